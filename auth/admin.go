@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mediocregopher/mediocre-api/auth/apitok"
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/pickyjson"
+)
+
+// The params taken in by the rate limit admin endpoints. Identifiers are given
+// in the query, since api tokens may contain slashes
+var (
+	rateLimitBucketParams = struct {
+		ID pickyjson.Str `json:"id"`
+	}{
+		ID: pickyjson.Str{}.Required(),
+	}
+
+	rateLimitBucketsParams = struct {
+		N pickyjson.Int64 `json:"n"`
+	}{
+		N: pickyjson.Int64{Min: 1, Max: 1000, Default: 20},
+	}
+
+	rateLimitCapacityParams = struct {
+		Capacity pickyjson.Str
+	}{
+		Capacity: pickyjson.Str{
+			Func: func(s string) bool {
+				d, err := time.ParseDuration(s)
+				return err == nil && d > 0
+			},
+		}.Required(),
+	}
+)
+
+// rateLimitLimits describes a RateLimiter's limits, as returned by Limits
+type rateLimitLimits struct {
+	Capacity, Interval, PerInterval string
+}
+
+// rateLimitBucket describes an apitok.Bucket
+type rateLimitBucket struct {
+	Identifier string
+	Remaining  string
+}
+
+// RateLimitAdmin returns an http.Handler serving endpoints for operators to
+// inspect and adjust the API's RateLimiter while it's running. Every request
+// must have an "Authorization: Bearer <token>" header. The endpoints are
+// described by the OpenAPI document served (without needing the token) at
+// /openapi.json. The handler expects to be mounted with its path prefix
+// stripped, e.g. using http.StripPrefix
+func (a *API) RateLimitAdmin(token string) http.Handler {
+	m := mux.NewRouter()
+	spec := apihelper.NewOpenAPI("rate-limit-admin", "1")
+	m.Path("/openapi.json").Handler(spec)
+	rl := a.RateLimiter
+
+	handle := func(
+		path string,
+		handlers map[string]http.HandlerFunc,
+		docs map[string]apihelper.Doc,
+	) {
+		m.Path(path).Handler(apihelper.RequireBearer(token, apihelper.Methods(handlers)))
+		for method, d := range docs {
+			d.Errors = append(d.Errors, apihelper.ErrNotAdmin)
+			spec.Add(path, method, d)
+		}
+	}
+
+	limits := func() *rateLimitLimits {
+		c, i, pi := rl.Limits()
+		return &rateLimitLimits{c.String(), i.String(), pi.String()}
+	}
+	handle("/limits", map[string]http.HandlerFunc{
+		"GET": func(w http.ResponseWriter, r *http.Request) {
+			apihelper.JSONSuccess(w, limits())
+		},
+	}, map[string]apihelper.Doc{
+		"GET": {Summary: "Get the rate limiter's current limits", Response: &rateLimitLimits{}},
+	})
+
+	handle("/limits/capacity", map[string]http.HandlerFunc{
+		"PUT": func(w http.ResponseWriter, r *http.Request) {
+			j := rateLimitCapacityParams
+			if !apihelper.Prepare(w, r, &j, 1024) {
+				return
+			}
+			d, _ := time.ParseDuration(j.Capacity.Str)
+			rl.SetCapacity(d)
+			apihelper.JSONSuccess(w, limits())
+		},
+	}, map[string]apihelper.Doc{
+		"PUT": {
+			Summary:  "Change the most time each bucket can hold, e.g. \"45s\". This lasts until the process restarts",
+			Body:     &rateLimitCapacityParams,
+			Response: &rateLimitLimits{},
+		},
+	})
+
+	handle("/bucket", map[string]http.HandlerFunc{
+		"GET": func(w http.ResponseWriter, r *http.Request) {
+			q := rateLimitBucketParams
+			if !apihelper.PrepareQuery(w, r, &q) {
+				return
+			}
+			apihelper.JSONSuccess(w, &rateLimitBucket{
+				Identifier: q.ID.Str,
+				Remaining:  rl.Remaining(q.ID.Str).String(),
+			})
+		},
+	}, map[string]apihelper.Doc{
+		"GET": {
+			Summary:  "Get how much time is left in the bucket of an api token (or IP address). It's rate limited if this isn't positive",
+			Query:    &rateLimitBucketParams,
+			Response: &rateLimitBucket{},
+		},
+	})
+
+	handle("/bucket/reset", map[string]http.HandlerFunc{
+		"POST": func(w http.ResponseWriter, r *http.Request) {
+			q := rateLimitBucketParams
+			if !apihelper.PrepareQuery(w, r, &q) {
+				return
+			}
+			common.HTTPError(w, r, rl.Reset(q.ID.Str))
+		},
+	}, map[string]apihelper.Doc{
+		"POST": {
+			Summary: "Fill the bucket of an api token (or IP address) back up, so it's no longer rate limited",
+			Query:   &rateLimitBucketParams,
+			Errors:  []common.ExpectedErr{apitok.ErrAdminUnsupported},
+		},
+	})
+
+	handle("/buckets", map[string]http.HandlerFunc{
+		"GET": func(w http.ResponseWriter, r *http.Request) {
+			q := rateLimitBucketsParams
+			if !apihelper.PrepareQuery(w, r, &q) {
+				return
+			}
+			bb, err := rl.MostThrottled(int(q.N.Int64))
+			if err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+			ret := make([]rateLimitBucket, len(bb))
+			for i, b := range bb {
+				ret[i] = rateLimitBucket{b.Identifier, b.Remaining.String()}
+			}
+			apihelper.JSONPage(w, ret, "", -1)
+		},
+	}, map[string]apihelper.Doc{
+		"GET": {
+			Summary:  "List the n most throttled api tokens (or IP addresses), i.e. those with the least time left in their buckets, least first",
+			Query:    &rateLimitBucketsParams,
+			Response: &[]rateLimitBucket{},
+			Page:     true,
+			Errors:   []common.ExpectedErr{apitok.ErrAdminUnsupported},
+		},
+	})
+
+	return m
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"net/http"
+	. "testing"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/auth/apitok"
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitAdmin(t *T) {
+	a := NewAPI()
+	a.RateLimiter.Interval = time.Hour
+	h := a.RateLimitAdmin("admin-token")
+	opts := &commontest.ReqOpts{
+		Header: http.Header{"Authorization": {"Bearer admin-token"}},
+	}
+
+	commontest.AssertReqErr(t, h, "GET", "/limits", "", apihelper.ErrNotAdmin)
+
+	var limits rateLimitLimits
+	commontest.AssertReqJSONWith(t, h, "GET", "/limits", "", opts, &limits)
+	assert.Equal(t, rateLimitLimits{"30s", "1h0m0s", "5s"}, limits)
+
+	commontest.AssertReqJSONWith(t, h, "PUT", "/limits/capacity", `{"Capacity":"1m"}`, opts, &limits)
+	assert.Equal(t, "1m0s", limits.Capacity)
+	resp := commontest.ReqWith(t, h, "PUT", "/limits/capacity", `{"Capacity":"soon"}`, opts)
+	assert.Equal(t, 400, resp.Code)
+
+	// api tokens may contain slashes
+	id := "foo/bar+baz="
+	a.RateLimiter.CanUseRaw(id)
+	a.RateLimiter.Use(id, 2*time.Minute)
+
+	var b rateLimitBucket
+	commontest.AssertReqJSONWith(t, h, "GET", "/bucket?id=foo%2Fbar%2Bbaz%3D", "", opts, &b)
+	assert.Equal(t, rateLimitBucket{id, "-1m0s"}, b)
+
+	var bb []rateLimitBucket
+	commontest.AssertReqJSONWith(t, h, "GET", "/buckets?n=1", "", opts, &commontest.Page{Data: &bb})
+	assert.Equal(t, []rateLimitBucket{{id, "-1m0s"}}, bb)
+
+	commontest.AssertReqWith(t, h, "POST", "/bucket/reset?id=foo%2Fbar%2Bbaz%3D", "", opts, "")
+	commontest.AssertReqJSONWith(t, h, "GET", "/bucket?id=foo%2Fbar%2Bbaz%3D", "", opts, &b)
+	assert.Equal(t, rateLimitBucket{id, "1m0s"}, b)
+
+	a.RateLimiter.Backend = struct{ apitok.RateLimitStore }{apitok.NewRateLimitMem()}
+	commontest.AssertReqErrWith(t, h, "GET", "/buckets", "", opts, apitok.ErrAdminUnsupported)
+}
@@ -6,25 +6,25 @@ package auth
 import (
 	"bytes"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/mediocregopher/mediocre-api/auth/apitok"
 	"github.com/mediocregopher/mediocre-api/auth/usertok"
 	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/xff"
 )
 
 // Various error responses this package may return (these will all be appended
 // with a newline in the final output)
 var (
-	ErrAPITokenMissing     = common.ExpectedErr{Code: 400, Err: "api token missing"}
-	ErrAPITokenInvalid     = common.ExpectedErr{Code: 400, Err: "api token invalid"}
-	ErrAPITokenRateLimited = common.ExpectedErr{Code: 420, Err: "chill bro"}
-	ErrIPAddrRateLimited   = common.ExpectedErr{Code: 420, Err: "chill bro"}
-	ErrUserTokenMissing    = common.ExpectedErr{Code: 400, Err: "user token missing"}
-	ErrUserTokenInvalid    = common.ExpectedErr{Code: 400, Err: "user token invalid"}
-	ErrSecretNotSet        = common.ExpectedErr{Code: 500, Err: "secret not set on server"}
-	ErrUnknownProblem      = common.ExpectedErr{Code: 500, Err: "unknown problem"}
+	ErrAPITokenMissing     = common.ExpectedErr{Code: 400, ID: "api_token_missing", Err: "api token missing"}
+	ErrAPITokenInvalid     = common.ExpectedErr{Code: 400, ID: "api_token_invalid", Err: "api token invalid"}
+	ErrAPITokenRateLimited = common.ExpectedErr{Code: 420, ID: "rate_limited", Err: "chill bro"}
+	ErrIPAddrRateLimited   = common.ExpectedErr{Code: 420, ID: "rate_limited", Err: "chill bro"}
+	ErrUserTokenMissing    = common.ExpectedErr{Code: 400, ID: "user_token_missing", Err: "user token missing"}
+	ErrUserTokenInvalid    = common.ExpectedErr{Code: 400, ID: "user_token_invalid", Err: "user token invalid"}
+	ErrSecretNotSet        = common.ExpectedErr{Code: 500, ID: "secret_not_set", Err: "secret not set on server"}
+	ErrUnknownProblem      = common.ExpectedErr{Code: 500, ID: "unknown_problem", Err: "unknown problem"}
 )
 
 // Various cookies which this package will look for
@@ -82,6 +82,12 @@ type handlerOpt struct {
 
 var blankHandlerOpt handlerOpt
 
+// SessionChecker is used to check whether a user token's session is still
+// valid, e.g. that it hasn't been revoked. *user.System implements it
+type SessionChecker interface {
+	ValidSession(user, session string) (bool, error)
+}
+
 // API can return an http.Handler which wraps around
 // another http.Handler, providing automatic rate-limiting and user
 // authentication
@@ -106,6 +112,20 @@ type API struct {
 	// successfully authenticate a user will have "?asUser=<username>" appended
 	// to their URL before being forwarded down the handler chain.
 	UserAuthGetParam string
+
+	// If set, user tokens are generated for this tenant, and only user tokens
+	// generated for it are accepted. This should match the Tenant of the user
+	// System whose users are being authenticated, so that users of one tenant
+	// can't use their tokens with another. Defaults to empty string (no
+	// tenant)
+	Tenant string
+
+	// If set, user tokens are only accepted if they were created with
+	// NewSessionUserToken, and Sessions says their session is still valid.
+	// This is what allows user tokens, which are otherwise stateless, to be
+	// revoked, e.g. when a user logs out everywhere. Defaults to nil (user
+	// tokens are valid forever)
+	Sessions SessionChecker
 }
 
 // NewAPI returns an API with all of its fields initialized to their default
@@ -143,21 +163,26 @@ func (a *API) NewUserToken(user string) string {
 	if a.Secret == nil {
 		return ""
 	}
-	return usertok.New(user, a.Secret)
+	return usertok.NewWithTenant(a.Tenant, user, a.Secret)
+}
+
+// NewSessionUserToken is like NewUserToken, but the token carries the given
+// session identifier, e.g. one returned from user.System's NewSession, which
+// is checked with Sessions whenever the token is used. Will return empty
+// string if Secret isn't set
+func (a *API) NewSessionUserToken(user, session string) string {
+	if a.Secret == nil {
+		return ""
+	}
+	return usertok.NewWithSession(a.Tenant, user, session, a.Secret)
 }
 
 // GetUser returns the user identifier held by the user token from the given
 // request. Returns empty string if the user token cookie isn't set or invalid,
 // or if Secret isn't set
 func (a *API) GetUser(r *http.Request) string {
-	if a.Secret == nil {
-		return ""
-	}
-	c, err := r.Cookie(UserTokenCookie)
-	if err != nil || c.Value == "" {
-		return ""
-	}
-	return usertok.ExtractUser(c.Value, a.Secret)
+	user, _ := a.authdUser(r)
+	return user
 }
 
 // Wrapper returns a function which takes in http.Handlers and wraps them,
@@ -174,10 +199,13 @@ func (a *API) Wrapper(flags HandlerFlag) func(http.Handler) http.Handler {
 			secret := a.Secret
 
 			if flags&IPRateLimited != 0 {
-				remoteIP := r.RemoteAddr[:strings.LastIndex(r.RemoteAddr, ":")]
+				remoteIP := r.RemoteAddr
+				if ip := xff.ClientIP(r); ip != nil {
+					remoteIP = ip.String()
+				}
 				switch a.RateLimiter.CanUseRaw(remoteIP) {
 				case apitok.Success:
-					token = r.RemoteAddr
+					token = remoteIP
 				case apitok.RateLimited:
 					common.HTTPError(w, r, ErrIPAddrRateLimited)
 					return
@@ -241,11 +269,21 @@ func (a *API) authdUser(r *http.Request) (string, error) {
 		return "", ErrUserTokenMissing
 	}
 
-	user := usertok.ExtractUser(c.Value, secret)
-	if user == "" {
+	tenant, user, session := usertok.ExtractSession(c.Value, secret)
+	if user == "" || tenant != a.Tenant {
 		return "", ErrUserTokenInvalid
 	}
 
+	if a.Sessions != nil {
+		if session == "" {
+			return "", ErrUserTokenInvalid
+		} else if ok, err := a.Sessions.ValidSession(user, session); err != nil {
+			return "", err
+		} else if !ok {
+			return "", ErrUserTokenInvalid
+		}
+	}
+
 	return user, nil
 }
 
@@ -100,3 +100,57 @@ func TestUserToken(t *T) {
 	assertReqErr(t, testMux, "POST", "/baz", apiTok, "blah blah blah", ErrUserTokenInvalid)
 	assertReq(t, testMux, "POST", "/baz", apiTok, userTok, username+"\n"+username)
 }
+
+func TestTenantUserToken(t *T) {
+	a := NewAPI()
+	a.Secret = testAPI.Secret
+	a.Tenant = "acme"
+	h := a.Wrapper(RequireUserAuthAlways)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, a.GetUser(r))
+		}),
+	)
+
+	username := "morty"
+	apiTok := a.NewAPIToken()
+	userTok := a.NewUserToken(username)
+	assertReq(t, h, "GET", "/", apiTok, userTok, username)
+
+	// Tokens for one tenant can't be used with another
+	assertReqErr(t, h, "GET", "/", apiTok, testAPI.NewUserToken(username), ErrUserTokenInvalid)
+	assertReqErr(t, testMux, "POST", "/baz", apiTok, userTok, ErrUserTokenInvalid)
+}
+
+// testSessions is a SessionChecker which considers the sessions in it valid
+type testSessions map[string]bool
+
+func (ts testSessions) ValidSession(user, session string) (bool, error) {
+	return ts[user+":"+session], nil
+}
+
+func TestSessionUserToken(t *T) {
+	sessions := testSessions{"morty:a": true, "morty:b": true}
+	a := NewAPI()
+	a.Secret = testAPI.Secret
+	a.Sessions = sessions
+	h := a.Wrapper(RequireUserAuthAlways)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, a.GetUser(r))
+		}),
+	)
+
+	username := "morty"
+	apiTok := a.NewAPIToken()
+	tokA := a.NewSessionUserToken(username, "a")
+	tokB := a.NewSessionUserToken(username, "b")
+	assertReq(t, h, "GET", "/", apiTok, tokA, username)
+	assertReq(t, h, "GET", "/", apiTok, tokB, username)
+
+	// Tokens without a session, or whose session isn't valid, aren't accepted
+	assertReqErr(t, h, "GET", "/", apiTok, a.NewUserToken(username), ErrUserTokenInvalid)
+	assertReqErr(t, h, "GET", "/", apiTok, a.NewSessionUserToken(username, "c"), ErrUserTokenInvalid)
+
+	delete(sessions, "morty:a")
+	assertReqErr(t, h, "GET", "/", apiTok, tokA, ErrUserTokenInvalid)
+	assertReq(t, h, "GET", "/", apiTok, tokB, username)
+}
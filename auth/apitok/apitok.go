@@ -2,11 +2,18 @@
 package apitok
 
 import (
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/mediocregopher/mediocre-api/auth/sig"
+	"github.com/mediocregopher/mediocre-api/common"
 )
 
+// ErrAdminUnsupported is returned from the RateLimiter's administrative methods
+// which need its Backend to implement RateLimitAdminStore, when it doesn't
+var ErrAdminUnsupported = common.ExpectedErr{Code: 501, ID: "rate_limit_admin_unsupported", Err: "rate limit store doesn't support administration"}
+
 // New returns an api token, signed with the given secret
 func New(secret []byte) string {
 	return sig.NewRand(secret, 3*time.Hour)
@@ -39,6 +46,10 @@ type RateLimiter struct {
 	// Where to actually store data pertaining to the RateLimiter. Default is
 	// a new instance of RateLimitMem (which stores all data in memory)
 	Backend RateLimitStore
+
+	// Protects Capacity, Interval, and PerInterval, so that SetCapacity may
+	// be called while the RateLimiter is in use
+	l sync.RWMutex
 }
 
 // NewRateLimiter returns a new RateLimiter initialized with all default values.
@@ -89,13 +100,14 @@ func (r *RateLimiter) CanUseRaw(identifier string) UseResult {
 	// always zero (since time since last modified is always so small), but
 	// enough time passes that time *should* have been added, it might happen
 	// that an app gets blocked when it shouldn't.
+	capacity, interval, perInterval := r.Limits()
 	lm := r.Backend.LastModified(identifier)
 	since := time.Since(lm)
-	toAdd := (since / r.Interval) * r.PerInterval
+	toAdd := (since / interval) * perInterval
 
 	var timeLeft int64
 	if toAdd > 0 {
-		timeLeft, _ = r.Backend.IncrByCeil(identifier, toAdd.Nanoseconds(), r.Capacity.Nanoseconds())
+		timeLeft, _ = r.Backend.IncrByCeil(identifier, toAdd.Nanoseconds(), capacity.Nanoseconds())
 	} else {
 		timeLeft = r.Backend.Get(identifier)
 	}
@@ -112,3 +124,83 @@ func (r *RateLimiter) CanUseRaw(identifier string) UseResult {
 func (r *RateLimiter) Use(identifier string, toRemove time.Duration) {
 	r.Backend.DecrBy(identifier, toRemove.Nanoseconds())
 }
+
+// Limits returns the Capacity, Interval, and PerInterval currently being used
+func (r *RateLimiter) Limits() (capacity, interval, perInterval time.Duration) {
+	r.l.RLock()
+	defer r.l.RUnlock()
+	return r.Capacity, r.Interval, r.PerInterval
+}
+
+// SetCapacity changes the Capacity, and may be called while the RateLimiter is
+// in use. Buckets which have more time in them than the new Capacity keep it
+// until they're next refilled
+func (r *RateLimiter) SetCapacity(capacity time.Duration) {
+	r.l.Lock()
+	defer r.l.Unlock()
+	r.Capacity = capacity
+}
+
+// remaining returns how much time would be in a bucket with the given value,
+// last modified at the given time, if it were refilled now
+func (r *RateLimiter) remaining(val int64, lm time.Time) time.Duration {
+	capacity, interval, perInterval := r.Limits()
+	if lm.IsZero() {
+		return capacity
+	}
+	d := time.Duration(val) + (time.Since(lm)/interval)*perInterval
+	if d > capacity {
+		d = capacity
+	}
+	return d
+}
+
+// Remaining returns how much time is left in the identifier's bucket. It may be
+// negative, in which case the identifier is being rate limited. The bucket
+// isn't modified
+func (r *RateLimiter) Remaining(identifier string) time.Duration {
+	return r.remaining(r.Backend.Get(identifier), r.Backend.LastModified(identifier))
+}
+
+// Reset fills the identifier's bucket back up to Capacity, so it's no longer
+// rate limited. Returns ErrAdminUnsupported if the Backend isn't a
+// RateLimitAdminStore
+func (r *RateLimiter) Reset(identifier string) error {
+	as, ok := r.Backend.(RateLimitAdminStore)
+	if !ok {
+		return ErrAdminUnsupported
+	}
+	capacity, _, _ := r.Limits()
+	as.Set(identifier, capacity.Nanoseconds())
+	return nil
+}
+
+// Bucket describes how much time is left in a single identifier's bucket
+type Bucket struct {
+	Identifier string
+	Remaining  time.Duration
+}
+
+// MostThrottled returns up to n of the identifiers which have the least time
+// left in their buckets, least first. Returns ErrAdminUnsupported if the
+// Backend isn't a RateLimitAdminStore
+func (r *RateLimiter) MostThrottled(n int) ([]Bucket, error) {
+	as, ok := r.Backend.(RateLimitAdminStore)
+	if !ok {
+		return nil, ErrAdminUnsupported
+	}
+	kvs := as.Lowest(n)
+	bb := make([]Bucket, len(kvs))
+	for i, kv := range kvs {
+		bb[i] = Bucket{
+			Identifier: kv.Key,
+			Remaining:  r.remaining(kv.Val, kv.LastModified),
+		}
+	}
+	// Buckets are refilled at different rates depending on when they were last
+	// modified, so the order may have changed
+	sort.SliceStable(bb, func(i, j int) bool {
+		return bb[i].Remaining < bb[j].Remaining
+	})
+	return bb, nil
+}
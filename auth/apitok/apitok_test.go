@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRateLimiter(t *T) {
@@ -32,3 +33,40 @@ func TestRateLimiter(t *T) {
 	time.Sleep(1 * time.Second)
 	assert.Equal(t, Success, r.CanUse(token, secret), "%#v", r.Backend)
 }
+
+func TestRateLimiterAdmin(t *T) {
+	r := NewRateLimiter()
+	r.Interval = time.Hour
+	assert.Equal(t, r.Capacity, r.Remaining("a"))
+
+	r.CanUseRaw("a")
+	r.Use("a", 40*time.Second)
+	r.CanUseRaw("b")
+	r.Use("b", 10*time.Second)
+	r.CanUseRaw("c")
+	assert.Equal(t, -10*time.Second, r.Remaining("a"))
+	assert.Equal(t, RateLimited, r.CanUseRaw("a"))
+
+	bb, err := r.MostThrottled(2)
+	require.Nil(t, err)
+	assert.Equal(t, []Bucket{
+		{Identifier: "a", Remaining: -10 * time.Second},
+		{Identifier: "b", Remaining: 20 * time.Second},
+	}, bb)
+
+	require.Nil(t, r.Reset("a"))
+	assert.Equal(t, r.Capacity, r.Remaining("a"))
+	assert.Equal(t, Success, r.CanUseRaw("a"))
+
+	// Lowering the capacity caps what's reported as remaining
+	r.SetCapacity(10 * time.Second)
+	capacity, _, _ := r.Limits()
+	assert.Equal(t, 10*time.Second, capacity)
+	assert.Equal(t, 10*time.Second, r.Remaining("c"))
+
+	// Stores which aren't RateLimitAdminStores can't be administered
+	r.Backend = struct{ RateLimitStore }{NewRateLimitMem()}
+	assert.Equal(t, ErrAdminUnsupported, r.Reset("a"))
+	_, err = r.MostThrottled(2)
+	assert.Equal(t, ErrAdminUnsupported, err)
+}
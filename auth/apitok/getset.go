@@ -1,6 +1,7 @@
 package apitok
 
 import (
+	"sort"
 	"sync"
 	"time"
 )
@@ -36,13 +37,33 @@ type RateLimitStore interface {
 	Clean(time.Duration)
 }
 
+// RateLimitAdminStore is a RateLimitStore which also supports the methods
+// needed by the RateLimiter's administrative methods, Reset and MostThrottled.
+// All methods must be thread-safe with each other
+type RateLimitAdminStore interface {
+	RateLimitStore
+
+	// Sets the given key to the given value
+	Set(key string, val int64)
+
+	// Returns up to n of the keys with the lowest values, lowest first
+	Lowest(n int) []KeyVal
+}
+
+// KeyVal describes a single key in a RateLimitStore, as returned by Lowest
+type KeyVal struct {
+	Key          string
+	Val          int64
+	LastModified time.Time
+}
+
 type keyval struct {
 	val   int64
 	tsMod time.Time
 }
 
-// RateLimitMem is an implementation of RateLimitStore which keeps all data in
-// memory protected by a mutex
+// RateLimitMem is an implementation of RateLimitAdminStore which keeps all data
+// in memory protected by a mutex
 type RateLimitMem struct {
 	m map[string]keyval
 	l sync.RWMutex
@@ -92,6 +113,34 @@ func (m *RateLimitMem) Get(key string) int64 {
 	return m.m[key].val
 }
 
+// Set is an implementation of Set for RateLimitAdminStore
+func (m *RateLimitMem) Set(key string, val int64) {
+	m.l.Lock()
+	defer m.l.Unlock()
+	m.m[key] = keyval{
+		val:   val,
+		tsMod: time.Now(),
+	}
+}
+
+// Lowest is an implementation of Lowest for RateLimitAdminStore
+func (m *RateLimitMem) Lowest(n int) []KeyVal {
+	m.l.RLock()
+	kvs := make([]KeyVal, 0, len(m.m))
+	for key, kv := range m.m {
+		kvs = append(kvs, KeyVal{Key: key, Val: kv.val, LastModified: kv.tsMod})
+	}
+	m.l.RUnlock()
+
+	sort.Slice(kvs, func(i, j int) bool {
+		return kvs[i].Val < kvs[j].Val
+	})
+	if len(kvs) > n {
+		kvs = kvs[:n]
+	}
+	return kvs
+}
+
 // LastModified is an implementation of LastModified for RateLimitStore
 func (m *RateLimitMem) LastModified(key string) time.Time {
 	m.l.RLock()
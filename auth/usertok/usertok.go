@@ -14,40 +14,85 @@ var b64 = base64.StdEncoding
 
 // New returns a new user token given a user identifying string and a secret
 func New(user string, secret []byte) string {
+	return NewWithTenant("", user, secret)
+}
+
+// NewWithTenant is like New, but the token is only valid for the given tenant,
+// see ExtractTenantUser. Tokens for the empty tenant are the same as those
+// returned by New
+func NewWithTenant(tenant, user string, secret []byte) string {
+	return NewWithSession(tenant, user, "", secret)
+}
+
+// NewWithSession is like NewWithTenant, but the token also carries the given
+// session identifier, see ExtractSession. This allows tokens to be revoked, by
+// having whatever checks them consult a registry of valid sessions. Tokens
+// for the empty session are the same as those returned by NewWithTenant
+func NewWithSession(tenant, user, session string, secret []byte) string {
 	shared := make([]byte, 16)
 	if _, err := rand.Read(shared); err != nil {
 		panic(err) // should probably do something else here....
 	}
-	userB := []byte(user)
 
-	userL := b64.EncodedLen(len(userB))
-	l := userL + b64.EncodedLen(len(shared)) + 1
-	data := make([]byte, l)
-	b64.Encode(data, userB)
-	data[userL] = ':'
-	b64.Encode(data[userL+1:], shared)
+	parts := [][]byte{
+		[]byte(b64.EncodeToString([]byte(user))),
+		[]byte(b64.EncodeToString(shared)),
+	}
+	if tenant != "" || session != "" {
+		parts = append(parts, []byte(b64.EncodeToString([]byte(tenant))))
+	}
+	if session != "" {
+		parts = append(parts, []byte(b64.EncodeToString([]byte(session))))
+	}
+	data := bytes.Join(parts, []byte(":"))
 
 	return sig.New(data, secret, 0)
 }
 
 // ExtractUser takes in a userTok as returned by New() and extracts the user
 // identifier that was passed into New() and returns it. Returns empty string if
-// the user token can't be extracted due to an invalid token
+// the user token can't be extracted due to an invalid token, or if it was made
+// for a tenant using NewWithTenant
 func ExtractUser(userTok string, secret []byte) string {
+	tenant, user := ExtractTenantUser(userTok, secret)
+	if tenant != "" {
+		return ""
+	}
+	return user
+}
+
+// ExtractTenantUser takes in a userTok as returned by New() or NewWithTenant()
+// and returns the tenant and user identifier that were passed in. The tenant is
+// empty for tokens returned by New. Returns empty strings if the user token
+// can't be extracted due to an invalid token
+func ExtractTenantUser(userTok string, secret []byte) (string, string) {
+	tenant, user, _ := ExtractSession(userTok, secret)
+	return tenant, user
+}
+
+// ExtractSession takes in a userTok as returned by any of the New functions and
+// returns the tenant, user identifier, and session identifier that were passed
+// in, any of which but the user may be empty. Returns empty strings if the
+// user token can't be extracted due to an invalid token
+func ExtractSession(userTok string, secret []byte) (string, string, string) {
 	data := sig.Extract(userTok, secret)
 	if data == nil {
-		return ""
+		return "", "", ""
 	}
 
-	parts := bytes.SplitN(data, []byte(":"), 2)
-	if len(parts) != 2 {
-		return ""
+	parts := bytes.Split(data, []byte(":"))
+	if len(parts) < 2 || len(parts) > 4 {
+		return "", "", ""
 	}
 
-	userB, err := b64.DecodeString(string(parts[0]))
-	if err != nil {
-		return ""
+	var decoded [4][]byte
+	for i, part := range parts {
+		b, err := b64.DecodeString(string(part))
+		if err != nil {
+			return "", "", ""
+		}
+		decoded[i] = b
 	}
 
-	return string(userB)
+	return string(decoded[2]), string(decoded[0]), string(decoded[3])
 }
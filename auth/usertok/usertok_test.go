@@ -31,3 +31,48 @@ func TestUserTok(t *T) {
 		}
 	}
 }
+
+func TestTenantUserTok(t *T) {
+	secret := []byte("secret")
+
+	userTok := NewWithTenant("acme", "foo", secret)
+	tenant, user := ExtractTenantUser(userTok, secret)
+	assert.Equal(t, "acme", tenant)
+	assert.Equal(t, "foo", user)
+	assert.Equal(t, "", ExtractUser(userTok, secret))
+
+	tenant, user = ExtractTenantUser(New("foo", secret), secret)
+	assert.Equal(t, "", tenant)
+	assert.Equal(t, "foo", user)
+
+	tenant, user = ExtractTenantUser(userTok, []byte("wrong"))
+	assert.Equal(t, "", tenant)
+	assert.Equal(t, "", user)
+}
+
+func TestSessionUserTok(t *T) {
+	secret := []byte("secret")
+
+	userTok := NewWithSession("", "foo", "sess", secret)
+	tenant, user, session := ExtractSession(userTok, secret)
+	assert.Equal(t, "", tenant)
+	assert.Equal(t, "foo", user)
+	assert.Equal(t, "sess", session)
+
+	userTok = NewWithSession("acme", "foo", "sess", secret)
+	tenant, user, session = ExtractSession(userTok, secret)
+	assert.Equal(t, "acme", tenant)
+	assert.Equal(t, "foo", user)
+	assert.Equal(t, "sess", session)
+	assert.Equal(t, "", ExtractUser(userTok, secret))
+
+	tenant, user, session = ExtractSession(NewWithTenant("acme", "foo", secret), secret)
+	assert.Equal(t, "acme", tenant)
+	assert.Equal(t, "foo", user)
+	assert.Equal(t, "", session)
+
+	tenant, user, session = ExtractSession(userTok, []byte("wrong"))
+	assert.Equal(t, "", tenant)
+	assert.Equal(t, "", user)
+	assert.Equal(t, "", session)
+}
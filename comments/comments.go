@@ -0,0 +1,328 @@
+// Package comments implements threaded comments on arbitrary entities (e.g.
+// rooms, broadcasts, or anything else with a string ID), stored in redis.
+// Comments can be created, edited, and soft-deleted by their authors, and
+// listed a page at a time, newest first
+package comments
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/user"
+	"github.com/mediocregopher/radix.v2/util"
+)
+
+// Errors which may be expected from various methods in this package
+var (
+	ErrNotFound    = common.ExpectedErr{Code: 404, ID: "comment_not_found", Err: "comment not found"}
+	ErrNotAuthor   = common.ExpectedErr{Code: 403, ID: "not_author", Err: "only a comment's author may change it"}
+	ErrDeleted     = common.ExpectedErr{Code: 400, ID: "comment_deleted", Err: "comment has been deleted"}
+	ErrEmptyBody   = common.ExpectedErr{Code: 400, ID: "empty_comment", Err: "comment body is empty"}
+	ErrBodyTooLong = common.ExpectedErr{Code: 400, ID: "comment_too_long", Err: "comment body is too long"}
+)
+
+// Comment is a single comment on an entity
+type Comment struct {
+	ID     string
+	Entity string
+
+	// The ID of the comment this is a reply to, or empty string if it's a
+	// top-level comment on the entity
+	Parent string
+
+	User string
+
+	// Empty once the comment has been deleted
+	Body string
+
+	TSCreated time.Time
+
+	// Zero if the comment has never been edited
+	TSEdited time.Time
+
+	Deleted bool
+
+	// The number of direct replies to the comment, including deleted ones
+	Replies int64
+}
+
+// System holds on to a Cmder and uses it to implement a comment system
+type System struct {
+	c common.Cmder
+	o *Opts
+}
+
+// Opts are different options which may be passed into New when creating a
+// system. They all have sane defaults which will cover most use cases
+type Opts struct {
+
+	// Prefix can be used if you wish to have two separate comment systems
+	// being persisted on the same Cmder. Prefix will be part of a string
+	// prepended to all key names
+	Prefix string
+
+	// If set, comments can only be created by users which exist in this user
+	// System and aren't disabled. Create returns user.ErrNotFound or
+	// user.ErrDisabled for any others
+	Users *user.System
+
+	// The maximum length of a comment's body, in bytes. Defaults to 10000
+	MaxLength int
+}
+
+// New returns a new System which will use the given Cmder as its persistence
+// layer. The passed in Opts may be used to modify behavior of the System, or
+// may be nil to just use the defaults
+func New(c common.Cmder, o *Opts) *System {
+	if o == nil {
+		o = &Opts{}
+	}
+	if o.MaxLength == 0 {
+		o.MaxLength = 10000
+	}
+	return &System{c: c, o: o}
+}
+
+// Key returns a key which can be used to interact with some arbitrary comment
+// data directly in redis. This is useful if more complicated, lower level
+// operations are needed to be done. All of an entity's comments are held in
+// keys starting with Key(entity), so they're all in the same cluster slot
+func (s *System) Key(entity string, extra ...string) string {
+	k := "comments:" + s.o.Prefix + ":{" + entity + "}"
+	if len(extra) > 0 {
+		k += ":" + strings.Join(extra, ":")
+	}
+	return k
+}
+
+// commentKey returns the key of the hash holding a single comment
+func (s *System) commentKey(entity, id string) string {
+	return s.Key(entity, "c", id)
+}
+
+// threadKey returns the key of the sorted set of the IDs of the comments
+// replying to the given parent, or the top-level comments if it's empty, each
+// scored by its creation time in microseconds
+func (s *System) threadKey(entity, parent string) string {
+	if parent == "" {
+		return s.Key(entity, "t")
+	}
+	return s.Key(entity, "t", parent)
+}
+
+func marshalTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	ts, _ := t.UTC().MarshalText()
+	return string(ts)
+}
+
+func unmarshalTime(ts string) time.Time {
+	var t time.Time
+	if ts != "" {
+		t.UnmarshalText([]byte(ts))
+	}
+	return t.UTC()
+}
+
+func newID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func (s *System) checkBody(body string) error {
+	if strings.TrimSpace(body) == "" {
+		return ErrEmptyBody
+	} else if len(body) > s.o.MaxLength {
+		return ErrBodyTooLong
+	}
+	return nil
+}
+
+// create creates the comment hash KEYS[1] with the fields and values in ARGV[4:]
+// and adds ARGV[1] to the sorted set KEYS[2] with score ARGV[2]. If KEYS[3] is
+// given it's the parent comment, which must exist and has its reply count,
+// ARGV[3], incremented. Returns 0 if the parent doesn't exist
+var create = `
+	if KEYS[3] then
+		if redis.call('EXISTS', KEYS[3]) == 0 then
+			return 0
+		end
+		redis.call('HINCRBY', KEYS[3], ARGV[3], 1)
+	end
+	redis.call('HMSET', KEYS[1], unpack(ARGV, 4))
+	redis.call('ZADD', KEYS[2], ARGV[2], ARGV[1])
+	return 1
+`
+
+// Create creates a new comment by the given user on the given entity, as a
+// reply to the comment with the ID parent, or as a top-level comment if parent
+// is empty. Returns ErrNotFound if the parent doesn't exist
+func (s *System) Create(entity, parent, u, body string) (Comment, error) {
+	if err := s.checkBody(body); err != nil {
+		return Comment{}, err
+	}
+	if s.o.Users != nil {
+		i, err := s.o.Users.Get(u, user.Private)
+		if err != nil {
+			return Comment{}, err
+		} else if i["Disabled"] != "" {
+			return Comment{}, user.ErrDisabled
+		}
+	}
+
+	c := Comment{
+		ID:        newID(),
+		Entity:    entity,
+		Parent:    parent,
+		User:      u,
+		Body:      body,
+		TSCreated: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	keys := []interface{}{s.commentKey(entity, c.ID), s.threadKey(entity, parent)}
+	if parent != "" {
+		keys = append(keys, s.commentKey(entity, parent))
+	}
+	args := append(keys,
+		c.ID, c.TSCreated.UnixNano()/1000, "r",
+		"u", c.User, "b", c.Body, "p", c.Parent, "tc", marshalTime(c.TSCreated),
+	)
+	created, err := util.LuaEval(s.c, create, len(keys), args...).Int()
+	if err != nil {
+		return Comment{}, err
+	} else if created == 0 {
+		return Comment{}, ErrNotFound
+	}
+	return c, nil
+}
+
+// Get returns the comment on the given entity with the given ID, or
+// ErrNotFound. Deleted comments are still returned, with Deleted set
+func (s *System) Get(entity, id string) (Comment, error) {
+	m, err := s.c.Cmd("HGETALL", s.commentKey(entity, id)).Map()
+	if err != nil {
+		return Comment{}, err
+	} else if len(m) == 0 {
+		return Comment{}, ErrNotFound
+	}
+	replies, _ := strconv.ParseInt(m["r"], 10, 64)
+	return Comment{
+		ID:        id,
+		Entity:    entity,
+		Parent:    m["p"],
+		User:      m["u"],
+		Body:      m["b"],
+		TSCreated: unmarshalTime(m["tc"]),
+		TSEdited:  unmarshalTime(m["te"]),
+		Deleted:   m["d"] != "",
+		Replies:   replies,
+	}, nil
+}
+
+// change sets the fields and values in ARGV[2:] on the comment hash KEYS[1],
+// deleting any field whose value is empty, but only if the comment exists, its
+// author is ARGV[1] (unless that's empty), and it hasn't been deleted. Returns 1
+// if the fields were set, 0 if the comment doesn't exist, -1 if it has a
+// different author, and -2 if it's been deleted
+var change = `
+	local author = redis.call('HGET', KEYS[1], 'u')
+	if not author then
+		return 0
+	end
+	if ARGV[1] ~= '' and author ~= ARGV[1] then
+		return -1
+	end
+	local deleted = redis.call('HGET', KEYS[1], 'd')
+	if deleted and deleted ~= '' then
+		return -2
+	end
+	for i=2,#ARGV,2 do
+		if ARGV[i+1] == '' then
+			redis.call('HDEL', KEYS[1], ARGV[i])
+		else
+			redis.call('HSET', KEYS[1], ARGV[i], ARGV[i+1])
+		end
+	end
+	return 1
+`
+
+// changeAuthored sets the given fields and values on the comment, as the
+// change script does, returning ErrNotFound, ErrNotAuthor, or ErrDeleted if it
+// doesn't
+func (s *System) changeAuthored(entity, id, u string, fieldVals ...interface{}) error {
+	args := append([]interface{}{s.commentKey(entity, id), u}, fieldVals...)
+	i, err := util.LuaEval(s.c, change, 1, args...).Int()
+	if err != nil {
+		return err
+	}
+	switch i {
+	case 0:
+		return ErrNotFound
+	case -1:
+		return ErrNotAuthor
+	case -2:
+		return ErrDeleted
+	}
+	return nil
+}
+
+// Edit changes the body of the comment on the given entity with the given ID.
+// Returns ErrNotAuthor if the given user isn't the comment's author, unless the
+// user is empty (e.g. for moderators), and ErrDeleted if the comment has been
+// deleted
+func (s *System) Edit(entity, id, u, body string) error {
+	if err := s.checkBody(body); err != nil {
+		return err
+	}
+	now := marshalTime(time.Now().UTC())
+	return s.changeAuthored(entity, id, u, "b", body, "te", now)
+}
+
+// Delete marks the comment on the given entity with the given ID as deleted
+// and removes its body. The comment itself is kept, with Deleted set, so that
+// its replies are still part of the thread. Returns ErrNotAuthor if the given
+// user isn't the comment's author, unless the user is empty (e.g. for
+// moderators), and ErrDeleted if it was already deleted
+func (s *System) Delete(entity, id, u string) error {
+	return s.changeAuthored(entity, id, u, "d", "1", "b", "")
+}
+
+// List returns up to limit comments on the given entity which reply to the
+// comment with the ID parent, or the top-level comments if parent is empty,
+// newest first. Only comments created before the given time are returned,
+// unless it's zero, so the next page can be fetched by passing in the
+// TSCreated of the last comment returned
+func (s *System) List(entity, parent string, before time.Time, limit int) ([]Comment, error) {
+	if limit < 1 {
+		return []Comment{}, nil
+	}
+	max := "+inf"
+	if !before.IsZero() {
+		max = "(" + strconv.FormatInt(before.UnixNano()/1000, 10)
+	}
+	ids, err := s.c.Cmd(
+		"ZREVRANGEBYSCORE", s.threadKey(entity, parent), max, "-inf",
+		"LIMIT", 0, limit,
+	).List()
+	if err != nil {
+		return nil, err
+	}
+
+	cc := make([]Comment, 0, len(ids))
+	for _, id := range ids {
+		c, err := s.Get(entity, id)
+		if err != nil {
+			return nil, err
+		}
+		cc = append(cc, c)
+	}
+	return cc, nil
+}
@@ -0,0 +1,169 @@
+package comments
+
+import (
+	"strings"
+	"sync"
+	. "testing"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/mediocregopher/mediocre-api/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSystem(t *T) *System {
+	p := commontest.APIStarterKit()
+	return New(p, &Opts{Prefix: commontest.KeyPrefix(t, p), MaxLength: 100})
+}
+
+func TestCreateGet(t *T) {
+	s := testSystem(t)
+	entity, u := commontest.RandStr(), commontest.RandStr()
+
+	_, err := s.Create(entity, "", u, " ")
+	assert.Equal(t, ErrEmptyBody, err)
+	_, err = s.Create(entity, "", u, strings.Repeat("a", 101))
+	assert.Equal(t, ErrBodyTooLong, err)
+	_, err = s.Create(entity, "nope", u, "hi")
+	assert.Equal(t, ErrNotFound, err)
+
+	start := time.Now()
+	c, err := s.Create(entity, "", u, "hi")
+	require.Nil(t, err)
+	assert.NotEmpty(t, c.ID)
+	assert.WithinDuration(t, start, c.TSCreated, time.Second)
+
+	cGot, err := s.Get(entity, c.ID)
+	require.Nil(t, err)
+	assert.Equal(t, c, cGot)
+
+	_, err = s.Get(commontest.RandStr(), c.ID)
+	assert.Equal(t, ErrNotFound, err)
+
+	reply, err := s.Create(entity, c.ID, commontest.RandStr(), "hello")
+	require.Nil(t, err)
+	assert.Equal(t, c.ID, reply.Parent)
+
+	cGot, err = s.Get(entity, c.ID)
+	require.Nil(t, err)
+	assert.Equal(t, int64(1), cGot.Replies)
+}
+
+func TestEditDelete(t *T) {
+	s := testSystem(t)
+	entity, u := commontest.RandStr(), commontest.RandStr()
+	c, err := s.Create(entity, "", u, "hi")
+	require.Nil(t, err)
+	reply, err := s.Create(entity, c.ID, u, "reply")
+	require.Nil(t, err)
+
+	assert.Equal(t, ErrNotAuthor, s.Edit(entity, c.ID, "someone-else", "bye"))
+	assert.Equal(t, ErrEmptyBody, s.Edit(entity, c.ID, u, ""))
+	assert.Equal(t, ErrNotFound, s.Edit(entity, "nope", u, "bye"))
+
+	require.Nil(t, s.Edit(entity, c.ID, u, "bye"))
+	cGot, err := s.Get(entity, c.ID)
+	require.Nil(t, err)
+	assert.Equal(t, "bye", cGot.Body)
+	assert.WithinDuration(t, time.Now(), cGot.TSEdited, time.Second)
+
+	// Moderators don't need to be the author
+	require.Nil(t, s.Edit(entity, c.ID, "", "moderated"))
+
+	assert.Equal(t, ErrNotAuthor, s.Delete(entity, c.ID, "someone-else"))
+	require.Nil(t, s.Delete(entity, c.ID, u))
+	assert.Equal(t, ErrDeleted, s.Delete(entity, c.ID, u))
+	assert.Equal(t, ErrDeleted, s.Edit(entity, c.ID, u, "back"))
+
+	cGot, err = s.Get(entity, c.ID)
+	require.Nil(t, err)
+	assert.True(t, cGot.Deleted)
+	assert.Empty(t, cGot.Body)
+
+	// The deleted comment is still in the thread, and so are its replies
+	l, err := s.List(entity, "", time.Time{}, 10)
+	require.Nil(t, err)
+	assert.Equal(t, []Comment{cGot}, l)
+	l, err = s.List(entity, c.ID, time.Time{}, 10)
+	require.Nil(t, err)
+	assert.Equal(t, []Comment{reply}, l)
+}
+
+func TestEditDeleteRace(t *T) {
+	s := testSystem(t)
+	entity, u := commontest.RandStr(), commontest.RandStr()
+	c, err := s.Create(entity, "", u, "hi")
+	require.Nil(t, err)
+
+	// Edits racing a delete either happen before it or fail, and never put a
+	// body back on the deleted comment
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Edit(entity, c.ID, u, "bye"); err != nil {
+				assert.Equal(t, ErrDeleted, err)
+			}
+		}()
+	}
+	require.Nil(t, s.Delete(entity, c.ID, u))
+	wg.Wait()
+
+	cGot, err := s.Get(entity, c.ID)
+	require.Nil(t, err)
+	assert.True(t, cGot.Deleted)
+	assert.Empty(t, cGot.Body)
+}
+
+func TestList(t *T) {
+	s := testSystem(t)
+	entity := commontest.RandStr()
+
+	var cc []Comment
+	for i := 0; i < 5; i++ {
+		c, err := s.Create(entity, "", commontest.RandStr(), "hi")
+		require.Nil(t, err)
+		cc = append([]Comment{c}, cc...)
+		time.Sleep(time.Millisecond)
+	}
+	_, err := s.Create(entity, cc[0].ID, commontest.RandStr(), "reply")
+	require.Nil(t, err)
+	cc[0].Replies = 1
+
+	l, err := s.List(entity, "", time.Time{}, 2)
+	require.Nil(t, err)
+	assert.Equal(t, cc[:2], l)
+
+	l, err = s.List(entity, "", l[1].TSCreated, 2)
+	require.Nil(t, err)
+	assert.Equal(t, cc[2:4], l)
+
+	l, err = s.List(entity, "", l[1].TSCreated, 2)
+	require.Nil(t, err)
+	assert.Equal(t, cc[4:], l)
+
+	l, err = s.List(commontest.RandStr(), "", time.Time{}, 2)
+	require.Nil(t, err)
+	assert.Empty(t, l)
+}
+
+func TestCreateUsers(t *T) {
+	p := commontest.APIStarterKit()
+	us := user.New(p)
+	us.Prefix = commontest.KeyPrefix(t, p)
+	s := New(p, &Opts{Prefix: commontest.KeyPrefix(t, p), Users: us})
+
+	entity, u := commontest.RandStr(), commontest.RandStr()
+	_, err := s.Create(entity, "", u, "hi")
+	assert.Equal(t, user.ErrNotFound, err)
+
+	require.Nil(t, us.Create(u, commontest.RandEmail(), commontest.RandStr()))
+	_, err = s.Create(entity, "", u, "hi")
+	require.Nil(t, err)
+
+	require.Nil(t, us.Disable(u))
+	_, err = s.Create(entity, "", u, "hi")
+	assert.Equal(t, user.ErrDisabled, err)
+}
@@ -0,0 +1,197 @@
+package apihelper
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/xff"
+)
+
+// AccessLogEntry describes a single request handled by the AccessLog
+// middleware
+type AccessLogEntry struct {
+	Time      time.Time     `json:"time"`
+	Method    string        `json:"method"`
+	Path      string        `json:"path"`
+	Status    int           `json:"status"`
+	Size      int64         `json:"size"`
+	Latency   time.Duration `json:"latency"`
+	User      string        `json:"user,omitempty"`
+	ClientIP  string        `json:"client_ip"`
+	RequestID string        `json:"request_id,omitempty"`
+}
+
+// String returns the entry formatted as a single line of key=value pairs
+func (e AccessLogEntry) String() string {
+	s := fmt.Sprintf(
+		"method=%s path=%q status=%d size=%d latency=%s client_ip=%s",
+		e.Method, e.Path, e.Status, e.Size, e.Latency, e.ClientIP,
+	)
+	if e.User != "" {
+		s += fmt.Sprintf(" user=%q", e.User)
+	}
+	if e.RequestID != "" {
+		s += " request_id=" + e.RequestID
+	}
+	return s
+}
+
+// AccessLogOpts are different options which may be passed into AccessLog. They
+// all have sane defaults which will cover most use cases
+type AccessLogOpts struct {
+
+	// Sink is called with each entry once its request has been handled.
+	// Defaults to LoggerSink(common.Log)
+	Sink func(AccessLogEntry)
+
+	// User, if set, is used to determine the authenticated user making the
+	// request, if any. auth.API's GetUser method can be used here. Defaults
+	// to nil, meaning the user is never logged
+	User func(*http.Request) string
+}
+
+// AccessLog wraps the given http.Handler, producing an AccessLogEntry for each
+// request which passes through it. The client's ip is determined using
+// xff.ClientIP, so this should be placed inside of the xff middleware if it's
+// being used. The passed in AccessLogOpts may be used to modify its behavior,
+// or may be nil to just use the defaults
+func AccessLog(h http.Handler, o *AccessLogOpts) http.Handler {
+	if o == nil {
+		o = &AccessLogOpts{}
+	}
+	if o.Sink == nil {
+		o.Sink = LoggerSink(common.Log)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		e := AccessLogEntry{
+			Time:      start,
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			RequestID: common.RequestID(r),
+		}
+		if ip := xff.ClientIP(r); ip != nil {
+			e.ClientIP = ip.String()
+		} else {
+			e.ClientIP = r.RemoteAddr
+		}
+		if o.User != nil {
+			e.User = o.User(r)
+		}
+
+		sw := &statusWriter{ResponseWriter: w}
+		h.ServeHTTP(sw, r)
+
+		e.Status, e.Size = sw.status, sw.size
+		if e.Status == 0 {
+			e.Status = 200
+		}
+		e.Latency = time.Since(start)
+		o.Sink(e)
+	})
+}
+
+// RequestID wraps the given http.Handler, making sure every request which
+// passes through it has a request ID. If the client sent a valid one in the
+// common.RequestIDHeader it's kept, otherwise a new random one is generated.
+// The ID is set on the request (see common.WithRequestID) and in its
+// common.RequestIDHeader, so that it's passed along to any upstreams the
+// request is forwarded to, and in the response's common.RequestIDHeader. This
+// should wrap AccessLog so that the ID is included in the access log
+func RequestID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(common.RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		r = common.WithRequestID(r, id)
+		r.Header.Set(common.RequestIDHeader, id)
+		w.Header().Set(common.RequestIDHeader, id)
+		h.ServeHTTP(w, r)
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// validRequestID returns whether the given request ID, which came from a
+// client, is reasonable to use and to write to logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// LoggerSink returns an AccessLog sink which writes each entry to the given
+// Logger as a line of key=value pairs. If the Logger is nil nothing is written
+func LoggerSink(l common.Logger) func(AccessLogEntry) {
+	return func(e AccessLogEntry) {
+		if l != nil {
+			l.Printf("%s", e)
+		}
+	}
+}
+
+// JSONSink returns an AccessLog sink which writes each entry to the given
+// io.Writer as a json object followed by a newline. It is safe to use from
+// multiple go-routines
+func JSONSink(w io.Writer) func(AccessLogEntry) {
+	var l sync.Mutex
+	enc := json.NewEncoder(w)
+	return func(e AccessLogEntry) {
+		l.Lock()
+		defer l.Unlock()
+		enc.Encode(e)
+	}
+}
+
+// statusWriter wraps an http.ResponseWriter, keeping track of the status code
+// and number of bytes written to it
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	if sw.status == 0 {
+		sw.status = code
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = 200
+	}
+	n, err := sw.ResponseWriter.Write(b)
+	sw.size += int64(n)
+	return n, err
+}
+
+// Flush implements the http.Flusher interface, so that streaming responses
+// still work through the AccessLog middleware
+func (sw *statusWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -3,18 +3,22 @@
 package apihelper
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"sort"
+	"strings"
 
 	"github.com/mediocregopher/mediocre-api/common"
 	"github.com/mediocregopher/mediocre-api/pickyjson"
 )
 
 // ErrUnlessMethod checks that the given request is using one of the given
-// HTTP methods. If it is not than an error is sent back to the client and true
-// is returned
+// HTTP methods. If it is not then a 405 is sent back to the client, with an
+// Allow header listing the given methods, and true is returned
 func ErrUnlessMethod(
 	w http.ResponseWriter, r *http.Request, methods ...string,
 ) bool {
@@ -23,8 +27,71 @@ func ErrUnlessMethod(
 			return false
 		}
 	}
-	http.Error(w, "invalid method", 400)
-	return false
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, "method not allowed", 405)
+	return true
+}
+
+// Methods returns an http.Handler which passes each request off to the handler
+// for its method in the given map. If there's no handler for the method a 405
+// is sent back to the client, with an Allow header listing the methods which
+// are handled. HEAD requests are handled by the GET handler if there isn't one
+// specifically for HEAD, and OPTIONS requests are responded to with the Allow
+// header if there isn't a handler for OPTIONS
+//
+//	m.Handle("/{user}", apihelper.Methods(map[string]http.HandlerFunc{
+//		"GET":  getUser,
+//		"POST": setUser,
+//	}))
+func Methods(handlers map[string]http.HandlerFunc) http.Handler {
+	allowed := make([]string, 0, len(handlers)+2)
+	for method := range handlers {
+		allowed = append(allowed, method)
+	}
+	if _, ok := handlers["GET"]; ok {
+		if _, ok := handlers["HEAD"]; !ok {
+			allowed = append(allowed, "HEAD")
+		}
+	}
+	if _, ok := handlers["OPTIONS"]; !ok {
+		allowed = append(allowed, "OPTIONS")
+	}
+	sort.Strings(allowed)
+	allow := strings.Join(allowed, ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h, ok := handlers[r.Method]; ok {
+			h(w, r)
+		} else if h, ok := handlers["GET"]; ok && r.Method == "HEAD" {
+			h(w, r)
+		} else if r.Method == "OPTIONS" {
+			w.Header().Set("Allow", allow)
+			w.WriteHeader(204)
+		} else {
+			w.Header().Set("Allow", allow)
+			http.Error(w, "method not allowed", 405)
+		}
+	})
+}
+
+// ErrNotAdmin is returned by handlers wrapped with RequireBearer when the
+// request doesn't have the token, which is generally an admin token
+var ErrNotAdmin = common.ExpectedErr{Code: 401, ID: "not_admin", Err: "admin token missing or invalid"}
+
+// RequireBearer returns an http.Handler which only passes requests on to the
+// given one if they have the given token as their bearer token, i.e. an
+// "Authorization: Bearer <token>" header. Other requests get ErrNotAdmin
+func RequireBearer(token string, h http.Handler) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			common.HTTPError(w, r, ErrNotAdmin)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
 }
 
 // Prepare takes in a request and its response, and performs the following
@@ -36,8 +103,8 @@ func ErrUnlessMethod(
 // * Replace r.Body with a MaxBytesReader which will stop the reading at the
 // given bodySizeLimit
 //
-// * If params isn't nil attempt to json.Unmarshal the request body into it. If
-// that fails an error is sent to the client and false is returned
+// * If params isn't nil attempt to pickyjson.Unmarshal the request body into
+// it. If that fails an error is sent to the client and false is returned
 //
 func Prepare(
 	w http.ResponseWriter, r *http.Request, params interface{},
@@ -45,10 +112,19 @@ func Prepare(
 ) bool {
 	r.Body = http.MaxBytesReader(w, r.Body, bodySizeLimit)
 	if params != nil {
-		if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
 			http.Error(w, err.Error(), 400)
 			return false
 		}
+		if err := pickyjson.Unmarshal(b, params); err != nil {
+			if _, ok := err.(common.ExpectedErr); ok {
+				common.HTTPError(w, r, err)
+			} else {
+				http.Error(w, err.Error(), 400)
+			}
+			return false
+		}
 		if err := pickyjson.CheckRequired(params); err != nil {
 			common.HTTPError(w, r, err)
 			return false
@@ -62,6 +138,29 @@ func Prepare(
 	return true
 }
 
+// PrepareQuery is like Prepare, but binds the request's url query parameters
+// into params instead of its body, using pickyjson.UnmarshalValues. params must
+// be a pointer to a struct whose fields are pickyjson types (or anything else
+// which can be unmarshalled from json). If binding fails or a required
+// parameter is missing an error is sent to the client and false is returned
+func PrepareQuery(
+	w http.ResponseWriter, r *http.Request, params interface{},
+) bool {
+	if err := pickyjson.UnmarshalValues(r.URL.Query(), params); err != nil {
+		if _, ok := err.(common.ExpectedErr); ok {
+			common.HTTPError(w, r, err)
+		} else {
+			http.Error(w, err.Error(), 400)
+		}
+		return false
+	}
+	if err := pickyjson.CheckRequired(params); err != nil {
+		common.HTTPError(w, r, err)
+		return false
+	}
+	return true
+}
+
 // JSONSuccess json encodes the given return value and writes that to the given
 // io.Writer (presumably an http.ResponseWriter)
 func JSONSuccess(w io.Writer, i interface{}) {
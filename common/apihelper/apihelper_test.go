@@ -0,0 +1,321 @@
+package apihelper
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	. "testing"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/pickyjson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelope(t *T) {
+	w := httptest.NewRecorder()
+	JSONData(w, map[string]int{"a": 1})
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, `{"data":{"a":1}}`+"\n", w.Body.String())
+
+	w = httptest.NewRecorder()
+	JSONPage(w, []string{"a", "b"}, "next", 10)
+	assert.Equal(t, `{"data":["a","b"],"meta":{"cursor":"next","total":10}}`+"\n", w.Body.String())
+
+	w = httptest.NewRecorder()
+	JSONPage(w, []string{}, "", -1)
+	assert.Equal(t, `{"data":[],"meta":{"cursor":""}}`+"\n", w.Body.String())
+
+	w = httptest.NewRecorder()
+	JSONPage(w, []string(nil), "", 0)
+	assert.Equal(t, `{"data":[],"meta":{"cursor":"","total":0}}`+"\n", w.Body.String())
+
+	r, err := http.NewRequest("GET", "/", nil)
+	require.Nil(t, err)
+
+	w = httptest.NewRecorder()
+	JSONError(w, r, common.ExpectedErr{Code: 404, ID: "nope", Err: "not found"})
+	assert.Equal(t, 404, w.Code)
+	assert.Equal(t, `{"error":{"code":404,"id":"nope","error":"not found"}}`+"\n", w.Body.String())
+
+	w = httptest.NewRecorder()
+	JSONError(w, r, errors.New("internal"))
+	assert.Equal(t, 500, w.Code)
+	assert.Equal(t, `{"error":{"code":500,"id":"unknown","error":"unknown server-side error"}}`+"\n", w.Body.String())
+}
+
+func TestAccessLog(t *T) {
+	var entries []AccessLogEntry
+	h := AccessLog(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/missing" {
+				http.Error(w, "nope", 404)
+				return
+			}
+			w.Write([]byte("hello"))
+		}),
+		&AccessLogOpts{
+			Sink: func(e AccessLogEntry) { entries = append(entries, e) },
+			User: func(r *http.Request) string { return r.Header.Get("X-User") },
+		},
+	)
+
+	r, err := http.NewRequest("GET", "/foo?a=b", nil)
+	require.Nil(t, err)
+	r.RemoteAddr = "1.2.3.4:5678"
+	r.Header.Set("X-User", "bob")
+	r.Header.Set(common.RequestIDHeader, "abc")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	r, err = http.NewRequest("POST", "/missing", nil)
+	require.Nil(t, err)
+	r.RemoteAddr = "1.2.3.4:5678"
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	require.Len(t, entries, 2)
+	e := entries[0]
+	assert.Equal(t, "GET", e.Method)
+	assert.Equal(t, "/foo", e.Path)
+	assert.Equal(t, 200, e.Status)
+	assert.Equal(t, int64(5), e.Size)
+	assert.Equal(t, "bob", e.User)
+	assert.Equal(t, "1.2.3.4", e.ClientIP)
+	assert.Equal(t, "abc", e.RequestID)
+	e.Latency = 0
+	assert.Equal(t,
+		`method=GET path="/foo" status=200 size=5 latency=0s client_ip=1.2.3.4 user="bob" request_id=abc`,
+		e.String(),
+	)
+
+	e = entries[1]
+	assert.Equal(t, "POST", e.Method)
+	assert.Equal(t, 404, e.Status)
+	assert.Empty(t, e.User)
+}
+
+func TestRequestID(t *T) {
+	var seen string
+	h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = common.RequestID(r)
+		assert.Equal(t, seen, r.Header.Get(common.RequestIDHeader))
+	}))
+
+	doReq := func(id string) string {
+		r := httptest.NewRequest("GET", "/", nil)
+		if id != "" {
+			r.Header.Set(common.RequestIDHeader, id)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, seen, w.Header().Get(common.RequestIDHeader))
+		return seen
+	}
+
+	// Valid IDs from the client are kept, others are replaced with new ones
+	assert.Equal(t, "abc-123", doReq("abc-123"))
+	id := doReq("")
+	assert.Len(t, id, 32)
+	assert.NotEqual(t, id, doReq(""))
+	assert.Len(t, doReq("bad id"), 32)
+	assert.Len(t, doReq(strings.Repeat("a", 129)), 32)
+}
+
+func TestPrepareQuery(t *T) {
+	doReq := func(query string) (*httptest.ResponseRecorder, bool, int64) {
+		params := struct {
+			User  pickyjson.Str   `json:"user"`
+			Limit pickyjson.Int64 `json:"limit"`
+		}{
+			User:  pickyjson.Username.Required(),
+			Limit: pickyjson.Int64{Max: 100, Default: 10},
+		}
+		r, err := http.NewRequest("GET", "/?"+query, nil)
+		require.Nil(t, err)
+		w := httptest.NewRecorder()
+		ok := PrepareQuery(w, r, &params)
+		return w, ok, params.Limit.Int64
+	}
+
+	_, ok, limit := doReq("user=bob")
+	assert.True(t, ok)
+	assert.Equal(t, int64(10), limit)
+
+	_, ok, limit = doReq("user=bob&limit=20")
+	assert.True(t, ok)
+	assert.Equal(t, int64(20), limit)
+
+	w, ok, _ := doReq("limit=20")
+	assert.False(t, ok)
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, "field user required\n", w.Body.String())
+
+	w, ok, _ = doReq("user=bob&limit=200")
+	assert.False(t, ok)
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, "field limit too big\n", w.Body.String())
+}
+
+func TestErrUnlessMethod(t *T) {
+	r, err := http.NewRequest("POST", "/", nil)
+	require.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	assert.False(t, ErrUnlessMethod(w, r, "GET", "POST"))
+	assert.Equal(t, 200, w.Code)
+
+	w = httptest.NewRecorder()
+	assert.True(t, ErrUnlessMethod(w, r, "GET", "PUT"))
+	assert.Equal(t, 405, w.Code)
+	assert.Equal(t, "GET, PUT", w.Header().Get("Allow"))
+}
+
+func TestMethods(t *T) {
+	h := Methods(map[string]http.HandlerFunc{
+		"GET":  func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("get")) },
+		"POST": func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("post")) },
+	})
+
+	doReq := func(method string) *httptest.ResponseRecorder {
+		r, err := http.NewRequest(method, "/", nil)
+		require.Nil(t, err)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, "get", doReq("GET").Body.String())
+	assert.Equal(t, "post", doReq("POST").Body.String())
+	assert.Equal(t, 200, doReq("HEAD").Code)
+
+	w := doReq("OPTIONS")
+	assert.Equal(t, 204, w.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS, POST", w.Header().Get("Allow"))
+
+	w = doReq("DELETE")
+	assert.Equal(t, 405, w.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS, POST", w.Header().Get("Allow"))
+}
+
+func TestRequireBearer(t *T) {
+	h := RequireBearer("secret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	doReq := func(auth string) *httptest.ResponseRecorder {
+		r, err := http.NewRequest("GET", "/", nil)
+		require.Nil(t, err)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := doReq("Bearer secret")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "ok", w.Body.String())
+
+	for _, auth := range []string{"", "Bearer nope", "secret", "Basic secret"} {
+		w = doReq(auth)
+		assert.Equal(t, ErrNotAdmin.Code, w.Code, auth)
+		assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"), auth)
+	}
+}
+
+func TestOpenAPI(t *T) {
+	errFoo := common.ExpectedErr{Code: 400, ID: "foo", Err: "foo happened"}
+	errBar := common.ExpectedErr{Code: 400, ID: "bar", Err: "bar happened"}
+
+	o := NewOpenAPI("test", "1")
+	o.Add("/{user:[a-z]+}/thing", "POST", Doc{
+		Summary: "Make a thing",
+		Body:    &struct{ Name pickyjson.Str }{pickyjson.Str{MinLength: 1}},
+		AsUser:  true,
+		Response: &struct {
+			ID string
+		}{},
+		Errors: []common.ExpectedErr{errFoo, errBar},
+	})
+
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/openapi.json", nil)
+	require.Nil(t, err)
+	o.ServeHTTP(w, r)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{
+		"openapi": "3.0.3",
+		"info": {"title": "test", "version": "1"},
+		"paths": {"/{user}/thing": {"post": {
+			"summary": "Make a thing",
+			"parameters": [
+				{"name": "user", "in": "path", "required": true, "schema": {"type": "string"}},
+				{"name": "_asUser", "in": "query", "schema": {"type": "string"},
+				 "description": "The user the request is being made on behalf of, which shield sets to the logged in user"}
+			],
+			"requestBody": {"required": true, "content": {"application/json": {"schema": {
+				"type": "object",
+				"properties": {"Name": {"type": "string", "minLength": 1}},
+				"required": ["Name"]
+			}}}},
+			"responses": {
+				"200": {"description": "Success", "content": {"application/json": {"schema": {
+					"type": "object",
+					"properties": {"ID": {"type": "string"}}
+				}}}},
+				"400": {"description": "foo happened; bar happened", "content": {
+					"text/plain": {"schema": {"type": "string"}},
+					"application/json": {"schema": {
+						"type": "object",
+						"properties": {
+							"code": {"type": "integer"},
+							"id": {"type": "string"},
+							"error": {"type": "string"},
+							"request_id": {"type": "string"}
+						},
+						"required": ["code", "error"]
+					}}
+				}}
+			}
+		}}}
+	}`, w.Body.String())
+
+	// Fetching and mounting the document under a prefix
+	fetched, err := FetchOpenAPI(o)
+	require.Nil(t, err)
+	combined := NewOpenAPI("combined", "1")
+	combined.Add("/token", "GET", Doc{})
+	combined.Mount("/api/", fetched)
+
+	b, err := combined.MarshalJSON()
+	require.Nil(t, err)
+	var doc struct {
+		Paths map[string]map[string]interface{}
+	}
+	require.Nil(t, json.Unmarshal(b, &doc))
+	assert.Len(t, doc.Paths, 2)
+	assert.Contains(t, doc.Paths, "/token")
+	assert.Contains(t, doc.Paths["/api/{user}/thing"], "post")
+
+	// Pages are described wrapped in an Envelope
+	paged := NewOpenAPI("paged", "1")
+	paged.Add("/things", "GET", Doc{Response: &[]string{}, Page: true})
+	b, err = paged.MarshalJSON()
+	require.Nil(t, err)
+	var pagedDoc struct {
+		Paths map[string]map[string]struct {
+			Responses map[string]struct {
+				Content map[string]struct {
+					Schema struct {
+						Properties map[string]map[string]interface{}
+					}
+				}
+			}
+		}
+	}
+	require.Nil(t, json.Unmarshal(b, &pagedDoc))
+	props := pagedDoc.Paths["/things"]["get"].Responses["200"].Content["application/json"].Schema.Properties
+	assert.Equal(t, "array", props["data"]["type"])
+	assert.Equal(t, "object", props["meta"]["type"])
+}
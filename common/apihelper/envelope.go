@@ -0,0 +1,75 @@
+package apihelper
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	"github.com/mediocregopher/mediocre-api/common"
+)
+
+// Envelope is the standard shape of json responses. Data holds the actual
+// response, Meta holds information about it (e.g. pagination), and Error is
+// set instead of Data if the request failed
+type Envelope struct {
+	Data  interface{}         `json:"data,omitempty"`
+	Meta  *Meta               `json:"meta,omitempty"`
+	Error *common.ExpectedErr `json:"error,omitempty"`
+}
+
+// Meta holds information about the data in an Envelope. Currently this is only
+// pagination information
+type Meta struct {
+
+	// Cursor is an opaque value which can be passed back in to retrieve the
+	// next page of results. It is empty if there are no more results
+	Cursor string `json:"cursor"`
+
+	// Total is the total number of items across all pages, or nil if it
+	// isn't known
+	Total *int64 `json:"total,omitempty"`
+}
+
+// JSONData writes the given value to the ResponseWriter, wrapped in an
+// Envelope
+func JSONData(w http.ResponseWriter, data interface{}) {
+	writeEnvelope(w, 200, Envelope{Data: data})
+}
+
+// JSONPage writes a single page of a list of items to the ResponseWriter,
+// wrapped in an Envelope. items should be a slice (an empty one will be
+// written as [] rather than omitted). cursor is the value which can be used to
+// retrieve the next page, or empty string if this is the last one. total is
+// the number of items across all pages, or -1 if it isn't known. All list
+// endpoints should use this, so that they paginate the same way
+func JSONPage(
+	w http.ResponseWriter, items interface{}, cursor string, total int64,
+) {
+	meta := &Meta{Cursor: cursor}
+	if total >= 0 {
+		meta.Total = &total
+	}
+	if items == nil {
+		items = []interface{}{}
+	} else if v := reflect.ValueOf(items); v.Kind() == reflect.Slice && v.IsNil() {
+		items = reflect.MakeSlice(v.Type(), 0, 0).Interface()
+	}
+	writeEnvelope(w, 200, Envelope{Data: items, Meta: meta})
+}
+
+// JSONError writes the given error to the ResponseWriter, wrapped in an
+// Envelope. The error is handled the same way common.HTTPError handles it,
+// see common.ResolveErr. If err is nil nothing is done
+func JSONError(w http.ResponseWriter, r *http.Request, err error) {
+	if err == nil {
+		return
+	}
+	eerr := common.ResolveErr(w, r, err)
+	writeEnvelope(w, eerr.Code, Envelope{Error: &eerr})
+}
+
+func writeEnvelope(w http.ResponseWriter, code int, e Envelope) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(e)
+}
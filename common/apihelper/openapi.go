@@ -0,0 +1,291 @@
+package apihelper
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/pickyjson"
+)
+
+// Doc describes what a single method of an endpoint takes in and returns, for
+// adding to an OpenAPI document
+type Doc struct {
+	// Summary is a short description of what the endpoint does
+	Summary string
+
+	// Body is the params value which is passed to Prepare, if any. Its
+	// constraints are described using pickyjson.Schema
+	Body interface{}
+
+	// Query is the params value which is passed to PrepareQuery, if any
+	Query interface{}
+
+	// AsUser indicates the endpoint uses the _asUser GET parameter, which
+	// shield sets to the logged in user
+	AsUser bool
+
+	// Response is an example of the value written with JSONSuccess, if any.
+	// Only its type and any pickyjson constraints it has matter
+	Response interface{}
+
+	// Page indicates Response is a slice which is written with JSONPage, and so
+	// is described wrapped in an Envelope
+	Page bool
+
+	// Errors are the errors the endpoint may return
+	Errors []common.ExpectedErr
+}
+
+// OpenAPI is an OpenAPI 3 document describing a REST interface. Endpoints are
+// added to it using Add, generally right alongside where their handlers are
+// registered, and it serves itself as json (e.g. at /openapi.json) so that
+// clients can be generated from it
+type OpenAPI struct {
+	Title, Version string
+
+	l     sync.RWMutex
+	paths map[string]map[string]interface{}
+}
+
+// NewOpenAPI returns an empty OpenAPI document with the given title and
+// version
+func NewOpenAPI(title, version string) *OpenAPI {
+	return &OpenAPI{
+		Title:   title,
+		Version: version,
+		paths:   map[string]map[string]interface{}{},
+	}
+}
+
+var pathParamRegex = regexp.MustCompile(`{([^}:]+)(:[^}]*)?}`)
+
+// Add describes the given method of the endpoint at the given path. The path
+// may be given as it was to a gorilla mux Router, e.g. "/{user}/auth", and each
+// of its variables is described as a path parameter
+func (o *OpenAPI) Add(path, method string, d Doc) {
+	op := map[string]interface{}{}
+	if d.Summary != "" {
+		op["summary"] = d.Summary
+	}
+
+	var params []interface{}
+	for _, m := range pathParamRegex.FindAllStringSubmatch(path, -1) {
+		params = append(params, map[string]interface{}{
+			"name":     m[1],
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": "string"},
+		})
+	}
+	path = pathParamRegex.ReplaceAllString(path, "{$1}")
+
+	if d.Query != nil {
+		s := pickyjson.Schema(d.Query)
+		props, _ := s["properties"].(map[string]interface{})
+		required := map[string]bool{}
+		if req, ok := s["required"].([]string); ok {
+			for _, name := range req {
+				required[name] = true
+			}
+		}
+		for _, name := range sortedMapKeys(props) {
+			params = append(params, map[string]interface{}{
+				"name":     name,
+				"in":       "query",
+				"required": required[name],
+				"schema":   props[name],
+			})
+		}
+	}
+	if d.AsUser {
+		params = append(params, map[string]interface{}{
+			"name":        "_asUser",
+			"in":          "query",
+			"description": "The user the request is being made on behalf of, which shield sets to the logged in user",
+			"schema":      map[string]interface{}{"type": "string"},
+		})
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	if d.Body != nil {
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  jsonContent(pickyjson.Schema(d.Body)),
+		}
+	}
+
+	success := map[string]interface{}{"description": "Success, with no body"}
+	if d.Response != nil {
+		schema := pickyjson.Schema(d.Response)
+		if d.Page {
+			schema = pageSchema(schema)
+		}
+		success = map[string]interface{}{
+			"description": "Success",
+			"content":     jsonContent(schema),
+		}
+	}
+	responses := map[string]interface{}{"200": success}
+	errs := map[int][]string{}
+	for _, err := range d.Errors {
+		errs[err.Code] = append(errs[err.Code], err.Err)
+	}
+	for code, msgs := range errs {
+		responses[strconv.Itoa(code)] = map[string]interface{}{
+			"description": strings.Join(msgs, "; "),
+			"content": map[string]interface{}{
+				"text/plain": map[string]interface{}{
+					"schema": map[string]interface{}{"type": "string"},
+				},
+				"application/json": map[string]interface{}{
+					"schema": errSchema,
+				},
+			},
+		}
+	}
+	op["responses"] = responses
+
+	o.l.Lock()
+	defer o.l.Unlock()
+	if o.paths[path] == nil {
+		o.paths[path] = map[string]interface{}{}
+	}
+	o.paths[path][strings.ToLower(method)] = op
+}
+
+// errSchema describes the json form of errors written by common.HTTPError
+var errSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"code":       map[string]interface{}{"type": "integer"},
+		"id":         map[string]interface{}{"type": "string"},
+		"error":      map[string]interface{}{"type": "string"},
+		"request_id": map[string]interface{}{"type": "string"},
+	},
+	"required": []string{"code", "error"},
+}
+
+// pageSchema describes the Envelope written by JSONPage, given the schema of
+// its items
+func pageSchema(items map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"data": items,
+			"meta": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"cursor": map[string]interface{}{"type": "string"},
+					"total":  map[string]interface{}{"type": "integer"},
+				},
+				"required": []string{"cursor"},
+			},
+		},
+		"required": []string{"data", "meta"},
+	}
+}
+
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schema},
+	}
+}
+
+func sortedMapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Mount adds all of the endpoints described by the other OpenAPI document to
+// this one, with the given prefix prepended to their paths. This is useful
+// when a REST interface is served under a path prefix, e.g. by shield
+func (o *OpenAPI) Mount(prefix string, other *OpenAPI) {
+	other.l.RLock()
+	defer other.l.RUnlock()
+	o.l.Lock()
+	defer o.l.Unlock()
+	prefix = strings.TrimSuffix(prefix, "/")
+	for path, ops := range other.paths {
+		o.paths[prefix+path] = ops
+	}
+}
+
+// MarshalJSON implements the json.Marshaler interface, returning the full
+// OpenAPI document
+func (o *OpenAPI) MarshalJSON() ([]byte, error) {
+	o.l.RLock()
+	defer o.l.RUnlock()
+	return json.Marshal(struct {
+		OpenAPI string                            `json:"openapi"`
+		Info    map[string]string                 `json:"info"`
+		Paths   map[string]map[string]interface{} `json:"paths"`
+	}{
+		OpenAPI: "3.0.3",
+		Info:    map[string]string{"title": o.Title, "version": o.Version},
+		Paths:   o.paths,
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface, loading a document
+// written by MarshalJSON so that it can be passed to Mount
+func (o *OpenAPI) UnmarshalJSON(b []byte) error {
+	var doc struct {
+		Info  map[string]string                 `json:"info"`
+		Paths map[string]map[string]interface{} `json:"paths"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	o.l.Lock()
+	defer o.l.Unlock()
+	o.Title, o.Version = doc.Info["title"], doc.Info["version"]
+	o.paths = doc.Paths
+	if o.paths == nil {
+		o.paths = map[string]map[string]interface{}{}
+	}
+	return nil
+}
+
+// ServeHTTP implements the http.Handler interface, writing the OpenAPI
+// document as json
+func (o *OpenAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if ErrUnlessMethod(w, r, "GET", "HEAD") {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	JSONSuccess(w, o)
+}
+
+// FetchOpenAPI requests /openapi.json from the given http.Handler and returns
+// the OpenAPI document it responds with. The handler may be a proxy to another
+// service, e.g. one created by the fwd package
+func FetchOpenAPI(h http.Handler) (*OpenAPI, error) {
+	r, err := http.NewRequest("GET", "/openapi.json", nil)
+	if err != nil {
+		return nil, err
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != 200 {
+		return nil, fmt.Errorf("fetching /openapi.json: got %d response", w.Code)
+	}
+	o := NewOpenAPI("", "")
+	if err := json.Unmarshal(w.Body.Bytes(), o); err != nil {
+		return nil, fmt.Errorf("fetching /openapi.json: %s", err)
+	}
+	return o, nil
+}
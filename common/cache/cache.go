@@ -0,0 +1,161 @@
+// Package cache implements a small in-process LRU cache whose entries expire
+// after a TTL, along with invalidating entries across processes using redis
+// pub/sub. It's used by systems (e.g. user and room) to optionally cache their
+// hottest reads
+package cache
+
+import (
+	"container/list"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/radix.v2/redis"
+)
+
+// Cache holds up to a fixed number of values in memory, each for up to a fixed
+// amount of time. Once full the least recently used value is evicted to make
+// room for a new one. All methods are thread-safe
+type Cache struct {
+	size int
+	ttl  time.Duration
+
+	l     sync.Mutex
+	ll    *list.List
+	elems map[string]*list.Element
+	gens  [numGens]uint64
+}
+
+// numGens is the number of generations a Cache tracks, see Gen. Keys share
+// them so that a Cache's memory stays bounded however many keys it's seen
+const numGens = 256
+
+type entry struct {
+	key     string
+	val     interface{}
+	expires time.Time
+}
+
+// New returns a Cache which will hold up to size values, each for up to the
+// given ttl
+func New(size int, ttl time.Duration) *Cache {
+	if size < 1 {
+		size = 1
+	}
+	return &Cache{
+		size:  size,
+		ttl:   ttl,
+		ll:    list.New(),
+		elems: map[string]*list.Element{},
+	}
+}
+
+// Get returns the value cached under the given key, and whether there was one
+// which hadn't expired yet
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	el, ok := c.elems[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if time.Now().After(e.expires) {
+		c.ll.Remove(el)
+		delete(c.elems, key)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return e.val, true
+}
+
+// Set caches the given value under the given key, replacing any value already
+// there
+func (c *Cache) Set(key string, val interface{}) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.set(key, val)
+}
+
+// set is Set, but expects the lock to already be held
+func (c *Cache) set(key string, val interface{}) {
+	e := &entry{key: key, val: val, expires: time.Now().Add(c.ttl)}
+	if el, ok := c.elems[key]; ok {
+		el.Value = e
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.elems[key] = c.ll.PushFront(e)
+	for c.ll.Len() > c.size {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.elems, el.Value.(*entry).key)
+	}
+}
+
+// genIndex returns the index in gens of the given key's generation
+func genIndex(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % numGens)
+}
+
+// Gen returns the given key's current generation, which changes whenever the
+// key is Deleted. Getting it before reading a value to cache, and passing it to
+// SetIfUnchanged, keeps a value which was read before a Delete (e.g. an
+// Invalidate for a change made while it was being read) from being cached
+func (c *Cache) Gen(key string) uint64 {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return c.gens[genIndex(key)]
+}
+
+// SetIfUnchanged is like Set, but only caches the value if the key hasn't been
+// Deleted since gen was returned from Gen for it, returning whether it was.
+// Keys share generations, so a Delete of another key occasionally also stops
+// the value from being cached
+func (c *Cache) SetIfUnchanged(key string, gen uint64, val interface{}) bool {
+	c.l.Lock()
+	defer c.l.Unlock()
+	if c.gens[genIndex(key)] != gen {
+		return false
+	}
+	c.set(key, val)
+	return true
+}
+
+// Delete removes the value cached under the given key, if there is one
+func (c *Cache) Delete(key string) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.gens[genIndex(key)]++
+	if el, ok := c.elems[key]; ok {
+		c.ll.Remove(el)
+		delete(c.elems, key)
+	}
+}
+
+// Len returns the number of values currently cached, including any which have
+// expired but haven't been removed yet
+func (c *Cache) Len() int {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return c.ll.Len()
+}
+
+// Invalidate deletes the given key from the Cache and publishes it to the
+// given channel (see common.Publish), so that any other Caches which are
+// Listening on it do the same
+func (c *Cache) Invalidate(cmder common.Cmder, channel, key string) {
+	c.Delete(key)
+	common.Publish(cmder, channel, key, "cache invalidation "+channel+"/"+key)
+}
+
+// Listen deletes every key published to the given channel (by Invalidate) from
+// the Cache, see common.Subscribe. Without Listen running a Cache only sees
+// changes made in its own process right away, and those made elsewhere once
+// its values expire
+func (c *Cache) Listen(conn *redis.Client, channel string) error {
+	return common.Subscribe(conn, channel, c.Delete)
+}
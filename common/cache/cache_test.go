@@ -0,0 +1,104 @@
+package cache
+
+import (
+	. "testing"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/mediocregopher/radix.v2/pool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func assertCached(t *T, c *Cache, key string, expected interface{}) {
+	v, ok := c.Get(key)
+	if expected == nil {
+		assert.False(t, ok, "%q is cached", key)
+		return
+	}
+	assert.True(t, ok, "%q isn't cached", key)
+	assert.Equal(t, expected, v)
+}
+
+func TestLRU(t *T) {
+	c := New(2, time.Minute)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	assertCached(t, c, "a", 1)
+
+	// b is now the least recently used, so it's evicted
+	c.Set("c", 3)
+	assert.Equal(t, 2, c.Len())
+	assertCached(t, c, "b", nil)
+	assertCached(t, c, "a", 1)
+	assertCached(t, c, "c", 3)
+
+	c.Set("a", 4)
+	assertCached(t, c, "a", 4)
+	assert.Equal(t, 2, c.Len())
+
+	c.Delete("a")
+	assertCached(t, c, "a", nil)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestSetIfUnchanged(t *T) {
+	c := New(10, time.Minute)
+	gen := c.Gen("a")
+	assert.True(t, c.SetIfUnchanged("a", gen, 1))
+	assertCached(t, c, "a", 1)
+
+	// A Delete in between means the value isn't cached
+	gen = c.Gen("a")
+	c.Delete("a")
+	assert.False(t, c.SetIfUnchanged("a", gen, 2))
+	assertCached(t, c, "a", nil)
+
+	assert.True(t, c.SetIfUnchanged("a", c.Gen("a"), 3))
+	assertCached(t, c, "a", 3)
+}
+
+func TestTTL(t *T) {
+	c := New(10, 100*time.Millisecond)
+	c.Set("a", 1)
+	assertCached(t, c, "a", 1)
+	time.Sleep(150 * time.Millisecond)
+	assertCached(t, c, "a", nil)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestListen(t *T) {
+	if commontest.InProcess {
+		t.Skip("the in-process redis doesn't support pub/sub")
+	}
+	cmder := commontest.APIStarterKit()
+	p, ok := cmder.(*pool.Pool)
+	if !ok {
+		t.Skip("test redis isn't a single instance")
+	}
+	conn, err := p.Get()
+	require.Nil(t, err)
+
+	channel := commontest.RandStr()
+	c := New(10, time.Minute)
+	errCh := make(chan error, 1)
+	go func() { errCh <- c.Listen(conn, channel) }()
+	// Give the subscription time to be made
+	time.Sleep(100 * time.Millisecond)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	New(10, time.Minute).Invalidate(cmder, channel, "a")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for _, ok := c.Get("a"); ok; _, ok = c.Get("a") {
+		if time.Now().After(deadline) {
+			t.Fatal("invalidation never received")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assertCached(t, c, "b", 2)
+
+	conn.Close()
+	assert.NotNil(t, <-errCh)
+}
@@ -0,0 +1,569 @@
+package common
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mediocregopher/radix.v2/cluster"
+	"github.com/mediocregopher/radix.v2/pool"
+	"github.com/mediocregopher/radix.v2/redis"
+	"github.com/mediocregopher/radix.v2/sentinel"
+	"github.com/mediocregopher/radix.v2/util"
+)
+
+// Cmder is the interface every System in mediocre-api uses to talk to redis.
+// It is the same as radix.v2's util.Cmder, so a *pool.Pool or
+// *cluster.Cluster can be used as one directly, and so can anything built on
+// top of radix's util functions (e.g. util.LuaEval and util.Scan)
+type Cmder = util.Cmder
+
+// NewCmder returns a Cmder for the redis instance at the given address. If
+// isCluster is true the address is treated as a node in a redis cluster and a
+// *cluster.Cluster is returned, otherwise a *pool.Pool is returned. In both
+// cases poolSize is the number of connections to make to each redis instance
+func NewCmder(addr string, poolSize int, isCluster bool) (Cmder, error) {
+	return NewCmderWithOpts(addr, &CmderOpts{
+		PoolSize: poolSize,
+		Cluster:  isCluster,
+	})
+}
+
+// CmderOpts are different options which may be passed into NewCmderWithOpts.
+// They all have sane defaults which will cover most use cases
+type CmderOpts struct {
+
+	// Number of connections to make to each redis instance. Defaults to 10
+	PoolSize int
+
+	// If true the address is treated as a node in a redis cluster
+	Cluster bool
+
+	// If set the address is treated as a redis sentinel, and commands are
+	// made against the master of this name. Can't be used with Cluster
+	SentinelMaster string
+
+	// If set every new connection is AUTH'd with this password
+	Password string
+
+	// If set connections are made over TLS using this config. If its
+	// ServerName isn't set the host of the address being connected to is used
+	TLS *tls.Config
+
+	// If set, and the initial connection to redis fails, it is retried with
+	// exponential backoff until this much time has passed, rather than the
+	// error being returned straight away. This lets a service start before
+	// redis is up, as often happens when both are started together
+	ConnectTimeout time.Duration
+
+	// If set, called every time the initial connection fails and is about to
+	// be retried after the given wait
+	OnRetry func(err error, wait time.Duration)
+
+	// If set, connections are made with this as their dial timeout (including
+	// the TLS handshake) and read and write deadline (see redis.DialTimeout),
+	// so a command against a stalled redis fails with
+	// ErrCmdTimeout once this has passed, and its connection is discarded. It
+	// must be longer than any blocking command (e.g. XREADGROUP with BLOCK) is
+	// allowed to block for
+	CmdTimeout time.Duration
+
+	// If either this or CmdTimeout is set the returned Cmder is a
+	// TimeoutCmder, using this as its TimeoutOpts' Retries
+	CmdRetries int
+}
+
+// The initial and maximum waits between attempts to connect when
+// ConnectTimeout is set
+const (
+	minRetryWait = 100 * time.Millisecond
+	maxRetryWait = 5 * time.Second
+)
+
+// NewCmderWithOpts is like NewCmder, but allows for connecting to redis
+// through sentinel, with a password, and/or over TLS, and for retrying the
+// initial connection. The passed in CmderOpts may be nil to just use the
+// defaults.
+//
+// Once connected, connections which break (e.g. because redis restarted) are
+// discarded and new ones are made as they're needed, so the returned Cmder
+// recovers on its own once redis is reachable again
+func NewCmderWithOpts(addr string, o *CmderOpts) (Cmder, error) {
+	if o == nil {
+		o = &CmderOpts{}
+	}
+	if o.Cluster && o.SentinelMaster != "" {
+		return nil, errors.New("sentinel can't be used with cluster")
+	}
+
+	deadline := time.Now().Add(o.ConnectTimeout)
+	wait := minRetryWait
+	for {
+		c, err := o.newCmder(addr)
+		if err == nil && (o.CmdTimeout > 0 || o.CmdRetries > 0) {
+			return NewTimeoutCmder(c, &TimeoutOpts{Retries: o.CmdRetries}), nil
+		} else if err == nil {
+			return c, nil
+		}
+
+		left := time.Until(deadline)
+		if left <= 0 {
+			return nil, err
+		} else if wait > left {
+			wait = left
+		}
+		if o.OnRetry != nil {
+			o.OnRetry(err, wait)
+		}
+		time.Sleep(wait)
+		if wait *= 2; wait > maxRetryWait {
+			wait = maxRetryWait
+		}
+	}
+}
+
+func (o *CmderOpts) newCmder(addr string) (Cmder, error) {
+	poolSize := o.PoolSize
+	if poolSize == 0 {
+		poolSize = 10
+	}
+	df := o.dial
+
+	if o.SentinelMaster != "" {
+		sc, err := sentinel.NewClientCustom("tcp", addr, poolSize, df, o.SentinelMaster)
+		if err != nil {
+			return nil, err
+		}
+		return NewSentinelCmder(sc, o.SentinelMaster), nil
+	} else if o.Cluster {
+		return cluster.NewWithOpts(cluster.Opts{
+			Addr:     addr,
+			PoolSize: poolSize,
+			Dialer:   df,
+		})
+	}
+	return pool.NewCustom("tcp", addr, poolSize, df)
+}
+
+// dial is used as the pool.DialFunc for all connections made by
+// NewCmderWithOpts
+func (o *CmderOpts) dial(network, addr string) (*redis.Client, error) {
+	var c *redis.Client
+	if o.TLS != nil {
+		// The dialer's Timeout covers the handshake as well, so a server which
+		// accepts the connection but stalls the handshake can't block forever
+		d := &net.Dialer{Timeout: o.CmdTimeout}
+		conn, err := tls.DialWithDialer(d, network, addr, o.TLS)
+		if err != nil {
+			return nil, err
+		}
+		var nc net.Conn = conn
+		if o.CmdTimeout > 0 {
+			nc = deadlineConn{Conn: conn, timeout: o.CmdTimeout}
+		}
+		if c, err = redis.NewClient(nc); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	} else {
+		var err error
+		if c, err = redis.DialTimeout(network, addr, o.CmdTimeout); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.Password != "" {
+		if err := c.Cmd("AUTH", o.Password).Err; err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// deadlineConn sets the deadline of the net.Conn it wraps before every read and
+// write, like redis.DialTimeout does for the connections it makes. It's needed
+// for connections redis.NewClient is given, which it doesn't set deadlines on
+type deadlineConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (dc deadlineConn) Read(b []byte) (int, error) {
+	dc.Conn.SetReadDeadline(time.Now().Add(dc.timeout))
+	return dc.Conn.Read(b)
+}
+
+func (dc deadlineConn) Write(b []byte) (int, error) {
+	dc.Conn.SetWriteDeadline(time.Now().Add(dc.timeout))
+	return dc.Conn.Write(b)
+}
+
+// ClientCmder wraps a single *redis.Client so it can be used as a Cmder. A
+// *redis.Client is already a Cmder on its own but isn't safe to use from
+// multiple go-routines at once, which every System assumes its Cmder is, so
+// ClientCmder serializes all calls to it
+type ClientCmder struct {
+	l sync.Mutex
+	c *redis.Client
+}
+
+// NewClientCmder returns a ClientCmder wrapping the given *redis.Client
+func NewClientCmder(c *redis.Client) *ClientCmder {
+	return &ClientCmder{c: c}
+}
+
+// Cmd implements the Cmder interface
+func (cc *ClientCmder) Cmd(cmd string, args ...interface{}) *redis.Resp {
+	cc.l.Lock()
+	defer cc.l.Unlock()
+	return cc.c.Cmd(cmd, args...)
+}
+
+// SentinelCmder wraps a *sentinel.Client so it can be used as a Cmder. Every
+// call to Cmd is made on a connection to the current master of the given name
+type SentinelCmder struct {
+	c    *sentinel.Client
+	name string
+}
+
+// NewSentinelCmder returns a SentinelCmder which will use the given
+// *sentinel.Client to make commands against the master of the given name
+func NewSentinelCmder(c *sentinel.Client, name string) *SentinelCmder {
+	return &SentinelCmder{c: c, name: name}
+}
+
+// Cmd implements the Cmder interface
+func (sc *SentinelCmder) Cmd(cmd string, args ...interface{}) *redis.Resp {
+	conn, err := sc.c.GetMaster(sc.name)
+	if err != nil {
+		return redis.NewRespIOErr(err)
+	}
+	defer sc.c.PutMaster(sc.name, conn)
+	return conn.Cmd(cmd, args...)
+}
+
+// ErrCmdTimeout is the error on the Resp returned from a TimeoutCmder's Cmd when
+// the command's connection timed out, see CmderOpts' CmdTimeout
+var ErrCmdTimeout = ExpectedErr{Code: 503, ID: "redis_timeout", Err: "timed out waiting on redis"}
+
+// TimeoutOpts are different options which may be passed into NewTimeoutCmder.
+// They all have sane defaults which will cover most use cases
+type TimeoutOpts struct {
+
+	// How many more times to attempt a command which fails because of a
+	// connection error, e.g. because redis restarted and broke a pooled
+	// connection. Commands which time out aren't retried. A command may have
+	// been carried out by redis before its connection failed, so commands
+	// which aren't idempotent (e.g. INCR) may be carried out more than once.
+	// Defaults to 0
+	Retries int
+
+	// How long to wait before the first retry, doubling before each one after.
+	// Defaults to 50ms
+	RetryWait time.Duration
+}
+
+// TimeoutCmder wraps a Cmder so that commands made through it are retried on
+// connection errors, and can be cancelled using a context. This keeps a slow
+// or unreachable redis from holding up whatever is waiting on it (e.g. an http
+// handler) indefinitely.
+//
+// Commands aren't timed out by the TimeoutCmder itself, but by the wrapped
+// Cmder's connections having deadlines (see CmderOpts' CmdTimeout), so a
+// command which times out fails with ErrCmdTimeout. A command which is given
+// up on because its context is done is still carried out by the wrapped Cmder
+// in the background until it finishes or its connection times out, and may
+// still be carried out by redis
+type TimeoutCmder struct {
+	c   Cmder
+	o   TimeoutOpts
+	ctx context.Context
+}
+
+// NewTimeoutCmder returns a TimeoutCmder wrapping the given Cmder. The passed
+// in TimeoutOpts may be nil to just use the defaults
+func NewTimeoutCmder(c Cmder, o *TimeoutOpts) *TimeoutCmder {
+	tc := &TimeoutCmder{c: c, ctx: context.Background()}
+	if o != nil {
+		tc.o = *o
+	}
+	if tc.o.RetryWait == 0 {
+		tc.o.RetryWait = 50 * time.Millisecond
+	}
+	return tc
+}
+
+// WithContext returns a copy of the TimeoutCmder whose commands are given up on
+// once the given context is done, with the context's error. This can be used
+// to stop commands made on behalf of a request once the request is cancelled,
+// by giving the copy to the System(s) handling it
+func (tc *TimeoutCmder) WithContext(ctx context.Context) *TimeoutCmder {
+	tc2 := *tc
+	tc2.ctx = ctx
+	return &tc2
+}
+
+// Cmd implements the Cmder interface
+func (tc *TimeoutCmder) Cmd(cmd string, args ...interface{}) *redis.Resp {
+	wait := tc.o.RetryWait
+	for i := 0; ; i++ {
+		r := tc.cmd(cmd, args)
+		if !r.IsType(redis.IOErr) || r.Err == ErrCmdTimeout ||
+			tc.ctx.Err() != nil || i >= tc.o.Retries {
+			return r
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-tc.ctx.Done():
+			t.Stop()
+			return redis.NewRespIOErr(tc.ctx.Err())
+		}
+		wait *= 2
+	}
+}
+
+// cmd makes a single attempt at the given command
+func (tc *TimeoutCmder) cmd(cmd string, args []interface{}) *redis.Resp {
+	if err := tc.ctx.Err(); err != nil {
+		return redis.NewRespIOErr(err)
+	} else if tc.ctx.Done() == nil {
+		return timedOut(tc.c.Cmd(cmd, args...))
+	}
+
+	ch := make(chan *redis.Resp, 1)
+	go func() { ch <- tc.c.Cmd(cmd, args...) }()
+
+	select {
+	case r := <-ch:
+		return timedOut(r)
+	case <-tc.ctx.Done():
+		return redis.NewRespIOErr(tc.ctx.Err())
+	}
+}
+
+// Pipe implements the Piper interface. The commands are sent on to the wrapped
+// Cmder together using Pipe, and those which fail because of a connection error
+// are retried together the same as with Cmd
+func (tc *TimeoutCmder) Pipe(cmds []PipeCmd) []*redis.Resp {
+	rr := tc.pipe(cmds)
+	wait := tc.o.RetryWait
+	for i := 0; i < tc.o.Retries && tc.ctx.Err() == nil; i++ {
+		var retry []int
+		for j, r := range rr {
+			if r.IsType(redis.IOErr) && r.Err != ErrCmdTimeout {
+				retry = append(retry, j)
+			}
+		}
+		if len(retry) == 0 {
+			break
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-tc.ctx.Done():
+			t.Stop()
+			for _, j := range retry {
+				rr[j] = redis.NewRespIOErr(tc.ctx.Err())
+			}
+			return rr
+		}
+		wait *= 2
+
+		retryCmds := make([]PipeCmd, len(retry))
+		for k, j := range retry {
+			retryCmds[k] = cmds[j]
+		}
+		for k, r := range tc.pipe(retryCmds) {
+			rr[retry[k]] = r
+		}
+	}
+	return rr
+}
+
+// pipe makes a single attempt at the given commands
+func (tc *TimeoutCmder) pipe(cmds []PipeCmd) []*redis.Resp {
+	rr := make([]*redis.Resp, len(cmds))
+	if err := tc.ctx.Err(); err != nil {
+		for i := range rr {
+			rr[i] = redis.NewRespIOErr(err)
+		}
+		return rr
+	}
+
+	if tc.ctx.Done() == nil {
+		rr = Pipe(tc.c, cmds)
+	} else {
+		ch := make(chan []*redis.Resp, 1)
+		go func() { ch <- Pipe(tc.c, cmds) }()
+		select {
+		case rr = <-ch:
+		case <-tc.ctx.Done():
+			for i := range rr {
+				rr[i] = redis.NewRespIOErr(tc.ctx.Err())
+			}
+			return rr
+		}
+	}
+
+	for i := range rr {
+		rr[i] = timedOut(rr[i])
+	}
+	return rr
+}
+
+// timedOut returns a Resp with ErrCmdTimeout in place of the given one if it's
+// the error of a connection timing out, otherwise the given Resp
+func timedOut(r *redis.Resp) *redis.Resp {
+	if ne, ok := r.Err.(net.Error); ok && ne.Timeout() && r.IsType(redis.IOErr) {
+		return redis.NewRespIOErr(ErrCmdTimeout)
+	}
+	return r
+}
+
+// Unwrap returns the Cmder which the TimeoutCmder wraps
+func (tc *TimeoutCmder) Unwrap() Cmder {
+	return tc.c
+}
+
+// ClusterOf returns the *cluster.Cluster which the given Cmder is, or which it
+// wraps (through any number of Cmders having an Unwrap method, e.g.
+// TimeoutCmder), or nil if there isn't one. Commands which need to be sent to
+// every node, like SCAN, need the Cluster itself
+func ClusterOf(c Cmder) *cluster.Cluster {
+	for {
+		switch cc := c.(type) {
+		case *cluster.Cluster:
+			return cc
+		case interface{ Unwrap() Cmder }:
+			c = cc.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+// PipeCmd is a single command to be sent by Pipe. The first of its Args must be
+// the key the command acts on, so that it can be sent to the right node of a
+// cluster
+type PipeCmd struct {
+	Cmd  string
+	Args []interface{}
+}
+
+func (pc PipeCmd) key() string {
+	if len(pc.Args) == 0 {
+		return ""
+	}
+	k, _ := pc.Args[0].(string)
+	return k
+}
+
+// Piper is implemented by Cmders which wrap another Cmder (e.g. TimeoutCmder),
+// so that commands sent through Pipe still go through them
+type Piper interface {
+	Pipe(cmds []PipeCmd) []*redis.Resp
+}
+
+// Pipe sends all of the given commands and returns their responses, in the same
+// order. When the Cmder is a *pool.Pool the commands are pipelined on a single
+// connection, and when it's a *cluster.Cluster they're pipelined on one
+// connection per node, so either way it only takes one round trip. When it's a
+// Piper its Pipe method is used, which for the Cmders in this package sends
+// the commands on to the Cmder they wrap using this same function. With any
+// other Cmder the commands are made one at a time.
+//
+// The commands aren't atomic, and a command failing doesn't stop the ones after
+// it. Like with Cmd any error is on the returned Resp
+func Pipe(c Cmder, cmds []PipeCmd) []*redis.Resp {
+	rr := make([]*redis.Resp, len(cmds))
+	if len(cmds) == 0 {
+		return rr
+	}
+
+	switch cc := c.(type) {
+	case Piper:
+		return cc.Pipe(cmds)
+	case *cluster.Cluster:
+		byAddr := map[string][]int{}
+		for i, pc := range cmds {
+			addr := cc.GetAddrForKey(pc.key())
+			byAddr[addr] = append(byAddr[addr], i)
+		}
+		for _, ii := range byAddr {
+			conn, err := cc.GetForKey(cmds[ii[0]].key())
+			if err != nil {
+				for _, i := range ii {
+					rr[i] = redis.NewRespIOErr(err)
+				}
+				continue
+			}
+			pipe(conn, cmds, ii, rr)
+			cc.Put(conn)
+		}
+
+		// Keys whose slots have moved since the cluster last loaded them get
+		// redirected, which Cmd knows how to follow
+		for i, r := range rr {
+			if r.IsType(redis.AppErr) && isRedirect(r.Err.Error()) {
+				rr[i] = c.Cmd(cmds[i].Cmd, cmds[i].Args...)
+			}
+		}
+		return rr
+
+	case *pool.Pool:
+		conn, err := cc.Get()
+		if err != nil {
+			for i := range rr {
+				rr[i] = redis.NewRespIOErr(err)
+			}
+			return rr
+		}
+		ii := make([]int, len(cmds))
+		for i := range ii {
+			ii[i] = i
+		}
+		pipe(conn, cmds, ii, rr)
+		cc.Put(conn)
+		return rr
+	}
+
+	for i, pc := range cmds {
+		rr[i] = c.Cmd(pc.Cmd, pc.Args...)
+	}
+	return rr
+}
+
+// pipe pipelines the commands at the given indexes on the connection, putting
+// their responses at the same indexes of rr
+func pipe(conn *redis.Client, cmds []PipeCmd, ii []int, rr []*redis.Resp) {
+	for _, i := range ii {
+		conn.PipeAppend(cmds[i].Cmd, cmds[i].Args...)
+	}
+	for _, i := range ii {
+		rr[i] = conn.PipeResp()
+	}
+}
+
+func isRedirect(err string) bool {
+	return strings.HasPrefix(err, "MOVED ") || strings.HasPrefix(err, "ASK ")
+}
+
+// Scan is the same as util.Scan, except that it also scans every node of a
+// cluster when the Cmder only wraps one. In that case the SCANs are made on the
+// cluster's connections directly, and so aren't recorded (or retried, etc...)
+// by the wrapping Cmders, though they're still timed out by the connections'
+// deadlines
+func Scan(c Cmder, ch chan string, cmd, key, pattern string) error {
+	if cl := ClusterOf(c); cl != nil {
+		c = cl
+	}
+	return util.Scan(c, ch, cmd, key, pattern)
+}
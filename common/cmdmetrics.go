@@ -0,0 +1,258 @@
+package common
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mediocregopher/radix.v2/redis"
+)
+
+// DefaultCmdBuckets are the latency buckets used by MetricsCmder if none are
+// given
+var DefaultCmdBuckets = []time.Duration{
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	1 * time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+}
+
+// CmdKey identifies the commands which a CmdStats is about
+type CmdKey struct {
+
+	// The part of the command's first key before its first colon, e.g. "user"
+	// for "user:{foo}". Every System's keys start with the name of its package,
+	// so this says which System made the command. It's "other" for commands
+	// without a key, and for keys which don't look like they came from a
+	// System
+	Prefix string
+
+	// The command's name, upper-cased
+	Cmd string
+}
+
+// CmdStats are the metrics collected by a MetricsCmder for a single CmdKey
+type CmdStats struct {
+
+	// Total number of commands made, including ones which errored
+	Calls int64
+
+	// Number of commands whose response was an error, either from redis or
+	// from the connection to it
+	Errors int64
+
+	// LatencyBuckets[i] is the number of commands which took at most
+	// Buckets[i], where Buckets are the ones the MetricsCmder was created
+	// with. As with prometheus histograms these counts are cumulative, and
+	// Calls acts as the final, infinite, bucket
+	LatencyBuckets []int64
+
+	// The sum of the durations of all commands
+	LatencySum time.Duration
+}
+
+// MetricsCmder wraps a Cmder and records the number of commands made through
+// it, how many errored, and a histogram of how long they took, all broken down
+// by CmdKey. This shows which Systems are putting load on redis, and with what
+// commands. It implements http.Handler, serving the metrics in the prometheus
+// text exposition format
+type MetricsCmder struct {
+	c       Cmder
+	buckets []time.Duration
+
+	l sync.Mutex
+	m map[CmdKey]*CmdStats
+}
+
+// NewMetricsCmder returns a MetricsCmder wrapping the given Cmder, using the
+// given latency buckets, which must be in ascending order. If none are given
+// DefaultCmdBuckets is used
+func NewMetricsCmder(c Cmder, buckets ...time.Duration) *MetricsCmder {
+	if len(buckets) == 0 {
+		buckets = DefaultCmdBuckets
+	}
+	return &MetricsCmder{
+		c:       c,
+		buckets: buckets,
+		m:       map[CmdKey]*CmdStats{},
+	}
+}
+
+// Buckets returns the latency buckets the MetricsCmder is using
+func (mc *MetricsCmder) Buckets() []time.Duration {
+	return mc.buckets
+}
+
+// Cmd implements the Cmder interface
+func (mc *MetricsCmder) Cmd(cmd string, args ...interface{}) *redis.Resp {
+	start := time.Now()
+	r := mc.c.Cmd(cmd, args...)
+	mc.record(cmd, args, r, time.Since(start))
+	return r
+}
+
+// Pipe implements the Piper interface. The commands are sent on to the wrapped
+// Cmder together using Pipe, and each is recorded as having taken as long as
+// all of them together did
+func (mc *MetricsCmder) Pipe(cmds []PipeCmd) []*redis.Resp {
+	start := time.Now()
+	rr := Pipe(mc.c, cmds)
+	took := time.Since(start)
+	for i, r := range rr {
+		mc.record(cmds[i].Cmd, cmds[i].Args, r, took)
+	}
+	return rr
+}
+
+// record adds the given command, which returned the given Resp, to the metrics
+func (mc *MetricsCmder) record(cmd string, args []interface{}, r *redis.Resp, took time.Duration) {
+	k := CmdKey{Prefix: cmdKeyPrefix(cmd, args), Cmd: strings.ToUpper(cmd)}
+	mc.l.Lock()
+	defer mc.l.Unlock()
+	cs, ok := mc.m[k]
+	if !ok {
+		cs = &CmdStats{LatencyBuckets: make([]int64, len(mc.buckets))}
+		mc.m[k] = cs
+	}
+	cs.Calls++
+	if r.Err != nil {
+		cs.Errors++
+	}
+	for i, b := range mc.buckets {
+		if took <= b {
+			cs.LatencyBuckets[i]++
+		}
+	}
+	cs.LatencySum += took
+}
+
+// Unwrap returns the Cmder which the MetricsCmder wraps
+func (mc *MetricsCmder) Unwrap() Cmder {
+	return mc.c
+}
+
+// cmdKeyPrefix returns the CmdKey Prefix for the given command
+func cmdKeyPrefix(cmd string, args []interface{}) string {
+	i := 0
+	switch strings.ToUpper(cmd) {
+	case "EVAL", "EVALSHA":
+		// script, numkeys, keys...
+		if len(args) < 3 || fmt.Sprint(args[1]) == "0" {
+			return "other"
+		}
+		i = 2
+	case "XREAD", "XREADGROUP":
+		for i < len(args) && !strings.EqualFold(fmt.Sprint(args[i]), "STREAMS") {
+			i++
+		}
+		i++
+	}
+	if i >= len(args) {
+		return "other"
+	}
+
+	key := firstStr(args[i])
+
+	// Limit what's accepted as a prefix, so that keys which didn't come from a
+	// System don't each get their own metrics
+	j := strings.IndexByte(key, ':')
+	if j < 1 || j > 32 {
+		return "other"
+	}
+	prefix := key[:j]
+	for _, r := range prefix {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '_' && r != '-' {
+			return "other"
+		}
+	}
+	return prefix
+}
+
+// firstStr returns the given argument if it's a string, or the first string
+// within it if it's a slice, as radix flattens slices into multiple arguments
+// (e.g. util.LuaEval passes its keys that way)
+func firstStr(arg interface{}) string {
+	switch a := arg.(type) {
+	case string:
+		return a
+	case []byte:
+		return string(a)
+	case []string:
+		if len(a) > 0 {
+			return a[0]
+		}
+	case []interface{}:
+		if len(a) > 0 {
+			return firstStr(a[0])
+		}
+	}
+	return ""
+}
+
+// Snapshot returns a copy of the metrics collected so far
+func (mc *MetricsCmder) Snapshot() map[CmdKey]CmdStats {
+	mc.l.Lock()
+	defer mc.l.Unlock()
+
+	snap := make(map[CmdKey]CmdStats, len(mc.m))
+	for k, cs := range mc.m {
+		cp := *cs
+		cp.LatencyBuckets = append([]int64(nil), cs.LatencyBuckets...)
+		snap[k] = cp
+	}
+	return snap
+}
+
+// ServeHTTP writes all metrics in the prometheus text exposition format
+func (mc *MetricsCmder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	snap := mc.Snapshot()
+	keys := make([]CmdKey, 0, len(snap))
+	for k := range snap {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Prefix != keys[j].Prefix {
+			return keys[i].Prefix < keys[j].Prefix
+		}
+		return keys[i].Cmd < keys[j].Cmd
+	})
+	labels := func(k CmdKey) string {
+		return PromLabels("prefix", k.Prefix, "command", k.Cmd)
+	}
+
+	WritePromHeader(w, "redis_commands_total", "counter", "Redis commands made, by key prefix and command")
+	for _, k := range keys {
+		fmt.Fprintf(w, "redis_commands_total{%s} %d\n", labels(k), snap[k].Calls)
+	}
+	WritePromHeader(w, "redis_command_errors_total", "counter", "Redis commands which returned an error, by key prefix and command")
+	for _, k := range keys {
+		fmt.Fprintf(w, "redis_command_errors_total{%s} %d\n", labels(k), snap[k].Errors)
+	}
+
+	hs := make([]PromHistogram, len(keys))
+	for i, k := range keys {
+		cs := snap[k]
+		hs[i] = PromHistogram{
+			Labels:  labels(k),
+			Buckets: mc.buckets,
+			Counts:  cs.LatencyBuckets,
+			Count:   cs.Calls,
+			Sum:     cs.LatencySum,
+		}
+	}
+	WritePromHistogram(w, "redis_command_duration_seconds", "Time taken by redis commands, by key prefix and command", hs)
+}
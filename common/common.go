@@ -3,9 +3,11 @@
 package common
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
+	"strings"
 )
 
 // ExpectedErr is an implementation of the error interface which will be used to
@@ -13,7 +15,27 @@ import (
 // to the client
 type ExpectedErr struct {
 	Code int
-	Err  string
+
+	// ID is a stable, machine-readable identifier for the error, e.g.
+	// "user_exists", which clients can branch on rather than parsing Err. It
+	// may be empty
+	ID string
+
+	Err string
+
+	// cause is held behind a pointer so that ExpectedErr is always
+	// comparable, regardless of the cause's type
+	cause *cause
+}
+
+type cause struct {
+	err error
+}
+
+// ErrUnknown is sent back to the client by HTTPError when the error it's given
+// isn't an ExpectedErr
+var ErrUnknown = ExpectedErr{
+	Code: 500, ID: "unknown", Err: "unknown server-side error",
 }
 
 // ExpectedErrf returns an ExpectedErr with a formatted message
@@ -29,15 +51,169 @@ func (e ExpectedErr) Error() string {
 	return e.Err
 }
 
-// HTTPError will attempt to cast the given error to an ExpectedErr. If it's
-// able to it will write that error and its response code back to the
-// http.ResponseWriter. Otherwise it will log the error and send back a 500
-// unknown server-side error. If err is nil it will do nothing.
+// WithID returns a copy of the ExpectedErr with its ID set to the given one
+func (e ExpectedErr) WithID(id string) ExpectedErr {
+	e.ID = id
+	return e
+}
+
+// Wrap returns a copy of the ExpectedErr with the given error attached as its
+// underlying cause. The cause is never sent to the client, but is returned by
+// Unwrap and will be logged by HTTPError, so that the root cause of an error
+// isn't lost while still sending a clean response
+func (e ExpectedErr) Wrap(err error) ExpectedErr {
+	if err == nil {
+		e.cause = nil
+	} else {
+		e.cause = &cause{err}
+	}
+	return e
+}
+
+// Unwrap returns the error attached using Wrap, if any
+func (e ExpectedErr) Unwrap() error {
+	if e.cause == nil {
+		return nil
+	}
+	return e.cause.err
+}
+
+// Is returns true if the target is an ExpectedErr with the same Code, ID, and
+// Err, regardless of either's cause. This allows errors.Is to match an
+// ExpectedErr returned from Wrap against the original
+func (e ExpectedErr) Is(target error) bool {
+	t, ok := target.(ExpectedErr)
+	return ok && t.Code == e.Code && t.ID == e.ID && t.Err == e.Err
+}
+
+// IsExpected returns true if the given error is an ExpectedErr, or wraps one
+func IsExpected(err error) bool {
+	_, ok := AsExpected(err)
+	return ok
+}
+
+// AsExpected returns the ExpectedErr the given error is or wraps, if there is
+// one
+func AsExpected(err error) (ExpectedErr, bool) {
+	var eerr ExpectedErr
+	ok := errors.As(err, &eerr)
+	return eerr, ok
+}
+
+// MarshalJSON implements the json.Marshaler interface. The ExpectedErr is
+// encoded as an object with "code", "id", and "error" fields, with "id" being
+// left out if it's empty
+func (e ExpectedErr) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Code int    `json:"code"`
+		ID   string `json:"id,omitempty"`
+		Err  string `json:"error"`
+	}{e.Code, e.ID, e.Err})
+}
+
+// tenantEscaper escapes the characters which delimit tenants in the prefixes
+// returned from TenantPrefix
+var tenantEscaper = strings.NewReplacer("%", "%25", ":", "%3A", "~", "%7E")
+
+// TenantPrefix returns the prefix a System should use in its key names, given
+// its tenant and its own prefix. Systems with different tenants never share
+// keys, regardless of their prefixes, so a single redis can hold the data of
+// multiple isolated applications. The returned prefix is the given one if the
+// tenant is empty, so data stored before tenants were used can still be found,
+// unless the given one starts with "~" or "%" (which are escaped so that it
+// can't be mistaken for a tenant's)
+func TenantPrefix(tenant, prefix string) string {
+	if tenant == "" {
+		if strings.HasPrefix(prefix, "~") || strings.HasPrefix(prefix, "%") {
+			return tenantEscaper.Replace(prefix[:1]) + prefix[1:]
+		}
+		return prefix
+	}
+	// The escaped tenant has no ":", so the first one ends it
+	tenant = "~" + tenantEscaper.Replace(tenant)
+	if prefix == "" {
+		return tenant
+	}
+	return tenant + ":" + prefix
+}
+
+// HTTPError will attempt to cast the given error to an ExpectedErr (or find
+// one it wraps). If it's able to it will write that error and its response
+// code back to the http.ResponseWriter, logging its cause if it has one.
+// Otherwise it will log the error and send back a 500 unknown server-side
+// error. If err is nil it will do nothing.
+//
+// If the request's Accept header includes application/json the error is
+// written as a json object (see ExpectedErr's MarshalJSON), otherwise it's
+// written as plain text. The message may be localized, see Translator.
+//
+// If the request has a request ID (see RequestID) it is set in the response's
+// RequestIDHeader, and included in the json object as "request_id"
 func HTTPError(w http.ResponseWriter, r *http.Request, err error) {
-	if eerr, ok := err.(ExpectedErr); ok {
+	if err == nil {
+		return
+	}
+	writeErr(w, r, err, wantsJSON(r))
+}
+
+// HTTPErrorJSON is like HTTPError, but always writes the error as a json
+// object, regardless of the request's Accept header
+func HTTPErrorJSON(w http.ResponseWriter, r *http.Request, err error) {
+	if err == nil {
+		return
+	}
+	writeErr(w, r, err, true)
+}
+
+// ResolveErr performs all the work HTTPError does except for writing the
+// response, and returns the ExpectedErr which should be written. The error is
+// logged and reported as necessary, and its message is translated. This is
+// useful for writing errors to the client in a different format than HTTPError
+// does
+func ResolveErr(w http.ResponseWriter, r *http.Request, err error) ExpectedErr {
+	requestID := RequestID(r)
+	eerr, ok := AsExpected(err)
+	if !ok {
+		logErr(r, requestID, err.Error())
+		eerr = ErrUnknown
+	} else if cause := eerr.Unwrap(); cause != nil {
+		logErr(r, requestID, eerr.Error()+": "+cause.Error())
+	}
+	if eerr.Code >= 500 && Reporter != nil {
+		Reporter(r, requestID, err)
+	}
+	return translate(w, r, eerr)
+}
+
+func writeErr(w http.ResponseWriter, r *http.Request, err error, asJSON bool) {
+	eerr := ResolveErr(w, r, err)
+	requestID := RequestID(r)
+	if requestID != "" {
+		w.Header().Set(RequestIDHeader, requestID)
+	}
+
+	if !asJSON {
 		http.Error(w, eerr.Error(), eerr.Code)
-	} else if err != nil {
-		log.Printf("%s %s -> %s", r.Method, r.URL, err)
-		http.Error(w, "unknown server-side error", 500)
+		return
+	}
+
+	b, _ := json.Marshal(struct {
+		Code      int    `json:"code"`
+		ID        string `json:"id,omitempty"`
+		Err       string `json:"error"`
+		RequestID string `json:"request_id,omitempty"`
+	}{eerr.Code, eerr.ID, eerr.Err, requestID})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(eerr.Code)
+	w.Write(append(b, '\n'))
+}
+
+func wantsJSON(r *http.Request) bool {
+	for _, accept := range r.Header["Accept"] {
+		if strings.Contains(accept, "application/json") {
+			return true
+		}
 	}
+	return false
 }
@@ -0,0 +1,499 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	. "testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/mediocregopher/radix.v2/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPError(t *T) {
+	eerr := ExpectedErr{Code: 400, ID: "foo_bar", Err: "foo bar"}
+
+	doReq := func(err error, accept string) *httptest.ResponseRecorder {
+		r, rerr := http.NewRequest("GET", "/", nil)
+		require.Nil(t, rerr)
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		HTTPError(w, r, err)
+		return w
+	}
+
+	w := doReq(eerr, "")
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, "foo bar\n", w.Body.String())
+
+	w = doReq(eerr, "text/html, application/json;q=0.9")
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `{"code":400,"id":"foo_bar","error":"foo bar"}`+"\n", w.Body.String())
+
+	w = doReq(ExpectedErrf(404, "no %s", "thing"), "application/json")
+	assert.Equal(t, 404, w.Code)
+	assert.Equal(t, `{"code":404,"error":"no thing"}`+"\n", w.Body.String())
+
+	w = doReq(errors.New("secret internal stuff"), "application/json")
+	assert.Equal(t, 500, w.Code)
+	assert.Equal(t, `{"code":500,"id":"unknown","error":"unknown server-side error"}`+"\n", w.Body.String())
+
+	w = doReq(nil, "")
+	assert.Equal(t, 200, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	// The request ID, if there is one, is included in the response
+	r := WithRequestID(httptest.NewRequest("GET", "/", nil), "abc")
+	r.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	HTTPError(w, r, eerr)
+	assert.Equal(t, "abc", w.Header().Get(RequestIDHeader))
+	assert.Equal(t, `{"code":400,"id":"foo_bar","error":"foo bar","request_id":"abc"}`+"\n", w.Body.String())
+}
+
+func TestTranslations(t *T) {
+	tr := Translations{
+		"fr":    {"foo_bar": "foo bar (fr)"},
+		"pt-BR": {"foo_bar": "foo bar (pt-BR)"},
+		"de":    {"other": "other (de)"},
+	}
+	eerr := ExpectedErr{Code: 400, ID: "foo_bar", Err: "foo bar"}
+
+	tests := []struct {
+		accept, msg, lang string
+		ok                bool
+	}{
+		{"", "", "", false},
+		{"fr", "foo bar (fr)", "fr", true},
+		{"fr-CA", "foo bar (fr)", "fr", true},
+		{"pt-BR", "foo bar (pt-BR)", "pt-BR", true},
+		{"pt-PT", "", "", false},
+		{"de, fr;q=0.5", "foo bar (fr)", "fr", true},
+		{"fr;q=0.5, pt-br", "foo bar (pt-BR)", "pt-BR", true},
+		{"fr;q=0, en", "", "", false},
+	}
+	for _, test := range tests {
+		msg, lang, ok := tr.Translate(eerr, test.accept)
+		assert.Equal(t, test.ok, ok, "accept: %q", test.accept)
+		assert.Equal(t, test.msg, msg, "accept: %q", test.accept)
+		assert.Equal(t, test.lang, lang, "accept: %q", test.accept)
+	}
+
+	_, _, ok := tr.Translate(ExpectedErr{Code: 400, Err: "foo bar"}, "fr")
+	assert.False(t, ok)
+
+	Translator = tr.Translate
+	defer func() { Translator = nil }()
+
+	r, err := http.NewRequest("GET", "/", nil)
+	require.Nil(t, err)
+	r.Header.Set("Accept-Language", "fr")
+	w := httptest.NewRecorder()
+	HTTPError(w, r, eerr)
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, "fr", w.Header().Get("Content-Language"))
+	assert.Equal(t, "foo bar (fr)\n", w.Body.String())
+}
+
+type sliceErr []string
+
+func (s sliceErr) Error() string { return s[0] }
+
+func TestWrap(t *T) {
+	eerr := ExpectedErr{Code: 400, ID: "foo_bar", Err: "foo bar"}
+	root := errors.New("root cause")
+
+	wrapped := eerr.Wrap(root)
+	assert.Equal(t, "foo bar", wrapped.Error())
+	assert.Equal(t, root, wrapped.Unwrap())
+	assert.Nil(t, eerr.Unwrap())
+	assert.True(t, errors.Is(wrapped, eerr))
+	assert.True(t, errors.Is(wrapped, root))
+	assert.False(t, errors.Is(wrapped, eerr.WithID("other")))
+
+	// ExpectedErrs stay comparable even if their cause isn't
+	var uncomparable error = sliceErr{"a"}
+	assert.NotPanics(t, func() {
+		var err error = eerr.Wrap(uncomparable)
+		assert.False(t, err == error(eerr))
+	})
+
+	outer := fmt.Errorf("doing thing: %w", wrapped)
+	assert.True(t, IsExpected(outer))
+	got, ok := AsExpected(outer)
+	assert.True(t, ok)
+	assert.Equal(t, wrapped, got)
+	assert.False(t, IsExpected(root))
+
+	// HTTPError sends the ExpectedErr even when it's wrapped
+	r, err := http.NewRequest("GET", "/", nil)
+	require.Nil(t, err)
+	w := httptest.NewRecorder()
+	HTTPError(w, r, outer)
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, "foo bar\n", w.Body.String())
+}
+
+func TestTenantPrefix(t *T) {
+	// Without a tenant the prefix is unchanged, so existing data is found
+	assert.Equal(t, "", TenantPrefix("", ""))
+	assert.Equal(t, "foo", TenantPrefix("", "foo"))
+	assert.Equal(t, "~a:x", TenantPrefix("a", "x"))
+
+	// No two tenant/prefix pairs share keys
+	pairs := [][2]string{
+		{"", ""}, {"", "x"}, {"", "~a"}, {"", "~a:x"}, {"", "%7Ea"},
+		{"", "%257Ea"}, {"", "%"}, {"", "~"},
+		{"a", ""}, {"a", "x"}, {"a:x", ""}, {"a", "x:y"}, {"a:x", "y"},
+		{"~a", ""}, {"%7Ea", ""}, {"a%3Ax", ""}, {"a", "~x"},
+	}
+	seen := map[string][2]string{}
+	for _, p := range pairs {
+		prefix := TenantPrefix(p[0], p[1])
+		other, ok := seen[prefix]
+		assert.False(t, ok, "%q and %q both give %q", p, other, prefix)
+		seen[prefix] = p
+	}
+}
+
+type testLogger []string
+
+func (l *testLogger) Printf(format string, args ...interface{}) {
+	*l = append(*l, fmt.Sprintf(format, args...))
+}
+
+func TestLogAndReport(t *T) {
+	logger := &testLogger{}
+	Log = logger
+	var reported []string
+	Reporter = func(r *http.Request, requestID string, err error) {
+		reported = append(reported, requestID+" "+err.Error())
+	}
+	defer func() {
+		Log = log.New(os.Stderr, "", log.LstdFlags)
+		Reporter = nil
+	}()
+
+	doReq := func(err error, requestID string, inCtx bool) {
+		r, rerr := http.NewRequest("GET", "/foo", nil)
+		require.Nil(t, rerr)
+		if inCtx {
+			r = WithRequestID(r, requestID)
+		} else if requestID != "" {
+			r.Header.Set(RequestIDHeader, requestID)
+		}
+		HTTPError(httptest.NewRecorder(), r, err)
+	}
+
+	eerr := ExpectedErr{Code: 400, Err: "foo bar"}
+	doReq(eerr, "", false)
+	doReq(eerr.Wrap(errors.New("baz")), "a", true)
+	doReq(errors.New("boom"), "b", false)
+	doReq(ExpectedErr{Code: 503, Err: "no"}, "", false)
+
+	assert.Equal(t, []string{
+		"GET /foo [a] -> foo bar: baz",
+		"GET /foo [b] -> boom",
+	}, []string(*logger))
+	assert.Equal(t, []string{"b boom", " no"}, reported)
+
+	r, err := http.NewRequest("GET", "/foo", nil)
+	require.Nil(t, err)
+	r.Header.Set(RequestIDHeader, "header")
+	assert.Equal(t, "header", RequestID(r))
+	assert.Equal(t, "ctx", RequestID(WithRequestID(r, "ctx")))
+}
+
+func TestHealth(t *T) {
+	h := NewHealth()
+	h.Timeout = 100 * time.Millisecond
+	h.Add("good", func() error { return nil })
+
+	w := httptest.NewRecorder()
+	h.Readiness().ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"status":"ok","checks":{"good":"ok"}}`, w.Body.String())
+
+	h.Add("bad", func() error { return errors.New("it's bad") })
+	h.Add("slow", func() error { time.Sleep(time.Second); return nil })
+
+	w = httptest.NewRecorder()
+	h.Readiness().ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, 503, w.Code)
+	assert.JSONEq(t, `{"status":"unavailable","checks":{
+		"good":"ok",
+		"bad":"it's bad",
+		"slow":"timed out"
+	}}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	h.Liveness().ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestCmderOpts(t *T) {
+	m, err := miniredis.Run()
+	require.Nil(t, err)
+	defer m.Close()
+	m.RequireAuth("hunter2")
+
+	c, err := NewCmderWithOpts(m.Addr(), &CmderOpts{PoolSize: 1, Password: "hunter2"})
+	require.Nil(t, err)
+	assert.Nil(t, c.Cmd("SET", "foo", "bar").Err)
+	s, err := c.Cmd("GET", "foo").Str()
+	require.Nil(t, err)
+	assert.Equal(t, "bar", s)
+
+	_, err = NewCmderWithOpts(m.Addr(), &CmderOpts{PoolSize: 1, Password: "wrong"})
+	assert.NotNil(t, err)
+
+	_, err = NewCmderWithOpts(m.Addr(), &CmderOpts{Cluster: true, SentinelMaster: "foo"})
+	assert.NotNil(t, err)
+}
+
+func TestCmderConnectTimeout(t *T) {
+	// Reserve an address with nothing listening on it
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	var retries int
+	o := &CmderOpts{
+		PoolSize:       1,
+		ConnectTimeout: 300 * time.Millisecond,
+		OnRetry:        func(error, time.Duration) { retries++ },
+	}
+	start := time.Now()
+	_, err = NewCmderWithOpts(addr, o)
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) >= o.ConnectTimeout)
+	assert.True(t, retries > 1)
+
+	// Redis coming up while retrying is connected to
+	m := miniredis.NewMiniRedis()
+	defer m.Close()
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		m.StartAddr(addr)
+	}()
+	o.ConnectTimeout = 5 * time.Second
+	c, err := NewCmderWithOpts(addr, o)
+	require.Nil(t, err)
+	assert.Nil(t, c.Cmd("PING").Err)
+}
+
+type cmderFunc func(string, ...interface{}) *redis.Resp
+
+func (f cmderFunc) Cmd(cmd string, args ...interface{}) *redis.Resp {
+	return f(cmd, args...)
+}
+
+func TestTimeoutCmder(t *T) {
+	slow := cmderFunc(func(cmd string, args ...interface{}) *redis.Resp {
+		time.Sleep(200 * time.Millisecond)
+		return redis.NewResp("OK")
+	})
+	var calls int
+	broken := cmderFunc(func(cmd string, args ...interface{}) *redis.Resp {
+		if calls++; calls < 3 {
+			return redis.NewRespIOErr(errors.New("broken pipe"))
+		}
+		return redis.NewResp("OK")
+	})
+
+	tc := NewTimeoutCmder(slow, nil)
+	assert.Nil(t, tc.Cmd("PING").Err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	tc = NewTimeoutCmder(slow, nil).WithContext(ctx)
+	assert.Equal(t, context.Canceled, tc.Cmd("PING").Err)
+	assert.True(t, time.Since(start) < 200*time.Millisecond)
+	assert.Equal(t, context.Canceled, tc.Cmd("PING").Err)
+
+	// Connection errors are retried, but only so many times
+	calls = 0
+	tc = NewTimeoutCmder(broken, &TimeoutOpts{Retries: 1, RetryWait: time.Millisecond})
+	assert.NotNil(t, tc.Cmd("PING").Err)
+	assert.Equal(t, 2, calls)
+
+	calls = 0
+	tc = NewTimeoutCmder(broken, &TimeoutOpts{Retries: 2, RetryWait: time.Millisecond})
+	assert.Nil(t, tc.Cmd("PING").Err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestCmdTimeout(t *T) {
+	// A "redis" which never answers
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	c, err := NewCmderWithOpts(l.Addr().String(), &CmderOpts{
+		PoolSize:   1,
+		CmdTimeout: 50 * time.Millisecond,
+		CmdRetries: 2,
+	})
+	require.Nil(t, err)
+
+	// Timeouts aren't retried
+	start := time.Now()
+	assert.Equal(t, ErrCmdTimeout, c.Cmd("PING").Err)
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+	assert.Equal(t, ErrCmdTimeout, c.Cmd("PING").Err)
+
+	// The TLS handshake never completes either
+	start = time.Now()
+	_, err = NewCmderWithOpts(l.Addr().String(), &CmderOpts{
+		PoolSize:   1,
+		CmdTimeout: 50 * time.Millisecond,
+		TLS:        &tls.Config{InsecureSkipVerify: true},
+	})
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+}
+
+func TestMetricsCmder(t *T) {
+	m, err := miniredis.Run()
+	require.Nil(t, err)
+	defer m.Close()
+	c, err := NewCmder(m.Addr(), 1, false)
+	require.Nil(t, err)
+
+	mc := NewMetricsCmder(c)
+	require.Nil(t, mc.Cmd("set", "user:{foo}", "bar").Err)
+	require.Nil(t, mc.Cmd("SET", "user:{baz}", "bar").Err)
+	require.NotNil(t, mc.Cmd("LPUSH", "user:{foo}", "bar").Err)
+	require.Nil(t, mc.Cmd("EVAL", "return 1", 1, []interface{}{"room:{foo}"}).Err)
+	require.Nil(t, mc.Cmd("PING").Err)
+	require.Nil(t, mc.Cmd("GET", "Weird Key").Err)
+
+	snap := mc.Snapshot()
+	assert.Len(t, snap, 5)
+	set := snap[CmdKey{"user", "SET"}]
+	assert.Equal(t, int64(2), set.Calls)
+	assert.Equal(t, int64(0), set.Errors)
+	assert.Equal(t, set.Calls, set.LatencyBuckets[len(set.LatencyBuckets)-1])
+	assert.Equal(t, int64(1), snap[CmdKey{"user", "LPUSH"}].Errors)
+	assert.Equal(t, int64(1), snap[CmdKey{"room", "EVAL"}].Calls)
+	assert.Equal(t, int64(1), snap[CmdKey{"other", "PING"}].Calls)
+	assert.Equal(t, int64(1), snap[CmdKey{"other", "GET"}].Calls)
+
+	w := httptest.NewRecorder()
+	mc.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	assert.Contains(t, body, `redis_commands_total{prefix="user",command="SET"} 2`+"\n")
+	assert.Contains(t, body, `redis_command_errors_total{prefix="user",command="LPUSH"} 1`+"\n")
+	assert.Contains(t, body, `redis_command_duration_seconds_count{prefix="room",command="EVAL"} 1`+"\n")
+}
+
+func TestWritePromHistogram(t *T) {
+	buf := new(bytes.Buffer)
+	WritePromHistogram(buf, "foo_seconds", "Foo", []PromHistogram{
+		{
+			Labels:  PromLabels("a", "b", "c", `"d"`),
+			Buckets: []time.Duration{time.Millisecond, time.Second},
+			Counts:  []int64{1, 2},
+			Count:   3,
+			Sum:     2500 * time.Millisecond,
+		},
+		{Count: 1, Sum: time.Second},
+	})
+	assert.Equal(t, `# HELP foo_seconds Foo
+# TYPE foo_seconds histogram
+foo_seconds_bucket{a="b",c="\"d\"",le="0.001"} 1
+foo_seconds_bucket{a="b",c="\"d\"",le="1"} 2
+foo_seconds_bucket{a="b",c="\"d\"",le="+Inf"} 3
+foo_seconds_sum{a="b",c="\"d\""} 2.5
+foo_seconds_count{a="b",c="\"d\""} 3
+foo_seconds_bucket{le="+Inf"} 1
+foo_seconds_sum{} 1
+foo_seconds_count{} 1
+`, buf.String())
+}
+
+func TestPipe(t *T) {
+	m, err := miniredis.Run()
+	require.Nil(t, err)
+	defer m.Close()
+	c, err := NewCmderWithOpts(m.Addr(), &CmderOpts{PoolSize: 1, CmdTimeout: time.Second})
+	require.Nil(t, err)
+
+	// The commands go through every wrapping Cmder
+	mc := NewMetricsCmder(c)
+	rr := Pipe(mc, []PipeCmd{
+		{Cmd: "SET", Args: []interface{}{"user:{foo}", "bar"}},
+		{Cmd: "GET", Args: []interface{}{"user:{foo}"}},
+		{Cmd: "LPUSH", Args: []interface{}{"user:{foo}", "bar"}},
+	})
+	require.Len(t, rr, 3)
+	assert.Nil(t, rr[0].Err)
+	s, _ := rr[1].Str()
+	assert.Equal(t, "bar", s)
+	assert.NotNil(t, rr[2].Err)
+
+	snap := mc.Snapshot()
+	assert.Equal(t, int64(1), snap[CmdKey{"user", "SET"}].Calls)
+	assert.Equal(t, int64(1), snap[CmdKey{"user", "GET"}].Calls)
+	assert.Equal(t, int64(1), snap[CmdKey{"user", "LPUSH"}].Errors)
+
+	// A TimeoutCmder's context applies to the whole batch
+	slow := cmderFunc(func(cmd string, args ...interface{}) *redis.Resp {
+		time.Sleep(200 * time.Millisecond)
+		return redis.NewResp("OK")
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	rr = Pipe(NewTimeoutCmder(slow, nil).WithContext(ctx), []PipeCmd{
+		{Cmd: "GET", Args: []interface{}{"foo"}},
+		{Cmd: "GET", Args: []interface{}{"bar"}},
+	})
+	assert.True(t, time.Since(start) < 200*time.Millisecond)
+	for _, r := range rr {
+		assert.Equal(t, context.DeadlineExceeded, r.Err)
+	}
+}
+
+func TestJSONLogWriter(t *T) {
+	buf := new(bytes.Buffer)
+	l := log.New(JSONLogWriter(buf), "", 0)
+	l.Printf("foo %q", "bar")
+
+	var entry struct {
+		Time time.Time
+		Msg  string
+	}
+	require.Nil(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, `foo "bar"`, entry.Msg)
+	assert.WithinDuration(t, time.Now(), entry.Time, time.Second)
+}
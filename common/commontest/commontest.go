@@ -5,31 +5,142 @@ package commontest
 import (
 	"bytes"
 	"crypto/rand"
+	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"runtime/debug"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/alicebob/miniredis"
 	"github.com/mediocregopher/mediocre-api/common"
 	"github.com/mediocregopher/radix.v2/pool"
-	"github.com/mediocregopher/radix.v2/util"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// InProcess, if true, causes APIStarterKit to return a Cmder backed by an
+// in-process miniredis instance rather than a live redis at RedisAddr, so
+// that tests can be run on machines without redis. It defaults to true if the
+// MEDIOCRE_TEST_INPROCESS environment variable is set, and can otherwise be set
+// in a TestMain before any tests are run.
+var InProcess = os.Getenv("MEDIOCRE_TEST_INPROCESS") != ""
+
+// RedisAddr is the address of the redis instance APIStarterKit will connect to
+// when InProcess isn't set. It defaults to the MEDIOCRE_TEST_REDIS_ADDR
+// environment variable, or "localhost:6379" if that isn't set
+var RedisAddr = envOr("MEDIOCRE_TEST_REDIS_ADDR", "localhost:6379")
+
+// RedisCluster, if true, causes APIStarterKit to treat RedisAddr as a node in a
+// redis cluster and return a cluster client, so that cluster-specific behavior
+// (hash tags, cross-slot errors) gets exercised. It defaults to true if the
+// MEDIOCRE_TEST_REDIS_CLUSTER environment variable is set
+var RedisCluster = os.Getenv("MEDIOCRE_TEST_REDIS_CLUSTER") != ""
+
+// RedisSentinelMaster, if set, causes APIStarterKit to treat RedisAddr as a
+// redis sentinel, and to make commands against the master of this name. It
+// defaults to the MEDIOCRE_TEST_REDIS_SENTINEL_MASTER environment variable
+var RedisSentinelMaster = os.Getenv("MEDIOCRE_TEST_REDIS_SENTINEL_MASTER")
+
+// RedisAuth, if set, is the password APIStarterKit will AUTH with. It defaults
+// to the MEDIOCRE_TEST_REDIS_AUTH environment variable
+var RedisAuth = os.Getenv("MEDIOCRE_TEST_REDIS_AUTH")
+
+// RedisTLS, if true, causes APIStarterKit to connect to redis over TLS. Since
+// test instances generally use self-signed certificates the certificate isn't
+// verified. It defaults to true if the MEDIOCRE_TEST_REDIS_TLS environment
+// variable is set
+var RedisTLS = os.Getenv("MEDIOCRE_TEST_REDIS_TLS") != ""
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
 // APIStarterKit returns an initialized *API and a Cmder which can be used as
 // generic entities for testing
-func APIStarterKit() util.Cmder {
-	p, err := pool.New("tcp", "localhost:6379", 10)
+func APIStarterKit() common.Cmder {
+	if InProcess {
+		return InProcessCmder()
+	}
+
+	o := &common.CmderOpts{
+		Cluster:        RedisCluster,
+		SentinelMaster: RedisSentinelMaster,
+		Password:       RedisAuth,
+	}
+	if RedisTLS {
+		o.TLS = &tls.Config{InsecureSkipVerify: true}
+	}
+	c, err := common.NewCmderWithOpts(RedisAddr, o)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+var (
+	miniOnce sync.Once
+	mini     *miniredis.Miniredis
+)
+
+// InProcessCmder returns a Cmder connected to a miniredis instance running
+// within the test process. The instance is started the first time this is
+// called and is shared by all subsequent callers.
+//
+// miniredis doesn't expire keys on its own, so the instance's clock is moved
+// forward in the background to keep TTLs roughly in line with real time
+func InProcessCmder() common.Cmder {
+	miniOnce.Do(func() {
+		var err error
+		if mini, err = miniredis.Run(); err != nil {
+			panic(err)
+		}
+		go func() {
+			last := time.Now()
+			for now := range time.Tick(50 * time.Millisecond) {
+				mini.FastForward(now.Sub(last))
+				last = now
+			}
+		}()
+	})
+	p, err := pool.New("tcp", mini.Addr(), 10)
 	if err != nil {
 		panic(err)
 	}
 	return p
 }
 
+// KeyPrefix returns a random prefix which a test can give to the Systems it is
+// testing, so that all keys they create are namespaced to that test. A cleanup
+// function is registered on the test which deletes every key containing the
+// prefix from the given Cmder once the test is done, so repeated test runs
+// don't leak keys into the redis instance
+func KeyPrefix(t *testing.T, c common.Cmder) string {
+	prefix := RandStr()
+	t.Cleanup(func() {
+		ch := make(chan string)
+		errCh := make(chan error, 1)
+		go func() { errCh <- common.Scan(c, ch, "SCAN", "", "*"+prefix+"*") }()
+		for key := range ch {
+			if err := c.Cmd("DEL", key).Err; err != nil {
+				t.Errorf("cleaning up key %q: %s", key, err)
+			}
+		}
+		if err := <-errCh; err != nil {
+			t.Errorf("scanning for keys with prefix %q: %s", prefix, err)
+		}
+	})
+	return prefix
+}
+
 // RandStr returns a string of random alphanumeric characters
 func RandStr() string {
 	b := make([]byte, 16)
@@ -52,12 +163,119 @@ func Req(
 ) (
 	int, string,
 ) {
+	resp := ReqWith(t, mux, method, endpoint, body, nil)
+	return resp.Code, resp.Body
+}
+
+// ReqOpts describes extra data which can be sent along with a request made by
+// ReqWith and its variants
+type ReqOpts struct {
+	// Headers which will be set on the request
+	Header http.Header
+
+	// Cookies which will be added to the request
+	Cookies []*http.Cookie
+
+	// If set, the RemoteAddr the request will appear to come from. Defaults to
+	// "1.1.1.1:50000"
+	RemoteAddr string
+}
+
+// Resp describes the result of a request made by ReqWith and its variants
+type Resp struct {
+	Code    int
+	Header  http.Header
+	Cookies []*http.Cookie
+	Body    string
+}
+
+// ReqWith is like Req, but the request will have the headers and cookies
+// described by the given ReqOpts (which may be nil) set on it, and the response
+// headers and cookies are returned along with the code and body
+func ReqWith(
+	t *testing.T, mux http.Handler, method, endpoint, body string, o *ReqOpts,
+) Resp {
 	r, err := http.NewRequest(method, endpoint, bytes.NewBufferString(body))
 	require.Nil(t, err, "\n%s", string(debug.Stack()))
 	r.RemoteAddr = "1.1.1.1:50000"
+	if o != nil {
+		for k, vv := range o.Header {
+			r.Header[k] = append(r.Header[k], vv...)
+		}
+		for _, c := range o.Cookies {
+			r.AddCookie(c)
+		}
+		if o.RemoteAddr != "" {
+			r.RemoteAddr = o.RemoteAddr
+		}
+	}
+
 	w := httptest.NewRecorder()
 	mux.ServeHTTP(w, r)
-	return w.Code, w.Body.String()
+	return Resp{
+		Code:    w.Code,
+		Header:  w.Header(),
+		Cookies: w.Result().Cookies(),
+		Body:    w.Body.String(),
+	}
+}
+
+// AssertReqWith is like AssertReq, but uses ReqWith to make the request and
+// returns its result so headers and cookies can be checked
+func AssertReqWith(
+	t *testing.T, mux http.Handler, method, endpoint, body string, o *ReqOpts,
+	expectedBody string,
+) Resp {
+	resp := ReqWith(t, mux, method, endpoint, body, o)
+	assert.Equal(t, 200, resp.Code, "\n%s", string(debug.Stack()))
+	assert.Equal(t, expectedBody, resp.Body, "\n%s", string(debug.Stack()))
+	return resp
+}
+
+// AssertReqJSONWith is like AssertReqJSON, but uses ReqWith to make the request
+// and returns its result so headers and cookies can be checked
+func AssertReqJSONWith(
+	t *testing.T, mux http.Handler, method, endpoint, body string, o *ReqOpts,
+	dst interface{},
+) Resp {
+	resp := ReqWith(t, mux, method, endpoint, body, o)
+	assert.Equal(t, 200, resp.Code, "\n%s", string(debug.Stack()))
+
+	err := json.Unmarshal([]byte(resp.Body), dst)
+	require.Nil(t, err, "\n%s", string(debug.Stack()))
+	return resp
+}
+
+// AssertReqErrWith is like AssertReqErr, but uses ReqWith to make the request
+// and returns its result so headers and cookies can be checked
+func AssertReqErrWith(
+	t *testing.T, mux http.Handler, method, endpoint, body string, o *ReqOpts,
+	err common.ExpectedErr,
+) Resp {
+	resp := ReqWith(t, mux, method, endpoint, body, o)
+	assert.Equal(t, err.Code, resp.Code, "\n%s", string(debug.Stack()))
+	assert.Equal(t, err.Err+"\n", resp.Body, "\n%s", string(debug.Stack()))
+	return resp
+}
+
+// AssertHeader uses the stretchr/assert package to assert that the given Resp
+// has the given header set to the given value
+func AssertHeader(t *testing.T, resp Resp, key, value string) {
+	assert.Equal(t, value, resp.Header.Get(key), "\n%s", string(debug.Stack()))
+}
+
+// AssertCookie uses the stretchr/assert package to assert that the given Resp
+// set a cookie with the given name and value, and returns that cookie so its
+// other attributes can be checked
+func AssertCookie(t *testing.T, resp Resp, name, value string) *http.Cookie {
+	for _, c := range resp.Cookies {
+		if c.Name == name {
+			assert.Equal(t, value, c.Value, "\n%s", string(debug.Stack()))
+			return c
+		}
+	}
+	assert.Fail(t, "cookie not set", "cookie %q not set\n%s", name, string(debug.Stack()))
+	return nil
 }
 
 // AssertReq uses the stretchr/assert package to assert that the result of
@@ -98,6 +316,17 @@ func AssertReqJSON(
 	require.Nil(t, err, "\n%s", string(debug.Stack()))
 }
 
+// Page is the json form of a response written by apihelper.JSONPage. To check
+// one, give AssertReqJSON (or AssertReqJSONWith) a Page with Data set to a
+// pointer to a slice, which the items are then unmarshaled into
+type Page struct {
+	Data interface{} `json:"data"`
+	Meta struct {
+		Cursor string `json:"cursor"`
+		Total  *int64 `json:"total"`
+	} `json:"meta"`
+}
+
 // AssertReqRawJSON uses the stretchr/assert package to assert that the result
 // of executing the given *http.Request returns a 200 response and a body which
 // is unmarshaled into dst successfully.
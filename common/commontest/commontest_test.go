@@ -0,0 +1,33 @@
+package commontest
+
+import (
+	"net/http"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReqWith(t *T) {
+	mux := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := r.Cookie("tok")
+		if err != nil {
+			http.Error(w, "no cookie", 400)
+			return
+		}
+		w.Header().Set("X-Echo", r.Header.Get("X-Foo"))
+		http.SetCookie(w, &http.Cookie{Name: "seen", Value: c.Value, HttpOnly: true})
+		w.Write([]byte(r.RemoteAddr))
+	})
+
+	resp := ReqWith(t, mux, "GET", "/", "", nil)
+	assert.Equal(t, 400, resp.Code)
+
+	resp = AssertReqWith(t, mux, "GET", "/", "", &ReqOpts{
+		Header:     http.Header{"X-Foo": {"bar"}},
+		Cookies:    []*http.Cookie{{Name: "tok", Value: "abc"}},
+		RemoteAddr: "2.2.2.2:1000",
+	}, "2.2.2.2:1000")
+	AssertHeader(t, resp, "X-Echo", "bar")
+	c := AssertCookie(t, resp, "seen", "abc")
+	assert.True(t, c.HttpOnly)
+}
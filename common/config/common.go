@@ -0,0 +1,192 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common"
+)
+
+// AddListenAddr adds the "listen-addr" parameter, with the given default, and
+// the "shutdown-timeout" parameter used by ListenAndServe
+func (c *Config) AddListenAddr(def string) {
+	c.Add(Param{
+		Name:        "listen-addr",
+		Description: "Address to listen for api requests on",
+		Default:     def,
+	})
+	c.Add(Param{
+		Name:        "shutdown-timeout",
+		Description: "How long to wait for in-flight requests to complete when shutting down",
+		Default:     "30s",
+	})
+}
+
+// ListenAddr returns the value of the "listen-addr" parameter
+func (c *Config) ListenAddr() string {
+	return c.Str("listen-addr")
+}
+
+// AddSecret adds the "secret" parameter
+func (c *Config) AddSecret() {
+	c.Add(Param{
+		Name:        "secret",
+		Description: "Secret to sign and validate tokens with",
+	})
+}
+
+// Secret returns the value of the "secret" parameter, or an error if it wasn't
+// set
+func (c *Config) Secret() ([]byte, error) {
+	if err := c.Require("secret"); err != nil {
+		return nil, err
+	}
+	return []byte(c.Str("secret")), nil
+}
+
+// AddRedis adds all parameters needed to connect to redis using Redis
+func (c *Config) AddRedis() {
+	c.Add(Param{
+		Name:        "redis-addr",
+		Description: "Address redis is listening on",
+		Default:     "127.0.0.1:6379",
+	})
+	c.Add(Param{
+		Name:        "redis-pool-size",
+		Description: "Number of connections to make for each redis instance",
+		Default:     "10",
+	})
+	c.Add(Param{
+		Name:        "redis-cluster",
+		Description: "Whether or not to treat the redis address as a node in a larger cluster",
+		Flag:        true,
+	})
+	c.Add(Param{
+		Name:        "redis-sentinel-master",
+		Description: "If set, the redis address is treated as a sentinel, and connections are made to the master of this name",
+	})
+	c.Add(Param{
+		Name:        "redis-auth",
+		Description: "Password to AUTH with on every new redis connection",
+	})
+	c.Add(Param{
+		Name:        "redis-tls",
+		Description: "Whether or not to connect to redis over TLS",
+		Flag:        true,
+	})
+	c.Add(Param{
+		Name:        "redis-tls-ca-file",
+		Description: "PEM file of CA certificates to verify redis's certificate with, instead of the system's. Requires --redis-tls",
+	})
+	c.Add(Param{
+		Name:        "redis-connect-timeout",
+		Description: "How long to keep retrying the initial connection to redis, with backoff, before giving up. 0 gives up after the first attempt",
+		Default:     "1m",
+	})
+	c.Add(Param{
+		Name:        "redis-timeout",
+		Description: "How long to wait on each redis command before failing it. 0 waits forever",
+		Default:     "5s",
+	})
+	c.Add(Param{
+		Name:        "redis-retries",
+		Description: "How many times to retry a redis command which fails because of a connection error. Commands which aren't idempotent may be carried out twice if retried",
+		Default:     "0",
+	})
+	c.Add(Param{
+		Name:        "redis-metrics-addr",
+		Description: "Address to serve metrics about the redis commands being made on, in the prometheus text format at /metrics. Leave blank to not collect them",
+	})
+}
+
+// Redis returns a Cmder connected to redis as described by the parameters
+// added by AddRedis. Failed attempts to connect are logged to common.Log while
+// they're being retried. If "redis-metrics-addr" is set the Cmder is a
+// common.MetricsCmder, which is served on that address in the background
+func (c *Config) Redis() (common.Cmder, error) {
+	poolSize, err := c.Int("redis-pool-size")
+	if err != nil {
+		return nil, err
+	}
+	connectTimeout, err := c.Duration("redis-connect-timeout")
+	if err != nil {
+		return nil, err
+	}
+	cmdTimeout, err := c.Duration("redis-timeout")
+	if err != nil {
+		return nil, err
+	}
+	cmdRetries, err := c.Int("redis-retries")
+	if err != nil {
+		return nil, err
+	}
+	addr := c.Str("redis-addr")
+	o := &common.CmderOpts{
+		PoolSize:       poolSize,
+		Cluster:        c.Bool("redis-cluster"),
+		SentinelMaster: c.Str("redis-sentinel-master"),
+		Password:       c.Str("redis-auth"),
+		ConnectTimeout: connectTimeout,
+		OnRetry: func(err error, wait time.Duration) {
+			if common.Log != nil {
+				common.Log.Printf("connecting to redis at %s: %s (retrying in %s)", addr, err, wait)
+			}
+		},
+		CmdTimeout: cmdTimeout,
+		CmdRetries: cmdRetries,
+	}
+	if o.TLS, err = c.redisTLS(); err != nil {
+		return nil, err
+	}
+	cmder, err := common.NewCmderWithOpts(addr, o)
+	if err != nil {
+		return nil, err
+	}
+
+	metricsAddr := c.Str("redis-metrics-addr")
+	if metricsAddr == "" {
+		return cmder, nil
+	}
+	mc := common.NewMetricsCmder(cmder)
+	l, err := net.Listen("tcp", metricsAddr)
+	if err != nil {
+		return nil, err
+	}
+	m := http.NewServeMux()
+	m.Handle("/metrics", mc)
+	go func() {
+		log.Printf("serving redis metrics on %s", l.Addr())
+		log.Printf("serving redis metrics: %s", http.Serve(l, m))
+	}()
+	return mc, nil
+}
+
+func (c *Config) redisTLS() (*tls.Config, error) {
+	caFile := c.Str("redis-tls-ca-file")
+	if !c.Bool("redis-tls") {
+		if caFile != "" {
+			return nil, errors.New("--redis-tls-ca-file requires --redis-tls")
+		}
+		return nil, nil
+	}
+
+	tc := &tls.Config{}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		tc.RootCAs = x509.NewCertPool()
+		if !tc.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("--redis-tls-ca-file: no certificates found in %s", caFile)
+		}
+	}
+	return tc, nil
+}
@@ -0,0 +1,285 @@
+// Package config implements a configuration loader which is shared by the
+// prefab services, so that they all take in their listen address, redis
+// settings, secrets, etc... the same way.
+//
+// Every parameter can be set in three places. In order of precedence, they are:
+//
+// * On the command line, e.g. "--redis-addr 127.0.0.1:6379"
+//
+// * In an environment variable named after the app and the parameter, e.g.
+// "USER_REDIS_ADDR=127.0.0.1:6379" for an app named "user"
+//
+// * In a JSON config file, e.g. {"redis-addr":"127.0.0.1:6379"}. The file is
+// optional, and is given using the "--config" parameter (which can itself be
+// set in the environment, e.g. "USER_CONFIG=/etc/user.json")
+//
+// Any parameter not set in any of those places takes on its default value.
+//
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Param describes a single configuration parameter
+type Param struct {
+	// Name of the parameter, without any leading dashes, e.g. "listen-addr"
+	Name string
+
+	// Description is shown in the usage output
+	Description string
+
+	// Default is the value the parameter takes on if it isn't set anywhere
+	Default string
+
+	// Flag indicates the parameter is a boolean switch, which can be set on
+	// the command line without a value (e.g. "--redis-cluster")
+	Flag bool
+}
+
+// Config holds a set of Params and, once Parse has been called, their values
+type Config struct {
+	appName string
+	params  []Param
+	args    []string
+
+	l    sync.RWMutex
+	vals map[string]string
+
+	// Getenv is used to look up environment variables. It defaults to
+	// os.Getenv
+	Getenv func(string) string
+
+	onShutdown []func()
+	onReload   []func() error
+}
+
+const configParam = "config"
+
+// New returns a new Config for the app with the given name. The name is used
+// to derive the environment variable each parameter can be set by
+func New(appName string) *Config {
+	c := &Config{
+		appName: appName,
+		vals:    map[string]string{},
+		Getenv:  os.Getenv,
+	}
+	c.Add(Param{
+		Name:        configParam,
+		Description: "JSON file to load configuration from. Optional",
+	})
+	return c
+}
+
+// Add adds the given Param to the Config. It must be called before Parse, and
+// panics if a Param with the same name was already added
+func (c *Config) Add(p Param) {
+	if _, ok := c.param(p.Name); ok {
+		panic(fmt.Sprintf("config param %q already added", p.Name))
+	}
+	c.params = append(c.params, p)
+}
+
+func (c *Config) param(name string) (Param, bool) {
+	for _, p := range c.params {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Param{}, false
+}
+
+// EnvVar returns the name of the environment variable which the parameter of
+// the given name can be set by
+func (c *Config) EnvVar(name string) string {
+	s := c.appName + "_" + name
+	return strings.ToUpper(strings.Replace(s, "-", "_", -1))
+}
+
+// Parse loads the values of all parameters from the given command line
+// arguments (not including the program name), the environment, and the config
+// file if one is given, following the precedence described in the package
+// docs. If an error is returned the Config's values are left as they were
+func (c *Config) Parse(args []string) error {
+	vals := map[string]string{}
+	fs := flag.NewFlagSet(c.appName, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	set := map[string]bool{}
+	for _, p := range c.params {
+		if p.Flag {
+			fs.Bool(p.Name, p.Default == "true", p.Description)
+		} else {
+			fs.String(p.Name, p.Default, p.Description)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		vals[f.Name] = f.Value.String()
+		set[f.Name] = true
+	})
+
+	for _, p := range c.params {
+		if set[p.Name] {
+			continue
+		}
+		if v := c.Getenv(c.EnvVar(p.Name)); v != "" {
+			vals[p.Name] = v
+			set[p.Name] = true
+		}
+	}
+
+	if file := vals[configParam]; file != "" {
+		fileVals, err := c.loadFile(file)
+		if err != nil {
+			return err
+		}
+		for name, v := range fileVals {
+			if !set[name] {
+				vals[name] = v
+				set[name] = true
+			}
+		}
+	}
+
+	for _, p := range c.params {
+		if !set[p.Name] {
+			vals[p.Name] = p.Default
+		} else if _, err := strconv.ParseBool(vals[p.Name]); p.Flag && err != nil {
+			return fmt.Errorf("--%s: invalid value %q, must be true or false", p.Name, vals[p.Name])
+		}
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.args, c.vals = args, vals
+	return nil
+}
+
+// Reload calls Parse again with the same arguments it was last called with,
+// picking up any changes to the environment and config file. It is safe to
+// call while other go-routines are reading values from the Config
+func (c *Config) Reload() error {
+	c.l.RLock()
+	args := c.args
+	c.l.RUnlock()
+	return c.Parse(args)
+}
+
+func (c *Config) loadFile(file string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("config file %s: %s", file, err)
+	}
+
+	vals := map[string]string{}
+	for name, v := range m {
+		if _, ok := c.param(name); !ok || name == configParam {
+			return nil, fmt.Errorf("config file %s: unknown param %q", file, name)
+		}
+		switch vv := v.(type) {
+		case string:
+			vals[name] = vv
+		case float64:
+			vals[name] = strconv.FormatFloat(vv, 'f', -1, 64)
+		case bool:
+			vals[name] = strconv.FormatBool(vv)
+		default:
+			return nil, fmt.Errorf("config file %s: param %q has invalid value", file, name)
+		}
+	}
+	return vals, nil
+}
+
+// ParseOrExit calls Parse with the process's command line arguments. If
+// parsing fails, or if "-h" or "--help" were given, the usage is written to
+// stderr and the process exits
+func (c *Config) ParseOrExit() {
+	err := c.Parse(os.Args[1:])
+	if err == flag.ErrHelp {
+		c.Usage(os.Stderr)
+		os.Exit(0)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		c.Usage(os.Stderr)
+		os.Exit(2)
+	}
+}
+
+// Usage writes a description of every parameter to the given io.Writer
+func (c *Config) Usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage of %s:\n", c.appName)
+	for _, p := range c.params {
+		fmt.Fprintf(w, "  --%s (env %s)\n", p.Name, c.EnvVar(p.Name))
+		if p.Description != "" {
+			fmt.Fprintf(w, "\t%s\n", p.Description)
+		}
+		if p.Default != "" {
+			fmt.Fprintf(w, "\tDefault: %q\n", p.Default)
+		}
+	}
+}
+
+// Str returns the value of the parameter with the given name
+func (c *Config) Str(name string) string {
+	c.l.RLock()
+	defer c.l.RUnlock()
+	return c.vals[name]
+}
+
+// Int returns the value of the parameter with the given name as an int
+func (c *Config) Int(name string) (int, error) {
+	i, err := strconv.Atoi(c.Str(name))
+	if err != nil {
+		return 0, fmt.Errorf("--%s: %s", name, err)
+	}
+	return i, nil
+}
+
+// Duration returns the value of the parameter with the given name as a
+// time.Duration, e.g. "30s"
+func (c *Config) Duration(name string) (time.Duration, error) {
+	d, err := time.ParseDuration(c.Str(name))
+	if err != nil {
+		return 0, fmt.Errorf("--%s: %s", name, err)
+	}
+	return d, nil
+}
+
+// Bool returns whether the parameter with the given name was set to a true
+// value, e.g. "true" or "1"
+func (c *Config) Bool(name string) bool {
+	b, _ := strconv.ParseBool(c.Str(name))
+	return b
+}
+
+// Require returns an error if any of the parameters with the given names
+// weren't set to a non-empty value
+func (c *Config) Require(names ...string) error {
+	var missing []string
+	for _, name := range names {
+		if c.Str(name) == "" {
+			missing = append(missing, "--"+name)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.New(strings.Join(missing, ", ") + " required")
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package config
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	. "testing"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/notify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig(env map[string]string) *Config {
+	c := New("test")
+	c.Getenv = func(k string) string { return env[k] }
+	c.AddListenAddr(":8080")
+	c.AddRedis()
+	c.Add(Param{Name: "foo", Default: "foo-default"})
+	return c
+}
+
+func TestDefaults(t *T) {
+	c := testConfig(nil)
+	require.Nil(t, c.Parse(nil))
+	assert.Equal(t, ":8080", c.ListenAddr())
+	assert.Equal(t, "foo-default", c.Str("foo"))
+	assert.False(t, c.Bool("redis-cluster"))
+	i, err := c.Int("redis-pool-size")
+	require.Nil(t, err)
+	assert.Equal(t, 10, i)
+	assert.NotNil(t, c.Require("redis-auth"))
+}
+
+func TestPrecedence(t *T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	require.Nil(t, ioutil.WriteFile(file, []byte(`{
+		"listen-addr": ":1",
+		"redis-pool-size": 5,
+		"redis-cluster": true,
+		"foo": "foo-file"
+	}`), 0644))
+
+	env := map[string]string{
+		"TEST_CONFIG":      file,
+		"TEST_LISTEN_ADDR": ":2",
+		"TEST_FOO":         "foo-env",
+	}
+	c := testConfig(env)
+	require.Nil(t, c.Parse([]string{"--listen-addr", ":3"}))
+	assert.Equal(t, ":3", c.ListenAddr())
+	assert.Equal(t, "foo-env", c.Str("foo"))
+	assert.True(t, c.Bool("redis-cluster"))
+	i, err := c.Int("redis-pool-size")
+	require.Nil(t, err)
+	assert.Equal(t, 5, i)
+	assert.Equal(t, "127.0.0.1:6379", c.Str("redis-addr"))
+
+	c = testConfig(env)
+	require.Nil(t, c.Parse(nil))
+	assert.Equal(t, ":2", c.ListenAddr())
+
+	require.Nil(t, ioutil.WriteFile(file, []byte(`{"bar":"baz"}`), 0644))
+	c = testConfig(env)
+	assert.NotNil(t, c.Parse(nil))
+
+	c = testConfig(nil)
+	assert.NotNil(t, c.Parse([]string{"--bar", "baz"}))
+
+	// Flags can be set in the environment using any value strconv.ParseBool
+	// accepts
+	c = testConfig(map[string]string{"TEST_REDIS_CLUSTER": "1"})
+	require.Nil(t, c.Parse(nil))
+	assert.True(t, c.Bool("redis-cluster"))
+	c = testConfig(map[string]string{"TEST_REDIS_CLUSTER": "false"})
+	require.Nil(t, c.Parse(nil))
+	assert.False(t, c.Bool("redis-cluster"))
+	c = testConfig(map[string]string{"TEST_REDIS_CLUSTER": "yes"})
+	assert.NotNil(t, c.Parse(nil))
+}
+
+func TestTLS(t *T) {
+	parse := func(args ...string) *Config {
+		c := New("test")
+		c.Getenv = func(string) string { return "" }
+		c.AddTLS()
+		require.Nil(t, c.Parse(args))
+		return c
+	}
+
+	tc, err := parse().TLS()
+	assert.Nil(t, err)
+	assert.Nil(t, tc)
+
+	_, err = parse("--tls-cert", "foo.crt").TLS()
+	assert.NotNil(t, err)
+
+	_, err = parse("--tls-cert", "foo.crt", "--tls-autocert-domains", "foo.com").TLS()
+	assert.NotNil(t, err)
+
+	tc, err = parse("--tls-autocert-domains", "foo.com,bar.com").TLS()
+	require.Nil(t, err)
+	assert.NotNil(t, tc.GetCertificate)
+}
+
+func TestGracefulShutdown(t *T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	c := New("test")
+	c.Getenv = func(string) string { return "" }
+	c.AddListenAddr(addr)
+	require.Nil(t, c.Parse(nil))
+	stopped := false
+	c.OnShutdown(func() { stopped = true })
+
+	inHandler := make(chan struct{})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(inHandler)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+
+	serveErrCh := make(chan error)
+	go func() { serveErrCh <- c.ListenAndServe(h) }()
+
+	// wait for the server to come up, then make a request which will be in
+	// flight when the signal comes in
+	var resp *http.Response
+	respErrCh := make(chan error)
+	go func() {
+		for i := 0; ; i++ {
+			var err error
+			if resp, err = http.Get("http://" + addr); err == nil || i > 50 {
+				respErrCh <- err
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	<-inHandler
+	proc, err := os.FindProcess(os.Getpid())
+	require.Nil(t, err)
+	require.Nil(t, proc.Signal(syscall.SIGTERM))
+
+	require.Nil(t, <-respErrCh)
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "done", string(body))
+	assert.Nil(t, <-serveErrCh)
+	assert.True(t, stopped)
+}
+
+func TestReload(t *T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	require.Nil(t, ioutil.WriteFile(file, []byte(`{"foo":"a"}`), 0644))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	c := testConfig(nil)
+	require.Nil(t, c.Parse([]string{"--config", file, "--listen-addr", addr}))
+	assert.Equal(t, "a", c.Str("foo"))
+
+	require.Nil(t, ioutil.WriteFile(file, []byte(`{"foo":"b"}`), 0644))
+	require.Nil(t, c.Reload())
+	assert.Equal(t, "b", c.Str("foo"))
+	assert.Equal(t, addr, c.ListenAddr())
+
+	// A bad file leaves the previous values in place
+	require.Nil(t, ioutil.WriteFile(file, []byte(`{"bar":"c"}`), 0644))
+	assert.NotNil(t, c.Reload())
+	assert.Equal(t, "b", c.Str("foo"))
+
+	// SIGHUP reloads the config and calls the OnReload functions
+	require.Nil(t, ioutil.WriteFile(file, []byte(`{"foo":"d"}`), 0644))
+	reloadCh := make(chan string, 1)
+	c.OnReload(func() error {
+		reloadCh <- c.Str("foo")
+		return nil
+	})
+	serveErrCh := make(chan error)
+	go func() { serveErrCh <- c.ListenAndServe(http.NotFoundHandler()) }()
+	for i := 0; i < 50; i++ {
+		if _, err := http.Get("http://" + addr); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	proc, err := os.FindProcess(os.Getpid())
+	require.Nil(t, err)
+	require.Nil(t, proc.Signal(syscall.SIGHUP))
+	assert.Equal(t, "d", <-reloadCh)
+
+	require.Nil(t, proc.Signal(syscall.SIGTERM))
+	assert.Nil(t, <-serveErrCh)
+}
+
+func TestRedisTLS(t *T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.Nil(t, ioutil.WriteFile(caFile, []byte("not a cert"), 0644))
+
+	c := testConfig(nil)
+	require.Nil(t, c.Parse(nil))
+	tc, err := c.redisTLS()
+	assert.Nil(t, err)
+	assert.Nil(t, tc)
+
+	require.Nil(t, c.Parse([]string{"--redis-tls-ca-file", caFile}))
+	_, err = c.redisTLS()
+	assert.NotNil(t, err)
+
+	require.Nil(t, c.Parse([]string{"--redis-tls"}))
+	tc, err = c.redisTLS()
+	assert.Nil(t, err)
+	assert.NotNil(t, tc)
+
+	require.Nil(t, c.Parse([]string{"--redis-tls", "--redis-tls-ca-file", caFile}))
+	_, err = c.redisTLS()
+	assert.NotNil(t, err)
+}
+
+func TestNotify(t *T) {
+	c := New("test")
+	c.AddNotify()
+	require.Nil(t, c.Parse(nil))
+	s, err := c.Notify()
+	assert.Nil(t, err)
+	assert.Nil(t, s)
+
+	require.Nil(t, c.Parse([]string{"--notify-smtp-addr", "localhost:25"}))
+	_, err = c.Notify()
+	assert.NotNil(t, err)
+
+	require.Nil(t, c.Parse([]string{"--notify-smtp-addr", "localhost:25", "--notify-smtp-from", "noreply@example.com"}))
+	s, err = c.Notify()
+	require.Nil(t, err)
+	assert.IsType(t, &notify.SMTP{}, s)
+
+	require.Nil(t, c.Parse([]string{"--notify-webhook-url", "http://localhost/notify"}))
+	s, err = c.Notify()
+	require.Nil(t, err)
+	assert.IsType(t, &notify.Webhook{}, s)
+
+	require.Nil(t, c.Parse([]string{"--notify-smtp-addr", "localhost:25", "--notify-webhook-url", "http://localhost/notify"}))
+	_, err = c.Notify()
+	assert.NotNil(t, err)
+}
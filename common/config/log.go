@@ -0,0 +1,37 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+)
+
+// AddLogging adds the "log-format" parameter used by Logging
+func (c *Config) AddLogging() {
+	c.Add(Param{
+		Name:        "log-format",
+		Description: "Format to write logs in, \"text\" or \"json\". json logs are written one object per line, access logs to stdout and everything else to stderr",
+		Default:     "text",
+	})
+}
+
+// Logging sets up the standard logger and common.Log according to the
+// "log-format" parameter, and returns the sink access logs should be written
+// to (see apihelper.AccessLogOpts)
+func (c *Config) Logging() (func(apihelper.AccessLogEntry), error) {
+	switch format := c.Str("log-format"); format {
+	case "text":
+		return apihelper.LoggerSink(common.Log), nil
+	case "json":
+		jw := common.JSONLogWriter(os.Stderr)
+		log.SetOutput(jw)
+		log.SetFlags(0)
+		common.Log = log.New(jw, "", 0)
+		return apihelper.JSONSink(os.Stdout), nil
+	default:
+		return nil, fmt.Errorf("--log-format: unknown format %q", format)
+	}
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mediocregopher/mediocre-api/notify"
+)
+
+// AddNotify adds all parameters needed to send notifications using Notify
+func (c *Config) AddNotify() {
+	c.Add(Param{
+		Name:        "notify-smtp-addr",
+		Description: "Address of the SMTP server to send notification emails through, e.g. smtp.example.com:587",
+	})
+	c.Add(Param{
+		Name:        "notify-smtp-from",
+		Description: "Address notification emails are sent from, e.g. \"Example <noreply@example.com>\". Required with --notify-smtp-addr",
+	})
+	c.Add(Param{
+		Name:        "notify-smtp-username",
+		Description: "Username to authenticate with the SMTP server with. Optional",
+	})
+	c.Add(Param{
+		Name:        "notify-smtp-password",
+		Description: "Password to authenticate with the SMTP server with. Optional",
+	})
+	c.Add(Param{
+		Name:        "notify-webhook-url",
+		Description: "URL to POST notifications to as json, instead of sending them over SMTP",
+	})
+	c.Add(Param{
+		Name:        "notify-webhook-secret",
+		Description: "Secret to sign notification webhook requests with. Optional",
+	})
+}
+
+// Notify returns the notify.Sender described by the parameters added by
+// AddNotify, or nil if neither SMTP nor a webhook was configured
+func (c *Config) Notify() (notify.Sender, error) {
+	smtpAddr, webhookURL := c.Str("notify-smtp-addr"), c.Str("notify-webhook-url")
+	switch {
+	case smtpAddr != "" && webhookURL != "":
+		return nil, errors.New("--notify-smtp-addr can't be used with --notify-webhook-url")
+
+	case smtpAddr != "":
+		if err := c.Require("notify-smtp-from"); err != nil {
+			return nil, err
+		}
+		s, err := notify.NewSMTP(smtpAddr, c.Str("notify-smtp-from"), &notify.SMTPOpts{
+			Username: c.Str("notify-smtp-username"),
+			Password: c.Str("notify-smtp-password"),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("--notify-smtp-from: %s", err)
+		}
+		return s, nil
+
+	case webhookURL != "":
+		o := &notify.WebhookOpts{}
+		if secret := c.Str("notify-webhook-secret"); secret != "" {
+			o.Secret = []byte(secret)
+		}
+		return notify.NewWebhook(webhookURL, o), nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// AddTLS adds the parameters needed for ListenAndServe to serve HTTPS, either
+// using a given certificate and key or using certificates automatically
+// obtained from Let's Encrypt
+func (c *Config) AddTLS() {
+	c.Add(Param{
+		Name:        "tls-cert",
+		Description: "Certificate file to serve HTTPS with. Requires --tls-key",
+	})
+	c.Add(Param{
+		Name:        "tls-key",
+		Description: "Key file to serve HTTPS with. Requires --tls-cert",
+	})
+	c.Add(Param{
+		Name:        "tls-autocert-domains",
+		Description: "Comma separated list of domains to automatically obtain certificates for from Let's Encrypt. Can't be used with --tls-cert",
+	})
+	c.Add(Param{
+		Name:        "tls-autocert-cache-dir",
+		Description: "Directory to cache certificates obtained from Let's Encrypt in",
+		Default:     "autocert-cache",
+	})
+	c.Add(Param{
+		Name:        "tls-autocert-email",
+		Description: "Contact email to give to Let's Encrypt. Optional",
+	})
+}
+
+// TLS returns the *tls.Config described by the parameters added by AddTLS, or
+// nil if TLS wasn't configured
+func (c *Config) TLS() (*tls.Config, error) {
+	certFile, keyFile := c.Str("tls-cert"), c.Str("tls-key")
+	domains := c.Str("tls-autocert-domains")
+
+	if domains != "" {
+		if certFile != "" || keyFile != "" {
+			return nil, errors.New("--tls-autocert-domains can't be used with --tls-cert or --tls-key")
+		}
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(strings.Split(domains, ",")...),
+			Cache:      autocert.DirCache(c.Str("tls-autocert-cache-dir")),
+			Email:      c.Str("tls-autocert-email"),
+		}
+		return m.TLSConfig(), nil
+	}
+
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	} else if certFile == "" || keyFile == "" {
+		return nil, errors.New("--tls-cert and --tls-key must be given together")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+// OnShutdown registers a function to be called by ListenAndServe once it has
+// finished shutting down the server, e.g. to stop background go-routines.
+// Functions are called in the order they were registered
+func (c *Config) OnShutdown(f func()) {
+	c.onShutdown = append(c.onShutdown, f)
+}
+
+// OnReload registers a function to be called by ListenAndServe whenever the
+// process receives a SIGHUP, after the Config has been reloaded (see Reload).
+// The function should apply any changed values, e.g. by building a new
+// http.Handler and swapping it in. If it returns an error the error is logged
+// and the server keeps running as it was. Functions are called in the order
+// they were registered
+func (c *Config) OnReload(f func() error) {
+	c.onReload = append(c.onReload, f)
+}
+
+// ListenAndServe serves the given http.Handler on the address given by the
+// "listen-addr" parameter. If AddTLS was called and TLS was configured HTTPS
+// will be served, otherwise plain HTTP.
+//
+// When the process receives a SIGINT or SIGTERM the server stops accepting new
+// connections and waits, up to the duration given by the "shutdown-timeout"
+// parameter, for in-flight requests to complete. Once they have (or the
+// timeout is hit) all functions given to OnShutdown are called and
+// ListenAndServe returns. It returns nil if shutdown was clean.
+//
+// If any functions were given to OnReload then SIGHUP causes the Config to be
+// reloaded and those functions to be called, without interrupting the server.
+// The listen address and TLS settings are not changed by a reload
+func (c *Config) ListenAndServe(h http.Handler) error {
+	timeout, err := c.Duration("shutdown-timeout")
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:    c.ListenAddr(),
+		Handler: h,
+	}
+	if _, ok := c.param("tls-cert"); ok {
+		if srv.TLSConfig, err = c.TLS(); err != nil {
+			return err
+		}
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	hupCh := make(chan os.Signal, 1)
+	if len(c.onReload) > 0 {
+		signal.Notify(hupCh, syscall.SIGHUP)
+		defer signal.Stop(hupCh)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			log.Printf("listening on %s (https)", srv.Addr)
+			errCh <- srv.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("listening on %s", srv.Addr)
+			errCh <- srv.ListenAndServe()
+		}
+	}()
+
+	for shutdown := false; !shutdown; {
+		select {
+		case err := <-errCh:
+			return err
+		case sig := <-sigCh:
+			log.Printf("got %s, shutting down (timeout %s)", sig, timeout)
+			shutdown = true
+		case sig := <-hupCh:
+			log.Printf("got %s, reloading", sig)
+			if err := c.reload(); err != nil {
+				log.Printf("reload failed: %s", err)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err = srv.Shutdown(ctx)
+	for _, f := range c.onShutdown {
+		f()
+	}
+	return err
+}
+
+func (c *Config) reload() error {
+	if err := c.Reload(); err != nil {
+		return err
+	}
+	for _, f := range c.onReload {
+		if err := f(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+// Package events implements a log of domain events (e.g. a user being created)
+// on top of a redis stream. Systems publish events to a Stream as things
+// happen, and other services consume them using consumer groups, which track
+// which events each group has processed so that none are missed, even if a
+// consumer is down when they're published.
+//
+// Events are published after the change they describe has been made, rather
+// than atomically with it, so if publishing fails (e.g. because redis became
+// unreachable in between) the change is kept but its event is lost, see
+// PublishOrLog. Consumers which can't tolerate that should also reconcile
+// against the Systems' data from time to time.
+//
+// Each event is a stream entry with a "type" field, e.g. "user.created", and
+// whatever other fields describe it
+package events
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/radix.v2/redis"
+)
+
+// Types of the events published by the Systems in mediocre-api
+const (
+	UserCreated      = "user.created"
+	RoomJoined       = "room.joined"
+	RoomLeft         = "room.left"
+	BroadcastStarted = "broadcast.started"
+	BroadcastEnded   = "broadcast.ended"
+)
+
+// typeField is the stream entry field an Event's Type is stored in
+const typeField = "type"
+
+// Event is a single event read from a Stream
+type Event struct {
+	// ID is the event's stream entry ID, which is unique within the Stream and
+	// increases with every event published. It's used to Ack the event and to
+	// Replay from a point in the stream
+	ID string
+
+	// Type identifies what happened, e.g. UserCreated
+	Type string
+
+	// Fields describe what happened, and depend on the Type
+	Fields map[string]string
+}
+
+// Time returns the time the event was published, as recorded in its ID
+func (e Event) Time() time.Time {
+	ms, err := strconv.ParseInt(strings.SplitN(e.ID, "-", 2)[0], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+// Stream holds on to a Cmder and uses it to publish and read events on a single
+// redis stream
+type Stream struct {
+	c common.Cmder
+	o *Opts
+}
+
+// Opts are different options which may be passed into New when creating a
+// Stream. They all have sane defaults which will cover most use cases
+type Opts struct {
+
+	// Prefix and Tenant are made part of the stream's key, the same way as
+	// with the Systems publishing to it, so that Streams for different
+	// applications sharing a redis are kept separate. Both default to empty
+	Prefix, Tenant string
+
+	// Key is the redis key of the stream. Defaults to "events", with Prefix
+	// and Tenant (if either is set) appended, e.g. "events:~tenant:prefix"
+	Key string
+
+	// MaxLen is roughly the number of events kept in the stream, older ones
+	// being trimmed as new ones are published. Consumers which fall further
+	// behind than this will miss events. Defaults to 100000
+	MaxLen int64
+}
+
+// New returns a Stream which will use the given Cmder to publish and read
+// events. The passed in Opts may be nil to just use the defaults
+func New(c common.Cmder, o *Opts) *Stream {
+	if o == nil {
+		o = &Opts{}
+	}
+	if o.Key == "" {
+		o.Key = "events"
+		if p := common.TenantPrefix(o.Tenant, o.Prefix); p != "" {
+			o.Key += ":" + p
+		}
+	}
+	if o.MaxLen == 0 {
+		o.MaxLen = 100000
+	}
+	return &Stream{c: c, o: o}
+}
+
+// Key returns the redis key of the stream
+func (s *Stream) Key() string {
+	return s.o.Key
+}
+
+// Publish adds an event of the given type with the given fields to the
+// stream, and returns its ID
+func (s *Stream) Publish(typ string, fields map[string]string) (string, error) {
+	args := make([]interface{}, 0, 6+len(fields)*2)
+	args = append(args, s.o.Key, "MAXLEN", "~", s.o.MaxLen, "*", typeField, typ)
+	for k, v := range fields {
+		if k == typeField {
+			continue
+		}
+		args = append(args, k, v)
+	}
+	return s.c.Cmd("XADD", args...).Str()
+}
+
+// PublishOrLog is like Publish, but logs any error to common.Log rather than
+// returning it. Systems use it to publish events after a change has already
+// been made, when failing to publish shouldn't fail the whole call. An event
+// which fails to be published this way is lost, and is only in the log. s may
+// be nil, in which case nothing is done
+func PublishOrLog(s *Stream, typ string, fields map[string]string) {
+	if s == nil {
+		return
+	}
+	if _, err := s.Publish(typ, fields); err != nil && common.Log != nil {
+		common.Log.Printf("publishing %s event: %s", typ, err)
+	}
+}
+
+// Replay returns up to count events published between the given IDs,
+// inclusive, oldest first. start and end may be "-" and "+" to mean the
+// beginning and end of the stream. It's useful for rebuilding state from past
+// events, and doesn't affect any consumer group
+func (s *Stream) Replay(start, end string, count int) ([]Event, error) {
+	return parseEvents(s.c.Cmd("XRANGE", s.o.Key, start, end, "COUNT", count))
+}
+
+// parseEvents parses the array of stream entries returned by commands like
+// XRANGE and XCLAIM. Entries which have since been trimmed are nil, and are
+// skipped
+func parseEvents(r *redis.Resp) ([]Event, error) {
+	entries, err := r.Array()
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsType(redis.Nil) {
+			continue
+		}
+		parts, err := entry.Array()
+		if err != nil {
+			return nil, err
+		} else if len(parts) != 2 {
+			return nil, errors.New("malformed stream entry")
+		}
+		id, err := parts[0].Str()
+		if err != nil {
+			return nil, err
+		}
+		if parts[1].IsType(redis.Nil) {
+			continue
+		}
+		fields, err := parts[1].Map()
+		if err != nil {
+			return nil, err
+		}
+		typ := fields[typeField]
+		delete(fields, typeField)
+		events = append(events, Event{ID: id, Type: typ, Fields: fields})
+	}
+	return events, nil
+}
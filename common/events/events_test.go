@@ -0,0 +1,84 @@
+package events
+
+import (
+	. "testing"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testStream(t *T) *Stream {
+	if commontest.InProcess {
+		t.Skip("the in-process redis doesn't support streams")
+	}
+	c := commontest.APIStarterKit()
+	return New(c, &Opts{Key: "events:" + commontest.KeyPrefix(t, c)})
+}
+
+func TestKey(t *T) {
+	assert.Equal(t, "events", New(nil, nil).Key())
+	assert.Equal(t, "events:foo", New(nil, &Opts{Prefix: "foo"}).Key())
+	assert.Equal(t, "events:~bar:foo", New(nil, &Opts{Prefix: "foo", Tenant: "bar"}).Key())
+	assert.Equal(t, "baz", New(nil, &Opts{Key: "baz", Tenant: "bar"}).Key())
+}
+
+func TestPublishReplay(t *T) {
+	s := testStream(t)
+	id1, err := s.Publish(UserCreated, map[string]string{"user": "foo"})
+	require.Nil(t, err)
+	id2, err := s.Publish(RoomJoined, map[string]string{"room": "bar", "user": "foo"})
+	require.Nil(t, err)
+
+	events, err := s.Replay("-", "+", 10)
+	require.Nil(t, err)
+	assert.Equal(t, []Event{
+		{ID: id1, Type: UserCreated, Fields: map[string]string{"user": "foo"}},
+		{ID: id2, Type: RoomJoined, Fields: map[string]string{"room": "bar", "user": "foo"}},
+	}, events)
+	assert.WithinDuration(t, time.Now(), events[0].Time(), time.Minute)
+
+	events, err = s.Replay(id2, "+", 10)
+	require.Nil(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, id2, events[0].ID)
+}
+
+func TestGroup(t *T) {
+	s := testStream(t)
+	g := s.Group("test")
+	require.Nil(t, g.Create("$"))
+	require.Nil(t, g.Create("$")) // creating again is fine
+
+	events, err := g.Read("a", 10, 0)
+	require.Nil(t, err)
+	assert.Empty(t, events)
+
+	id, err := s.Publish(UserCreated, map[string]string{"user": "foo"})
+	require.Nil(t, err)
+	events, err = g.Read("a", 10, time.Second)
+	require.Nil(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, id, events[0].ID)
+
+	// Each event is only delivered to one consumer
+	events, err = g.Read("b", 10, 0)
+	require.Nil(t, err)
+	assert.Empty(t, events)
+
+	// a never acks, so b can claim the event once it's been idle long enough
+	events, err = g.Claim("b", time.Minute, 10)
+	require.Nil(t, err)
+	assert.Empty(t, events)
+	time.Sleep(50 * time.Millisecond)
+	events, err = g.Claim("b", 10*time.Millisecond, 10)
+	require.Nil(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, id, events[0].ID)
+
+	require.Nil(t, g.Ack(id))
+	events, err = g.Claim("b", 0, 10)
+	require.Nil(t, err)
+	assert.Empty(t, events)
+}
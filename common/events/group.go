@@ -0,0 +1,127 @@
+package events
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mediocregopher/radix.v2/redis"
+)
+
+// Group is a consumer group on a Stream. Each event is delivered to only one
+// of the group's consumers, and remains pending until that consumer Acks it.
+// Events which a consumer never Acks, e.g. because it crashed, can be taken
+// over by another consumer using Claim
+type Group struct {
+	s    *Stream
+	name string
+}
+
+// Group returns the consumer group with the given name. Create must be called
+// before it can be used
+func (s *Stream) Group(name string) *Group {
+	return &Group{s: s, name: name}
+}
+
+// Create creates the consumer group if it doesn't already exist, creating the
+// stream as well if needed. A new group starts reading after the given ID,
+// which may be "$" to only read events published from now on, or "0" to read
+// every event still in the stream
+func (g *Group) Create(startID string) error {
+	err := g.s.c.Cmd("XGROUP", "CREATE", g.s.o.Key, g.name, startID, "MKSTREAM").Err
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// Read returns up to count events which haven't yet been delivered to any of
+// the group's consumers, delivering them to the given consumer. If there are
+// none it waits up to block for some to be published, or returns immediately
+// if block is 0. The returned events are pending until they're Acked
+func (g *Group) Read(consumer string, count int, block time.Duration) ([]Event, error) {
+	args := []interface{}{"GROUP", g.name, consumer, "COUNT", count}
+	if block > 0 {
+		args = append(args, "BLOCK", int64(block/time.Millisecond))
+	}
+	args = append(args, "STREAMS", g.s.o.Key, ">")
+
+	r := g.s.c.Cmd("XREADGROUP", args...)
+	if r.Err != nil {
+		return nil, r.Err
+	} else if r.IsType(redis.Nil) {
+		return nil, nil
+	}
+
+	// The reply is a list of [key, entries] pairs, one per stream read from
+	streams, err := r.Array()
+	if err != nil {
+		return nil, err
+	}
+	var events []Event
+	for _, stream := range streams {
+		parts, err := stream.Array()
+		if err != nil {
+			return nil, err
+		} else if len(parts) != 2 {
+			continue
+		}
+		es, err := parseEvents(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, es...)
+	}
+	return events, nil
+}
+
+// Ack marks the events with the given IDs as having been processed by the
+// group, so they're no longer pending
+func (g *Group) Ack(ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, 2+len(ids))
+	args = append(args, g.s.o.Key, g.name)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	return g.s.c.Cmd("XACK", args...).Err
+}
+
+// Claim takes over up to count events which were delivered to other consumers
+// in the group at least minIdle ago but never Acked, delivering them to the
+// given consumer instead, and returns them. It should be called periodically
+// by consumers so that events aren't lost when a consumer dies
+func (g *Group) Claim(consumer string, minIdle time.Duration, count int) ([]Event, error) {
+	pending, err := g.s.c.Cmd("XPENDING", g.s.o.Key, g.name, "-", "+", count).Array()
+	if err != nil {
+		return nil, err
+	}
+
+	minIdleMS := int64(minIdle / time.Millisecond)
+	args := []interface{}{g.s.o.Key, g.name, consumer, minIdleMS}
+	for _, p := range pending {
+		// Each is [id, consumer, idle ms, times delivered]
+		parts, err := p.Array()
+		if err != nil {
+			return nil, err
+		} else if len(parts) < 3 {
+			continue
+		}
+		idle, err := parts[2].Int64()
+		if err != nil {
+			return nil, err
+		} else if idle < minIdleMS {
+			continue
+		}
+		id, err := parts[0].Str()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, id)
+	}
+	if len(args) == 4 {
+		return nil, nil
+	}
+	return parseEvents(g.s.c.Cmd("XCLAIM", args...))
+}
@@ -0,0 +1,164 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthCheck checks the health of a single dependency of a service, returning
+// nil if it is healthy
+type HealthCheck func() error
+
+// Pinger is implemented by anything which can check its own connectivity, such
+// as a store backed by redis. A Pinger's Ping method can be used directly as a
+// HealthCheck
+type Pinger interface {
+	Ping() error
+}
+
+// CmderCheck returns a HealthCheck which PINGs redis using the given Cmder
+func CmderCheck(c Cmder) HealthCheck {
+	return func() error {
+		return c.Cmd("PING").Err
+	}
+}
+
+// HTTPCheck returns a HealthCheck which makes a GET request to the given url,
+// and considers the dependency healthy if a 2xx response is returned. It is
+// useful for checking the health endpoint of an upstream service
+func HTTPCheck(url string) HealthCheck {
+	return func() error {
+		resp, err := http.Get(url)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("%s returned %s", url, resp.Status)
+		}
+		return nil
+	}
+}
+
+// Health holds a set of named HealthChecks, one per subsystem of a service,
+// and exposes their status over http
+type Health struct {
+	// The maximum amount of time all checks are given to complete. A check
+	// which hasn't completed by then is considered to have failed. Defaults to
+	// 5 seconds
+	Timeout time.Duration
+
+	l      sync.Mutex
+	checks map[string]HealthCheck
+}
+
+// NewHealth returns a Health with no checks and all of its fields initialized
+// to their default values
+func NewHealth() *Health {
+	return &Health{
+		Timeout: 5 * time.Second,
+		checks:  map[string]HealthCheck{},
+	}
+}
+
+// Add adds a HealthCheck under the given name, replacing any existing check
+// with that name
+func (h *Health) Add(name string, check HealthCheck) {
+	h.l.Lock()
+	defer h.l.Unlock()
+	h.checks[name] = check
+}
+
+var errCheckTimeout = errors.New("timed out")
+
+// Check runs all HealthChecks concurrently and returns the result of each,
+// keyed by name
+func (h *Health) Check() map[string]error {
+	h.l.Lock()
+	checks := make(map[string]HealthCheck, len(h.checks))
+	for name, check := range h.checks {
+		checks[name] = check
+	}
+	h.l.Unlock()
+
+	type result struct {
+		name string
+		err  error
+	}
+	resCh := make(chan result, len(checks))
+	for name, check := range checks {
+		go func(name string, check HealthCheck) {
+			resCh <- result{name, check()}
+		}(name, check)
+	}
+
+	ret := make(map[string]error, len(checks))
+	timeout := time.After(h.Timeout)
+	for range checks {
+		select {
+		case res := <-resCh:
+			ret[res.name] = res.err
+		case <-timeout:
+			for name := range checks {
+				if _, ok := ret[name]; !ok {
+					ret[name] = errCheckTimeout
+				}
+			}
+			return ret
+		}
+	}
+	return ret
+}
+
+// HealthStatus is what is returned, as JSON, by the Health's readiness handler
+type HealthStatus struct {
+	// "ok" if all checks passed, "unavailable" otherwise
+	Status string `json:"status"`
+
+	// The result of each check, "ok" or the error it returned
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Status runs all HealthChecks and returns the combined result
+func (h *Health) Status() HealthStatus {
+	hs := HealthStatus{Status: "ok", Checks: map[string]string{}}
+	for name, err := range h.Check() {
+		if err != nil {
+			hs.Status = "unavailable"
+			hs.Checks[name] = err.Error()
+		} else {
+			hs.Checks[name] = "ok"
+		}
+	}
+	return hs
+}
+
+// Liveness returns an http.Handler, generally served at /healthz, which always
+// responds with a 200 as long as the process is up and able to serve requests
+func (h *Health) Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealthStatus(w, HealthStatus{Status: "ok"})
+	})
+}
+
+// Readiness returns an http.Handler, generally served at /readyz, which runs
+// every HealthCheck and responds with the result of each. The response code
+// will be 200 if all checks passed, or 503 otherwise
+func (h *Health) Readiness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealthStatus(w, h.Status())
+	})
+}
+
+func writeHealthStatus(w http.ResponseWriter, hs HealthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if hs.Status != "ok" {
+		w.WriteHeader(503)
+	}
+	json.NewEncoder(w).Encode(hs)
+}
@@ -0,0 +1,101 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Logger describes a logger which HTTPError can write to. *log.Logger
+// implements it
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// Log is where HTTPError logs unexpected errors and the causes of expected
+// ones. It may be replaced to send these logs elsewhere, or set to nil to
+// disable them. Defaults to a *log.Logger writing to stderr
+var Log Logger = log.New(os.Stderr, "", log.LstdFlags)
+
+// Reporter, if set, is called by HTTPError whenever it is about to send a
+// response with a 5xx status code, i.e. for any error which isn't an
+// ExpectedErr or is an ExpectedErr with a 5xx Code. It can be used to send these
+// errors to an error tracking service. requestID will be the result of
+// calling RequestID on the request. It is called synchronously, so it should
+// not block
+var Reporter func(r *http.Request, requestID string, err error)
+
+// JSONLogWriter returns an io.Writer which writes each Write made to it to the
+// given io.Writer as a json object with "time" and "msg" fields, followed by a
+// newline. It's intended to be used as the output of a *log.Logger with no
+// flags set, e.g.
+//
+//	common.Log = log.New(common.JSONLogWriter(os.Stderr), "", 0)
+//
+// It is safe to use from multiple go-routines
+func JSONLogWriter(w io.Writer) io.Writer {
+	return &jsonLogWriter{enc: json.NewEncoder(w)}
+}
+
+type jsonLogWriter struct {
+	l   sync.Mutex
+	enc *json.Encoder
+}
+
+func (jw *jsonLogWriter) Write(b []byte) (int, error) {
+	jw.l.Lock()
+	defer jw.l.Unlock()
+	err := jw.enc.Encode(struct {
+		Time time.Time `json:"time"`
+		Msg  string    `json:"msg"`
+	}{time.Now().UTC(), strings.TrimSuffix(string(b), "\n")})
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// RequestIDHeader is the header which RequestID will fall back to looking in
+// if a request ID hasn't been set on a request using WithRequestID
+const RequestIDHeader = "X-Request-ID"
+
+type ctxKey int
+
+const (
+	requestIDKey ctxKey = iota
+)
+
+// WithRequestID returns a copy of the request with the given request ID set on
+// its context, to later be retrieved by RequestID
+func WithRequestID(r *http.Request, id string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey, id))
+}
+
+// RequestID returns the request ID which was set on the request using
+// WithRequestID, or the value of its RequestIDHeader if one wasn't. Empty
+// string is returned if neither is set
+func RequestID(r *http.Request) string {
+	if id, ok := r.Context().Value(requestIDKey).(string); ok {
+		return id
+	}
+	return r.Header.Get(RequestIDHeader)
+}
+
+// logErr logs the given message about a request, including its request ID if
+// it has one
+func logErr(r *http.Request, requestID, msg string) {
+	if Log == nil {
+		return
+	}
+	if requestID != "" {
+		Log.Printf("%s %s [%s] -> %s", r.Method, r.URL, requestID, msg)
+	} else {
+		Log.Printf("%s %s -> %s", r.Method, r.URL, msg)
+	}
+}
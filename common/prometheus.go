@@ -0,0 +1,60 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// PromLabels formats the given label names and values, alternating, as the
+// inside of a prometheus metric's braces, e.g. `route="foo",code="200"`
+func PromLabels(namevals ...string) string {
+	parts := make([]string, 0, len(namevals)/2)
+	for i := 0; i+1 < len(namevals); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=%q", namevals[i], namevals[i+1]))
+	}
+	return strings.Join(parts, ",")
+}
+
+// WritePromHeader writes the HELP and TYPE lines which come before a metric's
+// samples in the prometheus text exposition format
+func WritePromHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// PromHistogram is a single series of a prometheus histogram, as written by
+// WritePromHistogram
+type PromHistogram struct {
+
+	// The series' labels, as returned by PromLabels
+	Labels string
+
+	// Counts[i] is the number of observations which were at most Buckets[i].
+	// The counts are cumulative, and Count acts as the final, infinite, bucket
+	Buckets []time.Duration
+	Counts  []int64
+
+	// The total number and sum of all observations
+	Count int64
+	Sum   time.Duration
+}
+
+// WritePromHistogram writes the header of the histogram with the given name,
+// followed by the bucket, sum and count samples of each of the given series, in
+// the prometheus text exposition format. Durations are written in seconds
+func WritePromHistogram(w io.Writer, name, help string, hs []PromHistogram) {
+	WritePromHeader(w, name, "histogram", help)
+	for _, h := range hs {
+		sep := ""
+		if h.Labels != "" {
+			sep = ","
+		}
+		for i, b := range h.Buckets {
+			fmt.Fprintf(w, "%s_bucket{%s%sle=\"%g\"} %d\n", name, h.Labels, sep, b.Seconds(), h.Counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, h.Labels, sep, h.Count)
+		fmt.Fprintf(w, "%s_sum{%s} %g\n", name, h.Labels, h.Sum.Seconds())
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, h.Labels, h.Count)
+	}
+}
@@ -0,0 +1,42 @@
+package common
+
+import (
+	"github.com/mediocregopher/radix.v2/pubsub"
+	"github.com/mediocregopher/radix.v2/redis"
+)
+
+// Publish publishes the message to the given channel, e.g. to tell other
+// processes about a change. Whatever's being published about has generally
+// already happened by the time this is called, so rather than returning an
+// error a failure is logged to Log, using what to describe the message
+func Publish(c Cmder, channel string, msg interface{}, what string) {
+	if err := c.Cmd("PUBLISH", channel, msg).Err; err != nil && Log != nil {
+		Log.Printf("publishing %s: %s", what, err)
+	}
+}
+
+// Subscribe subscribes the given connection to the given channel, and calls fn
+// with every message published to it. Messages published while the connection
+// isn't subscribed (e.g. before Subscribe is called, or while reconnecting)
+// are missed.
+//
+// The connection must not be used for anything else. Subscribe blocks until the
+// connection fails (e.g. because it was closed), and returns the error
+func Subscribe(conn *redis.Client, channel string, fn func(msg string)) error {
+	sc := pubsub.NewSubClient(conn)
+	if r := sc.Subscribe(channel); r.Err != nil {
+		return r.Err
+	}
+	for {
+		r := sc.Receive()
+		if r.Err != nil {
+			if r.Timeout() {
+				continue
+			}
+			return r.Err
+		} else if r.Type != pubsub.Message {
+			continue
+		}
+		fn(r.Message)
+	}
+}
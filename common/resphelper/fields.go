@@ -0,0 +1,119 @@
+package resphelper
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	bytesType = reflect.TypeOf([]byte(nil))
+	timeType  = reflect.TypeOf(time.Time{})
+
+	stringMapType   = reflect.TypeOf(map[string]string(nil))
+	stringSliceType = reflect.TypeOf([]string(nil))
+	int64SliceType  = reflect.TypeOf([]int64(nil))
+)
+
+type fieldKind int
+
+const (
+	kindUnsupported fieldKind = iota
+	kindInt64
+	kindInt
+	kindString
+	kindBytes
+	kindBool
+	kindFloat64
+	kindTime
+	kindStringMap
+	kindStringSlice
+	kindInt64Slice
+	kindStruct
+	kindStructPtr
+)
+
+// respField holds everything about a single struct field which UnmarshalResp
+// and MarshalToArgs need, so that it only needs to be worked out once per type
+type respField struct {
+	index     int
+	kind      fieldKind
+	name      string
+	omitEmpty bool
+	required  bool
+	def       *string
+}
+
+var fieldCache sync.Map // reflect.Type -> []respField
+
+// typeFields returns the respFields for the given struct type, computing and
+// caching them if this is the first time the type has been seen
+func typeFields(t reflect.Type) []respField {
+	if fields, ok := fieldCache.Load(t); ok {
+		return fields.([]respField)
+	}
+
+	fields := make([]respField, t.NumField())
+	for i := range fields {
+		structField := t.Field(i)
+		fields[i] = parseRespTag(structField)
+		fields[i].index = i
+		fields[i].kind = kindOf(structField.Type)
+	}
+
+	// If another goroutine got here first it doesn't matter, the result is the
+	// same either way
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+func kindOf(t reflect.Type) fieldKind {
+	switch k := t.Kind(); {
+	case k == reflect.Int64:
+		return kindInt64
+	case k == reflect.Int:
+		return kindInt
+	case k == reflect.String:
+		return kindString
+	case t == bytesType:
+		return kindBytes
+	case k == reflect.Bool:
+		return kindBool
+	case k == reflect.Float64:
+		return kindFloat64
+	case t == timeType:
+		return kindTime
+	case t == stringMapType:
+		return kindStringMap
+	case t == stringSliceType:
+		return kindStringSlice
+	case t == int64SliceType:
+		return kindInt64Slice
+	case k == reflect.Struct:
+		return kindStruct
+	case k == reflect.Ptr && t.Elem().Kind() == reflect.Struct:
+		return kindStructPtr
+	}
+	return kindUnsupported
+}
+
+func parseRespTag(f reflect.StructField) respField {
+	rf := respField{name: f.Name}
+	parts := strings.Split(f.Tag.Get("resp"), ",")
+	if parts[0] != "" {
+		rf.name = parts[0]
+	}
+	for _, opt := range parts[1:] {
+		switch opt {
+		case "omitempty":
+			rf.omitEmpty = true
+		case "required":
+			rf.required = true
+		}
+	}
+	if def, ok := f.Tag.Lookup("respdefault"); ok {
+		rf.def = &def
+	}
+	return rf
+}
@@ -6,24 +6,33 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strconv"
+	"time"
 
 	"github.com/mediocregopher/radix.v2/redis"
 )
 
-var bytesType = reflect.TypeOf([]byte(nil))
-
 // UnmarshalResp takes a *redis.Resp and attemps to unmarshal its data into the
 // given struct or pointer to a struct.
 //
-// Struct fields must be of types string, []byte, int, or int64. Embedded
-// structs and pointers to structs are also allowed
+// Struct fields must be of types string, []byte, int, int64, bool, float64 or
+// time.Time. Embedded structs and pointers to structs are also allowed. bools
+// are read from "1" and "0" (or integer replies), and time.Times are read from
+// either RFC3339 strings or unix timestamps, and are always returned in UTC.
+// Fields of type map[string]string, []string and []int64 are filled from
+// nested array replies, such as those returned by a lua script
 //
 // A struct field can tag itself using "resp" in order to change the name of the
-// key it will look at when filling itself in.
+// key it will look at when filling itself in. Fields which aren't found in the
+// Resp are left alone, unless they have a "respdefault" tag, in which case they
+// are filled in as if the Resp had that value, or the "required" option, in
+// which case an error is returned.
 //
 //	type Foo struct {
 //		A string
-//		B int `resp: "bb"`
+//		B int    `resp:"bb"`
+//		C int    `resp:"cc" respdefault:"10"`
+//		D string `resp:"dd,required"`
 //	}
 //	r := conn.Cmd("HGETALL", "foo") // retrieve resp
 //	f := Foo{}
@@ -43,45 +52,23 @@ func UnmarshalResp(r *redis.Resp, i interface{}) error {
 		return err
 	}
 
-	for ii, n := 0, t.NumField(); ii < n; ii++ {
-		structField := t.Field(ii)
-		fieldV := v.Field(ii)
-		fieldT := fieldV.Type()
-		fieldName := structField.Name
-		if tagName := structField.Tag.Get("resp"); tagName != "" {
-			fieldName = tagName
-		}
-
-		rv, ok := rm[fieldName]
+	for _, f := range typeFields(t) {
+		fieldV := v.Field(f.index)
 
-		var fieldVV interface{}
-		shouldAssign := true
-		err = nil
-		if fieldK := fieldV.Kind(); fieldK == reflect.Int64 && ok {
-			fieldVV, err = rv.Int64()
-		} else if fieldK == reflect.Int {
-			if !ok {
-				continue
-			}
-			fieldVV, err = rv.Int()
-		} else if fieldK == reflect.String {
-			if !ok {
-				continue
-			}
-			fieldVV, err = rv.Str()
-		} else if fieldT == bytesType {
-			if !ok {
-				continue
-			}
-			fieldVV, err = rv.Bytes()
-		} else if fieldK == reflect.Struct ||
-			(fieldK == reflect.Ptr && fieldT.Elem().Kind() == reflect.Struct) {
+		rv, ok := rm[f.name]
+		if !ok && f.def != nil {
+			rv, ok = redis.NewResp(*f.def), true
+		} else if !ok && f.required {
+			return fmt.Errorf("required field %q missing", f.name)
+		}
 
-			if fieldK == reflect.Struct {
+		if f.kind == kindStruct || f.kind == kindStructPtr {
+			var fieldVV interface{}
+			if f.kind == kindStruct {
 				fieldVV = fieldV.Addr().Interface()
 			} else {
 				if fieldV.IsNil() {
-					fieldV.Set(reflect.New(fieldT.Elem()))
+					fieldV.Set(reflect.New(fieldV.Type().Elem()))
 				}
 				fieldVV = fieldV.Interface()
 			}
@@ -89,25 +76,173 @@ func UnmarshalResp(r *redis.Resp, i interface{}) error {
 				err = UnmarshalResp(r, fieldVV)
 			} else if rv.IsType(redis.Array) {
 				err = UnmarshalResp(rv, fieldVV)
-			} else {
-				continue
 			}
-			shouldAssign = false
+			if err != nil {
+				return err
+			}
+			continue
+		} else if f.kind == kindUnsupported {
+			return fmt.Errorf("unsupported UnmarshalResp type %s", fieldV.Kind())
+		} else if !ok {
+			continue
+		}
 
-		} else {
-			err = fmt.Errorf("unsupported UnmarshalResp type %s", fieldK)
+		var fieldVV interface{}
+		switch f.kind {
+		case kindInt64:
+			fieldVV, err = rv.Int64()
+		case kindInt:
+			fieldVV, err = rv.Int()
+		case kindString:
+			fieldVV, err = rv.Str()
+		case kindBytes:
+			fieldVV, err = rv.Bytes()
+		case kindBool:
+			fieldVV, err = respBool(rv)
+		case kindFloat64:
+			fieldVV, err = rv.Float64()
+		case kindTime:
+			fieldVV, err = respTime(rv)
+		case kindStringMap:
+			fieldVV, err = rv.Map()
+		case kindStringSlice:
+			fieldVV, err = rv.List()
+		case kindInt64Slice:
+			fieldVV, err = respInt64s(rv)
 		}
 		if err != nil {
 			return err
 		}
-		if shouldAssign {
-			fieldV.Set(reflect.ValueOf(fieldVV))
-		}
+		fieldV.Set(reflect.ValueOf(fieldVV))
 	}
 
 	return nil
 }
 
+// MarshalToArgs takes in a struct or pointer to a struct and returns a flat
+// slice of field names and values, suitable for passing into HMSET. It is the
+// counterpart of UnmarshalResp, and follows the same rules for field types and
+// "resp" tags, except that map and slice fields aren't supported since they
+// can't be stored in a hash. Embedded structs and fields which are structs or
+// pointers to structs have their fields flattened into the returned slice, and
+// nil struct pointers are skipped. time.Times are written as RFC3339 strings
+// in UTC, with the zero time written as an empty string. Fields tagged with the
+// "omitempty" option are left out of the slice if they have their zero value.
+//
+//	f := Foo{A: "a", B: 2}
+//	args, err := resphelper.MarshalToArgs(&f)
+//	if err != nil {
+//		// handle error
+//	}
+//	conn.Cmd("HMSET", "foo", args)
+//
+func MarshalToArgs(i interface{}) ([]interface{}, error) {
+	v := reflect.ValueOf(i)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, errors.New("Must give a struct or struct pointer")
+	}
+	t := v.Type()
+
+	fields := typeFields(t)
+	args := make([]interface{}, 0, len(fields)*2)
+	for _, f := range fields {
+		fieldV := v.Field(f.index)
+		if f.omitEmpty && fieldV.IsZero() {
+			continue
+		}
+
+		switch f.kind {
+		case kindInt64, kindInt:
+			args = append(args, f.name, fieldV.Int())
+		case kindString:
+			args = append(args, f.name, fieldV.String())
+		case kindBytes:
+			args = append(args, f.name, fieldV.Bytes())
+		case kindBool:
+			if fieldV.Bool() {
+				args = append(args, f.name, 1)
+			} else {
+				args = append(args, f.name, 0)
+			}
+		case kindFloat64:
+			args = append(args, f.name, strconv.FormatFloat(fieldV.Float(), 'f', -1, 64))
+		case kindTime:
+			args = append(args, f.name, marshalTime(fieldV.Interface().(time.Time)))
+		case kindStruct, kindStructPtr:
+			if f.kind == kindStructPtr && fieldV.IsNil() {
+				continue
+			}
+			innerArgs, err := MarshalToArgs(fieldV.Interface())
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, innerArgs...)
+		default:
+			return nil, fmt.Errorf("unsupported MarshalToArgs type %s", fieldV.Kind())
+		}
+	}
+
+	return args, nil
+}
+
+func respBool(r *redis.Resp) (bool, error) {
+	if r.IsType(redis.Int) {
+		i, err := r.Int64()
+		return i != 0, err
+	}
+	s, err := r.Str()
+	if err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(s)
+}
+
+func respInt64s(r *redis.Resp) ([]int64, error) {
+	l, err := r.Array()
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]int64, len(l))
+	for i := range l {
+		if ret[i], err = l[i].Int64(); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+func respTime(r *redis.Resp) (time.Time, error) {
+	var unix int64
+	var err error
+	if r.IsType(redis.Int) {
+		unix, err = r.Int64()
+	} else {
+		var s string
+		if s, err = r.Str(); err != nil || s == "" {
+			return time.Time{}, err
+		}
+		var t time.Time
+		if t, err = time.Parse(time.RFC3339Nano, s); err == nil {
+			return t.UTC(), nil
+		}
+		unix, err = strconv.ParseInt(s, 10, 64)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not parse time: %s", err)
+	}
+	return time.Unix(unix, 0).UTC(), nil
+}
+
+func marshalTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
 func respToMap(r *redis.Resp) (map[string]*redis.Resp, error) {
 	rm := map[string]*redis.Resp{}
 	l, err := r.Array()
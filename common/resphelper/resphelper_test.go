@@ -2,6 +2,7 @@ package resphelper
 
 import (
 	. "testing"
+	"time"
 
 	"github.com/mediocregopher/radix.v2/redis"
 	"github.com/stretchr/testify/assert"
@@ -33,6 +34,96 @@ func TestUnmarshalResp(t *T) {
 	assert.Equal(t, 7, f.E)
 }
 
+func TestUnmarshalRespTypes(t *T) {
+	type Outer struct {
+		A, B, C bool
+		D       float64
+		E, F, G time.Time
+	}
+
+	now := time.Now().UTC()
+	f := Outer{}
+	r := redis.NewResp(map[string]interface{}{
+		"A": "1",
+		"B": "0",
+		"C": 1,
+		"D": "1.5",
+		"E": now.Format(time.RFC3339Nano),
+		"F": now.Unix(),
+		"G": "",
+	})
+	require.Nil(t, UnmarshalResp(r, &f))
+	assert.True(t, f.A)
+	assert.False(t, f.B)
+	assert.True(t, f.C)
+	assert.Equal(t, 1.5, f.D)
+	assert.True(t, now.Equal(f.E))
+	assert.Equal(t, time.UTC, f.E.Location())
+	assert.Equal(t, now.Unix(), f.F.Unix())
+	assert.True(t, f.G.IsZero())
+
+	r = redis.NewResp(map[string]interface{}{"E": "not a time"})
+	assert.NotNil(t, UnmarshalResp(r, &f))
+	r = redis.NewResp(map[string]interface{}{"A": "yes please"})
+	assert.NotNil(t, UnmarshalResp(r, &f))
+}
+
+func TestUnmarshalRespCollections(t *T) {
+	type Outer struct {
+		A map[string]string
+		B []string
+		C []int64
+		D []string // not going to be found
+	}
+
+	f := Outer{}
+	r := redis.NewResp([]interface{}{
+		"A", []string{"foo", "bar", "baz", "buz"},
+		"B", []string{"a", "b", "c"},
+		"C", []interface{}{1, "2", 3},
+	})
+	require.Nil(t, UnmarshalResp(r, &f))
+	assert.Equal(t, map[string]string{"foo": "bar", "baz": "buz"}, f.A)
+	assert.Equal(t, []string{"a", "b", "c"}, f.B)
+	assert.Equal(t, []int64{1, 2, 3}, f.C)
+	assert.Nil(t, f.D)
+
+	r = redis.NewResp([]interface{}{"C", []string{"a"}})
+	assert.NotNil(t, UnmarshalResp(r, &f))
+	r = redis.NewResp([]interface{}{"B", "a"})
+	assert.NotNil(t, UnmarshalResp(r, &f))
+
+	_, err := MarshalToArgs(&f)
+	assert.NotNil(t, err)
+}
+
+func TestRespTagOpts(t *T) {
+	type Outer struct {
+		A string `resp:"aa,omitempty"`
+		B int    `resp:"bb" respdefault:"10"`
+		C bool   `respdefault:"1"`
+		D string `resp:",required"`
+		E int64  `resp:",omitempty" respdefault:"5"`
+	}
+
+	f := Outer{A: "untouched"}
+	r := redis.NewResp(map[string]interface{}{"D": "foo"})
+	require.Nil(t, UnmarshalResp(r, &f))
+	assert.Equal(t, Outer{"untouched", 10, true, "foo", 5}, f)
+
+	f = Outer{}
+	r = redis.NewResp(map[string]interface{}{"bb": 3, "D": "foo"})
+	require.Nil(t, UnmarshalResp(r, &f))
+	assert.Equal(t, Outer{"", 3, true, "foo", 5}, f)
+
+	r = redis.NewResp(map[string]interface{}{"aa": "foo"})
+	assert.NotNil(t, UnmarshalResp(r, &f))
+
+	args, err := MarshalToArgs(&Outer{D: "foo"})
+	require.Nil(t, err)
+	assert.Equal(t, []interface{}{"bb", int64(0), "C", 0, "D", "foo"}, args)
+}
+
 func TestUnmarshalRespInner(t *T) {
 	type InnerA struct {
 		Foo string
@@ -84,3 +175,104 @@ func TestUnmarshalRespInner(t *T) {
 	assert.Equal(t, "again", f.D.Baz)
 	assert.Equal(t, "", f.E)
 }
+
+func TestMarshalToArgs(t *T) {
+	type Inner struct {
+		Foo string
+	}
+	type Outer struct {
+		A int64
+		B int
+		C []byte
+		D string `resp:"dd"`
+		Inner
+		E *Inner
+		F *Inner
+		G bool
+		H float64
+		I time.Time
+	}
+
+	f := Outer{
+		A:     5,
+		B:     6,
+		C:     []byte("hello"),
+		D:     "world",
+		Inner: Inner{Foo: "bar"},
+		G:     true,
+		H:     1.5,
+		I:     time.Unix(1000, 500).UTC(),
+	}
+	args, err := MarshalToArgs(&f)
+	require.Nil(t, err)
+	assert.Equal(t, []interface{}{
+		"A", int64(5),
+		"B", int64(6),
+		"C", []byte("hello"),
+		"dd", "world",
+		"Foo", "bar",
+		"G", 1,
+		"H", "1.5",
+		"I", "1970-01-01T00:16:40.0000005Z",
+	}, args)
+
+	// Round-trip through a flattened resp, the same as HGETALL would return
+	f2 := Outer{}
+	require.Nil(t, UnmarshalResp(redis.NewRespFlattenedStrings(args), &f2))
+	f2.E, f2.F = nil, nil
+	assert.Equal(t, f, f2)
+
+	_, err = MarshalToArgs(struct{ A float32 }{})
+	assert.NotNil(t, err)
+	_, err = MarshalToArgs(5)
+	assert.NotNil(t, err)
+}
+
+type benchStruct struct {
+	A int64
+	B int
+	C []byte
+	D string `resp:"dd"`
+	E bool
+	F float64
+	G time.Time
+}
+
+func BenchmarkUnmarshalResp(b *B) {
+	r := redis.NewRespFlattenedStrings(map[string]interface{}{
+		"A":  5,
+		"B":  6,
+		"C":  "hello",
+		"dd": "world",
+		"E":  1,
+		"F":  "1.5",
+		"G":  "2015-01-01T00:00:00Z",
+	})
+	var f benchStruct
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := UnmarshalResp(r, &f); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalToArgs(b *B) {
+	f := benchStruct{
+		A: 5,
+		B: 6,
+		C: []byte("hello"),
+		D: "world",
+		E: true,
+		F: 1.5,
+		G: time.Now(),
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := MarshalToArgs(&f); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
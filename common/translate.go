@@ -0,0 +1,112 @@
+package common
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Translator, if set, is used by HTTPError to localize the messages of the
+// errors it writes. It is given the error being written and the request's
+// Accept-Language header, and returns the translated message along with the
+// language tag it's in. If it returns false the error's canonical message is
+// used instead. Translations can be used as a Translator.
+//
+// Package code should keep returning its canonical errors, this only affects
+// what is sent to the client
+var Translator func(err ExpectedErr, acceptLanguage string) (string, string, bool)
+
+// Translations maps language tags (e.g. "fr", "pt-BR") to maps of error IDs to
+// their translated message in that language
+//
+//	common.Translator = common.Translations{
+//		"fr": {"user_exists": "l'utilisateur existe déjà"},
+//	}.Translate
+type Translations map[string]map[string]string
+
+// Translate implements the Translator function for Translations. The languages
+// in the Accept-Language header are tried in order of preference. For each one
+// an exact match of the tag is tried, then a match on just its primary
+// language (e.g. "fr" for "fr-CA")
+func (t Translations) Translate(
+	err ExpectedErr, acceptLanguage string,
+) (string, string, bool) {
+	if err.ID == "" {
+		return "", "", false
+	}
+	for _, lang := range parseAcceptLanguage(acceptLanguage) {
+		candidates := []string{lang}
+		if i := strings.Index(lang, "-"); i > 0 {
+			candidates = append(candidates, lang[:i])
+		}
+		for _, c := range candidates {
+			for tag, msgs := range t {
+				if !strings.EqualFold(tag, c) {
+					continue
+				}
+				if msg, ok := msgs[err.ID]; ok {
+					return msg, tag, true
+				}
+			}
+		}
+	}
+	return "", "", false
+}
+
+// parseAcceptLanguage returns the language tags in the given Accept-Language
+// header, ordered by their q value. Tags with a q value of 0 and the "*" tag
+// are left out
+func parseAcceptLanguage(h string) []string {
+	type langQ struct {
+		lang string
+		q    float64
+	}
+	var langs []langQ
+	for _, part := range strings.Split(h, ",") {
+		fields := strings.Split(part, ";")
+		lang := strings.TrimSpace(fields[0])
+		if lang == "" || lang == "*" {
+			continue
+		}
+		q := 1.0
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				if pq, err := strconv.ParseFloat(f[2:], 64); err == nil {
+					q = pq
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		langs = append(langs, langQ{lang, q})
+	}
+
+	sort.SliceStable(langs, func(i, j int) bool {
+		return langs[i].q > langs[j].q
+	})
+	ret := make([]string, len(langs))
+	for i := range langs {
+		ret[i] = langs[i].lang
+	}
+	return ret
+}
+
+// translate returns the given error with its message translated according to
+// Translator, setting the Content-Language header if it was
+func translate(
+	w http.ResponseWriter, r *http.Request, err ExpectedErr,
+) ExpectedErr {
+	if Translator == nil {
+		return err
+	}
+	msg, lang, ok := Translator(err, r.Header.Get("Accept-Language"))
+	if !ok {
+		return err
+	}
+	w.Header().Set("Content-Language", lang)
+	err.Err = msg
+	return err
+}
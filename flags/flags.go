@@ -0,0 +1,249 @@
+// Package flags implements feature flags, stored in redis, which can be turned
+// on for everyone, for a percentage of users, or for specific users, so that
+// features can be rolled out gradually
+package flags
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/user"
+	"github.com/mediocregopher/radix.v2/redis"
+)
+
+// Errors which may be expected from various methods in this package
+var (
+	ErrNotFound       = common.ExpectedErr{Code: 404, ID: "flag_not_found", Err: "flag not found"}
+	ErrInvalidName    = common.ExpectedErr{Code: 400, ID: "invalid_flag_name", Err: "invalid flag name"}
+	ErrInvalidPercent = common.ExpectedErr{Code: 400, ID: "invalid_percent", Err: "percent must be between 0 and 100"}
+)
+
+// Flag describes a single feature flag
+type Flag struct {
+	Name string
+
+	// If true the flag is on for everyone, except those users it's been
+	// overridden for
+	On bool
+
+	// When On is false, the flag is on for this percentage of users, from 0 to
+	// 100. Which users those are is decided by hashing the user's name together
+	// with the flag's, so a user who has a flag on keeps it on as the percentage
+	// is raised, and each flag is rolled out to a different set of users
+	Percent int64
+}
+
+// System holds on to a Cmder and uses it to implement a feature flag system
+type System struct {
+	c common.Cmder
+	o *Opts
+}
+
+// Opts are different options which may be passed into New when creating a
+// system. They all have sane defaults which will cover most use cases
+type Opts struct {
+
+	// Prefix can be used if you wish to have two separate flag systems being
+	// persisted on the same Cmder. Prefix will be part of a string prepended to
+	// all key names
+	Prefix string
+
+	// If set, overrides can only be set for users which exist in this user
+	// System, and SetOverride returns user.ErrNotFound for any others
+	Users *user.System
+}
+
+// New returns a new System which will use the given Cmder as its persistence
+// layer. The passed in Opts may be used to modify behavior of the System, or
+// may be nil to just use the defaults
+func New(c common.Cmder, o *Opts) *System {
+	if o == nil {
+		o = &Opts{}
+	}
+	return &System{c: c, o: o}
+}
+
+// Key returns a key which can be used to interact with some arbitrary flag data
+// directly in redis. This is useful if more complicated, lower level operations
+// are needed to be done
+func (s *System) Key(flag string, extra ...string) string {
+	k := "flags:" + s.o.Prefix + ":{" + flag + "}"
+	if len(extra) > 0 {
+		k += ":" + strings.Join(extra, ":")
+	}
+	return k
+}
+
+// allKey returns the key of the set holding the names of all flags
+func (s *System) allKey() string {
+	return "flags:" + s.o.Prefix + ":all"
+}
+
+// Set creates the given flag, or replaces it if it already exists. Overrides
+// already set for the flag are kept
+func (s *System) Set(f Flag) error {
+	if f.Name == "" {
+		return ErrInvalidName
+	} else if f.Percent < 0 || f.Percent > 100 {
+		return ErrInvalidPercent
+	}
+	on := "0"
+	if f.On {
+		on = "1"
+	}
+	if err := s.c.Cmd("HMSET", s.Key(f.Name), "on", on, "percent", f.Percent).Err; err != nil {
+		return err
+	}
+	return s.c.Cmd("SADD", s.allKey(), f.Name).Err
+}
+
+// Get returns the flag with the given name, or ErrNotFound if it hasn't been
+// Set
+func (s *System) Get(name string) (Flag, error) {
+	m, err := s.c.Cmd("HGETALL", s.Key(name)).Map()
+	if err != nil {
+		return Flag{}, err
+	} else if len(m) == 0 {
+		return Flag{}, ErrNotFound
+	}
+	percent, _ := strconv.ParseInt(m["percent"], 10, 64)
+	return Flag{Name: name, On: m["on"] == "1", Percent: percent}, nil
+}
+
+// List returns all flags which have been Set, sorted by name
+func (s *System) List() ([]Flag, error) {
+	names, err := s.c.Cmd("SMEMBERS", s.allKey()).List()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	fl := make([]Flag, 0, len(names))
+	for _, name := range names {
+		f, err := s.Get(name)
+		if err == ErrNotFound {
+			// Deleted since SMEMBERS was called
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		fl = append(fl, f)
+	}
+	return fl, nil
+}
+
+// Delete removes the flag with the given name along with all of its overrides,
+// after which it is off for everyone. Returns ErrNotFound if the flag doesn't
+// exist
+func (s *System) Delete(name string) error {
+	i, err := s.c.Cmd("DEL", s.Key(name)).Int()
+	if err != nil {
+		return err
+	} else if i == 0 {
+		return ErrNotFound
+	}
+	if err := s.c.Cmd("DEL", s.Key(name, "overrides")).Err; err != nil {
+		return err
+	}
+	return s.c.Cmd("SREM", s.allKey(), name).Err
+}
+
+// SetOverride sets whether the flag with the given name is on for the given
+// user, regardless of the flag's On and Percent. Returns ErrNotFound if the
+// flag doesn't exist
+func (s *System) SetOverride(name, u string, on bool) error {
+	if exists, err := s.c.Cmd("EXISTS", s.Key(name)).Int(); err != nil {
+		return err
+	} else if exists == 0 {
+		return ErrNotFound
+	}
+	if s.o.Users != nil {
+		if _, err := s.o.Users.Get(u, user.Public); err != nil {
+			return err
+		}
+	}
+	v := "0"
+	if on {
+		v = "1"
+	}
+	return s.c.Cmd("HSET", s.Key(name, "overrides"), u, v).Err
+}
+
+// ClearOverride undoes a previous call to SetOverride, so that whether the flag
+// is on for the user goes back to being decided by its On and Percent
+func (s *System) ClearOverride(name, u string) error {
+	return s.c.Cmd("HDEL", s.Key(name, "overrides"), u).Err
+}
+
+// Overrides returns all users which the flag with the given name has been
+// overridden for, and whether it's on for each of them
+func (s *System) Overrides(name string) (map[string]bool, error) {
+	m, err := s.c.Cmd("HGETALL", s.Key(name, "overrides")).Map()
+	if err != nil {
+		return nil, err
+	}
+	o := make(map[string]bool, len(m))
+	for u, v := range m {
+		o[u] = v == "1"
+	}
+	return o, nil
+}
+
+// Evaluate returns whether the flag with the given name is on for the given
+// user. Flags which don't exist are off for everyone, so code can check a flag
+// before it's been Set. An empty user is treated as anonymous, and only has a
+// flag on if the flag's On is true
+func (s *System) Evaluate(u, name string) (bool, error) {
+	f, err := s.Get(name)
+	if err == ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return s.evaluate(u, f)
+}
+
+func (s *System) evaluate(u string, f Flag) (bool, error) {
+	if u == "" {
+		return f.On, nil
+	}
+
+	r := s.c.Cmd("HGET", s.Key(f.Name, "overrides"), u)
+	if r.Err != nil {
+		return false, r.Err
+	} else if !r.IsType(redis.Nil) {
+		v, err := r.Str()
+		return v == "1", err
+	}
+
+	return f.On || bucket(f.Name, u) < f.Percent, nil
+}
+
+// EvaluateAll returns whether each flag which has been Set is on for the given
+// user, as Evaluate would
+func (s *System) EvaluateAll(u string) (map[string]bool, error) {
+	fl, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]bool, len(fl))
+	for _, f := range fl {
+		if m[f.Name], err = s.evaluate(u, f); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// bucket returns a number from 0 to 99 for the given flag and user, which is
+// always the same for the same pair
+func bucket(flag, u string) int64 {
+	h := fnv.New32a()
+	h.Write([]byte(flag))
+	h.Write([]byte{0})
+	h.Write([]byte(u))
+	return int64(h.Sum32() % 100)
+}
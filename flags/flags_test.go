@@ -0,0 +1,152 @@
+package flags
+
+import (
+	"fmt"
+	. "testing"
+
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/mediocregopher/mediocre-api/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSystem(t *T) *System {
+	p := commontest.APIStarterKit()
+	return New(p, &Opts{Prefix: commontest.KeyPrefix(t, p)})
+}
+
+func assertEvaluate(t *T, s *System, u, name string, expected bool) {
+	on, err := s.Evaluate(u, name)
+	require.Nil(t, err)
+	assert.Equal(t, expected, on, "user %q flag %q", u, name)
+}
+
+func TestSetGet(t *T) {
+	s := testSystem(t)
+	name := commontest.RandStr()
+
+	_, err := s.Get(name)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, ErrInvalidName, s.Set(Flag{}))
+	assert.Equal(t, ErrInvalidPercent, s.Set(Flag{Name: name, Percent: 101}))
+	assert.Equal(t, ErrInvalidPercent, s.Set(Flag{Name: name, Percent: -1}))
+
+	f := Flag{Name: name, Percent: 50}
+	require.Nil(t, s.Set(f))
+	fGot, err := s.Get(name)
+	require.Nil(t, err)
+	assert.Equal(t, f, fGot)
+
+	f2 := Flag{Name: commontest.RandStr(), On: true}
+	require.Nil(t, s.Set(f2))
+	l, err := s.List()
+	require.Nil(t, err)
+	assert.ElementsMatch(t, []Flag{f, f2}, l)
+
+	require.Nil(t, s.Delete(name))
+	assert.Equal(t, ErrNotFound, s.Delete(name))
+	l, err = s.List()
+	require.Nil(t, err)
+	assert.Equal(t, []Flag{f2}, l)
+}
+
+func TestEvaluate(t *T) {
+	s := testSystem(t)
+	name, u := commontest.RandStr(), commontest.RandStr()
+
+	// Flags which don't exist are off
+	assertEvaluate(t, s, u, name, false)
+	assertEvaluate(t, s, "", name, false)
+
+	require.Nil(t, s.Set(Flag{Name: name, On: true}))
+	assertEvaluate(t, s, u, name, true)
+	assertEvaluate(t, s, "", name, true)
+
+	require.Nil(t, s.Set(Flag{Name: name, Percent: 100}))
+	assertEvaluate(t, s, u, name, true)
+	assertEvaluate(t, s, "", name, false)
+
+	require.Nil(t, s.Set(Flag{Name: name}))
+	assertEvaluate(t, s, u, name, false)
+
+	m, err := s.EvaluateAll(u)
+	require.Nil(t, err)
+	assert.Equal(t, map[string]bool{name: false}, m)
+}
+
+func TestPercent(t *T) {
+	s := testSystem(t)
+	name := commontest.RandStr()
+	users := make([]string, 1000)
+	for i := range users {
+		users[i] = fmt.Sprintf("user%d", i)
+	}
+
+	countOn := func() map[string]bool {
+		on := map[string]bool{}
+		for _, u := range users {
+			ok, err := s.Evaluate(u, name)
+			require.Nil(t, err)
+			if ok {
+				on[u] = true
+			}
+		}
+		return on
+	}
+
+	require.Nil(t, s.Set(Flag{Name: name, Percent: 10}))
+	on10 := countOn()
+	assert.InDelta(t, 100, len(on10), 50)
+
+	// Raising the percentage keeps the flag on for everyone who had it
+	require.Nil(t, s.Set(Flag{Name: name, Percent: 50}))
+	on50 := countOn()
+	assert.InDelta(t, 500, len(on50), 100)
+	for u := range on10 {
+		assert.True(t, on50[u], u)
+	}
+}
+
+func TestOverrides(t *T) {
+	s := testSystem(t)
+	name, u1, u2 := commontest.RandStr(), commontest.RandStr(), commontest.RandStr()
+
+	assert.Equal(t, ErrNotFound, s.SetOverride(name, u1, true))
+
+	require.Nil(t, s.Set(Flag{Name: name}))
+	require.Nil(t, s.SetOverride(name, u1, true))
+	assertEvaluate(t, s, u1, name, true)
+	assertEvaluate(t, s, u2, name, false)
+
+	require.Nil(t, s.Set(Flag{Name: name, On: true}))
+	require.Nil(t, s.SetOverride(name, u2, false))
+	assertEvaluate(t, s, u1, name, true)
+	assertEvaluate(t, s, u2, name, false)
+
+	o, err := s.Overrides(name)
+	require.Nil(t, err)
+	assert.Equal(t, map[string]bool{u1: true, u2: false}, o)
+
+	require.Nil(t, s.ClearOverride(name, u2))
+	assertEvaluate(t, s, u2, name, true)
+
+	require.Nil(t, s.Delete(name))
+	o, err = s.Overrides(name)
+	require.Nil(t, err)
+	assert.Empty(t, o)
+}
+
+func TestOverridesUsers(t *T) {
+	p := commontest.APIStarterKit()
+	us := user.New(p)
+	us.Prefix = commontest.KeyPrefix(t, p)
+	s := New(p, &Opts{Prefix: commontest.KeyPrefix(t, p), Users: us})
+
+	name, u := commontest.RandStr(), commontest.RandStr()
+	require.Nil(t, s.Set(Flag{Name: name}))
+	assert.Equal(t, user.ErrNotFound, s.SetOverride(name, u, true))
+
+	require.Nil(t, us.Create(u, commontest.RandEmail(), commontest.RandStr()))
+	require.Nil(t, s.SetOverride(name, u, true))
+	assertEvaluate(t, s, u, name, true)
+}
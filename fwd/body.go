@@ -0,0 +1,72 @@
+package fwd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// ErrBodyTooLarge is passed to a Proxy's ErrHandler when a request's body is
+// larger than the Proxy's MaxBodySize
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// limitReader wraps a request body, returning ErrBodyTooLarge if more than max
+// bytes are read from it
+type limitReader struct {
+	io.ReadCloser
+	left     int64
+	exceeded bool
+}
+
+func (lr *limitReader) Read(b []byte) (int, error) {
+	if lr.exceeded {
+		return 0, ErrBodyTooLarge
+	}
+	// Read one more byte than is allowed, so that a body of exactly the max
+	// size isn't considered too large
+	if int64(len(b)) > lr.left+1 {
+		b = b[:lr.left+1]
+	}
+	n, err := lr.ReadCloser.Read(b)
+	if int64(n) > lr.left {
+		lr.exceeded = true
+		return int(lr.left), ErrBodyTooLarge
+	}
+	lr.left -= int64(n)
+	return n, err
+}
+
+// limitBody applies MaxBodySize and BufferBody to the request. If the body was
+// buffered it is returned. If the body is known to be too large already
+// ErrBodyTooLarge is returned. Otherwise the returned limitReader, if any,
+// should be checked after the request is performed to see if the body turned
+// out to be too large
+func (p *Proxy) limitBody(r *http.Request) ([]byte, *limitReader, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil, nil
+	}
+	if p.MaxBodySize > 0 && r.ContentLength > p.MaxBodySize {
+		return nil, nil, ErrBodyTooLarge
+	}
+
+	var lr *limitReader
+	if p.MaxBodySize > 0 {
+		lr = &limitReader{ReadCloser: r.Body, left: p.MaxBodySize}
+		r.Body = lr
+	}
+
+	if !p.BufferBody {
+		return nil, lr, nil
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	return body, nil, nil
+}
@@ -0,0 +1,100 @@
+package fwd
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxBodySize(t *T) {
+	var calls int
+	upstream := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			io.Copy(w, r.Body)
+		},
+	))
+	defer upstream.Close()
+
+	var errs []error
+	p := NewProxy()
+	p.ErrHandler = func(r *http.Request, err error) {
+		errs = append(errs, err)
+	}
+	p.MaxBodySize = 4
+	handler := p.Abs(upstream.URL)
+
+	// knownLen determines whether the request's ContentLength is set
+	doReq := func(body string, knownLen bool) *httptest.ResponseRecorder {
+		var r io.Reader = strings.NewReader(body)
+		if !knownLen {
+			r = ioutil.NopCloser(r)
+		}
+		req, err := http.NewRequest("POST", "http://example.com/", r)
+		require.Nil(t, err)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// The unbuffered, unknown length case is done last, since the upstream may
+	// still be handling the request after the proxy has given up on it
+	for _, buffer := range []bool{true, false} {
+		p.BufferBody = buffer
+		for _, knownLen := range []bool{true, false} {
+			calls, errs = 0, nil
+			w := doReq("OHAI", knownLen)
+			assert.Equal(t, 200, w.Code)
+			assert.Equal(t, "OHAI", w.Body.String())
+			assert.Empty(t, errs)
+
+			w = doReq("OHAI!", knownLen)
+			assert.Equal(t, 413, w.Code)
+			assert.Equal(t, []error{ErrBodyTooLarge}, errs)
+
+			// The upstream is never hit when the oversized body is known
+			// about ahead of time
+			if knownLen || buffer {
+				assert.Equal(t, 1, calls)
+			}
+		}
+	}
+}
+
+func TestBufferBodyRetries(t *T) {
+	var calls int
+	upstream := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				w.WriteHeader(503)
+				return
+			}
+			io.Copy(w, r.Body)
+		},
+	))
+	defer upstream.Close()
+
+	p := NewProxy()
+	p.ErrHandler = testErrHandler
+	p.Retries = 1
+	p.RetryBackoff = 0
+	p.RetryMaxBodySize = 2
+	p.BufferBody = true
+	handler := p.Abs(upstream.URL)
+
+	req, err := http.NewRequest("GET", "http://example.com/", bytes.NewBufferString("OHAI"))
+	require.Nil(t, err)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "OHAI", w.Body.String())
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,188 @@
+package fwd
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBreakerOpen is passed to a Proxy's ErrHandler when a request isn't
+// forwarded because the circuit breaker for its upstream is open
+var ErrBreakerOpen = errors.New("circuit breaker open for upstream")
+
+// BreakerState describes the state a Breaker is in for a single upstream
+type BreakerState int
+
+const (
+	// Closed means requests are being forwarded to the upstream normally
+	Closed BreakerState = iota
+
+	// Open means the upstream has been failing, and requests are not being
+	// forwarded to it at all
+	Open
+
+	// HalfOpen means the upstream was failing, but enough time has passed
+	// that a single probe request will be let through to see if it's
+	// recovered
+	HalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Breaker implements a circuit breaker which tracks the error rate of each
+// upstream separately. When an upstream's error rate gets too high the breaker
+// for it "opens", and requests to it fail fast instead of being forwarded.
+// After OpenTimeout a single probe request is let through; if it succeeds the
+// breaker closes again, otherwise it stays open for another OpenTimeout.
+//
+// A Breaker's fields should not be changed once it has started being used,
+// but a single Breaker may be shared between multiple Proxys
+type Breaker struct {
+
+	// The period over which requests and errors are counted for each
+	// upstream. Counts are reset at the end of each period. Defaults to 10
+	// seconds
+	Window time.Duration
+
+	// The minimum number of requests which must be made to an upstream within
+	// a Window before the breaker can open for it. Defaults to 20
+	MinRequests int
+
+	// The ratio of errors to requests (between 0 and 1) within a Window at
+	// which the breaker will open. Defaults to 0.5
+	ErrorRate float64
+
+	// How long the breaker will stay open before letting a probe request
+	// through. Defaults to 5 seconds
+	OpenTimeout time.Duration
+
+	// If set, will be called whenever the breaker for an upstream changes
+	// state. Useful for metrics and alerting. It is called synchronously, so
+	// it should not block
+	OnStateChange func(upstream string, from, to BreakerState)
+
+	l sync.Mutex
+	m map[string]*upstreamState
+}
+
+type upstreamState struct {
+	state               BreakerState
+	windowStart, openTS time.Time
+	requests, errs      int
+	probing             bool
+}
+
+// NewBreaker returns a Breaker with all of its fields initialized to their
+// default values. Any of the fields may be modified before the Breaker is used
+func NewBreaker() *Breaker {
+	return &Breaker{
+		Window:      10 * time.Second,
+		MinRequests: 20,
+		ErrorRate:   0.5,
+		OpenTimeout: 5 * time.Second,
+	}
+}
+
+// must be called with the lock held
+func (b *Breaker) get(upstream string) *upstreamState {
+	if b.m == nil {
+		b.m = map[string]*upstreamState{}
+	}
+	us, ok := b.m[upstream]
+	if !ok {
+		us = &upstreamState{windowStart: time.Now()}
+		b.m[upstream] = us
+	}
+	return us
+}
+
+// must be called with the lock held
+func (b *Breaker) setState(upstream string, us *upstreamState, to BreakerState) {
+	from := us.state
+	us.state = to
+	if from != to && b.OnStateChange != nil {
+		b.OnStateChange(upstream, from, to)
+	}
+}
+
+// Allow returns whether or not a request should be forwarded to the given
+// upstream. If it returns true Record must be called once the request is
+// completed
+func (b *Breaker) Allow(upstream string) bool {
+	b.l.Lock()
+	defer b.l.Unlock()
+	us := b.get(upstream)
+
+	switch us.state {
+	case Open:
+		if time.Since(us.openTS) < b.OpenTimeout {
+			return false
+		}
+		b.setState(upstream, us, HalfOpen)
+		us.probing = true
+		return true
+	case HalfOpen:
+		if us.probing {
+			return false
+		}
+		us.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Record records the result of a request to the given upstream which was
+// allowed by Allow
+func (b *Breaker) Record(upstream string, success bool) {
+	b.l.Lock()
+	defer b.l.Unlock()
+	us := b.get(upstream)
+
+	if us.state != Closed {
+		us.probing = false
+		if success {
+			us.requests, us.errs = 0, 0
+			us.windowStart = time.Now()
+			b.setState(upstream, us, Closed)
+		} else {
+			us.openTS = time.Now()
+			b.setState(upstream, us, Open)
+		}
+		return
+	}
+
+	if time.Since(us.windowStart) > b.Window {
+		us.requests, us.errs = 0, 0
+		us.windowStart = time.Now()
+	}
+
+	us.requests++
+	if !success {
+		us.errs++
+	}
+
+	if us.requests >= b.MinRequests &&
+		float64(us.errs)/float64(us.requests) >= b.ErrorRate {
+		us.openTS = time.Now()
+		b.setState(upstream, us, Open)
+	}
+}
+
+// State returns the current state of the breaker for the given upstream
+func (b *Breaker) State(upstream string) BreakerState {
+	b.l.Lock()
+	defer b.l.Unlock()
+	return b.get(upstream).state
+}
@@ -0,0 +1,93 @@
+package fwd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker(t *T) {
+	b := NewBreaker()
+	b.MinRequests = 4
+	b.ErrorRate = 0.5
+	b.OpenTimeout = 50 * time.Millisecond
+
+	var changes []BreakerState
+	b.OnStateChange = func(upstream string, from, to BreakerState) {
+		assert.Equal(t, "foo", upstream)
+		changes = append(changes, to)
+	}
+
+	// Not enough requests to open yet
+	for i := 0; i < 3; i++ {
+		require.True(t, b.Allow("foo"))
+		b.Record("foo", false)
+	}
+	assert.Equal(t, Closed, b.State("foo"))
+
+	require.True(t, b.Allow("foo"))
+	b.Record("foo", true)
+	assert.Equal(t, Open, b.State("foo"))
+	assert.False(t, b.Allow("foo"))
+
+	// Other upstreams aren't affected
+	assert.True(t, b.Allow("bar"))
+	b.Record("bar", true)
+
+	// After the timeout a single probe is let through, if it fails the breaker
+	// opens again
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, b.Allow("foo"))
+	assert.False(t, b.Allow("foo"))
+	assert.Equal(t, HalfOpen, b.State("foo"))
+	b.Record("foo", false)
+	assert.Equal(t, Open, b.State("foo"))
+	assert.False(t, b.Allow("foo"))
+
+	// If the probe succeeds the breaker closes
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, b.Allow("foo"))
+	b.Record("foo", true)
+	assert.Equal(t, Closed, b.State("foo"))
+	assert.True(t, b.Allow("foo"))
+
+	assert.Equal(t, []BreakerState{Open, HalfOpen, Open, HalfOpen, Closed}, changes)
+}
+
+func TestProxyBreaker(t *T) {
+	var calls int
+	upstream := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(500)
+		},
+	))
+	defer upstream.Close()
+
+	var errs []error
+	p := NewProxy()
+	p.ErrHandler = func(r *http.Request, err error) {
+		errs = append(errs, err)
+	}
+	p.Breaker = NewBreaker()
+	p.Breaker.MinRequests = 2
+	handler := p.Abs(upstream.URL)
+
+	for i := 0; i < 4; i++ {
+		req, err := http.NewRequest("GET", "http://example.com/", nil)
+		require.Nil(t, err)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if i < 2 {
+			assert.Equal(t, 500, w.Code)
+		} else {
+			assert.Equal(t, 503, w.Code)
+		}
+	}
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, []error{ErrBreakerOpen, ErrBreakerOpen}, errs)
+}
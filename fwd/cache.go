@@ -0,0 +1,301 @@
+package fwd
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/radix.v2/redis"
+)
+
+// CacheStore is used by a ResponseCache to store serialized responses
+type CacheStore interface {
+
+	// Get returns the value stored under the given key, or nil if there isn't
+	// one or it has expired
+	Get(key string) ([]byte, error)
+
+	// Set stores the value under the given key, to expire after the given
+	// duration
+	Set(key string, value []byte, ttl time.Duration) error
+}
+
+// ResponseCache describes how a Proxy should cache GET responses from its
+// upstreams. Responses are keyed on their full upstream URL, plus the values of
+// any request headers listed in Vary.
+//
+// Only responses with a 200 status code are cached, and responses which set a
+// cookie are never cached. Requests with an Authorization header are neither
+// served from nor stored in the cache, unless Authorization is listed in Vary
+type ResponseCache struct {
+
+	// Store is where cached responses are kept. See NewMemCacheStore and
+	// NewRedisCacheStore
+	Store CacheStore
+
+	// TTL is how long a response will be cached for. If HonorCacheControl is
+	// set this is only used for responses which don't specify their own
+	// max-age
+	TTL time.Duration
+
+	// Vary lists request headers whose values should be part of the cache key,
+	// e.g. Accept-Encoding
+	Vary []string
+
+	// HonorCacheControl causes the Cache-Control and Vary headers to be taken
+	// into account. Requests with no-cache or no-store are never served from
+	// the cache, and responses with no-store, no-cache, or private aren't
+	// stored. s-maxage and max-age on responses override TTL. Responses whose
+	// Vary header lists a header not in Vary aren't stored.
+	HonorCacheControl bool
+
+	// MaxBodySize is the largest response body which will be cached. Defaults
+	// to 1MB
+	MaxBodySize int64
+
+	// Bypass, if set, is called on every request. If it returns true the
+	// request is neither served from nor stored in the cache, e.g. because
+	// it's made by an authenticated user. Defaults to nil
+	Bypass func(*http.Request) bool
+}
+
+func (rc *ResponseCache) maxBodySize() int64 {
+	if rc.MaxBodySize == 0 {
+		return 1024 * 1024
+	}
+	return rc.MaxBodySize
+}
+
+// key returns the cache key for the given request, or empty string if the
+// request isn't cacheable
+func (rc *ResponseCache) key(r *http.Request) string {
+	if r.Method != "GET" {
+		return ""
+	}
+	if r.Header.Get("Authorization") != "" && !rc.varies("Authorization") {
+		return ""
+	}
+	if rc.Bypass != nil && rc.Bypass(r) {
+		return ""
+	}
+
+	key := r.URL.String()
+	for _, h := range rc.Vary {
+		key += "\n" + http.CanonicalHeaderKey(h) + ":" +
+			strings.Join(r.Header[http.CanonicalHeaderKey(h)], ",")
+	}
+	return key
+}
+
+func (rc *ResponseCache) varies(header string) bool {
+	for _, h := range rc.Vary {
+		if strings.EqualFold(h, header) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupAllowed returns whether the given request may be served from the cache
+func (rc *ResponseCache) lookupAllowed(r *http.Request) bool {
+	if !rc.HonorCacheControl {
+		return true
+	}
+	cc := parseCacheControl(r.Header)
+	_, noCache := cc["no-cache"]
+	_, noStore := cc["no-store"]
+	return !noCache && !noStore
+}
+
+// ttl returns how long the given response should be cached for, or 0 if it
+// shouldn't be
+func (rc *ResponseCache) ttl(resp *http.Response) time.Duration {
+	if resp.StatusCode != 200 || len(resp.Header["Set-Cookie"]) > 0 {
+		return 0
+	}
+	if !rc.HonorCacheControl {
+		return rc.TTL
+	}
+
+	for _, v := range resp.Header["Vary"] {
+		for _, h := range strings.Split(v, ",") {
+			if h = strings.TrimSpace(h); h != "" && !rc.varies(h) {
+				return 0
+			}
+		}
+	}
+
+	cc := parseCacheControl(resp.Header)
+	for _, d := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := cc[d]; ok {
+			return 0
+		}
+	}
+	for _, d := range []string{"s-maxage", "max-age"} {
+		if v, ok := cc[d]; ok {
+			secs, err := strconv.Atoi(v)
+			if err != nil || secs <= 0 {
+				return 0
+			}
+			return time.Duration(secs) * time.Second
+		}
+	}
+	return rc.TTL
+}
+
+func parseCacheControl(h http.Header) map[string]string {
+	m := map[string]string{}
+	for _, v := range h["Cache-Control"] {
+		for _, d := range strings.Split(v, ",") {
+			d = strings.TrimSpace(d)
+			if d == "" {
+				continue
+			}
+			var val string
+			if i := strings.Index(d, "="); i >= 0 {
+				d, val = d[:i], strings.Trim(d[i+1:], `"`)
+			}
+			m[strings.ToLower(d)] = val
+		}
+	}
+	return m
+}
+
+// get returns the cached response for the given key, if there is one
+func (rc *ResponseCache) get(key string, r *http.Request) (*http.Response, error) {
+	b, err := rc.Store.Get(key)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(b)), r)
+}
+
+// set stores the given response under the given key, if it is cacheable. The
+// response's body will be replaced so that it can still be read
+func (rc *ResponseCache) set(key string, resp *http.Response) error {
+	ttl := rc.ttl(resp)
+	if ttl <= 0 {
+		return nil
+	}
+
+	body, newBody, err := bufferReadCloser(resp.Body, rc.maxBodySize())
+	resp.Body = newBody
+	if err != nil || body == nil {
+		return err
+	}
+
+	stored := *resp
+	stored.ContentLength = int64(len(body))
+	stored.TransferEncoding = nil
+	stored.Header = resp.Header.Clone()
+	stored.Header.Del("Transfer-Encoding")
+
+	buf := new(bytes.Buffer)
+	stored.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err := stored.Write(buf); err != nil {
+		return err
+	}
+	return rc.Store.Set(key, buf.Bytes(), ttl)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// MemCacheStore is a CacheStore which keeps values in memory. It is safe to use
+// from multiple go-routines
+type MemCacheStore struct {
+	maxEntries int
+
+	l sync.Mutex
+	m map[string]memCacheEntry
+}
+
+type memCacheEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewMemCacheStore returns a MemCacheStore which will hold at most maxEntries
+// values at once. If maxEntries is 0 there is no limit
+func NewMemCacheStore(maxEntries int) *MemCacheStore {
+	return &MemCacheStore{
+		maxEntries: maxEntries,
+		m:          map[string]memCacheEntry{},
+	}
+}
+
+// Get implements the method for the CacheStore interface
+func (s *MemCacheStore) Get(key string) ([]byte, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	e, ok := s.m[key]
+	if !ok {
+		return nil, nil
+	} else if time.Now().After(e.expires) {
+		delete(s.m, key)
+		return nil, nil
+	}
+	return e.value, nil
+}
+
+// Set implements the method for the CacheStore interface. If the store is full
+// expired values are evicted, and if that isn't enough an arbitrary value is
+// evicted
+func (s *MemCacheStore) Set(key string, value []byte, ttl time.Duration) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if _, ok := s.m[key]; !ok && s.maxEntries > 0 && len(s.m) >= s.maxEntries {
+		now := time.Now()
+		for k, e := range s.m {
+			if now.After(e.expires) {
+				delete(s.m, k)
+			}
+		}
+		for k := range s.m {
+			if len(s.m) < s.maxEntries {
+				break
+			}
+			delete(s.m, k)
+		}
+	}
+
+	s.m[key] = memCacheEntry{value: value, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+// RedisCacheStore is a CacheStore which keeps values in redis, so that they can
+// be shared between multiple processes
+type RedisCacheStore struct {
+	c      common.Cmder
+	prefix string
+}
+
+// NewRedisCacheStore returns a RedisCacheStore which will use the given Cmder,
+// prefixing all of its keys with the given prefix
+func NewRedisCacheStore(c common.Cmder, prefix string) *RedisCacheStore {
+	return &RedisCacheStore{c: c, prefix: prefix}
+}
+
+// Get implements the method for the CacheStore interface
+func (s *RedisCacheStore) Get(key string) ([]byte, error) {
+	r := s.c.Cmd("GET", s.prefix+key)
+	if r.IsType(redis.Nil) {
+		return nil, nil
+	}
+	return r.Bytes()
+}
+
+// Set implements the method for the CacheStore interface
+func (s *RedisCacheStore) Set(key string, value []byte, ttl time.Duration) error {
+	ms := int64(ttl / time.Millisecond)
+	if ms <= 0 {
+		ms = 1
+	}
+	return s.c.Cmd("SET", s.prefix+key, value, "PX", ms).Err
+}
@@ -0,0 +1,136 @@
+package fwd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemCacheStore(t *T) {
+	s := NewMemCacheStore(2)
+
+	require.Nil(t, s.Set("a", []byte("A"), time.Hour))
+	require.Nil(t, s.Set("b", []byte("B"), time.Millisecond))
+	b, err := s.Get("a")
+	require.Nil(t, err)
+	assert.Equal(t, []byte("A"), b)
+
+	// b should be evicted since it's expired, leaving a
+	time.Sleep(5 * time.Millisecond)
+	require.Nil(t, s.Set("c", []byte("C"), time.Hour))
+	b, _ = s.Get("a")
+	assert.Equal(t, []byte("A"), b)
+	b, _ = s.Get("b")
+	assert.Nil(t, b)
+	b, _ = s.Get("c")
+	assert.Equal(t, []byte("C"), b)
+}
+
+func TestResponseCache(t *T) {
+	var calls int
+	upstream := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if cc := r.URL.Query().Get("cc"); cc != "" {
+				w.Header().Set("Cache-Control", cc)
+			}
+			if r.URL.Query().Get("cookie") != "" {
+				w.Header().Set("Set-Cookie", "foo=bar")
+			}
+			w.Header().Set("X-Lang", r.Header.Get("Accept-Language"))
+			fmt.Fprintf(w, "call %d", calls)
+		},
+	))
+	defer upstream.Close()
+
+	p := NewProxy()
+	p.ErrHandler = testErrHandler
+	p.Cache = &ResponseCache{
+		Store: NewMemCacheStore(0),
+		TTL:   time.Hour,
+		Vary:  []string{"Accept-Language"},
+	}
+	handler := p.Rel(upstream.URL, "/")
+
+	doReq := func(method, path string, hdrs ...string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, "http://example.com"+path, nil)
+		require.Nil(t, err)
+		for i := 0; i < len(hdrs); i += 2 {
+			req.Header.Set(hdrs[i], hdrs[i+1])
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// Second request is served from the cache, headers and all
+	calls = 0
+	assert.Equal(t, "call 1", doReq("GET", "/a").Body.String())
+	w := doReq("GET", "/a")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "call 1", w.Body.String())
+	assert.Equal(t, "call 2", doReq("GET", "/a?b").Body.String())
+
+	// Vary headers are part of the key
+	w = doReq("GET", "/a", "Accept-Language", "fr")
+	assert.Equal(t, "call 3", w.Body.String())
+	assert.Equal(t, "fr", w.Header().Get("X-Lang"))
+	w = doReq("GET", "/a", "Accept-Language", "fr")
+	assert.Equal(t, "call 3", w.Body.String())
+	assert.Equal(t, "fr", w.Header().Get("X-Lang"))
+
+	// Non-GETs, authorized requests, and responses with cookies aren't cached
+	assert.Equal(t, "call 4", doReq("POST", "/a").Body.String())
+	assert.Equal(t, "call 5", doReq("GET", "/a", "Authorization", "foo").Body.String())
+	assert.Equal(t, "call 6", doReq("GET", "/c?cookie=1").Body.String())
+	assert.Equal(t, "call 7", doReq("GET", "/c?cookie=1").Body.String())
+
+	// Cache-Control is ignored unless HonorCacheControl is set
+	assert.Equal(t, "call 8", doReq("GET", "/d?cc=no-store").Body.String())
+	assert.Equal(t, "call 8", doReq("GET", "/d?cc=no-store").Body.String())
+
+	p.Cache.HonorCacheControl = true
+	assert.Equal(t, "call 9", doReq("GET", "/e?cc=no-store").Body.String())
+	assert.Equal(t, "call 10", doReq("GET", "/e?cc=no-store").Body.String())
+	assert.Equal(t, "call 8", doReq("GET", "/d?cc=no-store").Body.String())
+	assert.Equal(t, "call 11", doReq("GET", "/d?cc=no-store", "Cache-Control", "no-cache").Body.String())
+
+	assert.Equal(t, "call 12", doReq("GET", "/f?cc=max-age=1").Body.String())
+	assert.Equal(t, "call 12", doReq("GET", "/f?cc=max-age=1").Body.String())
+	time.Sleep(1100 * time.Millisecond)
+	assert.Equal(t, "call 13", doReq("GET", "/f?cc=max-age=1").Body.String())
+
+	// Bypassed requests are neither served from nor stored in the cache
+	p.Cache.Bypass = func(r *http.Request) bool { return r.Header.Get("X-Bypass") != "" }
+	assert.Equal(t, "call 1", doReq("GET", "/a").Body.String())
+	assert.Equal(t, "call 14", doReq("GET", "/a", "X-Bypass", "1").Body.String())
+	assert.Equal(t, "call 15", doReq("GET", "/g", "X-Bypass", "1").Body.String())
+	assert.Equal(t, "call 16", doReq("GET", "/g").Body.String())
+}
+
+func TestResponseCacheTTL(t *T) {
+	rc := &ResponseCache{TTL: time.Minute, HonorCacheControl: true}
+	tests := []struct {
+		status int
+		hdrs   http.Header
+		ttl    time.Duration
+	}{
+		{200, http.Header{}, time.Minute},
+		{404, http.Header{}, 0},
+		{200, http.Header{"Cache-Control": {"private, max-age=60"}}, 0},
+		{200, http.Header{"Cache-Control": {"public, max-age=30"}}, 30 * time.Second},
+		{200, http.Header{"Cache-Control": {"max-age=30, s-maxage=10"}}, 10 * time.Second},
+		{200, http.Header{"Cache-Control": {"max-age=0"}}, 0},
+		{200, http.Header{"Vary": {"Accept-Encoding"}}, 0},
+		{200, http.Header{"Vary": {"*"}}, 0},
+	}
+	for _, test := range tests {
+		resp := &http.Response{StatusCode: test.status, Header: test.hdrs}
+		assert.Equal(t, test.ttl, rc.ttl(resp), "%#v", test)
+	}
+}
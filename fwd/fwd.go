@@ -11,15 +11,197 @@
 //	// "http://127.0.0.1:8080/rel/fuz/fiz"
 //	http.Handle("/fuz", fwd.Rel("http://127.0.0.1:8081", "/rel", nil))
 //
+// If more control over how requests are forwarded is needed a Proxy can be
+// used instead, which has the same methods but allows for setting various
+// options
+//
+//	p := fwd.NewProxy()
+//	p.FlushInterval = 100 * time.Millisecond
+//	http.Handle("/events", p.Abs("http://127.0.0.1:8081/events"))
 package fwd
 
 import (
+	"bytes"
+	"crypto/tls"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"path"
+	"sync"
+	"time"
 )
 
+// Proxy holds the options used when forwarding requests. A Proxy's fields
+// should not be changed once it has started forwarding requests
+type Proxy struct {
+
+	// ErrHandler can be set to handle any network or url parsing errors which
+	// may occur. Defaults to nil
+	ErrHandler func(*http.Request, error)
+
+	// ErrWriter can be set to write the response to the client when a request
+	// can't be forwarded, e.g. because the upstream couldn't be reached. It is
+	// called after ErrHandler. Defaults to nil, in which case a 413, 502, 503,
+	// or 504 is written, depending on the error
+	ErrWriter func(http.ResponseWriter, *http.Request, error)
+
+	// Transport is used to actually perform the forwarded requests. An
+	// *http.Transport can be created using NewTransport, which allows for
+	// configuring timeouts, connection pooling, and TLS. A RoundTripper is
+	// used rather than an *http.Client so that redirects from the upstream
+	// are passed back to the client instead of being followed. Defaults to
+	// NewTransport(nil)
+	Transport http.RoundTripper
+
+	// FlushInterval determines how often response data from the upstream is
+	// flushed to the client. When 0, data is flushed as soon as it is received
+	// from the upstream, which allows server-sent events and other streaming
+	// responses to work. When positive, data is flushed at most once per
+	// interval. When negative, data is never explicitly flushed and is left up
+	// to the http.ResponseWriter to buffer. Defaults to 0
+	FlushInterval time.Duration
+
+	// Retries is the number of times a GET or HEAD request will be retried if
+	// the upstream can't be reached or responds with a 502 or 503. Defaults
+	// to 0
+	Retries int
+
+	// RetryBackoff is how long to wait before the first retry. The wait is
+	// doubled for each subsequent retry. Defaults to 100 milliseconds
+	RetryBackoff time.Duration
+
+	// RetryMaxBodySize is the largest request body which will be buffered in
+	// memory so that its request can be retried. Requests with larger bodies
+	// are never retried. Defaults to 64KB
+	RetryMaxBodySize int64
+
+	// Breaker, if set, is used to stop forwarding requests to upstreams which
+	// are failing. While an upstream's breaker is open requests to it are
+	// immediately responded to with a 503. Any response with a 5xx status
+	// code counts as a failure. Defaults to nil
+	Breaker *Breaker
+
+	// RewriteRequest, if set, is called on each request after its URL has
+	// been set to the upstream's but before it is forwarded. It may modify
+	// the request however it likes, e.g. to add headers or change the path.
+	// Defaults to nil
+	RewriteRequest func(*http.Request)
+
+	// RewriteResponse, if set, is called on each response from an upstream
+	// before it is relayed to the client. It may modify the response however
+	// it likes, e.g. to strip headers or rewrite Location or Set-Cookie.
+	// Defaults to nil
+	RewriteResponse func(*http.Response)
+
+	// PreserveHost determines whether the Host header sent by the client is
+	// passed along to the upstream as-is. When false the Host header is set to
+	// the upstream's host instead, which is what most name-based virtual
+	// hosting upstreams will expect. In either case the original is available
+	// to the upstream in X-Forwarded-Host. Defaults to false
+	PreserveHost bool
+
+	// Cache, if set, is used to cache GET responses from upstreams, so that
+	// read-heavy endpoints don't need to hit the upstream for every request.
+	// Defaults to nil
+	Cache *ResponseCache
+
+	// MaxBodySize is the largest request body which will be forwarded to an
+	// upstream. Requests with larger bodies are responded to with a 413.
+	// Defaults to 0, meaning no limit
+	MaxBodySize int64
+
+	// BufferBody causes request bodies to be read entirely into memory before
+	// being forwarded, rather than being streamed to the upstream. This means
+	// an oversized body is always rejected before the upstream sees any of
+	// it, and that GET and HEAD requests may be retried regardless of
+	// RetryMaxBodySize. MaxBodySize should generally be set along with this.
+	// Defaults to false
+	BufferBody bool
+
+	// Observer, if set, is called once for every request the Proxy handles,
+	// after the response has been fully written. It can be used to collect
+	// metrics, see Metrics for a ready-made implementation. It is called
+	// synchronously, so it should not block. Defaults to nil
+	Observer func(Observation)
+}
+
+// NewProxy returns a Proxy with all of its fields initialized to their default
+// values. Any of the fields may be modified before the Proxy is used
+func NewProxy() *Proxy {
+	return &Proxy{
+		Transport:        NewTransport(nil),
+		RetryBackoff:     100 * time.Millisecond,
+		RetryMaxBodySize: 64 * 1024,
+	}
+}
+
+// TransportOpts are different options which may be passed into NewTransport.
+// They all have sane defaults which will cover most use cases
+type TransportOpts struct {
+
+	// How long to wait for a connection to an upstream to be established.
+	// Defaults to 10 seconds
+	DialTimeout time.Duration
+
+	// How long to wait for an upstream to send back response headers, once
+	// the request has been fully written. Defaults to 30 seconds
+	ResponseHeaderTimeout time.Duration
+
+	// The maximum number of idle connections which will be kept open to each
+	// upstream host. Defaults to 16
+	MaxIdleConnsPerHost int
+
+	// The maximum number of connections, idle or otherwise, which will be
+	// opened to each upstream host. Defaults to 0, meaning no limit
+	MaxConnsPerHost int
+
+	// How long an idle connection will be kept open before being closed.
+	// Defaults to 90 seconds
+	IdleConnTimeout time.Duration
+
+	// The TLS configuration to use when connecting to upstreams over https.
+	// Defaults to nil, meaning the default configuration is used
+	TLSClientConfig *tls.Config
+}
+
+// NewTransport returns an *http.Transport suitable for use as a Proxy's
+// Transport. The passed in TransportOpts may be used to modify its behavior,
+// or may be nil to just use the defaults
+func NewTransport(o *TransportOpts) *http.Transport {
+	if o == nil {
+		o = &TransportOpts{}
+	}
+	if o.DialTimeout == 0 {
+		o.DialTimeout = 10 * time.Second
+	}
+	if o.ResponseHeaderTimeout == 0 {
+		o.ResponseHeaderTimeout = 30 * time.Second
+	}
+	if o.MaxIdleConnsPerHost == 0 {
+		o.MaxIdleConnsPerHost = 16
+	}
+	if o.IdleConnTimeout == 0 {
+		o.IdleConnTimeout = 90 * time.Second
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   o.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ResponseHeaderTimeout: o.ResponseHeaderTimeout,
+		MaxIdleConnsPerHost:   o.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       o.MaxConnsPerHost,
+		IdleConnTimeout:       o.IdleConnTimeout,
+		TLSClientConfig:       o.TLSClientConfig,
+		TLSHandshakeTimeout:   o.DialTimeout,
+	}
+}
+
 // Abs returns an http.Handler which receives any incoming requests and
 // re-performs them exactly as-is, except on the given URL instead.
 //
@@ -27,14 +209,9 @@ import (
 //
 // This function panics if absURL cannot be parsed by url.Parse
 func Abs(absURL string, errHandler func(*http.Request, error)) http.Handler {
-	parsedURL, err := url.Parse(absURL)
-	if err != nil {
-		panic(err)
-	}
-
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		doProxy(parsedURL, w, r, errHandler)
-	})
+	p := NewProxy()
+	p.ErrHandler = errHandler
+	return p.Abs(absURL)
 }
 
 // Rel returns an http.Handler which receives any incoming requests and
@@ -50,36 +227,335 @@ func Abs(absURL string, errHandler func(*http.Request, error)) http.Handler {
 func Rel(
 	addr, relPath string, errHandler func(*http.Request, error),
 ) http.Handler {
+	p := NewProxy()
+	p.ErrHandler = errHandler
+	return p.Rel(addr, relPath)
+}
+
+// Abs is the same as the package-level Abs function, but uses the options set
+// on the Proxy
+func (p *Proxy) Abs(absURL string) http.Handler {
+	parsedURL, err := url.Parse(absURL)
+	if err != nil {
+		panic(err)
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		absURL := addr + path.Join(relPath, r.URL.Path)
-		parsedURL, err := url.Parse(absURL)
-		if err != nil {
-			errHandler(r, err)
-		}
-		parsedURL.RawQuery = r.URL.RawQuery
+		p.doProxy(parsedURL, w, r)
+	})
+}
 
-		doProxy(parsedURL, w, r, errHandler)
+// Rel is the same as the package-level Rel function, but uses the options set
+// on the Proxy
+func (p *Proxy) Rel(addr, relPath string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.doProxyPath(addr, path.Join(relPath, r.URL.Path), w, r)
 	})
 }
 
-func doProxy(
-	u *url.URL, w http.ResponseWriter, r *http.Request,
-	errHandler func(*http.Request, error),
-) {
+func (p *Proxy) transport() http.RoundTripper {
+	if p.Transport == nil {
+		return http.DefaultTransport
+	}
+	return p.Transport
+}
+
+func (p *Proxy) handleErr(r *http.Request, err error) {
+	if p.ErrHandler != nil {
+		p.ErrHandler(r, err)
+	}
+}
+
+func (p *Proxy) doProxy(u *url.URL, w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	obs := Observation{Method: r.Method}
+	if p.Observer != nil {
+		defer func() {
+			obs.Duration = time.Since(start)
+			p.Observer(obs)
+		}()
+	}
+
+	removeHopHeaders(r.Header)
+	setForwardedHeaders(r)
+
 	r.URL = u
-	resp, err := http.DefaultClient.Do(r)
+	// RequestURI is set on requests received by a server, but isn't allowed to
+	// be set on client requests
+	r.RequestURI = ""
+	if !p.PreserveHost {
+		r.Host = u.Host
+	}
+	if p.RewriteRequest != nil {
+		p.RewriteRequest(r)
+	}
+	obs.Upstream = r.URL.Host
+
+	body, lr, err := p.limitBody(r)
 	if err != nil {
-		if errHandler != nil {
-			errHandler(r, err)
+		obs.Err = err
+		p.writeErr(w, r, err)
+		return
+	}
+
+	var cacheKey string
+	if p.Cache != nil {
+		cacheKey = p.Cache.key(r)
+	}
+	if cacheKey != "" && p.Cache.lookupAllowed(r) {
+		resp, err := p.Cache.get(cacheKey, r)
+		if err != nil {
+			p.handleErr(r, err)
+		} else if resp != nil {
+			defer resp.Body.Close()
+			obs.StatusCode, obs.Cached = resp.StatusCode, true
+			p.writeResponse(w, r, resp)
+			return
+		}
+	}
+
+	upstream := r.URL.Host
+	if p.Breaker != nil && !p.Breaker.Allow(upstream) {
+		obs.Err = ErrBreakerOpen
+		p.writeErr(w, r, ErrBreakerOpen)
+		return
+	}
+
+	resp, err := p.roundTrip(r, body)
+	tooLarge := lr != nil && lr.exceeded
+	if p.Breaker != nil {
+		// A body being too large is the client's fault, not the upstream's
+		p.Breaker.Record(
+			upstream, tooLarge || (err == nil && resp.StatusCode < 500),
+		)
+	}
+	if tooLarge {
+		if resp != nil {
+			resp.Body.Close()
 		}
-		http.Error(w, "unexpected server-side error", 500)
+		err = ErrBodyTooLarge
+	}
+	if err != nil {
+		obs.Err = err
+		p.writeErr(w, r, err)
+		return
 	}
 	defer resp.Body.Close()
+	removeHopHeaders(resp.Header)
+	obs.StatusCode = resp.StatusCode
+
+	if cacheKey != "" {
+		if err := p.Cache.set(cacheKey, resp); err != nil {
+			p.handleErr(r, err)
+		}
+	}
+
+	p.writeResponse(w, r, resp)
+}
+
+// writeResponse relays the given response from an upstream to the client
+func (p *Proxy) writeResponse(
+	w http.ResponseWriter, r *http.Request, resp *http.Response,
+) {
+	if p.RewriteResponse != nil {
+		p.RewriteResponse(resp)
+	}
 
 	for header, vals := range resp.Header {
 		w.Header()[header] = append(w.Header()[header], vals...)
 	}
 
 	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+
+	// At this point the response has already been started, so there's nothing
+	// to do with an error except report it
+	if err := p.copyResponse(w, resp.Body); err != nil {
+		p.handleErr(r, err)
+	}
+}
+
+// writeErr handles an error which prevented a request from being forwarded,
+// and writes an appropriate response to the client
+func (p *Proxy) writeErr(w http.ResponseWriter, r *http.Request, err error) {
+	p.handleErr(r, err)
+	if p.ErrWriter != nil {
+		p.ErrWriter(w, r, err)
+		return
+	}
+
+	if err == ErrBreakerOpen {
+		http.Error(w, "upstream unavailable", 503)
+	} else if err == ErrBodyTooLarge {
+		http.Error(w, "request body too large", 413)
+	} else if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		http.Error(w, "upstream timed out", 504)
+	} else {
+		http.Error(w, "bad gateway", 502)
+	}
+}
+
+// roundTrip performs the given request using the Proxy's Transport, retrying
+// it according to Retries if it's idempotent. If the request's body has already
+// been buffered it should be passed in
+func (p *Proxy) roundTrip(r *http.Request, body []byte) (*http.Response, error) {
+	var retries int
+	if r.Method == "GET" || r.Method == "HEAD" {
+		retries = p.Retries
+	}
+
+	if body == nil && retries > 0 && r.Body != nil && r.Body != http.NoBody {
+		var err error
+		if body, err = bufferBody(r, p.RetryMaxBodySize); err != nil {
+			return nil, err
+		} else if body == nil {
+			retries = 0
+		}
+	}
+
+	backoff := p.RetryBackoff
+	for i := 0; ; i++ {
+		if body != nil {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		resp, err := p.transport().RoundTrip(r)
+		if i >= retries || !shouldRetry(resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		}
+		backoff *= 2
+	}
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == 502 || resp.StatusCode == 503
+}
+
+// bufferBody attempts to read the given request's body into memory, as long as
+// it's no larger than max. If it's larger nil is returned, and the request's
+// body is left so that it can still be read in its entirety
+func bufferBody(r *http.Request, max int64) ([]byte, error) {
+	buf, body, err := bufferReadCloser(r.Body, max)
+	r.Body = body
+	return buf, err
+}
+
+// bufferReadCloser attempts to read the given ReadCloser into memory, as long
+// as it's no larger than max. If it's larger nil is returned. In either case
+// the returned ReadCloser should be used in place of the given one, and will
+// still read all of the original data
+func bufferReadCloser(
+	rc io.ReadCloser, max int64,
+) ([]byte, io.ReadCloser, error) {
+	buf, err := ioutil.ReadAll(io.LimitReader(rc, max+1))
+	if err != nil {
+		return nil, rc, err
+	}
+
+	if int64(len(buf)) > max {
+		return nil, struct {
+			io.Reader
+			io.Closer
+		}{
+			io.MultiReader(bytes.NewReader(buf), rc),
+			rc,
+		}, nil
+	}
+
+	return buf, struct {
+		io.Reader
+		io.Closer
+	}{
+		bytes.NewReader(buf),
+		rc,
+	}, nil
+}
+
+// copyResponse copies the body of the upstream's response to the client,
+// flushing it according to FlushInterval
+func (p *Proxy) copyResponse(w http.ResponseWriter, body io.Reader) error {
+	f, ok := w.(http.Flusher)
+	if !ok || p.FlushInterval < 0 {
+		_, err := io.Copy(w, body)
+		return err
+	}
+
+	// Flush the headers right away, so clients of streaming endpoints know the
+	// request was successful even if the first bit of data takes a while
+	f.Flush()
+
+	fw := &flushWriter{w: w, f: f, interval: p.FlushInterval}
+	defer fw.stop()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, rerr := body.Read(buf)
+		if n > 0 {
+			if _, werr := fw.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if rerr == io.EOF {
+			return nil
+		} else if rerr != nil {
+			return rerr
+		}
+	}
+}
+
+// flushWriter wraps an http.ResponseWriter, flushing it either after every
+// write (if interval is 0) or at most once every interval
+type flushWriter struct {
+	w        io.Writer
+	f        http.Flusher
+	interval time.Duration
+
+	l       sync.Mutex
+	t       *time.Timer
+	stopped bool
+}
+
+func (fw *flushWriter) Write(b []byte) (int, error) {
+	fw.l.Lock()
+	defer fw.l.Unlock()
+
+	n, err := fw.w.Write(b)
+	if fw.interval == 0 {
+		fw.f.Flush()
+	} else if fw.t == nil {
+		fw.t = time.AfterFunc(fw.interval, fw.delayedFlush)
+	}
+	return n, err
+}
+
+func (fw *flushWriter) delayedFlush() {
+	fw.l.Lock()
+	defer fw.l.Unlock()
+	if !fw.stopped {
+		fw.f.Flush()
+	}
+	fw.t = nil
+}
+
+// stop must be called once writing is done. It performs a final flush and
+// makes sure no more flushes will happen
+func (fw *flushWriter) stop() {
+	fw.l.Lock()
+	defer fw.l.Unlock()
+	fw.stopped = true
+	if fw.t != nil {
+		fw.t.Stop()
+	}
+	fw.f.Flush()
 }
@@ -1,14 +1,19 @@
 package fwd
 
 import (
+	"bufio"
 	"bytes"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	. "testing"
+	"time"
 
+	"github.com/mediocregopher/mediocre-api/common"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var testHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -94,3 +99,282 @@ func TestRel(t *T) {
 	assert.Equal(t, []string{"bar", "foo"}, w.HeaderMap["X-Whatever"])
 	assert.Equal(t, "OHAI", w.Body.String())
 }
+
+func TestStreaming(t *T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: one\n\n")
+			w.(http.Flusher).Flush()
+			<-release
+			io.WriteString(w, "data: two\n\n")
+		},
+	))
+	defer upstream.Close()
+
+	for _, interval := range []time.Duration{0, 10 * time.Millisecond} {
+		p := NewProxy()
+		p.ErrHandler = testErrHandler
+		p.FlushInterval = interval
+		proxy := httptest.NewServer(p.Abs(upstream.URL))
+
+		resp, err := http.Get(proxy.URL)
+		require.Nil(t, err)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		// The first event should make it through even though the upstream
+		// hasn't finished its response yet
+		rd := bufio.NewReader(resp.Body)
+		line, err := rd.ReadString('\n')
+		require.Nil(t, err)
+		assert.Equal(t, "data: one\n", line)
+
+		release <- struct{}{}
+		rest, err := ioutil.ReadAll(rd)
+		require.Nil(t, err)
+		assert.Equal(t, "\ndata: two\n\n", string(rest))
+
+		resp.Body.Close()
+		proxy.Close()
+	}
+}
+
+func TestNoRedirect(t *T) {
+	upstream := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/elsewhere", 302)
+		},
+	))
+	defer upstream.Close()
+
+	var errs []error
+	p := NewProxy()
+	p.ErrHandler = func(r *http.Request, err error) {
+		errs = append(errs, err)
+	}
+	p.Transport = NewTransport(&TransportOpts{
+		DialTimeout: time.Second,
+	})
+	handler := p.Rel(upstream.URL, "/")
+
+	// Redirects should be passed back, not followed
+	req, err := http.NewRequest("GET", "http://example.com/foo", nil)
+	require.Nil(t, err)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, 302, w.Code)
+	assert.Equal(t, "/elsewhere", w.Header().Get("Location"))
+	assert.Empty(t, errs)
+}
+
+func TestRetries(t *T) {
+	var calls int
+	upstream := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls%3 != 0 {
+				w.WriteHeader(503)
+				return
+			}
+			io.Copy(w, r.Body)
+		},
+	))
+	defer upstream.Close()
+
+	p := NewProxy()
+	p.ErrHandler = testErrHandler
+	p.RetryBackoff = time.Millisecond
+	handler := p.Abs(upstream.URL)
+
+	doReq := func(method string) *httptest.ResponseRecorder {
+		body := bytes.NewBufferString("OHAI")
+		req, err := http.NewRequest(method, "http://example.com/", body)
+		require.Nil(t, err)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// Not enough retries
+	calls = 0
+	p.Retries = 1
+	assert.Equal(t, 503, doReq("GET").Code)
+	assert.Equal(t, 2, calls)
+
+	// Enough retries, and the body makes it through each time
+	calls = 0
+	p.Retries = 2
+	w := doReq("GET")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "OHAI", w.Body.String())
+	assert.Equal(t, 3, calls)
+
+	// Non-idempotent requests aren't retried
+	calls = 0
+	assert.Equal(t, 503, doReq("POST").Code)
+	assert.Equal(t, 1, calls)
+
+	// Requests with bodies which are too large aren't retried, but the whole
+	// body still makes it through
+	calls = 2
+	p.RetryMaxBodySize = 2
+	w = doReq("GET")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "OHAI", w.Body.String())
+	assert.Equal(t, 3, calls)
+	calls = 0
+	assert.Equal(t, 503, doReq("GET").Code)
+	assert.Equal(t, 1, calls)
+}
+
+func TestRewrite(t *T) {
+	p := NewProxy()
+	p.ErrHandler = testErrHandler
+	p.RewriteRequest = func(r *http.Request) {
+		r.URL.Path = "/rewritten"
+		r.URL.RawQuery = "a=b"
+	}
+	p.RewriteResponse = func(resp *http.Response) {
+		resp.Header.Del("X-Method")
+		resp.Header.Set("X-Whatever", "baz")
+	}
+	handler := p.Abs(testURL.String())
+
+	req, err := http.NewRequest("GET", "http://example.com/", nil)
+	require.Nil(t, err)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, "/rewritten?a=b", w.Header().Get("X-Path"))
+	assert.Empty(t, w.Header().Get("X-Method"))
+	assert.Equal(t, []string{"baz"}, w.Header()["X-Whatever"])
+}
+
+func TestProxyHeaders(t *T) {
+	var upstreamReq *http.Request
+	upstream := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			upstreamReq = r
+			w.Header().Set("Connection", "X-Conn-Resp")
+			w.Header().Set("X-Conn-Resp", "foo")
+			w.Header().Set("Keep-Alive", "timeout=5")
+			w.Header().Set("X-Whatever", "foo")
+		},
+	))
+	defer upstream.Close()
+
+	handler := Abs(upstream.URL, testErrHandler)
+
+	req, err := http.NewRequest("GET", "http://example.com/", nil)
+	require.Nil(t, err)
+	req.RemoteAddr = "1.2.3.4:5678"
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+	req.Header.Set("Connection", "X-Conn-Req")
+	req.Header.Set("X-Conn-Req", "foo")
+	req.Header.Set("Proxy-Authorization", "secret")
+	req.Header.Set("X-Other", "bar")
+	req = common.WithRequestID(req, "abc")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	h := upstreamReq.Header
+	assert.Equal(t, "10.0.0.1, 1.2.3.4", h.Get("X-Forwarded-For"))
+	assert.Equal(t, "http", h.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "example.com", h.Get("X-Forwarded-Host"))
+	assert.Empty(t, h.Get("X-Conn-Req"))
+	assert.Empty(t, h.Get("Proxy-Authorization"))
+	assert.Equal(t, "bar", h.Get("X-Other"))
+	assert.Equal(t, "abc", h.Get(common.RequestIDHeader))
+
+	assert.Empty(t, w.Header().Get("Connection"))
+	assert.Empty(t, w.Header().Get("X-Conn-Resp"))
+	assert.Empty(t, w.Header().Get("Keep-Alive"))
+	assert.Equal(t, "foo", w.Header().Get("X-Whatever"))
+}
+
+func TestHost(t *T) {
+	var host string
+	upstream := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			host = r.Host
+		},
+	))
+	defer upstream.Close()
+	u, err := url.Parse(upstream.URL)
+	require.Nil(t, err)
+
+	p := NewProxy()
+	p.ErrHandler = testErrHandler
+	handler := p.Abs(upstream.URL)
+
+	doReq := func() {
+		req, err := http.NewRequest("GET", "http://example.com/", nil)
+		require.Nil(t, err)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	doReq()
+	assert.Equal(t, u.Host, host)
+
+	p.PreserveHost = true
+	doReq()
+	assert.Equal(t, "example.com", host)
+}
+
+func TestUpstreamErrors(t *T) {
+	// Grab an address which nothing is listening on
+	down := httptest.NewServer(testHandler)
+	downURL := down.URL
+	down.Close()
+
+	slow := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+		},
+	))
+	defer slow.Close()
+
+	var errs []error
+	p := NewProxy()
+	p.ErrHandler = func(r *http.Request, err error) {
+		errs = append(errs, err)
+	}
+	p.Transport = NewTransport(&TransportOpts{
+		ResponseHeaderTimeout: 10 * time.Millisecond,
+	})
+
+	doReq := func(h http.Handler) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "http://example.com/", nil)
+		require.Nil(t, err)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := doReq(p.Abs(downURL))
+	assert.Equal(t, 502, w.Code)
+	assert.Len(t, errs, 1)
+
+	errs = nil
+	w = doReq(p.Rel(slow.URL, "/"))
+	assert.Equal(t, 504, w.Code)
+	assert.Len(t, errs, 1)
+
+	// Rel with an address which makes for an invalid url
+	errs = nil
+	w = doReq(p.Rel("http://%zz", "/"))
+	assert.Equal(t, 500, w.Code)
+	assert.Len(t, errs, 1)
+
+	// A custom ErrWriter is used if given
+	errs = nil
+	p.ErrWriter = func(w http.ResponseWriter, r *http.Request, err error) {
+		w.WriteHeader(599)
+		w.Write([]byte(err.Error()))
+	}
+	w = doReq(p.Abs(downURL))
+	assert.Equal(t, 599, w.Code)
+	require.Len(t, errs, 1)
+	assert.Equal(t, errs[0].Error(), w.Body.String())
+}
@@ -0,0 +1,66 @@
+package fwd
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/mediocregopher/mediocre-api/common"
+)
+
+// hopHeaders are headers which only apply to a single connection, and so must
+// not be passed along by a proxy. See RFC 7230 section 6.1
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// removeHopHeaders removes all hop-by-hop headers from the given header,
+// including any which are listed in its Connection header
+func removeHopHeaders(h http.Header) {
+	for _, v := range h["Connection"] {
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				h.Del(f)
+			}
+		}
+	}
+	for _, hh := range hopHeaders {
+		h.Del(hh)
+	}
+}
+
+// setForwardedHeaders sets the X-Forwarded-For, X-Forwarded-Proto, and
+// X-Forwarded-Host headers on the request's header, based on the request as it
+// was originally received. The client's ip is appended to any existing
+// X-Forwarded-For. If the request has a request ID (see common.RequestID) it's
+// set in the common.RequestIDHeader, so the upstream can log it as well
+func setForwardedHeaders(r *http.Request) {
+	if id := common.RequestID(r); id != "" {
+		r.Header.Set(common.RequestIDHeader, id)
+	}
+
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if prior := r.Header["X-Forwarded-For"]; len(prior) > 0 {
+			ip = strings.Join(prior, ", ") + ", " + ip
+		}
+		r.Header.Set("X-Forwarded-For", ip)
+	}
+
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+	r.Header.Set("X-Forwarded-Proto", proto)
+
+	if r.Host != "" {
+		r.Header.Set("X-Forwarded-Host", r.Host)
+	}
+}
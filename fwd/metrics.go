@@ -0,0 +1,181 @@
+package fwd
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common"
+)
+
+// Observation describes a single request handled by a Proxy, and is passed to
+// the Proxy's Observer
+type Observation struct {
+
+	// The host of the upstream the request was meant for
+	Upstream string
+
+	// The request's method
+	Method string
+
+	// The status code of the upstream's response, or 0 if there wasn't one.
+	// This will be set even if the response came from the Cache
+	StatusCode int
+
+	// How long it took to handle the request, including writing the response
+	Duration time.Duration
+
+	// Set if the request couldn't be forwarded, e.g. ErrBreakerOpen or a
+	// network error
+	Err error
+
+	// Whether the response was served from the Proxy's Cache
+	Cached bool
+}
+
+// DefaultBuckets are the latency buckets used by Metrics if none are given
+var DefaultBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// UpstreamMetrics are the metrics collected by Metrics for a single upstream
+type UpstreamMetrics struct {
+
+	// Total number of requests made to the upstream, including ones which
+	// errored or were served from the cache
+	Requests int64
+
+	// Number of requests which couldn't be forwarded to the upstream
+	Errors int64
+
+	// Number of requests which were served from the cache
+	Cached int64
+
+	// Number of responses with each status code
+	StatusCodes map[int]int64
+
+	// LatencyBuckets[i] is the number of requests which took at most
+	// Buckets[i], where Buckets are the ones the Metrics was created with. As
+	// with prometheus histograms these counts are cumulative, and Requests
+	// acts as the final, infinite, bucket
+	LatencyBuckets []int64
+
+	// The sum of the durations of all requests
+	LatencySum time.Duration
+}
+
+// Metrics collects per-upstream request counts, status codes, and latency
+// histograms from a Proxy. Its Observe method should be set as the Proxy's
+// Observer. It is safe to use from multiple go-routines, and a single Metrics
+// may be shared between multiple Proxys
+type Metrics struct {
+	buckets []time.Duration
+
+	l sync.Mutex
+	m map[string]*UpstreamMetrics
+}
+
+// NewMetrics returns a Metrics which will use the given latency buckets, which
+// must be in ascending order. If none are given DefaultBuckets is used
+func NewMetrics(buckets ...time.Duration) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	return &Metrics{
+		buckets: buckets,
+		m:       map[string]*UpstreamMetrics{},
+	}
+}
+
+// Buckets returns the latency buckets the Metrics is using
+func (m *Metrics) Buckets() []time.Duration {
+	return m.buckets
+}
+
+// Observe records the given Observation
+func (m *Metrics) Observe(o Observation) {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	um, ok := m.m[o.Upstream]
+	if !ok {
+		um = &UpstreamMetrics{
+			StatusCodes:    map[int]int64{},
+			LatencyBuckets: make([]int64, len(m.buckets)),
+		}
+		m.m[o.Upstream] = um
+	}
+
+	um.Requests++
+	if o.Err != nil {
+		um.Errors++
+	}
+	if o.Cached {
+		um.Cached++
+	}
+	if o.StatusCode != 0 {
+		um.StatusCodes[o.StatusCode]++
+	}
+	for i, b := range m.buckets {
+		if o.Duration <= b {
+			um.LatencyBuckets[i]++
+		}
+	}
+	um.LatencySum += o.Duration
+}
+
+// Snapshot returns a copy of the metrics collected so far, keyed by upstream
+func (m *Metrics) Snapshot() map[string]UpstreamMetrics {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	snap := make(map[string]UpstreamMetrics, len(m.m))
+	for upstream, um := range m.m {
+		cp := *um
+		cp.StatusCodes = make(map[int]int64, len(um.StatusCodes))
+		for code, n := range um.StatusCodes {
+			cp.StatusCodes[code] = n
+		}
+		cp.LatencyBuckets = append([]int64(nil), um.LatencyBuckets...)
+		snap[upstream] = cp
+	}
+	return snap
+}
+
+// WriteHistogram writes the latency histograms of all upstreams in the
+// prometheus text exposition format (see common.WritePromHistogram), as the
+// histogram with the given name. Each upstream's series has the given label set
+// to its key, so the key may be something other than an upstream's host if the
+// Observations given to Observe are
+func (m *Metrics) WriteHistogram(w io.Writer, name, help, label string) {
+	snap := m.Snapshot()
+	keys := make([]string, 0, len(snap))
+	for k := range snap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	hs := make([]common.PromHistogram, len(keys))
+	for i, k := range keys {
+		um := snap[k]
+		hs[i] = common.PromHistogram{
+			Labels:  common.PromLabels(label, k),
+			Buckets: m.buckets,
+			Counts:  um.LatencyBuckets,
+			Count:   um.Requests,
+			Sum:     um.LatencySum,
+		}
+	}
+	common.WritePromHistogram(w, name, help, hs)
+}
@@ -0,0 +1,68 @@
+package fwd
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *T) {
+	upstream := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/slow" {
+				time.Sleep(20 * time.Millisecond)
+			} else if r.URL.Path == "/missing" {
+				w.WriteHeader(404)
+			}
+		},
+	))
+	defer upstream.Close()
+	u, err := url.Parse(upstream.URL)
+	require.Nil(t, err)
+
+	down := httptest.NewServer(testHandler)
+	downURL, err := url.Parse(down.URL)
+	require.Nil(t, err)
+	down.Close()
+
+	m := NewMetrics(10*time.Millisecond, time.Second)
+	p := NewProxy()
+	p.Observer = m.Observe
+
+	doReq := func(h http.Handler, path string) {
+		req, err := http.NewRequest("GET", "http://example.com"+path, nil)
+		require.Nil(t, err)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	doReq(p.Rel(upstream.URL, "/"), "/")
+	doReq(p.Rel(upstream.URL, "/"), "/slow")
+	doReq(p.Rel(upstream.URL, "/"), "/missing")
+	doReq(p.Abs(down.URL), "/")
+
+	snap := m.Snapshot()
+	um := snap[u.Host]
+	assert.Equal(t, int64(3), um.Requests)
+	assert.Equal(t, int64(0), um.Errors)
+	assert.Equal(t, map[int]int64{200: 2, 404: 1}, um.StatusCodes)
+	assert.Equal(t, []int64{2, 3}, um.LatencyBuckets)
+	assert.True(t, um.LatencySum >= 20*time.Millisecond)
+
+	um = snap[downURL.Host]
+	assert.Equal(t, int64(1), um.Requests)
+	assert.Equal(t, int64(1), um.Errors)
+	assert.Empty(t, um.StatusCodes)
+
+	buf := new(bytes.Buffer)
+	m.WriteHistogram(buf, "fwd_seconds", "Foo", "upstream")
+	body := buf.String()
+	assert.Contains(t, body, "# TYPE fwd_seconds histogram\n")
+	assert.Contains(t, body, `fwd_seconds_bucket{upstream="`+u.Host+`",le="0.01"} 2`+"\n")
+	assert.Contains(t, body, `fwd_seconds_count{upstream="`+u.Host+`"} 3`+"\n")
+}
@@ -0,0 +1,99 @@
+package fwd
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// PathRule describes a rewrite of an incoming request's path onto a path on an
+// upstream. Any match of Pattern in the path is replaced with Replace, which
+// may refer to capture groups in Pattern using $1, ${name}, etc... as
+// described by regexp's Expand method
+type PathRule struct {
+	Pattern *regexp.Regexp
+	Replace string
+}
+
+// RegexRule returns a PathRule for the given pattern and replacement. It
+// panics if the pattern cannot be compiled
+//
+//	// Rewrites "/users/bob/posts" to "/posts/bob"
+//	fwd.RegexRule(`^/users/([^/]+)/posts$`, "/posts/$1")
+func RegexRule(pattern, replace string) PathRule {
+	return PathRule{
+		Pattern: regexp.MustCompile(pattern),
+		Replace: replace,
+	}
+}
+
+// StripPrefix returns a PathRule which removes the given prefix from the
+// beginning of a path. The prefix will only match whole path segments, so
+// StripPrefix("/api") will match "/api" and "/api/foo" but not "/apifoo"
+func StripPrefix(prefix string) PathRule {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return PathRule{
+		Pattern: regexp.MustCompile("^" + regexp.QuoteMeta(prefix) + "(/|$)"),
+		Replace: "/",
+	}
+}
+
+// Rewrite returns an http.Handler which receives any incoming requests and
+// re-performs them exactly as-is, except with their path rewritten according
+// to the given rules and rebased onto the given address. The first rule whose
+// Pattern matches the path is used, if none match the path is left as-is.
+//
+// For example, the handler returned by
+//
+//	Rewrite("http://foo.com", nil, StripPrefix("/public"))
+//
+// will receive a request for "http://bar.com/public/baz" and re-perform it on
+// "http://foo.com/baz"
+//
+// errHandler can be passed in to handle any network or url parsing errors which
+// may occur.
+func Rewrite(
+	addr string, errHandler func(*http.Request, error), rules ...PathRule,
+) http.Handler {
+	p := NewProxy()
+	p.ErrHandler = errHandler
+	return p.Rewrite(addr, rules...)
+}
+
+// Rewrite is the same as the package-level Rewrite function, but uses the
+// options set on the Proxy
+func (p *Proxy) Rewrite(addr string, rules ...PathRule) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.doProxyPath(addr, rewritePath(r.URL.Path, rules), w, r)
+	})
+}
+
+func rewritePath(path string, rules []PathRule) string {
+	for _, rule := range rules {
+		if rule.Pattern.MatchString(path) {
+			path = rule.Pattern.ReplaceAllString(path, rule.Replace)
+			break
+		}
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// doProxyPath forwards the request to the given path on the given address,
+// keeping the request's original query string
+func (p *Proxy) doProxyPath(
+	addr, path string, w http.ResponseWriter, r *http.Request,
+) {
+	parsedURL, err := url.Parse(addr + path)
+	if err != nil {
+		p.handleErr(r, err)
+		http.Error(w, "unexpected server-side error", 500)
+		return
+	}
+	parsedURL.RawQuery = r.URL.RawQuery
+
+	p.doProxy(parsedURL, w, r)
+}
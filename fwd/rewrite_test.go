@@ -0,0 +1,45 @@
+package fwd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewritePath(t *T) {
+	rules := []PathRule{
+		RegexRule(`^/users/(?P<user>[^/]+)/posts$`, "/posts/${user}"),
+		StripPrefix("/api/"),
+		StripPrefix("/"),
+	}
+
+	tests := map[string]string{
+		"/users/bob/posts":  "/posts/bob",
+		"/users/bob/other":  "/users/bob/other",
+		"/api/foo/bar":      "/foo/bar",
+		"/api":              "/",
+		"/apifoo":           "/apifoo",
+		"/":                 "/",
+		"/users/bob/posts/": "/users/bob/posts/",
+	}
+	for in, out := range tests {
+		assert.Equal(t, out, rewritePath(in, rules), "in: %q", in)
+	}
+}
+
+func TestRewriteHandler(t *T) {
+	endpoint := testURL.Scheme + "://" + testURL.Host
+	handler := Rewrite(
+		endpoint, testErrHandler,
+		RegexRule(`^/v1/(.*)$`, "/internal/$1"),
+	)
+
+	req, err := http.NewRequest("GET", "http://example.com/v1/foo?a=b", nil)
+	require.Nil(t, err)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, "/internal/foo?a=b", w.Header().Get("X-Path"))
+}
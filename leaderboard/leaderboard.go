@@ -0,0 +1,320 @@
+// Package leaderboard implements leaderboards backed by redis sorted sets.
+// Users' scores on a board are incremented, and the board can be read for its
+// top users or a user's rank and neighbors, both over all time and within
+// daily, weekly, or monthly windows which roll over on their own
+package leaderboard
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/radix.v2/redis"
+	"github.com/mediocregopher/radix.v2/util"
+)
+
+// Errors which may be expected from various methods in this package
+var (
+	ErrNotFound      = common.ExpectedErr{Code: 404, ID: "score_not_found", Err: "user has no score on this board"}
+	ErrUnknownPeriod = common.ExpectedErr{Code: 404, ID: "unknown_period", Err: "unknown period"}
+)
+
+// Period describes the window of time a board's scores are kept for
+type Period int
+
+// All possible Periods. Daily, Weekly, and Monthly boards start over at the
+// beginning of each day, ISO week (starting Monday), and month respectively, in
+// the System's Location
+const (
+	AllTime Period = iota
+	Daily
+	Weekly
+	Monthly
+)
+
+var periodNames = []string{"all", "daily", "weekly", "monthly"}
+
+// String returns the name of the Period, as used in keys and accepted by
+// ParsePeriod
+func (p Period) String() string {
+	if p < 0 || int(p) >= len(periodNames) {
+		return "Period(" + strconv.Itoa(int(p)) + ")"
+	}
+	return periodNames[p]
+}
+
+// ParsePeriod returns the Period with the given name ("all", "daily",
+// "weekly", or "monthly"), or ErrUnknownPeriod
+func ParsePeriod(name string) (Period, error) {
+	for i, pn := range periodNames {
+		if pn == name {
+			return Period(i), nil
+		}
+	}
+	return 0, ErrUnknownPeriod
+}
+
+// start returns the beginning of the window of this Period which contains t.
+// It must not be called on AllTime
+func (p Period) start(t time.Time) time.Time {
+	y, m, d := t.Date()
+	switch p {
+	case Weekly:
+		// Go's weeks start on Sunday, ISO weeks on Monday
+		d -= (int(t.Weekday()) + 6) % 7
+	case Monthly:
+		d = 1
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// add returns the beginning of the window n windows of this Period after the
+// one starting at the given time
+func (p Period) add(start time.Time, n int) time.Time {
+	switch p {
+	case Daily:
+		return start.AddDate(0, 0, n)
+	case Weekly:
+		return start.AddDate(0, 0, 7*n)
+	}
+	return start.AddDate(0, n, 0)
+}
+
+// window returns the identifier of the window of this Period which contains t,
+// e.g. "2006-01-02" for Daily
+func (p Period) window(t time.Time) string {
+	switch p {
+	case AllTime:
+		return ""
+	case Daily:
+		return t.Format("2006-01-02")
+	case Weekly:
+		y, w := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", y, w)
+	}
+	return t.Format("2006-01")
+}
+
+// Entry is a single user's place on a board
+type Entry struct {
+	User  string
+	Score float64
+
+	// Starting from 1 for the user with the highest score. Users with the same
+	// score are ordered by name, reverse lexicographically
+	Rank int64
+}
+
+// System holds on to a Cmder and uses it to implement a leaderboard system
+type System struct {
+	c common.Cmder
+	o *Opts
+}
+
+// Opts are different options which may be passed into New when creating a
+// system. They all have sane defaults which will cover most use cases
+type Opts struct {
+
+	// Prefix can be used if you wish to have two separate leaderboard systems
+	// being persisted on the same Cmder. Prefix will be part of a string
+	// prepended to all key names
+	Prefix string
+
+	// Periods are the Periods Incr updates boards for. Boards for other
+	// Periods can still be read, but will always be empty. Defaults to all of
+	// them
+	Periods []Period
+
+	// How many windows before the current one of each Period are kept after
+	// they've ended, so that e.g. yesterday's Daily board can still be read.
+	// Older ones are expired by redis. Defaults to 1
+	Retain int
+
+	// The Location which decides when days, weeks, and months begin. Defaults
+	// to UTC
+	Location *time.Location
+}
+
+// New returns a new System which will use the given Cmder as its persistence
+// layer. The passed in Opts may be used to modify behavior of the System, or
+// may be nil to just use the defaults
+func New(c common.Cmder, o *Opts) *System {
+	if o == nil {
+		o = &Opts{}
+	}
+	if o.Periods == nil {
+		o.Periods = []Period{AllTime, Daily, Weekly, Monthly}
+	}
+	if o.Retain < 1 {
+		o.Retain = 1
+	}
+	if o.Location == nil {
+		o.Location = time.UTC
+	}
+	return &System{c: c, o: o}
+}
+
+// Key returns a key which can be used to interact with some arbitrary board
+// data directly in redis. This is useful if more complicated, lower level
+// operations are needed to be done
+func (s *System) Key(board string, extra ...string) string {
+	k := "leaderboard:" + s.o.Prefix + ":{" + board + "}"
+	if len(extra) > 0 {
+		k += ":" + strings.Join(extra, ":")
+	}
+	return k
+}
+
+// windowKey returns the key of the sorted set for the window of the given
+// Period containing t
+func (s *System) windowKey(board string, p Period, t time.Time) string {
+	if p == AllTime {
+		return s.Key(board, p.String())
+	}
+	return s.Key(board, p.String(), p.window(t.In(s.o.Location)))
+}
+
+// incr increments the member ARGV[1] by ARGV[2] in every key, setting each
+// key's expiry to the unix timestamp at the same index in the remaining ARGV,
+// unless that's 0
+var incr = `
+	for i, key in ipairs(KEYS) do
+		redis.call('ZINCRBY', key, ARGV[2], ARGV[1])
+		local expireAt = ARGV[i + 2]
+		if expireAt ~= '0' then
+			redis.call('EXPIREAT', key, expireAt)
+		end
+	end
+	return 1
+`
+
+// Incr adds the given amount, which may be negative, to the user's score on
+// the given board, for every one of the System's Periods. A user with no score
+// starts from 0
+func (s *System) Incr(board, user string, by float64) error {
+	now := time.Now().In(s.o.Location)
+	n := len(s.o.Periods)
+	args := make([]interface{}, n, 2*n+2)
+	expires := make([]interface{}, n)
+	for i, p := range s.o.Periods {
+		args[i] = s.windowKey(board, p, now)
+		if p != AllTime {
+			expires[i] = p.add(p.start(now), s.o.Retain+1).Unix()
+		} else {
+			expires[i] = 0
+		}
+	}
+	args = append(args, user, strconv.FormatFloat(by, 'f', -1, 64))
+	args = append(args, expires...)
+	return util.LuaEval(s.c, incr, n, args...).Err
+}
+
+// Remove removes the user from the given board, for every one of the System's
+// Periods, e.g. because they were found to be cheating
+func (s *System) Remove(board, user string) error {
+	now := time.Now()
+	for _, p := range s.o.Periods {
+		if err := s.c.Cmd("ZREM", s.windowKey(board, p, now), user).Err; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Board returns the current window of the given Period of the given board, for
+// reading
+func (s *System) Board(board string, p Period) *Board {
+	return s.BoardAt(board, p, time.Now())
+}
+
+// BoardAt returns the window of the given Period of the given board which
+// contained the given time, e.g. so yesterday's Daily board can be read. Only
+// the current window and the System's Retain windows before it are kept
+func (s *System) BoardAt(board string, p Period, t time.Time) *Board {
+	return &Board{c: s.c, key: s.windowKey(board, p, t)}
+}
+
+// Board is a single window of a single leaderboard, as returned by Board or
+// BoardAt
+type Board struct {
+	c   common.Cmder
+	key string
+}
+
+// Key returns the key of the sorted set holding the board's scores
+func (b *Board) Key() string {
+	return b.key
+}
+
+// entries returns the Entries from a ZREVRANGE WITHSCORES response, the first
+// having the given rank
+func entries(r *redis.Resp, rank int64) ([]Entry, error) {
+	l, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+	ee := make([]Entry, 0, len(l)/2)
+	for i := 0; i+1 < len(l); i += 2 {
+		score, err := strconv.ParseFloat(l[i+1], 64)
+		if err != nil {
+			return nil, err
+		}
+		ee = append(ee, Entry{User: l[i], Score: score, Rank: rank})
+		rank++
+	}
+	return ee, nil
+}
+
+// Top returns up to the first n Entries on the board
+func (b *Board) Top(n int) ([]Entry, error) {
+	if n < 1 {
+		return []Entry{}, nil
+	}
+	return entries(b.c.Cmd("ZREVRANGE", b.key, 0, n-1, "WITHSCORES"), 1)
+}
+
+// rank returns the 0 based rank of the user on the board, or ErrNotFound
+func (b *Board) rank(user string) (int64, error) {
+	r := b.c.Cmd("ZREVRANK", b.key, user)
+	if r.Err != nil {
+		return 0, r.Err
+	} else if r.IsType(redis.Nil) {
+		return 0, ErrNotFound
+	}
+	return r.Int64()
+}
+
+// Rank returns the user's Entry on the board, or ErrNotFound if they don't
+// have a score on it
+func (b *Board) Rank(user string) (Entry, error) {
+	rank, err := b.rank(user)
+	if err != nil {
+		return Entry{}, err
+	}
+	score, err := b.c.Cmd("ZSCORE", b.key, user).Float64()
+	if err != nil {
+		return Entry{}, err
+	}
+	return Entry{User: user, Score: score, Rank: rank + 1}, nil
+}
+
+// Neighbors returns the user's Entry on the board along with up to n Entries on
+// either side of it, in order, or ErrNotFound if they don't have a score on it
+func (b *Board) Neighbors(user string, n int) ([]Entry, error) {
+	rank, err := b.rank(user)
+	if err != nil {
+		return nil, err
+	}
+	start := rank - int64(n)
+	if start < 0 {
+		start = 0
+	}
+	return entries(b.c.Cmd("ZREVRANGE", b.key, start, rank+int64(n), "WITHSCORES"), start+1)
+}
+
+// Len returns the number of users with a score on the board
+func (b *Board) Len() (int64, error) {
+	return b.c.Cmd("ZCARD", b.key).Int64()
+}
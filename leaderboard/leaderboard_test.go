@@ -0,0 +1,123 @@
+package leaderboard
+
+import (
+	. "testing"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSystem(t *T) *System {
+	p := commontest.APIStarterKit()
+	return New(p, &Opts{Prefix: commontest.KeyPrefix(t, p)})
+}
+
+func TestPeriod(t *T) {
+	for _, name := range []string{"all", "daily", "weekly", "monthly"} {
+		p, err := ParsePeriod(name)
+		require.Nil(t, err)
+		assert.Equal(t, name, p.String())
+	}
+	_, err := ParsePeriod("yearly")
+	assert.Equal(t, ErrUnknownPeriod, err)
+
+	// A Sunday, in the ISO week which started the Monday before
+	sun := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC), Daily.start(sun))
+	assert.Equal(t, time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC), Weekly.start(sun))
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), Monthly.start(sun))
+	assert.Equal(t, "2024-03-10", Daily.window(sun))
+	assert.Equal(t, "2024-W10", Weekly.window(sun))
+	assert.Equal(t, "2024-03", Monthly.window(sun))
+
+	assert.Equal(t, time.Date(2024, 3, 18, 0, 0, 0, 0, time.UTC), Weekly.add(Weekly.start(sun), 2))
+}
+
+func TestIncr(t *T) {
+	s := testSystem(t)
+	board := commontest.RandStr()
+	u1, u2, u3 := "a"+commontest.RandStr(), "b"+commontest.RandStr(), "c"+commontest.RandStr()
+
+	require.Nil(t, s.Incr(board, u1, 5))
+	require.Nil(t, s.Incr(board, u2, 3))
+	require.Nil(t, s.Incr(board, u2, 4.5))
+	require.Nil(t, s.Incr(board, u3, 1))
+	require.Nil(t, s.Incr(board, u3, -2))
+
+	expected := []Entry{
+		{User: u2, Score: 7.5, Rank: 1},
+		{User: u1, Score: 5, Rank: 2},
+		{User: u3, Score: -1, Rank: 3},
+	}
+	for _, p := range []Period{AllTime, Daily, Weekly, Monthly} {
+		b := s.Board(board, p)
+		top, err := b.Top(10)
+		require.Nil(t, err)
+		assert.Equal(t, expected, top, p.String())
+
+		top, err = b.Top(2)
+		require.Nil(t, err)
+		assert.Equal(t, expected[:2], top, p.String())
+
+		n, err := b.Len()
+		require.Nil(t, err)
+		assert.Equal(t, int64(3), n)
+
+		if p != AllTime {
+			ttl, err := s.c.Cmd("TTL", b.Key()).Int64()
+			require.Nil(t, err)
+			assert.True(t, ttl > 0, p.String())
+		}
+	}
+
+	// Previous windows are separate
+	top, err := s.BoardAt(board, Daily, time.Now().AddDate(0, 0, -1)).Top(10)
+	require.Nil(t, err)
+	assert.Empty(t, top)
+}
+
+func TestRankNeighbors(t *T) {
+	s := New(commontest.APIStarterKit(), &Opts{
+		Prefix:  commontest.KeyPrefix(t, commontest.APIStarterKit()),
+		Periods: []Period{AllTime},
+	})
+	board := commontest.RandStr()
+	users := []string{"u0", "u1", "u2", "u3", "u4"}
+	for i, u := range users {
+		require.Nil(t, s.Incr(board, u, float64(10-i)))
+	}
+	b := s.Board(board, AllTime)
+
+	e, err := b.Rank("u2")
+	require.Nil(t, err)
+	assert.Equal(t, Entry{User: "u2", Score: 8, Rank: 3}, e)
+	_, err = b.Rank("nope")
+	assert.Equal(t, ErrNotFound, err)
+
+	ee, err := b.Neighbors("u2", 1)
+	require.Nil(t, err)
+	assert.Equal(t, []Entry{
+		{User: "u1", Score: 9, Rank: 2},
+		{User: "u2", Score: 8, Rank: 3},
+		{User: "u3", Score: 7, Rank: 4},
+	}, ee)
+
+	ee, err = b.Neighbors("u0", 2)
+	require.Nil(t, err)
+	assert.Len(t, ee, 3)
+	assert.Equal(t, int64(1), ee[0].Rank)
+	_, err = b.Neighbors("nope", 1)
+	assert.Equal(t, ErrNotFound, err)
+
+	// Other periods weren't updated
+	n, err := s.Board(board, Daily).Len()
+	require.Nil(t, err)
+	assert.Zero(t, n)
+
+	require.Nil(t, s.Remove(board, "u0"))
+	e, err = b.Rank("u1")
+	require.Nil(t, err)
+	assert.Equal(t, int64(1), e.Rank)
+}
@@ -0,0 +1,57 @@
+package migrations
+
+import (
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/radix.v2/util"
+)
+
+// ForEachKey calls f with every key matching the given pattern (as used by
+// SCAN's MATCH), e.g. to backfill an index from existing data. If f returns an
+// error ForEachKey stops calling it and returns that error. Keys created or
+// deleted while it's running may or may not be seen
+func ForEachKey(c common.Cmder, pattern string, f func(key string) error) error {
+	ch := make(chan string)
+	errCh := make(chan error, 1)
+	go func() { errCh <- common.Scan(c, ch, "SCAN", "", pattern) }()
+
+	var err error
+	for key := range ch {
+		if err == nil {
+			err = f(key)
+		}
+	}
+	if scanErr := <-errCh; err == nil {
+		err = scanErr
+	}
+	return err
+}
+
+// renameField moves the value of the field ARGV[1] to the field ARGV[2] in the
+// hash KEYS[1], if it has the former field
+var renameField = `
+	local t = redis.call('TYPE', KEYS[1])
+	if (t.ok or t) ~= 'hash' then
+		return 0
+	end
+	local v = redis.call('HGET', KEYS[1], ARGV[1])
+	if not v then
+		return 0
+	end
+	redis.call('HSET', KEYS[1], ARGV[2], v)
+	redis.call('HDEL', KEYS[1], ARGV[1])
+	return 1
+`
+
+// RenameHashField returns a Migration Func which renames the field from to the
+// field to in every hash whose key matches the given pattern. Each hash is
+// changed atomically, and those without the field are left alone. This can be
+// used to re-key a user field after its Key was changed, e.g. with
+//
+//	RenameHashField(users.Key("*"), "_e", "_em")
+func RenameHashField(pattern, from, to string) func(common.Cmder) error {
+	return func(c common.Cmder) error {
+		return ForEachKey(c, pattern, func(key string) error {
+			return util.LuaEval(c, renameField, 1, key, from, to).Err
+		})
+	}
+}
@@ -0,0 +1,237 @@
+// Package migrations implements versioning the schema of the data stored in
+// redis, and running ordered migration functions to bring that data from one
+// version to the next, e.g. re-keying user fields or backfilling a new index.
+// A lock is held in redis while migrating, so that multiple instances starting
+// at once don't run the same migrations at the same time
+package migrations
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/radix.v2/redis"
+	"github.com/mediocregopher/radix.v2/util"
+)
+
+// Errors which can be returned from Run
+var (
+	ErrLocked   = common.ExpectedErr{Code: 503, ID: "migrations_locked", Err: "migrations are being run elsewhere"}
+	ErrLockLost = common.ExpectedErr{Code: 500, ID: "migrations_lock_lost", Err: "migrations lock was lost while migrating"}
+)
+
+// Migration is a single step in the schema's history. Func should take the data
+// from the previous Version to this one, and should be safe to run again if it
+// fails part way through, as it will be run again by the next call to Run
+type Migration struct {
+	Version     int
+	Description string
+	Func        func(common.Cmder) error
+}
+
+// System holds on to a Cmder and uses it to keep track of, and run, a set of
+// Migrations
+type System struct {
+	c          common.Cmder
+	o          *Opts
+	migrations []Migration
+}
+
+// Opts are different options which may be passed into New when creating a
+// system. They all have sane defaults which will cover most use cases
+type Opts struct {
+
+	// Prefix can be used if you wish to have two separately versioned schemas
+	// persisted on the same Cmder. Prefix will be part of a string prepended
+	// to all key names
+	Prefix string
+
+	// How long the lock is held for without being refreshed. It's refreshed
+	// while migrations are running, so this only matters if the process dies
+	// while holding it. Defaults to 30 seconds
+	LockTTL time.Duration
+
+	// How long Run waits for the lock, while another instance is holding it,
+	// before returning ErrLocked. Defaults to 5 minutes
+	LockWait time.Duration
+}
+
+// How often Run checks whether the lock has been released while waiting for it
+const lockPollInterval = 100 * time.Millisecond
+
+// New returns a new System which will use the given Cmder as its persistence
+// layer. The passed in Opts may be used to modify behavior of the System, or
+// may be nil to just use the defaults
+func New(c common.Cmder, o *Opts) *System {
+	if o == nil {
+		o = &Opts{}
+	}
+	if o.LockTTL == 0 {
+		o.LockTTL = 30 * time.Second
+	}
+	if o.LockWait == 0 {
+		o.LockWait = 5 * time.Minute
+	}
+	return &System{c: c, o: o}
+}
+
+// Key returns a key which can be used to interact with the migrations data
+// directly in redis. The current version is held at Key("version") and the lock
+// at Key("lock")
+func (s *System) Key(extra ...string) string {
+	k := "migrations:" + s.o.Prefix + ":{schema}"
+	if len(extra) > 0 {
+		k += ":" + strings.Join(extra, ":")
+	}
+	return k
+}
+
+// Add can be used just after calling New to add a Migration. Migrations must be
+// added in order, and each must have a Version greater than the one before it
+// (the first must be greater than 0, which is the version of a schema which has
+// never been migrated). Versions should never be reused or reordered once
+// they've been released
+func (s *System) Add(m Migration) {
+	last := 0
+	if len(s.migrations) > 0 {
+		last = s.migrations[len(s.migrations)-1].Version
+	}
+	if m.Version <= last {
+		panic(fmt.Sprintf("migration %d must have a version greater than %d", m.Version, last))
+	}
+	s.migrations = append(s.migrations, m)
+}
+
+// Migrations returns all Migrations which have been added
+func (s *System) Migrations() []Migration {
+	return s.migrations
+}
+
+// Version returns the version the data is currently at, which is the Version of
+// the last Migration to have been run, or 0 if none have been
+func (s *System) Version() (int, error) {
+	r := s.c.Cmd("GET", s.Key("version"))
+	if r.IsType(redis.Nil) {
+		return 0, nil
+	}
+	return r.Int()
+}
+
+// Pending returns the Migrations which haven't been run yet, in the order they
+// will be
+func (s *System) Pending() ([]Migration, error) {
+	v, err := s.Version()
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, m := range s.migrations {
+		if m.Version > v {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// pexpireEqual sets the expire time of KEYS[1] to ARGV[1] milliseconds if its
+// value is ARGV[2]. Returns 1 if it was, 0 otherwise
+var pexpireEqual = `
+	if redis.call('GET', KEYS[1]) == ARGV[2] then
+		return redis.call('PEXPIRE', KEYS[1], ARGV[1])
+	end
+	return 0
+`
+
+// delEqual deletes KEYS[1] if its value is ARGV[1]
+var delEqual = `
+	if redis.call('GET', KEYS[1]) == ARGV[1] then
+		return redis.call('DEL', KEYS[1])
+	end
+	return 0
+`
+
+// setIfLocked sets KEYS[2] to ARGV[2] if the lock KEYS[1] has the value
+// ARGV[1]. Returns 1 if it did, 0 otherwise
+var setIfLocked = `
+	if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+		return 0
+	end
+	redis.call('SET', KEYS[2], ARGV[2])
+	return 1
+`
+
+// Run runs all pending Migrations in order, recording the new version after
+// each one succeeds, and returns the Migrations it ran. If another instance is
+// already running them Run waits for it to finish (up to LockWait), then runs
+// any still pending. If a Migration fails its error is returned, along with
+// those which were run before it, and it's attempted again on the next call
+func (s *System) Run() ([]Migration, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	token := hex.EncodeToString(b)
+	lockKey, versionKey := s.Key("lock"), s.Key("version")
+	ttl := int64(s.o.LockTTL / time.Millisecond)
+
+	deadline := time.Now().Add(s.o.LockWait)
+	for {
+		r := s.c.Cmd("SET", lockKey, token, "PX", ttl, "NX")
+		if r.Err != nil {
+			return nil, r.Err
+		} else if !r.IsType(redis.Nil) {
+			break
+		} else if time.Now().After(deadline) {
+			return nil, ErrLocked
+		}
+		time.Sleep(lockPollInterval)
+	}
+	defer util.LuaEval(s.c, delEqual, 1, lockKey, token)
+
+	// Keep the lock from expiring for as long as migrations are running
+	stopCh := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(s.o.LockTTL / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				util.LuaEval(s.c, pexpireEqual, 1, lockKey, ttl, token)
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+	defer wg.Wait()
+	defer close(stopCh)
+
+	pending, err := s.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	for _, m := range pending {
+		if common.Log != nil {
+			common.Log.Printf("running migration %d: %s", m.Version, m.Description)
+		}
+		if err := m.Func(s.c); err != nil {
+			return ran, fmt.Errorf("migration %d: %w", m.Version, err)
+		}
+		ok, err := util.LuaEval(s.c, setIfLocked, 2, lockKey, versionKey, token, m.Version).Int()
+		if err != nil {
+			return ran, err
+		} else if ok == 0 {
+			return ran, ErrLockLost
+		}
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
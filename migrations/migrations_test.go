@@ -0,0 +1,115 @@
+package migrations
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	. "testing"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSystem(t *T, o *Opts) *System {
+	p := commontest.APIStarterKit()
+	if o == nil {
+		o = &Opts{}
+	}
+	o.Prefix = commontest.KeyPrefix(t, p)
+	return New(p, o)
+}
+
+func assertVersion(t *T, s *System, expected int) {
+	v, err := s.Version()
+	require.Nil(t, err)
+	assert.Equal(t, expected, v)
+}
+
+func TestRun(t *T) {
+	s := testSystem(t, nil)
+	assertVersion(t, s, 0)
+
+	var calls []int
+	for _, v := range []int{1, 5} {
+		v := v
+		s.Add(Migration{Version: v, Func: func(common.Cmder) error {
+			calls = append(calls, v)
+			return nil
+		}})
+	}
+	assert.Panics(t, func() { s.Add(Migration{Version: 5}) })
+
+	pending, err := s.Pending()
+	require.Nil(t, err)
+	assert.Len(t, pending, 2)
+
+	ran, err := s.Run()
+	require.Nil(t, err)
+	assert.Len(t, ran, 2)
+	assert.Equal(t, []int{1, 5}, calls)
+	assertVersion(t, s, 5)
+
+	// Running again does nothing
+	ran, err = s.Run()
+	require.Nil(t, err)
+	assert.Empty(t, ran)
+	assert.Equal(t, []int{1, 5}, calls)
+
+	// A failed migration leaves the version where it was
+	fail := errors.New("fail")
+	s.Add(Migration{Version: 6, Func: func(common.Cmder) error { return fail }})
+	ran, err = s.Run()
+	assert.True(t, errors.Is(err, fail))
+	assert.Empty(t, ran)
+	assertVersion(t, s, 5)
+}
+
+func TestLock(t *T) {
+	s := testSystem(t, nil)
+	var calls int32
+	s.Add(Migration{Version: 1, Func: func(common.Cmder) error {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	}})
+
+	// Instances running at the same time only run each migration once
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Run()
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assertVersion(t, s, 1)
+
+	require.Nil(t, s.c.Cmd("SET", s.Key("lock"), "someone-else").Err)
+	s.o.LockWait = 200 * time.Millisecond
+	_, err := s.Run()
+	assert.Equal(t, ErrLocked, err)
+}
+
+func TestRenameHashField(t *T) {
+	s := testSystem(t, nil)
+	k1, k2 := s.Key("a", "hash"), s.Key("b", "hash")
+	require.Nil(t, s.c.Cmd("HSET", k1, "old", "foo").Err)
+	require.Nil(t, s.c.Cmd("HSET", k2, "other", "bar").Err)
+
+	s.Add(Migration{Version: 1, Func: RenameHashField(s.Key("*", "hash"), "old", "new")})
+	_, err := s.Run()
+	require.Nil(t, err)
+
+	m, err := s.c.Cmd("HGETALL", k1).Map()
+	require.Nil(t, err)
+	assert.Equal(t, map[string]string{"new": "foo"}, m)
+	m, err = s.c.Cmd("HGETALL", k2).Map()
+	require.Nil(t, err)
+	assert.Equal(t, map[string]string{"other": "bar"}, m)
+}
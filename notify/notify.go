@@ -0,0 +1,113 @@
+// Package notify implements sending notifications, e.g. emails, to users. A
+// Sender delivers Messages, which are generally created from a Template. SMTP
+// and webhook Senders are provided, along with Templates for the common cases
+// of verifying an email address, resetting a password, and telling followers a
+// broadcast has started
+package notify
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+// Message is a single notification to be sent to a single recipient
+type Message struct {
+	// Kind identifies what the message is for, e.g. "verify-email". It's set
+	// from the Template the Message was made from, and lets a webhook receiver
+	// handle different kinds of messages differently
+	Kind string `json:"kind"`
+
+	// To is the recipient's email address
+	To string `json:"to"`
+
+	// Subject is the message's subject line
+	Subject string `json:"subject"`
+
+	// Text is the plain text body of the message
+	Text string `json:"text"`
+
+	// HTML is the html body of the message. Optional
+	HTML string `json:"html,omitempty"`
+}
+
+// Sender is implemented by anything which can deliver Messages
+type Sender interface {
+	Send(Message) error
+}
+
+// Template describes how to create Messages of a particular Kind. Its Subject,
+// Text, and HTML are go templates, with Text and Subject being executed using
+// text/template and HTML using html/template. They're all executed with the
+// data given to Message
+type Template struct {
+	Kind string
+
+	subject, text *texttemplate.Template
+	html          *htmltemplate.Template
+}
+
+// NewTemplate parses and returns a Template of the given kind. html may be
+// empty, in which case Messages made from the Template have no HTML body
+func NewTemplate(kind, subject, text, html string) (*Template, error) {
+	t := &Template{Kind: kind}
+	var err error
+	if t.subject, err = texttemplate.New(kind + "-subject").Parse(subject); err != nil {
+		return nil, err
+	}
+	if t.text, err = texttemplate.New(kind + "-text").Parse(text); err != nil {
+		return nil, err
+	}
+	if html != "" {
+		if t.html, err = htmltemplate.New(kind + "-html").Parse(html); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// MustTemplate is like NewTemplate, but panics if any of the templates can't be
+// parsed. It's intended for Templates defined at the package level
+func MustTemplate(kind, subject, text, html string) *Template {
+	t, err := NewTemplate(kind, subject, text, html)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Message returns a Message to the given recipient, created by executing the
+// Template's templates with the given data
+func (t *Template) Message(to string, data interface{}) (Message, error) {
+	m := Message{Kind: t.Kind, To: to}
+	buf := new(bytes.Buffer)
+	if err := t.subject.Execute(buf, data); err != nil {
+		return Message{}, err
+	}
+	m.Subject = buf.String()
+
+	buf.Reset()
+	if err := t.text.Execute(buf, data); err != nil {
+		return Message{}, err
+	}
+	m.Text = buf.String()
+
+	if t.html != nil {
+		buf.Reset()
+		if err := t.html.Execute(buf, data); err != nil {
+			return Message{}, err
+		}
+		m.HTML = buf.String()
+	}
+	return m, nil
+}
+
+// Send creates a Message from the given Template and sends it using the
+// given Sender
+func Send(s Sender, t *Template, to string, data interface{}) error {
+	m, err := t.Message(to, data)
+	if err != nil {
+		return err
+	}
+	return s.Send(m)
+}
@@ -0,0 +1,147 @@
+package notify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate(t *T) {
+	tpl := MustTemplate("test", "Hi {{.User}}", "Go to {{.Link}}", `<a href="{{.Link}}">{{.User}}</a>`)
+	m, err := tpl.Message("foo@example.com", LinkData{User: "<foo>", Link: "https://example.com/?a=b"})
+	require.Nil(t, err)
+	assert.Equal(t, Message{
+		Kind:    "test",
+		To:      "foo@example.com",
+		Subject: "Hi <foo>",
+		Text:    "Go to https://example.com/?a=b",
+		HTML:    `<a href="https://example.com/?a=b">&lt;foo&gt;</a>`,
+	}, m)
+
+	_, err = NewTemplate("test", "{{.User", "", "")
+	assert.NotNil(t, err)
+
+	// The default templates all execute with their documented data
+	for _, d := range []struct {
+		tpl  *Template
+		data interface{}
+	}{
+		{VerifyEmail, LinkData{"foo", "https://example.com"}},
+		{PasswordReset, LinkData{"foo", "https://example.com"}},
+		{BroadcastLive, BroadcastData{"foo", "bar", "https://example.com"}},
+	} {
+		m, err := d.tpl.Message("foo@example.com", d.data)
+		require.Nil(t, err, d.tpl.Kind)
+		assert.Contains(t, m.Text, "https://example.com", d.tpl.Kind)
+		assert.Contains(t, m.HTML, "https://example.com", d.tpl.Kind)
+	}
+}
+
+// fakeSMTP accepts a single SMTP session on a random local port, and returns
+// its address along with a channel the DATA it received is written to
+func fakeSMTP(t *T) (string, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	dataCh := make(chan string, 1)
+	go func() {
+		defer l.Close()
+		nc, err := l.Accept()
+		if err != nil {
+			return
+		}
+		c := textproto.NewConn(nc)
+		defer c.Close()
+		c.PrintfLine("220 localhost")
+		for {
+			line, err := c.ReadLine()
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+			case "EHLO", "HELO", "MAIL", "RCPT", "RSET", "NOOP":
+				c.PrintfLine("250 OK")
+			case "DATA":
+				c.PrintfLine("354 go ahead")
+				b, _ := c.ReadDotBytes()
+				dataCh <- string(b)
+				c.PrintfLine("250 OK")
+			case "QUIT":
+				c.PrintfLine("221 bye")
+				return
+			default:
+				c.PrintfLine("502 unknown command")
+			}
+		}
+	}()
+	return l.Addr().String(), dataCh
+}
+
+func TestSMTP(t *T) {
+	_, err := NewSMTP("localhost:25", "not an address", nil)
+	assert.NotNil(t, err)
+
+	addr, dataCh := fakeSMTP(t)
+	s, err := NewSMTP(addr, "Example <noreply@example.com>", nil)
+	require.Nil(t, err)
+	require.Nil(t, s.Send(Message{
+		To:      "foo@example.com",
+		Subject: "Héllo",
+		Text:    "text body",
+		HTML:    "<p>html body</p>",
+	}))
+
+	msg, err := mail.ReadMessage(strings.NewReader(<-dataCh))
+	require.Nil(t, err)
+	assert.Equal(t, `"Example" <noreply@example.com>`, msg.Header.Get("From"))
+	assert.Equal(t, "foo@example.com", msg.Header.Get("To"))
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.Nil(t, err)
+	assert.Equal(t, "Héllo", subject)
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.Nil(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	var bodies []string
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		b, err := ioutil.ReadAll(p)
+		require.Nil(t, err)
+		bodies = append(bodies, string(b))
+	}
+	assert.Equal(t, []string{"text body", "<p>html body</p>"}, bodies)
+}
+
+func TestWebhook(t *T) {
+	secret := []byte("turtles")
+	var got Message
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get(WebhookSignatureHeader) != WebhookSignature(secret, body) {
+			w.WriteHeader(403)
+			return
+		}
+		json.Unmarshal(body, &got)
+	}))
+	defer srv.Close()
+
+	m := Message{Kind: "test", To: "foo@example.com", Subject: "hi", Text: "body"}
+	require.Nil(t, NewWebhook(srv.URL, &WebhookOpts{Secret: secret}).Send(m))
+	assert.Equal(t, m, got)
+
+	assert.NotNil(t, NewWebhook(srv.URL, &WebhookOpts{Secret: []byte("wrong")}).Send(m))
+}
@@ -0,0 +1,137 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// SMTPOpts are different options which may be passed into NewSMTP. They all
+// have sane defaults which will cover most use cases
+type SMTPOpts struct {
+
+	// If set, PLAIN authentication is done with these credentials. net/smtp
+	// only allows this over TLS (which is used whenever the server supports
+	// STARTTLS) or to localhost
+	Username, Password string
+}
+
+// SMTP is a Sender which sends Messages as emails through an SMTP server
+type SMTP struct {
+	addr     string
+	from     string
+	envelope string
+	auth     smtp.Auth
+}
+
+// NewSMTP returns an SMTP which sends through the server at the given address
+// (e.g. "smtp.example.com:587"), with emails coming from the given address,
+// which may include a name (e.g. "Example <noreply@example.com>"). The passed
+// in SMTPOpts may be nil to just use the defaults
+func NewSMTP(addr, from string, o *SMTPOpts) (*SMTP, error) {
+	if o == nil {
+		o = &SMTPOpts{}
+	}
+	fromAddr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from address: %s", err)
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SMTP{addr: addr, from: fromAddr.String(), envelope: fromAddr.Address}
+	if o.Username != "" {
+		s.auth = smtp.PlainAuth("", o.Username, o.Password, host)
+	}
+	return s, nil
+}
+
+// Send implements the Sender interface
+func (s *SMTP) Send(m Message) error {
+	b, err := s.format(m)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(s.addr, s.auth, s.envelope, []string{m.To}, b)
+}
+
+// format returns the full email for the given Message, headers and all. If the
+// Message has an HTML body it's sent as multipart/alternative, so clients
+// which can't display html show the text body instead
+func (s *SMTP) format(m Message) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	header := func(k, v string) {
+		fmt.Fprintf(buf, "%s: %s\r\n", k, v)
+	}
+	header("From", s.from)
+	header("To", m.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", s.messageID())
+	header("MIME-Version", "1.0")
+
+	if m.HTML == "" {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQP(buf, m.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(buf)
+	header("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	buf.WriteString("\r\n")
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQP(pw, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQP(w io.Writer, body string) error {
+	qw := quotedprintable.NewWriter(w)
+	if _, err := qw.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qw.Close()
+}
+
+// messageID returns a new unique Message-ID, using the domain of the from
+// address
+func (s *SMTP) messageID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	domain := s.envelope[strings.LastIndex(s.envelope, "@")+1:]
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
@@ -0,0 +1,71 @@
+package notify
+
+// LinkData is the data the VerifyEmail and PasswordReset Templates are
+// executed with
+type LinkData struct {
+	// The name of the user the message is for
+	User string
+
+	// The link the user must follow to complete the action
+	Link string
+}
+
+// BroadcastData is the data the BroadcastLive Template is executed with
+type BroadcastData struct {
+	// The name of the user the message is for
+	User string
+
+	// The name of the user who started broadcasting
+	Broadcaster string
+
+	// A link to the broadcast
+	Link string
+}
+
+// Templates for common notifications. They can be used as-is, or replaced by
+// Templates of the same Kind with the application's own wording
+var (
+	VerifyEmail = MustTemplate("verify-email",
+		`Verify your email address`,
+		`Hi {{.User}},
+
+Please verify your email address by following this link:
+
+{{.Link}}
+
+If you didn't create an account you can ignore this email.
+`,
+		`<p>Hi {{.User}},</p>
+<p>Please verify your email address by following <a href="{{.Link}}">this link</a>.</p>
+<p>If you didn't create an account you can ignore this email.</p>
+`)
+
+	PasswordReset = MustTemplate("password-reset",
+		`Reset your password`,
+		`Hi {{.User}},
+
+A password reset was requested for your account. You can choose a new password
+by following this link:
+
+{{.Link}}
+
+If you didn't request this you can ignore this email, your password hasn't been
+changed.
+`,
+		`<p>Hi {{.User}},</p>
+<p>A password reset was requested for your account. You can choose a new password by following <a href="{{.Link}}">this link</a>.</p>
+<p>If you didn't request this you can ignore this email, your password hasn't been changed.</p>
+`)
+
+	BroadcastLive = MustTemplate("broadcast-live",
+		`{{.Broadcaster}} is live`,
+		`Hi {{.User}},
+
+{{.Broadcaster}} just started broadcasting. Watch now:
+
+{{.Link}}
+`,
+		`<p>Hi {{.User}},</p>
+<p>{{.Broadcaster}} just started broadcasting. <a href="{{.Link}}">Watch now</a>.</p>
+`)
+)
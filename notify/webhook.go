@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// WebhookSignatureHeader is the header a Webhook sets to the signature of each
+// request's body, if it has a Secret
+const WebhookSignatureHeader = "X-Notify-Signature"
+
+// WebhookOpts are different options which may be passed into NewWebhook. They
+// all have sane defaults which will cover most use cases
+type WebhookOpts struct {
+
+	// If set, every request has a WebhookSignatureHeader of the form
+	// "sha256=<hex>", where <hex> is the HMAC-SHA256 of the request body using
+	// this secret, so the receiver can check the request came from the Webhook
+	Secret []byte
+
+	// The client requests are made with. Defaults to a client with a 10 second
+	// timeout
+	Client *http.Client
+}
+
+// Webhook is a Sender which POSTs each Message as a json object to a url, for
+// delivering notifications through some other service (e.g. a transactional
+// email provider, or a push notification service)
+type Webhook struct {
+	url string
+	o   WebhookOpts
+}
+
+// NewWebhook returns a Webhook which POSTs to the given url. The passed in
+// WebhookOpts may be nil to just use the defaults
+func NewWebhook(url string, o *WebhookOpts) *Webhook {
+	w := &Webhook{url: url}
+	if o != nil {
+		w.o = *o
+	}
+	if w.o.Client == nil {
+		w.o.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return w
+}
+
+// Send implements the Sender interface. Any non-2xx response is returned as an
+// error
+func (w *Webhook) Send(m Message) error {
+	body, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequest("POST", w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	if w.o.Secret != nil {
+		r.Header.Set(WebhookSignatureHeader, WebhookSignature(w.o.Secret, body))
+	}
+
+	resp, err := w.o.Client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// WebhookSignature returns the value of the WebhookSignatureHeader for a
+// request with the given body, made by a Webhook with the given secret. A
+// receiver can compare it against the header using hmac.Equal
+func WebhookSignature(secret, body []byte) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write(body)
+	return "sha256=" + hex.EncodeToString(h.Sum(nil))
+}
@@ -6,29 +6,86 @@
 package pickyjson
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"reflect"
+	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/mediocregopher/mediocre-api/common"
 )
 
 // Various errors which may be returned by this package
 var (
-	ErrTooLong   = common.ExpectedErr{Code: 400, Err: "too long"}
-	ErrTooShort  = common.ExpectedErr{Code: 400, Err: "too short"}
-	ErrMalformed = common.ExpectedErr{Code: 400, Err: "malformed"}
-	ErrTooBig    = common.ExpectedErr{Code: 400, Err: "too big"}
-	ErrTooSmall  = common.ExpectedErr{Code: 400, Err: "too small"}
+	ErrTooLong   = common.ExpectedErr{Code: 400, ID: "too_long", Err: "too long"}
+	ErrTooShort  = common.ExpectedErr{Code: 400, ID: "too_short", Err: "too short"}
+	ErrMalformed = common.ExpectedErr{Code: 400, ID: "malformed", Err: "malformed"}
+	ErrTooBig    = common.ExpectedErr{Code: 400, ID: "too_big", Err: "too big"}
+	ErrTooSmall  = common.ExpectedErr{Code: 400, ID: "too_small", Err: "too small"}
+
+	ErrBadContentType = common.ExpectedErr{Code: 400, ID: "bad_content_type", Err: "content type not allowed"}
 )
 
 // Functions which return errors based on the related field names
 var (
 	ErrFieldRequiredf = func(f string) error {
-		return common.ExpectedErrf(400, "field %s required", f)
+		return common.ExpectedErrf(400, "field %s required", f).
+			WithID("field_required")
+	}
+	ErrFieldInvalidf = func(f string, err common.ExpectedErr) error {
+		return common.ExpectedErrf(err.Code, "field %s %s", f, err.Err).
+			WithID(err.ID)
+	}
+	ErrInvalidChoicef = func(choices []string) error {
+		return common.ExpectedErrf(
+			400, "must be one of: %s", strings.Join(choices, ", "),
+		).WithID("invalid_choice")
 	}
 )
 
+// ErrMsgs holds optional overrides for the messages of the errors returned
+// when a constraint isn't met, for returning domain-specific messages like
+// "password must be at least 6 characters" instead of the generic ones. Any
+// overrides left empty will use the normal error. Overridden messages are
+// returned as-is, without the path to the field which failed being added
+type ErrMsgs struct {
+	TooLong, TooShort, TooBig, TooSmall string
+	Malformed, InvalidChoice, Required  string
+}
+
+// override returns err with its message replaced by msg, or err as-is if msg
+// is empty
+func (m ErrMsgs) override(err error, msg string) error {
+	if msg == "" {
+		return err
+	}
+	eerr, _ := err.(common.ExpectedErr)
+	eerr.Err = msg
+	return eerr
+}
+
+// isOverride returns whether the given error has a message which came from
+// one of the overrides
+func (m ErrMsgs) isOverride(err error) bool {
+	eerr, ok := err.(common.ExpectedErr)
+	if !ok {
+		return false
+	}
+	for _, msg := range []string{
+		m.TooLong, m.TooShort, m.TooBig, m.TooSmall,
+		m.Malformed, m.InvalidChoice, m.Required,
+	} {
+		if msg != "" && msg == eerr.Err {
+			return true
+		}
+	}
+	return false
+}
+
 // Str is a wrapper for a normal go string, but with extra constraints. If a
 // constraint is not specified it will not be applied
 type Str struct {
@@ -36,6 +93,21 @@ type Str struct {
 	// essentially require the Str to be set if it's a field in a struct
 	MaxLength, MinLength int
 
+	// If set the string must be one of the given values, otherwise an error
+	// listing all valid values is returned
+	OneOf []string
+
+	// If set along with OneOf the string will be compared against the values
+	// case-insensitively, and will be filled in with the casing of the matching
+	// value in OneOf
+	OneOfFold bool
+
+	// If set the string must match this regular expression, otherwise
+	// ErrMalformed is returned. Since a Str is generally copied from a
+	// package-level template the regex only needs to be compiled once, e.g.
+	// with regexp.MustCompile
+	Pattern *regexp.Regexp
+
 	// A function the string will be passed to, useful for more complicated
 	// checks. It returns whether or not the string is valid
 	Func func(string) bool
@@ -44,9 +116,20 @@ type Str struct {
 	// passes all other constraints)
 	Map func(string) (string, error)
 
+	// Optional overrides for the error messages returned when the above
+	// constraints aren't met
+	ErrMsgs ErrMsgs
+
+	// If non-empty this will be filled into Str by Unmarshal when the field
+	// is absent from the json entirely. Unlike pre-filling Str this is not
+	// overwritten when the field is present but empty
+	Default string
+
 	// The place the value will be filled into if it passes all constraints.
 	// This can be pre-filled with a default value
 	Str string
+
+	set, null bool
 }
 
 // MarshalJSON implements the json.Marshaler interface, marshalling the value of
@@ -59,19 +142,36 @@ func (s *Str) MarshalJSON() ([]byte, error) {
 // given encoded json into the Str field. If the value doesn't fit within any
 // of the constraints an error will be returned
 func (s *Str) UnmarshalJSON(b []byte) error {
+	if isNull(b) {
+		s.Str = ""
+		s.set, s.null = true, true
+		return nil
+	}
+	s.null = false
+
 	var err error
 	if err = json.Unmarshal(b, &s.Str); err != nil {
 		return err
 	}
 
 	if l := len(s.Str); s.MaxLength > 0 && l > s.MaxLength {
-		return ErrTooLong
+		return s.ErrMsgs.override(ErrTooLong, s.ErrMsgs.TooLong)
 	} else if l < s.MinLength {
-		return ErrTooShort
+		return s.ErrMsgs.override(ErrTooShort, s.ErrMsgs.TooShort)
+	}
+
+	if s.Str != "" && len(s.OneOf) > 0 {
+		if s.Str, err = s.oneOf(s.Str); err != nil {
+			return err
+		}
+	}
+
+	if s.Str != "" && s.Pattern != nil && !s.Pattern.MatchString(s.Str) {
+		return s.ErrMsgs.override(ErrMalformed, s.ErrMsgs.Malformed)
 	}
 
 	if s.Str != "" && s.Func != nil && !s.Func(s.Str) {
-		return ErrMalformed
+		return s.ErrMsgs.override(ErrMalformed, s.ErrMsgs.Malformed)
 	}
 
 	if s.Str != "" && s.Map != nil {
@@ -80,9 +180,46 @@ func (s *Str) UnmarshalJSON(b []byte) error {
 		}
 	}
 
+	s.set = true
+
 	return nil
 }
 
+// WasSet returns whether or not the Str was actually present in the json it
+// was unmarshalled from (even if it was present but empty or null)
+func (s *Str) WasSet() bool {
+	return s.set
+}
+
+// IsNull returns whether or not the Str was explicitly set to null in the json
+// it was unmarshalled from, in which case Str will be empty and none of the
+// constraints will have been checked. Together with WasSet this can be used to
+// differentiate between a field being absent ("don't touch it"), being null
+// ("clear it"), and being an empty string
+func (s *Str) IsNull() bool {
+	return s.null
+}
+
+func (s *Str) errMsgs() ErrMsgs {
+	return s.ErrMsgs
+}
+
+func (s *Str) applyDefault() {
+	if s.Default != "" {
+		s.Str = s.Default
+	}
+}
+
+func (s *Str) oneOf(str string) (string, error) {
+	for _, choice := range s.OneOf {
+		if choice == str || (s.OneOfFold && strings.EqualFold(choice, str)) {
+			return choice, nil
+		}
+	}
+	err := ErrInvalidChoicef(s.OneOf)
+	return "", s.ErrMsgs.override(err, s.ErrMsgs.InvalidChoice)
+}
+
 // String implementation for fmt.Stringer
 func (s *Str) String() string {
 	return fmt.Sprintf("%q", s.Str)
@@ -112,6 +249,14 @@ type Int64 struct {
 	// integer is valid
 	Func func(int64) bool
 
+	// Optional overrides for the error messages returned when the above
+	// constraints aren't met
+	ErrMsgs ErrMsgs
+
+	// If non-zero this will be filled into Int64 by Unmarshal when the field
+	// is absent from the json entirely
+	Default int64
+
 	// The place the value will be filled into if it passes all constraints.
 	// This can be pre-filled with a default value
 	Int64 int64
@@ -120,7 +265,7 @@ type Int64 struct {
 	// struct
 	Require bool
 
-	filled bool
+	filled, null bool
 }
 
 // MarshalJSON implements the json.Marshaler interface, marshalling the value of
@@ -133,18 +278,25 @@ func (i *Int64) MarshalJSON() ([]byte, error) {
 // given encoded json into the Int64 field. If the value doesn't fit within any
 // of the constraints an error will be returned
 func (i *Int64) UnmarshalJSON(b []byte) error {
+	if isNull(b) {
+		i.Int64 = 0
+		i.filled, i.null = true, true
+		return nil
+	}
+	i.null = false
+
 	if err := json.Unmarshal(b, &i.Int64); err != nil {
 		return err
 	}
 
 	if i.Max > i.Min && i.Int64 > i.Max {
-		return ErrTooBig
+		return i.ErrMsgs.override(ErrTooBig, i.ErrMsgs.TooBig)
 	} else if i.Int64 < i.Min {
-		return ErrTooSmall
+		return i.ErrMsgs.override(ErrTooSmall, i.ErrMsgs.TooSmall)
 	}
 
 	if i.Func != nil && !i.Func(i.Int64) {
-		return ErrMalformed
+		return i.ErrMsgs.override(ErrMalformed, i.ErrMsgs.Malformed)
 	}
 
 	i.filled = true
@@ -152,6 +304,30 @@ func (i *Int64) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// WasSet returns whether or not the Int64 was actually present in the json it
+// was unmarshalled from (even if it was present but null)
+func (i *Int64) WasSet() bool {
+	return i.filled
+}
+
+// IsNull returns whether or not the Int64 was explicitly set to null in the
+// json it was unmarshalled from, in which case Int64 will be zero and none of
+// the constraints will have been checked. A null value does not satisfy
+// Require
+func (i *Int64) IsNull() bool {
+	return i.null
+}
+
+func (i *Int64) errMsgs() ErrMsgs {
+	return i.ErrMsgs
+}
+
+func (i *Int64) applyDefault() {
+	if i.Default != 0 {
+		i.Int64 = i.Default
+	}
+}
+
 // Required is a convenience method which returns an exact copy of the Int64
 // with Require set to true
 func (i Int64) Required() Int64 {
@@ -164,42 +340,293 @@ func (i *Int64) String() string {
 	return fmt.Sprint(i.Int64)
 }
 
+// UUID is a wrapper for a uuid string. When unmarshalling it will accept the
+// uuid in upper or lower case, with or without hyphens, and optionally wrapped
+// in braces or prefixed with "urn:uuid:". The resulting value will always be
+// in the canonical lowercase, hyphenated form (e.g.
+// "6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+type UUID struct {
+	// Whether or not this must be filled in, if specified for a field in a
+	// struct
+	Require bool
+
+	// The place the canonical value will be filled into if it is a valid uuid.
+	// This can be pre-filled with a default value
+	UUID string
+}
+
+// MarshalJSON implements the json.Marshaler interface, marshalling the value of
+// the UUID field
+func (u *UUID) MarshalJSON() ([]byte, error) {
+	return json.Marshal(u.UUID)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface, unmarshalling the
+// given encoded json into the UUID field. If the value isn't a valid uuid
+// ErrMalformed will be returned. An empty string is allowed, and is treated as
+// the field not being filled in
+func (u *UUID) UnmarshalJSON(b []byte) error {
+	var str string
+	if err := json.Unmarshal(b, &str); err != nil {
+		return err
+	}
+
+	if str == "" {
+		u.UUID = ""
+		return nil
+	}
+
+	canon, ok := canonicalUUID(str)
+	if !ok {
+		return ErrMalformed
+	}
+	u.UUID = canon
+	return nil
+}
+
+// Required is a convenience method which returns an exact copy of the UUID
+// with Require set to true
+func (u UUID) Required() UUID {
+	u.Require = true
+	return u
+}
+
+// String implementation for fmt.Stringer
+func (u *UUID) String() string {
+	return fmt.Sprintf("%q", u.UUID)
+}
+
+// Bytes is a wrapper for a []byte which is sent in the json as a base64
+// encoded string, with extra constraints. It's useful for small binary
+// payloads like avatars or signatures. If a constraint is not specified it
+// will not be applied
+type Bytes struct {
+	// The encoding the string is expected to be in. Defaults to
+	// base64.StdEncoding
+	Encoding *base64.Encoding
+
+	// Maximum length the decoded bytes may be. This is checked before
+	// decoding, so it can be used to prevent large payloads from being
+	// decoded at all
+	MaxDecodedLength int
+
+	// If set the content type of the decoded bytes, as determined by
+	// http.DetectContentType, must start with one of these (e.g. "image/")
+	// or ErrBadContentType is returned
+	ContentTypes []string
+
+	// A function the decoded bytes and their detected content type will be
+	// passed to, useful for more complicated checks. It returns whether or not
+	// the bytes are valid
+	Func func([]byte, string) bool
+
+	// Whether or not this must be filled in, if specified for a field in a
+	// struct
+	Require bool
+
+	// The place the decoded value will be filled into if it passes all
+	// constraints. This can be pre-filled with a default value
+	Bytes []byte
+
+	contentType string
+}
+
+func (bs *Bytes) encoding() *base64.Encoding {
+	if bs.Encoding == nil {
+		return base64.StdEncoding
+	}
+	return bs.Encoding
+}
+
+// MarshalJSON implements the json.Marshaler interface, marshalling the value of
+// the Bytes field as an encoded string
+func (bs *Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(bs.encoding().EncodeToString(bs.Bytes))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface, decoding the given
+// encoded json string into the Bytes field. If the value doesn't fit within
+// any of the constraints an error will be returned
+func (bs *Bytes) UnmarshalJSON(b []byte) error {
+	if isNull(b) {
+		bs.Bytes, bs.contentType = nil, ""
+		return nil
+	}
+
+	var str string
+	if err := json.Unmarshal(b, &str); err != nil {
+		return err
+	}
+
+	enc := bs.encoding()
+	if bs.MaxDecodedLength > 0 && len(str) > enc.EncodedLen(bs.MaxDecodedLength) {
+		return ErrTooLong
+	}
+
+	dec, err := enc.DecodeString(str)
+	if err != nil {
+		return ErrMalformed
+	}
+	if bs.MaxDecodedLength > 0 && len(dec) > bs.MaxDecodedLength {
+		return ErrTooLong
+	}
+
+	var contentType string
+	if len(dec) > 0 {
+		contentType = http.DetectContentType(dec)
+	}
+
+	if len(dec) > 0 && len(bs.ContentTypes) > 0 {
+		var ok bool
+		for _, prefix := range bs.ContentTypes {
+			if strings.HasPrefix(contentType, prefix) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return ErrBadContentType
+		}
+	}
+
+	if len(dec) > 0 && bs.Func != nil && !bs.Func(dec, contentType) {
+		return ErrMalformed
+	}
+
+	bs.Bytes, bs.contentType = dec, contentType
+	return nil
+}
+
+// ContentType returns the content type of the unmarshalled bytes, as
+// determined by http.DetectContentType. Returns empty string if nothing has
+// been unmarshalled
+func (bs *Bytes) ContentType() string {
+	return bs.contentType
+}
+
+// Required is a convenience method which returns an exact copy of the Bytes
+// with Require set to true
+func (bs Bytes) Required() Bytes {
+	bs.Require = true
+	return bs
+}
+
+// String implementation for fmt.Stringer
+func (bs *Bytes) String() string {
+	return fmt.Sprintf("%q", bs.encoding().EncodeToString(bs.Bytes))
+}
+
+func isNull(b []byte) bool {
+	return string(b) == "null"
+}
+
+// canonicalUUID returns the lowercase, hyphenated form of the given uuid
+// string, or false if it isn't a uuid at all
+func canonicalUUID(str string) (string, bool) {
+	str = strings.ToLower(str)
+	str = strings.TrimPrefix(str, "urn:uuid:")
+	if len(str) > 2 && str[0] == '{' && str[len(str)-1] == '}' {
+		str = str[1 : len(str)-1]
+	}
+
+	switch len(str) {
+	case 32:
+	case 36:
+		if str[8] != '-' || str[13] != '-' || str[18] != '-' || str[23] != '-' {
+			return "", false
+		}
+		str = str[:8] + str[9:13] + str[14:18] + str[19:23] + str[24:]
+	default:
+		return "", false
+	}
+
+	if _, err := hex.DecodeString(str); err != nil || len(str) != 32 {
+		return "", false
+	}
+
+	return str[:8] + "-" + str[8:12] + "-" + str[12:16] + "-" + str[16:20] +
+		"-" + str[20:], true
+}
+
 // CheckRequired takes in a struct and looks through it to ensure all required
 // parameters were actually filled in post-unmarshal. It will look through all
-// struct recursively (although it won't traverse slices/maps at the moment)
+// structs recursively, as well as through the elements of any slices, arrays,
+// and map values it comes across. The returned error will contain the full
+// path to the missing field, e.g. "field Profile.Links[2].URL required"
 func CheckRequired(i interface{}) error {
-	v := reflect.ValueOf(i)
-	vk := v.Kind()
-	if vk == reflect.Ptr || vk == reflect.Interface {
+	return checkRequired(reflect.ValueOf(i), "")
+}
+
+// checkRequired performs the actual work of CheckRequired. path is the path
+// which v was found under, and is used in any returned error
+func checkRequired(v reflect.Value, path string) error {
+	for vk := v.Kind(); vk == reflect.Ptr || vk == reflect.Interface; {
 		v = v.Elem()
+		vk = v.Kind()
 	}
-	if v.Kind() != reflect.Struct {
+	if !v.IsValid() || !v.CanInterface() {
+		return nil
+	}
+
+	switch val := v.Interface().(type) {
+	case Str:
+		if val.MinLength > 0 && val.Str == "" {
+			return val.ErrMsgs.override(ErrFieldRequiredf(path), val.ErrMsgs.Required)
+		}
+		return nil
+	case Int64:
+		if val.Require && (!val.filled || val.null) {
+			return val.ErrMsgs.override(ErrFieldRequiredf(path), val.ErrMsgs.Required)
+		}
+		return nil
+	case Bytes:
+		if val.Require && len(val.Bytes) == 0 {
+			return ErrFieldRequiredf(path)
+		}
+		return nil
+	case UUID:
+		if val.Require && val.UUID == "" {
+			return ErrFieldRequiredf(path)
+		}
 		return nil
 	}
-	t := v.Type()
 
-	for ii := 0; ii < v.NumField(); ii++ {
-		fieldValV := v.Field(ii)
-		switch fieldVal := fieldValV.Interface().(type) {
-		case Str:
-			if fieldVal.MinLength > 0 && fieldVal.Str == "" {
-				field := t.Field(ii)
-				return ErrFieldRequiredf(field.Name)
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for ii := 0; ii < v.NumField(); ii++ {
+			field := t.Field(ii)
+			name, ok := fieldName(field)
+			if !ok {
+				continue
 			}
-		case Int64:
-			if fieldVal.Require && !fieldVal.filled {
-				field := t.Field(ii)
-				return ErrFieldRequiredf(field.Name)
+			fieldPath := path
+			if !isEmbedded(field) {
+				fieldPath = joinPath(path, name)
 			}
-		default:
-			fvk := fieldValV.Kind()
-			if fvk == reflect.Ptr || fvk == reflect.Interface {
-				fieldValV = fieldValV.Elem()
+			if err := checkRequired(v.Field(ii), fieldPath); err != nil {
+				return err
 			}
-			if fieldValV.Kind() == reflect.Struct {
-				if err := CheckRequired(fieldVal); err != nil {
-					return err
-				}
+		}
+
+	case reflect.Slice, reflect.Array:
+		for ii := 0; ii < v.Len(); ii++ {
+			err := checkRequired(v.Index(ii), indexPath(path, ii))
+			if err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		// Sort the keys so that the error returned (if any) is deterministic
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+		})
+		for _, key := range keys {
+			keyPath := joinPath(path, fmt.Sprint(key))
+			if err := checkRequired(v.MapIndex(key), keyPath); err != nil {
+				return err
 			}
 		}
 	}
@@ -1,10 +1,14 @@
 package pickyjson
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"net/url"
+	"regexp"
 	"strings"
 	. "testing"
 
+	"github.com/mediocregopher/mediocre-api/common"
 	"github.com/stretchr/testify/require"
 )
 
@@ -42,6 +46,48 @@ func TestStr(t *T) {
 	require.Equal(t, ErrMalformed, unmarshal(`"foo"`, &s))
 	require.Nil(t, unmarshal(`"bar"`, &s))
 	require.Equal(t, "BAR", s.Str)
+
+	s = Str{
+		OneOf: []string{"foo", "Bar"},
+	}
+	require.Equal(t, ErrInvalidChoicef(s.OneOf), unmarshal(`"bar"`, &s))
+	require.Equal(t, "must be one of: foo, Bar", unmarshal(`"baz"`, &s).Error())
+	require.Nil(t, unmarshal(`"Bar"`, &s))
+	require.Equal(t, "Bar", s.Str)
+
+	s.OneOfFold = true
+	require.Nil(t, unmarshal(`"FOO"`, &s))
+	require.Equal(t, "foo", s.Str)
+	require.Nil(t, unmarshal(`"bar"`, &s))
+	require.Equal(t, "Bar", s.Str)
+
+	s = Str{
+		Pattern: regexp.MustCompile(`^[a-z]+-[0-9]+$`),
+	}
+	require.Equal(t, ErrMalformed, unmarshal(`"foo"`, &s))
+	require.Equal(t, ErrMalformed, unmarshal(`"foo-12a"`, &s))
+	require.Nil(t, unmarshal(`"foo-12"`, &s))
+	require.Equal(t, "foo-12", s.Str)
+}
+
+func TestPresets(t *T) {
+	s := Email
+	require.Equal(t, ErrMalformed, unmarshal(`"foo"`, &s))
+	require.Nil(t, unmarshal(`"Foo@Example.com"`, &s))
+	require.Equal(t, "foo@example.com", s.Str)
+
+	s = URL
+	require.Equal(t, ErrMalformed, unmarshal(`"not a url"`, &s))
+	require.Nil(t, unmarshal(`"http://example.com/foo"`, &s))
+
+	s = Hostname
+	require.Equal(t, ErrMalformed, unmarshal(`"foo_bar!"`, &s))
+	require.Nil(t, unmarshal(`"foo.example.com"`, &s))
+
+	s = Username
+	require.Equal(t, ErrMalformed, unmarshal(`"foo bar"`, &s))
+	require.Equal(t, ErrTooLong, unmarshal(`"`+strings.Repeat("a", 41)+`"`, &s))
+	require.Nil(t, unmarshal(`"foobar"`, &s))
 }
 
 func TestInt64(t *T) {
@@ -79,6 +125,77 @@ func TestInt64(t *T) {
 	require.Equal(t, int64(2), i.Int64)
 }
 
+func TestUUID(t *T) {
+	canon := "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	for _, in := range []string{
+		`"6ba7b810-9dad-11d1-80b4-00c04fd430c8"`,
+		`"6BA7B810-9DAD-11D1-80B4-00C04FD430C8"`,
+		`"6ba7b8109dad11d180b400c04fd430c8"`,
+		`"{6ba7b810-9dad-11d1-80b4-00c04fd430c8}"`,
+		`"urn:uuid:6ba7b810-9dad-11d1-80b4-00c04fd430c8"`,
+	} {
+		u := UUID{}
+		require.Nil(t, unmarshal(in, &u), "in: %s", in)
+		require.Equal(t, canon, u.UUID, "in: %s", in)
+	}
+
+	for _, in := range []string{
+		`"6ba7b810-9dad-11d1-80b4-00c04fd430c"`,
+		`"6ba7b8109-dad-11d1-80b4-00c04fd430c8"`,
+		`"6ba7b810-9dad-11d1-80b4-00c04fd430cz"`,
+		`"foo"`,
+		`"------------------------------------"`,
+		`"6ba7b810-9dad-11d1-80b4-00c04fd4-0c8"`,
+		`"6ba7b810-9dad-11d1-80b4-------------"`,
+		`"6ba7b810-9dad-11d1-80b4-0-c-4-d-3-c"`,
+		`"{------------------------------------}"`,
+	} {
+		u := UUID{}
+		require.Equal(t, ErrMalformed, unmarshal(in, &u), "in: %s", in)
+	}
+
+	u := UUID{}.Required()
+	require.Nil(t, unmarshal(`""`, &u))
+	require.Equal(t, ErrFieldRequiredf("U"), CheckRequired(&struct{ U UUID }{u}))
+}
+
+func TestBytes(t *T) {
+	png := []byte("\x89PNG\x0D\x0A\x1A\x0Afoo")
+	pngEnc := `"` + base64.StdEncoding.EncodeToString(png) + `"`
+	txtEnc := `"` + base64.StdEncoding.EncodeToString([]byte("hello")) + `"`
+
+	bs := Bytes{}
+	require.Nil(t, unmarshal(pngEnc, &bs))
+	require.Equal(t, png, bs.Bytes)
+	require.Equal(t, "image/png", bs.ContentType())
+	require.Equal(t, ErrMalformed, unmarshal(`"not base64!"`, &bs))
+
+	bs = Bytes{MaxDecodedLength: 4}
+	require.Equal(t, ErrTooLong, unmarshal(pngEnc, &bs))
+	require.Equal(t, ErrTooLong, unmarshal(txtEnc, &bs))
+
+	bs = Bytes{ContentTypes: []string{"image/"}}
+	require.Equal(t, ErrBadContentType, unmarshal(txtEnc, &bs))
+	require.Nil(t, unmarshal(pngEnc, &bs))
+
+	bs = Bytes{
+		Func: func(b []byte, contentType string) bool {
+			return len(b) > 5
+		},
+	}
+	require.Equal(t, ErrMalformed, unmarshal(txtEnc, &bs))
+	require.Nil(t, unmarshal(pngEnc, &bs))
+
+	b, err := json.Marshal(&bs)
+	require.Nil(t, err)
+	require.Equal(t, pngEnc, string(b))
+
+	bs = Bytes{}.Required()
+	require.Nil(t, unmarshal(`""`, &bs))
+	err = CheckRequired(&struct{ B Bytes }{bs})
+	require.Equal(t, ErrFieldRequiredf("B"), err)
+}
+
 func TestCheckRequired(t *T) {
 	type J struct {
 		S1, S2 Str
@@ -125,13 +242,13 @@ func TestCheckRequired(t *T) {
 	j.I2.Int64 = 1
 	j.I2.filled = true
 	err = CheckRequired(&j)
-	require.Equal(t, "field S4 required", err.Error())
+	require.Equal(t, "field J2.S4 required", err.Error())
 
 	// S4 still required
 
 	j.J2.S3.Str = "Baz"
 	err = CheckRequired(&j)
-	require.Equal(t, "field S4 required", err.Error())
+	require.Equal(t, "field J2.S4 required", err.Error())
 
 	// S4 still required
 
@@ -139,3 +256,256 @@ func TestCheckRequired(t *T) {
 	err = CheckRequired(&j)
 	require.Nil(t, err)
 }
+
+func TestCheckRequiredContainers(t *T) {
+	type Link struct {
+		URL Str
+	}
+	type J struct {
+		Links  []Link
+		Arr    [2]*Link
+		ByName map[string]Link
+		IDs    []Int64
+	}
+
+	j := J{
+		Links: []Link{{URL: Str{Str: "foo"}}, {URL: Str{}.Required()}},
+	}
+	require.Equal(t, ErrFieldRequiredf("Links[1].URL"), CheckRequired(&j))
+
+	j.Links[1].URL.Str = "bar"
+	require.Nil(t, CheckRequired(&j))
+
+	j.Arr[1] = &Link{URL: Str{}.Required()}
+	require.Equal(t, ErrFieldRequiredf("Arr[1].URL"), CheckRequired(&j))
+
+	j.Arr[1].URL.Str = "baz"
+	j.ByName = map[string]Link{"a": {URL: Str{}.Required()}}
+	require.Equal(t, ErrFieldRequiredf("ByName.a.URL"), CheckRequired(&j))
+
+	j.ByName = nil
+	j.IDs = []Int64{Int64{}.Required()}
+	require.Equal(t, ErrFieldRequiredf("IDs[0]"), CheckRequired(&j))
+
+	j.IDs = nil
+	require.Nil(t, CheckRequired(&j))
+}
+
+func TestUnmarshalPath(t *T) {
+	type Link struct {
+		URL Str `json:"url"`
+	}
+	type Profile struct {
+		Links []Link
+		Ages  map[string]Int64
+	}
+	type J struct {
+		Name    Str
+		Profile *Profile
+	}
+
+	newJ := func() J {
+		return J{
+			Name: Str{MaxLength: 3},
+			Profile: &Profile{
+				Links: []Link{
+					{URL: Str{MaxLength: 3}},
+					{URL: Str{MaxLength: 3}},
+					{URL: Str{MaxLength: 3}},
+				},
+			},
+		}
+	}
+
+	j := newJ()
+	err := Unmarshal([]byte(`{"name":"foobar"}`), &j)
+	require.Equal(t, "field Name too long", err.Error())
+
+	j = newJ()
+	err = Unmarshal(
+		[]byte(`{"Profile":{"Links":[{"url":"a"},{"url":"b"},{"url":"cccc"}]}}`),
+		&j,
+	)
+	require.Equal(t, "field Profile.Links[2].url too long", err.Error())
+
+	j = newJ()
+	err = Unmarshal([]byte(`{"Profile":{"Ages":{"bob":-1}}}`), &j)
+	require.Equal(t, "field Profile.Ages.bob too small", err.Error())
+
+	j = newJ()
+	err = Unmarshal(
+		[]byte(`{"Name":"foo","Profile":{"Links":[{"url":"a"}],"Ages":{"bob":4}}}`),
+		&j,
+	)
+	require.Nil(t, err)
+	require.Equal(t, "foo", j.Name.Str)
+	require.Len(t, j.Profile.Links, 1)
+	require.Equal(t, "a", j.Profile.Links[0].URL.Str)
+	require.Equal(t, int64(4), j.Profile.Ages["bob"].Int64)
+}
+
+func TestDefault(t *T) {
+	type J struct {
+		S Str
+		I Int64
+	}
+
+	newJ := func() J {
+		return J{
+			S: Str{Default: "foo"},
+			I: Int64{Default: 5},
+		}
+	}
+
+	j := newJ()
+	require.Nil(t, Unmarshal([]byte(`{}`), &j))
+	require.Equal(t, "foo", j.S.Str)
+	require.Equal(t, int64(5), j.I.Int64)
+	require.False(t, j.S.WasSet())
+	require.False(t, j.I.WasSet())
+
+	j = newJ()
+	require.Nil(t, Unmarshal([]byte(`{"S":"","I":0}`), &j))
+	require.Equal(t, "", j.S.Str)
+	require.Equal(t, int64(0), j.I.Int64)
+	require.True(t, j.S.WasSet())
+	require.True(t, j.I.WasSet())
+}
+
+func TestErrMsgs(t *T) {
+	s := Str{
+		MinLength: 6,
+		ErrMsgs:   ErrMsgs{TooShort: "password must be at least 6 characters"},
+	}
+	err := unmarshal(`"foo"`, &s)
+	require.Equal(t, "password must be at least 6 characters", err.Error())
+	require.Equal(t, 400, err.(common.ExpectedErr).Code)
+
+	// Non-overridden errors are left alone
+	s.MaxLength = 8
+	require.Equal(t, ErrTooLong, unmarshal(`"foobarbaz"`, &s))
+
+	// Overridden errors don't get their path added
+	j := struct{ Password Str }{s}
+	err = Unmarshal([]byte(`{"Password":"foo"}`), &j)
+	require.Equal(t, "password must be at least 6 characters", err.Error())
+
+	i := Int64{ErrMsgs: ErrMsgs{Required: "age is needed"}}.Required()
+	err = CheckRequired(&struct{ Age Int64 }{i})
+	require.Equal(t, "age is needed", err.Error())
+}
+
+func TestNull(t *T) {
+	type J struct {
+		S Str
+		I Int64
+	}
+
+	j := J{S: Str{MaxLength: 10}, I: Int64{Min: 5}.Required()}
+	require.Nil(t, Unmarshal([]byte(`{}`), &j))
+	require.False(t, j.S.WasSet() || j.S.IsNull())
+	require.False(t, j.I.WasSet() || j.I.IsNull())
+
+	j = J{S: Str{MaxLength: 10, Str: "foo"}, I: Int64{Min: 5, Int64: 6}}
+	require.Nil(t, Unmarshal([]byte(`{"S":null,"I":null}`), &j))
+	require.True(t, j.S.WasSet() && j.S.IsNull())
+	require.Equal(t, "", j.S.Str)
+	require.True(t, j.I.WasSet() && j.I.IsNull())
+	require.Equal(t, int64(0), j.I.Int64)
+
+	j.I = j.I.Required()
+	require.Equal(t, ErrFieldRequiredf("I"), CheckRequired(&j))
+
+	require.Nil(t, Unmarshal([]byte(`{"S":"foobar","I":6}`), &j))
+	require.True(t, j.S.WasSet() && !j.S.IsNull())
+	require.True(t, j.I.WasSet() && !j.I.IsNull())
+}
+
+func TestUnmarshalValues(t *T) {
+	type Q struct {
+		Search Str     `json:"q"`
+		Limit  Int64   `json:"limit"`
+		Tags   []Str   `json:"tag"`
+		IDs    []Int64 `json:"id"`
+		Raw    string
+	}
+	newQ := func() Q {
+		return Q{
+			Search: Str{MaxLength: 5},
+			Limit:  Int64{Max: 100, Default: 10},
+		}
+	}
+
+	q := newQ()
+	vals, _ := url.ParseQuery("q=123&tag=a&tag=b&id=1&id=2&raw=true&other=foo")
+	require.Nil(t, UnmarshalValues(vals, &q))
+	require.Equal(t, "123", q.Search.Str)
+	require.Equal(t, int64(10), q.Limit.Int64)
+	require.Equal(t, []string{"a", "b"}, []string{q.Tags[0].Str, q.Tags[1].Str})
+	require.Equal(t, []int64{1, 2}, []int64{q.IDs[0].Int64, q.IDs[1].Int64})
+	require.Equal(t, "true", q.Raw)
+
+	q = newQ()
+	vals, _ = url.ParseQuery("limit=50")
+	require.Nil(t, UnmarshalValues(vals, &q))
+	require.Equal(t, int64(50), q.Limit.Int64)
+
+	q = newQ()
+	vals, _ = url.ParseQuery("limit=500")
+	require.Equal(t, ErrFieldInvalidf("limit", ErrTooBig), UnmarshalValues(vals, &q))
+
+	q = newQ()
+	vals, _ = url.ParseQuery("q=toolong")
+	require.Equal(t, ErrFieldInvalidf("q", ErrTooLong), UnmarshalValues(vals, &q))
+
+	q = newQ()
+	vals, _ = url.ParseQuery("limit=abc")
+	require.NotNil(t, UnmarshalValues(vals, &q))
+
+	require.NotNil(t, UnmarshalValues(vals, q))
+}
+
+func TestSchema(t *T) {
+	type link struct {
+		URL Str
+	}
+	type Common struct {
+		ID UUID
+	}
+	j := struct {
+		Common
+		Name    Str
+		Kind    Str `json:"kind"`
+		Age     Int64
+		Avatar  Bytes
+		Links   []link
+		Tags    map[string]string
+		Ignored string `json:"-"`
+		hidden  string
+	}{
+		Name:  Str{MinLength: 2, MaxLength: 10, Pattern: regexp.MustCompile(`^[a-z]+$`)},
+		Kind:  Str{OneOf: []string{"a", "b"}, Default: "a"},
+		Age:   Int64{Min: 1, Max: 100, Require: true},
+		Links: []link{{URL: URL.Required()}},
+	}
+
+	b, err := json.Marshal(Schema(&j))
+	require.Nil(t, err)
+	require.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"ID": {"type": "string", "format": "uuid"},
+			"Name": {"type": "string", "minLength": 2, "maxLength": 10, "pattern": "^[a-z]+$"},
+			"kind": {"type": "string", "enum": ["a", "b"], "default": "a"},
+			"Age": {"type": "integer", "format": "int64", "minimum": 1, "maximum": 100},
+			"Avatar": {"type": "string", "format": "byte"},
+			"Links": {"type": "array", "items": {
+				"type": "object",
+				"properties": {"URL": {"type": "string", "minLength": 1, "maxLength": 2048}},
+				"required": ["URL"]
+			}},
+			"Tags": {"type": "object", "additionalProperties": {"type": "string"}}
+		},
+		"required": ["Name", "Age"]
+	}`, string(b))
+}
@@ -0,0 +1,39 @@
+package pickyjson
+
+import "github.com/asaskevich/govalidator"
+
+// Preconfigured Strs for commonly used kinds of fields. These are meant to be
+// copied into request structs, e.g.
+//
+//	j := struct {
+//		Email pickyjson.Str
+//	}{
+//		Email: pickyjson.Email.Required(),
+//	}
+var (
+	// Email only accepts valid email addresses, and normalizes them using
+	// govalidator.NormalizeEmail
+	Email = Str{
+		MaxLength: 254,
+		Func:      govalidator.IsEmail,
+		Map:       govalidator.NormalizeEmail,
+	}
+
+	// URL only accepts valid absolute or relative urls
+	URL = Str{
+		MaxLength: 2048,
+		Func:      govalidator.IsURL,
+	}
+
+	// Hostname only accepts valid dns names
+	Hostname = Str{
+		MaxLength: 253,
+		Func:      govalidator.IsDNSName,
+	}
+
+	// Username only accepts letters and numbers (including non-ascii ones)
+	Username = Str{
+		MaxLength: 40,
+		Func:      govalidator.IsUTFLetterNumeric,
+	}
+)
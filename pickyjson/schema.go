@@ -0,0 +1,154 @@
+package pickyjson
+
+import (
+	"reflect"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Schema returns a JSON Schema, in the form used by OpenAPI documents,
+// describing the json which Unmarshal will accept into the given value. It
+// should be given the same pre-filled struct which is passed to Unmarshal, so
+// that the constraints set on any Str, Int64, UUID, and Bytes fields can be
+// included. Fields which CheckRequired would require are listed as required.
+// Func and Map constraints can't be described, and are left out
+func Schema(i interface{}) map[string]interface{} {
+	s, _ := schema(reflect.ValueOf(i))
+	return s
+}
+
+// schema performs the actual work of Schema, also returning whether the value
+// is required when it's a field in a struct
+func schema(v reflect.Value) (map[string]interface{}, bool) {
+	for vk := v.Kind(); vk == reflect.Ptr || vk == reflect.Interface; {
+		if v.IsNil() {
+			if vk == reflect.Interface {
+				return map[string]interface{}{}, false
+			}
+			v = reflect.Zero(v.Type().Elem())
+		} else {
+			v = v.Elem()
+		}
+		vk = v.Kind()
+	}
+	if !v.IsValid() || !v.CanInterface() {
+		return map[string]interface{}{}, false
+	}
+
+	switch val := v.Interface().(type) {
+	case Str:
+		s := map[string]interface{}{"type": "string"}
+		if val.MinLength > 0 {
+			s["minLength"] = val.MinLength
+		}
+		if val.MaxLength > 0 {
+			s["maxLength"] = val.MaxLength
+		}
+		if len(val.OneOf) > 0 {
+			s["enum"] = val.OneOf
+		}
+		if val.Pattern != nil {
+			s["pattern"] = val.Pattern.String()
+		}
+		if val.Default != "" {
+			s["default"] = val.Default
+		}
+		return s, val.MinLength > 0
+	case Int64:
+		s := map[string]interface{}{
+			"type":    "integer",
+			"format":  "int64",
+			"minimum": val.Min,
+		}
+		if val.Max > val.Min {
+			s["maximum"] = val.Max
+		}
+		if val.Default != 0 {
+			s["default"] = val.Default
+		}
+		return s, val.Require
+	case UUID:
+		return map[string]interface{}{"type": "string", "format": "uuid"}, val.Require
+	case Bytes:
+		return map[string]interface{}{"type": "string", "format": "byte"}, val.Require
+	}
+
+	if v.Type() == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}, false
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}, false
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, false
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}, false
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}, false
+
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}, false
+		}
+		// A pre-filled first element is used as the template for all of them
+		elem := reflect.Zero(v.Type().Elem())
+		if v.Len() > 0 {
+			elem = v.Index(0)
+		}
+		items, _ := schema(elem)
+		return map[string]interface{}{"type": "array", "items": items}, false
+
+	case reflect.Map:
+		elem, _ := schema(reflect.Zero(v.Type().Elem()))
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": elem,
+		}, false
+
+	case reflect.Struct:
+		props := map[string]interface{}{}
+		var required []string
+		addStructFields(v, props, &required)
+		s := map[string]interface{}{"type": "object", "properties": props}
+		if len(required) > 0 {
+			s["required"] = required
+		}
+		return s, false
+	}
+
+	return map[string]interface{}{}, false
+}
+
+// addStructFields adds the schema of each of the given struct's fields to
+// props, and the names of those which are required to required. The fields of
+// embedded structs are added as if they were part of the outer struct
+func addStructFields(v reflect.Value, props map[string]interface{}, required *[]string) {
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := fieldName(field)
+		if !ok {
+			continue
+		}
+		fv := v.Field(i)
+		if isEmbedded(field) {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					fv = reflect.Zero(fv.Type().Elem())
+				} else {
+					fv = fv.Elem()
+				}
+			}
+			addStructFields(fv, props, required)
+			continue
+		}
+		s, req := schema(fv)
+		props[name] = s
+		if req {
+			*required = append(*required, name)
+		}
+	}
+}
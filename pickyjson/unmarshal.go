@@ -0,0 +1,260 @@
+package pickyjson
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/mediocregopher/mediocre-api/common"
+)
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// errMsger is implemented by types which may have their error messages
+// overridden
+type errMsger interface {
+	errMsgs() ErrMsgs
+}
+
+// defaulter is implemented by types which have a default value to fall back
+// to when they are absent from the json being unmarshalled
+type defaulter interface {
+	applyDefault()
+}
+
+// Unmarshal behaves like json.Unmarshal, except that when any of the values
+// being unmarshalled return an ExpectedErr (e.g. a Str which is too long) the
+// returned error will contain the full path to the offending field, e.g.
+// "field Profile.Links[2].URL too long". Field names in the path are the names
+// the fields are given in the json.
+//
+// Any Str or Int64 fields in a struct which are absent from the json will have
+// their Default value applied.
+//
+// When unmarshalling into a slice which already has elements, those elements
+// are used as the starting values for the corresponding elements in the json
+// array, the same way pre-filled struct fields are.
+func Unmarshal(b []byte, i interface{}) error {
+	v := reflect.ValueOf(i)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		// Let encoding/json generate the appropriate error
+		return json.Unmarshal(b, i)
+	}
+	return unmarshalPath(b, v.Elem(), "")
+}
+
+// unmarshalPath unmarshals b into v, which must be settable. path is the path
+// to v from the top-level value being unmarshalled into
+func unmarshalPath(b []byte, v reflect.Value, path string) error {
+	if v.Type().Implements(unmarshalerType) ||
+		reflect.PtrTo(v.Type()).Implements(unmarshalerType) {
+		i := v.Addr().Interface()
+		err := json.Unmarshal(b, i)
+		if m, ok := i.(errMsger); ok && m.errMsgs().isOverride(err) {
+			return err
+		}
+		return wrapPathErr(err, path)
+	}
+
+	isNull := string(b) == "null"
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if isNull {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return unmarshalPath(b, v.Elem(), path)
+
+	case reflect.Struct:
+		if isNull {
+			return nil
+		}
+		var m map[string]json.RawMessage
+		if err := json.Unmarshal(b, &m); err != nil {
+			return err
+		}
+		return unmarshalStruct(m, v, path)
+
+	case reflect.Slice:
+		if isNull {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		var l []json.RawMessage
+		if err := json.Unmarshal(b, &l); err != nil {
+			return err
+		}
+		newV := reflect.MakeSlice(v.Type(), len(l), len(l))
+		reflect.Copy(newV, v)
+		for i := range l {
+			err := unmarshalPath(l[i], newV.Index(i), indexPath(path, i))
+			if err != nil {
+				return err
+			}
+		}
+		v.Set(newV)
+		return nil
+
+	case reflect.Array:
+		if isNull {
+			return nil
+		}
+		var l []json.RawMessage
+		if err := json.Unmarshal(b, &l); err != nil {
+			return err
+		}
+		for i := 0; i < v.Len(); i++ {
+			if i >= len(l) {
+				v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+				continue
+			}
+			err := unmarshalPath(l[i], v.Index(i), indexPath(path, i))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		if isNull {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		var m map[string]json.RawMessage
+		if err := json.Unmarshal(b, &m); err != nil {
+			return err
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for key, raw := range m {
+			keyV := reflect.ValueOf(key).Convert(v.Type().Key())
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if existing := v.MapIndex(keyV); existing.IsValid() {
+				elem.Set(existing)
+			}
+			if err := unmarshalPath(raw, elem, joinPath(path, key)); err != nil {
+				return err
+			}
+			v.SetMapIndex(keyV, elem)
+		}
+		return nil
+	}
+
+	return json.Unmarshal(b, v.Addr().Interface())
+}
+
+func unmarshalStruct(
+	m map[string]json.RawMessage, v reflect.Value, path string,
+) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := fieldName(field)
+		if !ok {
+			continue
+		}
+
+		if isEmbedded(field) {
+			fieldV := v.Field(i)
+			if fieldV.Kind() == reflect.Ptr {
+				if fieldV.IsNil() && !fieldV.CanSet() {
+					continue
+				} else if fieldV.IsNil() {
+					fieldV.Set(reflect.New(field.Type.Elem()))
+				}
+				fieldV = fieldV.Elem()
+			}
+			if err := unmarshalStruct(m, fieldV, path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		raw, ok := m[name]
+		if !ok {
+			// encoding/json falls back to a case-insensitive match
+			for key := range m {
+				if strings.EqualFold(key, name) {
+					raw, ok = m[key], true
+					break
+				}
+			}
+		}
+		if !ok {
+			if d, ok := v.Field(i).Addr().Interface().(defaulter); ok {
+				d.applyDefault()
+			}
+			continue
+		}
+
+		err := unmarshalPath(raw, v.Field(i), joinPath(path, name))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldName returns the name the given struct field will have in json, or
+// false if it is never encoded in json
+func fieldName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	if field.PkgPath != "" && !isEmbedded(field) {
+		return "", false
+	}
+	if i := strings.Index(tag, ","); i >= 0 {
+		tag = tag[:i]
+	}
+	if tag != "" {
+		return tag, true
+	}
+	return field.Name, true
+}
+
+// isEmbedded returns whether the given struct field is an embedded struct
+// whose fields are treated as being part of the outer struct by encoding/json
+func isEmbedded(field reflect.StructField) bool {
+	if !field.Anonymous {
+		return false
+	}
+	if tag := field.Tag.Get("json"); tag != "" && tag[0] != ',' {
+		return false
+	}
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func indexPath(path string, i int) string {
+	return path + "[" + strconv.Itoa(i) + "]"
+}
+
+// wrapPathErr wraps the given error so that it contains the given path, if the
+// error is an ExpectedErr and the path isn't empty
+func wrapPathErr(err error, path string) error {
+	if eerr, ok := err.(common.ExpectedErr); ok && path != "" {
+		return ErrFieldInvalidf(path, eerr)
+	}
+	return err
+}
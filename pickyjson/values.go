@@ -0,0 +1,91 @@
+package pickyjson
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// UnmarshalValues unmarshals url.Values (e.g. a request's query parameters)
+// into the struct pointed to by i, the same way Unmarshal does with json. Each
+// of the struct's fields is filled in from the value with the field's json
+// name. Fields whose json form is a string (e.g. Str) are given the value
+// as-is, while any others (e.g. Int64) are given the value as a raw json
+// literal, so "?limit=10" works for an Int64 field. Slice fields are filled in
+// from all values with their name, e.g. "?tag=a&tag=b".
+//
+// Only the top-level fields of the struct are filled in, nested structs are not
+// supported
+func UnmarshalValues(vals url.Values, i interface{}) error {
+	v := reflect.ValueOf(i)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return errors.New("pickyjson: UnmarshalValues requires a pointer to a struct")
+	}
+	t := v.Elem().Type()
+
+	obj := map[string]json.RawMessage{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := fieldName(field)
+		if !ok {
+			continue
+		}
+		fieldVals, ok := lookupValues(vals, name)
+		if !ok {
+			continue
+		}
+
+		ft := field.Type
+		if ft.Kind() == reflect.Slice && ft.Elem().Kind() != reflect.Uint8 {
+			elems := make([]json.RawMessage, len(fieldVals))
+			for j := range fieldVals {
+				elems[j] = valueLiteral(fieldVals[j], ft.Elem())
+			}
+			obj[name], _ = json.Marshal(elems)
+		} else {
+			obj[name] = valueLiteral(fieldVals[0], ft)
+		}
+	}
+
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return Unmarshal(b, i)
+}
+
+// lookupValues returns the values for the given name, falling back to a case
+// insensitive match the way encoding/json does
+func lookupValues(vals url.Values, name string) ([]string, bool) {
+	if v, ok := vals[name]; ok && len(v) > 0 {
+		return v, true
+	}
+	for k, v := range vals {
+		if strings.EqualFold(k, name) && len(v) > 0 {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// valueLiteral returns the json literal which should be used for the given
+// value, based on what the json form of t looks like
+func valueLiteral(val string, t reflect.Type) json.RawMessage {
+	quoted, _ := json.Marshal(val)
+	if jsonIsString(t) || !json.Valid([]byte(val)) {
+		return quoted
+	}
+	return json.RawMessage(val)
+}
+
+// jsonIsString returns whether the json form of the zero value of t is a
+// string
+func jsonIsString(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	b, err := json.Marshal(reflect.New(t).Interface())
+	return err == nil && len(b) > 0 && b[0] == '"'
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/common/config"
+	"github.com/mediocregopher/mediocre-api/prefab/grpc/grpcapi"
+	"github.com/mediocregopher/mediocre-api/room"
+	"github.com/mediocregopher/mediocre-api/room/broadcast"
+	"github.com/mediocregopher/mediocre-api/user"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func main() {
+	c := config.New("core")
+	c.AddListenAddr(":9090")
+	c.AddTLS()
+	c.AddSecret()
+	c.AddRedis()
+	c.AddLogging()
+	c.Add(config.Param{
+		Name:        "check-in-period",
+		Description: "How long a user stays in a room after checking in, unless they check in again",
+		Default:     "30s",
+	})
+	c.Add(config.Param{
+		Name:        "aliveness-period",
+		Description: "How long a broadcast stays active without a heartbeat before it's considered dead. Rounded down to the second",
+		Default:     "30s",
+	})
+	c.ParseOrExit()
+
+	if _, err := c.Logging(); err != nil {
+		log.Fatal(err)
+	}
+
+	checkInPeriod, err := c.Duration("check-in-period")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	aliveness, err := c.Duration("aliveness-period")
+	if err != nil {
+		log.Fatal(err)
+	} else if aliveness < time.Second {
+		log.Fatal("--aliveness-period must be at least 1s")
+	}
+
+	shutdownTimeout, err := c.Duration("shutdown-timeout")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var opts []grpc.ServerOption
+	if tc, err := c.TLS(); err != nil {
+		log.Fatal(err)
+	} else if tc != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tc)))
+	}
+
+	cmder, err := c.Redis()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The same names the user prefab bans are banned here, so that users
+	// created through either can be used through the other
+	us := user.New(cmder)
+	us.BannedUsernames = append(us.BannedUsernames, "healthz", "readyz", "admin", "openapi.json")
+
+	rs := room.New(cmder, &room.Opts{CheckInPeriod: checkInPeriod})
+	defer rs.Stop()
+
+	// The broadcast secret is optional, without it Start doesn't return
+	// signatures and Verify always fails
+	bs := broadcast.New(cmder)
+	if secret := c.Str("secret"); secret != "" {
+		bs.Secret = []byte(secret)
+	}
+	bs.AlivenessPeriod = int(aliveness / time.Second)
+
+	srv := grpc.NewServer(opts...)
+	grpcapi.Register(srv, us, rs, bs)
+
+	h := common.NewHealth()
+	h.Add("redis", common.CmderCheck(cmder))
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+	go watchHealth(hs, h, 5*time.Second)
+
+	l, err := net.Listen("tcp", c.ListenAddr())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Printf("listening on %s", l.Addr())
+		errCh <- srv.Serve(l)
+	}()
+
+	select {
+	case err := <-errCh:
+		log.Fatal(err)
+	case sig := <-sigCh:
+		log.Printf("got %s, shutting down (timeout %s)", sig, shutdownTimeout)
+	}
+
+	// GracefulStop waits for all in-flight calls to complete, so if they
+	// haven't by the timeout they're cut off
+	hs.Shutdown()
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(shutdownTimeout):
+		srv.Stop()
+	}
+}
+
+// watchHealth periodically runs the given Health's checks, and sets the
+// overall serving status of the given health.Server based on whether they all
+// passed
+func watchHealth(hs *health.Server, h *common.Health, period time.Duration) {
+	for {
+		st := healthpb.HealthCheckResponse_SERVING
+		for name, err := range h.Check() {
+			if err != nil {
+				log.Printf("health check %q failed: %s", name, err)
+				st = healthpb.HealthCheckResponse_NOT_SERVING
+			}
+		}
+		hs.SetServingStatus("", st)
+		time.Sleep(period)
+	}
+}
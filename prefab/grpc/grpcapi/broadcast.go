@@ -0,0 +1,81 @@
+package grpcapi
+
+import (
+	"context"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/prefab/grpc/mediocrepb"
+	"github.com/mediocregopher/mediocre-api/room/broadcast"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// ErrNotBroadcasting is returned from BroadcastServer's Get when the user
+// isn't currently broadcasting
+var ErrNotBroadcasting = common.ExpectedErr{Code: 404, ID: "not_broadcasting", Err: "user is not broadcasting"}
+
+// BroadcastServer implements mediocrepb.BroadcastServiceServer using a
+// broadcast.System
+type BroadcastServer struct {
+	mediocrepb.UnimplementedBroadcastServiceServer
+	s *broadcast.System
+}
+
+// NewBroadcastServer returns a BroadcastServer backed by the given
+// broadcast.System
+func NewBroadcastServer(s *broadcast.System) *BroadcastServer {
+	return &BroadcastServer{s: s}
+}
+
+// Start implements the mediocrepb.BroadcastServiceServer interface
+func (bs *BroadcastServer) Start(ctx context.Context, req *mediocrepb.StartBroadcastRequest) (*mediocrepb.Broadcast, error) {
+	if req.User == "" {
+		return nil, grpcErr(ErrNoUser)
+	}
+	id, sig, err := bs.s.StartBroadcast(req.User)
+	if err != nil {
+		return nil, grpcErr(err)
+	}
+	return &mediocrepb.Broadcast{Id: string(id), User: req.User, Signature: sig}, nil
+}
+
+// StillAlive implements the mediocrepb.BroadcastServiceServer interface
+func (bs *BroadcastServer) StillAlive(ctx context.Context, req *mediocrepb.BroadcastRequest) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, grpcErr(bs.s.StillAlive(broadcast.ID(req.Id)))
+}
+
+// End implements the mediocrepb.BroadcastServiceServer interface
+func (bs *BroadcastServer) End(ctx context.Context, req *mediocrepb.BroadcastRequest) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, grpcErr(bs.s.Ended(broadcast.ID(req.Id)))
+}
+
+// Get implements the mediocrepb.BroadcastServiceServer interface
+func (bs *BroadcastServer) Get(ctx context.Context, req *mediocrepb.GetBroadcastRequest) (*mediocrepb.Broadcast, error) {
+	id, err := bs.s.GetBroadcastID(req.User)
+	if err != nil {
+		return nil, grpcErr(err)
+	} else if id == "" {
+		return nil, grpcErr(ErrNotBroadcasting)
+	}
+	return &mediocrepb.Broadcast{Id: string(id), User: id.User()}, nil
+}
+
+// Active implements the mediocrepb.BroadcastServiceServer interface
+func (bs *BroadcastServer) Active(ctx context.Context, _ *emptypb.Empty) (*mediocrepb.ActiveResponse, error) {
+	ids, err := bs.s.Active()
+	if err != nil {
+		return nil, grpcErr(err)
+	}
+	res := &mediocrepb.ActiveResponse{
+		Broadcasts: make([]*mediocrepb.Broadcast, len(ids)),
+	}
+	for i, id := range ids {
+		res.Broadcasts[i] = &mediocrepb.Broadcast{Id: string(id), User: id.User()}
+	}
+	return res, nil
+}
+
+// Verify implements the mediocrepb.BroadcastServiceServer interface
+func (bs *BroadcastServer) Verify(ctx context.Context, req *mediocrepb.VerifyRequest) (*mediocrepb.VerifyResponse, error) {
+	valid := bs.s.Verify(broadcast.ID(req.Id), req.Signature)
+	return &mediocrepb.VerifyResponse{Valid: valid}, nil
+}
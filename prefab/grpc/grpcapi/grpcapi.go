@@ -0,0 +1,111 @@
+// Package grpcapi implements the gRPC services described in the mediocrepb
+// package on top of the core Systems, so that internal services can use them
+// directly rather than going through shield and the REST prefabs. No
+// authentication is done, callers are trusted to only act on behalf of users
+// they've authenticated themselves
+package grpcapi
+
+import (
+	"encoding/json"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/pickyjson"
+	"github.com/mediocregopher/mediocre-api/prefab/grpc/mediocrepb"
+	"github.com/mediocregopher/mediocre-api/room"
+	"github.com/mediocregopher/mediocre-api/room/broadcast"
+	"github.com/mediocregopher/mediocre-api/user"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorDomain is the Domain of the errdetails.ErrorInfo attached to every
+// error returned for a common.ExpectedErr. The ErrorInfo's Reason is the
+// ExpectedErr's ID
+const ErrorDomain = "mediocre-api"
+
+// Register registers the servers for all of the given Systems with the given
+// grpc.Server. Any of the Systems may be nil, in which case that service isn't
+// registered
+func Register(srv *grpc.Server, us *user.System, rs *room.System, bs *broadcast.System) {
+	if us != nil {
+		mediocrepb.RegisterUserServiceServer(srv, NewUserServer(us))
+	}
+	if rs != nil {
+		mediocrepb.RegisterRoomServiceServer(srv, NewRoomServer(rs))
+	}
+	if bs != nil {
+		mediocrepb.RegisterBroadcastServiceServer(srv, NewBroadcastServer(bs))
+	}
+}
+
+// codeFor returns the grpc code corresponding to the given http status code
+func codeFor(httpCode int) codes.Code {
+	switch httpCode {
+	case 400:
+		return codes.InvalidArgument
+	case 401:
+		return codes.Unauthenticated
+	case 403:
+		return codes.PermissionDenied
+	case 404:
+		return codes.NotFound
+	case 409:
+		return codes.AlreadyExists
+	case 429:
+		return codes.ResourceExhausted
+	case 503:
+		return codes.Unavailable
+	}
+	return codes.Internal
+}
+
+// grpcErr converts the given error into one suitable for returning from a grpc
+// method. An ExpectedErr is returned with the grpc code corresponding to its
+// http Code and its ID attached as an errdetails.ErrorInfo. Any other error is
+// logged to common.Log and an INTERNAL error is returned in its place, the same
+// as common.HTTPError would do
+func grpcErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	eerr, ok := common.AsExpected(err)
+	if !ok {
+		if common.Log != nil {
+			common.Log.Printf("grpc: %s", err)
+		}
+		eerr = common.ErrUnknown
+	} else if cause := eerr.Unwrap(); cause != nil && common.Log != nil {
+		common.Log.Printf("grpc: %s: %s", eerr.Error(), cause)
+	}
+
+	st := status.New(codeFor(eerr.Code), eerr.Err)
+	if eerr.ID != "" {
+		if withInfo, err := st.WithDetails(&errdetails.ErrorInfo{
+			Reason: eerr.ID,
+			Domain: ErrorDomain,
+		}); err == nil {
+			st = withInfo
+		}
+	}
+	return st.Err()
+}
+
+// checkStr checks the given value against the constraints of the given
+// pickyjson.Str, the same way they're checked when the value is given in a
+// json request to one of the REST prefabs, and returns the value as it would
+// be filled in (e.g. a normalized email address)
+func checkStr(name string, s pickyjson.Str, val string) (string, error) {
+	b, err := json.Marshal(val)
+	if err != nil {
+		return "", err
+	}
+	if err := s.UnmarshalJSON(b); err != nil {
+		if eerr, ok := common.AsExpected(err); ok {
+			return "", pickyjson.ErrFieldInvalidf(name, eerr)
+		}
+		return "", err
+	}
+	return s.Str, nil
+}
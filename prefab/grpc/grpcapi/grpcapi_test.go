@@ -0,0 +1,181 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	. "testing"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/mediocregopher/mediocre-api/prefab/grpc/mediocrepb"
+	"github.com/mediocregopher/mediocre-api/room"
+	"github.com/mediocregopher/mediocre-api/room/broadcast"
+	"github.com/mediocregopher/mediocre-api/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+var testConn = func() *grpc.ClientConn {
+	cmder := commontest.APIStarterKit()
+	us := user.New(cmder)
+	us.Prefix = commontest.RandStr()
+	us.BCryptCost = 4
+	rs := room.New(cmder, &room.Opts{
+		Prefix:        commontest.RandStr(),
+		CheckInPeriod: 1 * time.Second,
+	})
+	bs := broadcast.New(cmder)
+	bs.Prefix = commontest.RandStr()
+	bs.Secret = []byte("turtles")
+
+	srv := grpc.NewServer()
+	Register(srv, us, rs, bs)
+	l := bufconn.Listen(1024 * 1024)
+	go srv.Serve(l)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return l.Dial()
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		panic(err)
+	}
+	return conn
+}()
+
+func assertCode(t *T, err error, code codes.Code, reason string) {
+	st, ok := status.FromError(err)
+	require.True(t, ok, "not a status error: %v", err)
+	assert.Equal(t, code, st.Code())
+	var gotReason string
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			assert.Equal(t, ErrorDomain, info.Domain)
+			gotReason = info.Reason
+		}
+	}
+	assert.Equal(t, reason, gotReason)
+}
+
+func TestUser(t *T) {
+	ctx := context.Background()
+	c := mediocrepb.NewUserServiceClient(testConn)
+	u := commontest.RandStr()
+
+	_, err := c.Create(ctx, &mediocrepb.CreateUserRequest{
+		User: u, Email: commontest.RandEmail(), Password: "short",
+	})
+	assertCode(t, err, codes.InvalidArgument, "too_short")
+
+	_, err = c.Create(ctx, &mediocrepb.CreateUserRequest{
+		User: u, Email: commontest.RandEmail(), Password: "password",
+	})
+	require.Nil(t, err)
+	_, err = c.Create(ctx, &mediocrepb.CreateUserRequest{
+		User: u, Email: commontest.RandEmail(), Password: "password",
+	})
+	assertCode(t, err, codes.InvalidArgument, user.ErrUserExists.ID)
+
+	_, err = c.Authenticate(ctx, &mediocrepb.AuthenticateRequest{User: u, Password: "password"})
+	assert.Nil(t, err)
+	_, err = c.Authenticate(ctx, &mediocrepb.AuthenticateRequest{User: u, Password: "wrong"})
+	assertCode(t, err, codes.InvalidArgument, user.ErrBadAuth.ID)
+
+	res, err := c.Get(ctx, &mediocrepb.GetUserRequest{User: u})
+	require.Nil(t, err)
+	assert.Equal(t, u, res.Info["Name"])
+	assert.NotContains(t, res.Info, "Email")
+
+	_, err = c.Set(ctx, &mediocrepb.SetUserRequest{User: u, Info: map[string]string{"Email": "foo@example.com"}})
+	require.Nil(t, err)
+	res, err = c.Get(ctx, &mediocrepb.GetUserRequest{User: u, Private: true})
+	require.Nil(t, err)
+	assert.Equal(t, "foo@example.com", res.Info["Email"])
+
+	_, err = c.Disable(ctx, &mediocrepb.UserRequest{User: u})
+	require.Nil(t, err)
+	_, err = c.Authenticate(ctx, &mediocrepb.AuthenticateRequest{User: u, Password: "password"})
+	assertCode(t, err, codes.InvalidArgument, user.ErrDisabled.ID)
+
+	_, err = c.Delete(ctx, &mediocrepb.UserRequest{User: u})
+	require.Nil(t, err)
+	_, err = c.Get(ctx, &mediocrepb.GetUserRequest{User: u})
+	assertCode(t, err, codes.NotFound, user.ErrNotFound.ID)
+	_, err = c.Enable(ctx, &mediocrepb.UserRequest{User: u})
+	assertCode(t, err, codes.NotFound, user.ErrNotFound.ID)
+}
+
+func TestRoom(t *T) {
+	ctx := context.Background()
+	c := mediocrepb.NewRoomServiceClient(testConn)
+	rm, u := commontest.RandStr(), commontest.RandStr()
+
+	_, err := c.CheckIn(ctx, &mediocrepb.RoomMemberRequest{Room: rm})
+	assertCode(t, err, codes.InvalidArgument, ErrNoUser.ID)
+
+	_, err = c.CheckIn(ctx, &mediocrepb.RoomMemberRequest{Room: rm, User: u})
+	require.Nil(t, err)
+	members, err := c.Members(ctx, &mediocrepb.RoomRequest{Room: rm})
+	require.Nil(t, err)
+	assert.Equal(t, []string{u}, members.Users)
+	card, err := c.Cardinality(ctx, &mediocrepb.RoomRequest{Room: rm})
+	require.Nil(t, err)
+	assert.Equal(t, int64(1), card.Cardinality)
+
+	_, err = c.CheckOut(ctx, &mediocrepb.RoomMemberRequest{Room: rm, User: u})
+	require.Nil(t, err)
+	card, err = c.Cardinality(ctx, &mediocrepb.RoomRequest{Room: rm})
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), card.Cardinality)
+}
+
+func TestBroadcast(t *T) {
+	ctx := context.Background()
+	c := mediocrepb.NewBroadcastServiceClient(testConn)
+	u := commontest.RandStr()
+
+	_, err := c.Get(ctx, &mediocrepb.GetBroadcastRequest{User: u})
+	assertCode(t, err, codes.NotFound, ErrNotBroadcasting.ID)
+
+	b, err := c.Start(ctx, &mediocrepb.StartBroadcastRequest{User: u})
+	require.Nil(t, err)
+	assert.Equal(t, u, b.User)
+	assert.NotEmpty(t, b.Signature)
+	_, err = c.Start(ctx, &mediocrepb.StartBroadcastRequest{User: u})
+	assertCode(t, err, codes.InvalidArgument, broadcast.ErrUserIsBroadcasting.ID)
+
+	v, err := c.Verify(ctx, &mediocrepb.VerifyRequest{Id: b.Id, Signature: b.Signature})
+	require.Nil(t, err)
+	assert.True(t, v.Valid)
+	v, err = c.Verify(ctx, &mediocrepb.VerifyRequest{Id: b.Id, Signature: "nope"})
+	require.Nil(t, err)
+	assert.False(t, v.Valid)
+
+	got, err := c.Get(ctx, &mediocrepb.GetBroadcastRequest{User: u})
+	require.Nil(t, err)
+	assert.Equal(t, b.Id, got.Id)
+
+	active, err := c.Active(ctx, &emptypb.Empty{})
+	require.Nil(t, err)
+	var found bool
+	for _, ab := range active.Broadcasts {
+		found = found || ab.Id == b.Id
+	}
+	assert.True(t, found)
+
+	_, err = c.StillAlive(ctx, &mediocrepb.BroadcastRequest{Id: b.Id})
+	require.Nil(t, err)
+	_, err = c.End(ctx, &mediocrepb.BroadcastRequest{Id: b.Id})
+	require.Nil(t, err)
+	_, err = c.StillAlive(ctx, &mediocrepb.BroadcastRequest{Id: b.Id})
+	assertCode(t, err, codes.InvalidArgument, broadcast.ErrBroadcastEnded.ID)
+}
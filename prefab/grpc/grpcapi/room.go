@@ -0,0 +1,59 @@
+package grpcapi
+
+import (
+	"context"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/prefab/grpc/mediocrepb"
+	"github.com/mediocregopher/mediocre-api/room"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// ErrNoUser is returned when checking in or out of a room without giving a
+// user
+var ErrNoUser = common.ExpectedErr{Code: 400, ID: "no_user", Err: "user must be given"}
+
+// RoomServer implements mediocrepb.RoomServiceServer using a room.System
+type RoomServer struct {
+	mediocrepb.UnimplementedRoomServiceServer
+	s *room.System
+}
+
+// NewRoomServer returns a RoomServer backed by the given room.System
+func NewRoomServer(s *room.System) *RoomServer {
+	return &RoomServer{s: s}
+}
+
+// CheckIn implements the mediocrepb.RoomServiceServer interface
+func (rs *RoomServer) CheckIn(ctx context.Context, req *mediocrepb.RoomMemberRequest) (*emptypb.Empty, error) {
+	if req.User == "" {
+		return nil, grpcErr(ErrNoUser)
+	}
+	return &emptypb.Empty{}, grpcErr(rs.s.CheckIn(req.Room, req.User))
+}
+
+// CheckOut implements the mediocrepb.RoomServiceServer interface
+func (rs *RoomServer) CheckOut(ctx context.Context, req *mediocrepb.RoomMemberRequest) (*emptypb.Empty, error) {
+	if req.User == "" {
+		return nil, grpcErr(ErrNoUser)
+	}
+	return &emptypb.Empty{}, grpcErr(rs.s.CheckOut(req.Room, req.User))
+}
+
+// Members implements the mediocrepb.RoomServiceServer interface
+func (rs *RoomServer) Members(ctx context.Context, req *mediocrepb.RoomRequest) (*mediocrepb.MembersResponse, error) {
+	users, err := rs.s.Members(req.Room)
+	if err != nil {
+		return nil, grpcErr(err)
+	}
+	return &mediocrepb.MembersResponse{Users: users}, nil
+}
+
+// Cardinality implements the mediocrepb.RoomServiceServer interface
+func (rs *RoomServer) Cardinality(ctx context.Context, req *mediocrepb.RoomRequest) (*mediocrepb.CardinalityResponse, error) {
+	n, err := rs.s.Cardinality(req.Room)
+	if err != nil {
+		return nil, grpcErr(err)
+	}
+	return &mediocrepb.CardinalityResponse{Cardinality: n}, nil
+}
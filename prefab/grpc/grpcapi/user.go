@@ -0,0 +1,100 @@
+package grpcapi
+
+import (
+	"context"
+
+	"github.com/mediocregopher/mediocre-api/pickyjson"
+	"github.com/mediocregopher/mediocre-api/prefab/grpc/mediocrepb"
+	"github.com/mediocregopher/mediocre-api/user"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// passwordParam matches the constraints the user prefab puts on passwords
+var passwordParam = pickyjson.Str{
+	MinLength: 6,
+	MaxLength: 255,
+}
+
+// UserServer implements mediocrepb.UserServiceServer using a user.System
+type UserServer struct {
+	mediocrepb.UnimplementedUserServiceServer
+	s *user.System
+}
+
+// NewUserServer returns a UserServer backed by the given user.System
+func NewUserServer(s *user.System) *UserServer {
+	return &UserServer{s: s}
+}
+
+// Create implements the mediocrepb.UserServiceServer interface
+func (us *UserServer) Create(ctx context.Context, req *mediocrepb.CreateUserRequest) (*emptypb.Empty, error) {
+	u, err := checkStr("user", pickyjson.Username.Required(), req.User)
+	if err != nil {
+		return nil, grpcErr(err)
+	}
+	email, err := checkStr("email", pickyjson.Email.Required(), req.Email)
+	if err != nil {
+		return nil, grpcErr(err)
+	}
+	password, err := checkStr("password", passwordParam.Required(), req.Password)
+	if err != nil {
+		return nil, grpcErr(err)
+	}
+	return &emptypb.Empty{}, grpcErr(us.s.Create(u, email, password))
+}
+
+// Authenticate implements the mediocrepb.UserServiceServer interface
+func (us *UserServer) Authenticate(ctx context.Context, req *mediocrepb.AuthenticateRequest) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, grpcErr(us.s.Authenticate(req.User, req.Password))
+}
+
+// Get implements the mediocrepb.UserServiceServer interface
+func (us *UserServer) Get(ctx context.Context, req *mediocrepb.GetUserRequest) (*mediocrepb.GetUserResponse, error) {
+	var filter user.FieldFlag
+	if req.Private {
+		filter |= user.Private
+	}
+	i, err := us.s.Get(req.User, filter)
+	if err != nil {
+		return nil, grpcErr(err)
+	}
+	return &mediocrepb.GetUserResponse{Info: i}, nil
+}
+
+// Set implements the mediocrepb.UserServiceServer interface
+func (us *UserServer) Set(ctx context.Context, req *mediocrepb.SetUserRequest) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, grpcErr(us.s.Set(req.User, req.Info))
+}
+
+// ChangePassword implements the mediocrepb.UserServiceServer interface
+func (us *UserServer) ChangePassword(ctx context.Context, req *mediocrepb.ChangePasswordRequest) (*emptypb.Empty, error) {
+	password, err := checkStr("new_password", passwordParam.Required(), req.NewPassword)
+	if err != nil {
+		return nil, grpcErr(err)
+	}
+	return &emptypb.Empty{}, grpcErr(us.s.ChangePassword(req.User, password))
+}
+
+// existing calls the given function with the request's user, but only after
+// checking that the user exists, since user.System's Disable and Enable don't
+func (us *UserServer) existing(req *mediocrepb.UserRequest, fn func(string) error) (*emptypb.Empty, error) {
+	if _, err := us.s.Get(req.User, user.Public); err != nil {
+		return nil, grpcErr(err)
+	}
+	return &emptypb.Empty{}, grpcErr(fn(req.User))
+}
+
+// Disable implements the mediocrepb.UserServiceServer interface
+func (us *UserServer) Disable(ctx context.Context, req *mediocrepb.UserRequest) (*emptypb.Empty, error) {
+	return us.existing(req, us.s.Disable)
+}
+
+// Enable implements the mediocrepb.UserServiceServer interface
+func (us *UserServer) Enable(ctx context.Context, req *mediocrepb.UserRequest) (*emptypb.Empty, error) {
+	return us.existing(req, us.s.Enable)
+}
+
+// Delete implements the mediocrepb.UserServiceServer interface
+func (us *UserServer) Delete(ctx context.Context, req *mediocrepb.UserRequest) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, grpcErr(us.s.Delete(req.User))
+}
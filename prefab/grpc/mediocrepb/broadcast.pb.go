@@ -0,0 +1,458 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: broadcast.proto
+
+package mediocrepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Broadcast describes a single broadcast. signature is only set when returned
+// by Start, and only if the server has a secret to sign broadcasts with
+type Broadcast struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	User          string                 `protobuf:"bytes,2,opt,name=user,proto3" json:"user,omitempty"`
+	Signature     string                 `protobuf:"bytes,3,opt,name=signature,proto3" json:"signature,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Broadcast) Reset() {
+	*x = Broadcast{}
+	mi := &file_broadcast_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Broadcast) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Broadcast) ProtoMessage() {}
+
+func (x *Broadcast) ProtoReflect() protoreflect.Message {
+	mi := &file_broadcast_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Broadcast.ProtoReflect.Descriptor instead.
+func (*Broadcast) Descriptor() ([]byte, []int) {
+	return file_broadcast_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Broadcast) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Broadcast) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+func (x *Broadcast) GetSignature() string {
+	if x != nil {
+		return x.Signature
+	}
+	return ""
+}
+
+type StartBroadcastRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	User          string                 `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StartBroadcastRequest) Reset() {
+	*x = StartBroadcastRequest{}
+	mi := &file_broadcast_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StartBroadcastRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StartBroadcastRequest) ProtoMessage() {}
+
+func (x *StartBroadcastRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_broadcast_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StartBroadcastRequest.ProtoReflect.Descriptor instead.
+func (*StartBroadcastRequest) Descriptor() ([]byte, []int) {
+	return file_broadcast_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *StartBroadcastRequest) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+type BroadcastRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BroadcastRequest) Reset() {
+	*x = BroadcastRequest{}
+	mi := &file_broadcast_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BroadcastRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BroadcastRequest) ProtoMessage() {}
+
+func (x *BroadcastRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_broadcast_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BroadcastRequest.ProtoReflect.Descriptor instead.
+func (*BroadcastRequest) Descriptor() ([]byte, []int) {
+	return file_broadcast_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *BroadcastRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type GetBroadcastRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	User          string                 `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetBroadcastRequest) Reset() {
+	*x = GetBroadcastRequest{}
+	mi := &file_broadcast_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetBroadcastRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetBroadcastRequest) ProtoMessage() {}
+
+func (x *GetBroadcastRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_broadcast_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetBroadcastRequest.ProtoReflect.Descriptor instead.
+func (*GetBroadcastRequest) Descriptor() ([]byte, []int) {
+	return file_broadcast_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetBroadcastRequest) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+type ActiveResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Broadcasts    []*Broadcast           `protobuf:"bytes,1,rep,name=broadcasts,proto3" json:"broadcasts,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ActiveResponse) Reset() {
+	*x = ActiveResponse{}
+	mi := &file_broadcast_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ActiveResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ActiveResponse) ProtoMessage() {}
+
+func (x *ActiveResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_broadcast_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ActiveResponse.ProtoReflect.Descriptor instead.
+func (*ActiveResponse) Descriptor() ([]byte, []int) {
+	return file_broadcast_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ActiveResponse) GetBroadcasts() []*Broadcast {
+	if x != nil {
+		return x.Broadcasts
+	}
+	return nil
+}
+
+type VerifyRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Signature     string                 `protobuf:"bytes,2,opt,name=signature,proto3" json:"signature,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VerifyRequest) Reset() {
+	*x = VerifyRequest{}
+	mi := &file_broadcast_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VerifyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VerifyRequest) ProtoMessage() {}
+
+func (x *VerifyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_broadcast_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VerifyRequest.ProtoReflect.Descriptor instead.
+func (*VerifyRequest) Descriptor() ([]byte, []int) {
+	return file_broadcast_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *VerifyRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *VerifyRequest) GetSignature() string {
+	if x != nil {
+		return x.Signature
+	}
+	return ""
+}
+
+type VerifyResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Valid         bool                   `protobuf:"varint,1,opt,name=valid,proto3" json:"valid,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VerifyResponse) Reset() {
+	*x = VerifyResponse{}
+	mi := &file_broadcast_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VerifyResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VerifyResponse) ProtoMessage() {}
+
+func (x *VerifyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_broadcast_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VerifyResponse.ProtoReflect.Descriptor instead.
+func (*VerifyResponse) Descriptor() ([]byte, []int) {
+	return file_broadcast_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *VerifyResponse) GetValid() bool {
+	if x != nil {
+		return x.Valid
+	}
+	return false
+}
+
+var File_broadcast_proto protoreflect.FileDescriptor
+
+const file_broadcast_proto_rawDesc = "" +
+	"\n" +
+	"\x0fbroadcast.proto\x12\bmediocre\x1a\x1bgoogle/protobuf/empty.proto\"M\n" +
+	"\tBroadcast\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04user\x18\x02 \x01(\tR\x04user\x12\x1c\n" +
+	"\tsignature\x18\x03 \x01(\tR\tsignature\"+\n" +
+	"\x15StartBroadcastRequest\x12\x12\n" +
+	"\x04user\x18\x01 \x01(\tR\x04user\"\"\n" +
+	"\x10BroadcastRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\")\n" +
+	"\x13GetBroadcastRequest\x12\x12\n" +
+	"\x04user\x18\x01 \x01(\tR\x04user\"E\n" +
+	"\x0eActiveResponse\x123\n" +
+	"\n" +
+	"broadcasts\x18\x01 \x03(\v2\x13.mediocre.BroadcastR\n" +
+	"broadcasts\"=\n" +
+	"\rVerifyRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1c\n" +
+	"\tsignature\x18\x02 \x01(\tR\tsignature\"&\n" +
+	"\x0eVerifyResponse\x12\x14\n" +
+	"\x05valid\x18\x01 \x01(\bR\x05valid2\x82\x03\n" +
+	"\x10BroadcastService\x12=\n" +
+	"\x05Start\x12\x1f.mediocre.StartBroadcastRequest\x1a\x13.mediocre.Broadcast\x12@\n" +
+	"\n" +
+	"StillAlive\x12\x1a.mediocre.BroadcastRequest\x1a\x16.google.protobuf.Empty\x129\n" +
+	"\x03End\x12\x1a.mediocre.BroadcastRequest\x1a\x16.google.protobuf.Empty\x129\n" +
+	"\x03Get\x12\x1d.mediocre.GetBroadcastRequest\x1a\x13.mediocre.Broadcast\x12:\n" +
+	"\x06Active\x12\x16.google.protobuf.Empty\x1a\x18.mediocre.ActiveResponse\x12;\n" +
+	"\x06Verify\x12\x17.mediocre.VerifyRequest\x1a\x18.mediocre.VerifyResponseB?Z=github.com/mediocregopher/mediocre-api/prefab/grpc/mediocrepbb\x06proto3"
+
+var (
+	file_broadcast_proto_rawDescOnce sync.Once
+	file_broadcast_proto_rawDescData []byte
+)
+
+func file_broadcast_proto_rawDescGZIP() []byte {
+	file_broadcast_proto_rawDescOnce.Do(func() {
+		file_broadcast_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_broadcast_proto_rawDesc), len(file_broadcast_proto_rawDesc)))
+	})
+	return file_broadcast_proto_rawDescData
+}
+
+var file_broadcast_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_broadcast_proto_goTypes = []any{
+	(*Broadcast)(nil),             // 0: mediocre.Broadcast
+	(*StartBroadcastRequest)(nil), // 1: mediocre.StartBroadcastRequest
+	(*BroadcastRequest)(nil),      // 2: mediocre.BroadcastRequest
+	(*GetBroadcastRequest)(nil),   // 3: mediocre.GetBroadcastRequest
+	(*ActiveResponse)(nil),        // 4: mediocre.ActiveResponse
+	(*VerifyRequest)(nil),         // 5: mediocre.VerifyRequest
+	(*VerifyResponse)(nil),        // 6: mediocre.VerifyResponse
+	(*emptypb.Empty)(nil),         // 7: google.protobuf.Empty
+}
+var file_broadcast_proto_depIdxs = []int32{
+	0, // 0: mediocre.ActiveResponse.broadcasts:type_name -> mediocre.Broadcast
+	1, // 1: mediocre.BroadcastService.Start:input_type -> mediocre.StartBroadcastRequest
+	2, // 2: mediocre.BroadcastService.StillAlive:input_type -> mediocre.BroadcastRequest
+	2, // 3: mediocre.BroadcastService.End:input_type -> mediocre.BroadcastRequest
+	3, // 4: mediocre.BroadcastService.Get:input_type -> mediocre.GetBroadcastRequest
+	7, // 5: mediocre.BroadcastService.Active:input_type -> google.protobuf.Empty
+	5, // 6: mediocre.BroadcastService.Verify:input_type -> mediocre.VerifyRequest
+	0, // 7: mediocre.BroadcastService.Start:output_type -> mediocre.Broadcast
+	7, // 8: mediocre.BroadcastService.StillAlive:output_type -> google.protobuf.Empty
+	7, // 9: mediocre.BroadcastService.End:output_type -> google.protobuf.Empty
+	0, // 10: mediocre.BroadcastService.Get:output_type -> mediocre.Broadcast
+	4, // 11: mediocre.BroadcastService.Active:output_type -> mediocre.ActiveResponse
+	6, // 12: mediocre.BroadcastService.Verify:output_type -> mediocre.VerifyResponse
+	7, // [7:13] is the sub-list for method output_type
+	1, // [1:7] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_broadcast_proto_init() }
+func file_broadcast_proto_init() {
+	if File_broadcast_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_broadcast_proto_rawDesc), len(file_broadcast_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_broadcast_proto_goTypes,
+		DependencyIndexes: file_broadcast_proto_depIdxs,
+		MessageInfos:      file_broadcast_proto_msgTypes,
+	}.Build()
+	File_broadcast_proto = out.File
+	file_broadcast_proto_goTypes = nil
+	file_broadcast_proto_depIdxs = nil
+}
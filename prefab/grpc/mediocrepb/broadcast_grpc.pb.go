@@ -0,0 +1,336 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: broadcast.proto
+
+package mediocrepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	BroadcastService_Start_FullMethodName      = "/mediocre.BroadcastService/Start"
+	BroadcastService_StillAlive_FullMethodName = "/mediocre.BroadcastService/StillAlive"
+	BroadcastService_End_FullMethodName        = "/mediocre.BroadcastService/End"
+	BroadcastService_Get_FullMethodName        = "/mediocre.BroadcastService/Get"
+	BroadcastService_Active_FullMethodName     = "/mediocre.BroadcastService/Active"
+	BroadcastService_Verify_FullMethodName     = "/mediocre.BroadcastService/Verify"
+)
+
+// BroadcastServiceClient is the client API for BroadcastService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// BroadcastService exposes a broadcast.System
+type BroadcastServiceClient interface {
+	// Start starts a new broadcast for the user. Fails with INVALID_ARGUMENT if
+	// they're already broadcasting
+	Start(ctx context.Context, in *StartBroadcastRequest, opts ...grpc.CallOption) (*Broadcast, error)
+	// StillAlive records that the broadcast is still going. Fails with
+	// INVALID_ARGUMENT if it has already ended
+	StillAlive(ctx context.Context, in *BroadcastRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// End records that the broadcast has ended
+	End(ctx context.Context, in *BroadcastRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// Get returns the user's current broadcast. Fails with NOT_FOUND if they
+	// aren't broadcasting
+	Get(ctx context.Context, in *GetBroadcastRequest, opts ...grpc.CallOption) (*Broadcast, error)
+	// Active returns all broadcasts which are currently going
+	Active(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ActiveResponse, error)
+	// Verify checks that the signature is the one returned by Start for the
+	// broadcast
+	Verify(ctx context.Context, in *VerifyRequest, opts ...grpc.CallOption) (*VerifyResponse, error)
+}
+
+type broadcastServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBroadcastServiceClient(cc grpc.ClientConnInterface) BroadcastServiceClient {
+	return &broadcastServiceClient{cc}
+}
+
+func (c *broadcastServiceClient) Start(ctx context.Context, in *StartBroadcastRequest, opts ...grpc.CallOption) (*Broadcast, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Broadcast)
+	err := c.cc.Invoke(ctx, BroadcastService_Start_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *broadcastServiceClient) StillAlive(ctx context.Context, in *BroadcastRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, BroadcastService_StillAlive_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *broadcastServiceClient) End(ctx context.Context, in *BroadcastRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, BroadcastService_End_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *broadcastServiceClient) Get(ctx context.Context, in *GetBroadcastRequest, opts ...grpc.CallOption) (*Broadcast, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Broadcast)
+	err := c.cc.Invoke(ctx, BroadcastService_Get_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *broadcastServiceClient) Active(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ActiveResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ActiveResponse)
+	err := c.cc.Invoke(ctx, BroadcastService_Active_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *broadcastServiceClient) Verify(ctx context.Context, in *VerifyRequest, opts ...grpc.CallOption) (*VerifyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(VerifyResponse)
+	err := c.cc.Invoke(ctx, BroadcastService_Verify_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// BroadcastServiceServer is the server API for BroadcastService service.
+// All implementations must embed UnimplementedBroadcastServiceServer
+// for forward compatibility.
+//
+// BroadcastService exposes a broadcast.System
+type BroadcastServiceServer interface {
+	// Start starts a new broadcast for the user. Fails with INVALID_ARGUMENT if
+	// they're already broadcasting
+	Start(context.Context, *StartBroadcastRequest) (*Broadcast, error)
+	// StillAlive records that the broadcast is still going. Fails with
+	// INVALID_ARGUMENT if it has already ended
+	StillAlive(context.Context, *BroadcastRequest) (*emptypb.Empty, error)
+	// End records that the broadcast has ended
+	End(context.Context, *BroadcastRequest) (*emptypb.Empty, error)
+	// Get returns the user's current broadcast. Fails with NOT_FOUND if they
+	// aren't broadcasting
+	Get(context.Context, *GetBroadcastRequest) (*Broadcast, error)
+	// Active returns all broadcasts which are currently going
+	Active(context.Context, *emptypb.Empty) (*ActiveResponse, error)
+	// Verify checks that the signature is the one returned by Start for the
+	// broadcast
+	Verify(context.Context, *VerifyRequest) (*VerifyResponse, error)
+	mustEmbedUnimplementedBroadcastServiceServer()
+}
+
+// UnimplementedBroadcastServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedBroadcastServiceServer struct{}
+
+func (UnimplementedBroadcastServiceServer) Start(context.Context, *StartBroadcastRequest) (*Broadcast, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Start not implemented")
+}
+func (UnimplementedBroadcastServiceServer) StillAlive(context.Context, *BroadcastRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StillAlive not implemented")
+}
+func (UnimplementedBroadcastServiceServer) End(context.Context, *BroadcastRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method End not implemented")
+}
+func (UnimplementedBroadcastServiceServer) Get(context.Context, *GetBroadcastRequest) (*Broadcast, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedBroadcastServiceServer) Active(context.Context, *emptypb.Empty) (*ActiveResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Active not implemented")
+}
+func (UnimplementedBroadcastServiceServer) Verify(context.Context, *VerifyRequest) (*VerifyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Verify not implemented")
+}
+func (UnimplementedBroadcastServiceServer) mustEmbedUnimplementedBroadcastServiceServer() {}
+func (UnimplementedBroadcastServiceServer) testEmbeddedByValue()                          {}
+
+// UnsafeBroadcastServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BroadcastServiceServer will
+// result in compilation errors.
+type UnsafeBroadcastServiceServer interface {
+	mustEmbedUnimplementedBroadcastServiceServer()
+}
+
+func RegisterBroadcastServiceServer(s grpc.ServiceRegistrar, srv BroadcastServiceServer) {
+	// If the following call pancis, it indicates UnimplementedBroadcastServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&BroadcastService_ServiceDesc, srv)
+}
+
+func _BroadcastService_Start_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StartBroadcastRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BroadcastServiceServer).Start(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BroadcastService_Start_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BroadcastServiceServer).Start(ctx, req.(*StartBroadcastRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BroadcastService_StillAlive_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BroadcastRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BroadcastServiceServer).StillAlive(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BroadcastService_StillAlive_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BroadcastServiceServer).StillAlive(ctx, req.(*BroadcastRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BroadcastService_End_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BroadcastRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BroadcastServiceServer).End(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BroadcastService_End_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BroadcastServiceServer).End(ctx, req.(*BroadcastRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BroadcastService_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBroadcastRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BroadcastServiceServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BroadcastService_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BroadcastServiceServer).Get(ctx, req.(*GetBroadcastRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BroadcastService_Active_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BroadcastServiceServer).Active(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BroadcastService_Active_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BroadcastServiceServer).Active(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BroadcastService_Verify_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VerifyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BroadcastServiceServer).Verify(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BroadcastService_Verify_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BroadcastServiceServer).Verify(ctx, req.(*VerifyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// BroadcastService_ServiceDesc is the grpc.ServiceDesc for BroadcastService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var BroadcastService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "mediocre.BroadcastService",
+	HandlerType: (*BroadcastServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Start",
+			Handler:    _BroadcastService_Start_Handler,
+		},
+		{
+			MethodName: "StillAlive",
+			Handler:    _BroadcastService_StillAlive_Handler,
+		},
+		{
+			MethodName: "End",
+			Handler:    _BroadcastService_End_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _BroadcastService_Get_Handler,
+		},
+		{
+			MethodName: "Active",
+			Handler:    _BroadcastService_Active_Handler,
+		},
+		{
+			MethodName: "Verify",
+			Handler:    _BroadcastService_Verify_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "broadcast.proto",
+}
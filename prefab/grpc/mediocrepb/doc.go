@@ -0,0 +1,6 @@
+// Package mediocrepb holds the protobuf definitions of the gRPC services served
+// by the grpc prefab, along with the go code generated from them. Clients can
+// be generated for other languages from the .proto files in this directory
+package mediocrepb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative user.proto room.proto broadcast.proto
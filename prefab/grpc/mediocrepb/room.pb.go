@@ -0,0 +1,288 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: room.proto
+
+package mediocrepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type RoomRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Room          string                 `protobuf:"bytes,1,opt,name=room,proto3" json:"room,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RoomRequest) Reset() {
+	*x = RoomRequest{}
+	mi := &file_room_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RoomRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RoomRequest) ProtoMessage() {}
+
+func (x *RoomRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_room_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RoomRequest.ProtoReflect.Descriptor instead.
+func (*RoomRequest) Descriptor() ([]byte, []int) {
+	return file_room_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *RoomRequest) GetRoom() string {
+	if x != nil {
+		return x.Room
+	}
+	return ""
+}
+
+type RoomMemberRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Room          string                 `protobuf:"bytes,1,opt,name=room,proto3" json:"room,omitempty"`
+	User          string                 `protobuf:"bytes,2,opt,name=user,proto3" json:"user,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RoomMemberRequest) Reset() {
+	*x = RoomMemberRequest{}
+	mi := &file_room_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RoomMemberRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RoomMemberRequest) ProtoMessage() {}
+
+func (x *RoomMemberRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_room_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RoomMemberRequest.ProtoReflect.Descriptor instead.
+func (*RoomMemberRequest) Descriptor() ([]byte, []int) {
+	return file_room_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *RoomMemberRequest) GetRoom() string {
+	if x != nil {
+		return x.Room
+	}
+	return ""
+}
+
+func (x *RoomMemberRequest) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+type MembersResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Users         []string               `protobuf:"bytes,1,rep,name=users,proto3" json:"users,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MembersResponse) Reset() {
+	*x = MembersResponse{}
+	mi := &file_room_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MembersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MembersResponse) ProtoMessage() {}
+
+func (x *MembersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_room_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MembersResponse.ProtoReflect.Descriptor instead.
+func (*MembersResponse) Descriptor() ([]byte, []int) {
+	return file_room_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *MembersResponse) GetUsers() []string {
+	if x != nil {
+		return x.Users
+	}
+	return nil
+}
+
+type CardinalityResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cardinality   int64                  `protobuf:"varint,1,opt,name=cardinality,proto3" json:"cardinality,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CardinalityResponse) Reset() {
+	*x = CardinalityResponse{}
+	mi := &file_room_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CardinalityResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CardinalityResponse) ProtoMessage() {}
+
+func (x *CardinalityResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_room_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CardinalityResponse.ProtoReflect.Descriptor instead.
+func (*CardinalityResponse) Descriptor() ([]byte, []int) {
+	return file_room_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *CardinalityResponse) GetCardinality() int64 {
+	if x != nil {
+		return x.Cardinality
+	}
+	return 0
+}
+
+var File_room_proto protoreflect.FileDescriptor
+
+const file_room_proto_rawDesc = "" +
+	"\n" +
+	"\n" +
+	"room.proto\x12\bmediocre\x1a\x1bgoogle/protobuf/empty.proto\"!\n" +
+	"\vRoomRequest\x12\x12\n" +
+	"\x04room\x18\x01 \x01(\tR\x04room\";\n" +
+	"\x11RoomMemberRequest\x12\x12\n" +
+	"\x04room\x18\x01 \x01(\tR\x04room\x12\x12\n" +
+	"\x04user\x18\x02 \x01(\tR\x04user\"'\n" +
+	"\x0fMembersResponse\x12\x14\n" +
+	"\x05users\x18\x01 \x03(\tR\x05users\"7\n" +
+	"\x13CardinalityResponse\x12 \n" +
+	"\vcardinality\x18\x01 \x01(\x03R\vcardinality2\x90\x02\n" +
+	"\vRoomService\x12>\n" +
+	"\aCheckIn\x12\x1b.mediocre.RoomMemberRequest\x1a\x16.google.protobuf.Empty\x12?\n" +
+	"\bCheckOut\x12\x1b.mediocre.RoomMemberRequest\x1a\x16.google.protobuf.Empty\x12;\n" +
+	"\aMembers\x12\x15.mediocre.RoomRequest\x1a\x19.mediocre.MembersResponse\x12C\n" +
+	"\vCardinality\x12\x15.mediocre.RoomRequest\x1a\x1d.mediocre.CardinalityResponseB?Z=github.com/mediocregopher/mediocre-api/prefab/grpc/mediocrepbb\x06proto3"
+
+var (
+	file_room_proto_rawDescOnce sync.Once
+	file_room_proto_rawDescData []byte
+)
+
+func file_room_proto_rawDescGZIP() []byte {
+	file_room_proto_rawDescOnce.Do(func() {
+		file_room_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_room_proto_rawDesc), len(file_room_proto_rawDesc)))
+	})
+	return file_room_proto_rawDescData
+}
+
+var file_room_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_room_proto_goTypes = []any{
+	(*RoomRequest)(nil),         // 0: mediocre.RoomRequest
+	(*RoomMemberRequest)(nil),   // 1: mediocre.RoomMemberRequest
+	(*MembersResponse)(nil),     // 2: mediocre.MembersResponse
+	(*CardinalityResponse)(nil), // 3: mediocre.CardinalityResponse
+	(*emptypb.Empty)(nil),       // 4: google.protobuf.Empty
+}
+var file_room_proto_depIdxs = []int32{
+	1, // 0: mediocre.RoomService.CheckIn:input_type -> mediocre.RoomMemberRequest
+	1, // 1: mediocre.RoomService.CheckOut:input_type -> mediocre.RoomMemberRequest
+	0, // 2: mediocre.RoomService.Members:input_type -> mediocre.RoomRequest
+	0, // 3: mediocre.RoomService.Cardinality:input_type -> mediocre.RoomRequest
+	4, // 4: mediocre.RoomService.CheckIn:output_type -> google.protobuf.Empty
+	4, // 5: mediocre.RoomService.CheckOut:output_type -> google.protobuf.Empty
+	2, // 6: mediocre.RoomService.Members:output_type -> mediocre.MembersResponse
+	3, // 7: mediocre.RoomService.Cardinality:output_type -> mediocre.CardinalityResponse
+	4, // [4:8] is the sub-list for method output_type
+	0, // [0:4] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_room_proto_init() }
+func file_room_proto_init() {
+	if File_room_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_room_proto_rawDesc), len(file_room_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_room_proto_goTypes,
+		DependencyIndexes: file_room_proto_depIdxs,
+		MessageInfos:      file_room_proto_msgTypes,
+	}.Build()
+	File_room_proto = out.File
+	file_room_proto_goTypes = nil
+	file_room_proto_depIdxs = nil
+}
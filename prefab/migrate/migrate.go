@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/common/config"
+	"github.com/mediocregopher/mediocre-api/migrations"
+	"github.com/mediocregopher/mediocre-api/user"
+)
+
+// all are the migrations of the data stored by the prefabs, in the order they
+// must be run. New ones are added to the end, with the next version, and
+// existing ones must never be changed or removed once released
+var all = []migrations.Migration{
+	{
+		Version:     1,
+		Description: "add existing users to the email index",
+		Func: func(c common.Cmder) error {
+			return user.New(c).IndexEmails()
+		},
+	},
+}
+
+func main() {
+	c := config.New("migrate")
+	c.AddRedis()
+	c.AddLogging()
+	c.Add(config.Param{
+		Name:        "status",
+		Description: "Print the current schema version and the pending migrations, without running them",
+		Flag:        true,
+	})
+	c.Add(config.Param{
+		Name:        "lock-wait",
+		Description: "How long to wait for migrations being run by another process to finish before giving up",
+		Default:     "5m",
+	})
+	c.ParseOrExit()
+
+	if _, err := c.Logging(); err != nil {
+		log.Fatal(err)
+	}
+
+	lockWait, err := c.Duration("lock-wait")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cmder, err := c.Redis()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s := migrations.New(cmder, &migrations.Opts{LockWait: lockWait})
+	for _, m := range all {
+		s.Add(m)
+	}
+
+	if c.Bool("status") {
+		v, err := s.Version()
+		if err != nil {
+			log.Fatal(err)
+		}
+		pending, err := s.Pending()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("version: %d\n", v)
+		for _, m := range pending {
+			fmt.Printf("pending: %d %s\n", m.Version, m.Description)
+		}
+		return
+	}
+
+	ran, err := s.Run()
+	for _, m := range ran {
+		log.Printf("ran migration %d: %s", m.Version, m.Description)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("schema is up to date")
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	. "testing"
+
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/mediocregopher/mediocre-api/migrations"
+	"github.com/mediocregopher/mediocre-api/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAll(t *T) {
+	c := commontest.APIStarterKit()
+	users := user.New(c)
+	u, email := commontest.RandStr(), commontest.RandStr()
+	require.Nil(t, users.Create(u, email, commontest.RandStr()))
+
+	// Simulate the user having been created before the email index was added
+	require.Nil(t, c.Cmd("DEL", "user:email:{"+email+"}").Err)
+	_, err := users.GetByEmail(email)
+	assert.Equal(t, user.ErrNotFound, err)
+
+	s := migrations.New(c, &migrations.Opts{Prefix: commontest.KeyPrefix(t, c)})
+	for _, m := range all {
+		s.Add(m)
+	}
+	ran, err := s.Run()
+	require.Nil(t, err)
+	assert.Len(t, ran, len(all))
+
+	got, err := users.GetByEmail(email)
+	require.Nil(t, err)
+	assert.Equal(t, u, got)
+}
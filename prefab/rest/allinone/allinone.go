@@ -0,0 +1,321 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/justinas/alice"
+	"github.com/mediocregopher/mediocre-api/auth"
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/common/config"
+	"github.com/mediocregopher/mediocre-api/flags"
+	"github.com/mediocregopher/mediocre-api/prefab/rest/broadcast/broadcastapi"
+	"github.com/mediocregopher/mediocre-api/prefab/rest/flags/flagsapi"
+	"github.com/mediocregopher/mediocre-api/prefab/rest/graphqlapi"
+	"github.com/mediocregopher/mediocre-api/prefab/rest/room/roomapi"
+	"github.com/mediocregopher/mediocre-api/prefab/rest/user/userapi"
+	"github.com/mediocregopher/mediocre-api/room"
+	"github.com/mediocregopher/mediocre-api/room/broadcast"
+	"github.com/mediocregopher/mediocre-api/user"
+	"github.com/mediocregopher/mediocre-api/xff"
+)
+
+func main() {
+	c := config.New("allinone")
+	c.AddListenAddr(":8080")
+	c.AddTLS()
+	c.AddSecret()
+	c.AddRedis()
+	c.AddLogging()
+	c.AddNotify()
+	c.Add(config.Param{
+		Name:        "verify-url",
+		Description: "URL linked to by email verification emails, with \"user\" and \"token\" query parameters added. Required with notify",
+	})
+	c.Add(config.Param{
+		Name:        "reset-url",
+		Description: "URL linked to by password reset emails, with \"user\" and \"token\" query parameters added. Required with notify",
+	})
+	c.Add(config.Param{
+		Name:        "admin-token",
+		Description: "Token which must be given as a bearer token to use the /user/admin/, /flags/admin/, and /shield/admin/ endpoints. Leave blank to disable them",
+	})
+	c.Add(config.Param{
+		Name:        "check-in-period",
+		Description: "How long a user stays in a room after checking in, unless they check in again",
+		Default:     "30s",
+	})
+	c.Add(config.Param{
+		Name:        "aliveness-period",
+		Description: "How long a broadcast stays active without a heartbeat before it's considered dead. Rounded down to the second",
+		Default:     "30s",
+	})
+	c.Add(config.Param{
+		Name:        "sessions",
+		Description: "Whether to record a session for every user token issued, and only accept tokens whose session is still valid. This lets tokens be revoked, e.g. by users logging out everywhere",
+		Flag:        true,
+	})
+	c.Add(config.Param{
+		Name:        "graphql",
+		Description: "Whether or not to serve the GraphQL endpoint at /graphql",
+		Flag:        true,
+	})
+	c.ParseOrExit()
+
+	logSink, err := c.Logging()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	secret, err := c.Secret()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	checkInPeriod, err := c.Duration("check-in-period")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	aliveness, err := c.Duration("aliveness-period")
+	if err != nil {
+		log.Fatal(err)
+	} else if aliveness < time.Second {
+		log.Fatal("--aliveness-period must be at least 1s")
+	}
+
+	cmder, err := c.Redis()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	a := newAuthAPI(secret)
+	if c.Bool("sessions") {
+		a.Sessions = user.New(cmder)
+	}
+
+	rs := room.New(cmder, &room.Opts{CheckInPeriod: checkInPeriod})
+	c.OnShutdown(rs.Stop)
+
+	bs := broadcast.New(cmder)
+	bs.Secret = deriveSecret(secret, "broadcast")
+	bs.AlivenessPeriod = int(aliveness / time.Second)
+
+	fs := flags.New(cmder, &flags.Opts{Users: user.New(cmder)})
+
+	uo := &userapi.MuxOpts{AdminToken: c.Str("admin-token"), Secret: deriveSecret(secret, "user")}
+	if uo.Notify, err = c.Notify(); err != nil {
+		log.Fatal(err)
+	} else if uo.Notify != nil {
+		if err := c.Require("verify-url", "reset-url"); err != nil {
+			log.Fatal(err)
+		}
+		uo.VerifyURL, uo.ResetURL = c.Str("verify-url"), c.Str("reset-url")
+	}
+	m := newMux(cmder, a, uo, rs, bs, fs, c.Bool("graphql"))
+	h := apihelper.RequestID(apihelper.AccessLog(m, &apihelper.AccessLogOpts{
+		Sink: logSink,
+		User: a.GetUser,
+	}))
+
+	if err := c.ListenAndServe(h); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// newAuthAPI returns the auth.API all requests are wrapped with, which passes
+// the logged in user on to the muxes using the _asUser GET parameter they
+// expect
+func newAuthAPI(secret []byte) *auth.API {
+	a := auth.NewAPI()
+	a.Secret = secret
+	a.UserAuthGetParam = "_asUser"
+	return a
+}
+
+// deriveSecret derives the secret a service signs things with (e.g. broadcast
+// IDs) from the main secret, so that what one service signs can never be
+// mistaken for a token or for what another one signs
+func deriveSecret(secret []byte, service string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(service))
+	return h.Sum(nil)
+}
+
+func prefixStrip(prefix string) alice.Constructor {
+	return func(h http.Handler) http.Handler {
+		return http.StripPrefix(prefix, h)
+	}
+}
+
+// stripParam removes the given GET parameter from all requests, so that
+// clients can't set the parameter the auth.API uses to tell the muxes who the
+// logged in user is
+func stripParam(param string) alice.Constructor {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if q := r.URL.Query(); len(q[param]) > 0 {
+				q.Del(param)
+				r.URL.RawQuery = q.Encode()
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// newMux returns an http.Handler which serves the user, room, broadcast, and
+// flags muxes under /user/, /room/, /broadcast/, and /flags/, all wrapped by the
+// given auth.API the same way shield would wrap them, along with shield's
+// /shield/token endpoint (and its rate limit admin endpoints, if uo has an
+// AdminToken) and an OpenAPI document describing all of them. If gql is true
+// the GraphQL endpoint is also served at /graphql
+func newMux(
+	cmder common.Cmder, a *auth.API, uo *userapi.MuxOpts,
+	rs *room.System, bs *broadcast.System, fs *flags.System, gql bool,
+) http.Handler {
+	if uo == nil {
+		uo = &userapi.MuxOpts{}
+	}
+
+	m := mux.NewRouter()
+	base := alice.New(stripParam(a.UserAuthGetParam))
+
+	h := common.NewHealth()
+	h.Add("redis", common.CmderCheck(cmder))
+	if p, ok := a.RateLimiter.Backend.(common.Pinger); ok {
+		h.Add("rate-limiter", p.Ping)
+	}
+	m.Path("/healthz").Handler(h.Liveness())
+	m.Path("/readyz").Handler(h.Readiness())
+
+	m.Handle("/shield/token", base.Append(
+		a.Wrapper(auth.IPRateLimited),
+	).ThenFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			token := a.NewAPIToken()
+			apihelper.JSONSuccess(w, &struct{ Token string }{token})
+		},
+	))
+
+	spec := apihelper.NewOpenAPI("allinone", "1")
+	spec.Add("/shield/token", "GET", apihelper.Doc{
+		Summary:  "Get a new api token",
+		Response: &struct{ Token string }{},
+		Errors:   []common.ExpectedErr{auth.ErrIPAddrRateLimited},
+	})
+	m.Path("/openapi.json").Handler(spec)
+
+	specs := map[string]http.Handler{}
+	if uo.AdminToken != "" {
+		rlAdmin := a.RateLimitAdmin(uo.AdminToken)
+		m.PathPrefix("/shield/admin/rate-limit/").Handler(
+			http.StripPrefix("/shield/admin/rate-limit", rlAdmin),
+		)
+		specs["/shield/admin/rate-limit"] = rlAdmin
+	}
+
+	userChain := base.Append(a.Wrapper(auth.Default), prefixStrip("/user"))
+	userMux := userapi.Mux(cmder, uo)
+	m.Methods("POST").Path("/user/{user}/auth").Handler(
+		userChain.Then(userTokenHandler(a, userMux)),
+	)
+	m.PathPrefix("/user/").Handler(userChain.Then(userMux))
+
+	roomMux := roomapi.Mux(cmder, rs)
+	m.PathPrefix("/room/").Handler(base.Append(
+		a.Wrapper(auth.RequireUserAuthPost),
+		prefixStrip("/room"),
+	).Then(roomMux))
+
+	// The media server making the broadcast callbacks doesn't have an api
+	// token, the broadcast's signature is checked instead
+	broadcastMux := broadcastapi.Mux(cmder, bs, nil)
+	m.Path("/broadcast/callback").Handler(base.Append(
+		a.Wrapper(auth.NoAPITokenRequired),
+		prefixStrip("/broadcast"),
+	).Then(broadcastMux))
+	m.PathPrefix("/broadcast/").Handler(base.Append(
+		a.Wrapper(auth.RequireUserAuthPost),
+		prefixStrip("/broadcast"),
+	).Then(broadcastMux))
+
+	flagsMux := flagsapi.Mux(cmder, fs, &flagsapi.MuxOpts{AdminToken: uo.AdminToken})
+	m.PathPrefix("/flags/").Handler(base.Append(
+		a.Wrapper(auth.Default),
+		prefixStrip("/flags"),
+	).Then(flagsMux))
+
+	if gql {
+		m.Path("/graphql").Handler(base.Append(
+			a.Wrapper(auth.Default),
+		).Then(graphqlapi.Handler(user.New(cmder), rs, bs)))
+	}
+
+	specs["/user"] = userMux
+	specs["/room"] = roomMux
+	specs["/broadcast"] = broadcastMux
+	specs["/flags"] = flagsMux
+	for prefix, h := range specs {
+		ms, err := apihelper.FetchOpenAPI(h)
+		if err != nil {
+			log.Printf("%s: %s", prefix, err)
+			continue
+		}
+		spec.Mount(prefix, ms)
+	}
+
+	return m
+}
+
+// sessionRecorder is implemented by user.System
+type sessionRecorder interface {
+	NewSession(user string, meta map[string]string) (string, error)
+}
+
+// userTokenHandler returns a handler which passes the request on to the given
+// user mux and, if it responds with a 200, returns a new user token for the
+// {user} in the request's path instead of the mux's response. If the auth.API's
+// Sessions is a user.System the token is for a new session recorded in it
+func userTokenHandler(a *auth.API, userMux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u := mux.Vars(r)["user"]
+		rec := httptest.NewRecorder()
+		userMux.ServeHTTP(rec, r)
+
+		if rec.Code != 200 {
+			for k, v := range rec.Header() {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(rec.Code)
+			w.Write(rec.Body.Bytes())
+			return
+		}
+
+		tok := a.NewUserToken(u)
+		if sr, ok := a.Sessions.(sessionRecorder); ok {
+			id, err := sr.NewSession(u, sessionMeta(r))
+			if err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+			tok = a.NewSessionUserToken(u, id)
+		}
+		apihelper.JSONSuccess(w, &struct{ Token string }{Token: tok})
+	})
+}
+
+// sessionMeta returns the metadata recorded with the session of a user logging
+// in with the given request, so they can tell their sessions apart
+func sessionMeta(r *http.Request) map[string]string {
+	meta := map[string]string{"UserAgent": r.UserAgent()}
+	if ip := xff.ClientIP(r); ip != nil {
+		meta["IP"] = ip.String()
+	}
+	return meta
+}
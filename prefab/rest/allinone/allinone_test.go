@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	. "testing"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/auth"
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/mediocregopher/mediocre-api/flags"
+	"github.com/mediocregopher/mediocre-api/prefab/rest/user/userapi"
+	"github.com/mediocregopher/mediocre-api/room"
+	"github.com/mediocregopher/mediocre-api/room/broadcast"
+	"github.com/mediocregopher/mediocre-api/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testAPI = newAuthAPI([]byte("turtles"))
+
+var testMux = func() http.Handler {
+	cmder := commontest.APIStarterKit()
+	rs := room.New(cmder, &room.Opts{
+		Prefix:        commontest.RandStr(),
+		CheckInPeriod: 1 * time.Second,
+	})
+	bs := broadcast.New(cmder)
+	bs.Prefix = commontest.RandStr()
+	bs.Secret = deriveSecret(testAPI.Secret, "broadcast")
+	fs := flags.New(cmder, &flags.Opts{Prefix: commontest.RandStr()})
+	return newMux(cmder, testAPI, nil, rs, bs, fs, true)
+}()
+
+func assertReqRawErr(t *T, r *http.Request, err common.ExpectedErr) {
+	w := httptest.NewRecorder()
+	testMux.ServeHTTP(w, r)
+	assert.Equal(t, err.Code, w.Code)
+	assert.Equal(t, err.Err+"\n", w.Body.String())
+}
+
+func TestAPIToken(t *T) {
+	s := struct{ Token string }{}
+	commontest.AssertReqJSON(t, testMux, "GET", "/shield/token", "", &s)
+	assert.NotEqual(t, "", s.Token)
+}
+
+func TestUser(t *T) {
+	u := commontest.RandStr()
+	password := commontest.RandStr()
+
+	reqBody := fmt.Sprintf(
+		`{"Email":"%s","Username":"%s","Password":"%s"}`,
+		commontest.RandEmail(), u, password,
+	)
+	commontest.AssertReqErr(t, testMux, "POST", "/user/new-user", reqBody, auth.ErrAPITokenMissing)
+	r := testAPI.NewRequest("POST", "/user/new-user", reqBody, "")
+	commontest.AssertReqRaw(t, testMux, r, "")
+
+	reqBody = fmt.Sprintf(`{"Password":"%s"}`, password)
+	r = testAPI.NewRequest("POST", "/user/"+u+"/auth", reqBody, "")
+	s := struct{ Token string }{}
+	commontest.AssertReqRawJSON(t, testMux, r, &s)
+	assert.Equal(t, u, testAPI.GetUser(&http.Request{Header: http.Header{
+		"Cookie": {auth.UserTokenCookie + "=" + s.Token},
+	}}))
+
+	r = testAPI.NewRequest("POST", "/user/"+u+"/auth", `{"Password":"aaaaaa"}`, "")
+	assertReqRawErr(t, r, user.ErrBadAuth)
+}
+
+func TestRoom(t *T) {
+	rm, u := commontest.RandStr(), commontest.RandStr()
+
+	r := testAPI.NewRequest("POST", "/room/"+rm+"/checkin", "", "")
+	assertReqRawErr(t, r, auth.ErrUserTokenMissing)
+
+	// The user can't be spoofed using _asUser
+	r = testAPI.NewRequest("POST", "/room/"+rm+"/checkin?_asUser=foo", "", u)
+	commontest.AssertReqRaw(t, testMux, r, "")
+
+	var members []string
+	r = testAPI.NewRequest("GET", "/room/"+rm+"/members", "", "")
+	commontest.AssertReqRawJSON(t, testMux, r, &commontest.Page{Data: &members})
+	assert.Equal(t, []string{u}, members)
+}
+
+func TestBroadcast(t *T) {
+	u := commontest.RandStr()
+
+	var b struct {
+		ID        broadcast.ID
+		Signature string
+	}
+	r := testAPI.NewRequest("POST", "/broadcast/start", "", u)
+	commontest.AssertReqRawJSON(t, testMux, r, &b)
+	require.Equal(t, u, b.ID.User())
+
+	// The callback doesn't need an api token
+	body := url.Values{
+		"call": {"publish"},
+		"name": {string(b.ID)},
+		"sig":  {b.Signature},
+	}.Encode()
+	commontest.AssertReqWith(t, testMux, "POST", "/broadcast/callback", body, &commontest.ReqOpts{
+		Header: http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+	}, "")
+}
+
+func TestFlags(t *T) {
+	var m map[string]bool
+	r := testAPI.NewRequest("GET", "/flags/evaluate", "", "")
+	commontest.AssertReqRawJSON(t, testMux, r, &m)
+	assert.NotNil(t, m)
+
+	// Without an admin token the admin endpoints aren't served
+	w := httptest.NewRecorder()
+	testMux.ServeHTTP(w, testAPI.NewRequest("GET", "/flags/admin/flags", "", ""))
+	assert.Equal(t, 404, w.Code)
+}
+
+func TestGraphQL(t *T) {
+	rm, u := commontest.RandStr(), commontest.RandStr()
+	body := fmt.Sprintf(`{"query":"mutation { checkIn(room: \"%s\") { members } }"}`, rm)
+
+	var res struct {
+		Data map[string]map[string][]string
+	}
+	r := testAPI.NewRequest("POST", "/graphql?_asUser=foo", body, u)
+	commontest.AssertReqRawJSON(t, testMux, r, &res)
+	assert.Equal(t, []string{u}, res.Data["checkIn"]["members"])
+}
+
+func TestHealth(t *T) {
+	commontest.AssertReq(t, testMux, "GET", "/healthz", "", `{"status":"ok"}`+"\n")
+	commontest.AssertReq(t, testMux, "GET", "/readyz", "",
+		`{"status":"ok","checks":{"redis":"ok"}}`+"\n")
+}
+
+func TestOpenAPI(t *T) {
+	var doc struct {
+		Paths map[string]map[string]interface{}
+	}
+	commontest.AssertReqJSON(t, testMux, "GET", "/openapi.json", "", &doc)
+	for _, path := range []string{"/shield/token", "/user/new-user", "/room/{room}/checkin", "/broadcast/start", "/flags/evaluate"} {
+		assert.Contains(t, doc.Paths, path)
+	}
+}
+
+func TestRateLimitAdmin(t *T) {
+	cmder := commontest.APIStarterKit()
+	a := newAuthAPI([]byte("turtles"))
+	rs := room.New(cmder, &room.Opts{Prefix: commontest.RandStr()})
+	defer rs.Stop()
+	fs := flags.New(cmder, &flags.Opts{Prefix: commontest.RandStr()})
+	m := newMux(cmder, a, &userapi.MuxOpts{AdminToken: "admin-token"}, rs, broadcast.New(cmder), fs, false)
+
+	url := "/shield/admin/rate-limit/limits"
+	commontest.AssertReqErr(t, m, "GET", url, "", apihelper.ErrNotAdmin)
+	var limits struct{ Capacity string }
+	commontest.AssertReqJSONWith(t, m, "GET", url, "", &commontest.ReqOpts{
+		Header: http.Header{"Authorization": {"Bearer admin-token"}},
+	}, &limits)
+	assert.Equal(t, "30s", limits.Capacity)
+
+	// Without an admin token they aren't served
+	code, _ := commontest.Req(t, testMux, "GET", url, "")
+	assert.Equal(t, 404, code)
+}
+
+func TestUserSessions(t *T) {
+	cmder := commontest.APIStarterKit()
+	a := newAuthAPI([]byte("turtles"))
+	us := user.New(cmder)
+	a.Sessions = us
+	rs := room.New(cmder, &room.Opts{Prefix: commontest.RandStr()})
+	defer rs.Stop()
+	fs := flags.New(cmder, &flags.Opts{Prefix: commontest.RandStr()})
+	m := newMux(cmder, a, nil, rs, broadcast.New(cmder), fs, false)
+
+	u, password := commontest.RandStr(), commontest.RandStr()
+	require.Nil(t, us.Create(u, commontest.RandEmail(), password))
+
+	r := a.NewRequest("POST", "/user/"+u+"/auth", fmt.Sprintf(`{"Password":"%s"}`, password), "")
+	s := struct{ Token string }{}
+	commontest.AssertReqRawJSON(t, m, r, &s)
+	withToken := func(method, url string) *http.Request {
+		r := a.NewRequest(method, url, "", "")
+		r.AddCookie(&http.Cookie{Name: auth.UserTokenCookie, Value: s.Token})
+		return r
+	}
+
+	var ss []user.Session
+	commontest.AssertReqRawJSON(t, m, withToken("GET", "/user/"+u+"/sessions"), &commontest.Page{Data: &ss})
+	require.Len(t, ss, 1)
+
+	// Once the session is revoked the token is no longer accepted
+	commontest.AssertReqRaw(t, m, withToken("POST", "/user/"+u+"/sessions/revoke-all"), "")
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, withToken("GET", "/user/"+u+"/sessions"))
+	assert.Equal(t, user.ErrBadAuth.Code, w.Code)
+}
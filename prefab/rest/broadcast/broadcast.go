@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/common/config"
+	"github.com/mediocregopher/mediocre-api/prefab/rest/broadcast/broadcastapi"
+	"github.com/mediocregopher/mediocre-api/room/broadcast"
+)
+
+func main() {
+	c := config.New("broadcast")
+	c.AddListenAddr(":8083")
+	c.AddTLS()
+	c.AddRedis()
+	c.AddLogging()
+	c.AddSecret()
+	c.Add(config.Param{
+		Name:        "aliveness-period",
+		Description: "How long a broadcast stays active without a heartbeat before it's considered dead. Rounded down to the second",
+		Default:     "30s",
+	})
+	c.ParseOrExit()
+
+	logSink, err := c.Logging()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	secret, err := c.Secret()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	aliveness, err := c.Duration("aliveness-period")
+	if err != nil {
+		log.Fatal(err)
+	} else if aliveness < time.Second {
+		log.Fatal("--aliveness-period must be at least 1s")
+	}
+
+	cmder, err := c.Redis()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s := broadcast.New(cmder)
+	s.Secret = secret
+	s.AlivenessPeriod = int(aliveness / time.Second)
+
+	m := broadcastapi.Mux(cmder, s, nil)
+	h := apihelper.RequestID(apihelper.AccessLog(m, &apihelper.AccessLogOpts{
+		Sink: logSink,
+		User: func(r *http.Request) string {
+			return r.URL.Query().Get("_asUser")
+		},
+	}))
+
+	if err := c.ListenAndServe(h); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,251 @@
+// Package broadcastapi implements the REST interface served by the broadcast
+// prefab, so that it can also be mounted as part of another process
+package broadcastapi
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/notify"
+	"github.com/mediocregopher/mediocre-api/room/broadcast"
+)
+
+// Errors which can be returned from the REST endpoints
+var (
+	ErrNotAuthd = common.ExpectedErr{Code: 400, ID: "not_authd", Err: "must be authenticated as a user"}
+	ErrNotOwner = common.ExpectedErr{Code: 400, ID: "not_broadcast_owner", Err: "broadcast belongs to a different user"}
+	ErrBadSig   = common.ExpectedErr{Code: 403, ID: "invalid_signature", Err: "invalid broadcast signature"}
+	ErrBadCall  = common.ExpectedErr{Code: 400, ID: "unknown_call", Err: "unknown callback call"}
+)
+
+// asUser returns the user the request is being made on behalf of, as set by
+// shield
+func asUser(r *http.Request) string {
+	return r.URL.Query().Get("_asUser")
+}
+
+// activeBroadcast is what's returned for each broadcast when listing active
+// ones
+type activeBroadcast struct {
+	User string
+	ID   broadcast.ID
+}
+
+// startedBroadcast is what's returned when starting a broadcast
+type startedBroadcast struct {
+	ID        broadcast.ID
+	Signature string
+}
+
+// Follower is someone who is emailed when a user they follow starts
+// broadcasting, see MuxOpts
+type Follower struct {
+	User, Email string
+}
+
+// MuxOpts are different options which may be passed into Mux. They all have
+// sane defaults which will cover most use cases
+type MuxOpts struct {
+
+	// If set along with Followers, whenever a user starts broadcasting their
+	// followers are emailed using the notify.BroadcastLive Template. Defaults
+	// to nil (disabled)
+	Notify notify.Sender
+
+	// Followers returns the followers of the given broadcaster. This package
+	// doesn't keep track of who follows who, so it's up to the application to
+	// provide. Defaults to nil (disabled)
+	Followers func(broadcaster string) ([]Follower, error)
+
+	// The link emailed to followers is to this url, with the "user" query
+	// parameter set to the broadcaster. Required with Notify
+	WatchURL string
+}
+
+// notifyFollowers emails the broadcaster's followers that they've gone live.
+// The broadcast has already started by the time this is called, so errors are
+// logged to common.Log
+func notifyFollowers(o *MuxOpts, broadcaster string) {
+	logErr := func(err error) {
+		if common.Log != nil {
+			common.Log.Printf("notifying followers of %q: %s", broadcaster, err)
+		}
+	}
+
+	fs, err := o.Followers(broadcaster)
+	if err != nil {
+		logErr(err)
+		return
+	}
+	l, err := url.Parse(o.WatchURL)
+	if err != nil {
+		logErr(err)
+		return
+	}
+	q := l.Query()
+	q.Set("user", broadcaster)
+	l.RawQuery = q.Encode()
+
+	for _, f := range fs {
+		data := notify.BroadcastData{User: f.User, Broadcaster: broadcaster, Link: l.String()}
+		if err := notify.Send(o.Notify, notify.BroadcastLive, f.Email, data); err != nil {
+			logErr(err)
+		}
+	}
+}
+
+// Mux takes in a common.Cmder and the broadcast.System using it, and returns an
+// http.Handler which implements the broadcast system as a rest interface. See
+// the broadcast prefab's README for more information on REST endpoints, which
+// are also described by the OpenAPI document served at /openapi.json. The passed
+// in MuxOpts may be nil to just use the defaults
+func Mux(cmder common.Cmder, s *broadcast.System, o *MuxOpts) http.Handler {
+	if o == nil {
+		o = &MuxOpts{}
+	}
+
+	m := mux.NewRouter()
+	spec := apihelper.NewOpenAPI("broadcast", "1")
+	m.Path("/openapi.json").Handler(spec)
+
+	h := common.NewHealth()
+	h.Add("broadcast-store", common.CmderCheck(cmder))
+	m.Path("/healthz").Handler(h.Liveness())
+	m.Path("/readyz").Handler(h.Readiness())
+
+	m.Path("/start").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"POST": func(w http.ResponseWriter, r *http.Request) {
+			u := asUser(r)
+			if u == "" {
+				common.HTTPError(w, r, ErrNotAuthd)
+				return
+			}
+			id, sig, err := s.StartBroadcast(u)
+			if err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+			if o.Notify != nil && o.Followers != nil {
+				go notifyFollowers(o, u)
+			}
+			apihelper.JSONSuccess(w, &startedBroadcast{id, sig})
+		},
+	}))
+	spec.Add("/start", "POST", apihelper.Doc{
+		Summary:  "Start a broadcast for the user",
+		AsUser:   true,
+		Response: &startedBroadcast{},
+		Errors:   []common.ExpectedErr{ErrNotAuthd, broadcast.ErrUserIsBroadcasting},
+	})
+
+	m.Path("/active").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"GET": func(w http.ResponseWriter, r *http.Request) {
+			ids, err := s.Active()
+			if err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+			ret := make([]activeBroadcast, len(ids))
+			for i := range ids {
+				ret[i] = activeBroadcast{User: ids[i].User(), ID: ids[i]}
+			}
+			apihelper.JSONPage(w, ret, "", int64(len(ret)))
+		},
+	}))
+	spec.Add("/active", "GET", apihelper.Doc{
+		Summary:  "List all broadcasts which are currently going",
+		Response: &[]activeBroadcast{},
+		Page:     true,
+	})
+
+	// ownerHandler calls fn with the broadcast ID in the path, but only if it
+	// belongs to the user the request is being made on behalf of
+	ownerHandler := func(fn func(broadcast.ID) error) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			u := asUser(r)
+			if u == "" {
+				common.HTTPError(w, r, ErrNotAuthd)
+				return
+			}
+			id := broadcast.ID(mux.Vars(r)["id"])
+			if id.User() == "" {
+				common.HTTPError(w, r, broadcast.ErrInvalidID)
+				return
+			} else if id.User() != u {
+				common.HTTPError(w, r, ErrNotOwner)
+				return
+			}
+			common.HTTPError(w, r, fn(id))
+		}
+	}
+
+	ownerErrs := []common.ExpectedErr{
+		ErrNotAuthd, ErrNotOwner, broadcast.ErrInvalidID, broadcast.ErrBroadcastEnded,
+	}
+
+	m.Path("/{id}/heartbeat").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"POST": ownerHandler(s.StillAlive),
+	}))
+	spec.Add("/{id}/heartbeat", "POST", apihelper.Doc{
+		Summary: "Record that the user's broadcast is still going",
+		AsUser:  true,
+		Errors:  ownerErrs,
+	})
+
+	m.Path("/{id}/end").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"POST": ownerHandler(s.Ended),
+	}))
+	spec.Add("/{id}/end", "POST", apihelper.Doc{
+		Summary: "End the user's broadcast",
+		AsUser:  true,
+		Errors:  ownerErrs,
+	})
+
+	m.Path("/callback").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"POST": callbackHandler(s),
+	}))
+	spec.Add("/callback", "POST", apihelper.Doc{
+		Summary: "Called by the media server, with a form encoded body, as a broadcaster streams to it",
+		Errors: []common.ExpectedErr{
+			ErrBadSig, ErrBadCall, broadcast.ErrInvalidID, broadcast.ErrBroadcastEnded,
+		},
+	})
+
+	return m
+}
+
+// callbackHandler handles the callbacks made by a media server (e.g.
+// nginx-rtmp's on_publish, on_update, and on_publish_done) as a broadcaster
+// streams to it. The stream's name must be the broadcast ID, and the "sig"
+// argument its signature. Any non-200 response tells the media server to drop
+// the stream
+func callbackHandler(s *broadcast.System) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := broadcast.ID(r.FormValue("name"))
+		if !s.Verify(id, r.FormValue("sig")) {
+			common.HTTPError(w, r, ErrBadSig)
+			return
+		}
+
+		switch r.FormValue("call") {
+		case "publish":
+			// Only allow the stream if it's for the broadcast which the user
+			// currently has going
+			curr, err := s.GetBroadcastID(id.User())
+			if err != nil {
+				common.HTTPError(w, r, err)
+			} else if curr != id {
+				common.HTTPError(w, r, broadcast.ErrBroadcastEnded)
+			}
+		case "update_publish":
+			common.HTTPError(w, r, s.StillAlive(id))
+		case "publish_done":
+			common.HTTPError(w, r, s.Ended(id))
+		default:
+			common.HTTPError(w, r, ErrBadCall)
+		}
+	}
+}
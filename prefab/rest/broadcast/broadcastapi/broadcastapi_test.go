@@ -0,0 +1,146 @@
+package broadcastapi
+
+import (
+	"net/http"
+	"net/url"
+	. "testing"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/mediocregopher/mediocre-api/notify"
+	"github.com/mediocregopher/mediocre-api/room/broadcast"
+	"github.com/stretchr/testify/assert"
+)
+
+var testMux = func() http.Handler {
+	cmder := commontest.APIStarterKit()
+	s := broadcast.New(cmder)
+	s.Prefix = commontest.RandStr()
+	s.Secret = []byte("TURTLES")
+	return Mux(cmder, s, nil)
+}()
+
+type testStarted struct {
+	ID        broadcast.ID
+	Signature string
+}
+
+func testStart(t *T, u string) testStarted {
+	var ret testStarted
+	commontest.AssertReqJSON(t, testMux, "POST", "/start?_asUser="+u, "", &ret)
+	assert.Equal(t, u, ret.ID.User())
+	return ret
+}
+
+func assertActive(t *T, u string, id broadcast.ID) {
+	var l []activeBroadcast
+	commontest.AssertReqJSON(t, testMux, "GET", "/active", "", &commontest.Page{Data: &l})
+	var found broadcast.ID
+	for _, ab := range l {
+		if ab.User == u {
+			found = ab.ID
+		}
+	}
+	assert.Equal(t, id, found)
+}
+
+func TestStartEnd(t *T) {
+	u := commontest.RandStr()
+	commontest.AssertReqErr(t, testMux, "POST", "/start", "", ErrNotAuthd)
+
+	b := testStart(t, u)
+	assertActive(t, u, b.ID)
+	commontest.AssertReqErr(t, testMux, "POST", "/start?_asUser="+u, "", broadcast.ErrUserIsBroadcasting)
+
+	heartbeat, end := "/"+string(b.ID)+"/heartbeat", "/"+string(b.ID)+"/end"
+	commontest.AssertReq(t, testMux, "POST", heartbeat+"?_asUser="+u, "", "")
+	commontest.AssertReqErr(t, testMux, "POST", heartbeat, "", ErrNotAuthd)
+	commontest.AssertReqErr(t, testMux, "POST", end+"?_asUser=foo", "", ErrNotOwner)
+
+	commontest.AssertReq(t, testMux, "POST", end+"?_asUser="+u, "", "")
+	assertActive(t, u, "")
+	commontest.AssertReqErr(t, testMux, "POST", heartbeat+"?_asUser="+u, "", broadcast.ErrBroadcastEnded)
+}
+
+func TestCallback(t *T) {
+	u := commontest.RandStr()
+	b := testStart(t, u)
+
+	callback := func(call, sig string) string {
+		return url.Values{
+			"call": {call},
+			"name": {string(b.ID)},
+			"sig":  {sig},
+		}.Encode()
+	}
+	opts := &commontest.ReqOpts{
+		Header: http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+	}
+
+	commontest.AssertReqErrWith(t, testMux, "POST", "/callback", callback("publish", "foo"), opts, ErrBadSig)
+	commontest.AssertReqWith(t, testMux, "POST", "/callback", callback("publish", b.Signature), opts, "")
+	commontest.AssertReqWith(t, testMux, "POST", "/callback", callback("update_publish", b.Signature), opts, "")
+	commontest.AssertReqErrWith(t, testMux, "POST", "/callback", callback("play", b.Signature), opts, ErrBadCall)
+	assertActive(t, u, b.ID)
+
+	commontest.AssertReqWith(t, testMux, "POST", "/callback", callback("publish_done", b.Signature), opts, "")
+	assertActive(t, u, "")
+
+	// Once ended the stream can't be started again with the same ID
+	commontest.AssertReqErrWith(t, testMux, "POST", "/callback", callback("publish", b.Signature), opts, broadcast.ErrBroadcastEnded)
+}
+
+func TestHealth(t *T) {
+	commontest.AssertReq(t, testMux, "GET", "/healthz", "", `{"status":"ok"}`+"\n")
+	commontest.AssertReq(t, testMux, "GET", "/readyz", "",
+		`{"status":"ok","checks":{"broadcast-store":"ok"}}`+"\n")
+}
+
+func TestOpenAPI(t *T) {
+	var doc struct {
+		Paths map[string]map[string]interface{}
+	}
+	commontest.AssertReqJSON(t, testMux, "GET", "/openapi.json", "", &doc)
+	assert.Len(t, doc.Paths, 5)
+	assert.Contains(t, doc.Paths["/start"], "post")
+}
+
+// chanSender is a notify.Sender which passes the Messages it's given into
+// itself, since they're sent in the background
+type chanSender chan notify.Message
+
+func (cs chanSender) Send(m notify.Message) error {
+	cs <- m
+	return nil
+}
+
+func TestNotifyFollowers(t *T) {
+	cmder := commontest.APIStarterKit()
+	s := broadcast.New(cmder)
+	s.Prefix = commontest.RandStr()
+	sender := make(chanSender, 2)
+	m := Mux(cmder, s, &MuxOpts{
+		Notify: sender,
+		Followers: func(broadcaster string) ([]Follower, error) {
+			return []Follower{
+				{User: broadcaster + "-fan", Email: "fan@example.com"},
+				{User: broadcaster + "-mom", Email: "mom@example.com"},
+			}, nil
+		},
+		WatchURL: "https://example.com/watch",
+	})
+
+	u := commontest.RandStr()
+	commontest.AssertReqJSON(t, m, "POST", "/start?_asUser="+u, "", &testStarted{})
+
+	for _, to := range []string{"fan@example.com", "mom@example.com"} {
+		select {
+		case msg := <-sender:
+			assert.Equal(t, notify.BroadcastLive.Kind, msg.Kind)
+			assert.Equal(t, to, msg.To)
+			assert.Contains(t, msg.Text, "https://example.com/watch?user="+u)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for notification to " + to)
+		}
+	}
+}
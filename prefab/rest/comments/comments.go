@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/mediocregopher/mediocre-api/comments"
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/common/config"
+	"github.com/mediocregopher/mediocre-api/prefab/rest/comments/commentsapi"
+	"github.com/mediocregopher/mediocre-api/user"
+)
+
+func main() {
+	c := config.New("comments")
+	c.AddListenAddr(":8086")
+	c.AddTLS()
+	c.AddRedis()
+	c.AddLogging()
+	c.Add(config.Param{
+		Name:        "max-length",
+		Description: "The maximum length of a comment, in bytes",
+		Default:     "10000",
+	})
+	c.Add(config.Param{
+		Name:        "check-users",
+		Description: "Only allow comments by users which exist in the user service's redis and aren't disabled. Requires using the same redis as the user service",
+		Flag:        true,
+	})
+	c.ParseOrExit()
+
+	logSink, err := c.Logging()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	maxLength, err := c.Int("max-length")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cmder, err := c.Redis()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	o := &comments.Opts{MaxLength: maxLength}
+	if c.Bool("check-users") {
+		o.Users = user.New(cmder)
+	}
+	s := comments.New(cmder, o)
+
+	m := commentsapi.Mux(cmder, s)
+	h := apihelper.RequestID(apihelper.AccessLog(m, &apihelper.AccessLogOpts{
+		Sink: logSink,
+		User: func(r *http.Request) string {
+			return r.URL.Query().Get("_asUser")
+		},
+	}))
+
+	if err := c.ListenAndServe(h); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,184 @@
+// Package commentsapi implements the REST interface served by the comments
+// prefab, so that it can also be mounted as part of another process
+package commentsapi
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mediocregopher/mediocre-api/comments"
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/pickyjson"
+	"github.com/mediocregopher/mediocre-api/user"
+)
+
+const bodySizeLimit = int64(64 * 1024)
+
+// ErrNotAuthd is returned when creating, editing, or deleting a comment
+// without the request being made on behalf of a user
+var ErrNotAuthd = common.ExpectedErr{Code: 400, ID: "not_authd", Err: "must be authenticated as a user"}
+
+// asUser returns the user the request is being made on behalf of, as set by
+// shield
+func asUser(r *http.Request) string {
+	return r.URL.Query().Get("_asUser")
+}
+
+// listParams are the query params taken in when listing comments
+var listParams = struct {
+	Parent pickyjson.Str   `json:"parent"`
+	Before time.Time       `json:"before"`
+	Limit  pickyjson.Int64 `json:"limit"`
+}{
+	Limit: pickyjson.Int64{Min: 1, Max: 100, Default: 20},
+}
+
+// createParams are the params taken in when creating a comment
+var createParams = struct {
+	Parent pickyjson.Str
+	Body   pickyjson.Str
+}{
+	Body: pickyjson.Str{}.Required(),
+}
+
+// editParams are the params taken in when editing a comment
+var editParams = struct {
+	Body pickyjson.Str
+}{
+	Body: pickyjson.Str{}.Required(),
+}
+
+// Mux takes in a common.Cmder and the comments.System using it, and returns an
+// http.Handler which implements the comment system as a rest interface. See
+// the comments prefab's README for more information on REST endpoints, which
+// are also described by the OpenAPI document served at /openapi.json
+func Mux(cmder common.Cmder, s *comments.System) http.Handler {
+	m := mux.NewRouter()
+	spec := apihelper.NewOpenAPI("comments", "1")
+	m.Path("/openapi.json").Handler(spec)
+
+	h := common.NewHealth()
+	h.Add("comment-store", common.CmderCheck(cmder))
+	m.Path("/healthz").Handler(h.Liveness())
+	m.Path("/readyz").Handler(h.Readiness())
+
+	// requireUser returns the user the request is being made on behalf of,
+	// or sends ErrNotAuthd and returns empty string if there isn't one
+	requireUser := func(w http.ResponseWriter, r *http.Request) string {
+		u := asUser(r)
+		if u == "" {
+			common.HTTPError(w, r, ErrNotAuthd)
+		}
+		return u
+	}
+
+	m.Path("/{entity}").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"GET": func(w http.ResponseWriter, r *http.Request) {
+			q := listParams
+			if !apihelper.PrepareQuery(w, r, &q) {
+				return
+			}
+			cc, err := s.List(mux.Vars(r)["entity"], q.Parent.Str, q.Before, int(q.Limit.Int64))
+			if err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+			// A short page is the last one, otherwise the next page is the
+			// comments created before the last one on this page
+			var cursor string
+			if len(cc) == int(q.Limit.Int64) {
+				cursor = cc[len(cc)-1].TSCreated.Format(time.RFC3339Nano)
+			}
+			apihelper.JSONPage(w, cc, cursor, -1)
+		},
+		"POST": func(w http.ResponseWriter, r *http.Request) {
+			u := requireUser(w, r)
+			if u == "" {
+				return
+			}
+			j := createParams
+			if !apihelper.Prepare(w, r, &j, bodySizeLimit) {
+				return
+			}
+			c, err := s.Create(mux.Vars(r)["entity"], j.Parent.Str, u, j.Body.Str)
+			if err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+			apihelper.JSONSuccess(w, &c)
+		},
+	}))
+	spec.Add("/{entity}", "GET", apihelper.Doc{
+		Summary:  "List an entity's top-level comments, or the replies to the parent comment if given, newest first. Only those created before the given time are listed, if one is given, and the returned cursor is the before time of the next page",
+		Query:    &listParams,
+		Response: &[]comments.Comment{},
+		Page:     true,
+	})
+	spec.Add("/{entity}", "POST", apihelper.Doc{
+		Summary:  "Comment on an entity, or reply to the parent comment if given, as the user",
+		Body:     &createParams,
+		AsUser:   true,
+		Response: &comments.Comment{},
+		Errors: []common.ExpectedErr{
+			ErrNotAuthd, comments.ErrNotFound, comments.ErrEmptyBody,
+			comments.ErrBodyTooLong, user.ErrNotFound, user.ErrDisabled,
+		},
+	})
+
+	m.Path("/{entity}/{id}").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"GET": func(w http.ResponseWriter, r *http.Request) {
+			vars := mux.Vars(r)
+			c, err := s.Get(vars["entity"], vars["id"])
+			if err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+			apihelper.JSONSuccess(w, &c)
+		},
+		"POST": func(w http.ResponseWriter, r *http.Request) {
+			u := requireUser(w, r)
+			if u == "" {
+				return
+			}
+			j := editParams
+			if !apihelper.Prepare(w, r, &j, bodySizeLimit) {
+				return
+			}
+			vars := mux.Vars(r)
+			common.HTTPError(w, r, s.Edit(vars["entity"], vars["id"], u, j.Body.Str))
+		},
+		"DELETE": func(w http.ResponseWriter, r *http.Request) {
+			u := requireUser(w, r)
+			if u == "" {
+				return
+			}
+			vars := mux.Vars(r)
+			common.HTTPError(w, r, s.Delete(vars["entity"], vars["id"], u))
+		},
+	}))
+	spec.Add("/{entity}/{id}", "GET", apihelper.Doc{
+		Summary:  "Get a single comment",
+		Response: &comments.Comment{},
+		Errors:   []common.ExpectedErr{comments.ErrNotFound},
+	})
+	spec.Add("/{entity}/{id}", "POST", apihelper.Doc{
+		Summary: "Edit one of the user's comments",
+		Body:    &editParams,
+		AsUser:  true,
+		Errors: []common.ExpectedErr{
+			ErrNotAuthd, comments.ErrNotFound, comments.ErrNotAuthor,
+			comments.ErrDeleted, comments.ErrEmptyBody, comments.ErrBodyTooLong,
+		},
+	})
+	spec.Add("/{entity}/{id}", "DELETE", apihelper.Doc{
+		Summary: "Delete one of the user's comments. Its replies are kept",
+		AsUser:  true,
+		Errors: []common.ExpectedErr{
+			ErrNotAuthd, comments.ErrNotFound, comments.ErrNotAuthor, comments.ErrDeleted,
+		},
+	})
+
+	return m
+}
@@ -0,0 +1,72 @@
+package commentsapi
+
+import (
+	"net/http"
+	"net/url"
+	. "testing"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/comments"
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testMux = func() http.Handler {
+	cmder := commontest.APIStarterKit()
+	s := comments.New(cmder, &comments.Opts{Prefix: commontest.RandStr()})
+	return Mux(cmder, s)
+}()
+
+func TestComments(t *T) {
+	entity, u := commontest.RandStr(), commontest.RandStr()
+	url1 := "/" + entity
+
+	commontest.AssertReqErr(t, testMux, "POST", url1, `{"Body":"hi"}`, ErrNotAuthd)
+
+	var c comments.Comment
+	commontest.AssertReqJSON(t, testMux, "POST", url1+"?_asUser="+u, `{"Body":"hi"}`, &c)
+	assert.Equal(t, u, c.User)
+	assert.Equal(t, "hi", c.Body)
+
+	var reply comments.Comment
+	body := `{"Parent":"` + c.ID + `","Body":"hello"}`
+	commontest.AssertReqJSON(t, testMux, "POST", url1+"?_asUser="+u, body, &reply)
+	assert.Equal(t, c.ID, reply.Parent)
+
+	var l []comments.Comment
+	page := commontest.Page{Data: &l}
+	commontest.AssertReqJSON(t, testMux, "GET", url1, "", &page)
+	require.Len(t, l, 1)
+	assert.Equal(t, c.ID, l[0].ID)
+	assert.Equal(t, int64(1), l[0].Replies)
+	assert.Empty(t, page.Meta.Cursor)
+
+	commontest.AssertReqJSON(t, testMux, "GET", url1+"?parent="+c.ID, "", &page)
+	require.Len(t, l, 1)
+	assert.Equal(t, reply.ID, l[0].ID)
+
+	// A full page's cursor gets the next one
+	commontest.AssertReqJSON(t, testMux, "GET", url1+"?limit=1", "", &page)
+	require.Len(t, l, 1)
+	assert.Equal(t, c.TSCreated.Format(time.RFC3339Nano), page.Meta.Cursor)
+	before := url.QueryEscape(page.Meta.Cursor)
+	commontest.AssertReqJSON(t, testMux, "GET", url1+"?before="+before, "", &page)
+	assert.Empty(t, l)
+	assert.Empty(t, page.Meta.Cursor)
+
+	urlC := url1 + "/" + c.ID
+	commontest.AssertReqErr(t, testMux, "POST", urlC+"?_asUser=foo", `{"Body":"bye"}`, comments.ErrNotAuthor)
+	commontest.AssertReq(t, testMux, "POST", urlC+"?_asUser="+u, `{"Body":"bye"}`, "")
+
+	var cGot comments.Comment
+	commontest.AssertReqJSON(t, testMux, "GET", urlC, "", &cGot)
+	assert.Equal(t, "bye", cGot.Body)
+
+	commontest.AssertReqErr(t, testMux, "DELETE", urlC, "", ErrNotAuthd)
+	commontest.AssertReq(t, testMux, "DELETE", urlC+"?_asUser="+u, "", "")
+	commontest.AssertReqJSON(t, testMux, "GET", urlC, "", &cGot)
+	assert.True(t, cGot.Deleted)
+
+	commontest.AssertReqErr(t, testMux, "GET", url1+"/nope", "", comments.ErrNotFound)
+}
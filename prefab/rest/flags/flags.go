@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/common/config"
+	"github.com/mediocregopher/mediocre-api/flags"
+	"github.com/mediocregopher/mediocre-api/prefab/rest/flags/flagsapi"
+	"github.com/mediocregopher/mediocre-api/user"
+)
+
+func main() {
+	c := config.New("flags")
+	c.AddListenAddr(":8084")
+	c.AddTLS()
+	c.AddRedis()
+	c.AddLogging()
+	c.Add(config.Param{
+		Name:        "admin-token",
+		Description: "Token which must be given as a bearer token to use the /admin/ endpoints. Leave blank to disable them",
+	})
+	c.Add(config.Param{
+		Name:        "check-users",
+		Description: "Only allow flags to be overridden for users which exist in the user service's redis. Requires using the same redis as the user service",
+		Flag:        true,
+	})
+	c.ParseOrExit()
+
+	logSink, err := c.Logging()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cmder, err := c.Redis()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	o := &flags.Opts{}
+	if c.Bool("check-users") {
+		o.Users = user.New(cmder)
+	}
+	s := flags.New(cmder, o)
+
+	m := flagsapi.Mux(cmder, s, &flagsapi.MuxOpts{AdminToken: c.Str("admin-token")})
+	h := apihelper.RequestID(apihelper.AccessLog(m, &apihelper.AccessLogOpts{
+		Sink: logSink,
+		User: func(r *http.Request) string {
+			return r.URL.Query().Get("_asUser")
+		},
+	}))
+
+	if err := c.ListenAndServe(h); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,217 @@
+// Package flagsapi implements the REST interface served by the flags prefab, so
+// that it can also be mounted as part of another process
+package flagsapi
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/flags"
+	"github.com/mediocregopher/mediocre-api/pickyjson"
+	"github.com/mediocregopher/mediocre-api/user"
+)
+
+const bodySizeLimit = int64(4 * 1024)
+
+// asUser returns the user the request is being made on behalf of, as set by
+// shield
+func asUser(r *http.Request) string {
+	return r.URL.Query().Get("_asUser")
+}
+
+// flagState is what's returned when evaluating a single flag
+type flagState struct {
+	Name string
+	On   bool
+}
+
+// MuxOpts are different options which may be passed into Mux. They all
+// have sane defaults which will cover most use cases
+type MuxOpts struct {
+
+	// If set, the /admin/ endpoints are enabled, and requests to them must
+	// have an "Authorization: Bearer <AdminToken>" header. Defaults to empty
+	// string (disabled)
+	AdminToken string
+}
+
+// Mux takes in a common.Cmder and the flags.System using it, and returns an
+// http.Handler which implements the flag system as a rest interface. See the
+// flags prefab's README for more information on REST endpoints, which are also
+// described by the OpenAPI document served at /openapi.json. The passed in
+// MuxOpts may be nil to just use the defaults
+func Mux(cmder common.Cmder, s *flags.System, o *MuxOpts) http.Handler {
+	if o == nil {
+		o = &MuxOpts{}
+	}
+
+	m := mux.NewRouter()
+	spec := apihelper.NewOpenAPI("flags", "1")
+	m.Path("/openapi.json").Handler(spec)
+
+	h := common.NewHealth()
+	h.Add("flag-store", common.CmderCheck(cmder))
+	m.Path("/healthz").Handler(h.Liveness())
+	m.Path("/readyz").Handler(h.Readiness())
+
+	if o.AdminToken != "" {
+		adminRoutes(m.PathPrefix("/admin").Subrouter(), spec, s, o.AdminToken)
+	}
+
+	m.Path("/evaluate").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"GET": func(w http.ResponseWriter, r *http.Request) {
+			fm, err := s.EvaluateAll(asUser(r))
+			if err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+			apihelper.JSONSuccess(w, &fm)
+		},
+	}))
+	spec.Add("/evaluate", "GET", apihelper.Doc{
+		Summary:  "Get whether each flag is on for the user, or for anonymous users if there isn't one",
+		AsUser:   true,
+		Response: &map[string]bool{},
+	})
+
+	m.Path("/evaluate/{flag}").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"GET": func(w http.ResponseWriter, r *http.Request) {
+			name := mux.Vars(r)["flag"]
+			on, err := s.Evaluate(asUser(r), name)
+			if err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+			apihelper.JSONSuccess(w, &flagState{Name: name, On: on})
+		},
+	}))
+	spec.Add("/evaluate/{flag}", "GET", apihelper.Doc{
+		Summary:  "Get whether a flag is on for the user, or for anonymous users if there isn't one. Flags which don't exist are off",
+		AsUser:   true,
+		Response: &flagState{},
+	})
+
+	return m
+}
+
+// flagParams are the params taken in when setting a flag
+var flagParams = struct {
+	On      bool
+	Percent pickyjson.Int64
+}{
+	Percent: pickyjson.Int64{Max: 100},
+}
+
+// overrideParams are the params taken in when overriding a flag for a user
+var overrideParams = struct {
+	On bool
+}{}
+
+// adminRoutes adds the admin endpoints to the given Router, which should be a
+// subrouter for the /admin path prefix, and describes them in the given
+// OpenAPI document
+func adminRoutes(m *mux.Router, spec *apihelper.OpenAPI, s *flags.System, token string) {
+	handle := func(
+		path string,
+		handlers map[string]http.HandlerFunc,
+		docs map[string]apihelper.Doc,
+	) {
+		m.Path(path).Handler(apihelper.RequireBearer(token, apihelper.Methods(handlers)))
+		for method, d := range docs {
+			d.Errors = append(d.Errors, apihelper.ErrNotAdmin)
+			spec.Add("/admin"+path, method, d)
+		}
+	}
+
+	handle("/flags", map[string]http.HandlerFunc{
+		"GET": func(w http.ResponseWriter, r *http.Request) {
+			fl, err := s.List()
+			if err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+			apihelper.JSONPage(w, fl, "", int64(len(fl)))
+		},
+	}, map[string]apihelper.Doc{
+		"GET": {Summary: "List all flags", Response: &[]flags.Flag{}, Page: true},
+	})
+
+	handle("/flags/{flag}", map[string]http.HandlerFunc{
+		"GET": func(w http.ResponseWriter, r *http.Request) {
+			f, err := s.Get(mux.Vars(r)["flag"])
+			if err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+			apihelper.JSONSuccess(w, &f)
+		},
+		"PUT": func(w http.ResponseWriter, r *http.Request) {
+			j := flagParams
+			if !apihelper.Prepare(w, r, &j, bodySizeLimit) {
+				return
+			}
+			common.HTTPError(w, r, s.Set(flags.Flag{
+				Name:    mux.Vars(r)["flag"],
+				On:      j.On,
+				Percent: j.Percent.Int64,
+			}))
+		},
+		"DELETE": func(w http.ResponseWriter, r *http.Request) {
+			common.HTTPError(w, r, s.Delete(mux.Vars(r)["flag"]))
+		},
+	}, map[string]apihelper.Doc{
+		"GET": {
+			Summary:  "Get a flag",
+			Response: &flags.Flag{},
+			Errors:   []common.ExpectedErr{flags.ErrNotFound},
+		},
+		"PUT": {
+			Summary: "Create or replace a flag. Its overrides are kept",
+			Body:    &flagParams,
+		},
+		"DELETE": {
+			Summary: "Delete a flag and all of its overrides",
+			Errors:  []common.ExpectedErr{flags.ErrNotFound},
+		},
+	})
+
+	handle("/flags/{flag}/overrides", map[string]http.HandlerFunc{
+		"GET": func(w http.ResponseWriter, r *http.Request) {
+			o, err := s.Overrides(mux.Vars(r)["flag"])
+			if err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+			apihelper.JSONSuccess(w, &o)
+		},
+	}, map[string]apihelper.Doc{
+		"GET": {
+			Summary:  "Get the users a flag has been overridden for, and whether it's on for each",
+			Response: &map[string]bool{},
+		},
+	})
+
+	handle("/flags/{flag}/overrides/{user}", map[string]http.HandlerFunc{
+		"PUT": func(w http.ResponseWriter, r *http.Request) {
+			j := overrideParams
+			if !apihelper.Prepare(w, r, &j, bodySizeLimit) {
+				return
+			}
+			vars := mux.Vars(r)
+			common.HTTPError(w, r, s.SetOverride(vars["flag"], vars["user"], j.On))
+		},
+		"DELETE": func(w http.ResponseWriter, r *http.Request) {
+			vars := mux.Vars(r)
+			common.HTTPError(w, r, s.ClearOverride(vars["flag"], vars["user"]))
+		},
+	}, map[string]apihelper.Doc{
+		"PUT": {
+			Summary: "Set whether a flag is on for a user, regardless of the flag's settings",
+			Body:    &overrideParams,
+			Errors:  []common.ExpectedErr{flags.ErrNotFound, user.ErrNotFound},
+		},
+		"DELETE": {Summary: "Remove a flag's override for a user"},
+	})
+}
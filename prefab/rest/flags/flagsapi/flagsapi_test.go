@@ -0,0 +1,89 @@
+package flagsapi
+
+import (
+	"net/http"
+	. "testing"
+
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/mediocregopher/mediocre-api/flags"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAdminToken = "admin-token"
+
+var testAdminOpts = &commontest.ReqOpts{
+	Header: http.Header{"Authorization": {"Bearer " + testAdminToken}},
+}
+
+var testMux = func() http.Handler {
+	cmder := commontest.APIStarterKit()
+	s := flags.New(cmder, &flags.Opts{Prefix: commontest.RandStr()})
+	return Mux(cmder, s, &MuxOpts{AdminToken: testAdminToken})
+}()
+
+func assertEvaluate(t *T, name, u string, on bool) {
+	var fs flagState
+	commontest.AssertReqJSON(t, testMux, "GET", "/evaluate/"+name+"?_asUser="+u, "", &fs)
+	assert.Equal(t, flagState{Name: name, On: on}, fs)
+}
+
+func TestAdminAuth(t *T) {
+	commontest.AssertReqErr(t, testMux, "GET", "/admin/flags", "", apihelper.ErrNotAdmin)
+
+	// Without a token the endpoints aren't there at all
+	m := Mux(commontest.APIStarterKit(), flags.New(commontest.APIStarterKit(), nil), nil)
+	code, _ := commontest.Req(t, m, "GET", "/admin/flags", "")
+	assert.Equal(t, 404, code)
+}
+
+func TestFlags(t *T) {
+	name, u := commontest.RandStr(), commontest.RandStr()
+	url := "/admin/flags/" + name
+	assertEvaluate(t, name, u, false)
+	commontest.AssertReqErrWith(t, testMux, "GET", url, "", testAdminOpts, flags.ErrNotFound)
+
+	commontest.AssertReqWith(t, testMux, "PUT", url, `{"On":true}`, testAdminOpts, "")
+	var f flags.Flag
+	commontest.AssertReqJSONWith(t, testMux, "GET", url, "", testAdminOpts, &f)
+	assert.Equal(t, flags.Flag{Name: name, On: true}, f)
+	assertEvaluate(t, name, u, true)
+	assertEvaluate(t, name, "", true)
+
+	var fl []flags.Flag
+	commontest.AssertReqJSONWith(t, testMux, "GET", "/admin/flags", "", testAdminOpts, &commontest.Page{Data: &fl})
+	assert.Contains(t, fl, f)
+
+	resp := commontest.ReqWith(t, testMux, "PUT", url, `{"Percent":101}`, testAdminOpts)
+	assert.Equal(t, 400, resp.Code)
+
+	commontest.AssertReqWith(t, testMux, "PUT", url, `{"Percent":100}`, testAdminOpts, "")
+	assertEvaluate(t, name, u, true)
+	assertEvaluate(t, name, "", false)
+
+	var m map[string]bool
+	commontest.AssertReqJSON(t, testMux, "GET", "/evaluate?_asUser="+u, "", &m)
+	assert.True(t, m[name])
+
+	commontest.AssertReqWith(t, testMux, "DELETE", url, "", testAdminOpts, "")
+	commontest.AssertReqErrWith(t, testMux, "DELETE", url, "", testAdminOpts, flags.ErrNotFound)
+	assertEvaluate(t, name, u, false)
+}
+
+func TestOverrides(t *T) {
+	name, u := commontest.RandStr(), commontest.RandStr()
+	url := "/admin/flags/" + name + "/overrides/" + u
+
+	commontest.AssertReqErrWith(t, testMux, "PUT", url, `{"On":true}`, testAdminOpts, flags.ErrNotFound)
+
+	commontest.AssertReqWith(t, testMux, "PUT", "/admin/flags/"+name, `{}`, testAdminOpts, "")
+	commontest.AssertReqWith(t, testMux, "PUT", url, `{"On":true}`, testAdminOpts, "")
+	assertEvaluate(t, name, u, true)
+
+	var m map[string]bool
+	commontest.AssertReqJSONWith(t, testMux, "GET", "/admin/flags/"+name+"/overrides", "", testAdminOpts, &m)
+	assert.Equal(t, map[string]bool{u: true}, m)
+
+	commontest.AssertReqWith(t, testMux, "DELETE", url, "", testAdminOpts, "")
+	assertEvaluate(t, name, u, false)
+}
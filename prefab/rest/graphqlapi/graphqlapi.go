@@ -0,0 +1,111 @@
+// Package graphqlapi implements a GraphQL endpoint over the user, room, and
+// broadcast Systems, for clients which would rather make one flexible query
+// than call each REST prefab separately. Like the REST prefabs it expects to
+// be wrapped by an auth.API, and takes the logged in user (the "viewer") from
+// the _asUser GET parameter
+package graphqlapi
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/room"
+	"github.com/mediocregopher/mediocre-api/room/broadcast"
+	"github.com/mediocregopher/mediocre-api/user"
+)
+
+// ErrNotAuthd is returned from all mutations if the request isn't being made
+// on behalf of a user
+var ErrNotAuthd = common.ExpectedErr{Code: 400, ID: "not_authd", Err: "must be authenticated as a user"}
+
+// Requests are only made up of a query and its variables, so they don't need
+// to be large
+const bodySizeLimit = int64(64 * 1024)
+
+// maxDepth limits how deeply queries can nest fields, so that a single request
+// can't cause an unbounded number of lookups (e.g. via broadcast.user.broadcast)
+const maxDepth = 8
+
+type viewerKey struct{}
+
+// viewer returns the user the request is being made on behalf of, as set on
+// the context by Handler
+func viewer(ctx context.Context) string {
+	u, _ := ctx.Value(viewerKey{}).(string)
+	return u
+}
+
+// Handler returns an http.Handler which serves GraphQL queries and mutations
+// over the given Systems. Requests must be POSTs with a json body containing
+// "query", and optionally "operationName" and "variables". See the allinone
+// prefab's README for the schema
+func Handler(us *user.System, rs *room.System, bs *broadcast.System) http.Handler {
+	s := graphql.MustParseSchema(
+		schema,
+		&resolver{us: us, rs: rs, bs: bs},
+		graphql.MaxDepth(maxDepth),
+	)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if apihelper.ErrUnlessMethod(w, r, "POST") {
+			return
+		}
+
+		var params struct {
+			Query         string                 `json:"query"`
+			OperationName string                 `json:"operationName"`
+			Variables     map[string]interface{} `json:"variables"`
+		}
+		b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, bodySizeLimit))
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		} else if err := json.Unmarshal(b, &params); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), viewerKey{}, r.URL.Query().Get("_asUser"))
+		res := s.Exec(ctx, params.Query, params.OperationName, params.Variables)
+		apihelper.JSONSuccess(w, res)
+	})
+}
+
+// gqlErr is returned from resolvers in place of an ExpectedErr, so that the
+// error's code and id are included in the response as extensions
+type gqlErr struct {
+	common.ExpectedErr
+}
+
+// Extensions implements graphql-go's ResolverError interface
+func (e gqlErr) Extensions() map[string]interface{} {
+	ext := map[string]interface{}{"code": e.Code}
+	if e.ID != "" {
+		ext["id"] = e.ID
+	}
+	return ext
+}
+
+// resolverErr converts the given error into one suitable for returning from a
+// resolver. Errors which aren't ExpectedErrs are logged and replaced with
+// common.ErrUnknown, the same as common.HTTPError would do
+func resolverErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	eerr, ok := common.AsExpected(err)
+	if !ok {
+		if common.Log != nil {
+			common.Log.Printf("graphql: %s", err)
+		}
+		eerr = common.ErrUnknown
+	} else if cause := eerr.Unwrap(); cause != nil && common.Log != nil {
+		common.Log.Printf("graphql: %s: %s", eerr.Error(), cause)
+	}
+	return gqlErr{eerr}
+}
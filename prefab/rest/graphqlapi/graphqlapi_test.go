@@ -0,0 +1,140 @@
+package graphqlapi
+
+import (
+	"encoding/json"
+	"net/http"
+	. "testing"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/mediocregopher/mediocre-api/room"
+	"github.com/mediocregopher/mediocre-api/room/broadcast"
+	"github.com/mediocregopher/mediocre-api/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testUsers, testBroadcasts, testHandler = func() (*user.System, *broadcast.System, http.Handler) {
+	cmder := commontest.APIStarterKit()
+	us := user.New(cmder)
+	us.Prefix = commontest.RandStr()
+	us.BCryptCost = 4
+	rs := room.New(cmder, &room.Opts{
+		Prefix:        commontest.RandStr(),
+		CheckInPeriod: 1 * time.Second,
+	})
+	bs := broadcast.New(cmder)
+	bs.Prefix = commontest.RandStr()
+	return us, bs, Handler(us, rs, bs)
+}()
+
+type gqlRes struct {
+	Data   map[string]interface{}
+	Errors []struct {
+		Message    string
+		Extensions map[string]interface{}
+	}
+}
+
+// query makes the given query as the given user (if any) and returns the
+// response
+func query(t *T, asUser, q string, vars map[string]interface{}) gqlRes {
+	body, err := json.Marshal(map[string]interface{}{"query": q, "variables": vars})
+	require.Nil(t, err)
+	path := "/"
+	if asUser != "" {
+		path += "?_asUser=" + asUser
+	}
+	var res gqlRes
+	commontest.AssertReqJSON(t, testHandler, "POST", path, string(body), &res)
+	return res
+}
+
+func newUser(t *T) string {
+	u := commontest.RandStr()
+	require.Nil(t, testUsers.Create(u, commontest.RandEmail(), "password"))
+	return u
+}
+
+func TestUser(t *T) {
+	u := newUser(t)
+	q := `query($name: String!) { user(name: $name) { name email: field(name: "Email") } }`
+	vars := map[string]interface{}{"name": u}
+
+	res := query(t, "", q, vars)
+	require.Empty(t, res.Errors)
+	assert.Equal(t, map[string]interface{}{"name": u, "email": nil}, res.Data["user"])
+
+	// The user can see their own private fields
+	res = query(t, u, q, vars)
+	require.Empty(t, res.Errors)
+	assert.NotNil(t, res.Data["user"].(map[string]interface{})["email"])
+
+	res = query(t, "", q, map[string]interface{}{"name": commontest.RandStr()})
+	require.Empty(t, res.Errors)
+	assert.Nil(t, res.Data["user"])
+
+	res = query(t, "", `{ viewer { name } }`, nil)
+	assert.Nil(t, res.Data["viewer"])
+	res = query(t, u, `{ viewer { name } }`, nil)
+	assert.Equal(t, map[string]interface{}{"name": u}, res.Data["viewer"])
+}
+
+func TestSetUser(t *T) {
+	u := newUser(t)
+	m := `mutation { setUser(fields: [{name: "Email", value: "foo@example.com"}]) { email: field(name: "Email") } }`
+
+	res := query(t, "", m, nil)
+	require.Len(t, res.Errors, 1)
+	assert.Equal(t, ErrNotAuthd.Err, res.Errors[0].Message)
+	assert.Equal(t, ErrNotAuthd.ID, res.Errors[0].Extensions["id"])
+
+	res = query(t, u, m, nil)
+	require.Empty(t, res.Errors)
+	assert.Equal(t, map[string]interface{}{"email": "foo@example.com"}, res.Data["setUser"])
+
+	res = query(t, u, `mutation { setUser(fields: [{name: "Name", value: "foo"}]) { name } }`, nil)
+	require.Len(t, res.Errors, 1)
+	assert.Equal(t, "field_not_editable", res.Errors[0].Extensions["id"])
+}
+
+func TestRoom(t *T) {
+	u, rm := newUser(t), commontest.RandStr()
+	vars := map[string]interface{}{"room": rm}
+
+	res := query(t, "", `mutation($room: String!) { checkIn(room: $room) { name } }`, vars)
+	require.Len(t, res.Errors, 1)
+	assert.Equal(t, ErrNotAuthd.ID, res.Errors[0].Extensions["id"])
+
+	res = query(t, u, `mutation($room: String!) { checkIn(room: $room) { cardinality members } }`, vars)
+	require.Empty(t, res.Errors)
+	assert.Equal(t, map[string]interface{}{
+		"cardinality": float64(1),
+		"members":     []interface{}{u},
+	}, res.Data["checkIn"])
+
+	res = query(t, u, `mutation($room: String!) { checkOut(room: $room) { cardinality } }`, vars)
+	require.Empty(t, res.Errors)
+	assert.Equal(t, map[string]interface{}{"cardinality": float64(0)}, res.Data["checkOut"])
+}
+
+func TestBroadcasts(t *T) {
+	u := newUser(t)
+	id, _, err := testBroadcasts.StartBroadcast(u)
+	require.Nil(t, err)
+
+	res := query(t, "", `{ activeBroadcasts { id user { name broadcast { id } } } }`, nil)
+	require.Empty(t, res.Errors)
+	assert.Contains(t, res.Data["activeBroadcasts"], map[string]interface{}{
+		"id": string(id),
+		"user": map[string]interface{}{
+			"name":      u,
+			"broadcast": map[string]interface{}{"id": string(id)},
+		},
+	})
+}
+
+func TestMethod(t *T) {
+	code, _ := commontest.Req(t, testHandler, "GET", "/", "")
+	assert.Equal(t, 405, code)
+}
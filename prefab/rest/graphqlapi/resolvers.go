@@ -0,0 +1,191 @@
+package graphqlapi
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/mediocregopher/mediocre-api/room"
+	"github.com/mediocregopher/mediocre-api/room/broadcast"
+	"github.com/mediocregopher/mediocre-api/user"
+)
+
+// resolver is the root resolver, resolving the fields of both Query and
+// Mutation
+type resolver struct {
+	us *user.System
+	rs *room.System
+	bs *broadcast.System
+}
+
+// getUser returns the resolver for the given user, or nil if they don't exist
+func (r *resolver) getUser(ctx context.Context, name string) (*userResolver, error) {
+	var filter user.FieldFlag
+	if name == viewer(ctx) {
+		filter |= user.Private
+	}
+	info, err := r.us.Get(name, filter)
+	if errors.Is(err, user.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, resolverErr(err)
+	}
+	return &userResolver{r: r, name: name, info: info}, nil
+}
+
+func (r *resolver) Viewer(ctx context.Context) (*userResolver, error) {
+	v := viewer(ctx)
+	if v == "" {
+		return nil, nil
+	}
+	return r.getUser(ctx, v)
+}
+
+func (r *resolver) User(ctx context.Context, args struct{ Name string }) (*userResolver, error) {
+	return r.getUser(ctx, args.Name)
+}
+
+func (r *resolver) Room(args struct{ Name string }) *roomResolver {
+	return &roomResolver{r: r, name: args.Name}
+}
+
+func (r *resolver) ActiveBroadcasts() ([]*broadcastResolver, error) {
+	ids, err := r.bs.Active()
+	if err != nil {
+		return nil, resolverErr(err)
+	}
+	brs := make([]*broadcastResolver, len(ids))
+	for i, id := range ids {
+		brs[i] = &broadcastResolver{r: r, id: id}
+	}
+	return brs, nil
+}
+
+func (r *resolver) SetUser(ctx context.Context, args struct {
+	Fields []struct{ Name, Value string }
+}) (*userResolver, error) {
+	v := viewer(ctx)
+	if v == "" {
+		return nil, resolverErr(ErrNotAuthd)
+	}
+	info := user.Info{}
+	for _, f := range args.Fields {
+		info[f.Name] = f.Value
+	}
+	if err := r.us.Set(v, info); err != nil {
+		return nil, resolverErr(err)
+	}
+	u, err := r.getUser(ctx, v)
+	if err == nil && u == nil {
+		err = resolverErr(user.ErrNotFound)
+	}
+	return u, err
+}
+
+func (r *resolver) CheckIn(ctx context.Context, args struct{ Room string }) (*roomResolver, error) {
+	v := viewer(ctx)
+	if v == "" {
+		return nil, resolverErr(ErrNotAuthd)
+	}
+	if err := r.rs.CheckIn(args.Room, v); err != nil {
+		return nil, resolverErr(err)
+	}
+	return &roomResolver{r: r, name: args.Room}, nil
+}
+
+func (r *resolver) CheckOut(ctx context.Context, args struct{ Room string }) (*roomResolver, error) {
+	v := viewer(ctx)
+	if v == "" {
+		return nil, resolverErr(ErrNotAuthd)
+	}
+	if err := r.rs.CheckOut(args.Room, v); err != nil {
+		return nil, resolverErr(err)
+	}
+	return &roomResolver{r: r, name: args.Room}, nil
+}
+
+type userResolver struct {
+	r    *resolver
+	name string
+	info user.Info
+}
+
+func (u *userResolver) Name() string {
+	return u.name
+}
+
+// field describes a single one of a user's fields
+type field struct {
+	name, value string
+}
+
+func (f field) Name() string  { return f.name }
+func (f field) Value() string { return f.value }
+
+func (u *userResolver) Fields() []field {
+	fields := make([]field, 0, len(u.info))
+	for name, value := range u.info {
+		if value != "" {
+			fields = append(fields, field{name, value})
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].name < fields[j].name
+	})
+	return fields
+}
+
+func (u *userResolver) Field(args struct{ Name string }) *string {
+	if v := u.info[args.Name]; v != "" {
+		return &v
+	}
+	return nil
+}
+
+func (u *userResolver) Broadcast() (*broadcastResolver, error) {
+	id, err := u.r.bs.GetBroadcastID(u.name)
+	if err != nil {
+		return nil, resolverErr(err)
+	} else if id == "" {
+		return nil, nil
+	}
+	return &broadcastResolver{r: u.r, id: id}, nil
+}
+
+type roomResolver struct {
+	r    *resolver
+	name string
+}
+
+func (rm *roomResolver) Name() string {
+	return rm.name
+}
+
+func (rm *roomResolver) Cardinality() (int32, error) {
+	n, err := rm.r.rs.Cardinality(rm.name)
+	return int32(n), resolverErr(err)
+}
+
+func (rm *roomResolver) Members() ([]string, error) {
+	members, err := rm.r.rs.Members(rm.name)
+	if err != nil {
+		return nil, resolverErr(err)
+	} else if members == nil {
+		members = []string{}
+	}
+	return members, nil
+}
+
+type broadcastResolver struct {
+	r  *resolver
+	id broadcast.ID
+}
+
+func (b *broadcastResolver) ID() graphql.ID {
+	return graphql.ID(b.id)
+}
+
+func (b *broadcastResolver) User(ctx context.Context) (*userResolver, error) {
+	return b.r.getUser(ctx, b.id.User())
+}
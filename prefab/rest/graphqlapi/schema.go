@@ -0,0 +1,75 @@
+package graphqlapi
+
+// schema is the GraphQL schema served by Handler
+const schema = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+type Query {
+	# The user the request is being made as, or null if it isn't made as one
+	viewer: User
+
+	# The user with the given name, or null if there isn't one
+	user(name: String!): User
+
+	room(name: String!): Room!
+
+	# All broadcasts which are currently going
+	activeBroadcasts: [Broadcast!]!
+}
+
+type Mutation {
+	# Sets the given editable fields on the viewer, e.g. their Email
+	setUser(fields: [FieldInput!]!): User!
+
+	# Checks the viewer in to the room
+	checkIn(room: String!): Room!
+
+	# Checks the viewer out of the room
+	checkOut(room: String!): Room!
+}
+
+type User {
+	name: String!
+
+	# The user's fields. Private fields, e.g. Email, are only included for the
+	# viewer
+	fields: [Field!]!
+
+	# The value of the field with the given name, or null if it isn't set or
+	# can't be seen
+	field(name: String!): String
+
+	# The user's current broadcast, or null if they aren't broadcasting
+	broadcast: Broadcast
+}
+
+type Field {
+	name: String!
+	value: String!
+}
+
+input FieldInput {
+	name: String!
+	value: String!
+}
+
+type Room {
+	name: String!
+
+	# The number of users currently in the room
+	cardinality: Int!
+
+	# The names of the users currently in the room
+	members: [String!]!
+}
+
+type Broadcast {
+	id: ID!
+
+	# The broadcasting user, or null if they no longer exist
+	user: User
+}
+`
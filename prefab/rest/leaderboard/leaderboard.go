@@ -0,0 +1,69 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/common/config"
+	"github.com/mediocregopher/mediocre-api/leaderboard"
+	"github.com/mediocregopher/mediocre-api/prefab/rest/leaderboard/leaderboardapi"
+)
+
+func main() {
+	c := config.New("leaderboard")
+	c.AddListenAddr(":8085")
+	c.AddTLS()
+	c.AddRedis()
+	c.AddLogging()
+	c.Add(config.Param{
+		Name:        "admin-token",
+		Description: "Token which must be given as a bearer token to use the /admin/ endpoints, which change scores. Leave blank to disable them",
+	})
+	c.Add(config.Param{
+		Name:        "retain",
+		Description: "How many daily, weekly, and monthly boards before the current ones are kept",
+		Default:     "1",
+	})
+	c.Add(config.Param{
+		Name:        "timezone",
+		Description: "Timezone which decides when days, weeks, and months begin, e.g. America/New_York",
+		Default:     "UTC",
+	})
+	c.ParseOrExit()
+
+	logSink, err := c.Logging()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	retain, err := c.Int("retain")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	loc, err := time.LoadLocation(c.Str("timezone"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cmder, err := c.Redis()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s := leaderboard.New(cmder, &leaderboard.Opts{Retain: retain, Location: loc})
+
+	m := leaderboardapi.Mux(cmder, s, &leaderboardapi.MuxOpts{AdminToken: c.Str("admin-token")})
+	h := apihelper.RequestID(apihelper.AccessLog(m, &apihelper.AccessLogOpts{
+		Sink: logSink,
+		User: func(r *http.Request) string {
+			return r.URL.Query().Get("_asUser")
+		},
+	}))
+
+	if err := c.ListenAndServe(h); err != nil {
+		log.Fatal(err)
+	}
+}
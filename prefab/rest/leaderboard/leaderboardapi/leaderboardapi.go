@@ -0,0 +1,187 @@
+// Package leaderboardapi implements the REST interface served by the leaderboard
+// prefab, so that it can also be mounted as part of another process
+package leaderboardapi
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/leaderboard"
+	"github.com/mediocregopher/mediocre-api/pickyjson"
+)
+
+const bodySizeLimit = int64(4 * 1024)
+
+// topParams are the query params taken in when getting the top of a board
+var topParams = struct {
+	N pickyjson.Int64 `json:"n"`
+}{
+	N: pickyjson.Int64{Min: 1, Max: 100, Default: 10},
+}
+
+// neighborsParams are the query params taken in when getting a user's
+// neighbors on a board
+var neighborsParams = struct {
+	N pickyjson.Int64 `json:"n"`
+}{
+	N: pickyjson.Int64{Min: 1, Max: 50, Default: 5},
+}
+
+// incrParams are the params taken in when incrementing a user's score
+var incrParams = struct {
+	By float64
+}{}
+
+// MuxOpts are different options which may be passed into Mux. They all
+// have sane defaults which will cover most use cases
+type MuxOpts struct {
+
+	// If set, the /admin/ endpoints are enabled, and requests to them must
+	// have an "Authorization: Bearer <AdminToken>" header. Defaults to empty
+	// string (disabled)
+	AdminToken string
+}
+
+// Mux takes in a common.Cmder and the leaderboard.System using it, and returns
+// an http.Handler which implements the leaderboard system as a rest interface.
+// See the leaderboard prefab's README for more information on REST endpoints,
+// which are also described by the OpenAPI document served at /openapi.json.
+// The passed in MuxOpts may be nil to just use the defaults
+func Mux(cmder common.Cmder, s *leaderboard.System, o *MuxOpts) http.Handler {
+	if o == nil {
+		o = &MuxOpts{}
+	}
+
+	m := mux.NewRouter()
+	spec := apihelper.NewOpenAPI("leaderboard", "1")
+	m.Path("/openapi.json").Handler(spec)
+
+	h := common.NewHealth()
+	h.Add("leaderboard-store", common.CmderCheck(cmder))
+	m.Path("/healthz").Handler(h.Liveness())
+	m.Path("/readyz").Handler(h.Readiness())
+
+	if o.AdminToken != "" {
+		adminRoutes(m.PathPrefix("/admin").Subrouter(), spec, s, o.AdminToken)
+	}
+
+	// boardHandler calls fn with the Board for the {board} and {period} in the
+	// request's path
+	boardHandler := func(fn func(http.ResponseWriter, *http.Request, *leaderboard.Board)) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			vars := mux.Vars(r)
+			p, err := leaderboard.ParsePeriod(vars["period"])
+			if err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+			fn(w, r, s.Board(vars["board"], p))
+		}
+	}
+
+	m.Path("/{board}/{period}").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"GET": boardHandler(func(w http.ResponseWriter, r *http.Request, b *leaderboard.Board) {
+			q := topParams
+			if !apihelper.PrepareQuery(w, r, &q) {
+				return
+			}
+			ee, err := b.Top(int(q.N.Int64))
+			if err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+			apihelper.JSONPage(w, ee, "", -1)
+		}),
+	}))
+	spec.Add("/{board}/{period}", "GET", apihelper.Doc{
+		Summary:  "Get the users with the highest scores on the current window of a board. period is one of all, daily, weekly, or monthly",
+		Query:    &topParams,
+		Response: &[]leaderboard.Entry{},
+		Page:     true,
+		Errors:   []common.ExpectedErr{leaderboard.ErrUnknownPeriod},
+	})
+
+	m.Path("/{board}/{period}/{user}").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"GET": boardHandler(func(w http.ResponseWriter, r *http.Request, b *leaderboard.Board) {
+			e, err := b.Rank(mux.Vars(r)["user"])
+			if err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+			apihelper.JSONSuccess(w, &e)
+		}),
+	}))
+	spec.Add("/{board}/{period}/{user}", "GET", apihelper.Doc{
+		Summary:  "Get a user's score and rank on the current window of a board",
+		Response: &leaderboard.Entry{},
+		Errors:   []common.ExpectedErr{leaderboard.ErrUnknownPeriod, leaderboard.ErrNotFound},
+	})
+
+	m.Path("/{board}/{period}/{user}/neighbors").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"GET": boardHandler(func(w http.ResponseWriter, r *http.Request, b *leaderboard.Board) {
+			q := neighborsParams
+			if !apihelper.PrepareQuery(w, r, &q) {
+				return
+			}
+			ee, err := b.Neighbors(mux.Vars(r)["user"], int(q.N.Int64))
+			if err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+			apihelper.JSONPage(w, ee, "", -1)
+		}),
+	}))
+	spec.Add("/{board}/{period}/{user}/neighbors", "GET", apihelper.Doc{
+		Summary:  "Get a user's place on the current window of a board along with the n users on either side of them",
+		Query:    &neighborsParams,
+		Response: &[]leaderboard.Entry{},
+		Page:     true,
+		Errors:   []common.ExpectedErr{leaderboard.ErrUnknownPeriod, leaderboard.ErrNotFound},
+	})
+
+	return m
+}
+
+// adminRoutes adds the admin endpoints to the given Router, which should be a
+// subrouter for the /admin path prefix, and describes them in the given
+// OpenAPI document
+func adminRoutes(m *mux.Router, spec *apihelper.OpenAPI, s *leaderboard.System, token string) {
+	handle := func(
+		path string,
+		handlers map[string]http.HandlerFunc,
+		docs map[string]apihelper.Doc,
+	) {
+		m.Path(path).Handler(apihelper.RequireBearer(token, apihelper.Methods(handlers)))
+		for method, d := range docs {
+			d.Errors = append(d.Errors, apihelper.ErrNotAdmin)
+			spec.Add("/admin"+path, method, d)
+		}
+	}
+
+	handle("/{board}/{user}/incr", map[string]http.HandlerFunc{
+		"POST": func(w http.ResponseWriter, r *http.Request) {
+			j := incrParams
+			if !apihelper.Prepare(w, r, &j, bodySizeLimit) {
+				return
+			}
+			vars := mux.Vars(r)
+			common.HTTPError(w, r, s.Incr(vars["board"], vars["user"], j.By))
+		},
+	}, map[string]apihelper.Doc{
+		"POST": {
+			Summary: "Add to a user's score on every window of a board. By may be negative",
+			Body:    &incrParams,
+		},
+	})
+
+	handle("/{board}/{user}", map[string]http.HandlerFunc{
+		"DELETE": func(w http.ResponseWriter, r *http.Request) {
+			vars := mux.Vars(r)
+			common.HTTPError(w, r, s.Remove(vars["board"], vars["user"]))
+		},
+	}, map[string]apihelper.Doc{
+		"DELETE": {Summary: "Remove a user from every current window of a board"},
+	})
+}
@@ -0,0 +1,61 @@
+package leaderboardapi
+
+import (
+	"net/http"
+	. "testing"
+
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/mediocregopher/mediocre-api/leaderboard"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAdminToken = "admin-token"
+
+var testAdminOpts = &commontest.ReqOpts{
+	Header: http.Header{"Authorization": {"Bearer " + testAdminToken}},
+}
+
+var testMux = func() http.Handler {
+	cmder := commontest.APIStarterKit()
+	s := leaderboard.New(cmder, &leaderboard.Opts{Prefix: commontest.RandStr()})
+	return Mux(cmder, s, &MuxOpts{AdminToken: testAdminToken})
+}()
+
+func TestLeaderboard(t *T) {
+	board, u1, u2 := commontest.RandStr(), "a"+commontest.RandStr(), "b"+commontest.RandStr()
+	incr := func(u, body string) {
+		commontest.AssertReqWith(t, testMux, "POST", "/admin/"+board+"/"+u+"/incr", body, testAdminOpts, "")
+	}
+
+	commontest.AssertReqErr(t, testMux, "POST", "/admin/"+board+"/"+u1+"/incr", `{"By":1}`, apihelper.ErrNotAdmin)
+	commontest.AssertReqErr(t, testMux, "GET", "/"+board+"/yearly", "", leaderboard.ErrUnknownPeriod)
+	commontest.AssertReqErr(t, testMux, "GET", "/"+board+"/daily/"+u1, "", leaderboard.ErrNotFound)
+
+	incr(u1, `{"By":2}`)
+	incr(u2, `{"By":3}`)
+
+	var ee []leaderboard.Entry
+	commontest.AssertReqJSON(t, testMux, "GET", "/"+board+"/weekly", "", &commontest.Page{Data: &ee})
+	assert.Equal(t, []leaderboard.Entry{
+		{User: u2, Score: 3, Rank: 1},
+		{User: u1, Score: 2, Rank: 2},
+	}, ee)
+
+	commontest.AssertReqJSON(t, testMux, "GET", "/"+board+"/all?n=1", "", &commontest.Page{Data: &ee})
+	assert.Equal(t, []leaderboard.Entry{{User: u2, Score: 3, Rank: 1}}, ee)
+
+	code, _ := commontest.Req(t, testMux, "GET", "/"+board+"/all?n=1000", "")
+	assert.Equal(t, 400, code)
+
+	var e leaderboard.Entry
+	commontest.AssertReqJSON(t, testMux, "GET", "/"+board+"/daily/"+u1, "", &e)
+	assert.Equal(t, leaderboard.Entry{User: u1, Score: 2, Rank: 2}, e)
+
+	commontest.AssertReqJSON(t, testMux, "GET", "/"+board+"/monthly/"+u1+"/neighbors?n=1", "", &commontest.Page{Data: &ee})
+	assert.Len(t, ee, 2)
+
+	commontest.AssertReqWith(t, testMux, "DELETE", "/admin/"+board+"/"+u2, "", testAdminOpts, "")
+	commontest.AssertReqJSON(t, testMux, "GET", "/"+board+"/daily/"+u1, "", &e)
+	assert.Equal(t, int64(1), e.Rank)
+}
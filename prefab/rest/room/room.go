@@ -0,0 +1,55 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/common/config"
+	"github.com/mediocregopher/mediocre-api/prefab/rest/room/roomapi"
+	"github.com/mediocregopher/mediocre-api/room"
+)
+
+func main() {
+	c := config.New("room")
+	c.AddListenAddr(":8082")
+	c.AddTLS()
+	c.AddRedis()
+	c.AddLogging()
+	c.Add(config.Param{
+		Name:        "check-in-period",
+		Description: "How long a user stays in a room after checking in, unless they check in again",
+		Default:     "30s",
+	})
+	c.ParseOrExit()
+
+	logSink, err := c.Logging()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	checkInPeriod, err := c.Duration("check-in-period")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cmder, err := c.Redis()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s := room.New(cmder, &room.Opts{CheckInPeriod: checkInPeriod})
+	c.OnShutdown(s.Stop)
+
+	m := roomapi.Mux(cmder, s)
+	h := apihelper.RequestID(apihelper.AccessLog(m, &apihelper.AccessLogOpts{
+		Sink: logSink,
+		User: func(r *http.Request) string {
+			return r.URL.Query().Get("_asUser")
+		},
+	}))
+
+	if err := c.ListenAndServe(h); err != nil {
+		log.Fatal(err)
+	}
+}
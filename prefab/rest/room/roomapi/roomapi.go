@@ -0,0 +1,108 @@
+// Package roomapi implements the REST interface served by the room prefab, so
+// that it can also be mounted as part of another process
+package roomapi
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/room"
+)
+
+// ErrNotAuthd is returned when checking in or out of a room without the
+// request being made on behalf of a user
+var ErrNotAuthd = common.ExpectedErr{Code: 400, ID: "not_authd", Err: "must be authenticated as a user"}
+
+// asUser returns the user the request is being made on behalf of, as set by
+// shield
+func asUser(r *http.Request) string {
+	return r.URL.Query().Get("_asUser")
+}
+
+// roomInfo is what's returned when GETing a room
+type roomInfo struct {
+	Name        string
+	Cardinality int64
+}
+
+// Mux takes in a common.Cmder and the room.System using it, and returns an
+// http.Handler which implements the room system as a rest interface. See the
+// room prefab's README for more information on REST endpoints, which are also
+// described by the OpenAPI document served at /openapi.json
+func Mux(cmder common.Cmder, s *room.System) http.Handler {
+	m := mux.NewRouter()
+	spec := apihelper.NewOpenAPI("room", "1")
+	m.Path("/openapi.json").Handler(spec)
+
+	h := common.NewHealth()
+	h.Add("room-store", common.CmderCheck(cmder))
+	m.Path("/healthz").Handler(h.Liveness())
+	m.Path("/readyz").Handler(h.Readiness())
+
+	m.Path("/{room}").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"GET": func(w http.ResponseWriter, r *http.Request) {
+			rm := mux.Vars(r)["room"]
+			n, err := s.Cardinality(rm)
+			if err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+			apihelper.JSONSuccess(w, &roomInfo{Name: rm, Cardinality: n})
+		},
+	}))
+	spec.Add("/{room}", "GET", apihelper.Doc{
+		Summary:  "Get a room's name and how many users are in it",
+		Response: &roomInfo{},
+	})
+
+	m.Path("/{room}/members").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"GET": func(w http.ResponseWriter, r *http.Request) {
+			members, err := s.Members(mux.Vars(r)["room"])
+			if err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+			apihelper.JSONPage(w, members, "", int64(len(members)))
+		},
+	}))
+	spec.Add("/{room}/members", "GET", apihelper.Doc{
+		Summary:  "List the users in a room",
+		Response: &[]string{},
+		Page:     true,
+	})
+
+	// asUserHandler calls fn with the room and the user the request is being
+	// made on behalf of, which is required
+	asUserHandler := func(fn func(string, string) error) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			u := asUser(r)
+			if u == "" {
+				common.HTTPError(w, r, ErrNotAuthd)
+				return
+			}
+			common.HTTPError(w, r, fn(mux.Vars(r)["room"], u))
+		}
+	}
+
+	m.Path("/{room}/checkin").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"POST": asUserHandler(s.CheckIn),
+	}))
+	spec.Add("/{room}/checkin", "POST", apihelper.Doc{
+		Summary: "Record that the user is in a room. Must be repeated periodically",
+		AsUser:  true,
+		Errors:  []common.ExpectedErr{ErrNotAuthd},
+	})
+
+	m.Path("/{room}/checkout").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"POST": asUserHandler(s.CheckOut),
+	}))
+	spec.Add("/{room}/checkout", "POST", apihelper.Doc{
+		Summary: "Record that the user is no longer in a room",
+		AsUser:  true,
+		Errors:  []common.ExpectedErr{ErrNotAuthd},
+	})
+
+	return m
+}
@@ -0,0 +1,69 @@
+package roomapi
+
+import (
+	"net/http"
+	. "testing"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/mediocregopher/mediocre-api/room"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testMux = func() http.Handler {
+	cmder := commontest.APIStarterKit()
+	s := room.New(cmder, &room.Opts{
+		Prefix:        commontest.RandStr(),
+		CheckInPeriod: 1 * time.Second,
+	})
+	return Mux(cmder, s)
+}()
+
+func assertMembers(t *T, rm string, members ...string) {
+	var l []string
+	page := commontest.Page{Data: &l}
+	commontest.AssertReqJSON(t, testMux, "GET", "/"+rm+"/members", "", &page)
+	assert.ElementsMatch(t, members, l)
+	require.NotNil(t, page.Meta.Total)
+	assert.Equal(t, int64(len(members)), *page.Meta.Total)
+
+	var i roomInfo
+	commontest.AssertReqJSON(t, testMux, "GET", "/"+rm, "", &i)
+	assert.Equal(t, roomInfo{Name: rm, Cardinality: int64(len(members))}, i)
+}
+
+func TestCheckInOut(t *T) {
+	rm := commontest.RandStr()
+	u1, u2 := commontest.RandStr(), commontest.RandStr()
+	assertMembers(t, rm)
+
+	commontest.AssertReqErr(t, testMux, "POST", "/"+rm+"/checkin", "", ErrNotAuthd)
+	assertMembers(t, rm)
+
+	commontest.AssertReq(t, testMux, "POST", "/"+rm+"/checkin?_asUser="+u1, "", "")
+	commontest.AssertReq(t, testMux, "POST", "/"+rm+"/checkin?_asUser="+u2, "", "")
+	assertMembers(t, rm, u1, u2)
+
+	commontest.AssertReq(t, testMux, "POST", "/"+rm+"/checkout?_asUser="+u1, "", "")
+	assertMembers(t, rm, u2)
+
+	// u2 never checks in again, so is removed once the check in period is up
+	time.Sleep(2 * time.Second)
+	assertMembers(t, rm)
+}
+
+func TestHealth(t *T) {
+	commontest.AssertReq(t, testMux, "GET", "/healthz", "", `{"status":"ok"}`+"\n")
+	commontest.AssertReq(t, testMux, "GET", "/readyz", "",
+		`{"status":"ok","checks":{"room-store":"ok"}}`+"\n")
+}
+
+func TestOpenAPI(t *T) {
+	var doc struct {
+		Paths map[string]map[string]interface{}
+	}
+	commontest.AssertReqJSON(t, testMux, "GET", "/openapi.json", "", &doc)
+	assert.Len(t, doc.Paths, 4)
+	assert.Contains(t, doc.Paths["/{room}/checkin"], "post")
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/fwd"
+)
+
+// shieldMetrics collects the metrics served at /metrics. fwd.Metrics is used
+// for both sets, with requests being keyed by the name of the route they
+// matched rather than by upstream
+type shieldMetrics struct {
+	routes    []route
+	requests  *fwd.Metrics
+	upstreams *fwd.Metrics
+}
+
+func newShieldMetrics(routes []route) *shieldMetrics {
+	return &shieldMetrics{
+		routes:    routes,
+		requests:  fwd.NewMetrics(),
+		upstreams: fwd.NewMetrics(),
+	}
+}
+
+// routeName returns the name of the route the given path falls under, or
+// "shield" if it isn't forwarded anywhere
+func (sm *shieldMetrics) routeName(path string) string {
+	for _, rt := range sm.routes {
+		if strings.HasPrefix(path, rt.Prefix) {
+			return rt.Name
+		}
+	}
+	return "shield"
+}
+
+// observeEntry is used as part of the AccessLog sink, so that every request
+// shield handles is counted, including ones rejected before being forwarded
+func (sm *shieldMetrics) observeEntry(e apihelper.AccessLogEntry) {
+	sm.requests.Observe(fwd.Observation{
+		Upstream:   sm.routeName(e.Path),
+		Method:     e.Method,
+		StatusCode: e.Status,
+		Duration:   e.Latency,
+	})
+}
+
+// ServeHTTP writes all metrics in the prometheus text exposition format
+func (sm *shieldMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	reqs := sm.requests.Snapshot()
+	common.WritePromHeader(w, "shield_requests_total", "counter", "Requests handled by shield, by route and response code")
+	for _, name := range sortedKeys(reqs) {
+		codes := make([]int, 0, len(reqs[name].StatusCodes))
+		for code := range reqs[name].StatusCodes {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			fmt.Fprintf(w, "shield_requests_total{route=%q,code=\"%d\"} %d\n", name, code, reqs[name].StatusCodes[code])
+		}
+	}
+	common.WritePromHeader(w, "shield_rate_limited_total", "counter", "Requests rejected for exceeding their rate limit, by route")
+	for _, name := range sortedKeys(reqs) {
+		fmt.Fprintf(w, "shield_rate_limited_total{route=%q} %d\n", name, reqs[name].StatusCodes[420])
+	}
+	sm.requests.WriteHistogram(w, "shield_request_duration_seconds", "Time taken to handle requests, by route", "route")
+
+	ups := sm.upstreams.Snapshot()
+	common.WritePromHeader(w, "shield_upstream_requests_total", "counter", "Requests forwarded to each upstream")
+	for _, name := range sortedKeys(ups) {
+		fmt.Fprintf(w, "shield_upstream_requests_total{upstream=%q} %d\n", name, ups[name].Requests)
+	}
+	common.WritePromHeader(w, "shield_upstream_errors_total", "counter", "Requests which couldn't be forwarded to each upstream")
+	for _, name := range sortedKeys(ups) {
+		fmt.Fprintf(w, "shield_upstream_errors_total{upstream=%q} %d\n", name, ups[name].Errors)
+	}
+	common.WritePromHeader(w, "shield_upstream_cached_total", "counter", "Requests for each upstream which were served from the cache")
+	for _, name := range sortedKeys(ups) {
+		fmt.Fprintf(w, "shield_upstream_cached_total{upstream=%q} %d\n", name, ups[name].Cached)
+	}
+	sm.upstreams.WriteHistogram(w, "shield_upstream_duration_seconds", "Time taken by each upstream to respond", "upstream")
+}
+
+func sortedKeys(m map[string]fwd.UpstreamMetrics) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
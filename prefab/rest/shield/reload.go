@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/common/config"
+	"github.com/mediocregopher/mediocre-api/user"
+)
+
+// shieldFromConfig builds a shield from the current values of the given
+// Config, reading the routes file if one is given. Access logs are written to
+// the given sink, if it's not nil. If prev is given the new shield carries on from it, see
+// newShieldMuxFrom. sessions, if given, is used as the routeConfig's sessions
+func shieldFromConfig(
+	c *config.Config, prev *shield, logSink func(apihelper.AccessLogEntry),
+	sessions *user.System,
+) (*shield, error) {
+	secret, err := c.Secret()
+	if err != nil {
+		return nil, err
+	}
+
+	var rc routeConfig
+	if file := c.Str("routes-file"); file != "" {
+		if rc, err = loadRouteConfig(file); err != nil {
+			return nil, err
+		}
+	}
+	if userAddr := c.Str("user-api-addr"); userAddr != "" {
+		rc.Routes = append(rc.Routes, userRoute(userAddr))
+	}
+	if roomAddr := c.Str("room-api-addr"); roomAddr != "" {
+		rc.Routes = append(rc.Routes, roomRoute(roomAddr))
+	}
+	if broadcastAddr := c.Str("broadcast-api-addr"); broadcastAddr != "" {
+		rc.Routes = append(rc.Routes, broadcastRoute(broadcastAddr))
+	}
+	rc.adminToken = c.Str("admin-token")
+	rc.sessions = sessions
+
+	s, err := newShieldMuxFrom(prev, string(secret), rc)
+	if err != nil {
+		return nil, err
+	}
+	if logSink != nil {
+		s.logSink = logSink
+	}
+	return s, nil
+}
+
+// reloadable is an http.Handler which serves requests using whichever shield
+// was most recently stored in it. Requests which are already being handled
+// when a new shield is stored are completed by the old one
+type reloadable struct {
+	v atomic.Value
+}
+
+func newReloadable(s *shield) *reloadable {
+	r := &reloadable{}
+	r.store(s)
+	return r
+}
+
+func (r *reloadable) load() *shield {
+	return r.v.Load().(*shield)
+}
+
+func (r *reloadable) store(s *shield) {
+	r.v.Store(s)
+}
+
+func (r *reloadable) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.load().ServeHTTP(w, req)
+}
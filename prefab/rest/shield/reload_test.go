@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReload(t *T) {
+	upstream := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {},
+	))
+	defer upstream.Close()
+
+	file := filepath.Join(t.TempDir(), "routes.yml")
+	writeRoutes := func(prefix string) {
+		require.Nil(t, ioutil.WriteFile(file, []byte(`
+routes:
+  - prefix: `+prefix+`
+    upstream: `+upstream.URL+`
+    auth: [no-api-token]
+`), 0644))
+	}
+	writeRoutes("/a/")
+
+	c := newConfig()
+	c.Getenv = func(string) string { return "" }
+	require.Nil(t, c.Parse([]string{"--secret", "turtles", "--routes-file", file}))
+	s, err := shieldFromConfig(c, nil, nil, nil)
+	require.Nil(t, err)
+	h := newReloadable(s)
+
+	serve := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		return w
+	}
+	assert.Equal(t, 200, serve("/a/foo").Code)
+	assert.Equal(t, 404, serve("/b/foo").Code)
+
+	writeRoutes("/b/")
+	require.Nil(t, c.Reload())
+	s, err = shieldFromConfig(c, h.load(), nil, nil)
+	require.Nil(t, err)
+	h.store(s)
+	assert.Equal(t, 404, serve("/a/foo").Code)
+	assert.Equal(t, 200, serve("/b/foo").Code)
+
+	// Metrics collected before the reload are kept
+	body := serve("/metrics").Body.String()
+	assert.Contains(t, body, `shield_requests_total{route="a",code="200"} 1`)
+	assert.Contains(t, body, `shield_requests_total{route="b",code="200"} 1`)
+
+	// A bad config doesn't produce a shield
+	writeRoutes("/shield/")
+	require.Nil(t, c.Reload())
+	_, err = shieldFromConfig(c, h.load(), nil, nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/auth"
+	"github.com/mediocregopher/mediocre-api/auth/apitok"
+	"github.com/mediocregopher/mediocre-api/user"
+	"gopkg.in/yaml.v2"
+)
+
+// routeConfig describes the file given by --routes-file, e.g.
+//
+//	rate_limit:
+//	  capacity: 30s
+//	  interval: 5s
+//	  per_interval: 5s
+//	rate_limit_tiers:
+//	  login:
+//	    capacity: 5s
+//	routes:
+//	  - prefix: /user/
+//	    upstream: http://127.0.0.1:8081
+//	    user_token_path: /{user}/auth
+//	    rate_limit_tier: login
+//	  - prefix: /static/
+//	    upstream: http://127.0.0.1:8090
+//	    auth: [no-api-token]
+//	    cache:
+//	      ttl: 1m
+type routeConfig struct {
+	RateLimit      *rateLimitConfig            `yaml:"rate_limit"`
+	RateLimitTiers map[string]*rateLimitConfig `yaml:"rate_limit_tiers"`
+	Routes         []route                     `yaml:"routes"`
+
+	// The most responses which will be cached at once, across all routes.
+	// Defaults to 10000
+	CacheMaxEntries int `yaml:"cache_max_entries"`
+
+	// If set, the rate limit admin endpoints are served under
+	// /shield/admin/rate-limit/, and requests to them must have it as their
+	// bearer token. Set from --admin-token, not the routes file
+	adminToken string
+
+	// If set, a session is recorded in it for every user token issued, and
+	// user tokens are only accepted while their session is valid. Set from
+	// --sessions, not the routes file
+	sessions *user.System
+}
+
+// rateLimitConfig overrides the fields of the same name on the auth.API's
+// RateLimiter. Any which are left zero keep their default
+type rateLimitConfig struct {
+	Capacity    time.Duration `yaml:"capacity"`
+	Interval    time.Duration `yaml:"interval"`
+	PerInterval time.Duration `yaml:"per_interval"`
+}
+
+// apply sets the non-zero fields of the rateLimitConfig on the given
+// RateLimiter. It is safe to call on a nil rateLimitConfig
+func (rl *rateLimitConfig) apply(r *apitok.RateLimiter) {
+	if rl == nil {
+		return
+	}
+	if rl.Capacity > 0 {
+		r.Capacity = rl.Capacity
+	}
+	if rl.Interval > 0 {
+		r.Interval = rl.Interval
+	}
+	if rl.PerInterval > 0 {
+		r.PerInterval = rl.PerInterval
+	}
+}
+
+// cacheConfig describes how a route's GET responses are cached, see
+// fwd.ResponseCache for the meaning of each field. Requests made with a valid
+// user token always skip the cache
+type cacheConfig struct {
+	TTL               time.Duration `yaml:"ttl"`
+	Vary              []string      `yaml:"vary"`
+	HonorCacheControl bool          `yaml:"honor_cache_control"`
+}
+
+// route describes a single path prefix which shield forwards to an upstream
+type route struct {
+	// Name is used to identify the route in logs and health checks. Defaults
+	// to the prefix without its slashes
+	Name string `yaml:"name"`
+
+	// All requests whose path starts with Prefix are forwarded, with Prefix
+	// stripped from the path, to the Upstream
+	Prefix   string `yaml:"prefix"`
+	Upstream string `yaml:"upstream"`
+
+	// Names of auth.HandlerFlags to apply to the route, see authFlags
+	Auth []string `yaml:"auth"`
+
+	// Name of the entry in rate_limit_tiers which the route is rate-limited
+	// by. Each tier keeps its own buckets, so time used up on one tier
+	// doesn't count against any other. Defaults to the top-level rate_limit
+	RateLimitTier string `yaml:"rate_limit_tier"`
+
+	// If set, public GET responses from the upstream are cached
+	Cache *cacheConfig `yaml:"cache"`
+
+	// If set, POSTs to this path (relative to Prefix, e.g. "/{user}/auth")
+	// are treated as login requests. If the upstream responds with a 200 a user
+	// token is generated for the {user} in the path and returned instead of
+	// the upstream's response
+	UserTokenPath string `yaml:"user_token_path"`
+
+	flags auth.HandlerFlag
+}
+
+// authFlags maps the names which can be used in a route's Auth field to the
+// auth.HandlerFlags they stand for
+var authFlags = map[string]auth.HandlerFlag{
+	"ip-rate-limited":  auth.IPRateLimited,
+	"no-api-token":     auth.NoAPITokenRequired,
+	"user-auth-get":    auth.RequireUserAuthGet,
+	"user-auth-post":   auth.RequireUserAuthPost,
+	"user-auth-put":    auth.RequireUserAuthPut,
+	"user-auth-head":   auth.RequireUserAuthHead,
+	"user-auth-delete": auth.RequireUserAuthDelete,
+	"user-auth-always": auth.RequireUserAuthAlways,
+}
+
+// userRoute returns the route which --user-api-addr is shorthand for
+func userRoute(userAddr string) route {
+	return route{
+		Prefix:        "/user/",
+		Upstream:      userAddr,
+		UserTokenPath: "/{user}/auth",
+	}
+}
+
+// roomRoute returns the route which --room-api-addr is shorthand for. Checking
+// in and out of rooms is done as the logged in user
+func roomRoute(roomAddr string) route {
+	return route{
+		Prefix:   "/room/",
+		Upstream: roomAddr,
+		Auth:     []string{"user-auth-post"},
+	}
+}
+
+// broadcastRoute returns the route which --broadcast-api-addr is shorthand
+// for. Starting, ending, and keeping alive broadcasts is done as the logged in
+// user
+func broadcastRoute(broadcastAddr string) route {
+	return route{
+		Prefix:   "/broadcast/",
+		Upstream: broadcastAddr,
+		Auth:     []string{"user-auth-post"},
+	}
+}
+
+func loadRouteConfig(file string) (routeConfig, error) {
+	var rc routeConfig
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return rc, err
+	}
+	if err := yaml.UnmarshalStrict(b, &rc); err != nil {
+		return rc, fmt.Errorf("%s: %s", file, err)
+	}
+	return rc, nil
+}
+
+// normalize fills in defaults on all routes and checks that they are valid
+func (rc *routeConfig) normalize() error {
+	if rc.CacheMaxEntries == 0 {
+		rc.CacheMaxEntries = 10000
+	}
+
+	prefixes := map[string]bool{}
+	for i := range rc.Routes {
+		rt := &rc.Routes[i]
+		if rt.Prefix == "" || rt.Upstream == "" {
+			return fmt.Errorf("route %d: prefix and upstream are required", i)
+		}
+		if !strings.HasPrefix(rt.Prefix, "/") {
+			rt.Prefix = "/" + rt.Prefix
+		}
+		if !strings.HasSuffix(rt.Prefix, "/") {
+			rt.Prefix += "/"
+		}
+		if rt.Prefix == "/shield/" {
+			return fmt.Errorf("route %d: prefix /shield/ is reserved", i)
+		}
+		if prefixes[rt.Prefix] {
+			return fmt.Errorf("route %d: prefix %s used more than once", i, rt.Prefix)
+		}
+		prefixes[rt.Prefix] = true
+
+		if rt.Name == "" {
+			rt.Name = strings.Trim(rt.Prefix, "/")
+		}
+		if !strings.Contains(rt.Upstream, "://") {
+			return fmt.Errorf("route %s: upstream %q must include a scheme", rt.Name, rt.Upstream)
+		}
+
+		if rt.RateLimitTier != "" && rc.RateLimitTiers[rt.RateLimitTier] == nil {
+			return fmt.Errorf("route %s: unknown rate limit tier %q", rt.Name, rt.RateLimitTier)
+		}
+
+		if rt.Cache != nil && rt.Cache.TTL <= 0 && !rt.Cache.HonorCacheControl {
+			return fmt.Errorf("route %s: cache needs a ttl", rt.Name)
+		}
+
+		rt.flags = auth.Default
+		for _, name := range rt.Auth {
+			f, ok := authFlags[name]
+			if !ok {
+				return fmt.Errorf("route %s: unknown auth flag %q", rt.Name, name)
+			}
+			rt.flags |= f
+		}
+	}
+	return nil
+}
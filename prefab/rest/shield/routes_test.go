@@ -0,0 +1,304 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	. "testing"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/auth"
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadRouteConfig(t *T) {
+	file := filepath.Join(t.TempDir(), "routes.yml")
+	require.Nil(t, ioutil.WriteFile(file, []byte(`
+rate_limit:
+  capacity: 60s
+routes:
+  - prefix: things
+    upstream: http://127.0.0.1:8082
+    auth: [no-api-token, user-auth-post]
+`), 0644))
+
+	rc, err := loadRouteConfig(file)
+	require.Nil(t, err)
+	require.Nil(t, rc.normalize())
+	assert.Equal(t, 60*time.Second, rc.RateLimit.Capacity)
+	require.Len(t, rc.Routes, 1)
+	assert.Equal(t, "things", rc.Routes[0].Name)
+	assert.Equal(t, "/things/", rc.Routes[0].Prefix)
+	assert.Equal(t, auth.NoAPITokenRequired|auth.RequireUserAuthPost, rc.Routes[0].flags)
+
+	for _, bad := range []routeConfig{
+		{Routes: []route{{Prefix: "/foo/"}}},
+		{Routes: []route{{Prefix: "/foo/", Upstream: "127.0.0.1:8082"}}},
+		{Routes: []route{{Prefix: "/shield/", Upstream: "http://127.0.0.1:8082"}}},
+		{Routes: []route{{Prefix: "/foo/", Upstream: "http://a", Auth: []string{"nope"}}}},
+		{Routes: []route{{Prefix: "/foo/", Upstream: "http://a", RateLimitTier: "nope"}}},
+		{Routes: []route{{Prefix: "/foo/", Upstream: "http://a", Cache: &cacheConfig{}}}},
+		{Routes: []route{
+			{Prefix: "/foo/", Upstream: "http://a"},
+			{Prefix: "/foo", Upstream: "http://b"},
+		}},
+	} {
+		assert.NotNil(t, bad.normalize(), "%#v", bad)
+	}
+}
+
+func TestRoutes(t *T) {
+	upstream := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/bob/auth" && r.FormValue("password") != "hunter2" {
+				http.Error(w, "bad auth", 400)
+				return
+			} else if r.URL.Path == "/bob/auth" {
+				return
+			}
+			w.Write([]byte(r.URL.Path))
+		},
+	))
+	defer upstream.Close()
+
+	testMux, err := newShieldMux("turtles", routeConfig{
+		Routes: []route{{
+			Prefix:        "/things/",
+			Upstream:      upstream.URL,
+			Auth:          []string{"no-api-token"},
+			UserTokenPath: "/{user}/auth",
+		}},
+	})
+	require.Nil(t, err)
+
+	serve := func(method, url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		testMux.ServeHTTP(w, httptest.NewRequest(method, url, nil))
+		return w
+	}
+
+	w := serve("GET", "/things/foo/bar")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "/foo/bar", w.Body.String())
+
+	w = serve("POST", "/things/bob/auth?password=wrong")
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, "bad auth\n", w.Body.String())
+
+	w = serve("POST", "/things/bob/auth?password=hunter2")
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"Token"`)
+}
+
+func TestShorthandRoutes(t *T) {
+	upstream := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s?%s", r.URL.Path, r.URL.RawQuery)
+		},
+	))
+	defer upstream.Close()
+
+	testMux, err := newShieldMux("turtles", routeConfig{
+		Routes: []route{
+			userRoute(upstream.URL),
+			roomRoute(upstream.URL),
+			broadcastRoute(upstream.URL),
+		},
+	})
+	require.Nil(t, err)
+
+	serve := func(method, url, user string) *httptest.ResponseRecorder {
+		r := testMux.a.NewRequest(method, url, "", user)
+		w := httptest.NewRecorder()
+		testMux.ServeHTTP(w, r)
+		return w
+	}
+
+	// Clients can't claim to be a user by setting the param themselves
+	w := serve("GET", "/room/foo/members?_asUser=bob&a=b", "")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "/foo/members?a=b", w.Body.String())
+
+	w = serve("POST", "/room/foo/checkin", "")
+	assert.Equal(t, 400, w.Code)
+	w = serve("POST", "/room/foo/checkin?_asUser=bob", "alice")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "/foo/checkin?_asUser=alice", w.Body.String())
+
+	w = serve("POST", "/broadcast/start", "")
+	assert.Equal(t, 400, w.Code)
+	w = serve("POST", "/broadcast/start", "alice")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "/start?_asUser=alice", w.Body.String())
+}
+
+func TestRateLimitTiers(t *T) {
+	upstream := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(time.Millisecond)
+		},
+	))
+	defer upstream.Close()
+
+	testMux, err := newShieldMux("turtles", routeConfig{
+		RateLimitTiers: map[string]*rateLimitConfig{
+			"strict": {Capacity: time.Nanosecond, Interval: time.Hour},
+		},
+		Routes: []route{
+			{Prefix: "/loose/", Upstream: upstream.URL, Auth: []string{"ip-rate-limited"}},
+			{
+				Prefix:        "/strict/",
+				Upstream:      upstream.URL,
+				Auth:          []string{"ip-rate-limited"},
+				RateLimitTier: "strict",
+			},
+		},
+	})
+	require.Nil(t, err)
+
+	serve := func(url string) int {
+		w := httptest.NewRecorder()
+		testMux.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		return w.Code
+	}
+
+	// The first request to the strict route uses up all of its tier's time,
+	// but doesn't affect the default tier
+	assert.Equal(t, 200, serve("/strict/foo"))
+	assert.Equal(t, 420, serve("/strict/foo"))
+	assert.Equal(t, 200, serve("/loose/foo"))
+	assert.Equal(t, 200, serve("/loose/foo"))
+}
+
+func TestCache(t *T) {
+	var calls int
+	upstream := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			fmt.Fprintf(w, "call %d", calls)
+		},
+	))
+	defer upstream.Close()
+
+	testMux, err := newShieldMux("turtles", routeConfig{
+		Routes: []route{
+			{
+				Prefix:   "/cached/",
+				Upstream: upstream.URL,
+				Auth:     []string{"no-api-token"},
+				Cache:    &cacheConfig{TTL: time.Hour},
+			},
+			{Prefix: "/uncached/", Upstream: upstream.URL, Auth: []string{"no-api-token"}},
+		},
+	})
+	require.Nil(t, err)
+
+	serve := func(url, user string) string {
+		r := httptest.NewRequest("GET", url, nil)
+		if user != "" {
+			r.AddCookie(&http.Cookie{
+				Name:  auth.UserTokenCookie,
+				Value: testMux.a.NewUserToken(user),
+			})
+		}
+		w := httptest.NewRecorder()
+		testMux.ServeHTTP(w, r)
+		return w.Body.String()
+	}
+
+	assert.Equal(t, "call 1", serve("/cached/foo", ""))
+	assert.Equal(t, "call 1", serve("/cached/foo", ""))
+	assert.Equal(t, "call 2", serve("/uncached/foo", ""))
+	assert.Equal(t, "call 3", serve("/uncached/foo", ""))
+
+	// Requests made by a user always go to the upstream, and don't replace
+	// what's in the cache
+	assert.Equal(t, "call 4", serve("/cached/foo", "bob"))
+	assert.Equal(t, "call 5", serve("/cached/foo", "bob"))
+	assert.Equal(t, "call 1", serve("/cached/foo", ""))
+}
+
+func TestHealth(t *T) {
+	upstream := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {},
+	))
+	defer upstream.Close()
+
+	routes := []route{{Prefix: "/up/", Upstream: upstream.URL}}
+	testMux, err := newShieldMux("turtles", routeConfig{Routes: routes})
+	require.Nil(t, err)
+
+	var hs common.HealthStatus
+	commontest.AssertReqJSON(t, testMux, "GET", "/shield/health", "", &hs)
+	assert.Equal(t, "ok", hs.Status)
+	assert.Equal(t, "ok", hs.Checks["upstream:up"])
+
+	routes = append(routes, route{Prefix: "/down/", Upstream: "http://127.0.0.1:1"})
+	testMux, err = newShieldMux("turtles", routeConfig{Routes: routes})
+	require.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	testMux.ServeHTTP(w, httptest.NewRequest("GET", "/shield/health", nil))
+	assert.Equal(t, 503, w.Code)
+	hs = common.HealthStatus{}
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &hs))
+	assert.Equal(t, "unavailable", hs.Status)
+	assert.Equal(t, "ok", hs.Checks["upstream:up"])
+	assert.NotEqual(t, "ok", hs.Checks["upstream:down"])
+
+	// An upstream being down doesn't affect shield's own readiness
+	commontest.AssertReq(t, testMux, "GET", "/readyz", "", `{"status":"ok"}`+"\n")
+}
+
+func TestMetrics(t *T) {
+	upstream := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.URL.Path))
+		},
+	))
+	defer upstream.Close()
+	upstreamHost := strings.TrimPrefix(upstream.URL, "http://")
+
+	testMux, err := newShieldMux("turtles", routeConfig{
+		Routes: []route{
+			{Prefix: "/things/", Upstream: upstream.URL, Auth: []string{"no-api-token"}},
+			{Prefix: "/down/", Upstream: "http://127.0.0.1:1", Auth: []string{"no-api-token"}},
+		},
+	})
+	require.Nil(t, err)
+
+	var entries []apihelper.AccessLogEntry
+	testMux.logSink = func(e apihelper.AccessLogEntry) {
+		entries = append(entries, e)
+	}
+
+	serve := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		testMux.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		return w
+	}
+	assert.Equal(t, 200, serve("/things/foo").Code)
+	assert.Equal(t, 200, serve("/things/bar").Code)
+	assert.NotEqual(t, 200, serve("/down/foo").Code)
+
+	require.Len(t, entries, 3)
+	assert.Equal(t, "/things/foo", entries[0].Path)
+	assert.Equal(t, 200, entries[0].Status)
+	assert.NotEmpty(t, entries[0].RequestID)
+
+	body := serve("/metrics").Body.String()
+	assert.Contains(t, body, `shield_requests_total{route="things",code="200"} 2`)
+	assert.Contains(t, body, `shield_rate_limited_total{route="things"} 0`)
+	assert.Contains(t, body, `shield_request_duration_seconds_count{route="things"} 2`)
+	assert.Contains(t, body, `shield_upstream_requests_total{upstream="`+upstreamHost+`"} 2`)
+	assert.Contains(t, body, `shield_upstream_errors_total{upstream="`+upstreamHost+`"} 0`)
+	assert.Contains(t, body, `shield_upstream_errors_total{upstream="127.0.0.1:1"} 1`)
+}
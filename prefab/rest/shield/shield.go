@@ -4,42 +4,93 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/justinas/alice"
-	"github.com/mediocregopher/lever"
 	"github.com/mediocregopher/mediocre-api/auth"
+	"github.com/mediocregopher/mediocre-api/common"
 	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/common/config"
 	"github.com/mediocregopher/mediocre-api/fwd"
+	"github.com/mediocregopher/mediocre-api/user"
+	"github.com/mediocregopher/mediocre-api/xff"
 )
 
 func main() {
-	l := lever.New("shield", nil)
-	l.Add(lever.Param{
-		Name:        "--listen-addr",
-		Description: "Address to listen for api requests on",
-		Default:     ":8080",
-	})
-	l.Add(lever.Param{
-		Name:        "--secret",
-		Description: "Secret to validate api and user tokens with",
-	})
-	l.Add(lever.Param{
-		Name:        "--user-api-addr",
-		Description: "Address the user api is listening on, e.g. \"http://127.0.0.1:8081\". Leave blank to not forward user requests",
+	c := newConfig()
+	c.ParseOrExit()
+
+	logSink, err := c.Logging()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var sessions *user.System
+	if c.Bool("sessions") {
+		cmder, err := c.Redis()
+		if err != nil {
+			log.Fatal(err)
+		}
+		sessions = user.New(cmder)
+	}
+
+	s, err := shieldFromConfig(c, nil, logSink, sessions)
+	if err != nil {
+		log.Fatal(err)
+	}
+	h := newReloadable(s)
+	c.OnReload(func() error {
+		s, err := shieldFromConfig(c, h.load(), logSink, sessions)
+		if err != nil {
+			return err
+		}
+		h.store(s)
+		log.Print("reloaded routes and secret")
+		return nil
 	})
-	l.Parse()
 
-	secret, _ := l.ParamStr("--secret")
-	if secret == "" {
-		log.Fatal("--secret is required")
+	if err := c.ListenAndServe(h); err != nil {
+		log.Fatal(err)
 	}
-	addr, _ := l.ParamStr("--listen-addr")
-	userAddr, _ := l.ParamStr("--user-api-addr")
+}
 
-	log.Printf("listening on %s", addr)
-	log.Fatal(http.ListenAndServe(addr, newShieldMux(secret, userAddr)))
+// newConfig returns the Config for shield, with all of its parameters added
+func newConfig() *config.Config {
+	c := config.New("shield")
+	c.AddListenAddr(":8080")
+	c.AddTLS()
+	c.AddSecret()
+	c.Add(config.Param{
+		Name:        "routes-file",
+		Description: "YAML file describing the path prefixes to forward and the upstreams to forward them to",
+	})
+	c.Add(config.Param{
+		Name:        "user-api-addr",
+		Description: "Address the user api is listening on, e.g. \"http://127.0.0.1:8081\". Shorthand for a /user/ route. Leave blank to not forward user requests",
+	})
+	c.Add(config.Param{
+		Name:        "room-api-addr",
+		Description: "Address the room api is listening on. Shorthand for a /room/ route. Leave blank to not forward room requests",
+	})
+	c.Add(config.Param{
+		Name:        "broadcast-api-addr",
+		Description: "Address the broadcast api is listening on. Shorthand for a /broadcast/ route. Leave blank to not forward broadcast requests",
+	})
+	c.Add(config.Param{
+		Name:        "admin-token",
+		Description: "Token which must be given as a bearer token to use the /shield/admin/ endpoints, for inspecting and adjusting rate limiting. Leave blank to disable them",
+	})
+	c.Add(config.Param{
+		Name:        "sessions",
+		Description: "Whether to record a session in the user api's redis (see the redis-* parameters) for every user token issued, and only accept tokens whose session is still valid. This lets tokens be revoked, e.g. by users logging out everywhere",
+		Flag:        true,
+	})
+	c.AddRedis()
+	c.AddLogging()
+	return c
 }
 
 func prefixStrip(prefix string) alice.Constructor {
@@ -48,22 +99,97 @@ func prefixStrip(prefix string) alice.Constructor {
 	}
 }
 
-func fwdErrorHandler(r *http.Request, err error) {
-	log.Print(err)
+// stripParam removes the given GET parameter from all requests. It's used to
+// keep clients from setting the parameter which the auth.API uses to tell
+// upstreams who the logged in user is
+func stripParam(param string) alice.Constructor {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if q := r.URL.Query(); len(q[param]) > 0 {
+				q.Del(param)
+				r.URL.RawQuery = q.Encode()
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
 }
 
-type shield struct {
-	a *auth.API
-	m *mux.Router
+func fwdErrorHandler(r *http.Request, err error) {
+	log.Print(err)
 }
 
-func newShieldMux(secret, userAddr string) *shield {
+// newAuthAPI returns an auth.API using the given secret, whose RateLimiter has
+// the given rateLimitConfig applied to it. If sessions is given user tokens are
+// checked against it
+func newAuthAPI(secret string, rl *rateLimitConfig, sessions *user.System) *auth.API {
 	a := auth.NewAPI()
 	a.Secret = []byte(secret)
 	a.UserAuthGetParam = "_asUser"
+	if sessions != nil {
+		a.Sessions = sessions
+	}
+	rl.apply(a.RateLimiter)
+	return a
+}
+
+type shield struct {
+	a       *auth.API
+	tiers   map[string]*auth.API
+	m       *mux.Router
+	metrics *shieldMetrics
+
+	// Every request's AccessLogEntry is passed to logSink, after being
+	// recorded in metrics. Defaults to apihelper.LoggerSink(common.Log)
+	logSink func(apihelper.AccessLogEntry)
+
+	h http.Handler
+}
+
+func newShieldMux(secret string, rc routeConfig) (*shield, error) {
+	return newShieldMuxFrom(nil, secret, rc)
+}
+
+// newShieldMuxFrom is like newShieldMux, but if prev is given the new shield
+// will carry on from it, keeping its metrics and the rate limiting state of any
+// tiers it shares with it
+func newShieldMuxFrom(prev *shield, secret string, rc routeConfig) (*shield, error) {
+	if err := rc.normalize(); err != nil {
+		return nil, err
+	}
+
+	a := newAuthAPI(secret, rc.RateLimit, rc.sessions)
+	tiers := map[string]*auth.API{}
+	for name, rl := range rc.RateLimitTiers {
+		tiers[name] = newAuthAPI(secret, rl, rc.sessions)
+	}
+
+	sm := newShieldMetrics(rc.Routes)
+	if prev != nil {
+		a.RateLimiter.Backend = prev.a.RateLimiter.Backend
+		for name, ta := range tiers {
+			if pa, ok := prev.tiers[name]; ok {
+				ta.RateLimiter.Backend = pa.RateLimiter.Backend
+			}
+		}
+		sm.requests, sm.upstreams = prev.metrics.requests, prev.metrics.upstreams
+	}
 
 	m := mux.NewRouter()
-	base := alice.New()
+	base := alice.New(stripParam(a.UserAuthGetParam))
+	var cacheStore fwd.CacheStore
+
+	// /readyz only checks shield's own dependencies, so that an upstream going
+	// down doesn't take shield out of rotation along with it. /shield/health
+	// checks those as well as every upstream
+	h, all := common.NewHealth(), common.NewHealth()
+	if p, ok := a.RateLimiter.Backend.(common.Pinger); ok {
+		h.Add("rate-limiter", p.Ping)
+		all.Add("rate-limiter", p.Ping)
+	}
+	m.Path("/healthz").Handler(h.Liveness())
+	m.Path("/readyz").Handler(h.Readiness())
+	m.Path("/shield/health").Handler(all.Readiness())
+	m.Path("/metrics").Handler(sm)
 
 	m.Handle("/shield/token", base.Append(
 		a.Wrapper(auth.IPRateLimited),
@@ -73,59 +199,175 @@ func newShieldMux(secret, userAddr string) *shield {
 			apihelper.JSONSuccess(w, &struct{ Token string }{token})
 		},
 	))
+	spec := apihelper.NewOpenAPI("shield", "1")
+	spec.Add("/shield/token", "GET", apihelper.Doc{
+		Summary:  "Get a new api token",
+		Response: &struct{ Token string }{},
+		Errors:   []common.ExpectedErr{auth.ErrIPAddrRateLimited},
+	})
+	upstreamSpecs := map[string]http.Handler{}
+	m.Path("/openapi.json").Handler(openAPIHandler(spec, upstreamSpecs))
+
+	// Each tier has its own RateLimiter, so each gets its own set of admin
+	// endpoints. The tiers' are added first so that the top-level ones, whose
+	// prefix they share, don't match them
+	if rc.adminToken != "" {
+		adminRoute := func(prefix string, aa *auth.API) {
+			h := aa.RateLimitAdmin(rc.adminToken)
+			m.PathPrefix(prefix + "/").Handler(http.StripPrefix(prefix, h))
+			upstreamSpecs[prefix] = h
+		}
+		for name, ta := range tiers {
+			adminRoute("/shield/admin/rate-limit/tiers/"+name, ta)
+		}
+		adminRoute("/shield/admin/rate-limit", a)
+	}
+
+	for _, rt := range rc.Routes {
+		strip := strings.TrimSuffix(rt.Prefix, "/")
+		ra := a
+		if rt.RateLimitTier != "" {
+			ra = tiers[rt.RateLimitTier]
+		}
+		chain := base.Append(
+			ra.Wrapper(rt.flags),
+			prefixStrip(strip),
+		)
+		all.Add("upstream:"+rt.Name, common.HTTPCheck(rt.Upstream+"/healthz"))
+
+		// We need to manually handle this part since the upstream api doesn't
+		// know anything about user tokens. So we ask the upstream if the auth
+		// was successful and if so create a user token, instead of just
+		// forwarding the request
+		if rt.UserTokenPath != "" {
+			m.Methods("POST").Path(strip + rt.UserTokenPath).Handler(
+				chain.Then(userTokenHandler(a, rc.sessions, rt.Upstream, sm.upstreams.Observe)),
+			)
+		}
+
+		p := fwd.NewProxy()
+		p.ErrHandler = fwdErrorHandler
+		p.Observer = sm.upstreams.Observe
+		if cc := rt.Cache; cc != nil {
+			if cacheStore == nil {
+				cacheStore = fwd.NewMemCacheStore(rc.CacheMaxEntries)
+			}
+			p.Cache = &fwd.ResponseCache{
+				Store:             cacheStore,
+				TTL:               cc.TTL,
+				Vary:              cc.Vary,
+				HonorCacheControl: cc.HonorCacheControl,
+				Bypass: func(r *http.Request) bool {
+					return a.GetUser(r) != ""
+				},
+			}
+		}
+		m.PathPrefix(rt.Prefix).Handler(chain.Then(p.Rel(rt.Upstream, "/")))
+		upstreamSpecs[strip] = p.Rel(rt.Upstream, "/")
+	}
 
-	authDefault := a.Wrapper(auth.Default)
+	s := &shield{
+		a:       a,
+		tiers:   tiers,
+		m:       m,
+		metrics: sm,
+		logSink: apihelper.LoggerSink(common.Log),
+	}
+	s.h = apihelper.RequestID(apihelper.AccessLog(m, &apihelper.AccessLogOpts{
+		User: a.GetUser,
+		Sink: func(e apihelper.AccessLogEntry) {
+			sm.observeEntry(e)
+			s.logSink(e)
+		},
+	}))
+	return s, nil
+}
+
+// userTokenHandler returns a handler which forwards the request to the given
+// upstream and, if the upstream responds with a 200, returns a new user token
+// for the {user} in the request's path. If sessions is given the token is for a
+// new session recorded in it. Each request made to the upstream is passed to
+// observe
+func userTokenHandler(
+	a *auth.API, sessions *user.System, upstream string, observe func(fwd.Observation),
+) http.Handler {
+	u, err := url.Parse(upstream)
+	if err != nil {
+		log.Fatalf("bad upstream address: %s", upstream)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Scheme = u.Scheme
+		r.URL.Host = u.Host
+		r.RequestURI = ""
+		start := time.Now()
+		resp, err := http.DefaultClient.Do(r)
+		obs := fwd.Observation{
+			Upstream: u.Host,
+			Method:   r.Method,
+			Duration: time.Since(start),
+			Err:      err,
+		}
+		if resp != nil {
+			obs.StatusCode = resp.StatusCode
+		}
+		observe(obs)
+		if err != nil {
+			fwdErrorHandler(r, err)
+			http.Error(w, "unexpected server-side error", 500)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			w.WriteHeader(resp.StatusCode)
+			io.Copy(w, resp.Body)
+			return
+		}
 
-	if userAddr != "" {
-		i := strings.Index(userAddr, ":")
-		if i < 0 {
-			log.Fatalf("bad user address: %s", userAddr)
+		u := mux.Vars(r)["user"]
+		tok := a.NewUserToken(u)
+		if sessions != nil {
+			id, err := sessions.NewSession(u, sessionMeta(r))
+			if err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+			tok = a.NewSessionUserToken(u, id)
 		}
-		userAddrScheme := userAddr[:i]
-		userAddrHost := userAddr[i+3:]
-		userPrefixStrip := prefixStrip("/user")
-
-		// We need to manually handle this part since the user api doesn't know
-		// anything about user tokens. So we ask the user api if the auth was
-		// successful and if so create a user token, instead of just forwarding
-		// the request
-		m.Methods("POST").Path("/user/{user}/auth").Handler(base.Append(
-			authDefault,
-			userPrefixStrip,
-		).ThenFunc(
-			func(w http.ResponseWriter, r *http.Request) {
-				r.URL.Scheme = userAddrScheme
-				r.URL.Host = userAddrHost
-				resp, err := http.DefaultClient.Do(r)
-				if err != nil {
-					fwdErrorHandler(r, err)
-					http.Error(w, "unexpected server-side error", 500)
-					return
-				}
-				defer resp.Body.Close()
-
-				if resp.StatusCode != 200 {
-					w.WriteHeader(resp.StatusCode)
-					io.Copy(w, resp.Body)
-				}
-
-				u := mux.Vars(r)["user"]
-				tok := a.NewUserToken(u)
-				apihelper.JSONSuccess(w, &struct{ Token string }{Token: tok})
-			},
-		))
-
-		m.PathPrefix("/user/").Handler(base.Append(
-			authDefault,
-			userPrefixStrip,
-		).Then(
-			fwd.Rel(userAddr, "/", fwdErrorHandler),
-		))
-	}
-
-	return &shield{a: a, m: m}
+		apihelper.JSONSuccess(w, &struct{ Token string }{Token: tok})
+	})
+}
+
+// sessionMeta returns the metadata recorded with the session of a user logging
+// in with the given request, so they can tell their sessions apart
+func sessionMeta(r *http.Request) map[string]string {
+	meta := map[string]string{"UserAgent": r.UserAgent()}
+	if ip := xff.ClientIP(r); ip != nil {
+		meta["IP"] = ip.String()
+	}
+	return meta
+}
+
+// openAPIHandler serves shield's own OpenAPI document, combined with those
+// served by each upstream (which are keyed by the prefix they're served under).
+// The upstreams' documents are fetched on every request, so that they're always
+// up to date, and any upstream which doesn't serve one is left out
+func openAPIHandler(spec *apihelper.OpenAPI, upstreams map[string]http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		combined := apihelper.NewOpenAPI(spec.Title, spec.Version)
+		combined.Mount("", spec)
+		for prefix, h := range upstreams {
+			us, err := apihelper.FetchOpenAPI(h)
+			if err != nil {
+				log.Printf("upstream %s: %s", prefix, err)
+				continue
+			}
+			combined.Mount(prefix, us)
+		}
+		combined.ServeHTTP(w, r)
+	})
 }
 
 func (s *shield) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	s.m.ServeHTTP(w, r)
+	s.h.ServeHTTP(w, r)
 }
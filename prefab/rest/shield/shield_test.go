@@ -2,17 +2,23 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"net/http/httptest"
 	. "testing"
+	"time"
 
+	"github.com/mediocregopher/mediocre-api/auth"
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
 	"github.com/mediocregopher/mediocre-api/common/commontest"
-	userPrefab "github.com/mediocregopher/mediocre-api/prefab/rest/user"
+	"github.com/mediocregopher/mediocre-api/prefab/rest/user/userapi"
 	"github.com/mediocregopher/mediocre-api/user"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestAPIToken(t *T) {
-	testMux := newShieldMux("turtles", "")
+	testMux, err := newShieldMux("turtles", routeConfig{})
+	require.Nil(t, err)
 	s := struct{ Token string }{}
 	commontest.AssertReqJSON(t, testMux, "GET", "/shield/token", "", &s)
 	assert.NotEqual(t, "", s.Token)
@@ -20,9 +26,12 @@ func TestAPIToken(t *T) {
 
 func TestUser(t *T) {
 	cmder := commontest.APIStarterKit()
-	userMux := userPrefab.UserMux(cmder)
+	userMux := userapi.Mux(cmder, nil)
 	userServer := httptest.NewServer(userMux)
-	testMux := newShieldMux("apples", userServer.URL)
+	testMux, err := newShieldMux("apples", routeConfig{
+		Routes: []route{userRoute(userServer.URL)},
+	})
+	require.Nil(t, err)
 	u := commontest.RandStr()
 	email := commontest.RandEmail()
 	password := commontest.RandStr()
@@ -61,3 +70,133 @@ func TestUser(t *T) {
 	assert.Equal(t, u, info["Name"])
 	assert.Equal(t, email, info["Email"])
 }
+
+func TestUserSessions(t *T) {
+	cmder := commontest.APIStarterKit()
+	userMux := userapi.Mux(cmder, &userapi.MuxOpts{AdminToken: "admin-token"})
+	userServer := httptest.NewServer(userMux)
+	defer userServer.Close()
+	sessions := user.New(cmder)
+	testMux, err := newShieldMux("apples", routeConfig{
+		Routes:   []route{userRoute(userServer.URL)},
+		sessions: sessions,
+	})
+	require.Nil(t, err)
+
+	u, password := commontest.RandStr(), commontest.RandStr()
+	require.Nil(t, sessions.Create(u, commontest.RandEmail(), password))
+
+	login := func() string {
+		reqBody := fmt.Sprintf(`{"Password":"%s"}`, password)
+		r := testMux.a.NewRequest("POST", "/user/"+u+"/auth", reqBody, "")
+		s := struct{ Token string }{}
+		commontest.AssertReqRawJSON(t, testMux, r, &s)
+		return s.Token
+	}
+	withTokenBody := func(method, url, body, tok string) *http.Request {
+		r := testMux.a.NewRequest(method, url, body, "")
+		r.AddCookie(&http.Cookie{Name: auth.UserTokenCookie, Value: tok})
+		return r
+	}
+	withToken := func(method, url, tok string) *http.Request {
+		return withTokenBody(method, url, "", tok)
+	}
+	// The user route doesn't require user auth, so a token which isn't
+	// accepted means the request isn't authd as the user
+	assertNotAuthd := func(r *http.Request) {
+		w := httptest.NewRecorder()
+		testMux.ServeHTTP(w, r)
+		assert.Equal(t, user.ErrBadAuth.Code, w.Code)
+		assert.Equal(t, user.ErrBadAuth.Err+"\n", w.Body.String())
+	}
+
+	tokA, tokB := login(), login()
+	var ss []user.Session
+	r := withToken("GET", "/user/"+u+"/sessions", tokB)
+	commontest.AssertReqRawJSON(t, testMux, r, &commontest.Page{Data: &ss})
+	assert.Len(t, ss, 2)
+
+	// Tokens which aren't for a session aren't accepted
+	assertNotAuthd(testMux.a.NewRequest("GET", "/user/"+u+"/sessions", "", u))
+
+	// Logging out everywhere with one token revokes both
+	commontest.AssertReqRaw(t, testMux, withToken("POST", "/user/"+u+"/sessions/revoke-all", tokA), "")
+	for _, tok := range []string{tokA, tokB} {
+		assertNotAuthd(withToken("GET", "/user/"+u+"/sessions", tok))
+	}
+
+	// So does the user changing their password
+	tok := login()
+	newPassword := commontest.RandStr()
+	body := fmt.Sprintf(`{"OldPassword":"%s","NewPassword":"%s"}`, password, newPassword)
+	commontest.AssertReqRaw(t, testMux, withTokenBody("POST", "/user/"+u+"/password", body, tok), "")
+	password = newPassword
+	assertNotAuthd(withToken("GET", "/user/"+u+"/sessions", tok))
+
+	// And an admin changing it, or disabling the user
+	admin := &commontest.ReqOpts{Header: http.Header{"Authorization": {"Bearer admin-token"}}}
+	tok = login()
+	body = fmt.Sprintf(`{"NewPassword":"%s"}`, password)
+	commontest.AssertReqWith(t, userMux, "POST", "/admin/users/"+u+"/password", body, admin, "")
+	assertNotAuthd(withToken("GET", "/user/"+u+"/sessions", tok))
+
+	tok = login()
+	commontest.AssertReqWith(t, userMux, "POST", "/admin/users/"+u+"/disable", "", admin, "")
+	assertNotAuthd(withToken("GET", "/user/"+u+"/sessions", tok))
+}
+
+func TestOpenAPI(t *T) {
+	cmder := commontest.APIStarterKit()
+	userServer := httptest.NewServer(userapi.Mux(cmder, nil))
+	defer userServer.Close()
+	testMux, err := newShieldMux("apples", routeConfig{
+		Routes: []route{
+			userRoute(userServer.URL),
+			{Prefix: "/down/", Upstream: "http://127.0.0.1:1"},
+		},
+	})
+	require.Nil(t, err)
+
+	var doc struct {
+		Paths map[string]map[string]interface{}
+	}
+	commontest.AssertReqJSON(t, testMux, "GET", "/openapi.json", "", &doc)
+	assert.Contains(t, doc.Paths, "/shield/token")
+	assert.Contains(t, doc.Paths, "/user/new-user")
+	assert.Contains(t, doc.Paths["/user/{user}/auth"], "post")
+}
+
+func TestRateLimitAdmin(t *T) {
+	testMux, err := newShieldMux("apples", routeConfig{
+		RateLimitTiers: map[string]*rateLimitConfig{
+			"login": {Capacity: 5 * time.Second},
+		},
+		adminToken: "admin-token",
+	})
+	require.Nil(t, err)
+	opts := &commontest.ReqOpts{
+		Header: http.Header{"Authorization": {"Bearer admin-token"}},
+	}
+
+	var limits struct{ Capacity string }
+	url := "/shield/admin/rate-limit/limits"
+	commontest.AssertReqErr(t, testMux, "GET", url, "", apihelper.ErrNotAdmin)
+	commontest.AssertReqJSONWith(t, testMux, "GET", url, "", opts, &limits)
+	assert.Equal(t, "30s", limits.Capacity)
+
+	url = "/shield/admin/rate-limit/tiers/login/limits"
+	commontest.AssertReqJSONWith(t, testMux, "GET", url, "", opts, &limits)
+	assert.Equal(t, "5s", limits.Capacity)
+
+	var doc struct {
+		Paths map[string]map[string]interface{}
+	}
+	commontest.AssertReqJSON(t, testMux, "GET", "/openapi.json", "", &doc)
+	assert.Contains(t, doc.Paths["/shield/admin/rate-limit/buckets"], "get")
+
+	// Without an admin token the endpoints aren't there at all
+	testMux, err = newShieldMux("apples", routeConfig{})
+	require.Nil(t, err)
+	code, _ := commontest.Req(t, testMux, "GET", "/shield/admin/rate-limit/limits", "")
+	assert.Equal(t, 404, code)
+}
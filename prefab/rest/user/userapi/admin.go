@@ -0,0 +1,238 @@
+package userapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/pickyjson"
+	"github.com/mediocregopher/mediocre-api/user"
+)
+
+// adminPasswordParams are the params taken in by the admin password endpoint.
+// passwordParam's MinLength would make NewPassword required, so the length is
+// checked in Func instead, which isn't called for an empty string
+var adminPasswordParams = struct {
+	NewPassword pickyjson.Str
+}{
+	NewPassword: pickyjson.Str{
+		MaxLength: passwordParam.MaxLength,
+		Func: func(p string) bool {
+			return len(p) >= passwordParam.MinLength
+		},
+	},
+}
+
+// adminRenameParams are the params taken in by the admin rename endpoint
+var adminRenameParams = struct {
+	NewUsername pickyjson.Str
+}{
+	NewUsername: pickyjson.Username.Required(),
+}
+
+// adminSearchParams are the query params taken in by the admin search endpoint
+var adminSearchParams = struct {
+	Query  pickyjson.Str `json:"q"`
+	Cursor pickyjson.Str `json:"cursor"`
+}{
+	Query: pickyjson.Str{MaxLength: 255}.Required(),
+}
+
+// adminRoutes adds the admin endpoints to the given Router, which should be a
+// subrouter for the /admin path prefix, and describes them in the given
+// OpenAPI document
+func adminRoutes(m *mux.Router, spec *apihelper.OpenAPI, s *user.System, token string) {
+	handle := func(
+		path string,
+		handlers map[string]http.HandlerFunc,
+		docs map[string]apihelper.Doc,
+	) {
+		m.Path(path).Handler(apihelper.RequireBearer(token, apihelper.Methods(handlers)))
+		for method, d := range docs {
+			d.Errors = append(d.Errors, apihelper.ErrNotAdmin)
+			spec.Add("/admin"+path, method, d)
+		}
+	}
+
+	// This must come before /users/{user}, which would otherwise match it
+	if len(s.SearchFields) > 0 {
+		handle("/users/search", map[string]http.HandlerFunc{
+			"GET": func(w http.ResponseWriter, r *http.Request) {
+				q := adminSearchParams
+				if !apihelper.PrepareQuery(w, r, &q) {
+					return
+				}
+				ii, cursor, err := s.Search(q.Query.Str, q.Cursor.Str)
+				if err != nil {
+					common.HTTPError(w, r, err)
+					return
+				}
+				apihelper.JSONPage(w, ii, cursor, -1)
+			},
+		}, map[string]apihelper.Doc{
+			"GET": {
+				Summary:  "Search users by their searchable fields, returning all of each matching user's fields. The returned cursor gets the next page of results, if it isn't empty",
+				Query:    &adminSearchParams,
+				Response: &[]user.Info{},
+				Page:     true,
+				Errors:   []common.ExpectedErr{user.ErrInvalidCursor},
+			},
+		})
+	}
+
+	handle("/users/{user}", map[string]http.HandlerFunc{
+		"GET": func(w http.ResponseWriter, r *http.Request) {
+			i, err := s.Get(mux.Vars(r)["user"], user.Private)
+			if err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+			apihelper.JSONSuccess(w, &i)
+		},
+		"DELETE": func(w http.ResponseWriter, r *http.Request) {
+			common.HTTPError(w, r, s.Delete(mux.Vars(r)["user"]))
+		},
+	}, map[string]apihelper.Doc{
+		"GET": {
+			Summary:  "Get all of a user's fields",
+			Response: &user.Info{},
+			Errors:   []common.ExpectedErr{user.ErrNotFound},
+		},
+		"DELETE": {
+			Summary: "Delete a user",
+			Errors:  []common.ExpectedErr{user.ErrNotFound},
+		},
+	})
+
+	// Disable and Enable don't check that the user exists, so that's done
+	// here first
+	existing := func(fn func(string) error) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			u := mux.Vars(r)["user"]
+			if _, err := s.Get(u, user.Public); err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+			common.HTTPError(w, r, fn(u))
+		}
+	}
+	handle("/users/{user}/disable", map[string]http.HandlerFunc{
+		"POST": existing(s.Disable),
+	}, map[string]apihelper.Doc{
+		"POST": {Summary: "Disable a user's account", Errors: []common.ExpectedErr{user.ErrNotFound}},
+	})
+	handle("/users/{user}/enable", map[string]http.HandlerFunc{
+		"POST": existing(s.Enable),
+	}, map[string]apihelper.Doc{
+		"POST": {Summary: "Re-enable a user's account", Errors: []common.ExpectedErr{user.ErrNotFound}},
+	})
+
+	handle("/users/{user}/password", map[string]http.HandlerFunc{
+		"POST": func(w http.ResponseWriter, r *http.Request) {
+			j := adminPasswordParams
+			if !apihelper.Prepare(w, r, &j, bodySizeLimit) {
+				return
+			}
+
+			// If no password was given a random one is generated and returned,
+			// so it can be passed on to the user
+			password, generated := j.NewPassword.Str, false
+			if password == "" {
+				password, generated = randPassword(), true
+			}
+			if err := s.ChangePassword(mux.Vars(r)["user"], password); err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+			if generated {
+				apihelper.JSONSuccess(w, &struct{ Password string }{password})
+			}
+		},
+	}, map[string]apihelper.Doc{
+		"POST": {
+			Summary:  "Set a user's password, generating and returning a random one if none is given",
+			Body:     &adminPasswordParams,
+			Response: &struct{ Password string }{},
+			Errors:   []common.ExpectedErr{user.ErrNotFound},
+		},
+	})
+
+	handle("/users/{user}/rename", map[string]http.HandlerFunc{
+		"POST": func(w http.ResponseWriter, r *http.Request) {
+			j := adminRenameParams
+			if !apihelper.Prepare(w, r, &j, bodySizeLimit) {
+				return
+			}
+			common.HTTPError(w, r, s.Rename(mux.Vars(r)["user"], j.NewUsername.Str))
+		},
+	}, map[string]apihelper.Doc{
+		"POST": {
+			Summary: "Change a user's username",
+			Body:    &adminRenameParams,
+			Errors:  []common.ExpectedErr{user.ErrNotFound, user.ErrUserExists, user.ErrInvalidUsername},
+		},
+	})
+
+	handle("/users/{user}/roles", map[string]http.HandlerFunc{
+		"GET": func(w http.ResponseWriter, r *http.Request) {
+			roles, err := s.Roles(mux.Vars(r)["user"])
+			if err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+			apihelper.JSONPage(w, roles, "", int64(len(roles)))
+		},
+	}, map[string]apihelper.Doc{
+		"GET": {Summary: "List the roles a user has been given", Response: &[]string{}, Page: true},
+	})
+
+	handle("/users/{user}/roles/{role}", map[string]http.HandlerFunc{
+		"PUT": func(w http.ResponseWriter, r *http.Request) {
+			vars := mux.Vars(r)
+			common.HTTPError(w, r, s.AddRole(vars["user"], vars["role"]))
+		},
+		"DELETE": func(w http.ResponseWriter, r *http.Request) {
+			vars := mux.Vars(r)
+			common.HTTPError(w, r, s.RemoveRole(vars["user"], vars["role"]))
+		},
+	}, map[string]apihelper.Doc{
+		"PUT":    {Summary: "Give a user a role", Errors: []common.ExpectedErr{user.ErrNotFound}},
+		"DELETE": {Summary: "Take a role away from a user"},
+	})
+
+	handle("/banned-usernames", map[string]http.HandlerFunc{
+		"GET": func(w http.ResponseWriter, r *http.Request) {
+			banned, err := s.Banned()
+			if err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+			apihelper.JSONPage(w, banned, "", int64(len(banned)))
+		},
+	}, map[string]apihelper.Doc{
+		"GET": {Summary: "List banned usernames", Response: &[]string{}, Page: true},
+	})
+
+	handle("/banned-usernames/{username}", map[string]http.HandlerFunc{
+		"PUT": func(w http.ResponseWriter, r *http.Request) {
+			common.HTTPError(w, r, s.Ban(mux.Vars(r)["username"]))
+		},
+		"DELETE": func(w http.ResponseWriter, r *http.Request) {
+			common.HTTPError(w, r, s.Unban(mux.Vars(r)["username"]))
+		},
+	}, map[string]apihelper.Doc{
+		"PUT":    {Summary: "Ban a username from being registered"},
+		"DELETE": {Summary: "Unban a username"},
+	})
+}
+
+func randPassword() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
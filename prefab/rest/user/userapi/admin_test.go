@@ -0,0 +1,154 @@
+package userapi
+
+import (
+	"fmt"
+	"net/http"
+	. "testing"
+
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/mediocregopher/mediocre-api/user"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAdminToken = "admin-token"
+
+var testAdminOpts = &commontest.ReqOpts{
+	Header: http.Header{"Authorization": {"Bearer " + testAdminToken}},
+}
+
+func TestAdminAuth(t *T) {
+	u, _, _ := testAPICreateUser(t)
+	url := "/admin/users/" + u
+
+	commontest.AssertReqErr(t, testMux, "GET", url, "", apihelper.ErrNotAdmin)
+	badOpts := &commontest.ReqOpts{
+		Header: http.Header{"Authorization": {"Bearer foo"}},
+	}
+	commontest.AssertReqErrWith(t, testMux, "GET", url, "", badOpts, apihelper.ErrNotAdmin)
+
+	var i user.Info
+	commontest.AssertReqJSONWith(t, testMux, "GET", url, "", testAdminOpts, &i)
+	assert.Equal(t, u, i["Name"])
+
+	// Without a token the endpoints aren't there at all
+	m := Mux(commontest.APIStarterKit(), nil)
+	code, _ := commontest.Req(t, m, "GET", url, "")
+	assert.Equal(t, 404, code)
+}
+
+func TestAdminDisable(t *T) {
+	u, _, password := testAPICreateUser(t)
+	urlAuth := fmt.Sprintf("/%s/auth", u)
+	reqBody := fmt.Sprintf(`{"Password":"%s"}`, password)
+
+	commontest.AssertReqWith(t, testMux, "POST", "/admin/users/"+u+"/disable", "", testAdminOpts, "")
+	commontest.AssertReqErr(t, testMux, "POST", urlAuth, reqBody, user.ErrDisabled)
+
+	commontest.AssertReqWith(t, testMux, "POST", "/admin/users/"+u+"/enable", "", testAdminOpts, "")
+	commontest.AssertReq(t, testMux, "POST", urlAuth, reqBody, "")
+
+	u404 := commontest.RandStr()
+	commontest.AssertReqErrWith(t, testMux, "POST", "/admin/users/"+u404+"/disable", "", testAdminOpts, user.ErrNotFound)
+}
+
+func TestAdminDelete(t *T) {
+	u, _, _ := testAPICreateUser(t)
+	url := "/admin/users/" + u
+
+	commontest.AssertReqWith(t, testMux, "DELETE", url, "", testAdminOpts, "")
+	commontest.AssertReqErr(t, testMux, "GET", "/"+u, "", user.ErrNotFound)
+	commontest.AssertReqErrWith(t, testMux, "DELETE", url, "", testAdminOpts, user.ErrNotFound)
+}
+
+func TestAdminResetPassword(t *T) {
+	u, _, oldPassword := testAPICreateUser(t)
+	url := "/admin/users/" + u + "/password"
+	urlAuth := fmt.Sprintf("/%s/auth", u)
+
+	newPassword := commontest.RandStr()
+	reqBody := fmt.Sprintf(`{"NewPassword":"%s"}`, newPassword)
+	commontest.AssertReqWith(t, testMux, "POST", url, reqBody, testAdminOpts, "")
+	commontest.AssertReqErr(t, testMux, "POST", urlAuth, fmt.Sprintf(`{"Password":"%s"}`, oldPassword), user.ErrBadAuth)
+	commontest.AssertReq(t, testMux, "POST", urlAuth, fmt.Sprintf(`{"Password":"%s"}`, newPassword), "")
+
+	var ret struct{ Password string }
+	commontest.AssertReqJSONWith(t, testMux, "POST", url, `{}`, testAdminOpts, &ret)
+	assert.NotEmpty(t, ret.Password)
+	commontest.AssertReq(t, testMux, "POST", urlAuth, fmt.Sprintf(`{"Password":"%s"}`, ret.Password), "")
+}
+
+func TestAdminBan(t *T) {
+	u := commontest.RandStr()
+	reqBody := fmt.Sprintf(
+		`{"Email":"%s","Username":"%s","Password":"%s"}`,
+		commontest.RandEmail(), u, commontest.RandStr(),
+	)
+
+	commontest.AssertReqWith(t, testMux, "PUT", "/admin/banned-usernames/"+u, "", testAdminOpts, "")
+	commontest.AssertReqErr(t, testMux, "POST", "/new-user", reqBody, user.ErrInvalidUsername)
+
+	var banned []string
+	commontest.AssertReqJSONWith(t, testMux, "GET", "/admin/banned-usernames", "", testAdminOpts, &commontest.Page{Data: &banned})
+	assert.Contains(t, banned, u)
+
+	commontest.AssertReqWith(t, testMux, "DELETE", "/admin/banned-usernames/"+u, "", testAdminOpts, "")
+	commontest.AssertReq(t, testMux, "POST", "/new-user", reqBody, "")
+}
+
+func TestAdminRename(t *T) {
+	u, _, password := testAPICreateUser(t)
+	u2 := commontest.RandStr()
+	reqBody := fmt.Sprintf(`{"NewUsername":"%s"}`, u2)
+
+	commontest.AssertReqWith(t, testMux, "POST", "/admin/users/"+u+"/rename", reqBody, testAdminOpts, "")
+	commontest.AssertReqErr(t, testMux, "GET", "/"+u, "", user.ErrNotFound)
+	commontest.AssertReq(t, testMux, "POST", "/"+u2+"/auth", fmt.Sprintf(`{"Password":"%s"}`, password), "")
+
+	u3, _, _ := testAPICreateUser(t)
+	reqBody = fmt.Sprintf(`{"NewUsername":"%s"}`, u3)
+	commontest.AssertReqErrWith(t, testMux, "POST", "/admin/users/"+u2+"/rename", reqBody, testAdminOpts, user.ErrUserExists)
+}
+
+func TestAdminRoles(t *T) {
+	u, _, _ := testAPICreateUser(t)
+	url := "/admin/users/" + u + "/roles"
+
+	var roles []string
+	commontest.AssertReqJSONWith(t, testMux, "GET", url, "", testAdminOpts, &commontest.Page{Data: &roles})
+	assert.Equal(t, []string{}, roles)
+
+	commontest.AssertReqWith(t, testMux, "PUT", url+"/admin", "", testAdminOpts, "")
+	commontest.AssertReqJSONWith(t, testMux, "GET", url, "", testAdminOpts, &commontest.Page{Data: &roles})
+	assert.Equal(t, []string{"admin"}, roles)
+
+	commontest.AssertReqWith(t, testMux, "DELETE", url+"/admin", "", testAdminOpts, "")
+	commontest.AssertReqJSONWith(t, testMux, "GET", url, "", testAdminOpts, &commontest.Page{Data: &roles})
+	assert.Equal(t, []string{}, roles)
+
+	u404 := commontest.RandStr()
+	commontest.AssertReqErrWith(t, testMux, "PUT", "/admin/users/"+u404+"/roles/admin", "", testAdminOpts, user.ErrNotFound)
+}
+
+func TestAdminSearch(t *T) {
+	// Without SearchFields the search endpoint isn't there, so the user
+	// endpoint is hit instead
+	url := "/admin/users/search?q=foo"
+	commontest.AssertReqErrWith(t, testMux, "GET", url, "", testAdminOpts, user.ErrNotFound)
+
+	m := Mux(commontest.APIStarterKit(), &MuxOpts{
+		AdminToken:   testAdminToken,
+		SearchFields: []string{"Name", "Email"},
+	})
+	commontest.AssertReqErr(t, m, "GET", url, "", apihelper.ErrNotAdmin)
+	commontest.AssertReqErrWith(t, m, "GET", url+"&cursor=nope", "", testAdminOpts, user.ErrInvalidCursor)
+
+	resp := commontest.ReqWith(t, m, "GET", "/admin/users/search", "", testAdminOpts)
+	assert.Equal(t, 400, resp.Code)
+
+	reqBody := fmt.Sprintf(
+		`{"Email":"%s","Username":"search","Password":"%s"}`,
+		commontest.RandEmail(), commontest.RandStr(),
+	)
+	commontest.AssertReqErr(t, m, "POST", "/new-user", reqBody, user.ErrInvalidUsername)
+}
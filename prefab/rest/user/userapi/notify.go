@@ -0,0 +1,133 @@
+package userapi
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/notify"
+	"github.com/mediocregopher/mediocre-api/pickyjson"
+	"github.com/mediocregopher/mediocre-api/user"
+)
+
+// ErrNoEmail is returned from the endpoints which email the user when they
+// don't have an email to send to
+var ErrNoEmail = common.ExpectedErr{Code: 400, ID: "no_email", Err: "user has no email"}
+
+var (
+	verifyConfirmParams = struct {
+		Token pickyjson.Str
+	}{
+		Token: pickyjson.Str{}.Required(),
+	}
+
+	resetConfirmParams = struct {
+		Token       pickyjson.Str
+		NewPassword pickyjson.Str
+	}{
+		Token:       pickyjson.Str{}.Required(),
+		NewPassword: passwordParam.Required(),
+	}
+)
+
+// tokenLink returns the given url with the user and token added to it as the
+// "user" and "token" query parameters
+func tokenLink(base, u, token string) (string, error) {
+	l, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	q := l.Query()
+	q.Set("user", u)
+	q.Set("token", token)
+	l.RawQuery = q.Encode()
+	return l.String(), nil
+}
+
+// sendTokenLink emails the user a link to the given url with a token from
+// newToken in it, using the given Template. Returns ErrNoEmail if the user
+// doesn't have an email
+func sendTokenLink(
+	s *user.System, o *MuxOpts, tpl *notify.Template, base, u string,
+	newToken func(string) (string, error),
+) error {
+	i, err := s.Get(u, user.Private)
+	if err != nil {
+		return err
+	} else if i["Email"] == "" {
+		return ErrNoEmail
+	}
+	token, err := newToken(u)
+	if err != nil {
+		return err
+	}
+	link, err := tokenLink(base, u, token)
+	if err != nil {
+		return err
+	}
+	return notify.Send(o.Notify, tpl, i["Email"], notify.LinkData{User: u, Link: link})
+}
+
+// notifyRoutes adds the endpoints for verifying users' emails and resetting
+// their passwords, which send emails using o.Notify
+func notifyRoutes(m *mux.Router, spec *apihelper.OpenAPI, s *user.System, o *MuxOpts) {
+	m.Path("/{user}/verify").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"POST": requireAuthd(
+			func(w http.ResponseWriter, r *http.Request) {
+				u := mux.Vars(r)["user"]
+				err := sendTokenLink(s, o, notify.VerifyEmail, o.VerifyURL, u, s.NewVerifyToken)
+				common.HTTPError(w, r, err)
+			},
+		),
+	}))
+	spec.Add("/{user}/verify", "POST", apihelper.Doc{
+		Summary: "Email the user a link to verify their current email with",
+		AsUser:  true,
+		Errors:  []common.ExpectedErr{user.ErrNotFound, user.ErrBadAuth, user.ErrDisabled, ErrNoEmail},
+	})
+
+	m.Path("/{user}/verify/confirm").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"POST": func(w http.ResponseWriter, r *http.Request) {
+			j := verifyConfirmParams
+			if !apihelper.Prepare(w, r, &j, bodySizeLimit) {
+				return
+			}
+			common.HTTPError(w, r, s.VerifyEmail(mux.Vars(r)["user"], j.Token.Str))
+		},
+	}))
+	spec.Add("/{user}/verify/confirm", "POST", apihelper.Doc{
+		Summary: "Mark the user's email as verified, using the token from the link emailed to them",
+		Body:    &verifyConfirmParams,
+		Errors:  []common.ExpectedErr{user.ErrNotFound, user.ErrDisabled, user.ErrInvalidVerifyToken},
+	})
+
+	m.Path("/{user}/password/reset").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"POST": func(w http.ResponseWriter, r *http.Request) {
+			u := mux.Vars(r)["user"]
+			err := sendTokenLink(s, o, notify.PasswordReset, o.ResetURL, u, s.NewResetToken)
+			common.HTTPError(w, r, err)
+		},
+	}))
+	spec.Add("/{user}/password/reset", "POST", apihelper.Doc{
+		Summary: "Email the user a link to reset their password with",
+		Errors:  []common.ExpectedErr{user.ErrNotFound, user.ErrDisabled, ErrNoEmail},
+	})
+
+	m.Path("/{user}/password/reset/confirm").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"POST": func(w http.ResponseWriter, r *http.Request) {
+			j := resetConfirmParams
+			if !apihelper.Prepare(w, r, &j, bodySizeLimit) {
+				return
+			}
+			err := s.ResetPassword(mux.Vars(r)["user"], j.Token.Str, j.NewPassword.Str)
+			common.HTTPError(w, r, err)
+		},
+	}))
+	spec.Add("/{user}/password/reset/confirm", "POST", apihelper.Doc{
+		Summary: "Set the user's password, using the token from the link emailed to them",
+		Body:    &resetConfirmParams,
+		Errors:  []common.ExpectedErr{user.ErrNotFound, user.ErrDisabled, user.ErrInvalidResetToken},
+	})
+}
@@ -0,0 +1,109 @@
+package userapi
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	. "testing"
+
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/mediocregopher/mediocre-api/notify"
+	"github.com/mediocregopher/mediocre-api/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testSender is a notify.Sender which keeps the Messages it's given
+type testSender []notify.Message
+
+func (ts *testSender) Send(m notify.Message) error {
+	*ts = append(*ts, m)
+	return nil
+}
+
+var linkRegexp = regexp.MustCompile(`https://\S+`)
+
+// lastLink returns the query parameters of the link in the last Message sent
+func (ts *testSender) lastLink(t *T, kind, to string) url.Values {
+	require.NotEmpty(t, *ts)
+	m := (*ts)[len(*ts)-1]
+	assert.Equal(t, kind, m.Kind)
+	assert.Equal(t, to, m.To)
+	l, err := url.Parse(linkRegexp.FindString(m.Text))
+	require.Nil(t, err)
+	return l.Query()
+}
+
+func tokenBody(t *T, v interface{}) string {
+	b, err := json.Marshal(v)
+	require.Nil(t, err)
+	return string(b)
+}
+
+func TestAPIVerifyReset(t *T) {
+	sender := new(testSender)
+	m := Mux(commontest.APIStarterKit(), &MuxOpts{
+		Secret:    []byte("secret"),
+		Notify:    sender,
+		VerifyURL: "https://example.com/verify?a=b",
+		ResetURL:  "https://example.com/reset",
+	})
+
+	u, email, password := commontest.RandStr(), commontest.RandEmail(), commontest.RandStr()
+	body := tokenBody(t, map[string]string{"Username": u, "Email": email, "Password": password})
+	commontest.AssertReq(t, m, "POST", "/new-user", body, "")
+
+	// Verifying
+	commontest.AssertReqErr(t, m, "POST", "/"+u+"/verify", "", user.ErrBadAuth)
+	commontest.AssertReq(t, m, "POST", "/"+u+"/verify?_asUser="+u, "", "")
+	q := sender.lastLink(t, notify.VerifyEmail.Kind, email)
+	assert.Equal(t, "b", q.Get("a"))
+	assert.Equal(t, u, q.Get("user"))
+
+	commontest.AssertReqErr(t, m, "POST", "/"+u+"/verify/confirm",
+		tokenBody(t, map[string]string{"Token": "bogus"}), user.ErrInvalidVerifyToken)
+	commontest.AssertReq(t, m, "POST", "/"+u+"/verify/confirm",
+		tokenBody(t, map[string]string{"Token": q.Get("token")}), "")
+	var i user.Info
+	commontest.AssertReqJSON(t, m, "GET", "/"+u+"?_asUser="+u, "", &i)
+	assert.NotEmpty(t, i["Verified"])
+
+	// Resetting
+	commontest.AssertReqErr(t, m, "POST", "/"+commontest.RandStr()+"/password/reset", "", user.ErrNotFound)
+	commontest.AssertReq(t, m, "POST", "/"+u+"/password/reset", "", "")
+	q = sender.lastLink(t, notify.PasswordReset.Kind, email)
+	assert.Equal(t, u, q.Get("user"))
+
+	newPassword := commontest.RandStr()
+	resetBody := tokenBody(t, map[string]string{"Token": q.Get("token"), "NewPassword": newPassword})
+	commontest.AssertReq(t, m, "POST", "/"+u+"/password/reset/confirm", resetBody, "")
+	commontest.AssertReqErr(t, m, "POST", "/"+u+"/password/reset/confirm", resetBody, user.ErrInvalidResetToken)
+	commontest.AssertReqErr(t, m, "POST", "/"+u+"/auth",
+		tokenBody(t, map[string]string{"Password": password}), user.ErrBadAuth)
+	commontest.AssertReq(t, m, "POST", "/"+u+"/auth",
+		tokenBody(t, map[string]string{"Password": newPassword}), "")
+
+	// Without a Sender the endpoints aren't there at all
+	code, _ := commontest.Req(t, testMux, "POST", "/"+u+"/password/reset", "")
+	assert.Equal(t, 404, code)
+}
+
+func TestAPINoEmail(t *T) {
+	sender := new(testSender)
+	cmder := commontest.APIStarterKit()
+	m := Mux(cmder, &MuxOpts{
+		Secret:    []byte("secret"),
+		Notify:    sender,
+		VerifyURL: "https://example.com/verify",
+		ResetURL:  "https://example.com/reset",
+	})
+
+	u := commontest.RandStr()
+	s := user.New(cmder)
+	require.Nil(t, s.Create(u, commontest.RandEmail(), commontest.RandStr()))
+	require.Nil(t, s.Set(u, user.Info{"Email": ""}))
+
+	commontest.AssertReqErr(t, m, "POST", "/"+u+"/verify?_asUser="+u, "", ErrNoEmail)
+	commontest.AssertReqErr(t, m, "POST", "/"+u+"/password/reset", "", ErrNoEmail)
+	assert.Empty(t, *sender)
+}
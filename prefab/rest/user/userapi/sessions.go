@@ -0,0 +1,48 @@
+package userapi
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/user"
+)
+
+// sessionRoutes adds the endpoints for users to see and revoke their sessions.
+// Sessions are only recorded if whatever issues user tokens (e.g. shield) is
+// set up to, otherwise there are never any
+func sessionRoutes(m *mux.Router, spec *apihelper.OpenAPI, s *user.System) {
+	m.Path("/{user}/sessions").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"GET": requireAuthd(
+			func(w http.ResponseWriter, r *http.Request) {
+				ss, err := s.ListSessions(mux.Vars(r)["user"])
+				if err != nil {
+					common.HTTPError(w, r, err)
+					return
+				}
+				apihelper.JSONPage(w, ss, "", int64(len(ss)))
+			},
+		),
+	}))
+	spec.Add("/{user}/sessions", "GET", apihelper.Doc{
+		Summary:  "List the user's sessions which haven't expired or been revoked",
+		AsUser:   true,
+		Response: &[]user.Session{},
+		Page:     true,
+		Errors:   []common.ExpectedErr{user.ErrBadAuth},
+	})
+
+	m.Path("/{user}/sessions/revoke-all").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"POST": requireAuthd(
+			func(w http.ResponseWriter, r *http.Request) {
+				common.HTTPError(w, r, s.RevokeAll(mux.Vars(r)["user"]))
+			},
+		),
+	}))
+	spec.Add("/{user}/sessions/revoke-all", "POST", apihelper.Doc{
+		Summary: "Revoke all of the user's sessions, logging them out everywhere",
+		AsUser:  true,
+		Errors:  []common.ExpectedErr{user.ErrBadAuth},
+	})
+}
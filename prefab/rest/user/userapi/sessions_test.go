@@ -0,0 +1,39 @@
+package userapi
+
+import (
+	. "testing"
+
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/mediocregopher/mediocre-api/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPISessions(t *T) {
+	cmder := commontest.APIStarterKit()
+	m := Mux(cmder, nil)
+	s := user.New(cmder)
+
+	u := commontest.RandStr()
+	require.Nil(t, s.Create(u, commontest.RandEmail(), commontest.RandStr()))
+	id1, err := s.NewSession(u, map[string]string{"IP": "127.0.0.1"})
+	require.Nil(t, err)
+	id2, err := s.NewSession(u, nil)
+	require.Nil(t, err)
+
+	commontest.AssertReqErr(t, m, "GET", "/"+u+"/sessions", "", user.ErrBadAuth)
+	var ss []user.Session
+	commontest.AssertReqJSON(t, m, "GET", "/"+u+"/sessions?_asUser="+u, "", &commontest.Page{Data: &ss})
+	require.Len(t, ss, 2)
+	assert.ElementsMatch(t, []string{id1, id2}, []string{ss[0].ID, ss[1].ID})
+
+	commontest.AssertReqErr(t, m, "POST", "/"+u+"/sessions/revoke-all", "", user.ErrBadAuth)
+	commontest.AssertReq(t, m, "POST", "/"+u+"/sessions/revoke-all?_asUser="+u, "", "")
+	ok, err := s.ValidSession(u, id1)
+	require.Nil(t, err)
+	assert.False(t, ok)
+
+	ss = nil
+	commontest.AssertReqJSON(t, m, "GET", "/"+u+"/sessions?_asUser="+u, "", &commontest.Page{Data: &ss})
+	assert.Empty(t, ss)
+}
@@ -0,0 +1,258 @@
+// Package userapi implements the REST interface served by the user prefab, so
+// that it can also be mounted as part of another process
+package userapi
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/common/apihelper"
+	"github.com/mediocregopher/mediocre-api/notify"
+	"github.com/mediocregopher/mediocre-api/pickyjson"
+	"github.com/mediocregopher/mediocre-api/user"
+	"github.com/mediocregopher/mediocre-api/xff"
+)
+
+// Body size limit for this module is very low, we're not dealing with large
+// requests here
+const bodySizeLimit = int64(4 * 1024)
+
+var passwordParam = pickyjson.Str{
+	MinLength: 6,
+	MaxLength: 255,
+}
+
+// The params taken in by each endpoint. Each request's params are copied from
+// these, and they're used to describe the endpoints in the OpenAPI document
+var (
+	newUserParams = struct {
+		Username, Email, Password pickyjson.Str
+	}{
+		Username: pickyjson.Username.Required(),
+		Email:    pickyjson.Email.Required(),
+		Password: passwordParam.Required(),
+	}
+
+	changePasswordParams = struct {
+		OldPassword, NewPassword pickyjson.Str
+	}{
+		OldPassword: passwordParam.Required(),
+		NewPassword: passwordParam.Required(),
+	}
+
+	authParams = struct {
+		Password pickyjson.Str
+	}{
+		Password: passwordParam.Required(),
+	}
+)
+
+// clientIP returns the ip failed authentications from the request are counted
+// against, see user.System's MaxIPAttempts
+func clientIP(r *http.Request) string {
+	if ip := xff.ClientIP(r); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+func requireAuthd(hf http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := mux.Vars(r)["user"]
+		if r.FormValue("_asUser") != u {
+			common.HTTPError(w, r, user.ErrBadAuth)
+			return
+		}
+		hf(w, r)
+	}
+}
+
+// MuxOpts are different options which may be passed into Mux. They all
+// have sane defaults which will cover most use cases
+type MuxOpts struct {
+
+	// If set, the /admin/ endpoints are enabled, and requests to them must
+	// have an "Authorization: Bearer <AdminToken>" header. Defaults to empty
+	// string (disabled)
+	AdminToken string
+
+	// If set, these user fields are mirrored into a RediSearch index, and the
+	// /admin/users/search endpoint is enabled for searching them (if
+	// AdminToken is also set). See user.System's SearchFields. Defaults to
+	// empty (disabled)
+	SearchFields []string
+
+	// Secret is used to sign the tokens emailed to users for verifying their
+	// emails and resetting their passwords, see user.System's Secret.
+	// Defaults to nil
+	Secret []byte
+
+	// If set along with Secret, the /{user}/verify and /{user}/password/reset
+	// endpoints are enabled, which email users links through this using the
+	// notify.VerifyEmail and notify.PasswordReset Templates. Defaults to nil
+	// (disabled)
+	Notify notify.Sender
+
+	// The links emailed by the /{user}/verify and /{user}/password/reset
+	// endpoints are to these urls, with "user" and "token" query parameters
+	// added. Whatever they serve (e.g. a page of the application's) should
+	// give the token to the matching /confirm endpoint. Required with Notify
+	VerifyURL, ResetURL string
+}
+
+// Mux takes in a common.Cmder and returns an http.Handler which impliments an
+// entire user system as a rest interface. See the user prefab's README for more
+// information on REST endpoints, which are also described by the OpenAPI
+// document served at /openapi.json. The passed in MuxOpts may be nil to just use
+// the defaults
+func Mux(cmder common.Cmder, o *MuxOpts) http.Handler {
+	if o == nil {
+		o = &MuxOpts{}
+	}
+
+	m := mux.NewRouter()
+	spec := apihelper.NewOpenAPI("user", "1")
+	m.Path("/openapi.json").Handler(spec)
+
+	s := user.New(cmder)
+	s.BannedUsernames = append(s.BannedUsernames, "healthz", "readyz", "admin", "openapi.json")
+	if s.SearchFields = o.SearchFields; len(s.SearchFields) > 0 {
+		s.BannedUsernames = append(s.BannedUsernames, "search")
+	}
+	s.Secret = o.Secret
+	if o.AdminToken != "" {
+		adminRoutes(m.PathPrefix("/admin").Subrouter(), spec, s, o.AdminToken)
+	}
+	if o.Notify != nil && o.Secret != nil {
+		notifyRoutes(m, spec, s, o)
+	}
+	sessionRoutes(m, spec, s)
+
+	h := common.NewHealth()
+	h.Add("user-store", common.CmderCheck(cmder))
+	if len(s.SearchFields) > 0 {
+		// Creating the index is idempotent, so it's done here in order for it
+		// to be retried until RediSearch is available
+		h.Add("user-search", s.CreateSearchIndex)
+	}
+	m.Path("/healthz").Handler(h.Liveness())
+	m.Path("/readyz").Handler(h.Readiness())
+
+	m.Path("/new-user").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"POST": func(w http.ResponseWriter, r *http.Request) {
+			j := newUserParams
+			if !apihelper.Prepare(w, r, &j, bodySizeLimit) {
+				return
+			}
+
+			err := s.Create(j.Username.Str, j.Email.Str, j.Password.Str)
+			common.HTTPError(w, r, err)
+		},
+	}))
+	spec.Add("/new-user", "POST", apihelper.Doc{
+		Summary: "Create a new user",
+		Body:    &newUserParams,
+		Errors:  []common.ExpectedErr{user.ErrUserExists, user.ErrInvalidUsername, user.ErrEmailTaken},
+	})
+
+	m.Path("/{user}").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"GET": func(w http.ResponseWriter, r *http.Request) {
+			u := mux.Vars(r)["user"]
+
+			authU := r.FormValue("_asUser")
+			var filter user.FieldFlag
+			if u == authU {
+				filter |= user.Private
+			}
+			ret, err := s.Get(u, filter)
+
+			if err != nil {
+				common.HTTPError(w, r, err)
+			} else {
+				apihelper.JSONSuccess(w, &ret)
+			}
+		},
+
+		"POST": requireAuthd(
+			func(w http.ResponseWriter, r *http.Request) {
+				u := mux.Vars(r)["user"]
+
+				j := user.Info{}
+				if !apihelper.Prepare(w, r, &j, bodySizeLimit) {
+					return
+				}
+
+				if err := s.Set(u, j); err != nil {
+					common.HTTPError(w, r, err)
+					return
+				}
+			},
+		),
+	}))
+	spec.Add("/{user}", "GET", apihelper.Doc{
+		Summary:  "Get a user's fields. Private fields are included if authed as the user",
+		AsUser:   true,
+		Response: &user.Info{},
+		Errors:   []common.ExpectedErr{user.ErrNotFound},
+	})
+	spec.Add("/{user}", "POST", apihelper.Doc{
+		Summary: "Modify one or more of a user's editable fields",
+		Body:    &user.Info{},
+		AsUser:  true,
+		Errors:  []common.ExpectedErr{user.ErrNotFound, user.ErrBadAuth, user.ErrEmailTaken},
+	})
+
+	m.Path("/{user}/password").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"POST": requireAuthd(
+			func(w http.ResponseWriter, r *http.Request) {
+				user := mux.Vars(r)["user"]
+
+				j := changePasswordParams
+				if !apihelper.Prepare(w, r, &j, bodySizeLimit) {
+					return
+				}
+
+				if err := s.AuthenticateFrom(user, j.OldPassword.Str, clientIP(r)); err != nil {
+					common.HTTPError(w, r, err)
+					return
+				}
+
+				if err := s.ChangePassword(user, j.NewPassword.Str); err != nil {
+					common.HTTPError(w, r, err)
+					return
+				}
+			},
+		),
+	}))
+	spec.Add("/{user}/password", "POST", apihelper.Doc{
+		Summary: "Change the user's password",
+		Body:    &changePasswordParams,
+		AsUser:  true,
+		Errors:  []common.ExpectedErr{user.ErrNotFound, user.ErrBadAuth, user.ErrDisabled, user.ErrTooManyAttempts},
+	})
+
+	m.Path("/{user}/auth").Handler(apihelper.Methods(map[string]http.HandlerFunc{
+		"POST": func(w http.ResponseWriter, r *http.Request) {
+			user := mux.Vars(r)["user"]
+
+			j := authParams
+			if !apihelper.Prepare(w, r, &j, bodySizeLimit) {
+				return
+			}
+
+			// login only succeeds without an error
+			if err := s.AuthenticateFrom(user, j.Password.Str, clientIP(r)); err != nil {
+				common.HTTPError(w, r, err)
+				return
+			}
+		},
+	}))
+	spec.Add("/{user}/auth", "POST", apihelper.Doc{
+		Summary: "Check the user's password",
+		Body:    &authParams,
+		Errors:  []common.ExpectedErr{user.ErrNotFound, user.ErrDisabled, user.ErrBadAuth, user.ErrTooManyAttempts},
+	})
+
+	return m
+}
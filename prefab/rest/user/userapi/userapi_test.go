@@ -1,4 +1,4 @@
-package main
+package userapi
 
 import (
 	"fmt"
@@ -14,7 +14,7 @@ import (
 
 var testMux = func() http.Handler {
 	cmder := commontest.APIStarterKit()
-	return UserMux(cmder)
+	return Mux(cmder, &MuxOpts{AdminToken: testAdminToken})
 }()
 
 func testAPICreateUser(t *T) (string, string, string) {
@@ -126,3 +126,27 @@ func TestAPIUserAuth(t *T) {
 	reqBody = fmt.Sprintf(`{"Password":"%s"}`, password)
 	commontest.AssertReq(t, testMux, "POST", url, reqBody, "")
 }
+
+func TestHealth(t *T) {
+	commontest.AssertReq(t, testMux, "GET", "/healthz", "", `{"status":"ok"}`+"\n")
+	commontest.AssertReq(t, testMux, "GET", "/readyz", "",
+		`{"status":"ok","checks":{"user-store":"ok"}}`+"\n")
+}
+
+func TestOpenAPI(t *T) {
+	var doc struct {
+		Paths map[string]map[string]struct {
+			RequestBody struct {
+				Content map[string]struct {
+					Schema struct{ Required []string }
+				}
+			}
+		}
+	}
+	commontest.AssertReqJSON(t, testMux, "GET", "/openapi.json", "", &doc)
+	for _, path := range []string{"/new-user", "/{user}", "/{user}/password", "/{user}/auth", "/admin/users/{user}"} {
+		assert.Contains(t, doc.Paths, path)
+	}
+	body := doc.Paths["/new-user"]["post"].RequestBody.Content["application/json"]
+	assert.Equal(t, []string{"Username", "Email", "Password"}, body.Schema.Required)
+}
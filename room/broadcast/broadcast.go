@@ -7,9 +7,8 @@
 //
 // - It must be periodically verified that a user is still broadcasting
 //
-// - A signature is given when starting a broadcast which can optionally be
-//   later used to authenticate a broadcast ID
-//
+//   - A signature is given when starting a broadcast which can optionally be
+//     later used to authenticate a broadcast ID
 package broadcast
 
 import (
@@ -20,6 +19,7 @@ import (
 	"strings"
 
 	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/common/events"
 	"github.com/mediocregopher/mediocre-api/room"
 	"github.com/mediocregopher/radix.v2/redis"
 	"github.com/mediocregopher/radix.v2/util"
@@ -27,9 +27,9 @@ import (
 
 // Errors which can be expected from various methods in this package
 var (
-	ErrUserIsBroadcasting = common.ExpectedErr{Code: 400, Err: "user already broadcasting"}
-	ErrInvalidID          = common.ExpectedErr{Code: 400, Err: "invalid broadcast.ID"}
-	ErrBroadcastEnded     = common.ExpectedErr{Code: 400, Err: "broadcast already ended"}
+	ErrUserIsBroadcasting = common.ExpectedErr{Code: 400, ID: "user_is_broadcasting", Err: "user already broadcasting"}
+	ErrInvalidID          = common.ExpectedErr{Code: 400, ID: "invalid_broadcast_id", Err: "invalid broadcast.ID"}
+	ErrBroadcastEnded     = common.ExpectedErr{Code: 400, ID: "broadcast_ended", Err: "broadcast already ended"}
 )
 
 // EXPIREEQUAL KEY SECONDS VALUE
@@ -60,7 +60,7 @@ var delEqual = `
 // System holds on to a room.System and implements a broadcast system around it,
 // using the room.System to track what users are in what broadcasts
 type System struct {
-	c util.Cmder
+	c common.Cmder
 	*room.System
 
 	// When set a signature will be generated for broadcast IDs which can be
@@ -72,14 +72,27 @@ type System struct {
 	// have two broadcast Systems using the same Cmder
 	Prefix string
 
+	// Tenant can be filled in on a System returned from New in order to keep
+	// its data separate from that of Systems with other Tenants, e.g. when one
+	// deployment hosts multiple applications. Like Prefix it's made part of
+	// all keys, so Active only returns the Tenant's own broadcasts. If the
+	// embedded room.System is set it should have the same Tenant
+	Tenant string
+
 	// This is the amount of seconds which is allowed to elapse with no
 	// StillBroadcasting calls for a broadcast before it is considered dead.
 	// Defaults to 30
 	AlivenessPeriod int
+
+	// If set, a BroadcastStarted event is published to this Stream whenever a
+	// broadcast is started, and a BroadcastEnded event whenever one is Ended.
+	// Both have "user" and "id" fields. Broadcasts which die from a lack of
+	// StillAlive calls don't cause a BroadcastEnded event
+	Events *events.Stream
 }
 
 // New returns a new initialized system
-func New(c util.Cmder) *System {
+func New(c common.Cmder) *System {
 	return &System{
 		c:               c,
 		AlivenessPeriod: 30,
@@ -146,7 +159,7 @@ func (s *System) Verify(id ID, sig string) bool {
 }
 
 func (s *System) userKey(user string) string {
-	k := "broadcast:" + s.Prefix + ":user:{" + user + "}"
+	k := "broadcast:" + common.TenantPrefix(s.Tenant, s.Prefix) + ":user:{" + user + "}"
 	return k
 }
 
@@ -163,6 +176,7 @@ func (s *System) StartBroadcast(user string) (ID, string, error) {
 	} else if r.IsType(redis.Nil) {
 		return "", "", ErrUserIsBroadcasting
 	}
+	events.PublishOrLog(s.Events, events.BroadcastStarted, map[string]string{"user": user, "id": string(id)})
 	return id, sig, nil
 }
 
@@ -201,6 +215,7 @@ func (s *System) Ended(id ID) error {
 	if i == 0 {
 		return ErrBroadcastEnded
 	}
+	events.PublishOrLog(s.Events, events.BroadcastEnded, map[string]string{"user": user, "id": string(id)})
 	return nil
 }
 
@@ -225,3 +240,36 @@ func (s *System) GetBroadcastID(user string) (ID, error) {
 	}
 	return id, nil
 }
+
+// Active returns the IDs of all broadcasts which are currently going, in no
+// particular order
+func (s *System) Active() ([]ID, error) {
+	ch := make(chan string)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- common.Scan(s.c, ch, "SCAN", "", s.userKey("*"))
+	}()
+
+	var keys []string
+	for key := range ch {
+		keys = append(keys, key)
+	}
+	if err := <-errCh; err != nil {
+		return nil, err
+	}
+
+	ids := make([]ID, 0, len(keys))
+	for _, key := range keys {
+		r := s.c.Cmd("GET", key)
+		if r.IsType(redis.Nil) {
+			// The broadcast ended since the SCAN
+			continue
+		}
+		idStr, err := r.Str()
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, ID(idStr))
+	}
+	return ids, nil
+}
@@ -5,7 +5,6 @@ import (
 	"time"
 
 	"github.com/mediocregopher/mediocre-api/common/commontest"
-	"github.com/mediocregopher/radix.v2/pool"
 	"github.com/mediocregopher/radix.v2/redis"
 	"github.com/mediocregopher/radix.v2/util"
 	"github.com/stretchr/testify/assert"
@@ -13,10 +12,10 @@ import (
 )
 
 func testSystem(t *T) *System {
-	p, err := pool.New("tcp", "localhost:6379", 10)
-	require.Nil(t, err)
+	p := commontest.APIStarterKit()
 
 	s := New(p)
+	s.Prefix = commontest.KeyPrefix(t, p)
 	s.AlivenessPeriod = 1
 	s.Secret = []byte("TURTLES")
 	return s
@@ -92,12 +91,32 @@ func TestEnded(t *T) {
 	assert.Equal(t, ErrBroadcastEnded, s.Ended(id))
 }
 
-func TestExpireEqual(t *T) {
-	p, err := redis.Dial("tcp", "localhost:6379")
+func TestActive(t *T) {
+	s := testSystem(t)
+	ids, err := s.Active()
+	require.Nil(t, err)
+	assert.Empty(t, ids)
+
+	id1, _, err := s.StartBroadcast(commontest.RandStr())
+	require.Nil(t, err)
+	id2, _, err := s.StartBroadcast(commontest.RandStr())
 	require.Nil(t, err)
 
+	ids, err = s.Active()
+	require.Nil(t, err)
+	assert.ElementsMatch(t, []ID{id1, id2}, ids)
+
+	require.Nil(t, s.Ended(id1))
+	ids, err = s.Active()
+	require.Nil(t, err)
+	assert.Equal(t, []ID{id2}, ids)
+}
+
+func TestExpireEqual(t *T) {
+	p := commontest.APIStarterKit()
+
 	// Set value to "key"
-	key := commontest.RandStr()
+	key := commontest.KeyPrefix(t, p) + ":" + commontest.RandStr()
 	require.Nil(t, p.Cmd("SET", key, "key").Err)
 
 	// Try to set expire with wrong value, should return 0 and not have any ttl
@@ -120,11 +139,10 @@ func TestExpireEqual(t *T) {
 }
 
 func TestDelEqual(t *T) {
-	p, err := redis.Dial("tcp", "localhost:6379")
-	require.Nil(t, err)
+	p := commontest.APIStarterKit()
 
 	// Set value to "key"
-	key := commontest.RandStr()
+	key := commontest.KeyPrefix(t, p) + ":" + commontest.RandStr()
 	require.Nil(t, p.Cmd("SET", key, "key").Err)
 
 	// Try to delete with wrong value, should return 0 and the value still be
@@ -146,3 +164,20 @@ func TestDelEqual(t *T) {
 	r := p.Cmd("GET", key)
 	assert.True(t, r.IsType(redis.Nil))
 }
+
+func TestTenant(t *T) {
+	s1, s2 := testSystem(t), testSystem(t)
+	s2.Prefix, s2.Tenant = s1.Prefix, commontest.RandStr()
+	user := commontest.RandStr()
+
+	id1, _, err := s1.StartBroadcast(user)
+	require.Nil(t, err)
+	id2, _, err := s2.StartBroadcast(user)
+	require.Nil(t, err)
+	assertUserBroadcastID(t, s1, user, id1)
+	assertUserBroadcastID(t, s2, user, id2)
+
+	ids, err := s2.Active()
+	require.Nil(t, err)
+	assert.Equal(t, []ID{id2}, ids)
+}
@@ -6,12 +6,14 @@ import (
 	"strings"
 	"time"
 
-	"github.com/mediocregopher/radix.v2/util"
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/common/cache"
+	"github.com/mediocregopher/mediocre-api/common/events"
 )
 
 // System holds on to a Cmder and uses it to implement a basic room system
 type System struct {
-	c      util.Cmder
+	c      common.Cmder
 	o      *Opts
 	stopCh chan struct{}
 }
@@ -25,16 +27,36 @@ type Opts struct {
 	// all key names
 	Prefix string
 
+	// Tenant can be used to keep the System's data separate from that of
+	// Systems with other Tenants, e.g. when one deployment hosts multiple
+	// applications. Like Prefix it's made part of all key names, so rooms with
+	// the same name in different Tenants are different rooms, and idle members
+	// are only removed from the System's own Tenant's rooms
+	Tenant string
+
 	// CheckInPeriod indicates how long a user has to check in to a room before
 	// they are recorded as not being in it anymore. It should not be set to
 	// less than 1 second. Defaults to 30 seconds
 	CheckInPeriod time.Duration
+
+	// If set, a RoomJoined event is published to this Stream whenever a user
+	// checks in to a room they weren't already in, and a RoomLeft event
+	// whenever they check out of one. Both have "room" and "user" fields.
+	// Users removed for not checking in don't cause a RoomLeft event
+	Events *events.Stream
+
+	// If set, Cardinality caches rooms' cardinalities in it. Rooms are
+	// invalidated in it, and published to CacheChannel, whenever a user joins
+	// or leaves them through this System, so every System sharing the same
+	// data should have a Cache set and be calling its Listen with
+	// CacheChannel in order to see each other's changes right away
+	Cache *cache.Cache
 }
 
 // New returns a new System which will use the given Cmder as its persistence
 // layer. The passed in Opts may be used to modify behavior of the System, or
 // may be nil to just use the defaults
-func New(c util.Cmder, o *Opts) *System {
+func New(c common.Cmder, o *Opts) *System {
 	if o == nil {
 		o = &Opts{}
 	}
@@ -51,30 +73,63 @@ func New(c util.Cmder, o *Opts) *System {
 	return &s
 }
 
+// prefix returns the prefix used in all key names, taking both Prefix and
+// Tenant into account
+func (s *System) prefix() string {
+	return common.TenantPrefix(s.o.Tenant, s.o.Prefix)
+}
+
 // Key returns a key which can be used to interact with some arbitrary room data
 // directly in redis. This is useful if more complicated, lower level operations
 // are needed to be done
 func (s *System) Key(room string, extra ...string) string {
-	k := "room:" + s.o.Prefix + ":{" + room + "}"
+	k := "room:" + s.prefix() + ":{" + room + "}"
 	if len(extra) > 0 {
 		k += ":" + strings.Join(extra, ":")
 	}
 	return k
 }
 
+// CacheChannel returns the pub/sub channel which changed rooms are published
+// to when a Cache is set, see the Cache field of Opts
+func (s *System) CacheChannel() string {
+	return "room:" + s.prefix() + ":cache"
+}
+
+// uncache invalidates the given room in the Cache, if one is set
+func (s *System) uncache(room string) {
+	if s.o.Cache != nil {
+		s.o.Cache.Invalidate(s.c, s.CacheChannel(), room)
+	}
+}
+
 // CheckIn records that a user with the given id has joined the given room. The
 // user must check in periodically (see the CheckInPeriod field of System) or
 // they will be recorded as not in the room anymore
 func (s *System) CheckIn(room, id string) error {
 	now := time.Now().UTC().UnixNano()
 	key := s.Key(room)
-	return s.c.Cmd("ZADD", key, now, id).Err
+	added, err := s.c.Cmd("ZADD", key, now, id).Int()
+	if err != nil {
+		return err
+	} else if added > 0 {
+		s.uncache(room)
+		events.PublishOrLog(s.o.Events, events.RoomJoined, map[string]string{"room": room, "user": id})
+	}
+	return nil
 }
 
 // CheckOut records that a user is no longer in a room
 func (s *System) CheckOut(room, id string) error {
 	key := s.Key(room)
-	return s.c.Cmd("ZREM", key, id).Err
+	removed, err := s.c.Cmd("ZREM", key, id).Int()
+	if err != nil {
+		return err
+	} else if removed > 0 {
+		s.uncache(room)
+		events.PublishOrLog(s.o.Events, events.RoomLeft, map[string]string{"room": room, "user": id})
+	}
+	return nil
 }
 
 // Members returns the list of user ids currently checked into a room
@@ -85,8 +140,23 @@ func (s *System) Members(room string) ([]string, error) {
 
 // Cardinality returns the number of user ids currently checked into a room
 func (s *System) Cardinality(room string) (int64, error) {
+	var gen uint64
+	if s.o.Cache != nil {
+		if n, ok := s.o.Cache.Get(room); ok {
+			return n.(int64), nil
+		}
+		gen = s.o.Cache.Gen(room)
+	}
+
 	key := s.Key(room)
-	return s.c.Cmd("ZCARD", key).Int64()
+	n, err := s.c.Cmd("ZCARD", key).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if s.o.Cache != nil {
+		s.o.Cache.SetIfUnchanged(room, gen, n)
+	}
+	return n, nil
 }
 
 // Stop cleans up any go routines that this room system has running for it. It
@@ -114,14 +184,27 @@ func (s *System) removeIdle() error {
 
 	var err error
 	go func() {
-		err = util.Scan(s.c, ch, "SCAN", "", s.Key("*"))
+		err = common.Scan(s.c, ch, "SCAN", "", s.Key("*"))
 	}()
 
 	for key := range ch {
 		// TODO We can't report an error from here unfortunately. That's
 		// something I'll need to address in radix.v2
-		s.c.Cmd("ZREMRANGEBYSCORE", key, "-inf", expire)
+		removed, _ := s.c.Cmd("ZREMRANGEBYSCORE", key, "-inf", expire).Int()
+		if removed > 0 {
+			s.uncache(roomFromKey(key))
+		}
 	}
 
 	return err
 }
+
+// roomFromKey returns the name of the room whose Key is the given one
+func roomFromKey(key string) string {
+	start := strings.Index(key, "{") + 1
+	end := strings.LastIndex(key, "}")
+	if start == 0 || end < start {
+		return ""
+	}
+	return key[start:end]
+}
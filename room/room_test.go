@@ -5,17 +5,22 @@ import (
 	. "testing"
 	"time"
 
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/common/cache"
 	"github.com/mediocregopher/mediocre-api/common/commontest"
-	"github.com/mediocregopher/radix.v2/pool"
+	"github.com/mediocregopher/mediocre-api/common/events"
+	"github.com/mediocregopher/radix.v2/redis"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func testSystem(t *T) *System {
-	p, err := pool.New("tcp", "localhost:6379", 10)
-	require.Nil(t, err)
+	p := commontest.APIStarterKit()
 
-	return New(p, &Opts{CheckInPeriod: 1 * time.Second})
+	return New(p, &Opts{
+		Prefix:        commontest.KeyPrefix(t, p),
+		CheckInPeriod: 1 * time.Second,
+	})
 }
 
 func assertRoomMembers(t *T, s *System, room string, members ...string) {
@@ -113,3 +118,113 @@ func TestLeave(t *T) {
 	assertRoomMembers(t, s, room2, user2)
 	assertRoomMembers(t, s, room3)
 }
+
+func TestEvents(t *T) {
+	if commontest.InProcess {
+		t.Skip("the in-process redis doesn't support streams")
+	}
+	p := commontest.APIStarterKit()
+	prefix := commontest.KeyPrefix(t, p)
+	es := events.New(p, &events.Opts{Key: "events:" + prefix})
+	s := New(p, &Opts{Prefix: prefix, Events: es})
+
+	room, user := commontest.RandStr(), commontest.RandStr()
+	require.Nil(t, s.CheckIn(room, user))
+	require.Nil(t, s.CheckIn(room, user))
+	require.Nil(t, s.CheckOut(room, user))
+	require.Nil(t, s.CheckOut(room, user))
+
+	evs, err := es.Replay("-", "+", 10)
+	require.Nil(t, err)
+	fields := map[string]string{"room": room, "user": user}
+	require.Len(t, evs, 2)
+	assert.Equal(t, events.RoomJoined, evs[0].Type)
+	assert.Equal(t, fields, evs[0].Fields)
+	assert.Equal(t, events.RoomLeft, evs[1].Type)
+	assert.Equal(t, fields, evs[1].Fields)
+}
+
+func TestCache(t *T) {
+	p := commontest.APIStarterKit()
+	s := New(p, &Opts{
+		Prefix:        commontest.KeyPrefix(t, p),
+		CheckInPeriod: 1 * time.Second,
+		Cache:         cache.New(10, time.Minute),
+	})
+	defer s.Stop()
+	room := commontest.RandStr()
+	assertCard := func(expected int64) {
+		c, err := s.Cardinality(room)
+		require.Nil(t, err)
+		assert.Equal(t, expected, c)
+	}
+
+	require.Nil(t, s.CheckIn(room, "a"))
+	require.Nil(t, s.CheckIn(room, "b"))
+	assertCard(2)
+
+	// Changes made behind the System's back aren't seen while cached
+	require.Nil(t, p.Cmd("ZADD", s.Key(room), time.Now().UnixNano(), "c").Err)
+	assertCard(2)
+
+	// Checking out invalidates the room, so c is seen now as well
+	require.Nil(t, s.CheckOut(room, "a"))
+	assertCard(2)
+
+	// Users removed for not checking in invalidate the room too
+	time.Sleep(2 * time.Second)
+	assertCard(0)
+}
+
+// changeDuringRead is a Cmder which calls change right after the first ZCARD
+// made through it has been read, but before it's returned
+type changeDuringRead struct {
+	common.Cmder
+	change func()
+}
+
+func (c *changeDuringRead) Cmd(cmd string, args ...interface{}) *redis.Resp {
+	r := c.Cmder.Cmd(cmd, args...)
+	if cmd == "ZCARD" && c.change != nil {
+		change := c.change
+		c.change = nil
+		change()
+	}
+	return r
+}
+
+func TestCacheChangeDuringRead(t *T) {
+	p := commontest.APIStarterKit()
+	c := &changeDuringRead{Cmder: p}
+	s := New(c, &Opts{
+		Prefix: commontest.KeyPrefix(t, p),
+		Cache:  cache.New(10, time.Minute),
+	})
+	defer s.Stop()
+	room := commontest.RandStr()
+
+	// A check in which happens while the room is being read means what was
+	// read isn't cached
+	c.change = func() { require.Nil(t, s.CheckIn(room, "a")) }
+	n, err := s.Cardinality(room)
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = s.Cardinality(room)
+	require.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestTenant(t *T) {
+	s1 := testSystem(t)
+	s2 := New(s1.c, &Opts{
+		Prefix:        s1.o.Prefix,
+		Tenant:        commontest.RandStr(),
+		CheckInPeriod: 1 * time.Second,
+	})
+	room, u1, u2 := commontest.RandStr(), commontest.RandStr(), commontest.RandStr()
+
+	require.Nil(t, s1.CheckIn(room, u1))
+	require.Nil(t, s2.CheckIn(room, u2))
+	assertRoomMembers(t, s1, room, u1)
+	assertRoomMembers(t, s2, room, u2)
+}
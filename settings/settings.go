@@ -0,0 +1,294 @@
+// Package settings implements namespaced application settings stored in redis,
+// with typed getters, notifications of changes over redis pub/sub, and optional
+// in-process caching
+package settings
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/radix.v2/redis"
+)
+
+// ErrNotFound is returned when getting a setting which hasn't been set
+var ErrNotFound = common.ExpectedErr{Code: 404, ID: "setting_not_found", Err: "setting not found"}
+
+// Change describes a setting which was Set or Deleted, and is what's passed to
+// the function given to Listen
+type Change struct {
+	Namespace string
+	Key       string
+}
+
+// System holds on to a Cmder and uses it to implement a settings system
+type System struct {
+	c common.Cmder
+	o *Opts
+
+	cacheL sync.Mutex
+	cache  map[string]cacheEntry
+
+	// gens counts how many times each namespace has been uncached, so that a
+	// read which started before a change isn't cached after it
+	gens map[string]uint64
+}
+
+type cacheEntry struct {
+	vals    map[string]string
+	expires time.Time
+}
+
+// Opts are different options which may be passed into New when creating a
+// system. They all have sane defaults which will cover most use cases
+type Opts struct {
+
+	// Prefix can be used if you wish to have two separate settings systems
+	// being persisted on the same Cmder. Prefix will be part of a string
+	// prepended to all key names
+	Prefix string
+
+	// If set, all of a namespace's settings are cached in memory for this long
+	// once any of them is read, so that frequently read settings don't each
+	// need a round-trip to redis. Changes made through this System are seen
+	// right away, but those made elsewhere may not be seen until the cache
+	// expires, unless Listen is being called. Defaults to 0 (no caching)
+	CacheTTL time.Duration
+}
+
+// New returns a new System which will use the given Cmder as its persistence
+// layer. The passed in Opts may be used to modify behavior of the System, or
+// may be nil to just use the defaults
+func New(c common.Cmder, o *Opts) *System {
+	if o == nil {
+		o = &Opts{}
+	}
+	return &System{
+		c:     c,
+		o:     o,
+		cache: map[string]cacheEntry{},
+		gens:  map[string]uint64{},
+	}
+}
+
+// Key returns a key which can be used to interact with some arbitrary settings
+// data directly in redis. This is useful if more complicated, lower level
+// operations are needed to be done. All of a namespace's settings are held in a
+// single hash at Key(namespace)
+func (s *System) Key(namespace string, extra ...string) string {
+	k := "settings:" + s.o.Prefix + ":{" + namespace + "}"
+	if len(extra) > 0 {
+		k += ":" + strings.Join(extra, ":")
+	}
+	return k
+}
+
+// Channel returns the redis pub/sub channel a Change is published to, as json,
+// whenever a setting is Set or Deleted. Publishing is best-effort, errors doing
+// so are logged to common.Log
+func (s *System) Channel() string {
+	return "settings:" + s.o.Prefix + ":changes"
+}
+
+// encode returns the string form a value is stored as. Strings are stored as
+// they are, bools, numbers, and time.Durations in the form strconv and
+// time.ParseDuration parse, and everything else as json
+func encode(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case time.Duration:
+		return v.String(), nil
+	case int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64:
+		return fmt.Sprint(v), nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// Set sets the setting with the given key in the given namespace to the given
+// value, which is read back with the getter matching its type (e.g. GetInt for
+// an int, GetJSON for a struct)
+func (s *System) Set(namespace, key string, v interface{}) error {
+	str, err := encode(v)
+	if err != nil {
+		return err
+	}
+	if err := s.c.Cmd("HSET", s.Key(namespace), key, str).Err; err != nil {
+		return err
+	}
+	s.changed(namespace, key)
+	return nil
+}
+
+// Delete removes the setting with the given key from the given namespace. It
+// is not an error if the setting doesn't exist
+func (s *System) Delete(namespace, key string) error {
+	if err := s.c.Cmd("HDEL", s.Key(namespace), key).Err; err != nil {
+		return err
+	}
+	s.changed(namespace, key)
+	return nil
+}
+
+// changed drops the namespace from the cache and publishes the Change, see
+// common.Publish
+func (s *System) changed(namespace, key string) {
+	s.uncache(namespace)
+	b, _ := json.Marshal(Change{Namespace: namespace, Key: key})
+	common.Publish(s.c, s.Channel(), b, "settings change "+namespace+"/"+key)
+}
+
+func (s *System) uncache(namespace string) {
+	s.cacheL.Lock()
+	delete(s.cache, namespace)
+	s.gens[namespace]++
+	s.cacheL.Unlock()
+}
+
+// All returns every setting in the given namespace, as the strings they're
+// stored as
+func (s *System) All(namespace string) (map[string]string, error) {
+	if s.o.CacheTTL <= 0 {
+		return s.c.Cmd("HGETALL", s.Key(namespace)).Map()
+	}
+
+	s.cacheL.Lock()
+	e, ok := s.cache[namespace]
+	gen := s.gens[namespace]
+	s.cacheL.Unlock()
+	if !ok || time.Now().After(e.expires) {
+		vals, err := s.c.Cmd("HGETALL", s.Key(namespace)).Map()
+		if err != nil {
+			return nil, err
+		}
+		// If the namespace was uncached while reading it then what was read
+		// may already be stale, so it's returned but not cached
+		e = cacheEntry{vals: vals, expires: time.Now().Add(s.o.CacheTTL)}
+		s.cacheL.Lock()
+		if s.gens[namespace] == gen {
+			s.cache[namespace] = e
+		}
+		s.cacheL.Unlock()
+	}
+
+	vals := make(map[string]string, len(e.vals))
+	for k, v := range e.vals {
+		vals[k] = v
+	}
+	return vals, nil
+}
+
+// Get returns the setting with the given key in the given namespace, as the
+// string it's stored as, or ErrNotFound if it hasn't been set
+func (s *System) Get(namespace, key string) (string, error) {
+	if s.o.CacheTTL > 0 {
+		vals, err := s.All(namespace)
+		if err != nil {
+			return "", err
+		} else if v, ok := vals[key]; ok {
+			return v, nil
+		}
+		return "", ErrNotFound
+	}
+
+	r := s.c.Cmd("HGET", s.Key(namespace), key)
+	if r.Err != nil {
+		return "", r.Err
+	} else if r.IsType(redis.Nil) {
+		return "", ErrNotFound
+	}
+	return r.Str()
+}
+
+// get calls Get and passes the result to the given parse function, adding the
+// namespace and key to any error it returns
+func (s *System) get(namespace, key string, parse func(string) error) error {
+	str, err := s.Get(namespace, key)
+	if err != nil {
+		return err
+	}
+	if err := parse(str); err != nil {
+		return fmt.Errorf("setting %s/%s: %s", namespace, key, err)
+	}
+	return nil
+}
+
+// GetInt is like Get, but parses the setting as an integer
+func (s *System) GetInt(namespace, key string) (int64, error) {
+	var i int64
+	err := s.get(namespace, key, func(str string) (err error) {
+		i, err = strconv.ParseInt(str, 10, 64)
+		return
+	})
+	return i, err
+}
+
+// GetFloat is like Get, but parses the setting as a floating point number
+func (s *System) GetFloat(namespace, key string) (float64, error) {
+	var f float64
+	err := s.get(namespace, key, func(str string) (err error) {
+		f, err = strconv.ParseFloat(str, 64)
+		return
+	})
+	return f, err
+}
+
+// GetBool is like Get, but parses the setting as a bool
+func (s *System) GetBool(namespace, key string) (bool, error) {
+	var b bool
+	err := s.get(namespace, key, func(str string) (err error) {
+		b, err = strconv.ParseBool(str)
+		return
+	})
+	return b, err
+}
+
+// GetDuration is like Get, but parses the setting as a time.Duration
+func (s *System) GetDuration(namespace, key string) (time.Duration, error) {
+	var d time.Duration
+	err := s.get(namespace, key, func(str string) (err error) {
+		d, err = time.ParseDuration(str)
+		return
+	})
+	return d, err
+}
+
+// GetJSON is like Get, but unmarshals the setting as json into the given value
+func (s *System) GetJSON(namespace, key string, v interface{}) error {
+	return s.get(namespace, key, func(str string) error {
+		return json.Unmarshal([]byte(str), v)
+	})
+}
+
+// Listen calls fn with every Change published to Channel, whether by this
+// System or another one with the same Prefix (e.g. in another process), see
+// common.Subscribe. Changed namespaces are dropped from the cache before fn is
+// called, so with Listen running the cache never serves a stale setting for
+// longer than it takes the Change to arrive. fn may be nil if only that is
+// wanted
+func (s *System) Listen(conn *redis.Client, fn func(Change)) error {
+	return common.Subscribe(conn, s.Channel(), func(msg string) {
+		var c Change
+		if err := json.Unmarshal([]byte(msg), &c); err != nil {
+			if common.Log != nil {
+				common.Log.Printf("bad settings change message %q: %s", msg, err)
+			}
+			return
+		}
+		s.uncache(c.Namespace)
+		if fn != nil {
+			fn(c)
+		}
+	})
+}
@@ -0,0 +1,176 @@
+package settings
+
+import (
+	. "testing"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/mediocregopher/radix.v2/pool"
+	"github.com/mediocregopher/radix.v2/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSystem(t *T, cacheTTL time.Duration) *System {
+	p := commontest.APIStarterKit()
+	return New(p, &Opts{Prefix: commontest.KeyPrefix(t, p), CacheTTL: cacheTTL})
+}
+
+func TestSetGet(t *T) {
+	s := testSystem(t, 0)
+	ns := commontest.RandStr()
+
+	_, err := s.Get(ns, "foo")
+	assert.Equal(t, ErrNotFound, err)
+	_, err = s.GetInt(ns, "foo")
+	assert.Equal(t, ErrNotFound, err)
+
+	require.Nil(t, s.Set(ns, "str", "bar"))
+	require.Nil(t, s.Set(ns, "int", 5))
+	require.Nil(t, s.Set(ns, "float", 1.5))
+	require.Nil(t, s.Set(ns, "bool", true))
+	require.Nil(t, s.Set(ns, "dur", 90*time.Second))
+	require.Nil(t, s.Set(ns, "json", map[string]int{"a": 1}))
+
+	str, err := s.Get(ns, "str")
+	require.Nil(t, err)
+	assert.Equal(t, "bar", str)
+
+	i, err := s.GetInt(ns, "int")
+	require.Nil(t, err)
+	assert.Equal(t, int64(5), i)
+
+	f, err := s.GetFloat(ns, "float")
+	require.Nil(t, err)
+	assert.Equal(t, 1.5, f)
+
+	b, err := s.GetBool(ns, "bool")
+	require.Nil(t, err)
+	assert.True(t, b)
+
+	d, err := s.GetDuration(ns, "dur")
+	require.Nil(t, err)
+	assert.Equal(t, 90*time.Second, d)
+
+	var m map[string]int
+	require.Nil(t, s.GetJSON(ns, "json", &m))
+	assert.Equal(t, map[string]int{"a": 1}, m)
+
+	_, err = s.GetInt(ns, "str")
+	assert.NotNil(t, err)
+
+	all, err := s.All(ns)
+	require.Nil(t, err)
+	assert.Len(t, all, 6)
+	assert.Equal(t, "1m30s", all["dur"])
+
+	// Namespaces are separate
+	_, err = s.Get(commontest.RandStr(), "str")
+	assert.Equal(t, ErrNotFound, err)
+
+	require.Nil(t, s.Delete(ns, "str"))
+	require.Nil(t, s.Delete(ns, "str"))
+	_, err = s.Get(ns, "str")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestCache(t *T) {
+	s := testSystem(t, time.Minute)
+	s2 := New(s.c, &Opts{Prefix: s.o.Prefix})
+	ns := commontest.RandStr()
+
+	_, err := s.Get(ns, "foo")
+	assert.Equal(t, ErrNotFound, err)
+
+	// Changes made through the same System are seen right away
+	require.Nil(t, s.Set(ns, "foo", "bar"))
+	v, err := s.Get(ns, "foo")
+	require.Nil(t, err)
+	assert.Equal(t, "bar", v)
+
+	// Those made elsewhere aren't, until the cache is dropped
+	require.Nil(t, s2.Set(ns, "foo", "baz"))
+	v, err = s.Get(ns, "foo")
+	require.Nil(t, err)
+	assert.Equal(t, "bar", v)
+
+	s.uncache(ns)
+	v, err = s.Get(ns, "foo")
+	require.Nil(t, err)
+	assert.Equal(t, "baz", v)
+}
+
+// changeDuringRead is a Cmder which calls change right after the first HGETALL
+// made through it has been read, but before it's returned
+type changeDuringRead struct {
+	common.Cmder
+	change func()
+}
+
+func (c *changeDuringRead) Cmd(cmd string, args ...interface{}) *redis.Resp {
+	r := c.Cmder.Cmd(cmd, args...)
+	if cmd == "HGETALL" && c.change != nil {
+		change := c.change
+		c.change = nil
+		change()
+	}
+	return r
+}
+
+func TestCacheChangeDuringRead(t *T) {
+	s := testSystem(t, time.Minute)
+	ns := commontest.RandStr()
+	require.Nil(t, s.Set(ns, "foo", "bar"))
+
+	// A Set which happens while the namespace is being read means what was
+	// read isn't cached
+	c := &changeDuringRead{Cmder: s.c}
+	c.change = func() { require.Nil(t, s.Set(ns, "foo", "baz")) }
+	s.c = c
+	v, err := s.Get(ns, "foo")
+	require.Nil(t, err)
+	assert.Equal(t, "bar", v)
+	v, err = s.Get(ns, "foo")
+	require.Nil(t, err)
+	assert.Equal(t, "baz", v)
+}
+
+func TestListen(t *T) {
+	if commontest.InProcess {
+		t.Skip("the in-process redis doesn't support pub/sub")
+	}
+	s := testSystem(t, time.Minute)
+	p, ok := s.c.(*pool.Pool)
+	if !ok {
+		t.Skip("test redis isn't a single instance")
+	}
+	conn, err := p.Get()
+	require.Nil(t, err)
+
+	ch := make(chan Change, 1)
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.Listen(conn, func(c Change) { ch <- c }) }()
+	// Give the subscription time to be made
+	time.Sleep(100 * time.Millisecond)
+
+	ns := commontest.RandStr()
+	_, err = s.Get(ns, "foo")
+	assert.Equal(t, ErrNotFound, err)
+
+	s2 := New(s.c, &Opts{Prefix: s.o.Prefix})
+	require.Nil(t, s2.Set(ns, "foo", "bar"))
+	select {
+	case c := <-ch:
+		assert.Equal(t, Change{Namespace: ns, Key: "foo"}, c)
+	case <-time.After(5 * time.Second):
+		t.Fatal("change never received")
+	}
+
+	v, err := s.Get(ns, "foo")
+	require.Nil(t, err)
+	assert.Equal(t, "bar", v)
+
+	conn.Close()
+	assert.NotNil(t, <-errCh)
+}
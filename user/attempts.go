@@ -0,0 +1,126 @@
+package user
+
+import (
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/radix.v2/redis"
+	"github.com/mediocregopher/radix.v2/util"
+)
+
+// ErrTooManyAttempts is returned from Authenticate when there have been too many
+// failed attempts to authenticate as the user, or from the ip, recently. See
+// MaxAttempts
+var ErrTooManyAttempts = common.ExpectedErr{Code: 429, ID: "too_many_attempts", Err: "too many failed attempts, try again later"}
+
+// RESERVEATTEMPT key max milliseconds
+// If the counter at the key is below max, increments it and sets it to expire
+// in the given number of milliseconds, returning 1. Otherwise returns 0 and
+// leaves it alone
+var reserveAttempt = `
+	local n = tonumber(redis.call('GET', KEYS[1]) or '0')
+	if n >= tonumber(ARGV[1]) then
+		return 0
+	end
+	redis.call('INCR', KEYS[1])
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+`
+
+// RELEASEATTEMPT key
+// Decrements the counter at the key, unless it's expired
+var releaseAttempt = `
+	if redis.call('EXISTS', KEYS[1]) == 1 then
+		redis.call('DECR', KEYS[1])
+	end
+`
+
+// attemptsKey returns the key counting recent failed attempts to authenticate
+// as the user. It's under Key(user, ...) so that Delete removes it
+func (s *System) attemptsKey(user string) string {
+	return s.Key(user, "attempts")
+}
+
+// ipAttemptsKey returns the key counting recent failed attempts to authenticate
+// from the ip
+func (s *System) ipAttemptsKey(ip string) string {
+	if p := s.prefix(); p != "" {
+		return "user:" + p + ":attempts:{" + ip + "}"
+	}
+	return "user:attempts:{" + ip + "}"
+}
+
+// reserveAttempt counts an attempt in the counter at the given key, unless it
+// has already reached max, in which case false is returned. A max of 0 or less
+// means there is no limit, and nothing is counted.
+//
+// Attempts are counted before they're checked rather than once they've failed,
+// so that many made at once can't all get in before any of them is counted.
+// Attempts which turn out not to have failed are released using releaseAttempt
+func (s *System) reserveAttempt(key string, max int) (bool, error) {
+	if max <= 0 {
+		return true, nil
+	}
+	ms := int64(s.LockoutPeriod / time.Millisecond)
+	n, err := util.LuaEval(s.c, reserveAttempt, 1, key, max, ms).Int()
+	return n == 1, err
+}
+
+// releaseAttempt un-counts an attempt counted by reserveAttempt
+func (s *System) releaseAttempt(key string, max int) error {
+	if max <= 0 {
+		return nil
+	}
+	return util.LuaEval(s.c, releaseAttempt, 1, key).Err
+}
+
+// reserveAttempts reserves an attempt against both the user and the ip (if
+// given), see reserveAttempt, returning ErrTooManyAttempts if either has too
+// many recent failed attempts. The two are counted separately, as their keys
+// may be on different nodes of a cluster
+func (s *System) reserveAttempts(user, ip string) error {
+	if ok, err := s.reserveAttempt(s.attemptsKey(user), s.MaxAttempts); err != nil {
+		return err
+	} else if !ok {
+		return ErrTooManyAttempts
+	} else if ip == "" {
+		return nil
+	}
+
+	if ok, err := s.reserveAttempt(s.ipAttemptsKey(ip), s.MaxIPAttempts); err != nil {
+		return err
+	} else if !ok {
+		if err := s.releaseAttempt(s.attemptsKey(user), s.MaxAttempts); err != nil {
+			return err
+		}
+		return ErrTooManyAttempts
+	}
+	return nil
+}
+
+// releaseAttempts releases the attempts reserved by reserveAttempts
+func (s *System) releaseAttempts(user, ip string) error {
+	if err := s.releaseAttempt(s.attemptsKey(user), s.MaxAttempts); err != nil {
+		return err
+	} else if ip == "" {
+		return nil
+	}
+	return s.releaseAttempt(s.ipAttemptsKey(ip), s.MaxIPAttempts)
+}
+
+// Attempts returns the number of recent failed attempts to authenticate as the
+// given user, as counted towards MaxAttempts. Attempts which are still being
+// checked are included
+func (s *System) Attempts(user string) (int, error) {
+	r := s.c.Cmd("GET", s.attemptsKey(user))
+	if r.IsType(redis.Nil) {
+		return 0, nil
+	}
+	return r.Int()
+}
+
+// ResetAttempts forgets about the recent failed attempts to authenticate as the
+// given user, lifting their lockout if they have one
+func (s *System) ResetAttempts(user string) error {
+	return s.c.Cmd("DEL", s.attemptsKey(user)).Err
+}
@@ -0,0 +1,109 @@
+package user
+
+import (
+	"sync"
+	. "testing"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttempts(t *T) {
+	s := testSystem(t)
+	s.BCryptCost = 4
+	s.MaxAttempts = 3
+	user, _, password := randUser(t, s)
+
+	// A success forgets about earlier failures
+	assert.Equal(t, ErrBadAuth, s.Authenticate(user, "bogus"))
+	assert.Equal(t, ErrBadAuth, s.Authenticate(user, "bogus"))
+	require.Nil(t, s.Authenticate(user, password))
+	n, err := s.Attempts(user)
+	require.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, ErrBadAuth, s.Authenticate(user, "bogus"))
+	}
+	assert.Equal(t, ErrTooManyAttempts, s.Authenticate(user, password))
+	n, err = s.Attempts(user)
+	require.Nil(t, err)
+	assert.Equal(t, 3, n)
+
+	require.Nil(t, s.ResetAttempts(user))
+	require.Nil(t, s.Authenticate(user, password))
+
+	// The lockout expires by itself
+	s.LockoutPeriod = 100 * time.Millisecond
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, ErrBadAuth, s.Authenticate(user, "bogus"))
+	}
+	assert.Equal(t, ErrTooManyAttempts, s.Authenticate(user, password))
+	time.Sleep(200 * time.Millisecond)
+	require.Nil(t, s.Authenticate(user, password))
+}
+
+func TestIPAttempts(t *T) {
+	s := testSystem(t)
+	s.BCryptCost = 4
+	s.MaxIPAttempts = 3
+	user, _, password := randUser(t, s)
+	ip, ip2 := commontest.RandStr(), commontest.RandStr()
+
+	// Failures for users which don't exist count too, and success doesn't
+	// reset the ip's count
+	assert.Equal(t, ErrBadAuth, s.AuthenticateFrom(user, "bogus", ip))
+	assert.Equal(t, ErrNotFound, s.AuthenticateFrom(commontest.RandStr(), "bogus", ip))
+	require.Nil(t, s.AuthenticateFrom(user, password, ip))
+	assert.Equal(t, ErrBadAuth, s.AuthenticateFrom(user, "bogus", ip))
+	assert.Equal(t, ErrTooManyAttempts, s.AuthenticateFrom(user, password, ip))
+
+	// Other ips, and not giving one, are unaffected
+	require.Nil(t, s.AuthenticateFrom(user, password, ip2))
+	require.Nil(t, s.Authenticate(user, password))
+}
+
+func TestAttemptsConcurrent(t *T) {
+	s := testSystem(t)
+	s.BCryptCost = 4
+	s.MaxAttempts = 3
+	s.MaxIPAttempts = 5
+	user, _, _ := randUser(t, s)
+	user2, _, _ := randUser(t, s)
+	ip := commontest.RandStr()
+
+	// Only MaxAttempts guesses get checked, however many are made at once
+	guess := func(user, ip string, n int) map[error]int {
+		var l sync.Mutex
+		errs := map[error]int{}
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := s.AuthenticateFrom(user, "bogus", ip)
+				l.Lock()
+				errs[err]++
+				l.Unlock()
+			}()
+		}
+		wg.Wait()
+		return errs
+	}
+	errs := guess(user, ip, 20)
+	assert.Equal(t, 3, errs[ErrBadAuth])
+	assert.Equal(t, 17, errs[ErrTooManyAttempts])
+	n, err := s.Attempts(user)
+	require.Nil(t, err)
+	assert.Equal(t, 3, n)
+
+	// The same goes for the ip, which has 2 guesses left
+	errs = guess(user2, ip, 20)
+	assert.Equal(t, 2, errs[ErrBadAuth])
+	assert.Equal(t, 18, errs[ErrTooManyAttempts])
+	n, err = s.Attempts(user2)
+	require.Nil(t, err)
+	assert.Equal(t, 2, n)
+}
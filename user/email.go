@@ -0,0 +1,152 @@
+package user
+
+import (
+	"strings"
+
+	"github.com/mediocregopher/radix.v2/redis"
+	"github.com/mediocregopher/radix.v2/util"
+)
+
+// emailKey returns the key of the string holding the name of the user with the
+// given email. Emails are indexed case-insensitively
+func (s *System) emailKey(email string) string {
+	email = strings.ToLower(email)
+	if p := s.prefix(); p != "" {
+		return "user:" + p + ":email:{" + email + "}"
+	}
+	return "user:email:{" + email + "}"
+}
+
+// delEqual deletes KEYS[1] if its value is ARGV[1]
+var delEqual = `
+	if redis.call('GET', KEYS[1]) == ARGV[1] then
+		return redis.call('DEL', KEYS[1])
+	end
+	return 0
+`
+
+// claimEmail KEYS[1] user prevOwner
+// Points the email key at the user if it's unset, already the user's, or
+// pointing at prevOwner. Returns 1 if it was set, 2 if it was already the
+// user's, or otherwise the name of the user which has it
+var claimEmail = `
+	local owner = redis.call('GET', KEYS[1])
+	if owner == ARGV[1] then
+		return 2
+	end
+	if not owner or owner == ARGV[2] then
+		redis.call('SET', KEYS[1], ARGV[1])
+		return 1
+	end
+	return owner
+`
+
+// indexEmail claims the given email for the given user in the email index,
+// returning ErrEmailTaken if another user has it. If prevOwner is given and has
+// the email it's moved from them. The returned bool is whether the email wasn't
+// already the user's, in which case unindexEmail should be used to undo the
+// claim if the change it's for fails
+func (s *System) indexEmail(user, email, prevOwner string) (bool, error) {
+	if email == "" {
+		return false, nil
+	}
+	key := s.emailKey(email)
+	r := util.LuaEval(s.c, claimEmail, 1, key, user, prevOwner)
+	if r.IsType(redis.Str) {
+		owner, err := r.Str()
+		if err != nil {
+			return false, err
+		}
+
+		// The index is updated separately from the user, so the owner may no
+		// longer exist or have the email if a change failed part way through,
+		// in which case it's free to be taken over
+		m, err := s.getRaw(owner)
+		if err != nil && err != ErrNotFound {
+			return false, err
+		} else if err == nil && strings.EqualFold(m[s.fields["Email"].Key], email) {
+			return false, ErrEmailTaken
+		}
+		if r = util.LuaEval(s.c, claimEmail, 1, key, user, owner); r.IsType(redis.Str) {
+			// someone else claimed it in between
+			return false, ErrEmailTaken
+		}
+	}
+	i, err := r.Int()
+	return i == 1, err
+}
+
+// unindexEmail removes the given email from the email index, if it's pointing
+// at the given user
+func (s *System) unindexEmail(user, email string) error {
+	if email == "" {
+		return nil
+	}
+	return util.LuaEval(s.c, delEqual, 1, s.emailKey(email), user).Err
+}
+
+// GetByEmail returns the name of the user with the given email, compared
+// case-insensitively, or ErrNotFound if there isn't one. Disabled users are
+// returned as well.
+//
+// Create and Set return ErrEmailTaken rather than give a user an email which
+// another already has, so the email identifies a single user. Users created
+// before the email index was added aren't found until their email is Set
+// again, or they're backfilled using IndexEmails
+func (s *System) GetByEmail(email string) (string, error) {
+	if email == "" {
+		return "", ErrNotFound
+	}
+	r := s.c.Cmd("GET", s.emailKey(email))
+	if r.IsType(redis.Nil) {
+		return "", ErrNotFound
+	}
+	user, err := r.Str()
+	if err != nil {
+		return "", err
+	}
+
+	// The index is updated separately from the user, so it may be stale if a
+	// change failed part way through
+	m, err := s.getRaw(user)
+	if err != nil {
+		return "", err
+	} else if !strings.EqualFold(m[s.fields["Email"].Key], email) {
+		return "", ErrNotFound
+	}
+	return user, nil
+}
+
+// IndexEmails adds every existing user to the email index used by GetByEmail,
+// e.g. as a migration (see the migrations package) to backfill the users
+// created before the index was added. If those users have emails in common
+// the index is left pointing at whichever user already has it, and the others
+// aren't found by GetByEmail
+func (s *System) IndexEmails() error {
+	var cursor string
+	for {
+		users, next, err := s.List(cursor, 100)
+		if err != nil {
+			return err
+		}
+		for _, u := range users {
+			m, err := s.getRaw(u)
+			if err == ErrNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+			email := m[s.fields["Email"].Key]
+			if email == "" {
+				continue
+			}
+			if err := s.c.Cmd("SET", s.emailKey(email), m[s.fields["Name"].Key], "NX").Err; err != nil {
+				return err
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		cursor = next
+	}
+}
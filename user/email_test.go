@@ -0,0 +1,121 @@
+package user
+
+import (
+	"strings"
+	. "testing"
+
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetByEmail(t *T) {
+	s := testSystem(t)
+	user, email, _ := randUser(t, s)
+
+	got, err := s.GetByEmail(email)
+	require.Nil(t, err)
+	assert.Equal(t, user, got)
+	got, err = s.GetByEmail(strings.ToUpper(email))
+	require.Nil(t, err)
+	assert.Equal(t, user, got)
+
+	_, err = s.GetByEmail(commontest.RandStr())
+	assert.Equal(t, ErrNotFound, err)
+	_, err = s.GetByEmail("")
+	assert.Equal(t, ErrNotFound, err)
+
+	// Changing the email moves the user in the index
+	email2 := commontest.RandStr()
+	require.Nil(t, s.Set(user, Info{"Email": email2}))
+	_, err = s.GetByEmail(email)
+	assert.Equal(t, ErrNotFound, err)
+	got, err = s.GetByEmail(email2)
+	require.Nil(t, err)
+	assert.Equal(t, user, got)
+
+	// Another user can't take the email, and so doesn't lose it for the first
+	// user by changing away from it
+	user2, email3, _ := randUser(t, s)
+	assert.Equal(t, ErrEmailTaken, s.Set(user2, Info{"Email": email2}))
+	assert.Equal(t, ErrEmailTaken, s.Create(commontest.RandStr(), strings.ToUpper(email2), "password"))
+	require.Nil(t, s.Set(user2, Info{"Email": commontest.RandStr()}))
+	got, err = s.GetByEmail(email2)
+	require.Nil(t, err)
+	assert.Equal(t, user, got)
+	i, err := s.Get(user2, Private)
+	require.Nil(t, err)
+	assert.NotEqual(t, email2, i["Email"])
+
+	// Once the first user changes theirs it can be taken
+	_, err = s.GetByEmail(email3)
+	assert.Equal(t, ErrNotFound, err)
+	require.Nil(t, s.Set(user, Info{"Email": email}))
+	require.Nil(t, s.Set(user2, Info{"Email": email2}))
+	got, err = s.GetByEmail(email2)
+	require.Nil(t, err)
+	assert.Equal(t, user2, got)
+
+	// A failed Create doesn't keep the email claimed
+	email4 := commontest.RandStr()
+	assert.Equal(t, ErrUserExists, s.Create(user, email4, "password"))
+	_, err = s.GetByEmail(email4)
+	assert.Equal(t, ErrNotFound, err)
+	require.Nil(t, s.Set(user2, Info{"Email": email4}))
+
+	// Deleting the user removes them from the index
+	require.Nil(t, s.Delete(user2))
+	_, err = s.GetByEmail(email4)
+	assert.Equal(t, ErrNotFound, err)
+	n, err := s.c.Cmd("EXISTS", s.emailKey(email4)).Int()
+	require.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestEmailStaleClaim(t *T) {
+	s := testSystem(t)
+	user, email, _ := randUser(t, s)
+
+	// Simulate a change which failed part way through, leaving the index
+	// pointing at users which don't have the email
+	require.Nil(t, s.c.Cmd("SET", s.emailKey(email), commontest.RandStr()).Err)
+	require.Nil(t, s.Set(user, Info{"Email": email}))
+	got, err := s.GetByEmail(email)
+	require.Nil(t, err)
+	assert.Equal(t, user, got)
+
+	require.Nil(t, s.Delete(user))
+	user2, _, _ := randUser(t, s)
+	require.Nil(t, s.c.Cmd("SET", s.emailKey(email), user2).Err)
+	_, err = s.GetByEmail(email)
+	assert.Equal(t, ErrNotFound, err)
+	user3 := commontest.RandStr()
+	require.Nil(t, s.Create(user3, email, "password"))
+	got, err = s.GetByEmail(email)
+	require.Nil(t, err)
+	assert.Equal(t, user3, got)
+}
+
+func TestIndexEmails(t *T) {
+	s := testSystem(t)
+	user, email, _ := randUser(t, s)
+
+	// user3 had email2 as well before the index was added, so email2 should
+	// stay pointing at user2 which is already in it
+	user2, email2, _ := randUser(t, s)
+	user3, _, _ := randUser(t, s)
+	require.Nil(t, s.c.Cmd("HSET", s.Key(user3), s.fields["Email"].Key, email2).Err)
+
+	// Simulate user having been created before the index was added
+	require.Nil(t, s.c.Cmd("DEL", s.emailKey(email)).Err)
+	_, err := s.GetByEmail(email)
+	assert.Equal(t, ErrNotFound, err)
+
+	require.Nil(t, s.IndexEmails())
+	got, err := s.GetByEmail(email)
+	require.Nil(t, err)
+	assert.Equal(t, user, got)
+	got, err = s.GetByEmail(email2)
+	require.Nil(t, err)
+	assert.Equal(t, user2, got)
+}
@@ -0,0 +1,160 @@
+package user
+
+import (
+	"strconv"
+	"time"
+)
+
+// FieldType describes what kind of value a Field holds. Every value is stored as
+// a string, but fields with a type other than TypeString are checked to be of
+// their type when Set, and stored in a consistent format which their typed
+// getters (e.g. GetInt) parse
+type FieldType int
+
+// The different FieldTypes. Fields default to TypeString
+const (
+	TypeString FieldType = iota
+
+	// Stored in base 10
+	TypeInt64
+
+	// Stored as "1" for true and empty string for false
+	TypeBool
+
+	// Stored in the format of time.Time's MarshalText, in UTC, with empty
+	// string being the zero time
+	TypeTime
+)
+
+func (t FieldType) String() string {
+	switch t {
+	case TypeString:
+		return "string"
+	case TypeInt64:
+		return "int64"
+	case TypeBool:
+		return "bool"
+	case TypeTime:
+		return "time"
+	default:
+		return "FieldType(" + strconv.Itoa(int(t)) + ")"
+	}
+}
+
+func marshalBool(b bool) string {
+	if b {
+		return "1"
+	}
+	return ""
+}
+
+// normalizeValue checks that the given value is valid for a field of the given
+// type, and returns it in the format fields of that type are stored in. For
+// TypeBool any value accepted by strconv.ParseBool is valid, and for TypeTime
+// any RFC 3339 time
+func normalizeValue(t FieldType, v string) (string, bool) {
+	if v == "" {
+		return "", true
+	}
+	switch t {
+	case TypeInt64:
+		i, err := strconv.ParseInt(v, 10, 64)
+		return strconv.FormatInt(i, 10), err == nil
+	case TypeBool:
+		b, err := strconv.ParseBool(v)
+		return marshalBool(b), err == nil
+	case TypeTime:
+		tt, err := unmarshalTime(v)
+		return marshalTime(tt), err == nil
+	default:
+		return v, true
+	}
+}
+
+// getTyped returns the raw value of the given field of the user, after checking
+// that it's of the given type
+func (s *System) getTyped(user, field string, t FieldType) (string, error) {
+	f, ok := s.fields[field]
+	if !ok {
+		return "", ErrFieldUnknown(field)
+	} else if f.Type != t {
+		return "", ErrFieldType(field, f.Type)
+	}
+	i, err := s.Get(user, Private|Hidden|Editable)
+	if err != nil {
+		return "", err
+	}
+	return i[field], nil
+}
+
+// GetString returns the value of one of the user's TypeString fields, no
+// matter its FieldFlags. Returns ErrNotFound if the user doesn't exist
+func (s *System) GetString(user, field string) (string, error) {
+	return s.getTyped(user, field, TypeString)
+}
+
+// GetInt returns the value of one of the user's TypeInt64 fields, or 0 if it's
+// not set, no matter its FieldFlags. Returns ErrNotFound if the user doesn't
+// exist
+func (s *System) GetInt(user, field string) (int64, error) {
+	v, err := s.getTyped(user, field, TypeInt64)
+	if err != nil || v == "" {
+		return 0, err
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+// GetBool returns the value of one of the user's TypeBool fields, or false if
+// it's not set, no matter its FieldFlags. Returns ErrNotFound if the user
+// doesn't exist
+func (s *System) GetBool(user, field string) (bool, error) {
+	v, err := s.getTyped(user, field, TypeBool)
+	return v != "", err
+}
+
+// GetTime returns the value of one of the user's TypeTime fields, or the zero
+// time if it's not set, no matter its FieldFlags. Returns ErrNotFound if the
+// user doesn't exist
+func (s *System) GetTime(user, field string) (time.Time, error) {
+	v, err := s.getTyped(user, field, TypeTime)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return unmarshalTime(v)
+}
+
+// setTyped Sets the given field of the user to the given value, after checking
+// that it's of the given type
+func (s *System) setTyped(user, field string, t FieldType, v string) error {
+	if f, ok := s.fields[field]; !ok {
+		return ErrFieldUnknown(field)
+	} else if f.Type != t {
+		return ErrFieldType(field, f.Type)
+	}
+	return s.Set(user, Info{field: v})
+}
+
+// SetString is like Set, for a single TypeString field
+func (s *System) SetString(user, field, v string) error {
+	return s.setTyped(user, field, TypeString, v)
+}
+
+// SetInt is like Set, for a single TypeInt64 field
+func (s *System) SetInt(user, field string, v int64) error {
+	return s.setTyped(user, field, TypeInt64, strconv.FormatInt(v, 10))
+}
+
+// SetBool is like Set, for a single TypeBool field
+func (s *System) SetBool(user, field string, v bool) error {
+	return s.setTyped(user, field, TypeBool, marshalBool(v))
+}
+
+// SetTime is like Set, for a single TypeTime field. Setting the zero time
+// unsets the field
+func (s *System) SetTime(user, field string, v time.Time) error {
+	var vs string
+	if !v.IsZero() {
+		vs = marshalTime(v)
+	}
+	return s.setTyped(user, field, TypeTime, vs)
+}
@@ -0,0 +1,78 @@
+package user
+
+import (
+	. "testing"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypedFields(t *T) {
+	s := testSystem(t)
+	s.AddField(Field{Name: "str", Flags: Public | Editable})
+	s.AddField(Field{Name: "int", Flags: Public | Editable, Type: TypeInt64})
+	s.AddField(Field{Name: "bool", Flags: Public | Editable, Type: TypeBool})
+	s.AddField(Field{Name: "time", Flags: Public | Editable, Type: TypeTime})
+	user, _, _ := randUser(t, s)
+
+	// Unset fields are their type's zero value
+	i, err := s.GetInt(user, "int")
+	require.Nil(t, err)
+	assert.Zero(t, i)
+	b, err := s.GetBool(user, "bool")
+	require.Nil(t, err)
+	assert.False(t, b)
+	tt, err := s.GetTime(user, "time")
+	require.Nil(t, err)
+	assert.True(t, tt.IsZero())
+
+	now := time.Now().Round(time.Millisecond)
+	require.Nil(t, s.SetString(user, "str", "foo"))
+	require.Nil(t, s.SetInt(user, "int", -42))
+	require.Nil(t, s.SetBool(user, "bool", true))
+	require.Nil(t, s.SetTime(user, "time", now))
+
+	str, err := s.GetString(user, "str")
+	require.Nil(t, err)
+	assert.Equal(t, "foo", str)
+	i, err = s.GetInt(user, "int")
+	require.Nil(t, err)
+	assert.Equal(t, int64(-42), i)
+	b, err = s.GetBool(user, "bool")
+	require.Nil(t, err)
+	assert.True(t, b)
+	tt, err = s.GetTime(user, "time")
+	require.Nil(t, err)
+	assert.True(t, now.Equal(tt))
+
+	// Values given to Set are checked and stored consistently
+	assert.Equal(t, ErrFieldInvalid("int", TypeInt64), s.Set(user, Info{"int": "foo"}))
+	assert.Equal(t, ErrFieldInvalid("bool", TypeBool), s.Set(user, Info{"bool": "foo"}))
+	assert.Equal(t, ErrFieldInvalid("time", TypeTime), s.Set(user, Info{"time": "foo"}))
+	require.Nil(t, s.Set(user, Info{"int": "+7", "bool": "false"}))
+	u, err := s.Get(user, Public)
+	require.Nil(t, err)
+	assert.Equal(t, "7", u["int"])
+	assert.Equal(t, "", u["bool"])
+
+	// The typed getters and setters check the field's type
+	_, err = s.GetInt(user, "bool")
+	assert.Equal(t, ErrFieldType("bool", TypeBool), err)
+	assert.Equal(t, ErrFieldType("str", TypeString), s.SetTime(user, "str", now))
+	_, err = s.GetString(user, "nope")
+	assert.Equal(t, ErrFieldUnknown("nope"), err)
+	assert.Equal(t, ErrFieldUneditable("TSCreated"), s.SetTime(user, "TSCreated", now))
+
+	// Builtin fields are typed too
+	tt, err = s.GetTime(user, "TSCreated")
+	require.Nil(t, err)
+	assert.False(t, tt.IsZero())
+	b, err = s.GetBool(user, "Disabled")
+	require.Nil(t, err)
+	assert.False(t, b)
+
+	_, err = s.GetInt(commontest.RandStr(), "int")
+	assert.Equal(t, ErrNotFound, err)
+}
@@ -0,0 +1,140 @@
+package user
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/radix.v2/cluster"
+)
+
+// listPattern returns the SCAN pattern which matches the keys of all users'
+// hashes, along with some keys which aren't (e.g. those of data stored using
+// Key(user, ...)), which List filters out
+func (s *System) listPattern() string {
+	if p := s.prefix(); p != "" {
+		return escapeMatch("user:"+p+":{") + "*}"
+	}
+	return "user:{*}"
+}
+
+// listKeys returns the names of the users whose hashes are amongst the given
+// keys
+func (s *System) listKeys(keys []string) []string {
+	base := strings.TrimSuffix(s.Key(""), "}")
+	users := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if !strings.HasPrefix(k, base) || !strings.HasSuffix(k, "}") {
+			continue
+		}
+		user := k[len(base) : len(k)-1]
+		if s.Key(user) == k {
+			users = append(users, user)
+		}
+	}
+	return users
+}
+
+// scanPage makes a single SCAN call on the given Cmder, returning the keys found
+// and the next SCAN cursor
+func scanPage(c common.Cmder, cursor, pattern string, count int) ([]string, string, error) {
+	l, err := c.Cmd("SCAN", cursor, "MATCH", pattern, "COUNT", count).Array()
+	if err != nil {
+		return nil, "", err
+	} else if len(l) != 2 {
+		return nil, "", errors.New("unexpected SCAN reply")
+	}
+	next, err := l[0].Str()
+	if err != nil {
+		return nil, "", err
+	}
+	keys, err := l[1].List()
+	return keys, next, err
+}
+
+// List returns a page of the names of existing users, including disabled ones,
+// in no particular order. If NormalizeUsername is set the names are as
+// normalized by it, rather than as given to Create. count is a hint for how many keys redis should look
+// at for the page (defaulting to 10), so a page may have more or fewer users
+// than it, and may be empty even though there are more to come.
+//
+// The cursor should be empty to get the first page. Each call returns the
+// cursor to give to get the next page, or empty string if there are no more.
+// This is built on SCAN, so a user which exists for the whole listing is
+// returned at least once, but may be returned more than once. When using
+// cluster every node is listed in turn, and the listing may miss users or
+// return ErrInvalidCursor if nodes are added or removed during it
+func (s *System) List(cursor string, count int) ([]string, string, error) {
+	if count <= 0 {
+		count = 10
+	}
+	if cl := common.ClusterOf(s.c); cl != nil {
+		return s.listCluster(cl, cursor, count)
+	}
+
+	if cursor == "" {
+		cursor = "0"
+	} else if _, err := strconv.ParseUint(cursor, 10, 64); err != nil || cursor == "0" {
+		return nil, "", ErrInvalidCursor
+	}
+	keys, next, err := scanPage(s.c, cursor, s.listPattern(), count)
+	if err != nil {
+		return nil, "", err
+	} else if next == "0" {
+		next = ""
+	}
+	return s.listKeys(keys), next, nil
+}
+
+// listCluster implements List for cluster, where each node has to be SCANned
+// separately. Its cursors are of the form "<node>:<cursor>", where node is the
+// index of the node being SCANned in the sorted list of node addresses
+func (s *System) listCluster(cl *cluster.Cluster, cursor string, count int) ([]string, string, error) {
+	node, scanCursor := 0, "0"
+	if cursor != "" {
+		i := strings.IndexByte(cursor, ':')
+		if i < 0 {
+			return nil, "", ErrInvalidCursor
+		}
+		var err error
+		if node, err = strconv.Atoi(cursor[:i]); err != nil || node < 0 {
+			return nil, "", ErrInvalidCursor
+		}
+		scanCursor = cursor[i+1:]
+		if _, err := strconv.ParseUint(scanCursor, 10, 64); err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+	}
+
+	conns, err := cl.GetEvery()
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		for _, conn := range conns {
+			cl.Put(conn)
+		}
+	}()
+	addrs := make([]string, 0, len(conns))
+	for addr := range conns {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	if node >= len(addrs) {
+		return nil, "", ErrInvalidCursor
+	}
+
+	keys, next, err := scanPage(conns[addrs[node]], scanCursor, s.listPattern(), count)
+	if err != nil {
+		return nil, "", err
+	}
+	if next == "0" {
+		node, next = node+1, "0"
+		if node == len(addrs) {
+			return s.listKeys(keys), "", nil
+		}
+	}
+	return s.listKeys(keys), strconv.Itoa(node) + ":" + next, nil
+}
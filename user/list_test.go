@@ -0,0 +1,44 @@
+package user
+
+import (
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestList(t *T) {
+	s := testSystem(t)
+	expected := map[string]bool{}
+	for i := 0; i < 25; i++ {
+		user, _, _ := randUser(t, s)
+		expected[user] = true
+		// Keys stored alongside a user aren't listed as users themselves
+		require.Nil(t, s.c.Cmd("SET", s.Key(user, "foo"), "1").Err)
+	}
+	disabled, _, _ := randUser(t, s)
+	require.Nil(t, s.Disable(disabled))
+	expected[disabled] = true
+
+	// Users of other Systems aren't listed
+	s2 := testSystem(t)
+	randUser(t, s2)
+
+	got := map[string]bool{}
+	var cursor string
+	for {
+		users, next, err := s.List(cursor, 5)
+		require.Nil(t, err)
+		for _, u := range users {
+			got[u] = true
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	assert.Equal(t, expected, got)
+
+	_, _, err := s.List("foo", 5)
+	assert.Equal(t, ErrInvalidCursor, err)
+}
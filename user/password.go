@@ -0,0 +1,356 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mediocregopher/radix.v2/util"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrUnknownHasher is returned from Authenticate when a user's password hash was
+// made by a PasswordHasher which the System doesn't know about
+var ErrUnknownHasher = errors.New("password hash made by unknown hasher")
+
+// PasswordHasher hashes passwords, and checks passwords against the hashes it
+// made. Hashes are stored along with the Name of the PasswordHasher which made
+// them, and must contain whatever parameters are needed to check them (e.g.
+// salt and cost), so that they can still be checked after the PasswordHasher's
+// parameters are changed
+type PasswordHasher interface {
+
+	// Name uniquely identifies the hashing algorithm, e.g. "bcrypt". It must
+	// not contain a "$"
+	Name() string
+
+	// Hash returns a new hash of the password
+	Hash(password []byte) (string, error)
+
+	// Verify returns whether the password matches the hash, which was returned
+	// from Hash of a PasswordHasher with the same Name (but maybe different
+	// parameters)
+	Verify(hash string, password []byte) (bool, error)
+
+	// NeedsRehash returns whether the hash, which Verify has just succeeded
+	// on, was made with different parameters than the PasswordHasher's, and
+	// so should be replaced by a new one from Hash
+	NeedsRehash(hash string) bool
+}
+
+// BCryptHasher is a PasswordHasher using bcrypt. This is the default
+type BCryptHasher struct {
+	// Defaults to bcrypt.DefaultCost if not set
+	Cost int
+}
+
+func (h BCryptHasher) cost() int {
+	if h.Cost == 0 {
+		return bcrypt.DefaultCost
+	}
+	return h.Cost
+}
+
+// Name implements the PasswordHasher interface
+func (h BCryptHasher) Name() string { return "bcrypt" }
+
+// Hash implements the PasswordHasher interface
+func (h BCryptHasher) Hash(password []byte) (string, error) {
+	b, err := bcrypt.GenerateFromPassword(password, h.cost())
+	return string(b), err
+}
+
+// Verify implements the PasswordHasher interface
+func (h BCryptHasher) Verify(hash string, password []byte) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), password)
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// NeedsRehash implements the PasswordHasher interface
+func (h BCryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.cost()
+}
+
+// Argon2idHasher is a PasswordHasher using argon2id. Its hashes are of the form
+// "m=<memory>,t=<time>,p=<threads>$<salt>$<key>"
+type Argon2idHasher struct {
+	// Defaults to 1
+	Time uint32
+
+	// In KiB. Defaults to 64*1024 (64MiB)
+	Memory uint32
+
+	// Defaults to 4
+	Threads uint8
+}
+
+func (h Argon2idHasher) params() (uint32, uint32, uint8) {
+	t, m, p := h.Time, h.Memory, h.Threads
+	if t == 0 {
+		t = 1
+	}
+	if m == 0 {
+		m = 64 * 1024
+	}
+	if p == 0 {
+		p = 4
+	}
+	return t, m, p
+}
+
+// Name implements the PasswordHasher interface
+func (h Argon2idHasher) Name() string { return "argon2id" }
+
+// Hash implements the PasswordHasher interface
+func (h Argon2idHasher) Hash(password []byte) (string, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return "", err
+	}
+	t, m, p := h.params()
+	key := argon2.IDKey(password, salt, t, m, p, 32)
+	return fmt.Sprintf("m=%d,t=%d,p=%d$%s$%s", m, t, p, b64(salt), b64(key)), nil
+}
+
+// parse returns the parameters, salt, and key of one of its hashes
+func (h Argon2idHasher) parse(hash string) (Argon2idHasher, []byte, []byte, error) {
+	var hh Argon2idHasher
+	parts := strings.Split(hash, "$")
+	if len(parts) != 3 {
+		return hh, nil, nil, errors.New("malformed argon2id hash")
+	}
+	_, err := fmt.Sscanf(parts[0], "m=%d,t=%d,p=%d", &hh.Memory, &hh.Time, &hh.Threads)
+	if err != nil {
+		return hh, nil, nil, err
+	}
+	salt, key, err := unb64(parts[1], parts[2])
+	return hh, salt, key, err
+}
+
+// Verify implements the PasswordHasher interface
+func (h Argon2idHasher) Verify(hash string, password []byte) (bool, error) {
+	hh, salt, key, err := h.parse(hash)
+	if err != nil {
+		return false, err
+	}
+	got := argon2.IDKey(password, salt, hh.Time, hh.Memory, hh.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(got, key) == 1, nil
+}
+
+// NeedsRehash implements the PasswordHasher interface
+func (h Argon2idHasher) NeedsRehash(hash string) bool {
+	hh, _, _, err := h.parse(hash)
+	if err != nil {
+		return true
+	}
+	t, m, p := h.params()
+	return hh.Time != t || hh.Memory != m || hh.Threads != p
+}
+
+// ScryptHasher is a PasswordHasher using scrypt. Its hashes are of the form
+// "n=<n>,r=<r>,p=<p>$<salt>$<key>"
+type ScryptHasher struct {
+	// Defaults to 32768
+	N int
+
+	// Defaults to 8
+	R int
+
+	// Defaults to 1
+	P int
+}
+
+func (h ScryptHasher) params() (int, int, int) {
+	n, r, p := h.N, h.R, h.P
+	if n == 0 {
+		n = 32768
+	}
+	if r == 0 {
+		r = 8
+	}
+	if p == 0 {
+		p = 1
+	}
+	return n, r, p
+}
+
+// Name implements the PasswordHasher interface
+func (h ScryptHasher) Name() string { return "scrypt" }
+
+// Hash implements the PasswordHasher interface
+func (h ScryptHasher) Hash(password []byte) (string, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return "", err
+	}
+	n, r, p := h.params()
+	key, err := scrypt.Key(password, salt, n, r, p, 32)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("n=%d,r=%d,p=%d$%s$%s", n, r, p, b64(salt), b64(key)), nil
+}
+
+// parse returns the parameters, salt, and key of one of its hashes
+func (h ScryptHasher) parse(hash string) (ScryptHasher, []byte, []byte, error) {
+	var hh ScryptHasher
+	parts := strings.Split(hash, "$")
+	if len(parts) != 3 {
+		return hh, nil, nil, errors.New("malformed scrypt hash")
+	}
+	_, err := fmt.Sscanf(parts[0], "n=%d,r=%d,p=%d", &hh.N, &hh.R, &hh.P)
+	if err != nil {
+		return hh, nil, nil, err
+	}
+	salt, key, err := unb64(parts[1], parts[2])
+	return hh, salt, key, err
+}
+
+// Verify implements the PasswordHasher interface
+func (h ScryptHasher) Verify(hash string, password []byte) (bool, error) {
+	hh, salt, key, err := h.parse(hash)
+	if err != nil {
+		return false, err
+	}
+	got, err := scrypt.Key(password, salt, hh.N, hh.R, hh.P, len(key))
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(got, key) == 1, nil
+}
+
+// NeedsRehash implements the PasswordHasher interface
+func (h ScryptHasher) NeedsRehash(hash string) bool {
+	hh, _, _, err := h.parse(hash)
+	if err != nil {
+		return true
+	}
+	n, r, p := h.params()
+	return hh.N != n || hh.R != r || hh.P != p
+}
+
+func newSalt() ([]byte, error) {
+	salt := make([]byte, 16)
+	_, err := rand.Read(salt)
+	return salt, err
+}
+
+func b64(b []byte) string {
+	return base64.RawStdEncoding.EncodeToString(b)
+}
+
+func unb64(salt, key string) ([]byte, []byte, error) {
+	saltB, err := base64.RawStdEncoding.DecodeString(salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyB, err := base64.RawStdEncoding.DecodeString(key)
+	return saltB, keyB, err
+}
+
+// HSETIFEQ key field expected value [field value ...]
+// Sets the field to the value, along with any other given fields, but only if
+// it's currently the expected value. Returns 1 if it was set, 0 otherwise
+var hsetifeq = `
+	if redis.call('HGET', KEYS[1], ARGV[1]) ~= ARGV[2] then
+		return 0
+	end
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[3])
+	for i=4,#ARGV,2 do
+		redis.call('HSET', KEYS[1], ARGV[i], ARGV[i+1])
+	end
+	return 1
+`
+
+// builtinHashers are the PasswordHashers whose hashes can always be checked, no
+// matter what PasswordHasher is set to
+var builtinHashers = []PasswordHasher{BCryptHasher{}, Argon2idHasher{}, ScryptHasher{}}
+
+// passwordHasher returns the PasswordHasher new hashes are made with
+func (s *System) passwordHasher() PasswordHasher {
+	if s.PasswordHasher != nil {
+		return s.PasswordHasher
+	}
+	return BCryptHasher{Cost: s.BCryptCost}
+}
+
+// hashPassword returns the value to store in the PasswordHash field for the
+// given password
+func (s *System) hashPassword(password string) (string, error) {
+	h := s.passwordHasher()
+	hash, err := h.Hash([]byte(password))
+	if err != nil {
+		return "", err
+	}
+	return h.Name() + "$" + hash, nil
+}
+
+// rehashPassword replaces the user's stored password hash, which the password
+// was just checked against, with a new one from hashPassword. Nothing is done
+// if the stored hash has changed since it was read (e.g. by ChangePassword),
+// so that an old password is never put back. Like setQuiet this doesn't change
+// TSModified
+func (s *System) rehashPassword(user, stored, password string) error {
+	hash, err := s.hashPassword(password)
+	if err != nil {
+		return err
+	}
+	i, err := util.LuaEval(s.c, hsetifeq, 1,
+		s.Key(user), s.fields["PasswordHash"].Key, stored, hash,
+	).Int()
+	if err != nil {
+		return err
+	} else if i == 1 {
+		s.uncache(user)
+	}
+	return nil
+}
+
+// checkPassword returns whether the password matches the value stored in the
+// PasswordHash field, and whether that value should be replaced with a new one
+// from hashPassword
+func (s *System) checkPassword(stored, password string) (bool, bool, error) {
+	// Hashes stored before PasswordHasher existed are hex encoded bcrypt
+	// hashes without a name
+	i := strings.IndexByte(stored, '$')
+	if i < 0 {
+		b, err := hex.DecodeString(stored)
+		if err != nil {
+			return false, false, err
+		}
+		ok, err := BCryptHasher{}.Verify(string(b), []byte(password))
+		return ok, true, err
+	}
+
+	name, hash := stored[:i], stored[i+1:]
+	current := s.passwordHasher()
+	h := current
+	if name != current.Name() {
+		h = nil
+		for _, bh := range builtinHashers {
+			if bh.Name() == name {
+				h = bh
+				break
+			}
+		}
+		if h == nil {
+			return false, false, ErrUnknownHasher
+		}
+	}
+
+	ok, err := h.Verify(hash, []byte(password))
+	if err != nil || !ok {
+		return false, false, err
+	}
+	return true, name != current.Name() || current.NeedsRehash(hash), nil
+}
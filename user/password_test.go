@@ -0,0 +1,99 @@
+package user
+
+import (
+	"encoding/hex"
+	"strings"
+	. "testing"
+
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Hashers with cheap parameters, so tests run quickly
+var (
+	testArgon2id = Argon2idHasher{Time: 1, Memory: 1024, Threads: 1}
+	testScrypt   = ScryptHasher{N: 1024, R: 8, P: 1}
+)
+
+func TestPasswordHashers(t *T) {
+	hashers := []PasswordHasher{BCryptHasher{Cost: 4}, testArgon2id, testScrypt}
+	others := []PasswordHasher{
+		BCryptHasher{Cost: 5},
+		Argon2idHasher{Time: 2, Memory: 1024, Threads: 1},
+		ScryptHasher{N: 2048, R: 8, P: 1},
+	}
+	for i, h := range hashers {
+		password := []byte(commontest.RandStr())
+		hash, err := h.Hash(password)
+		require.Nil(t, err, h.Name())
+
+		ok, err := h.Verify(hash, password)
+		require.Nil(t, err, h.Name())
+		assert.True(t, ok, h.Name())
+		ok, err = h.Verify(hash, []byte("bogus"))
+		require.Nil(t, err, h.Name())
+		assert.False(t, ok, h.Name())
+
+		// Hashes can be verified by the same algorithm with other parameters,
+		// which say they need rehashing
+		ok, err = others[i].Verify(hash, password)
+		require.Nil(t, err, h.Name())
+		assert.True(t, ok, h.Name())
+		assert.False(t, h.NeedsRehash(hash), h.Name())
+		assert.True(t, others[i].NeedsRehash(hash), h.Name())
+	}
+}
+
+func TestPasswordRehash(t *T) {
+	s := testSystem(t)
+	s.BCryptCost = 4
+	user, _, password := randUser(t, s)
+	storedHash := func() string {
+		i, err := s.Get(user, Hidden)
+		require.Nil(t, err)
+		return i["PasswordHash"]
+	}
+	assert.True(t, strings.HasPrefix(storedHash(), "bcrypt$"))
+
+	// Hashes from before PasswordHasher existed still work, and are replaced
+	legacy, err := bcrypt.GenerateFromPassword([]byte(password), 4)
+	require.Nil(t, err)
+	require.Nil(t, s.set(user, "PasswordHash", hex.EncodeToString(legacy)))
+	assert.Equal(t, ErrBadAuth, s.Authenticate(user, "bogus"))
+	require.Nil(t, s.Authenticate(user, password))
+	assert.True(t, strings.HasPrefix(storedHash(), "bcrypt$"))
+
+	// Nothing is rehashed while SkipRehash is set
+	s.PasswordHasher = testArgon2id
+	s.SkipRehash = true
+	before := storedHash()
+	require.Nil(t, s.Authenticate(user, password))
+	assert.Equal(t, before, storedHash())
+
+	// Changing the PasswordHasher, or its parameters, rehashes the password
+	// the next time the user authenticates
+	s.SkipRehash = false
+	require.Nil(t, s.Authenticate(user, password))
+	assert.True(t, strings.HasPrefix(storedHash(), "argon2id$"))
+
+	s.PasswordHasher = testScrypt
+	require.Nil(t, s.Authenticate(user, password))
+	assert.True(t, strings.HasPrefix(storedHash(), "scrypt$n=1024,"))
+
+	s.PasswordHasher = ScryptHasher{N: 2048, R: 8, P: 1}
+	require.Nil(t, s.Authenticate(user, password))
+	assert.True(t, strings.HasPrefix(storedHash(), "scrypt$n=2048,"))
+	before = storedHash()
+	require.Nil(t, s.Authenticate(user, password))
+	assert.Equal(t, before, storedHash())
+	assert.Equal(t, ErrBadAuth, s.Authenticate(user, "bogus"))
+
+	// A rehash racing a password change doesn't put back the old password
+	newPassword := commontest.RandStr()
+	require.Nil(t, s.ChangePassword(user, newPassword))
+	require.Nil(t, s.rehashPassword(user, before, password))
+	assert.Equal(t, ErrBadAuth, s.Authenticate(user, password))
+	require.Nil(t, s.Authenticate(user, newPassword))
+}
@@ -0,0 +1,71 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/radix.v2/redis"
+)
+
+// Types of the Events published to EventsChannel
+const (
+	EventCreated  = "user.created"
+	EventModified = "user.modified"
+	EventDisabled = "user.disabled"
+	EventDeleted  = "user.deleted"
+)
+
+// Event describes a change made to a user, and is published as json to
+// EventsChannel. It's what's passed to the function given to Subscribe
+type Event struct {
+	// Type is what happened to the user, e.g. EventCreated
+	Type string
+
+	// User is the user's name. For an EventModified published by Rename it's
+	// the new name
+	User string
+
+	// For EventModified, the names of the fields which were changed
+	Fields []string `json:",omitempty"`
+
+	// For EventModified published by Rename, the user's old name
+	OldUser string `json:",omitempty"`
+
+	// When the change was made
+	Time time.Time
+}
+
+// publish publishes an Event of the given type for the user to EventsChannel,
+// if it's set, see common.Publish
+func (s *System) publish(typ, user string, fields ...string) {
+	s.publishEvent(Event{Type: typ, User: user, Fields: fields})
+}
+
+func (s *System) publishEvent(e Event) {
+	if s.EventsChannel == "" {
+		return
+	}
+	e.Time = time.Now().UTC()
+	b, _ := json.Marshal(e)
+	common.Publish(s.c, s.EventsChannel, b, e.Type+" event for user "+e.User)
+}
+
+// Subscribe calls fn with every Event published to EventsChannel, whether by
+// this System or another one (e.g. in another process), see common.Subscribe
+func (s *System) Subscribe(conn *redis.Client, fn func(Event)) error {
+	if s.EventsChannel == "" {
+		return errors.New("EventsChannel isn't set")
+	}
+	return common.Subscribe(conn, s.EventsChannel, func(msg string) {
+		var e Event
+		if err := json.Unmarshal([]byte(msg), &e); err != nil {
+			if common.Log != nil {
+				common.Log.Printf("bad user event message %q: %s", msg, err)
+			}
+			return
+		}
+		fn(e)
+	})
+}
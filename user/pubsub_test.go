@@ -0,0 +1,66 @@
+package user
+
+import (
+	. "testing"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/mediocregopher/radix.v2/pool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscribe(t *T) {
+	if commontest.InProcess {
+		t.Skip("the in-process redis doesn't support pub/sub")
+	}
+	s := testSystem(t)
+	s.EventsChannel = "user-events:" + s.Prefix
+	p, ok := s.c.(*pool.Pool)
+	if !ok {
+		t.Skip("test redis isn't a single instance")
+	}
+	conn, err := p.Get()
+	require.Nil(t, err)
+
+	ch := make(chan Event, 10)
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.Subscribe(conn, func(e Event) { ch <- e }) }()
+	// Give the subscription time to be made
+	time.Sleep(100 * time.Millisecond)
+
+	assertEvent := func(expected Event) {
+		select {
+		case e := <-ch:
+			assert.WithinDuration(t, time.Now(), e.Time, time.Minute)
+			e.Time = time.Time{}
+			assert.Equal(t, expected, e)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s event never received", expected.Type)
+		}
+	}
+
+	user, _, _ := randUser(t, s)
+	assertEvent(Event{Type: EventCreated, User: user})
+
+	require.Nil(t, s.Set(user, Info{"Email": commontest.RandEmail()}))
+	assertEvent(Event{Type: EventModified, User: user, Fields: []string{"Email", "Verified"}})
+
+	require.Nil(t, s.ChangePassword(user, commontest.RandStr()))
+	assertEvent(Event{Type: EventModified, User: user, Fields: []string{"PasswordHash"}})
+
+	require.Nil(t, s.Disable(user))
+	assertEvent(Event{Type: EventDisabled, User: user})
+	require.Nil(t, s.Enable(user))
+	assertEvent(Event{Type: EventModified, User: user, Fields: []string{"Disabled"}})
+
+	newUser := commontest.RandStr()
+	require.Nil(t, s.Rename(user, newUser))
+	assertEvent(Event{Type: EventModified, User: newUser, Fields: []string{"Name"}, OldUser: user})
+
+	require.Nil(t, s.Delete(newUser))
+	assertEvent(Event{Type: EventDeleted, User: newUser})
+
+	conn.Close()
+	assert.NotNil(t, <-errCh)
+}
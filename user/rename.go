@@ -0,0 +1,216 @@
+package user
+
+import (
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/radix.v2/redis"
+	"github.com/mediocregopher/radix.v2/util"
+)
+
+// RENAMEUSER oldKey newKey [oldKey newKey ...] nameField name modifiedField now
+// Renames each old key to its new one, but only if the first old key (the
+// user's hash) exists and the first new key doesn't. Keys after the first
+// which don't exist anymore are skipped. Then sets the name and modified fields
+// on the new hash. Returns 1 if successful, 0 if the old hash doesn't exist, or
+// -1 if the new one does
+var renameUser = `
+	if redis.call('EXISTS', KEYS[1]) == 0 then
+		return 0
+	end
+	if redis.call('EXISTS', KEYS[2]) == 1 then
+		return -1
+	end
+	for i=1,#KEYS,2 do
+		local ttl = redis.call('PTTL', KEYS[i])
+		if ttl ~= -2 then
+			redis.call('RENAME', KEYS[i], KEYS[i+1])
+			-- Some redis implementations (e.g. miniredis, used in tests) give
+			-- the renamed key an expiry even when the old one had none
+			if ttl == -1 then
+				redis.call('PERSIST', KEYS[i+1])
+			end
+		end
+	end
+	redis.call('HSET', KEYS[2], ARGV[1], ARGV[2])
+	redis.call('HSET', KEYS[2], ARGV[3], ARGV[4])
+	return 1
+`
+
+// extraKeys returns all keys of the form Key(user, ...), not including the
+// user's hash itself
+func (s *System) extraKeys(user string) ([]string, error) {
+	ch := make(chan string)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- common.Scan(s.c, ch, "SCAN", "", escapeMatch(s.Key(user))+":*")
+	}()
+	var keys []string
+	for k := range ch {
+		keys = append(keys, k)
+	}
+	return keys, <-errCh
+}
+
+// Rename changes the name of the given user, along with all data stored under
+// Key(oldUser, ...), to the new name. The Name field is set to newUser, and the
+// user's email and search indexes are updated. Returns ErrNotFound if the user
+// doesn't exist, ErrUserExists if a user with the new name does, or
+// ErrInvalidUsername if the new name is banned (as in Create).
+//
+// Data of the user's which is keyed by their name outside of this System isn't
+// changed. Tokens made for the old name, including sessions' and those from
+// NewVerifyToken, stop working.
+//
+// When not using cluster the user is renamed atomically. With cluster the old
+// and new keys are in different slots, so the user's data is copied to the new
+// keys and then removed from the old ones. If that fails part way through both
+// users may exist, in which case the new one can be Deleted and Rename called
+// again
+func (s *System) Rename(oldUser, newUser string) error {
+	if s.normalize(oldUser) == s.normalize(newUser) {
+		// Only the displayed name is changing
+		return s.setName(oldUser, newUser)
+	}
+	if err := s.checkBanned(newUser); err != nil {
+		return err
+	}
+
+	m, err := s.getRaw(oldUser)
+	if err != nil {
+		return err
+	}
+	extra, err := s.extraKeys(oldUser)
+	if err != nil {
+		return err
+	}
+
+	oldKey, newKey := s.Key(oldUser), s.Key(newUser)
+	keys := make([]interface{}, 0, len(extra)*2+2)
+	keys = append(keys, oldKey, newKey)
+	for _, k := range extra {
+		keys = append(keys, k, newKey+k[len(oldKey):])
+	}
+
+	if common.ClusterOf(s.c) == nil {
+		err = s.renameAtomic(keys, newUser)
+	} else {
+		err = s.renameCopy(keys, m, newUser)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.uncache(oldUser)
+	s.uncache(newUser)
+	s.publishEvent(Event{
+		Type: EventModified, User: newUser, Fields: []string{"Name"}, OldUser: oldUser,
+	})
+	// If the email isn't the old user's in the index some other user had it
+	// before the index was added, in which case it's left with them
+	if _, err := s.indexEmail(newUser, m[s.fields["Email"].Key], oldUser); err != nil && err != ErrEmailTaken {
+		return err
+	}
+	if err := s.unmirror(oldUser); err != nil {
+		return err
+	}
+	if len(s.SearchFields) == 0 || m[s.fields["Disabled"].Key] != "" {
+		return nil
+	}
+	i, err := s.Get(newUser, Private)
+	if err != nil {
+		return err
+	}
+	return s.mirror(newUser, i)
+}
+
+// setName sets the user's Name field, without checking that it normalizes to
+// the same username
+func (s *System) setName(user, name string) error {
+	i, err := util.LuaEval(s.c, hsetdelxx, 1,
+		s.Key(user), s.fields["Name"].Key, s.fields["Name"].Key, name,
+	).Int()
+	if err != nil {
+		return err
+	} else if i == 0 {
+		return ErrNotFound
+	}
+	s.uncache(user)
+	s.publish(EventModified, user, "Name")
+	return nil
+}
+
+// renameAtomic renames the given pairs of keys, the first being the user's
+// hash, using the renameUser script
+func (s *System) renameAtomic(keys []interface{}, newUser string) error {
+	args := make([]interface{}, 0, len(keys)+4)
+	args = append(args, keys...)
+	args = append(args,
+		s.fields["Name"].Key, newUser,
+		s.fields["TSModified"].Key, marshalTime(time.Now()),
+	)
+	i, err := util.LuaEval(s.c, renameUser, len(keys), args...).Int()
+	if err != nil {
+		return err
+	} else if i == 0 {
+		return ErrNotFound
+	} else if i == -1 {
+		return ErrUserExists
+	}
+	return nil
+}
+
+// renameCopy does the same as renameAtomic, but one key at a time so that the
+// keys may be in different slots. The user's hash is copied (from its contents
+// m) first, so that the new name is claimed before anything else is done, and
+// deleted last, so that the old user is only gone once everything's copied
+func (s *System) renameCopy(keys []interface{}, m map[string]string, newUser string) error {
+	m[s.fields["Name"].Key] = newUser
+	m[s.fields["TSModified"].Key] = marshalTime(time.Now())
+	args := make([]interface{}, 0, len(m)*2+1)
+	args = append(args, keys[1])
+	for k, v := range m {
+		args = append(args, k, v)
+	}
+	i, err := util.LuaEval(s.c, hmsetnx, 1, args...).Int()
+	if err != nil {
+		return err
+	} else if i == 0 {
+		return ErrUserExists
+	}
+
+	for i := 2; i < len(keys); i += 2 {
+		if err := s.copyKey(keys[i].(string), keys[i+1].(string)); err != nil {
+			return err
+		}
+	}
+
+	for i := len(keys) - 2; i >= 0; i -= 2 {
+		if err := s.c.Cmd("DEL", keys[i]).Err; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyKey copies the value and expiry of one key to another, replacing it. Does
+// nothing if the key doesn't exist anymore
+func (s *System) copyKey(from, to string) error {
+	r := s.c.Cmd("DUMP", from)
+	if r.IsType(redis.Nil) {
+		return nil
+	}
+	b, err := r.Bytes()
+	if err != nil {
+		return err
+	}
+	ttl, err := s.c.Cmd("PTTL", from).Int64()
+	if err != nil {
+		return err
+	} else if ttl == -2 {
+		return nil
+	} else if ttl < 0 {
+		ttl = 0
+	}
+	return s.c.Cmd("RESTORE", to, ttl, b, "REPLACE").Err
+}
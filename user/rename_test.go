@@ -0,0 +1,52 @@
+package user
+
+import (
+	. "testing"
+
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRename(t *T) {
+	s := testSystem(t)
+	user, email, password := randUser(t, s)
+	require.Nil(t, s.AddRole(user, "admin"))
+	require.Nil(t, s.c.Cmd("SET", s.Key(user, "foo"), "bar", "EX", 100).Err)
+
+	newUser := commontest.RandStr()
+	require.Nil(t, s.Rename(user, newUser))
+
+	_, err := s.Get(user, Public)
+	assert.Equal(t, ErrNotFound, err)
+	i, err := s.Get(newUser, Private)
+	require.Nil(t, err)
+	assert.Equal(t, newUser, i["Name"])
+	assert.Equal(t, email, i["Email"])
+	assert.Nil(t, s.Authenticate(newUser, password))
+
+	// Data stored under the user's Key moves with them
+	has, err := s.HasRole(newUser, "admin")
+	require.Nil(t, err)
+	assert.True(t, has)
+	v, err := s.c.Cmd("GET", s.Key(newUser, "foo")).Str()
+	require.Nil(t, err)
+	assert.Equal(t, "bar", v)
+	ttl, err := s.c.Cmd("TTL", s.Key(newUser, "foo")).Int()
+	require.Nil(t, err)
+	assert.True(t, ttl > 0)
+	n, err := s.c.Cmd("EXISTS", s.Key(user, "foo")).Int()
+	require.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	got, err := s.GetByEmail(email)
+	require.Nil(t, err)
+	assert.Equal(t, newUser, got)
+
+	// The old name can be used again
+	require.Nil(t, s.Create(user, commontest.RandStr(), commontest.RandStr()))
+
+	assert.Equal(t, ErrUserExists, s.Rename(newUser, user))
+	assert.Equal(t, ErrNotFound, s.Rename(commontest.RandStr(), commontest.RandStr()))
+	assert.Equal(t, ErrInvalidUsername, s.Rename(newUser, "root"))
+}
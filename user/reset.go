@@ -0,0 +1,110 @@
+package user
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/auth/sig"
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/radix.v2/util"
+)
+
+// ErrInvalidResetToken is returned from ResetPassword when the token wasn't
+// returned from NewResetToken for the user, has expired, or has already been
+// used
+var ErrInvalidResetToken = common.ExpectedErr{Code: 400, ID: "invalid_reset_token", Err: "invalid or expired password reset token"}
+
+// resetTag is the first part of every reset token's data, so that they can't be
+// mistaken for any other kind of token signed with the same Secret
+const resetTag = "reset"
+
+// passwordHashSum returns what reset tokens store in place of the user's
+// PasswordHash, so that the hash itself isn't sent out in them
+func passwordHashSum(stored string) string {
+	sum := sha256.Sum256([]byte(stored))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewResetToken returns a token which can be given to ResetPassword to set the
+// given user's password without knowing their current one, e.g. by sending it
+// to the user's email in a link using notify.PasswordReset. The token is signed
+// using Secret, and expires after ResetTimeout. It's only valid while the user
+// has the password they had when it was generated, so it can only be used once,
+// and changing the password invalidates any tokens already sent. Returns
+// ErrNotFound or ErrDisabled if the user doesn't exist or is disabled
+func (s *System) NewResetToken(user string) (string, error) {
+	if s.Secret == nil {
+		return "", ErrSecretNotSet
+	}
+	m, err := s.getRaw(user)
+	if err != nil {
+		return "", err
+	}
+	i := s.infoFromRaw(m, Hidden|Private)
+	if i["Disabled"] != "" {
+		return "", ErrDisabled
+	}
+
+	data := bytes.Join([][]byte{
+		[]byte(resetTag),
+		[]byte(verifyB64.EncodeToString([]byte(s.Tenant))),
+		[]byte(verifyB64.EncodeToString([]byte(s.normalize(user)))),
+		[]byte(passwordHashSum(i["PasswordHash"])),
+	}, []byte(":"))
+	return sig.New(data, s.Secret, s.ResetTimeout), nil
+}
+
+// ResetPassword checks that the given token was returned from NewResetToken for
+// the given user, and that neither has it expired nor has the user's password
+// changed since, and if so changes the user's password to the given one. All of
+// the user's sessions are revoked, see RevokeAll. Returns ErrInvalidResetToken
+// if the token isn't valid
+func (s *System) ResetPassword(user, token, newPassword string) error {
+	if s.Secret == nil {
+		return ErrSecretNotSet
+	}
+	parts := bytes.Split(sig.Extract(token, s.Secret), []byte(":"))
+	if len(parts) != 4 || string(parts[0]) != resetTag {
+		return ErrInvalidResetToken
+	}
+	tenant, err := verifyB64.DecodeString(string(parts[1]))
+	if err != nil || string(tenant) != s.Tenant {
+		return ErrInvalidResetToken
+	}
+	tokUser, err := verifyB64.DecodeString(string(parts[2]))
+	if err != nil || string(tokUser) != s.normalize(user) {
+		return ErrInvalidResetToken
+	}
+
+	m, err := s.getRaw(user)
+	if err != nil {
+		return err
+	}
+	i := s.infoFromRaw(m, Hidden|Private)
+	if i["Disabled"] != "" {
+		return ErrDisabled
+	} else if string(parts[3]) != passwordHashSum(i["PasswordHash"]) {
+		return ErrInvalidResetToken
+	}
+
+	hash, err := s.hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	// The password is only changed if it's still the one the token was checked
+	// against, so that the token can't be used twice concurrently
+	n, err := util.LuaEval(s.c, hsetifeq, 1,
+		s.Key(user), s.fields["PasswordHash"].Key, i["PasswordHash"], hash,
+		s.fields["TSModified"].Key, marshalTime(time.Now()),
+	).Int()
+	if err != nil {
+		return err
+	} else if n == 0 {
+		return ErrInvalidResetToken
+	}
+	s.uncache(user)
+	s.publish(EventModified, user, "PasswordHash")
+	return s.RevokeAll(user)
+}
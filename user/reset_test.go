@@ -0,0 +1,66 @@
+package user
+
+import (
+	. "testing"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResetPassword(t *T) {
+	s := testSystem(t)
+	user, _, password := randUser(t, s)
+
+	_, err := s.NewResetToken(user)
+	assert.Equal(t, ErrSecretNotSet, err)
+	s.Secret = []byte("secret")
+
+	_, err = s.NewResetToken(commontest.RandStr())
+	assert.Equal(t, ErrNotFound, err)
+
+	tok, err := s.NewResetToken(user)
+	require.Nil(t, err)
+	session, err := s.NewSession(user, nil)
+	require.Nil(t, err)
+
+	newPassword := commontest.RandStr()
+	assert.Equal(t, ErrInvalidResetToken, s.ResetPassword(user, "blah blah blah", newPassword))
+	assert.Equal(t, ErrInvalidResetToken, s.ResetPassword(commontest.RandStr(), tok, newPassword))
+	require.Nil(t, s.Authenticate(user, password))
+
+	require.Nil(t, s.ResetPassword(user, tok, newPassword))
+	assert.Equal(t, ErrBadAuth, s.Authenticate(user, password))
+	require.Nil(t, s.Authenticate(user, newPassword))
+	ok, err := s.ValidSession(user, session)
+	require.Nil(t, err)
+	assert.False(t, ok)
+
+	// Tokens can only be used once, and are invalidated by the password
+	// changing
+	assert.Equal(t, ErrInvalidResetToken, s.ResetPassword(user, tok, commontest.RandStr()))
+	tok, err = s.NewResetToken(user)
+	require.Nil(t, err)
+	require.Nil(t, s.ChangePassword(user, password))
+	assert.Equal(t, ErrInvalidResetToken, s.ResetPassword(user, tok, newPassword))
+
+	// Verification tokens aren't reset tokens
+	vtok, err := s.NewVerifyToken(user)
+	require.Nil(t, err)
+	assert.Equal(t, ErrInvalidResetToken, s.ResetPassword(user, vtok, newPassword))
+
+	// Tokens expire
+	s.ResetTimeout = time.Second
+	tok, err = s.NewResetToken(user)
+	require.Nil(t, err)
+	time.Sleep(1100 * time.Millisecond)
+	assert.Equal(t, ErrInvalidResetToken, s.ResetPassword(user, tok, newPassword))
+
+	tok, err = s.NewResetToken(user)
+	require.Nil(t, err)
+	require.Nil(t, s.Disable(user))
+	assert.Equal(t, ErrDisabled, s.ResetPassword(user, tok, newPassword))
+	_, err = s.NewResetToken(user)
+	assert.Equal(t, ErrDisabled, err)
+}
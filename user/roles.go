@@ -0,0 +1,113 @@
+package user
+
+import (
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/radix.v2/util"
+)
+
+// ErrNoPermission is returned from CheckPermission when the user hasn't been
+// granted the Permissions being checked for
+var ErrNoPermission = common.ExpectedErr{Code: 403, ID: "no_permission", Err: "user doesn't have permission"}
+
+// Permission is a set of flags describing things a user may be allowed to do.
+// The flags are defined by the application, in the same way as FieldFlag's,
+// e.g.:
+//
+//	const (
+//		PermBan user.Permission = 1 << iota
+//		PermEditOthers
+//	)
+//
+// and are granted to users through their roles, see RolePermissions
+type Permission uint64
+
+// SADDXX userKey setKey member
+// Calls SADD on the set, but only if the user's hash exists. Returns -1 if it
+// doesn't, otherwise what SADD returned
+var saddxx = `
+	if redis.call('EXISTS', KEYS[1]) == 0 then
+		return -1
+	end
+	return redis.call('SADD', KEYS[2], ARGV[1])
+`
+
+// rolesKey returns the key of the set holding the user's roles. It's under
+// Key(user, ...), so it's in the same slot as the user's hash and is removed
+// by Delete
+func (s *System) rolesKey(user string) string {
+	return s.Key(user, "roles")
+}
+
+// AddRole gives the user the role with the given name, e.g. "admin". Giving a
+// user a role they already have does nothing. Returns ErrNotFound if the user
+// doesn't exist
+func (s *System) AddRole(user, role string) error {
+	i, err := util.LuaEval(s.c, saddxx, 2, s.Key(user), s.rolesKey(user), role).Int()
+	if err != nil {
+		return err
+	} else if i == -1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RemoveRole takes away the role with the given name from the user. Taking
+// away a role the user doesn't have does nothing
+func (s *System) RemoveRole(user, role string) error {
+	return s.c.Cmd("SREM", s.rolesKey(user), role).Err
+}
+
+// HasRole returns whether the user has been given the role with the given name
+func (s *System) HasRole(user, role string) (bool, error) {
+	i, err := s.c.Cmd("SISMEMBER", s.rolesKey(user), role).Int()
+	return i == 1, err
+}
+
+// Roles returns the names of all roles the user has been given, in no
+// particular order
+func (s *System) Roles(user string) ([]string, error) {
+	return s.c.Cmd("SMEMBERS", s.rolesKey(user)).List()
+}
+
+// Permissions returns all Permissions granted to the user by their roles, as
+// set in RolePermissions. Disabled users have no Permissions
+func (s *System) Permissions(user string) (Permission, error) {
+	roles, err := s.Roles(user)
+	if err != nil || len(roles) == 0 {
+		return 0, err
+	}
+	i, err := s.Get(user, Private)
+	if err == ErrNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	} else if i["Disabled"] != "" {
+		return 0, nil
+	}
+
+	var p Permission
+	for _, role := range roles {
+		p |= s.RolePermissions[role]
+	}
+	return p, nil
+}
+
+// HasPermission returns whether the user has been granted all of the given
+// Permissions by their roles, e.g. so that an endpoint can be limited to users
+// with PermBan
+func (s *System) HasPermission(user string, p Permission) (bool, error) {
+	has, err := s.Permissions(user)
+	return has&p == p, err
+}
+
+// CheckPermission is like HasPermission, but returns ErrNoPermission if the user
+// doesn't have the Permissions, so that it can be passed straight to
+// common.HTTPError by whatever is gating an endpoint on them
+func (s *System) CheckPermission(user string, p Permission) error {
+	if has, err := s.HasPermission(user, p); err != nil {
+		return err
+	} else if !has {
+		return ErrNoPermission
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package user
+
+import (
+	"sort"
+	. "testing"
+
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoles(t *T) {
+	s := testSystem(t)
+	user, _, _ := randUser(t, s)
+
+	roles, err := s.Roles(user)
+	require.Nil(t, err)
+	assert.Empty(t, roles)
+
+	require.Nil(t, s.AddRole(user, "admin"))
+	require.Nil(t, s.AddRole(user, "mod"))
+	require.Nil(t, s.AddRole(user, "mod"))
+	roles, err = s.Roles(user)
+	require.Nil(t, err)
+	sort.Strings(roles)
+	assert.Equal(t, []string{"admin", "mod"}, roles)
+
+	has, err := s.HasRole(user, "admin")
+	require.Nil(t, err)
+	assert.True(t, has)
+	require.Nil(t, s.RemoveRole(user, "admin"))
+	has, err = s.HasRole(user, "admin")
+	require.Nil(t, err)
+	assert.False(t, has)
+
+	assert.Equal(t, ErrNotFound, s.AddRole(commontest.RandStr(), "admin"))
+
+	// Deleting the user removes their roles, so a new user with the same name
+	// doesn't get them
+	require.Nil(t, s.Delete(user))
+	require.Nil(t, s.Create(user, commontest.RandStr(), commontest.RandStr()))
+	roles, err = s.Roles(user)
+	require.Nil(t, err)
+	assert.Empty(t, roles)
+}
+
+func TestPermissions(t *T) {
+	const (
+		permBan Permission = 1 << iota
+		permEdit
+		permDelete
+	)
+	s := testSystem(t)
+	s.RolePermissions = map[string]Permission{
+		"admin": permBan | permEdit | permDelete,
+		"mod":   permBan,
+		"edit":  permEdit,
+	}
+	user, _, _ := randUser(t, s)
+
+	p, err := s.Permissions(user)
+	require.Nil(t, err)
+	assert.Equal(t, Permission(0), p)
+	assert.Equal(t, ErrNoPermission, s.CheckPermission(user, permBan))
+
+	require.Nil(t, s.AddRole(user, "mod"))
+	require.Nil(t, s.AddRole(user, "edit"))
+	require.Nil(t, s.AddRole(user, "unknown"))
+	p, err = s.Permissions(user)
+	require.Nil(t, err)
+	assert.Equal(t, permBan|permEdit, p)
+
+	has, err := s.HasPermission(user, permBan|permEdit)
+	require.Nil(t, err)
+	assert.True(t, has)
+	has, err = s.HasPermission(user, permBan|permDelete)
+	require.Nil(t, err)
+	assert.False(t, has)
+	assert.Nil(t, s.CheckPermission(user, permEdit))
+	assert.Equal(t, ErrNoPermission, s.CheckPermission(user, permDelete))
+
+	// Disabled users have no permissions
+	require.Nil(t, s.Disable(user))
+	assert.Equal(t, ErrNoPermission, s.CheckPermission(user, permEdit))
+}
@@ -0,0 +1,157 @@
+package user
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mediocregopher/mediocre-api/common"
+)
+
+// ErrInvalidCursor is returned from Search and List when given a cursor which
+// they didn't return themselves
+var ErrInvalidCursor = common.ExpectedErr{Code: 400, ID: "invalid_cursor", Err: "invalid cursor"}
+
+// The number of users returned by each call to Search
+const searchPageSize = 20
+
+// searchBase returns the part of all search related key names which comes
+// before anything else, taking Prefix and Tenant into account
+func (s *System) searchBase() string {
+	if p := s.prefix(); p != "" {
+		return "user:" + p + ":search"
+	}
+	return "user:search"
+}
+
+// searchKey returns the key of the hash which SearchFields are mirrored into
+// for the given user. It shares the user's hash tag, so it lives in the same
+// slot as the user's own key
+func (s *System) searchKey(user string) string {
+	return s.searchBase() + ":{" + s.normalize(user) + "}"
+}
+
+// mirror copies the SearchFields found in the given Info into the user's search
+// hash, so they get indexed
+func (s *System) mirror(user string, i Info) error {
+	args := []interface{}{s.searchKey(user)}
+	for _, f := range s.SearchFields {
+		if v, ok := i[f]; ok {
+			args = append(args, f, v)
+		}
+	}
+	if len(args) == 1 {
+		return nil
+	}
+	return s.c.Cmd("HMSET", args...).Err
+}
+
+// unmirror removes the user's search hash, so they no longer show up in Search
+func (s *System) unmirror(user string) error {
+	if len(s.SearchFields) == 0 {
+		return nil
+	}
+	return s.c.Cmd("DEL", s.searchKey(user)).Err
+}
+
+// CreateSearchIndex creates the RediSearch index which Search uses, if it
+// doesn't already exist. This must be called, after SearchFields is set, before
+// Search can be used. Users who are created or Set before it's called are still
+// indexed once it is
+func (s *System) CreateSearchIndex() error {
+	args := []interface{}{
+		s.searchBase(), "ON", "HASH", "PREFIX", 1, s.searchBase() + ":",
+		"SCHEMA",
+	}
+	for _, f := range s.SearchFields {
+		if s.fields[f].Flags == 0 {
+			return ErrFieldUnknown(f)
+		}
+		args = append(args, f, "TEXT")
+	}
+
+	err := s.c.Cmd("FT.CREATE", args...).Err
+	if err != nil && strings.Contains(err.Error(), "already exists") {
+		return nil
+	}
+	return err
+}
+
+// searchQuery turns the words in the given string, split up the same way
+// RediSearch splits up fields, into a RediSearch query which matches users
+// having all of them, with each word matching any word in a field it's a prefix
+// of or is one letter away from
+func searchQuery(q string) string {
+	words := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	for i, w := range words {
+		// RediSearch ignores prefixes shorter than two characters
+		if len([]rune(w)) > 1 {
+			words[i] = "(" + w + "*|%" + w + "%)"
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// Search returns the Info (with Private fields) of the users whose
+// SearchFields match the given query, up to 20 at a time. Each word in the
+// query matches a word in any of the fields which it's a prefix of or is a
+// single typo away from, and all words must match. Disabled users are never
+// returned.
+//
+// The cursor should be empty to get the first page of results. Each call
+// returns the cursor to give to get the next page, or empty string if there are
+// no more
+func (s *System) Search(query, cursor string) ([]Info, string, error) {
+	offset := 0
+	if cursor != "" {
+		var err error
+		if offset, err = strconv.Atoi(cursor); err != nil || offset < 0 {
+			return nil, "", ErrInvalidCursor
+		}
+	}
+
+	q := searchQuery(query)
+	if q == "" {
+		return nil, "", nil
+	}
+
+	// The reply is the total number of results followed by the keys of this
+	// page of them
+	l, err := s.c.Cmd(
+		"FT.SEARCH", s.searchBase(), q, "NOCONTENT",
+		"LIMIT", offset, searchPageSize,
+	).Array()
+	if err != nil {
+		return nil, "", err
+	}
+	total, err := l[0].Int()
+	if err != nil {
+		return nil, "", err
+	}
+
+	ii := make([]Info, 0, len(l)-1)
+	keyPrefix := s.searchBase() + ":{"
+	for _, r := range l[1:] {
+		k, err := r.Str()
+		if err != nil {
+			return nil, "", err
+		}
+		user := strings.TrimSuffix(strings.TrimPrefix(k, keyPrefix), "}")
+		i, err := s.Get(user, Private)
+		if err == ErrNotFound || (err == nil && i["Disabled"] != "") {
+			// Deleted or disabled since being found
+			continue
+		} else if err != nil {
+			return nil, "", err
+		}
+		ii = append(ii, i)
+	}
+
+	next := ""
+	if offset += searchPageSize; offset < total {
+		next = strconv.Itoa(offset)
+	}
+	return ii, next, nil
+}
@@ -0,0 +1,106 @@
+package user
+
+import (
+	"strings"
+	. "testing"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSearchSystem(t *T) *System {
+	s := testSystem(t)
+	s.SearchFields = []string{"Name", "Email"}
+	return s
+}
+
+func TestSearchQuery(t *T) {
+	assert.Equal(t, "", searchQuery(" .@ "))
+	assert.Equal(t, "(bob*|%bob%)", searchQuery("Bob"))
+	assert.Equal(t,
+		"(bob*|%bob%) (example*|%example%) (com*|%com%)",
+		searchQuery("bob@example.com"),
+	)
+	assert.Equal(t, "j (smith*|%smith%)", searchQuery("J. Smith"))
+}
+
+func TestSearchMirror(t *T) {
+	s := testSearchSystem(t)
+	user, email, _ := randUser(t, s)
+
+	assertMirror := func(expected map[string]string) {
+		m, err := s.c.Cmd("HGETALL", s.searchKey(user)).Map()
+		require.Nil(t, err)
+		assert.Equal(t, expected, m)
+	}
+	assertMirror(map[string]string{"Name": user, "Email": email})
+
+	email2 := commontest.RandEmail()
+	require.Nil(t, s.Set(user, Info{"Email": email2}))
+	assertMirror(map[string]string{"Name": user, "Email": email2})
+
+	require.Nil(t, s.Disable(user))
+	assertMirror(map[string]string{})
+	require.Nil(t, s.Enable(user))
+	assertMirror(map[string]string{"Name": user, "Email": email2})
+
+	require.Nil(t, s.Delete(user))
+	assertMirror(map[string]string{})
+
+	// Without SearchFields nothing is mirrored
+	s.SearchFields = nil
+	user, _, _ = randUser(t, s)
+	assertMirror(map[string]string{})
+}
+
+func TestSearch(t *T) {
+	s := testSearchSystem(t)
+	if err := s.CreateSearchIndex(); err != nil &&
+		strings.Contains(strings.ToLower(err.Error()), "unknown command") {
+		t.Skip("RediSearch isn't available")
+	} else {
+		require.Nil(t, err)
+	}
+	require.Nil(t, s.CreateSearchIndex())
+
+	_, _, err := s.Search("foo", "nope")
+	assert.Equal(t, ErrInvalidCursor, err)
+
+	word := strings.ToLower(commontest.RandStr())
+	var users []string
+	for i := 0; i < searchPageSize+1; i++ {
+		user := word + "-" + commontest.RandStr()
+		require.Nil(t, s.Create(user, commontest.RandEmail(), "password"))
+		users = append(users, user)
+	}
+
+	// RediSearch indexes hashes asynchronously
+	time.Sleep(500 * time.Millisecond)
+
+	var found []string
+	for cursor := ""; ; {
+		ii, next, err := s.Search(word, cursor)
+		require.Nil(t, err)
+		for _, i := range ii {
+			found = append(found, i["Name"])
+		}
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+	assert.ElementsMatch(t, users, found)
+
+	// A typo still matches, and disabled users aren't found
+	require.Nil(t, s.Disable(users[0]))
+	typo := word[:len(word)-1] + "z"
+	ii, _, err := s.Search(typo+" "+users[1][len(word)+1:], "")
+	require.Nil(t, err)
+	require.Len(t, ii, 1)
+	assert.Equal(t, users[1], ii[0]["Name"])
+
+	ii, _, err = s.Search(users[0][len(word)+1:], "")
+	require.Nil(t, err)
+	assert.Empty(t, ii)
+}
@@ -0,0 +1,192 @@
+package user
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/mediocregopher/radix.v2/redis"
+	"github.com/mediocregopher/radix.v2/util"
+)
+
+// Session describes one of a user's sessions, as returned by ListSessions
+type Session struct {
+	ID      string
+	Created time.Time
+	Expires time.Time
+
+	// The metadata given to NewSession, e.g. the client's user agent and ip
+	Meta map[string]string
+}
+
+// NEWSESSION userKey indexKey sessionKey id expiresMs ttlMs nowMs data
+// Stores the session's data and adds it to the user's index of sessions, first
+// removing sessions which have expired from the index, but only if the user
+// exists. The index is kept around for as long as its longest lived session.
+// Returns 1 if the user exists, 0 otherwise
+var newSession = `
+	if redis.call('EXISTS', KEYS[1]) == 0 then
+		return 0
+	end
+	redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', ARGV[4])
+	redis.call('SET', KEYS[3], ARGV[5], 'PX', ARGV[3])
+	redis.call('ZADD', KEYS[2], ARGV[2], ARGV[1])
+	if redis.call('PTTL', KEYS[2]) < tonumber(ARGV[3]) then
+		redis.call('PEXPIRE', KEYS[2], ARGV[3])
+	end
+	return 1
+`
+
+// VALIDSESSION userKey sessionKey disabledField
+// Returns 1 if the session exists and the user isn't disabled, 0 otherwise
+var validSession = `
+	if redis.call('EXISTS', KEYS[2]) == 0 then
+		return 0
+	end
+	if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 1 then
+		return 0
+	end
+	return 1
+`
+
+// REVOKEALL indexKey sessionKeyPrefix
+// Deletes every session in the index, and the index itself. The session keys
+// aren't passed in as KEYS, since they're only known once the index is read,
+// but they share the index's hash tag and so are always on the same node
+var revokeAll = `
+	local ids = redis.call('ZRANGE', KEYS[1], 0, -1)
+	for _, id in ipairs(ids) do
+		redis.call('DEL', ARGV[1] .. id)
+	end
+	redis.call('DEL', KEYS[1])
+`
+
+// sessionsKey returns the key of the sorted set indexing the user's sessions by
+// when they expire. Like all session keys it's under Key(user, ...), so that
+// Delete removes them
+func (s *System) sessionsKey(user string) string {
+	return s.Key(user, "sessions")
+}
+
+// sessionKey returns the key holding the session's data
+func (s *System) sessionKey(user, id string) string {
+	return s.Key(user, "session", id)
+}
+
+// sessionData is what's stored at a sessionKey
+type sessionData struct {
+	Created time.Time
+	Meta    map[string]string
+}
+
+// NewSession records a new session for the user, with the given metadata (which
+// may be nil), and returns its ID. The session is valid until SessionTTL has
+// passed or it's revoked. Returns ErrNotFound if the user doesn't exist
+func (s *System) NewSession(user string, meta map[string]string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+
+	now := time.Now()
+	data, err := json.Marshal(sessionData{Created: now.UTC(), Meta: meta})
+	if err != nil {
+		return "", err
+	}
+
+	ttl := int64(s.SessionTTL / time.Millisecond)
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+	i, err := util.LuaEval(s.c, newSession, 3,
+		s.Key(user), s.sessionsKey(user), s.sessionKey(user, id),
+		id, nowMs+ttl, ttl, nowMs, data,
+	).Int()
+	if err != nil {
+		return "", err
+	} else if i == 0 {
+		return "", ErrNotFound
+	}
+	return id, nil
+}
+
+// ValidSession returns whether the session with the given ID was created for
+// the user, and hasn't expired or been revoked, and that the user isn't
+// disabled
+func (s *System) ValidSession(user, id string) (bool, error) {
+	if id == "" {
+		return false, nil
+	}
+	i, err := util.LuaEval(s.c, validSession, 2,
+		s.Key(user), s.sessionKey(user, id), s.fields["Disabled"].Key,
+	).Int()
+	return i == 1, err
+}
+
+// ListSessions returns the user's sessions which haven't expired or been
+// revoked, ordered by when they expire, soonest first
+func (s *System) ListSessions(user string) ([]Session, error) {
+	nowMs := time.Now().UnixNano() / int64(time.Millisecond)
+	l, err := s.c.Cmd(
+		"ZRANGEBYSCORE", s.sessionsKey(user), "("+strconv.FormatInt(nowMs, 10), "+inf",
+		"WITHSCORES",
+	).List()
+	if err != nil || len(l) == 0 {
+		return nil, err
+	}
+
+	keys := make([]interface{}, 0, len(l)/2)
+	for i := 0; i < len(l); i += 2 {
+		keys = append(keys, s.sessionKey(user, l[i]))
+	}
+	// The keys all share the user's hash tag, so this works with cluster
+	rr, err := s.c.Cmd("MGET", keys...).Array()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(rr))
+	for i, r := range rr {
+		if r.IsType(redis.Nil) {
+			// Revoked since being listed
+			continue
+		}
+		b, err := r.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		var data sessionData
+		if err := json.Unmarshal(b, &data); err != nil {
+			return nil, err
+		}
+		expiresMs, err := strconv.ParseFloat(l[i*2+1], 64)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, Session{
+			ID:      l[i*2],
+			Created: data.Created,
+			Expires: time.Unix(0, int64(expiresMs)*int64(time.Millisecond)).UTC(),
+			Meta:    data.Meta,
+		})
+	}
+	return sessions, nil
+}
+
+// RevokeSession makes the session with the given ID no longer valid. Revoking
+// a session which doesn't exist does nothing
+func (s *System) RevokeSession(user, id string) error {
+	if err := s.c.Cmd("DEL", s.sessionKey(user, id)).Err; err != nil {
+		return err
+	}
+	return s.c.Cmd("ZREM", s.sessionsKey(user), id).Err
+}
+
+// RevokeAll makes all of the user's sessions no longer valid, e.g. to log them
+// out everywhere. ChangePassword, ResetPassword and Disable all call it
+func (s *System) RevokeAll(user string) error {
+	return util.LuaEval(s.c, revokeAll, 1,
+		s.sessionsKey(user), s.sessionKey(user, ""),
+	).Err
+}
@@ -0,0 +1,109 @@
+package user
+
+import (
+	. "testing"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessions(t *T) {
+	s := testSystem(t)
+	user, _, _ := randUser(t, s)
+
+	_, err := s.NewSession(commontest.RandStr(), nil)
+	assert.Equal(t, ErrNotFound, err)
+
+	meta := map[string]string{"ip": "127.0.0.1"}
+	id1, err := s.NewSession(user, meta)
+	require.Nil(t, err)
+	id2, err := s.NewSession(user, nil)
+	require.Nil(t, err)
+	assert.NotEqual(t, id1, id2)
+
+	assertValid := func(id string, expected bool) {
+		ok, err := s.ValidSession(user, id)
+		require.Nil(t, err)
+		assert.Equal(t, expected, ok, "session: %s", id)
+	}
+	assertValid(id1, true)
+	assertValid(id2, true)
+	assertValid(commontest.RandStr(), false)
+	assertValid("", false)
+
+	sessions, err := s.ListSessions(user)
+	require.Nil(t, err)
+	require.Len(t, sessions, 2)
+	// Both may expire in the same millisecond, so their order isn't certain
+	if sessions[0].ID != id1 {
+		sessions[0], sessions[1] = sessions[1], sessions[0]
+	}
+	assert.Equal(t, id1, sessions[0].ID)
+	assert.Equal(t, meta, sessions[0].Meta)
+	assert.WithinDuration(t, time.Now(), sessions[0].Created, 5*time.Second)
+	assert.WithinDuration(t, time.Now().Add(s.SessionTTL), sessions[0].Expires, 5*time.Second)
+	assert.Equal(t, id2, sessions[1].ID)
+
+	require.Nil(t, s.RevokeSession(user, id1))
+	assertValid(id1, false)
+	assertValid(id2, true)
+	sessions, err = s.ListSessions(user)
+	require.Nil(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, id2, sessions[0].ID)
+
+	id3, err := s.NewSession(user, nil)
+	require.Nil(t, err)
+	require.Nil(t, s.RevokeAll(user))
+	assertValid(id2, false)
+	assertValid(id3, false)
+	sessions, err = s.ListSessions(user)
+	require.Nil(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestSessionExpire(t *T) {
+	s := testSystem(t)
+	s.SessionTTL = 500 * time.Millisecond
+	user, _, _ := randUser(t, s)
+
+	id, err := s.NewSession(user, nil)
+	require.Nil(t, err)
+	time.Sleep(1 * time.Second)
+
+	ok, err := s.ValidSession(user, id)
+	require.Nil(t, err)
+	assert.False(t, ok)
+	sessions, err := s.ListSessions(user)
+	require.Nil(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestSessionRevokedBy(t *T) {
+	s := testSystem(t)
+	user, _, _ := randUser(t, s)
+	assertValid := func(id string, expected bool) {
+		ok, err := s.ValidSession(user, id)
+		require.Nil(t, err)
+		assert.Equal(t, expected, ok)
+	}
+
+	id, err := s.NewSession(user, nil)
+	require.Nil(t, err)
+	require.Nil(t, s.ChangePassword(user, commontest.RandStr()))
+	assertValid(id, false)
+
+	id, err = s.NewSession(user, nil)
+	require.Nil(t, err)
+	require.Nil(t, s.Disable(user))
+	assertValid(id, false)
+
+	// Sessions of disabled users aren't valid even if they weren't revoked
+	id, err = s.NewSession(user, nil)
+	require.Nil(t, err)
+	assertValid(id, false)
+	require.Nil(t, s.Enable(user))
+	assertValid(id, true)
+}
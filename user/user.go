@@ -6,33 +6,44 @@
 package user
 
 import (
-	"encoding/hex"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/mediocregopher/mediocre-api/common"
-	"github.com/mediocregopher/radix.v2/redis"
+	"github.com/mediocregopher/mediocre-api/common/cache"
+	"github.com/mediocregopher/mediocre-api/common/events"
 	"github.com/mediocregopher/radix.v2/util"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // Errors which can be expected from various methods in this package
 var (
-	ErrUserExists      = common.ExpectedErr{Code: 400, Err: "user exists"}
-	ErrNotFound        = common.ExpectedErr{Code: 404, Err: "user not found"}
-	ErrBadAuth         = common.ExpectedErr{Code: 400, Err: "could not authenticate user"}
-	ErrDisabled        = common.ExpectedErr{Code: 400, Err: "user account is disabled"}
-	ErrInvalidUsername = common.ExpectedErr{Code: 400, Err: "invalid username"}
+	ErrUserExists      = common.ExpectedErr{Code: 400, ID: "user_exists", Err: "user exists"}
+	ErrNotFound        = common.ExpectedErr{Code: 404, ID: "user_not_found", Err: "user not found"}
+	ErrBadAuth         = common.ExpectedErr{Code: 400, ID: "bad_auth", Err: "could not authenticate user"}
+	ErrDisabled        = common.ExpectedErr{Code: 400, ID: "user_disabled", Err: "user account is disabled"}
+	ErrInvalidUsername = common.ExpectedErr{Code: 400, ID: "invalid_username", Err: "invalid username"}
+	ErrEmailTaken      = common.ExpectedErr{Code: 400, ID: "email_taken", Err: "email is taken by another user"}
 )
 
 // Functions which return errors based on the related field names
 var (
 	ErrFieldUnknown = func(f string) error {
-		return common.ExpectedErrf(400, "unknown field %q", f)
+		return common.ExpectedErrf(400, "unknown field %q", f).
+			WithID("unknown_field")
 	}
 	ErrFieldUneditable = func(f string) error {
-		return common.ExpectedErrf(400, "field %q not editable", f)
+		return common.ExpectedErrf(400, "field %q not editable", f).
+			WithID("field_not_editable")
+	}
+	ErrFieldType = func(f string, t FieldType) error {
+		return common.ExpectedErrf(400, "field %q is of type %s", f, t).
+			WithID("field_wrong_type")
+	}
+	ErrFieldInvalid = func(f string, t FieldType) error {
+		return common.ExpectedErrf(400, "field %q must be a valid %s", f, t).
+			WithID("field_invalid")
 	}
 )
 
@@ -103,7 +114,9 @@ const (
 )
 
 // Field is a struct which describes a single field of a user map. A field's
-// value is inherently a string.
+// value is inherently a string, but may be given a Type other than TypeString
+// to have it checked and read/written with the typed getters and setters (e.g.
+// GetInt and SetInt)
 type Field struct {
 
 	// The name of the field. This is the key it will appear under in the user
@@ -117,6 +130,9 @@ type Field struct {
 	// Used to determine the behavior of this field. This *must* be set to a
 	// value greater than zero
 	Flags FieldFlag
+
+	// The type of value the field holds. Defaults to TypeString
+	Type FieldType
 }
 
 // Info represents information for a single user in the system. The fields in
@@ -130,36 +146,152 @@ type Info map[string]string
 // * Email (private, editable)
 // * TSModified (private)
 // * Disabled (private)
+// * Verified (private)
+// * LastLoggedIn (private)
 // * PasswordHash (hidden)
 type System struct {
-	c util.Cmder
+	c common.Cmder
 
-	// The cost parameter to use when creating new password hashes. This
-	// defaults to 11 and can be set right after instantiation
+	// The cost parameter to use when creating new password hashes, if
+	// PasswordHasher isn't set. This defaults to 11 and can be set right after
+	// instantiation
 	BCryptCost int
 
+	// PasswordHasher is used to hash passwords. Hashes made by any of the
+	// PasswordHashers in this package can still be checked after it's
+	// changed, and when a user successfully authenticates with a hash made by
+	// a different PasswordHasher, or one with different parameters, their
+	// password is rehashed with this one (unless SkipRehash is set). Defaults
+	// to nil, meaning a BCryptHasher using BCryptCost
+	PasswordHasher PasswordHasher
+
+	// If set, Authenticate never rehashes passwords, see PasswordHasher.
+	// Defaults to false
+	SkipRehash bool
+
 	// A list of usernames which are not allowed to be created. Defaults to
 	// []string{"new-user", "root"}
 	BannedUsernames []string
 
+	// Prefix can be filled in on a System returned from New, and is used as
+	// part of a prefix on all keys used by this system. Useful if you want to
+	// have two user Systems using the same Cmder
+	Prefix string
+
+	// Tenant can be filled in on a System returned from New in order to keep
+	// its data separate from that of Systems with other Tenants, e.g. when one
+	// deployment hosts multiple applications. Like Prefix it's made part of
+	// all keys, and so also of the index used by Search. Users with the same
+	// name in different Tenants are different users
+	Tenant string
+
+	// If set, a UserCreated event is published to this Stream whenever a user
+	// is created, with the user's name in its "user" field
+	Events *events.Stream
+
+	// If set, an Event is published as json to this pub/sub channel whenever
+	// a user is created, modified, disabled, or deleted through this System,
+	// see Subscribe. Unlike with Events, those published while nothing is
+	// subscribed are missed. Defaults to empty, meaning none are published.
+	// Like Prefix and Tenant, Systems sharing a redis which are kept separate
+	// should use different channels
+	EventsChannel string
+
+	// SearchFields are the names of the fields which Search matches against,
+	// e.g. []string{"Name", "Email"}. Whenever a user is created or Set these
+	// fields are mirrored into a hash which is indexed by RediSearch, see
+	// CreateSearchIndex. Defaults to empty, meaning search is disabled and
+	// nothing is mirrored
+	SearchFields []string
+
+	// If set, Get caches users' data in it. Users are invalidated in it, and
+	// published to CacheChannel, whenever they're changed through this
+	// System, so every System sharing the same data should have a Cache set
+	// and be calling its Listen with CacheChannel in order to see each
+	// other's changes right away. Authenticate never uses the Cache
+	Cache *cache.Cache
+
+	// The secret used to sign the tokens returned from NewVerifyToken and
+	// NewResetToken. Email verification and password resets can't be used
+	// unless this is set. Defaults to nil
+	Secret []byte
+
+	// How long tokens returned from NewVerifyToken are valid for. Defaults to
+	// 24 hours, and can be set right after instantiation
+	VerifyTimeout time.Duration
+
+	// How long tokens returned from NewResetToken are valid for. Defaults to
+	// 1 hour, and can be set right after instantiation
+	ResetTimeout time.Duration
+
+	// How many times in a row authenticating as a user may fail before
+	// Authenticate returns ErrTooManyAttempts for them, until LockoutPeriod
+	// has passed without another failure. Defaults to 10, and can be set right
+	// after instantiation. Setting it to 0 turns this off
+	MaxAttempts int
+
+	// How many times in a row authenticating from an ip, as any user, may fail
+	// before AuthenticateFrom returns ErrTooManyAttempts for it, in the same
+	// way as MaxAttempts. Many users may share an ip, so this should be
+	// higher than MaxAttempts. Defaults to 0, meaning ips aren't limited
+	MaxIPAttempts int
+
+	// How long failed attempts are counted towards MaxAttempts and
+	// MaxIPAttempts for. Each failure resets the period for its user and ip.
+	// Defaults to 15 minutes, and can be set right after instantiation
+	LockoutPeriod time.Duration
+
+	// How long sessions created by NewSession are valid for, unless revoked.
+	// Defaults to 30 days, and can be set right after instantiation
+	SessionTTL time.Duration
+
+	// RolePermissions maps role names to the Permissions which users having
+	// them are granted, see AddRole and HasPermission. Roles which aren't in
+	// it grant no Permissions. Defaults to nil
+	RolePermissions map[string]Permission
+
+	// If set, usernames are passed through this before being used to find a
+	// user's data, so that all usernames it maps to the same string refer to
+	// the same user, e.g. strings.ToLower to make usernames case-insensitive.
+	// The Name field keeps the username as it was given to Create. It must
+	// be set right after instantiation, before any users are created, and
+	// should be idempotent. Defaults to nil (usernames are used as-is)
+	NormalizeUsername func(string) string
+
+	// If set, Authenticate doesn't record the time of successful logins in
+	// the LastLoggedIn field, or reset the user's failed attempts (they
+	// expire after LockoutPeriod instead). Along with SkipRehash this means
+	// it makes no writes to the user when authenticating succeeds, e.g. when
+	// the Cmder is a read-only replica. Attempts are still counted though, so
+	// MaxAttempts (and MaxIPAttempts) should also be set to 0 in that case.
+	// Defaults to false
+	SkipLastLoggedIn bool
+
 	fields map[string]Field
 }
 
 // New returns a new System which will use the given Cmder as its persistence
 // layer
-func New(c util.Cmder) *System {
+func New(c common.Cmder) *System {
 	s := System{
 		c:               c,
 		BCryptCost:      11,
 		BannedUsernames: []string{"new-user", "root"},
+		VerifyTimeout:   24 * time.Hour,
+		ResetTimeout:    time.Hour,
+		MaxAttempts:     10,
+		LockoutPeriod:   15 * time.Minute,
+		SessionTTL:      30 * 24 * time.Hour,
 		fields:          map[string]Field{},
 	}
-	s.AddField(Field{"Name", "_n", Public})
-	s.AddField(Field{"TSCreated", "_t", Public})
-	s.AddField(Field{"Email", "_e", Private | Editable})
-	s.AddField(Field{"TSModified", "_tm", Private})
-	s.AddField(Field{"Disabled", "_d", Private})
-	s.AddField(Field{"PasswordHash", "_p", Hidden})
+	s.AddField(Field{"Name", "_n", Public, TypeString})
+	s.AddField(Field{"TSCreated", "_t", Public, TypeTime})
+	s.AddField(Field{"Email", "_e", Private | Editable, TypeString})
+	s.AddField(Field{"TSModified", "_tm", Private, TypeTime})
+	s.AddField(Field{"Disabled", "_d", Private, TypeBool})
+	s.AddField(Field{"Verified", "_v", Private, TypeTime})
+	s.AddField(Field{"LastLoggedIn", "_ll", Private, TypeTime})
+	s.AddField(Field{"PasswordHash", "_p", Hidden, TypeString})
 	return &s
 }
 
@@ -178,11 +310,30 @@ func (s *System) AddField(f Field) {
 	s.fields[f.Name] = f
 }
 
+// prefix returns the prefix used in all key names, taking both Prefix and
+// Tenant into account
+func (s *System) prefix() string {
+	return common.TenantPrefix(s.Tenant, s.Prefix)
+}
+
+// normalize returns the given username as passed through NormalizeUsername, if
+// it's set
+func (s *System) normalize(user string) string {
+	if s.NormalizeUsername == nil {
+		return user
+	}
+	return s.NormalizeUsername(user)
+}
+
 // Key returns a key which can be used to interact with some arbitrary user data
 // directly in redis. This is useful if more complicated, lower level operations
-// are needed to be done
+// are needed to be done. The user is normalized first, see NormalizeUsername
 func (s *System) Key(user string, extra ...string) string {
+	user = s.normalize(user)
 	k := "user:{" + user + "}"
+	if p := s.prefix(); p != "" {
+		k = "user:" + p + ":{" + user + "}"
+	}
 	if len(extra) > 0 {
 		k += ":" + strings.Join(extra, ":")
 	}
@@ -203,20 +354,80 @@ func unmarshalTime(ts string) (time.Time, error) {
 	return t.UTC(), err
 }
 
-// Create attempts to create a new user with the given email and password. If
-// the user already exists ErrUserExists will be returned. If not the password
-// will be hashed and stored
-func (s *System) Create(user, email, password string) error {
+// CacheChannel returns the pub/sub channel which changed users are published
+// to when Cache is set, see the Cache field
+func (s *System) CacheChannel() string {
+	if p := s.prefix(); p != "" {
+		return "user:" + p + ":cache"
+	}
+	return "user:cache"
+}
+
+// uncache invalidates the given user in Cache, if it's set
+func (s *System) uncache(user string) {
+	if s.Cache != nil {
+		s.Cache.Invalidate(s.c, s.CacheChannel(), s.normalize(user))
+	}
+}
+
+// bannedKey returns the key of the set holding the usernames banned using Ban
+func (s *System) bannedKey() string {
+	if p := s.prefix(); p != "" {
+		return "user:" + p + ":banned"
+	}
+	return "user:banned"
+}
+
+// Ban prevents a user with the given name from being created in the future, in
+// addition to those in BannedUsernames. It has no effect on an existing user
+// with that name, see Disable and Delete for that
+func (s *System) Ban(username string) error {
+	return s.c.Cmd("SADD", s.bannedKey(), s.normalize(username)).Err
+}
+
+// Unban undoes a previous call to Ban. It has no effect on BannedUsernames
+func (s *System) Unban(username string) error {
+	return s.c.Cmd("SREM", s.bannedKey(), s.normalize(username)).Err
+}
+
+// Banned returns all usernames which have been banned using Ban, in no
+// particular order, as normalized by NormalizeUsername. It does not include
+// BannedUsernames
+func (s *System) Banned() ([]string, error) {
+	return s.c.Cmd("SMEMBERS", s.bannedKey()).List()
+}
+
+// checkBanned returns ErrInvalidUsername if the username is in BannedUsernames or
+// was banned using Ban
+func (s *System) checkBanned(user string) error {
 	for _, bannedUser := range s.BannedUsernames {
-		if bannedUser == user {
+		if s.normalize(bannedUser) == s.normalize(user) {
 			return ErrInvalidUsername
 		}
 	}
+	if banned, err := s.c.Cmd("SISMEMBER", s.bannedKey(), s.normalize(user)).Int(); err != nil {
+		return err
+	} else if banned == 1 {
+		return ErrInvalidUsername
+	}
+	return nil
+}
+
+// Create attempts to create a new user with the given email and password. If
+// the user already exists ErrUserExists will be returned. If the username is in
+// BannedUsernames or was banned using Ban ErrInvalidUsername will be returned,
+// and if another user has the email ErrEmailTaken will be. If not the password
+// will be hashed and stored, and the user added to the index used by
+// GetByEmail
+func (s *System) Create(user, email, password string) error {
+	if err := s.checkBanned(user); err != nil {
+		return err
+	}
 
 	key := s.Key(user)
 	nowS := marshalTime(time.Now())
 
-	hash, err := s.generatePassword(password)
+	hash, err := s.hashPassword(password)
 	if err != nil {
 		return err
 	}
@@ -233,31 +444,43 @@ func (s *System) Create(user, email, password string) error {
 		return err
 	}
 
-	i, err := util.LuaEval(s.c, hmsetnx, 1, args...).Int()
+	claimed, err := s.indexEmail(user, email, "")
 	if err != nil {
 		return err
-	} else if i == 0 {
-		return ErrUserExists
 	}
-	return nil
-}
-
-func (s *System) generatePassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.BCryptCost)
+	i, err := util.LuaEval(s.c, hmsetnx, 1, args...).Int()
+	if err == nil && i == 0 {
+		err = ErrUserExists
+	}
 	if err != nil {
-		return "", err
+		// If this fails the stale claim is taken over by the next user to
+		// want the email, so the original error is the one to return
+		if claimed {
+			s.unindexEmail(user, email)
+		}
+		return err
 	}
-	return hex.EncodeToString(hash), nil
+	if err := s.mirror(user, Info{"Name": user, "Email": email}); err != nil {
+		return err
+	}
+	events.PublishOrLog(s.Events, events.UserCreated, map[string]string{"user": user})
+	s.publish(EventCreated, user)
+	return nil
 }
 
-// ChangePassword changes an existing user's password to be the given one
+// ChangePassword changes an existing user's password to be the given one. All
+// of the user's sessions are revoked, see RevokeAll
 func (s *System) ChangePassword(user, newPassword string) error {
-	hash, err := s.generatePassword(newPassword)
+	hash, err := s.hashPassword(newPassword)
 	if err != nil {
 		return err
 	}
 
-	return s.setExists(user, "PasswordHash", hash)
+	if err := s.setExists(user, "PasswordHash", hash); err != nil {
+		return err
+	}
+	s.publish(EventModified, user, "PasswordHash")
+	return s.RevokeAll(user)
 }
 
 func (s *System) set(user string, keyvals ...interface{}) error {
@@ -268,7 +491,11 @@ func (s *System) set(user string, keyvals ...interface{}) error {
 		return err
 	}
 
-	return s.c.Cmd("HMSET", args...).Err
+	if err := s.c.Cmd("HMSET", args...).Err; err != nil {
+		return err
+	}
+	s.uncache(user)
+	return nil
 }
 
 // same as set, but only if the user exists and is not disabled. Returns
@@ -291,6 +518,7 @@ func (s *System) setExists(user string, keyvals ...interface{}) error {
 	} else if i == -1 {
 		return ErrDisabled
 	}
+	s.uncache(user)
 	return nil
 }
 
@@ -346,42 +574,116 @@ func (s *System) unset(user string, fields ...string) error {
 	} else if i == 0 {
 		return ErrNotFound
 	}
+	s.uncache(user)
 	return nil
 }
 
 // Authenticate attempts to authenticate the user with the given password.
-// Returns nil on success. Can return ErrDisabled or ErrBadAuth
+// Returns nil on success, after recording the time in the user's LastLoggedIn
+// field (see SkipLastLoggedIn). Can return ErrDisabled, ErrBadAuth, or
+// ErrTooManyAttempts if authenticating as the user has failed too many times
+// recently (see MaxAttempts)
 func (s *System) Authenticate(user, password string) error {
-	u, err := s.Get(user, Hidden|Private)
-	if err != nil {
+	return s.AuthenticateFrom(user, password, "")
+}
+
+// AuthenticateFrom is like Authenticate, but also counts failures against the
+// given ip (the client's), returning ErrTooManyAttempts if there have been too
+// many from it recently (see MaxIPAttempts). Attempts for users which don't
+// exist count against the ip as well
+func (s *System) AuthenticateFrom(user, password, ip string) error {
+	if err := s.reserveAttempts(user, ip); err != nil {
 		return err
 	}
 
+	// The Cache isn't used, so that password changes and disabling take effect
+	// right away everywhere
+	m, err := s.getRaw(user)
+	if err == ErrNotFound {
+		// Only the ip is counted against for users which don't exist
+		if err := s.releaseAttempt(s.attemptsKey(user), s.MaxAttempts); err != nil {
+			return err
+		}
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	u := s.infoFromRaw(m, Hidden|Private)
+
 	if u["Disabled"] != "" {
+		if err := s.releaseAttempts(user, ip); err != nil {
+			return err
+		}
 		return ErrDisabled
 	}
 
-	p, err := hex.DecodeString(u["PasswordHash"])
+	match, rehash, err := s.checkPassword(u["PasswordHash"], password)
 	if err != nil {
 		return err
+	} else if !match {
+		return ErrBadAuth
 	}
 
-	match := bcrypt.CompareHashAndPassword([]byte(p), []byte(password)) == nil
-	if !match {
-		return ErrBadAuth
+	// Only the user's failures are forgotten on success, otherwise one ip
+	// could keep guessing other users' passwords by logging into its own
+	// account in between. With SkipLastLoggedIn they're left to expire
+	// instead, and only this attempt is released
+	if s.SkipLastLoggedIn {
+		if err := s.releaseAttempts(user, ip); err != nil {
+			return err
+		}
+	} else {
+		if ip != "" {
+			if err := s.releaseAttempt(s.ipAttemptsKey(ip), s.MaxIPAttempts); err != nil {
+				return err
+			}
+		}
+		if s.MaxAttempts > 0 {
+			if err := s.ResetAttempts(user); err != nil {
+				return err
+			}
+		}
+	}
+
+	if rehash && !s.SkipRehash {
+		if err := s.rehashPassword(user, u["PasswordHash"], password); err != nil {
+			return err
+		}
+	}
+	if s.SkipLastLoggedIn {
+		return nil
 	}
+	return s.setQuiet(user, "LastLoggedIn", marshalTime(time.Now()))
+}
+
+// setQuiet sets one of the user's fields without changing TSModified, as the
+// user isn't being modified by them. It does nothing if the user doesn't exist
+// (e.g. has been deleted)
+func (s *System) setQuiet(user, field, value string) error {
+	_, err := util.LuaEval(s.c, hsetdelxx, 1,
+		s.Key(user), s.fields["Name"].Key, s.fields[field].Key, value,
+	).Int()
+	if err != nil {
+		return err
+	}
+	s.uncache(user)
 	return nil
 }
 
-func (s *System) getFromResp(r *redis.Resp, filters FieldFlag) (Info, error) {
-	m, err := r.Map()
+// getRaw returns the user's hash as it's stored in redis, or ErrNotFound
+func (s *System) getRaw(user string) (map[string]string, error) {
+	m, err := s.c.Cmd("HGETALL", s.Key(user)).Map()
 	if err != nil {
 		return nil, err
-	}
-	if len(m) == 0 {
+	} else if len(m) == 0 {
 		return nil, ErrNotFound
 	}
+	return m, nil
+}
 
+// infoFromRaw returns the Info for a user's hash, as returned by getRaw, with
+// only the fields allowed by the given filters
+func (s *System) infoFromRaw(m map[string]string, filters FieldFlag) Info {
 	rm := Info{}
 	for f := range s.fields {
 		filt := s.fields[f].Flags
@@ -390,35 +692,182 @@ func (s *System) getFromResp(r *redis.Resp, filters FieldFlag) (Info, error) {
 		}
 		rm[f] = m[s.fields[f].Key]
 	}
-	return rm, nil
+	return rm
 }
 
 // Get returns the Info for the given user, or ErrNotFound if the user couldn't
 // be found
 func (s *System) Get(user string, filters FieldFlag) (Info, error) {
-	key := s.Key(user)
-	return s.getFromResp(s.c.Cmd("HGETALL", key), filters)
+	var gen uint64
+	if s.Cache != nil {
+		if m, ok := s.Cache.Get(s.normalize(user)); ok {
+			return s.infoFromRaw(m.(map[string]string), filters), nil
+		}
+		gen = s.Cache.Gen(s.normalize(user))
+	}
+
+	m, err := s.getRaw(user)
+	if err != nil {
+		return nil, err
+	}
+	if s.Cache != nil {
+		s.Cache.SetIfUnchanged(s.normalize(user), gen, m)
+	}
+	return s.infoFromRaw(m, filters), nil
+}
+
+// GetMulti is like Get, but gets the Info of many users at once. Users which
+// aren't cached are all fetched in a single round trip to redis (or one per
+// node when using cluster), rather than one each. The returned map is keyed by
+// the given usernames, and users which couldn't be found aren't in it
+func (s *System) GetMulti(users []string, filters FieldFlag) (map[string]Info, error) {
+	m := make(map[string]Info, len(users))
+	seen := make(map[string]bool, len(users))
+	missed := make([]string, 0, len(users))
+	gens := make([]uint64, 0, len(users))
+	cmds := make([]common.PipeCmd, 0, len(users))
+	for _, user := range users {
+		if seen[user] {
+			continue
+		}
+		seen[user] = true
+
+		if s.Cache != nil {
+			if raw, ok := s.Cache.Get(s.normalize(user)); ok {
+				m[user] = s.infoFromRaw(raw.(map[string]string), filters)
+				continue
+			}
+			gens = append(gens, s.Cache.Gen(s.normalize(user)))
+		}
+		missed = append(missed, user)
+		cmds = append(cmds, common.PipeCmd{Cmd: "HGETALL", Args: []interface{}{s.Key(user)}})
+	}
+
+	for i, r := range common.Pipe(s.c, cmds) {
+		raw, err := r.Map()
+		if err != nil {
+			return nil, err
+		} else if len(raw) == 0 {
+			continue
+		}
+		if s.Cache != nil {
+			s.Cache.SetIfUnchanged(s.normalize(missed[i]), gens[i], raw)
+		}
+		m[missed[i]] = s.infoFromRaw(raw, filters)
+	}
+	return m, nil
 }
 
 // Disable marks the user as being disabled, meaning they have effectively
 // deleted their account without actually deleting any data. They cannot log in
-// and do not show up anywhere
+// and do not show up anywhere, and all of their sessions are revoked
 func (s *System) Disable(user string) error {
-	return s.set(user, "Disabled", "1")
+	if err := s.set(user, "Disabled", "1"); err != nil {
+		return err
+	}
+	s.publish(EventDisabled, user)
+	if err := s.RevokeAll(user); err != nil {
+		return err
+	}
+	return s.unmirror(user)
 }
 
 // Enable marks the user as having an account enabled. Accounts are enabled by
 // default when created, this only really has an effect when an accound was
 // previously Disable'd
 func (s *System) Enable(user string) error {
-	return s.unset(user, "Disabled")
+	if err := s.unset(user, "Disabled"); err != nil {
+		return err
+	}
+	s.publish(EventModified, user, "Disabled")
+	if len(s.SearchFields) == 0 {
+		return nil
+	}
+	i, err := s.Get(user, Private)
+	if err != nil {
+		return err
+	}
+	return s.mirror(user, i)
+}
+
+// escapeMatch escapes the characters in the given string which are special in
+// SCAN's MATCH patterns, so the string only matches itself
+func escapeMatch(str string) string {
+	var b strings.Builder
+	for _, r := range str {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Delete removes all data for the given user, after which a user with the same
+// name may be created again. This includes every key of the form
+// Key(user, ...), so data which was stored alongside the user using Key is
+// removed as well. Returns ErrNotFound if the user doesn't exist.
+//
+// Finding those keys requires a SCAN of the whole keyspace (of every node, when
+// using cluster). If Delete fails part way through the user still exists, so it
+// can be called again to finish
+func (s *System) Delete(user string) error {
+	key := s.Key(user)
+	m, err := s.getRaw(user)
+	if err != nil {
+		return err
+	}
+
+	extra, err := s.extraKeys(user)
+	if err != nil {
+		return err
+	}
+	for _, k := range extra {
+		if err := s.c.Cmd("DEL", k).Err; err != nil {
+			return err
+		}
+	}
+
+	// The user hash is deleted last, so the user isn't considered gone until
+	// everything else is
+	i, err := s.c.Cmd("DEL", key).Int()
+	if err != nil {
+		return err
+	} else if i == 0 {
+		return ErrNotFound
+	}
+	s.uncache(user)
+	s.publish(EventDeleted, user)
+	if err := s.unindexEmail(user, m[s.fields["Email"].Key]); err != nil {
+		return err
+	}
+	return s.unmirror(user)
 }
 
 // Set is used to manually modify a user's fields. The Info argument need only
 // be filled with the fields which are desired to be changed. All fields given
-// in that argument must be Editable.
+// in that argument must be Editable, and the values of fields with a Type other
+// than TypeString must be valid for their Type (or empty, to unset them), else
+// ErrFieldInvalid is returned. Changing the user's Email marks it as not being
+// verified, and returns ErrEmailTaken if another user has the new one
 func (s *System) Set(user string, i Info) error {
-	keyvals := make([]interface{}, 0, len(i)*2)
+	keyvals := make([]interface{}, 0, len(i)*2+2)
+	set := make(Info, len(i))
+	changed := make([]string, 0, len(i)+1)
+	email, emailSet := i["Email"]
+	var oldEmail string
+	if emailSet {
+		m, err := s.getRaw(user)
+		if err != nil {
+			return err
+		}
+		oldEmail = m[s.fields["Email"].Key]
+		if oldEmail != email {
+			keyvals = append(keyvals, "Verified", "")
+			changed = append(changed, "Verified")
+		}
+	}
 	for fieldName, value := range i {
 		flags := s.fields[fieldName].Flags
 
@@ -429,8 +878,38 @@ func (s *System) Set(user string, i Info) error {
 			return ErrFieldUneditable(fieldName)
 		}
 
+		t := s.fields[fieldName].Type
+		value, ok := normalizeValue(t, value)
+		if !ok {
+			return ErrFieldInvalid(fieldName, t)
+		}
+		set[fieldName] = value
+		changed = append(changed, fieldName)
+
 		keyvals = append(keyvals, fieldName, value)
 	}
 
-	return s.setExists(user, keyvals...)
+	var claimed bool
+	if emailSet {
+		var err error
+		if claimed, err = s.indexEmail(user, email, ""); err != nil {
+			return err
+		}
+	}
+	if err := s.setExists(user, keyvals...); err != nil {
+		if claimed {
+			s.unindexEmail(user, email)
+		}
+		return err
+	}
+	sort.Strings(changed)
+	s.publish(EventModified, user, changed...)
+	if emailSet {
+		if !strings.EqualFold(oldEmail, email) {
+			if err := s.unindexEmail(user, oldEmail); err != nil {
+				return err
+			}
+		}
+	}
+	return s.mirror(user, set)
 }
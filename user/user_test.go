@@ -1,20 +1,24 @@
 package user
 
 import (
+	"strings"
 	. "testing"
 	"time"
 
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/common/cache"
 	"github.com/mediocregopher/mediocre-api/common/commontest"
-	"github.com/mediocregopher/radix.v2/pool"
+	"github.com/mediocregopher/radix.v2/redis"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func testSystem(t *T) *System {
-	p, err := pool.New("tcp", "localhost:6379", 10)
-	require.Nil(t, err)
+	p := commontest.APIStarterKit()
 
-	return New(p)
+	s := New(p)
+	s.Prefix = commontest.KeyPrefix(t, p)
+	return s
 }
 
 func randUser(t *T, s *System) (string, string, string) {
@@ -156,6 +160,79 @@ func TestAuthenticate(t *T) {
 	assert.Equal(t, ErrNotFound, err)
 }
 
+func TestLastLoggedIn(t *T) {
+	s := testSystem(t)
+	user, _, password := randUser(t, s)
+
+	i, err := s.Get(user, Private)
+	require.Nil(t, err)
+	assert.Equal(t, "", i["LastLoggedIn"])
+
+	// Only successful authentications are recorded, and they don't count as
+	// modifying the user
+	require.Nil(t, s.Authenticate(user, password))
+	i2, err := s.Get(user, Private)
+	require.Nil(t, err)
+	last, err := unmarshalTime(i2["LastLoggedIn"])
+	require.Nil(t, err)
+	assert.WithinDuration(t, time.Now(), last, 5*time.Second)
+	assert.Equal(t, i["TSModified"], i2["TSModified"])
+
+	assert.Equal(t, ErrBadAuth, s.Authenticate(user, password+"bogus"))
+	i3, err := s.Get(user, Private)
+	require.Nil(t, err)
+	assert.Equal(t, i2["LastLoggedIn"], i3["LastLoggedIn"])
+
+	// It's not public
+	i, err = s.Get(user, Public)
+	require.Nil(t, err)
+	_, ok := i["LastLoggedIn"]
+	assert.False(t, ok)
+
+	s2 := testSystem(t)
+	s2.SkipLastLoggedIn = true
+	user, _, password = randUser(t, s2)
+	require.Nil(t, s2.Authenticate(user, password))
+	i, err = s2.Get(user, Private)
+	require.Nil(t, err)
+	assert.Equal(t, "", i["LastLoggedIn"])
+
+	// Failed attempts aren't reset either, so that nothing is written
+	assert.Equal(t, ErrBadAuth, s2.Authenticate(user, password+"bogus"))
+	require.Nil(t, s2.Authenticate(user, password))
+	n, err := s2.Attempts(user)
+	require.Nil(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestNormalizeUsername(t *T) {
+	s := testSystem(t)
+	s.NormalizeUsername = strings.ToLower
+	user := "Alice" + commontest.RandStr()
+	lower := strings.ToLower(user)
+	password := commontest.RandStr()
+
+	require.Nil(t, s.Create(user, commontest.RandStr(), password))
+	assert.Equal(t, ErrUserExists, s.Create(lower, commontest.RandStr(), password))
+
+	// The Name keeps the casing given to Create
+	for _, u := range []string{user, lower, strings.ToUpper(user)} {
+		i, err := s.Get(u, Public)
+		require.Nil(t, err)
+		assert.Equal(t, user, i["Name"])
+		assert.Nil(t, s.Authenticate(u, password))
+	}
+
+	banned := "Bob" + commontest.RandStr()
+	require.Nil(t, s.Ban(banned))
+	assert.Equal(t, ErrInvalidUsername, s.Create(strings.ToLower(banned), commontest.RandStr(), password))
+	assert.Equal(t, ErrInvalidUsername, s.Create("ROOT", commontest.RandStr(), password))
+
+	require.Nil(t, s.Delete(lower))
+	_, err := s.Get(user, Public)
+	assert.Equal(t, ErrNotFound, err)
+}
+
 func TestChangePassword(t *T) {
 	s := testSystem(t)
 	user, _, password := randUser(t, s)
@@ -194,6 +271,66 @@ func TestDisable(t *T) {
 	assert.Nil(t, err)
 }
 
+func TestDelete(t *T) {
+	s := testSystem(t)
+	user, email, password := randUser(t, s)
+
+	require.Nil(t, s.Delete(user))
+	_, err := s.Get(user, Public)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, ErrNotFound, s.Delete(user))
+
+	// The name can be used again once deleted
+	assert.Nil(t, s.Create(user, email, password))
+}
+
+func TestDeleteKeys(t *T) {
+	s := testSystem(t)
+	base := commontest.RandStr()
+	user, other := base+"*", base+"x"
+	for _, u := range []string{user, other} {
+		require.Nil(t, s.Create(u, commontest.RandStr(), commontest.RandStr()))
+		require.Nil(t, s.c.Cmd("SET", s.Key(u, "foo"), "1").Err)
+		require.Nil(t, s.c.Cmd("SET", s.Key(u, "bar", "baz"), "1").Err)
+	}
+
+	require.Nil(t, s.Delete(user))
+	for _, k := range []string{s.Key(user), s.Key(user, "foo"), s.Key(user, "bar", "baz")} {
+		i, err := s.c.Cmd("EXISTS", k).Int()
+		require.Nil(t, err)
+		assert.Equal(t, 0, i, "key: %s", k)
+	}
+
+	// Only the deleted user's keys are removed, even though its name would
+	// match the other's as a pattern
+	for _, k := range []string{s.Key(other), s.Key(other, "foo"), s.Key(other, "bar", "baz")} {
+		i, err := s.c.Cmd("EXISTS", k).Int()
+		require.Nil(t, err)
+		assert.Equal(t, 1, i, "key: %s", k)
+	}
+}
+
+func TestBan(t *T) {
+	s := testSystem(t)
+	user := commontest.RandStr()
+
+	banned, err := s.Banned()
+	require.Nil(t, err)
+	assert.Empty(t, banned)
+
+	require.Nil(t, s.Ban(user))
+	banned, err = s.Banned()
+	require.Nil(t, err)
+	assert.Equal(t, []string{user}, banned)
+	assert.Equal(t, ErrInvalidUsername, s.Create(user, "email", "password"))
+
+	require.Nil(t, s.Unban(user))
+	banned, err = s.Banned()
+	require.Nil(t, err)
+	assert.Empty(t, banned)
+	assert.Nil(t, s.Create(user, "email", "password"))
+}
+
 func TestSet(t *T) {
 	s := testSystem(t)
 	s.AddField(Field{Name: "foo", Flags: Public})
@@ -219,3 +356,132 @@ func TestSet(t *T) {
 	require.Nil(t, err)
 	assert.Equal(t, "bar1", u["bar"])
 }
+
+func TestCache(t *T) {
+	s := testSystem(t)
+	s.Cache = cache.New(10, time.Minute)
+	user, email, password := randUser(t, s)
+
+	pi, err := s.Get(user, Private)
+	require.Nil(t, err)
+	assert.Equal(t, email, pi["Email"])
+
+	// Changes made behind the System's back aren't seen while cached, except
+	// by Authenticate
+	require.Nil(t, s.c.Cmd("HSET", s.Key(user), s.fields["Disabled"].Key, "1").Err)
+	pi, err = s.Get(user, Private)
+	require.Nil(t, err)
+	assert.Equal(t, "", pi["Disabled"])
+	assert.Equal(t, ErrDisabled, s.Authenticate(user, password))
+
+	require.Nil(t, s.Enable(user))
+	email2 := commontest.RandEmail()
+	require.Nil(t, s.Set(user, Info{"Email": email2}))
+	pi, err = s.Get(user, Private)
+	require.Nil(t, err)
+	assert.Equal(t, email2, pi["Email"])
+
+	require.Nil(t, s.Delete(user))
+	_, err = s.Get(user, Private)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+// changeDuringRead is a Cmder which calls change right after the first HGETALL
+// made through it has been read, but before it's returned
+type changeDuringRead struct {
+	common.Cmder
+	change func()
+}
+
+func (c *changeDuringRead) Cmd(cmd string, args ...interface{}) *redis.Resp {
+	r := c.Cmder.Cmd(cmd, args...)
+	if cmd == "HGETALL" && c.change != nil {
+		change := c.change
+		c.change = nil
+		change()
+	}
+	return r
+}
+
+func TestCacheChangeDuringRead(t *T) {
+	s := testSystem(t)
+	s.Cache = cache.New(10, time.Minute)
+	user, email, _ := randUser(t, s)
+	email2 := commontest.RandEmail()
+
+	// A Set which happens while the user is being read means what was read
+	// isn't cached, for both Get and GetMulti
+	c := &changeDuringRead{Cmder: s.c}
+	s.c = c
+	c.change = func() { require.Nil(t, s.Set(user, Info{"Email": email2})) }
+	i, err := s.Get(user, Private)
+	require.Nil(t, err)
+	assert.Equal(t, email, i["Email"])
+	i, err = s.Get(user, Private)
+	require.Nil(t, err)
+	assert.Equal(t, email2, i["Email"])
+
+	s.Cache.Delete(s.normalize(user))
+	c.change = func() { require.Nil(t, s.Set(user, Info{"Email": email})) }
+	m, err := s.GetMulti([]string{user}, Private)
+	require.Nil(t, err)
+	assert.Equal(t, email2, m[user]["Email"])
+	m, err = s.GetMulti([]string{user}, Private)
+	require.Nil(t, err)
+	assert.Equal(t, email, m[user]["Email"])
+}
+
+func TestGetMulti(t *T) {
+	s := testSystem(t)
+	user1, email1, _ := randUser(t, s)
+	user2, email2, _ := randUser(t, s)
+	userDNE := commontest.RandStr()
+
+	m, err := s.GetMulti(nil, Private)
+	require.Nil(t, err)
+	assert.Empty(t, m)
+
+	m, err = s.GetMulti([]string{user1, userDNE, user2, user1}, Private)
+	require.Nil(t, err)
+	assert.Len(t, m, 2)
+	assert.Equal(t, email1, m[user1]["Email"])
+	assert.Equal(t, email2, m[user2]["Email"])
+	i, err := s.Get(user1, Private)
+	require.Nil(t, err)
+	assert.Equal(t, i, m[user1])
+
+	// Filters apply the same as with Get
+	m, err = s.GetMulti([]string{user1}, Public)
+	require.Nil(t, err)
+	assert.NotContains(t, m[user1], "Email")
+
+	// Cached users are mixed in with those fetched
+	s.Cache = cache.New(10, time.Minute)
+	_, err = s.Get(user1, Private)
+	require.Nil(t, err)
+	m, err = s.GetMulti([]string{user1, user2}, Private)
+	require.Nil(t, err)
+	assert.Equal(t, email1, m[user1]["Email"])
+	assert.Equal(t, email2, m[user2]["Email"])
+	_, ok := s.Cache.Get(s.normalize(user2))
+	assert.True(t, ok)
+}
+
+func TestTenant(t *T) {
+	s1, s2 := testSystem(t), testSystem(t)
+	s2.Prefix, s2.Tenant = s1.Prefix, commontest.RandStr()
+
+	user, email, _ := randUser(t, s1)
+	_, err := s2.Get(user, Private)
+	assert.Equal(t, ErrNotFound, err)
+
+	// The same name can be used in each tenant
+	email2 := commontest.RandStr()
+	require.Nil(t, s2.Create(user, email2, commontest.RandStr()))
+	i, err := s1.Get(user, Private)
+	require.Nil(t, err)
+	assert.Equal(t, email, i["Email"])
+	i, err = s2.Get(user, Private)
+	require.Nil(t, err)
+	assert.Equal(t, email2, i["Email"])
+}
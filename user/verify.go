@@ -0,0 +1,129 @@
+package user
+
+import (
+	"bytes"
+	"encoding/base64"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/auth/sig"
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/radix.v2/util"
+)
+
+// Errors which can be expected when verifying emails
+var (
+	ErrSecretNotSet       = common.ExpectedErr{Code: 500, ID: "secret_not_set", Err: "secret not set on server"}
+	ErrInvalidVerifyToken = common.ExpectedErr{Code: 400, ID: "invalid_verify_token", Err: "invalid or expired verification token"}
+)
+
+var verifyB64 = base64.RawURLEncoding
+
+// verifyTag is the first part of every verify token's data, so that they can't
+// be mistaken for any other kind of token signed with the same Secret. It isn't
+// valid padded base64, so usertok can't extract a user from a verify token
+// either
+const verifyTag = "verify"
+
+// NewVerifyToken returns a token which can be given to VerifyEmail to mark the
+// given user's current email as verified, e.g. by sending it to that email in a
+// link using notify.VerifyEmail. The token is signed using Secret, and expires
+// after VerifyTimeout. It's only valid for the email the user has when it's
+// generated, so changing the email invalidates any tokens already sent. Returns
+// ErrNotFound or ErrDisabled if the user doesn't exist or is disabled
+func (s *System) NewVerifyToken(user string) (string, error) {
+	if s.Secret == nil {
+		return "", ErrSecretNotSet
+	}
+	m, err := s.getRaw(user)
+	if err != nil {
+		return "", err
+	}
+	i := s.infoFromRaw(m, Private)
+	if i["Disabled"] != "" {
+		return "", ErrDisabled
+	}
+
+	data := bytes.Join([][]byte{
+		[]byte(verifyTag),
+		[]byte(verifyB64.EncodeToString([]byte(s.Tenant))),
+		[]byte(verifyB64.EncodeToString([]byte(s.normalize(user)))),
+		[]byte(verifyB64.EncodeToString([]byte(i["Email"]))),
+	}, []byte(":"))
+	return sig.New(data, s.Secret, s.VerifyTimeout), nil
+}
+
+// verifyEmail key nameField disabledField emailField email field value [field value...]
+// Calls HMSET, but only if nameField is set on the hash, disabledField isn't,
+// and emailField has the value email. Returns 1 if the set was successful, 0
+// if the hash has no nameField, -1 if it has disabledField, and -2 if
+// emailField has some other value
+var verifyEmail = `
+	if not redis.call('HGET', KEYS[1], ARGV[1]) then
+		return 0
+	end
+	if redis.call('HGET', KEYS[1], ARGV[2]) then
+		return -1
+	end
+	if redis.call('HGET', KEYS[1], ARGV[3]) ~= ARGV[4] then
+		return -2
+	end
+	for i=5,#ARGV,2 do
+		redis.call('HSET', KEYS[1], ARGV[i], ARGV[i+1])
+	end
+	return 1
+`
+
+// VerifyEmail checks that the given token was returned from NewVerifyToken for
+// the given user and their current email, and hasn't expired, and if so sets
+// the user's Verified field to the current time. Returns ErrInvalidVerifyToken
+// if the token isn't valid
+func (s *System) VerifyEmail(user, token string) error {
+	if s.Secret == nil {
+		return ErrSecretNotSet
+	}
+	parts := bytes.Split(sig.Extract(token, s.Secret), []byte(":"))
+	if len(parts) != 4 || string(parts[0]) != verifyTag {
+		return ErrInvalidVerifyToken
+	}
+	var dec [3]string
+	for i := range dec {
+		b, err := verifyB64.DecodeString(string(parts[i+1]))
+		if err != nil {
+			return ErrInvalidVerifyToken
+		}
+		dec[i] = string(b)
+	}
+	if dec[0] != s.Tenant || dec[1] != s.normalize(user) {
+		return ErrInvalidVerifyToken
+	}
+
+	args := []interface{}{
+		s.Key(user),
+		s.fields["Name"].Key,
+		s.fields["Disabled"].Key,
+		s.fields["Email"].Key,
+		dec[2],
+	}
+	args, err := s.appendKeyvalsToArgs([]interface{}{
+		"Verified", marshalTime(time.Now()),
+	}, args)
+	if err != nil {
+		return err
+	}
+
+	i, err := util.LuaEval(s.c, verifyEmail, 1, args...).Int()
+	if err != nil {
+		return err
+	}
+	switch i {
+	case 0:
+		return ErrNotFound
+	case -1:
+		return ErrDisabled
+	case -2:
+		return ErrInvalidVerifyToken
+	}
+	s.uncache(user)
+	s.publish(EventModified, user, "Verified")
+	return nil
+}
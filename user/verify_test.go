@@ -0,0 +1,96 @@
+package user
+
+import (
+	"strings"
+	. "testing"
+	"time"
+
+	"github.com/mediocregopher/mediocre-api/auth/usertok"
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func assertVerified(t *T, s *System, user string, verified bool) {
+	i, err := s.Get(user, Private)
+	require.Nil(t, err)
+	assert.Equal(t, verified, i["Verified"] != "", "verified: %q", i["Verified"])
+}
+
+func TestVerifyEmail(t *T) {
+	s := testSystem(t)
+	user, _, _ := randUser(t, s)
+
+	_, err := s.NewVerifyToken(user)
+	assert.Equal(t, ErrSecretNotSet, err)
+	s.Secret = []byte("secret")
+
+	_, err = s.NewVerifyToken(commontest.RandStr())
+	assert.Equal(t, ErrNotFound, err)
+
+	tok, err := s.NewVerifyToken(user)
+	require.Nil(t, err)
+	assertVerified(t, s, user, false)
+
+	assert.Equal(t, ErrInvalidVerifyToken, s.VerifyEmail(user, "blah blah blah"))
+	assert.Equal(t, ErrInvalidVerifyToken, s.VerifyEmail(commontest.RandStr(), tok))
+	assertVerified(t, s, user, false)
+
+	require.Nil(t, s.VerifyEmail(user, tok))
+	assertVerified(t, s, user, true)
+
+	// Setting the same email leaves it verified, changing it doesn't, and
+	// tokens for the old email are no longer valid
+	i, err := s.Get(user, Private)
+	require.Nil(t, err)
+	require.Nil(t, s.Set(user, Info{"Email": i["Email"]}))
+	assertVerified(t, s, user, true)
+	require.Nil(t, s.Set(user, Info{"Email": commontest.RandStr()}))
+	assertVerified(t, s, user, false)
+	assert.Equal(t, ErrInvalidVerifyToken, s.VerifyEmail(user, tok))
+
+	// Tokens expire
+	s.VerifyTimeout = time.Second
+	tok, err = s.NewVerifyToken(user)
+	require.Nil(t, err)
+	time.Sleep(1100 * time.Millisecond)
+	assert.Equal(t, ErrInvalidVerifyToken, s.VerifyEmail(user, tok))
+
+	tok, err = s.NewVerifyToken(user)
+	require.Nil(t, err)
+	require.Nil(t, s.Disable(user))
+	assert.Equal(t, ErrDisabled, s.VerifyEmail(user, tok))
+	_, err = s.NewVerifyToken(user)
+	assert.Equal(t, ErrDisabled, err)
+}
+
+func TestVerifyTokenKinds(t *T) {
+	s := testSystem(t)
+	s.Secret = []byte("secret")
+	user, _, _ := randUser(t, s)
+
+	// Neither user tokens nor verify tokens can be used as the other, even
+	// when signed with the same secret
+	utok := usertok.NewWithSession(s.Tenant, user, commontest.RandStr(), s.Secret)
+	assert.Equal(t, ErrInvalidVerifyToken, s.VerifyEmail(user, utok))
+	tok, err := s.NewVerifyToken(user)
+	require.Nil(t, err)
+	tenant, u, session := usertok.ExtractSession(tok, s.Secret)
+	assert.Equal(t, "", tenant)
+	assert.Equal(t, "", u)
+	assert.Equal(t, "", session)
+}
+
+func TestVerifyEmailNormalized(t *T) {
+	s := testSystem(t)
+	s.Secret = []byte("secret")
+	s.NormalizeUsername = strings.ToLower
+	user := "Alice" + commontest.RandStr()
+	require.Nil(t, s.Create(user, commontest.RandStr(), commontest.RandStr()))
+
+	// A token for any casing of the name works for any other
+	tok, err := s.NewVerifyToken(strings.ToUpper(user))
+	require.Nil(t, err)
+	require.Nil(t, s.VerifyEmail(user, tok))
+	assertVerified(t, s, user, true)
+}
@@ -0,0 +1,203 @@
+// Package votes implements per-user up and down votes on arbitrary IDs (e.g.
+// rooms, broadcasts, or comments), stored in redis. Voting is idempotent, each
+// user has at most one vote on each ID, and changing it is atomic
+package votes
+
+import (
+	"strings"
+
+	"github.com/mediocregopher/mediocre-api/common"
+	"github.com/mediocregopher/mediocre-api/user"
+	"github.com/mediocregopher/radix.v2/util"
+)
+
+// ErrInvalidVote is returned when voting with a Vote other than Up, Down, or
+// None
+var ErrInvalidVote = common.ExpectedErr{Code: 400, ID: "invalid_vote", Err: "invalid vote"}
+
+// Vote is a single user's vote on an ID
+type Vote int
+
+// All possible Votes. None means the user hasn't voted, and voting None removes
+// any vote the user had
+const (
+	Down Vote = -1
+	None Vote = 0
+	Up   Vote = 1
+)
+
+// Tally is the number of up and down votes on an ID
+type Tally struct {
+	Up, Down int64
+}
+
+// Score returns the number of up votes minus the number of down votes
+func (t Tally) Score() int64 {
+	return t.Up - t.Down
+}
+
+// System holds on to a Cmder and uses it to implement a voting system
+type System struct {
+	c common.Cmder
+	o *Opts
+}
+
+// Opts are different options which may be passed into New when creating a
+// system. They all have sane defaults which will cover most use cases
+type Opts struct {
+
+	// Prefix can be used if you wish to have two separate vote systems being
+	// persisted on the same Cmder. Prefix will be part of a string prepended to
+	// all key names
+	Prefix string
+
+	// If set, only users which exist in this user System and aren't disabled
+	// can vote. Vote returns user.ErrNotFound or user.ErrDisabled for any
+	// others. Removing a vote is always allowed
+	Users *user.System
+}
+
+// New returns a new System which will use the given Cmder as its persistence
+// layer. The passed in Opts may be used to modify behavior of the System, or
+// may be nil to just use the defaults
+func New(c common.Cmder, o *Opts) *System {
+	if o == nil {
+		o = &Opts{}
+	}
+	return &System{c: c, o: o}
+}
+
+// Key returns a key which can be used to interact with some arbitrary vote
+// data directly in redis. This is useful if more complicated, lower level
+// operations are needed to be done. The users who voted Up and Down on an ID
+// are held in the sets Key(id, "up") and Key(id, "down")
+func (s *System) Key(id string, extra ...string) string {
+	k := "votes:" + s.o.Prefix + ":{" + id + "}"
+	if len(extra) > 0 {
+		k += ":" + strings.Join(extra, ":")
+	}
+	return k
+}
+
+// vote removes ARGV[1] from whichever of the up set KEYS[1] and down set KEYS[2]
+// it isn't voting for, adds it to the one it is according to ARGV[2] (1 for
+// up, -1 for down, 0 for neither), and returns the sizes of both sets
+var vote = `
+	local up, down = KEYS[1], KEYS[2]
+	if ARGV[2] == '1' then
+		redis.call('SREM', down, ARGV[1])
+		redis.call('SADD', up, ARGV[1])
+	elseif ARGV[2] == '-1' then
+		redis.call('SREM', up, ARGV[1])
+		redis.call('SADD', down, ARGV[1])
+	else
+		redis.call('SREM', up, ARGV[1])
+		redis.call('SREM', down, ARGV[1])
+	end
+	return {redis.call('SCARD', up), redis.call('SCARD', down)}
+`
+
+// Vote sets the given user's vote on the given ID, replacing any vote they
+// already had, and returns the ID's new Tally. Voting the same way twice has no
+// further effect
+func (s *System) Vote(id, u string, v Vote) (Tally, error) {
+	if v != Up && v != Down && v != None {
+		return Tally{}, ErrInvalidVote
+	}
+	if s.o.Users != nil && v != None {
+		i, err := s.o.Users.Get(u, user.Private)
+		if err != nil {
+			return Tally{}, err
+		} else if i["Disabled"] != "" {
+			return Tally{}, user.ErrDisabled
+		}
+	}
+	l, err := util.LuaEval(s.c, vote, 2, s.Key(id, "up"), s.Key(id, "down"), u, int(v)).Array()
+	if err != nil {
+		return Tally{}, err
+	}
+	var t Tally
+	if t.Up, err = l[0].Int64(); err != nil {
+		return Tally{}, err
+	}
+	if t.Down, err = l[1].Int64(); err != nil {
+		return Tally{}, err
+	}
+	return t, nil
+}
+
+// Tally returns the Tally of votes on the given ID
+func (s *System) Tally(id string) (Tally, error) {
+	var t Tally
+	var err error
+	if t.Up, err = s.c.Cmd("SCARD", s.Key(id, "up")).Int64(); err != nil {
+		return Tally{}, err
+	}
+	if t.Down, err = s.c.Cmd("SCARD", s.Key(id, "down")).Int64(); err != nil {
+		return Tally{}, err
+	}
+	return t, nil
+}
+
+// Tallies is like Tally, but returns the Tally of each of the given IDs
+func (s *System) Tallies(ids ...string) (map[string]Tally, error) {
+	m := make(map[string]Tally, len(ids))
+	for _, id := range ids {
+		t, err := s.Tally(id)
+		if err != nil {
+			return nil, err
+		}
+		m[id] = t
+	}
+	return m, nil
+}
+
+// userVote returns 1 if ARGV[1] is in the up set KEYS[1], -1 if it's in the
+// down set KEYS[2], and 0 otherwise
+var userVote = `
+	if redis.call('SISMEMBER', KEYS[1], ARGV[1]) == 1 then
+		return 1
+	elseif redis.call('SISMEMBER', KEYS[2], ARGV[1]) == 1 then
+		return -1
+	end
+	return 0
+`
+
+// UserVote returns the given user's vote on the given ID, which is None if they
+// haven't voted on it
+func (s *System) UserVote(id, u string) (Vote, error) {
+	i, err := util.LuaEval(s.c, userVote, 2, s.Key(id, "up"), s.Key(id, "down"), u).Int()
+	return Vote(i), err
+}
+
+// UserVotes is like UserVote, but returns the given user's vote on each of the
+// given IDs, e.g. to show which items in a list they've voted on
+func (s *System) UserVotes(u string, ids ...string) (map[string]Vote, error) {
+	m := make(map[string]Vote, len(ids))
+	for _, id := range ids {
+		v, err := s.UserVote(id, u)
+		if err != nil {
+			return nil, err
+		}
+		m[id] = v
+	}
+	return m, nil
+}
+
+// Voters returns all users who voted the given way on the given ID, in no
+// particular order. v must be Up or Down
+func (s *System) Voters(id string, v Vote) ([]string, error) {
+	switch v {
+	case Up:
+		return s.c.Cmd("SMEMBERS", s.Key(id, "up")).List()
+	case Down:
+		return s.c.Cmd("SMEMBERS", s.Key(id, "down")).List()
+	}
+	return nil, ErrInvalidVote
+}
+
+// Clear removes all votes on the given ID, e.g. because the thing being voted
+// on was deleted
+func (s *System) Clear(id string) error {
+	return s.c.Cmd("DEL", s.Key(id, "up"), s.Key(id, "down")).Err
+}
@@ -0,0 +1,115 @@
+package votes
+
+import (
+	. "testing"
+
+	"github.com/mediocregopher/mediocre-api/common/commontest"
+	"github.com/mediocregopher/mediocre-api/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSystem(t *T) *System {
+	p := commontest.APIStarterKit()
+	return New(p, &Opts{Prefix: commontest.KeyPrefix(t, p)})
+}
+
+func assertVote(t *T, s *System, id, user string, expected Vote) {
+	v, err := s.UserVote(id, user)
+	require.Nil(t, err)
+	assert.Equal(t, expected, v)
+}
+
+func TestVote(t *T) {
+	s := testSystem(t)
+	id, u1, u2 := commontest.RandStr(), commontest.RandStr(), commontest.RandStr()
+
+	tally, err := s.Tally(id)
+	require.Nil(t, err)
+	assert.Equal(t, Tally{}, tally)
+	assertVote(t, s, id, u1, None)
+
+	_, err = s.Vote(id, u1, 2)
+	assert.Equal(t, ErrInvalidVote, err)
+
+	tally, err = s.Vote(id, u1, Up)
+	require.Nil(t, err)
+	assert.Equal(t, Tally{Up: 1}, tally)
+	assertVote(t, s, id, u1, Up)
+
+	// Voting the same way again has no effect
+	tally, err = s.Vote(id, u1, Up)
+	require.Nil(t, err)
+	assert.Equal(t, Tally{Up: 1}, tally)
+
+	tally, err = s.Vote(id, u2, Down)
+	require.Nil(t, err)
+	assert.Equal(t, Tally{Up: 1, Down: 1}, tally)
+	assert.Equal(t, int64(0), tally.Score())
+
+	// Changing a vote moves it
+	tally, err = s.Vote(id, u2, Up)
+	require.Nil(t, err)
+	assert.Equal(t, Tally{Up: 2}, tally)
+	assert.Equal(t, int64(2), tally.Score())
+
+	voters, err := s.Voters(id, Up)
+	require.Nil(t, err)
+	assert.ElementsMatch(t, []string{u1, u2}, voters)
+
+	tally, err = s.Vote(id, u1, None)
+	require.Nil(t, err)
+	assert.Equal(t, Tally{Up: 1}, tally)
+	assertVote(t, s, id, u1, None)
+
+	tally, err = s.Tally(id)
+	require.Nil(t, err)
+	assert.Equal(t, Tally{Up: 1}, tally)
+
+	require.Nil(t, s.Clear(id))
+	tally, err = s.Tally(id)
+	require.Nil(t, err)
+	assert.Equal(t, Tally{}, tally)
+}
+
+func TestMulti(t *T) {
+	s := testSystem(t)
+	id1, id2, id3 := commontest.RandStr(), commontest.RandStr(), commontest.RandStr()
+	u := commontest.RandStr()
+
+	_, err := s.Vote(id1, u, Up)
+	require.Nil(t, err)
+	_, err = s.Vote(id2, u, Down)
+	require.Nil(t, err)
+
+	vm, err := s.UserVotes(u, id1, id2, id3)
+	require.Nil(t, err)
+	assert.Equal(t, map[string]Vote{id1: Up, id2: Down, id3: None}, vm)
+
+	tm, err := s.Tallies(id1, id2, id3)
+	require.Nil(t, err)
+	assert.Equal(t, map[string]Tally{id1: {Up: 1}, id2: {Down: 1}, id3: {}}, tm)
+}
+
+func TestVoteUsers(t *T) {
+	p := commontest.APIStarterKit()
+	us := user.New(p)
+	us.Prefix = commontest.KeyPrefix(t, p)
+	s := New(p, &Opts{Prefix: commontest.KeyPrefix(t, p), Users: us})
+
+	id, u := commontest.RandStr(), commontest.RandStr()
+	_, err := s.Vote(id, u, Up)
+	assert.Equal(t, user.ErrNotFound, err)
+
+	require.Nil(t, us.Create(u, commontest.RandEmail(), commontest.RandStr()))
+	_, err = s.Vote(id, u, Up)
+	require.Nil(t, err)
+
+	require.Nil(t, us.Disable(u))
+	_, err = s.Vote(id, u, Down)
+	assert.Equal(t, user.ErrDisabled, err)
+
+	tally, err := s.Vote(id, u, None)
+	require.Nil(t, err)
+	assert.Equal(t, Tally{}, tally)
+}
@@ -0,0 +1,52 @@
+package xff
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+type ctxKey int
+
+const (
+	protoKey ctxKey = iota
+	clientKey
+)
+
+type client struct {
+	ip    net.IP
+	chain []net.IP
+}
+
+func withClient(r *http.Request, ip net.IP, chain []net.IP) *http.Request {
+	c := client{ip: ip, chain: chain}
+	return r.WithContext(context.WithValue(r.Context(), clientKey, c))
+}
+
+// ClientIP returns the ip of the client which made the request. If the request
+// passed through the xff middleware this is the ip it determined for the
+// client, otherwise it's the ip portion of the request's RemoteAddr. nil is
+// returned if RemoteAddr can't be parsed
+func ClientIP(r *http.Request) net.IP {
+	if c, ok := r.Context().Value(clientKey).(client); ok {
+		return c.ip
+	}
+	return remoteIP(r.RemoteAddr)
+}
+
+// Chain returns the chain of ips the request passed through, starting with the
+// original client as given in the forwarding header and ending with the ip the
+// request came directly from. Entries which couldn't be parsed are left out.
+// The forwarding header is only taken into account if the request passed
+// through the xff middleware and came from a trusted proxy, otherwise the chain
+// only contains the ip portion of RemoteAddr. nil is returned if RemoteAddr
+// can't be parsed
+func Chain(r *http.Request) []net.IP {
+	if c, ok := r.Context().Value(clientKey).(client); ok {
+		return c.chain
+	}
+	if ip := remoteIP(r.RemoteAddr); ip != nil {
+		return []net.IP{ip}
+	}
+	return nil
+}
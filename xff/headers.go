@@ -0,0 +1,67 @@
+package xff
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// DefaultHeaders are the headers which are checked for the client's ip if no
+// Headers are given in Opts, in order of precedence
+var DefaultHeaders = []string{"Forwarded", "X-Forwarded-For", "X-Real-IP"}
+
+// forwardedIPs returns the chain of ips found in the first of the Opts' Headers
+// which is set on the request, or nil if none are. An element will be nil if
+// it couldn't be parsed as an ip (e.g. "unknown" or an obfuscated identifier
+// in a Forwarded header)
+func (o *Opts) forwardedIPs(r *http.Request) []net.IP {
+	for _, header := range o.Headers {
+		vals := r.Header[http.CanonicalHeaderKey(header)]
+		if len(vals) == 0 {
+			continue
+		}
+
+		var raw []string
+		switch http.CanonicalHeaderKey(header) {
+		case "Forwarded":
+			raw = parseForwarded(vals, "for")
+		case "X-Real-Ip":
+			raw = vals[:1]
+		default:
+			raw = strings.Split(strings.Join(vals, ","), ",")
+		}
+
+		ips := make([]net.IP, len(raw))
+		for i := range raw {
+			ips[i] = parseIP(raw[i])
+		}
+		return ips
+	}
+	return nil
+}
+
+// parseForwarded returns the value of the given parameter in each element of
+// the given RFC 7239 Forwarded header values. If an element doesn't have the
+// parameter it is given as an empty string. Any port on the value is removed
+func parseForwarded(vals []string, param string) []string {
+	var ret []string
+	for _, val := range vals {
+		for _, elem := range strings.Split(val, ",") {
+			var found string
+			for _, pair := range strings.Split(elem, ";") {
+				pair = strings.TrimSpace(pair)
+				i := strings.Index(pair, "=")
+				if i < 0 || !strings.EqualFold(pair[:i], param) {
+					continue
+				}
+				found = strings.Trim(pair[i+1:], `"`)
+				if host, _, err := net.SplitHostPort(found); err == nil {
+					found = host
+				}
+				break
+			}
+			ret = append(ret, found)
+		}
+	}
+	return ret
+}
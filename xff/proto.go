@@ -0,0 +1,57 @@
+package xff
+
+import (
+	"net/http"
+	"strings"
+)
+
+// forwardedProto returns the scheme the original request was made with, as
+// given by the proto parameter of a Forwarded header or by X-Forwarded-Proto,
+// in that order of precedence. Empty string is returned if neither is set or
+// they don't contain "http" or "https"
+func forwardedProto(r *http.Request) string {
+	var proto string
+	if fwd := r.Header["Forwarded"]; len(fwd) > 0 {
+		for _, p := range parseForwarded(fwd, "proto") {
+			if p != "" {
+				proto = p
+				break
+			}
+		}
+	}
+	if proto == "" {
+		proto = r.Header.Get("X-Forwarded-Proto")
+		if i := strings.Index(proto, ","); i >= 0 {
+			proto = proto[:i]
+		}
+	}
+
+	proto = strings.ToLower(strings.TrimSpace(proto))
+	if proto != "http" && proto != "https" {
+		return ""
+	}
+	return proto
+}
+
+// Scheme returns the scheme, either "http" or "https", which the client
+// originally made the request with. If the request came through a trusted
+// proxy which set X-Forwarded-Proto or Forwarded, and passed through the xff
+// middleware, the scheme given there is used. Otherwise the scheme is
+// determined by whether or not the request came in over TLS. This is useful
+// for building absolute urls and deciding whether to set Secure on cookies when
+// behind a TLS-terminating load balancer
+func Scheme(r *http.Request) string {
+	if proto, ok := r.Context().Value(protoKey).(string); ok {
+		return proto
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// IsSecure returns whether the client originally made the request over https.
+// See Scheme
+func IsSecure(r *http.Request) bool {
+	return Scheme(r) == "https"
+}
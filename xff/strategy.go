@@ -0,0 +1,61 @@
+package xff
+
+import "net"
+
+// Strategy picks the client's ip out of the chain of ips found in a forwarding
+// header. The chain is in the order given by the header, so the original client
+// is first and the proxy closest to the server is last. An element of the chain
+// will be nil if it couldn't be parsed. The Opts the Strategy is being used
+// with are passed in as well. nil should be returned if no ip in the chain
+// should be used, in which case RemoteAddr is left as-is
+type Strategy func(chain []net.IP, o *Opts) net.IP
+
+// LeftmostPublic is a Strategy which picks the first ip in the chain which
+// isn't a loopback or private address (see the Opts' PrivateCIDRs and
+// AllowPrivateClients). This is the default Strategy. It works regardless of
+// how many proxies are in front of the server, but since the leftmost entries
+// are set by the client it can be spoofed
+func LeftmostPublic(chain []net.IP, o *Opts) net.IP {
+	for _, ip := range chain {
+		if ip == nil || ip.IsLoopback() {
+			continue
+		} else if !o.AllowPrivateClients && o.IsPrivate(ip) {
+			continue
+		}
+		return ip
+	}
+	return nil
+}
+
+// RightmostUntrusted is a Strategy which picks the last ip in the chain which
+// isn't within the Opts' TrustedCIDRs. Since every entry to its right was added
+// by a trusted proxy this ip can't be spoofed, as long as all proxies in front
+// of the server are within TrustedCIDRs
+func RightmostUntrusted(chain []net.IP, o *Opts) net.IP {
+	for i := len(chain) - 1; i >= 0; i-- {
+		if chain[i] == nil {
+			// If an entry can't be parsed then nothing to its left can be
+			// trusted either
+			return nil
+		} else if !o.IsTrusted(chain[i]) {
+			return chain[i]
+		}
+	}
+	return nil
+}
+
+// SkipHops returns a Strategy which skips over the n rightmost ips in the chain
+// and picks the next one. n should be the number of trusted proxies in front of
+// the server, not counting the one requests come directly from. For example,
+// if a load balancer forwards to nginx which forwards to the server n should be
+// 1. Like RightmostUntrusted this can't be spoofed, but doesn't depend on
+// knowing the addresses of the proxies
+func SkipHops(n int) Strategy {
+	return func(chain []net.IP, o *Opts) net.IP {
+		i := len(chain) - 1 - n
+		if i < 0 {
+			return nil
+		}
+		return chain[i]
+	}
+}
@@ -1,35 +1,115 @@
 // Package xff implements a middleware http.Handler which parses any
-// X-Forwarded-For headers it sees in the *http.Request and sets the RemoteAddr
-// to the correct value based on them
+// X-Forwarded-For (or Forwarded, or X-Real-IP) headers it sees in the
+// *http.Request and sets the RemoteAddr to the correct value based on them
 //
 //	s := http.NewServeMux()
 //	// Set Handle and HandleFuncs here
-//	x := xff.NewXFF(s)
+//	x := xff.XFF(s)
 //	// All *http.Request instances in the handlers for s will have the correct
-//	// RemoteAddr field value now
+//	// RemoteAddr field value now, and xff.Scheme can be used to find the
+//	// scheme the client originally used
 //	http.ListenAndServe(":8080", x)
 //
+// These headers are only honored on requests coming directly from a trusted
+// proxy, otherwise any client could set them to pretend to be whoever they
+// like. By default loopback and private addresses are trusted, New can be
+// used to change this
+//
+//	trusted, _ := xff.ParseCIDRs("203.0.113.0/24")
+//	x := xff.New(s, &xff.Opts{TrustedCIDRs: trusted})
+//
 package xff
 
 import (
+	"context"
 	"net"
 	"net/http"
 	"strings"
 )
 
-// Unfortunately go doesn't provide a way to distinguish a v4 net.IP from a v6,
-// so we have to just try all private CIDRs no matter the type
-var internalCIDRs = []*net.IPNet{
+// DefaultPrivateCIDRs are the networks which are considered private if no
+// PrivateCIDRs are given in Opts. Unfortunately go doesn't provide a way to
+// distinguish a v4 net.IP from a v6, so we have to just try all private CIDRs
+// no matter the type
+var DefaultPrivateCIDRs = []*net.IPNet{
 	mustGetCIDRNetwork("10.0.0.0/8"),
 	mustGetCIDRNetwork("172.16.0.0/12"),
 	mustGetCIDRNetwork("192.168.0.0/16"),
 	mustGetCIDRNetwork("169.254.0.0/16"),
-	mustGetCIDRNetwork("169.254.0.0/16"),
 	mustGetCIDRNetwork("fd00::/8"),
 }
 
-func ipIsPrivate(ip net.IP) bool {
-	for _, cidr := range internalCIDRs {
+// DefaultTrustedCIDRs are the networks which proxies are trusted to be in if no
+// TrustedCIDRs are given in Opts. They cover loopback and private addresses
+var DefaultTrustedCIDRs = []*net.IPNet{
+	mustGetCIDRNetwork("127.0.0.0/8"),
+	mustGetCIDRNetwork("::1/128"),
+	mustGetCIDRNetwork("10.0.0.0/8"),
+	mustGetCIDRNetwork("172.16.0.0/12"),
+	mustGetCIDRNetwork("192.168.0.0/16"),
+	mustGetCIDRNetwork("fd00::/8"),
+}
+
+// Opts are different options which may be passed into New. They all have sane
+// defaults which will cover most use cases
+type Opts struct {
+
+	// TrustedCIDRs are the networks which proxies setting X-Forwarded-For are
+	// expected to be in. The header is ignored on any request whose RemoteAddr
+	// isn't in one of these networks. To trust all requests (not recommended
+	// if the server is reachable from the internet) use "0.0.0.0/0" and
+	// "::/0". Defaults to DefaultTrustedCIDRs
+	TrustedCIDRs []*net.IPNet
+
+	// Headers are the headers which will be checked for the client's ip, in
+	// order of precedence. Only the first one which is set on a request is
+	// used. "Forwarded" (RFC 7239), "X-Forwarded-For", and "X-Real-IP" are
+	// supported, any other header is treated like X-Forwarded-For. Defaults to
+	// DefaultHeaders
+	Headers []string
+
+	// Strategy is used to pick the client's ip out of the chain of ips given
+	// in a header. See LeftmostPublic, RightmostUntrusted, and SkipHops.
+	// Defaults to LeftmostPublic
+	Strategy Strategy
+
+	// PrivateCIDRs are the networks which are considered private, and so are
+	// skipped over by LeftmostPublic when looking for the client's ip. Ranges
+	// can be added to or removed from DefaultPrivateCIDRs as needed, and an
+	// empty (but non-nil) slice means no networks are private. Defaults to
+	// DefaultPrivateCIDRs
+	PrivateCIDRs []*net.IPNet
+
+	// AllowPrivateClients causes private addresses to be treated like any
+	// other address when looking for the client's ip, for deployments where
+	// clients legitimately come from private networks, such as corporate
+	// intranets or VPNs. Loopback addresses are still skipped. Defaults to
+	// false
+	AllowPrivateClients bool
+}
+
+// IsTrusted returns whether the given ip is within one of the Opts'
+// TrustedCIDRs
+func (o *Opts) IsTrusted(ip net.IP) bool {
+	cidrs := o.TrustedCIDRs
+	if cidrs == nil {
+		cidrs = DefaultTrustedCIDRs
+	}
+	return cidrsContain(cidrs, ip)
+}
+
+// IsPrivate returns whether the given ip is within one of the Opts'
+// PrivateCIDRs
+func (o *Opts) IsPrivate(ip net.IP) bool {
+	cidrs := o.PrivateCIDRs
+	if cidrs == nil {
+		cidrs = DefaultPrivateCIDRs
+	}
+	return cidrsContain(cidrs, ip)
+}
+
+func cidrsContain(cidrs []*net.IPNet, ip net.IP) bool {
+	for _, cidr := range cidrs {
 		if cidr.Contains(ip) {
 			return true
 		}
@@ -37,40 +117,98 @@ func ipIsPrivate(ip net.IP) bool {
 	return false
 }
 
+// ParseCIDRs parses each of the given strings as a CIDR network, e.g.
+// "10.0.0.0/8", and returns them. This is useful for filling in TrustedCIDRs
+// from configuration
+func ParseCIDRs(cidrs ...string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
 // XFF takes in an http.Handler and wraps it in a new http.Handler which will
 // deal with X-Forwarded-For headers, correctly changing RemoteAddr where
 // appropriate, before passing the request off to the passed in http.Handler.
+// It is the same as calling New with nil Opts.
 func XFF(h http.Handler) http.Handler {
+	return New(h, nil)
+}
+
+// New is like XFF, but the passed in Opts may be used to modify its behavior,
+// or may be nil to just use the defaults
+func New(h http.Handler, o *Opts) http.Handler {
+	if o == nil {
+		o = &Opts{}
+	}
+	if o.Headers == nil {
+		o.Headers = DefaultHeaders
+	}
+	if o.Strategy == nil {
+		o.Strategy = LeftmostPublic
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		defer h.ServeHTTP(w, r)
-		xff := r.Header.Get("X-Forwarded-For")
-		if xff == "" {
-			return
-		}
+		h.ServeHTTP(w, o.apply(r))
+	})
+}
 
-		ips := strings.Split(xff, ",")
-		finalIP := ""
-		for i := range ips {
-			ip := parseIP(ips[i])
-			if ip == nil || ip.IsLoopback() || ipIsPrivate(ip) {
-				continue
-			}
-			finalIP = ip.String()
-			break
-		}
+// apply returns the request with its RemoteAddr and context filled in based on
+// its headers, if it came from a trusted proxy
+func (o *Opts) apply(r *http.Request) *http.Request {
+	peerIP := remoteIP(r.RemoteAddr)
+	if peerIP == nil {
+		return r
+	} else if !o.IsTrusted(peerIP) {
+		return withClient(r, peerIP, []net.IP{peerIP})
+	}
 
-		if finalIP == "" {
-			return
-		}
-		finalNeedsBrackets := (strings.Index(finalIP, ":") >= 0)
+	if proto := forwardedProto(r); proto != "" {
+		r = r.WithContext(context.WithValue(r.Context(), protoKey, proto))
+	}
 
-		port := r.RemoteAddr[strings.LastIndex(r.RemoteAddr, ":")+1:]
-		if finalNeedsBrackets {
-			r.RemoteAddr = "[" + finalIP + "]:" + port
-		} else {
-			r.RemoteAddr = finalIP + ":" + port
+	ips := o.forwardedIPs(r)
+	chain := make([]net.IP, 0, len(ips)+1)
+	for _, ip := range ips {
+		if ip != nil {
+			chain = append(chain, ip)
 		}
-	})
+	}
+	chain = append(chain, peerIP)
+
+	var ip net.IP
+	if len(ips) > 0 {
+		ip = o.Strategy(ips, o)
+	}
+	if ip == nil {
+		return withClient(r, peerIP, chain)
+	}
+	r = withClient(r, ip, chain)
+
+	finalIP := ip.String()
+	finalNeedsBrackets := (strings.Index(finalIP, ":") >= 0)
+
+	port := r.RemoteAddr[strings.LastIndex(r.RemoteAddr, ":")+1:]
+	if finalNeedsBrackets {
+		r.RemoteAddr = "[" + finalIP + "]:" + port
+	} else {
+		r.RemoteAddr = finalIP + ":" + port
+	}
+	return r
+}
+
+// remoteIP returns the ip portion of a RemoteAddr, which will usually but not
+// always have a port on it
+func remoteIP(remoteAddr string) net.IP {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return parseIP(host)
+	}
+	return parseIP(remoteAddr)
 }
 
 // Used because we may want to strip the brackets from an input ip, if there are
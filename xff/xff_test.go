@@ -1,7 +1,9 @@
 package xff
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -35,28 +37,258 @@ func TestXFF(t *T) {
 	testAddr(t, "[::ffff:8.8.8.8]:2000", "[::ffff:8.8.8.8]:2000")
 
 	// IPv4
-	testAddr(t, "8.8.8.8:2000", "1.1.1.1:2000",
+	testAddr(t, "8.8.8.8:2000", "10.0.0.1:2000",
 		"8.8.8.8")
-	testAddr(t, "1.1.1.1:2000", "1.1.1.1:2000",
+	testAddr(t, "10.0.0.1:2000", "10.0.0.1:2000",
 		"127.0.0.1")
-	testAddr(t, "1.1.1.1:2000", "1.1.1.1:2000",
+	testAddr(t, "10.0.0.1:2000", "10.0.0.1:2000",
 		"127.0.0.1", "192.168.1.1")
-	testAddr(t, "8.8.8.8:2000", "1.1.1.1:2000",
+	testAddr(t, "8.8.8.8:2000", "10.0.0.1:2000",
 		"127.0.0.1", "192.168.1.1", "8.8.8.8")
-	testAddr(t, "8.8.8.8:2000", "1.1.1.1:2000",
+	testAddr(t, "8.8.8.8:2000", "10.0.0.1:2000",
 		"127.0.0.1", "192.168.1.1", "8.8.8.8", "9.9.9.9")
 
 	// IPv6
-	testAddr(t, "[1::1]:2000", "1.1.1.1:2000",
+	testAddr(t, "[1::1]:2000", "10.0.0.1:2000",
 		"1::1")
-	testAddr(t, "8.8.8.8:2000", "1.1.1.1:2000",
+	testAddr(t, "8.8.8.8:2000", "10.0.0.1:2000",
 		"::ffff:8.8.8.8")
-	testAddr(t, "1.1.1.1:2000", "1.1.1.1:2000",
+	testAddr(t, "10.0.0.1:2000", "10.0.0.1:2000",
 		"fd00::1")
-	testAddr(t, "1.1.1.1:2000", "1.1.1.1:2000",
+	testAddr(t, "10.0.0.1:2000", "10.0.0.1:2000",
 		"fd00::1", "::1")
-	testAddr(t, "[1::1]:2000", "1.1.1.1:2000",
+	testAddr(t, "[1::1]:2000", "10.0.0.1:2000",
 		"fd00::1", "::1", "1::1")
-	testAddr(t, "[1::1]:2000", "1.1.1.1:2000",
+	testAddr(t, "[1::1]:2000", "10.0.0.1:2000",
 		"fd00::1", "::1", "1::1", "2::2")
 }
+
+func TestUntrusted(t *T) {
+	// 1.1.1.1 isn't a trusted proxy by default, so its X-Forwarded-For is
+	// ignored
+	testAddr(t, "1.1.1.1:2000", "1.1.1.1:2000", "8.8.8.8")
+	testAddr(t, "[2::2]:2000", "[2::2]:2000", "8.8.8.8")
+	testAddr(t, "[::1]:2000", "[::1]:2000", "192.168.1.1")
+	testAddr(t, "8.8.8.8:2000", "[::1]:2000", "8.8.8.8")
+
+	trusted, err := ParseCIDRs("1.1.1.0/24")
+	require.Nil(t, err)
+	h := New(http.HandlerFunc(echoRemoteAddr), &Opts{TrustedCIDRs: trusted})
+
+	for addrIn, addrExpect := range map[string]string{
+		"1.1.1.1:2000":  "8.8.8.8:2000",
+		"10.0.0.1:2000": "10.0.0.1:2000",
+	} {
+		r, err := http.NewRequest("GET", "/", nil)
+		require.Nil(t, err)
+		r.RemoteAddr = addrIn
+		r.Header.Set("X-Forwarded-For", "8.8.8.8")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, addrExpect, w.Body.String())
+	}
+
+	_, err = ParseCIDRs("1.1.1.1")
+	assert.NotNil(t, err)
+}
+
+func TestHeaders(t *T) {
+	doReq := func(h http.Handler, hdrs ...string) string {
+		r, err := http.NewRequest("GET", "/", nil)
+		require.Nil(t, err)
+		r.RemoteAddr = "10.0.0.1:2000"
+		for i := 0; i < len(hdrs); i += 2 {
+			r.Header.Add(hdrs[i], hdrs[i+1])
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Body.String()
+	}
+
+	h := XFF(http.HandlerFunc(echoRemoteAddr))
+	assert.Equal(t, "8.8.8.8:2000", doReq(h, "X-Real-IP", "8.8.8.8"))
+	assert.Equal(t, "8.8.8.8:2000", doReq(h,
+		"Forwarded", `for=192.168.1.1;proto=https, for="8.8.8.8:1234"`,
+	))
+	assert.Equal(t, "[1::1]:2000", doReq(h,
+		"Forwarded", `for=unknown`,
+		"Forwarded", `For="[1::1]:1234";by=10.0.0.1`,
+	))
+
+	// Forwarded takes precedence over X-Forwarded-For, which takes precedence
+	// over X-Real-IP
+	assert.Equal(t, "8.8.8.8:2000", doReq(h,
+		"X-Real-IP", "9.9.9.9",
+		"X-Forwarded-For", "8.8.8.8",
+	))
+	assert.Equal(t, "7.7.7.7:2000", doReq(h,
+		"X-Real-IP", "9.9.9.9",
+		"X-Forwarded-For", "8.8.8.8",
+		"Forwarded", "for=7.7.7.7",
+	))
+
+	// The order can be changed, and the first header which is set is used even
+	// if it doesn't end up containing a public ip
+	h = New(http.HandlerFunc(echoRemoteAddr), &Opts{
+		Headers: []string{"X-Real-IP", "X-Forwarded-For"},
+	})
+	assert.Equal(t, "9.9.9.9:2000", doReq(h,
+		"X-Real-IP", "9.9.9.9",
+		"X-Forwarded-For", "8.8.8.8",
+	))
+	assert.Equal(t, "10.0.0.1:2000", doReq(h,
+		"X-Real-IP", "192.168.1.1",
+		"X-Forwarded-For", "8.8.8.8",
+	))
+	assert.Equal(t, "10.0.0.1:2000", doReq(h, "Forwarded", "for=7.7.7.7"))
+}
+
+func TestStrategy(t *T) {
+	trusted, err := ParseCIDRs("10.0.0.0/8", "2.2.2.0/24")
+	require.Nil(t, err)
+
+	ips := func(strs ...string) []net.IP {
+		ret := make([]net.IP, len(strs))
+		for i := range strs {
+			ret[i] = parseIP(strs[i])
+		}
+		return ret
+	}
+
+	o := &Opts{TrustedCIDRs: trusted}
+	chain := ips("8.8.8.8", "192.168.1.1", "9.9.9.9", "2.2.2.2", "10.0.0.2")
+
+	assert.Equal(t, "8.8.8.8", LeftmostPublic(chain, o).String())
+	assert.Equal(t, "9.9.9.9", RightmostUntrusted(chain, o).String())
+	assert.Nil(t, RightmostUntrusted(ips("8.8.8.8", "garbage", "10.0.0.2"), o))
+	assert.Nil(t, RightmostUntrusted(ips("10.0.0.3", "10.0.0.2"), o))
+	assert.Equal(t, "10.0.0.2", SkipHops(0)(chain, o).String())
+	assert.Equal(t, "2.2.2.2", SkipHops(1)(chain, o).String())
+	assert.Equal(t, "8.8.8.8", SkipHops(4)(chain, o).String())
+	assert.Nil(t, SkipHops(5)(chain, o))
+
+	h := New(http.HandlerFunc(echoRemoteAddr), &Opts{
+		TrustedCIDRs: trusted,
+		Strategy:     RightmostUntrusted,
+	})
+	r, err := http.NewRequest("GET", "/", nil)
+	require.Nil(t, err)
+	r.RemoteAddr = "10.0.0.1:2000"
+	r.Header.Set("X-Forwarded-For", "8.8.8.8, 9.9.9.9, 2.2.2.2")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, "9.9.9.9:2000", w.Body.String())
+}
+
+func TestScheme(t *T) {
+	h := XFF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, Scheme(r))
+	}))
+
+	doReq := func(remoteAddr string, hdrs ...string) string {
+		r, err := http.NewRequest("GET", "/", nil)
+		require.Nil(t, err)
+		r.RemoteAddr = remoteAddr
+		for i := 0; i < len(hdrs); i += 2 {
+			r.Header.Add(hdrs[i], hdrs[i+1])
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Body.String()
+	}
+
+	assert.Equal(t, "http", doReq("10.0.0.1:2000"))
+	assert.Equal(t, "https", doReq("10.0.0.1:2000", "X-Forwarded-Proto", "HTTPS"))
+	assert.Equal(t, "https", doReq("10.0.0.1:2000", "X-Forwarded-Proto", "https, http"))
+	assert.Equal(t, "http", doReq("10.0.0.1:2000", "X-Forwarded-Proto", "gopher"))
+	assert.Equal(t, "https", doReq("10.0.0.1:2000",
+		"Forwarded", "for=8.8.8.8, for=10.0.0.2;proto=https",
+		"X-Forwarded-Proto", "http",
+	))
+
+	// Untrusted peers can't set the scheme
+	assert.Equal(t, "http", doReq("1.1.1.1:2000", "X-Forwarded-Proto", "https"))
+
+	r, err := http.NewRequest("GET", "/", nil)
+	require.Nil(t, err)
+	r.TLS = &tls.ConnectionState{}
+	assert.Equal(t, "https", Scheme(r))
+	assert.True(t, IsSecure(r))
+}
+
+func TestPrivateCIDRs(t *T) {
+	doReq := func(o *Opts, forwards string) string {
+		h := New(http.HandlerFunc(echoRemoteAddr), o)
+		r, err := http.NewRequest("GET", "/", nil)
+		require.Nil(t, err)
+		r.RemoteAddr = "10.0.0.1:2000"
+		r.Header.Set("X-Forwarded-For", forwards)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Body.String()
+	}
+
+	forwards := "127.0.0.1, 192.168.1.1, 100.64.0.1, 8.8.8.8"
+	assert.Equal(t, "100.64.0.1:2000", doReq(nil, forwards))
+
+	cgnat, err := ParseCIDRs("100.64.0.0/10")
+	require.Nil(t, err)
+	private := append([]*net.IPNet{}, DefaultPrivateCIDRs...)
+	private = append(private, cgnat...)
+	assert.Equal(t, "8.8.8.8:2000", doReq(&Opts{
+		PrivateCIDRs: private,
+	}, forwards))
+
+	assert.Equal(t, "192.168.1.1:2000", doReq(&Opts{
+		PrivateCIDRs: []*net.IPNet{},
+	}, forwards))
+
+	assert.Equal(t, "192.168.1.1:2000", doReq(&Opts{
+		AllowPrivateClients: true,
+	}, forwards))
+}
+
+func TestClientIP(t *T) {
+	var ip net.IP
+	var chain []net.IP
+	h := XFF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, chain = ClientIP(r), Chain(r)
+	}))
+
+	doReq := func(remoteAddr, forwards string) {
+		r, err := http.NewRequest("GET", "/", nil)
+		require.Nil(t, err)
+		r.RemoteAddr = remoteAddr
+		if forwards != "" {
+			r.Header.Set("X-Forwarded-For", forwards)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	strs := func(ips []net.IP) []string {
+		ret := make([]string, len(ips))
+		for i := range ips {
+			ret[i] = ips[i].String()
+		}
+		return ret
+	}
+
+	doReq("10.0.0.1:2000", "8.8.8.8, garbage, 192.168.1.1")
+	assert.Equal(t, "8.8.8.8", ip.String())
+	assert.Equal(t, []string{"8.8.8.8", "192.168.1.1", "10.0.0.1"}, strs(chain))
+
+	doReq("10.0.0.1:2000", "192.168.1.1")
+	assert.Equal(t, "10.0.0.1", ip.String())
+	assert.Equal(t, []string{"192.168.1.1", "10.0.0.1"}, strs(chain))
+
+	doReq("[1::1]:2000", "8.8.8.8")
+	assert.Equal(t, "1::1", ip.String())
+	assert.Equal(t, []string{"1::1"}, strs(chain))
+
+	// Without the middleware RemoteAddr is used
+	r, err := http.NewRequest("GET", "/", nil)
+	require.Nil(t, err)
+	r.RemoteAddr = "8.8.8.8:2000"
+	assert.Equal(t, "8.8.8.8", ClientIP(r).String())
+	assert.Equal(t, []string{"8.8.8.8"}, strs(Chain(r)))
+}